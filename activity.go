@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/internal/textfmt"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：activity 命令 ---------- */
+
+// activity 显示服务端最近完成的操作；-follow 时按 -interval 轮询，带回上次的序号，只显示新的条目
+func (c *clientCmd) activity(args []string) {
+	fs := newFlagSet("client activity")
+	n := fs.Int("n", 50, "number of recent operations to show")
+	follow := fs.Bool("follow", false, "keep polling and print new operations as they complete")
+	interval := fs.Duration("interval", 2*time.Second, "with -follow, how often to poll")
+	asJSON := fs.Bool("json", false, "print each operation as a JSON object on its own line")
+	parseFlags(fs, args)
+	if *n <= 0 || *interval <= 0 {
+		usageFail("-n and -interval must be positive")
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	res, err := cl.Activity("", nil, *n)
+	if err != nil {
+		c.fail(err)
+	}
+	c.printActivity(res.Entries, *asJSON)
+	if !*follow {
+		return
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	tick := time.NewTicker(*interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+		}
+		// 一次取不完时接着取，直到追上服务端
+		for more := true; more; {
+			since := res.Last
+			next, err := cl.Activity(res.Run, &since, *n)
+			if err != nil {
+				c.fail(err)
+			}
+			if next.Gap {
+				fmt.Fprintln(os.Stderr, i18n.T("status.activity_gap"))
+			}
+			c.printActivity(next.Entries, *asJSON)
+			res, more = next, next.More
+		}
+	}
+}
+
+func (c *clientCmd) printActivity(entries []client.ActivityEntry, asJSON bool) {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			enc.Encode(e)
+		}
+		return
+	}
+	t := textfmt.NewTable(os.Stdout, textfmt.Left, textfmt.Left, textfmt.Right)
+	for _, e := range entries {
+		size := "-"
+		if e.Action != "delete" {
+			size = c.format.Size(e.Size)
+		}
+		t.Row(c.format.Time(e.Time), e.Action, size, e.Path, e.Token)
+	}
+	t.Flush()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"wsbox/internal/i18n"
+)
+
+/* ---------- 客户端：append 命令（追加上传） ---------- */
+
+// append 把本地文件或标准输入追加到远程文件末尾，用于持续发送日志：每次只发送新增的部分。
+// 追加不是幂等的，失败时不自动重试（服务端在失败时不写入任何内容，调用方可以放心重发同一段）
+
+// appendResult 是全局 -json 时 append 成功后的输出
+type appendResult struct {
+	Path       string `json:"path"`
+	Appended   int64  `json:"appended"`
+	Size       int64  `json:"size"`
+	DurationMS int64  `json:"duration_ms"`
+	SHA256     string `json:"sha256,omitempty"`
+}
+
+func (c *clientCmd) append(args []string) {
+	fs := newFlagSet("client append")
+	noVerify := fs.Bool("no-verify", false, "skip the SHA-256 check of the appended content")
+	headers := c.registerHeaders(fs)
+	progress := c.registerProgress(fs)
+	args = parseFlags(fs, args)
+	c.verify = !*noVerify
+	if err := headers(); err != nil {
+		usageFail("-header:", err)
+	}
+	if err := progress(); err != nil {
+		usageFail(err)
+	}
+	switch {
+	case len(args) < 1:
+		usageFail(i18n.T("usage.missing_local"))
+	case len(args) < 2:
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+	local, remote := args[0], path.Join("/", args[1])
+
+	var in io.Reader = os.Stdin
+	if local != stdioArg {
+		f, err := os.Open(local)
+		if err != nil {
+			c.fail(err)
+		}
+		defer f.Close()
+		if fi, err := f.Stat(); err == nil && fi.IsDir() {
+			usageFail(i18n.T("status.dir_upload", local))
+		}
+		in = f
+	}
+	c.transfer = c.newTransferProgress("upload", remote)
+	cl := c.dial()
+	defer cl.Close()
+	start := time.Now()
+	res, st, err := cl.Append(remote, in)
+	if c.verbose && st.Verified {
+		fmt.Fprintln(os.Stderr, i18n.T("status.verified"))
+	}
+	if err != nil {
+		c.fail(err)
+	}
+	elapsed := time.Since(start)
+	c.noteTransfer(st.Bytes, elapsed)
+	switch {
+	case c.json:
+		printJSON(appendResult{Path: res.Path, Appended: res.Appended, Size: res.Size, DurationMS: elapsed.Milliseconds(), SHA256: st.SHA256})
+	case c.progress != progressJSON:
+		fmt.Println(i18n.T("status.append_done", c.format.Size(res.Appended), res.Path, c.format.Size(res.Size)))
+	}
+}
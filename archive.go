@@ -0,0 +1,401 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"wsbox/internal/i18n"
+	"wsbox/internal/protocol"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：打包下载 ---------- */
+
+// archiveFlags 是 get -archive 和 get -r -as-archive 共用的标志
+type archiveFlags struct {
+	format   string
+	symlinks string
+}
+
+func (a *archiveFlags) options() (client.ArchiveOptions, error) {
+	switch a.symlinks {
+	case "skip", "store":
+	default:
+		return client.ArchiveOptions{}, fmt.Errorf("-symlinks must be skip or store, not %q", a.symlinks)
+	}
+	switch a.format {
+	case "", protocol.ArchiveTarGz, protocol.ArchiveZip:
+	default:
+		return client.ArchiveOptions{}, fmt.Errorf("-format must be tgz or zip, not %q", a.format)
+	}
+	return client.ArchiveOptions{Format: a.format, StoreSymlinks: a.symlinks == "store"}, nil
+}
+
+// getArchive 实现 "get -archive <remoteDir> [out]"：服务端把目录打包成一个流，原样保存为 out。
+// 没有给出 -format 时按 out 的扩展名选择，.zip 为 zip，其余为 tar.gz；out 为 "-" 时写到标准输出。
+// 先写到 out+client.PartSuffix，完整收到后再改名，失败时删除（打包的流不能续传）
+func (c *clientCmd) getArchive(remote, out string, flags archiveFlags) {
+	opts, err := flags.options()
+	if err != nil {
+		usageFail(err)
+	}
+	remote = path.Join("/", remote)
+	if opts.Format == "" {
+		opts.Format = protocol.ArchiveTarGz
+		if strings.HasSuffix(strings.ToLower(out), ".zip") {
+			opts.Format = protocol.ArchiveZip
+		}
+	}
+	if out == "" {
+		name := path.Base(remote)
+		if name == "/" {
+			name = "sandbox"
+		}
+		out = name + "." + opts.Format
+	}
+
+	var w io.Writer = os.Stdout
+	var part *os.File
+	if out == stdioArg {
+		c.stdoutData = true
+		if c.progress == progressAuto {
+			c.progress = ""
+		}
+	} else {
+		part, err = os.Create(out + client.PartSuffix)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		w = part
+	}
+	fail := func(err error) {
+		printDownloadErr(err)
+		if part != nil {
+			part.Close()
+			os.Remove(part.Name())
+		}
+		os.Exit(exitCode(err))
+	}
+
+	c.transfer = c.newTransferProgress("download", remote)
+	cl := c.dial()
+	defer cl.Close()
+	sum, err := cl.DownloadArchive(remote, opts, w)
+	if err != nil {
+		fail(err)
+	}
+	if part != nil {
+		if err := part.Close(); err != nil {
+			fail(err)
+		}
+		if err := os.Rename(part.Name(), out); err != nil {
+			fail(err)
+		}
+	}
+	c.reportArchive(sum)
+	if out != stdioArg && c.progress != progressJSON {
+		fmt.Println(i18n.T("status.archive_done", out, sum.Files, c.format.Size(sum.Bytes)))
+	}
+}
+
+// printDownloadErr 与单个文件的下载一样报告错误：服务端的错误原样输出，其余错误注明是下载失败
+func printDownloadErr(err error) {
+	var re *client.RemoteError
+	if errors.As(err, &re) {
+		fmt.Fprintln(os.Stderr, describeErr(err))
+	} else {
+		fmt.Fprintln(os.Stderr, i18n.T("status.download_failed", describeErr(err)))
+	}
+}
+
+// reportArchive 在 stderr 上提示服务端打包时跳过或读到变化中的文件
+func (c *clientCmd) reportArchive(sum *client.ArchiveSummary) {
+	if sum.Skipped > 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("status.archive_skipped", sum.Skipped))
+	}
+	if sum.Changed > 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("status.archive_changed", sum.Changed))
+	}
+}
+
+// getTreeArchive 实现 "get -r -as-archive <remoteDir> <localDir>"：请求 tar.gz 流，边接收边解到 local，
+// 一个请求代替逐个文件的下载。服务端不支持打包时退回 getTree。返回是否全部成功
+func (c *clientCmd) getTreeArchive(remote, local string, flags archiveFlags, fallback func() bool) bool {
+	opts, err := flags.options()
+	if err != nil {
+		usageFail(err)
+	}
+	if opts.Format == protocol.ArchiveZip {
+		// zip 的目录在文件末尾，不能边收边解
+		usageFail("-as-archive extracts tgz streams only")
+	}
+	opts.Format = protocol.ArchiveTarGz
+	remote = path.Join("/", remote)
+
+	c.transfer = c.newTransferProgress("download", remote)
+	cl := c.dial()
+	defer cl.Close()
+	if caps, err := cl.Caps(); err == nil && !caps.HasFeature("archive") {
+		fmt.Fprintln(os.Stderr, i18n.T("status.archive_fallback"))
+		cl.Close()
+		return fallback()
+	}
+
+	pr, pw := io.Pipe()
+	var st extractStats
+	extracted := make(chan error, 1)
+	go func() {
+		err := extractTarGz(pr, local, &st)
+		if err == nil {
+			// tar 的结束标记之后还有 gzip 的尾部，读完才不会阻塞下载
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(err)
+		extracted <- err
+	}()
+	sum, err := cl.DownloadArchive(remote, opts, pw)
+	pw.CloseWithError(err)
+	// 解包失败时管道以该错误关闭，下载随之以同一个错误结束；下载失败时解包读到的也是下载的错误
+	if xerr := <-extracted; err == nil {
+		err = xerr
+	}
+	if err != nil {
+		printDownloadErr(err)
+		return false
+	}
+	c.reportArchive(sum)
+	fmt.Println(i18n.T("status.tree_fetch_summary", st.files, c.format.Size(st.bytes), sum.Skipped, st.rejected))
+	return st.rejected == 0
+}
+
+/* ---------- 客户端：解开 tar.gz ---------- */
+
+// extractStats 记录解包的结果，rejected 是因为路径不安全而没有解出的条目数
+type extractStats struct {
+	files    int
+	bytes    int64
+	links    int
+	rejected int
+}
+
+// errUnsafeEntry 表示归档条目会写到目标目录之外
+var errUnsafeEntry = errors.New("unsafe entry")
+
+// extractTarGz 把 tar.gz 流解到目录 dest。归档来自服务端，条目名和链接目标都不可信：
+// 绝对路径、含 ".." 或反斜杠的名字、指向 dest 之外的链接、经过符号链接的路径都拒绝并计入 st.rejected，
+// 已存在的同名文件被替换。只有读取归档和写本地文件的错误会中止解包
+func extractTarGz(r io.Reader, dest string, st *extractStats) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	// 收到归档数据之后才创建目标目录，服务端报错时不留下空目录
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = extractEntry(tr, h, dest, st)
+		if errors.Is(err, errUnsafeEntry) {
+			st.rejected++
+			fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", h.Name, err))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractEntry(tr *tar.Reader, h *tar.Header, dest string, st *extractStats) error {
+	name, err := safeEntryName(h.Name)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	if err := checkNoSymlinkParents(dest, name); err != nil {
+		return err
+	}
+	switch h.Typeflag {
+	case tar.TypeDir:
+		if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+			return fmt.Errorf("%w: %s exists and is not a directory", errUnsafeEntry, target)
+		}
+		return os.MkdirAll(target, 0755)
+	case tar.TypeSymlink:
+		if path.IsAbs(h.Linkname) || escapes(path.Join(path.Dir(name), h.Linkname)) {
+			return fmt.Errorf("%w: link target %s leaves the directory", errUnsafeEntry, h.Linkname)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := removeNonDir(target); err != nil {
+			return err
+		}
+		if err := os.Symlink(h.Linkname, target); err != nil {
+			return err
+		}
+		st.links++
+		return nil
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		// 已有的符号链接不能被跟随写到别处，先删掉
+		if err := removeNonDir(target); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, h.FileInfo().Mode().Perm()|0600)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		os.Chtimes(target, h.ModTime, h.ModTime)
+		st.files++
+		st.bytes += n
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported entry type %q", errUnsafeEntry, h.Typeflag)
+}
+
+// safeEntryName 返回清理后的 "/" 分隔相对路径，拒绝会离开目标目录的名字
+func safeEntryName(name string) (string, error) {
+	clean := path.Clean(strings.TrimSuffix(name, "/"))
+	if name == "" || path.IsAbs(name) || strings.Contains(name, `\`) || clean == "." || escapes(clean) || filepath.VolumeName(filepath.FromSlash(clean)) != "" {
+		return "", fmt.Errorf("%w: invalid entry name", errUnsafeEntry)
+	}
+	return clean, nil
+}
+
+// escapes 判断清理后的相对路径是否以 ".." 离开当前目录
+func escapes(clean string) bool {
+	return clean == ".." || strings.HasPrefix(clean, "../")
+}
+
+// checkNoSymlinkParents 确认 dest 下 name 的各级父目录都不是符号链接，
+// 否则先解出的链接（或本地原有的链接）会把后面的条目带到 dest 之外
+func checkNoSymlinkParents(dest, name string) error {
+	p := dest
+	parts := strings.Split(name, "/")
+	for _, part := range parts[:len(parts)-1] {
+		p = filepath.Join(p, part)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s is a symlink", errUnsafeEntry, p)
+		}
+	}
+	return nil
+}
+
+// removeNonDir 删除 p 处已有的文件或链接，p 是目录时报错
+func removeNonDir(p string) error {
+	fi, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%w: %s is a directory", errUnsafeEntry, p)
+	}
+	return os.Remove(p)
+}
+
+/* ---------- 客户端：解包上传 ---------- */
+
+// archiveFormat 按文件名判断归档格式，无法判断时返回空
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return protocol.ArchiveZip
+	case strings.HasSuffix(lower, ".tgz"), strings.HasSuffix(lower, ".tar.gz"):
+		return protocol.ArchiveTarGz
+	}
+	return ""
+}
+
+// addExtract 实现 "add -extract <archive> [remoteDir]"：上传归档，由服务端解到 remoteDir，
+// 默认是去掉扩展名的归档文件名。archive 为 "-" 时从标准输入读取，此时必须给出 format
+func (c *clientCmd) addExtract(args []string, format string) {
+	local := args[0]
+	if format == "" {
+		format = archiveFormat(local)
+	}
+	if format != protocol.ArchiveTarGz && format != protocol.ArchiveZip {
+		usageFail(i18n.T("status.extract_format", local))
+	}
+	remote := ""
+	if len(args) > 1 {
+		remote = args[1]
+	} else if local != stdioArg {
+		base := filepath.Base(local)
+		lower := strings.ToLower(base)
+		for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+			if strings.HasSuffix(lower, ext) {
+				base = base[:len(base)-len(ext)]
+				break
+			}
+		}
+		remote = base
+	}
+	if remote == "" {
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+	remote = path.Join("/", remote)
+
+	var in io.Reader = os.Stdin
+	if local != stdioArg {
+		f, err := os.Open(local)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+	c.transfer = c.newTransferProgress("upload", remote)
+	cl := c.dial()
+	defer cl.Close()
+	res, st, err := cl.UploadExtract(remote, in, format)
+	if c.verbose && st.Verified {
+		fmt.Fprintln(os.Stderr, i18n.T("status.verified"))
+	}
+	if err != nil {
+		c.fail(err)
+	}
+	if res.Skipped > 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("status.extract_skipped", res.Skipped))
+	}
+	if c.progress != progressJSON {
+		fmt.Println(i18n.T("status.extract_done", res.Files, c.format.Size(res.Bytes), remote))
+	}
+}
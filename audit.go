@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"wsbox/pkg/server"
+)
+
+/* ---------- 服务端：配置安全审计 ---------- */
+
+// runAudit 实现 "wsbox server audit"，接受与 "wsbox server" 相同的标志
+func runAudit(args []string) {
+	fs := newFlagSet("server audit")
+	build := serverFlags(fs)
+	asJSON := fs.Bool("json", false, "print the findings as JSON")
+	fs.Parse(args)
+	cfg, _ := build()
+	s, err := server.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !printAudit(os.Stdout, s.Audit(), *asJSON) {
+		os.Exit(1)
+	}
+}
+
+// printAudit 输出审计发现，没有高危发现时返回 true
+func printAudit(w io.Writer, report server.AuditReport, asJSON bool) bool {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return report.OK
+	}
+	if len(report.Findings) == 0 {
+		fmt.Fprintln(w, "audit: no findings")
+		return true
+	}
+	for _, f := range report.Findings {
+		fmt.Fprintf(w, "[%s] %s: %s\n", strings.ToUpper(f.Severity), f.Code, f.Message)
+		for _, p := range f.Paths {
+			fmt.Fprintf(w, "         %s\n", p)
+		}
+		if f.Hint != "" {
+			fmt.Fprintf(w, "         hint: %s\n", f.Hint)
+		}
+	}
+	if !report.OK {
+		fmt.Fprintln(w, "audit: high-severity findings present")
+	}
+	return report.OK
+}
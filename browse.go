@@ -0,0 +1,576 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：交互式浏览 ---------- */
+
+// browse 是一个只读的双栏终端界面：左栏是目录条目，右栏是选中条目的详情和开头内容的预览。
+// 所有数据都通过客户端库获取，连接断开时自动重连一次。唯一会改动本地文件的操作是下载，覆盖已有文件前需要确认
+
+// previewBytes 是预览读取的最大字节数
+const previewBytes = 4096
+
+// narrowCols 小于它的终端只显示一栏，Tab 在列表和详情之间切换
+const narrowCols = 60
+
+// browser 是 browse 的状态，只在按键循环的协程中访问
+type browser struct {
+	c   *clientCmd
+	cl  *client.Client
+	out *bufio.Writer
+
+	dir     string
+	entries []client.ListEntry
+	view    []int // 通过过滤的条目在 entries 中的下标
+	sel     int   // view 中选中的位置
+	top     int   // 列表第一行显示的位置
+
+	filter    string
+	filtering bool // 正在输入过滤条件
+	detail    bool // 窄终端上显示详情栏
+	stat      map[string]string
+	previews  map[string][]string
+
+	status  string
+	confirm func() // 等待 y 确认的操作
+	copied  []string
+	cols    int
+	rows    int
+}
+
+// browse 实现 client browse [dir]
+func (c *clientCmd) browse(args []string) {
+	dir := "/"
+	if len(args) > 0 {
+		dir = remoteDir(args[0])
+	}
+	if !isTerminal(os.Stdin) || !stdoutIsTerminal {
+		fmt.Fprintln(os.Stderr, i18n.T("browse.no_terminal"))
+		os.Exit(1)
+	}
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	b := &browser{c: c, out: bufio.NewWriter(os.Stdout), dir: dir, previews: map[string][]string{}}
+	if err := b.connect(); err != nil {
+		restore()
+		fmt.Fprintln(os.Stderr, i18n.T("status.dial_failed", describeErr(err)))
+		os.Exit(exitCode(err))
+	}
+	// 备用屏幕，退出后恢复原来的终端内容
+	b.out.WriteString("\x1b[?1049h\x1b[?25l")
+	b.run()
+	b.out.WriteString("\x1b[?25h\x1b[?1049l")
+	b.out.Flush()
+	restore()
+	b.cl.Close()
+	for _, p := range b.copied {
+		fmt.Println(p)
+	}
+}
+
+// remoteDir 规范化远程目录路径
+func remoteDir(p string) string {
+	return path.Clean("/" + p)
+}
+
+// connect 建立连接。不显示进度帧，它们会破坏界面
+func (b *browser) connect() error {
+	opts, err := b.c.dialOptions()
+	if err != nil {
+		return err
+	}
+	cl, err := client.DialContext(context.Background(), b.c.server, b.c.token, opts)
+	if err != nil {
+		return b.c.explainDial(err)
+	}
+	b.cl = cl
+	return nil
+}
+
+// call 执行一次请求，连接已不可用（服务端重启、网络中断）时重连后再试一次。服务端返回的错误状态不重试
+func (b *browser) call(fn func(*client.Client) error) error {
+	err := fn(b.cl)
+	var re *client.RemoteError
+	if err == nil || errors.As(err, &re) {
+		return err
+	}
+	b.cl.Close()
+	if cerr := b.connect(); cerr != nil {
+		return err
+	}
+	return fn(b.cl)
+}
+
+func (b *browser) run() {
+	keys := make(chan string)
+	go readKeys(keys)
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+
+	b.load(b.dir, "")
+	for {
+		b.render()
+		select {
+		case k, ok := <-keys:
+			if !ok || !b.key(k) {
+				return
+			}
+		case <-resize:
+		}
+	}
+}
+
+// readKeys 从标准输入读取按键，一次读到的多个按键（粘贴、快速输入）拆开发送
+func readKeys(keys chan<- string) {
+	buf := make([]byte, 256)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		for _, k := range splitKeys(string(buf[:n])) {
+			keys <- k
+		}
+	}
+}
+
+// splitKeys 把输入拆成按键：转义序列（方向键等）作为一个整体，其余按字符拆分
+func splitKeys(s string) []string {
+	var keys []string
+	for s != "" {
+		if len(s) >= 3 && s[0] == 0x1b && (s[1] == '[' || s[1] == 'O') {
+			i := 2
+			for i < len(s) && !(s[i] >= 'A' && s[i] <= 'Z' || s[i] >= 'a' && s[i] <= 'z' || s[i] == '~') {
+				i++
+			}
+			i = min(i+1, len(s))
+			keys = append(keys, s[:i])
+			s = s[i:]
+			continue
+		}
+		_, n := utf8.DecodeRuneInString(s)
+		keys = append(keys, s[:n])
+		s = s[n:]
+	}
+	return keys
+}
+
+/* ---------- 浏览：数据 ---------- */
+
+// load 列出目录，成功后选中名为 selectName 的条目（返回上级目录时选中刚离开的目录）
+func (b *browser) load(dir, selectName string) {
+	var res *client.LongListResult
+	err := b.call(func(cl *client.Client) (err error) {
+		res, err = cl.ListLong(dir)
+		return err
+	})
+	if err != nil {
+		b.status = describeErr(err)
+		return
+	}
+	entries := res.Entries
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Dir && !entries[j].Dir })
+	b.dir, b.entries, b.filter, b.stat = dir, entries, "", nil
+	b.sel, b.top = 0, 0
+	b.applyFilter()
+	for i, idx := range b.view {
+		if b.entries[idx].Name == selectName {
+			b.sel = i
+		}
+	}
+	b.status = ""
+	if res.Truncated {
+		b.status = i18n.T("browse.truncated", len(entries))
+	}
+}
+
+func (b *browser) applyFilter() {
+	b.view = b.view[:0]
+	f := strings.ToLower(b.filter)
+	for i, e := range b.entries {
+		if strings.Contains(strings.ToLower(e.Name), f) {
+			b.view = append(b.view, i)
+		}
+	}
+	b.sel = min(b.sel, max(len(b.view)-1, 0))
+}
+
+// selected 返回选中的条目，没有条目时返回 nil
+func (b *browser) selected() *client.ListEntry {
+	if len(b.view) == 0 {
+		return nil
+	}
+	return &b.entries[b.view[b.sel]]
+}
+
+func (b *browser) remotePath(e *client.ListEntry) string {
+	return path.Join(b.dir, e.Name)
+}
+
+// preview 返回文件开头内容的预览行，结果在本次浏览中缓存，刷新目录时清空
+func (b *browser) preview(e *client.ListEntry) []string {
+	p := b.remotePath(e)
+	if lines, ok := b.previews[p]; ok {
+		return lines
+	}
+	var data []byte
+	err := b.call(func(cl *client.Client) (err error) {
+		data, err = cl.ReadRange(p, 0, min(e.Size, previewBytes))
+		return err
+	})
+	var lines []string
+	switch {
+	case err != nil:
+		lines = []string{i18n.T("browse.no_preview", describeErr(err))}
+	case len(data) == 0:
+		lines = []string{i18n.T("browse.empty_file")}
+	case !utf8.Valid(trimPartialRune(data)) || strings.ContainsRune(string(data), 0):
+		lines = []string{i18n.T("browse.binary")}
+	default:
+		for _, l := range strings.Split(string(data), "\n") {
+			lines = append(lines, printable(l))
+		}
+	}
+	b.previews[p] = lines
+	return lines
+}
+
+// trimPartialRune 去掉末尾被截断的多字节字符，预览在任意字节处截断
+func trimPartialRune(data []byte) []byte {
+	for i := 0; i < utf8.UTFMax && len(data) > 0; i++ {
+		if utf8.FullRune(data) && utf8.Valid(data) {
+			return data
+		}
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+// printable 把制表符换成空格并去掉其他控制字符，它们会破坏界面
+func printable(s string) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+/* ---------- 浏览：按键 ---------- */
+
+// key 处理一个按键，返回 false 时退出
+func (b *browser) key(k string) bool {
+	if b.confirm != nil {
+		fn := b.confirm
+		b.confirm, b.status = nil, ""
+		if k == "y" || k == "Y" {
+			fn()
+		}
+		return true
+	}
+	if b.filtering {
+		switch k {
+		case "\r", "\n":
+			b.filtering = false
+		case "\x1b":
+			b.filtering, b.filter = false, ""
+			b.applyFilter()
+		case "\x7f", "\b":
+			if b.filter != "" {
+				_, n := utf8.DecodeLastRuneInString(b.filter)
+				b.filter = b.filter[:len(b.filter)-n]
+				b.applyFilter()
+			}
+		case "\x03":
+			return false
+		default:
+			if r, _ := utf8.DecodeRuneInString(k); len(k) == utf8.RuneLen(r) && unicode.IsPrint(r) {
+				b.filter += k
+				b.sel = 0
+				b.applyFilter()
+			}
+		}
+		return true
+	}
+
+	b.status = ""
+	switch k {
+	case "q", "\x03":
+		return false
+	case "k", "\x1b[A", "\x1bOA":
+		b.move(-1)
+	case "j", "\x1b[B", "\x1bOB":
+		b.move(1)
+	case "\x1b[5~":
+		b.move(-b.listRows())
+	case "\x1b[6~":
+		b.move(b.listRows())
+	case "g", "\x1b[H":
+		b.move(-len(b.view))
+	case "G", "\x1b[F":
+		b.move(len(b.view))
+	case "\r", "\n", "l", "\x1b[C", "\x1bOC":
+		if e := b.selected(); e != nil && e.Dir {
+			b.load(b.remotePath(e), "")
+		} else if e != nil {
+			b.detail = true
+		}
+	case "h", "\x7f", "\b", "\x1b[D", "\x1bOD":
+		if b.detail && b.cols < narrowCols {
+			b.detail = false
+		} else if b.dir != "/" {
+			b.load(path.Dir(b.dir), path.Base(b.dir))
+		}
+	case "\t":
+		b.detail = !b.detail
+	case "/":
+		b.filtering = true
+	case "\x1b":
+		b.filter = ""
+		b.applyFilter()
+	case "r":
+		b.previews = map[string][]string{}
+		name := ""
+		if e := b.selected(); e != nil {
+			name = e.Name
+		}
+		b.load(b.dir, name)
+	case "s":
+		b.showStat()
+	case "y":
+		if e := b.selected(); e != nil {
+			p := b.remotePath(e)
+			// OSC 52 让支持它的终端（包括经过 SSH 的）写入本地剪贴板，退出时路径还会输出到标准输出
+			fmt.Fprintf(b.out, "\x1b]52;c;%s\x07", base64.StdEncoding.EncodeToString([]byte(p)))
+			b.copied = append(b.copied, p)
+			b.status = i18n.T("browse.copied", p)
+		}
+	case "d":
+		b.download()
+	}
+	return true
+}
+
+func (b *browser) move(delta int) {
+	b.sel = max(min(b.sel+delta, len(b.view)-1), 0)
+	b.stat = nil
+}
+
+// showStat 查询选中条目的 stat 信息并显示在详情栏
+func (b *browser) showStat() {
+	e := b.selected()
+	if e == nil {
+		return
+	}
+	var info *client.StatInfo
+	err := b.call(func(cl *client.Client) (err error) {
+		info, err = cl.Stat(b.remotePath(e))
+		return err
+	})
+	if err != nil {
+		b.status = describeErr(err)
+		return
+	}
+	b.stat = map[string]string{
+		"exists":   fmt.Sprint(info.Exists),
+		"dir":      fmt.Sprint(info.IsDir),
+		"size":     b.c.format.Size(info.Size),
+		"modified": b.c.format.Time(info.ModTime),
+	}
+	b.detail = true
+}
+
+// download 把选中的文件下载到当前目录，已有同名文件时先确认
+func (b *browser) download() {
+	e := b.selected()
+	if e == nil {
+		return
+	}
+	if e.Dir {
+		b.status = i18n.T("browse.dir_download")
+		return
+	}
+	remote, local := b.remotePath(e), filepath.Base(e.Name)
+	fetch := func() {
+		b.status = i18n.T("browse.downloading", remote)
+		b.render()
+		var st client.TransferStats
+		err := b.call(func(cl *client.Client) (err error) {
+			st, err = cl.DownloadFile(remote, local, nil)
+			return err
+		})
+		if err != nil {
+			b.status = describeErr(err)
+			return
+		}
+		b.status = i18n.T("browse.downloaded", local, b.c.format.Size(st.Size))
+	}
+	if _, err := os.Lstat(local); err == nil {
+		b.status = i18n.T("browse.overwrite", local)
+		b.confirm = fetch
+		return
+	}
+	fetch()
+}
+
+/* ---------- 浏览：绘制 ---------- */
+
+// listRows 是列表区域的行数：减去标题、状态和帮助三行
+func (b *browser) listRows() int {
+	return max(b.rows-3, 1)
+}
+
+func (b *browser) render() {
+	b.cols, b.rows = 80, 24
+	if cols, rows, err := terminalSize(int(os.Stdout.Fd())); err == nil && cols > 0 && rows > 0 {
+		b.cols, b.rows = cols, rows
+	}
+	w := b.out
+	w.WriteString("\x1b[H\x1b[2J")
+	if b.rows < 4 || b.cols < 20 {
+		w.WriteString(fit(i18n.T("browse.too_small"), b.cols))
+		w.Flush()
+		return
+	}
+
+	n := b.listRows()
+	if b.sel < b.top {
+		b.top = b.sel
+	}
+	if b.sel >= b.top+n {
+		b.top = b.sel - n + 1
+	}
+	var left, right []string
+	for i := b.top; i < len(b.view) && i < b.top+n; i++ {
+		left = append(left, b.entryLine(i))
+	}
+	if len(b.view) == 0 {
+		left = append(left, "  "+i18n.T("browse.no_entries"))
+	}
+	right = b.detailLines()
+
+	header := fmt.Sprintf(" wsbox %s  %s", b.dir, i18n.T("browse.count", len(b.view), len(b.entries)))
+	w.WriteString("\x1b[7m" + fit(header, b.cols) + "\x1b[0m\r\n")
+	split := b.cols >= narrowCols
+	leftW := b.cols
+	if split {
+		leftW = b.cols * 2 / 5
+	}
+	for row := 0; row < n; row++ {
+		switch {
+		case split:
+			w.WriteString(b.highlight(row, fit(at(left, row), leftW)))
+			w.WriteString("\x1b[2m│\x1b[0m")
+			w.WriteString(fit(at(right, row), b.cols-leftW-1))
+		case b.detail:
+			w.WriteString(fit(at(right, row), b.cols))
+		default:
+			w.WriteString(b.highlight(row, fit(at(left, row), b.cols)))
+		}
+		w.WriteString("\r\n")
+	}
+
+	status := b.status
+	if b.filtering || b.filter != "" {
+		status = "/" + b.filter
+		if b.filtering {
+			status += "_"
+		}
+	}
+	w.WriteString(fit(status, b.cols) + "\r\n")
+	w.WriteString("\x1b[2m" + fit(i18n.T("browse.help"), b.cols) + "\x1b[0m")
+	w.Flush()
+}
+
+// highlight 以反色显示选中的行
+func (b *browser) highlight(row int, s string) string {
+	if b.top+row == b.sel && len(b.view) > 0 {
+		return "\x1b[7m" + s + "\x1b[0m"
+	}
+	return s
+}
+
+func (b *browser) entryLine(i int) string {
+	e := b.entries[b.view[i]]
+	if e.Dir {
+		return " " + printable(e.Name) + "/"
+	}
+	return " " + printable(e.Name)
+}
+
+// detailLines 是详情栏的内容：条目的属性，文件还有开头内容的预览
+func (b *browser) detailLines() []string {
+	e := b.selected()
+	if e == nil {
+		return nil
+	}
+	lines := []string{" " + printable(b.remotePath(e))}
+	kind := i18n.T("browse.file")
+	if e.Dir {
+		kind = i18n.T("browse.directory")
+	}
+	lines = append(lines, " "+kind)
+	if !e.Dir {
+		lines = append(lines, " "+i18n.T("browse.size", b.c.format.Size(e.Size)))
+	}
+	if !e.ModTime.IsZero() {
+		lines = append(lines, " "+i18n.T("browse.modified", b.c.format.Time(e.ModTime)))
+	}
+	if e.Mode != "" {
+		lines = append(lines, " "+e.Mode)
+	}
+	if b.stat != nil {
+		lines = append(lines, "", " stat:")
+		for _, k := range []string{"exists", "dir", "size", "modified"} {
+			lines = append(lines, fmt.Sprintf("   %s: %s", k, b.stat[k]))
+		}
+	}
+	if !e.Dir {
+		lines = append(lines, "")
+		for _, l := range b.preview(e) {
+			lines = append(lines, " "+l)
+		}
+	}
+	return lines
+}
+
+func at(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+// fit 把 s 截断或补齐到 w 个字符。与 textfmt 的表格一样按字符数计算宽度
+func fit(s string, w int) string {
+	if w <= 0 {
+		return ""
+	}
+	n := utf8.RuneCountInString(s)
+	if n <= w {
+		return s + strings.Repeat(" ", w-n)
+	}
+	r := []rune(s)
+	return string(r[:w-1]) + "…"
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"wsbox/internal/i18n"
+)
+
+/* ---------- 客户端：仅大小写不同的本地文件名 ---------- */
+
+// get -case-collision 的取值。Linux 上 Readme.md 和 readme.md 是两个文件，
+// 下载到 macOS/Windows 等大小写不敏感的文件系统时会互相覆盖
+const (
+	caseRename    = "rename"
+	caseOverwrite = "overwrite"
+	caseFail      = "fail"
+)
+
+func validCasePolicy(v string, allowed ...string) error {
+	for _, a := range allowed {
+		if v == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid -case-collision %q, expected one of %s", v, strings.Join(allowed, "|"))
+}
+
+// caseCollision 返回 dir 中与 name 仅大小写不同的已有条目，没有时返回空串
+func caseCollision(dir, name string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if e.Name() != name && strings.EqualFold(e.Name(), name) {
+			return e.Name()
+		}
+	}
+	return ""
+}
+
+// caseRenamed 按 "name (case 2).ext" 的格式为本地文件找一个不冲突的名字
+func caseRenamed(dir, name string) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (case %d)%s", stem, i, ext)
+		if _, err := os.Lstat(filepath.Join(dir, candidate)); err == nil {
+			continue
+		}
+		if caseCollision(dir, candidate) == "" {
+			return candidate
+		}
+	}
+}
+
+// resolveLocalCase 在写入本地文件前检查大小写冲突，返回实际写入的路径
+func resolveLocalCase(local, policy string) (string, error) {
+	dir, name := filepath.Split(local)
+	if dir == "" {
+		dir = "."
+	}
+	existing := caseCollision(dir, name)
+	if existing == "" || policy == caseOverwrite {
+		return local, nil
+	}
+	if policy == caseFail {
+		return "", errors.New(i18n.T("status.case_collision", name, existing))
+	}
+	renamed := filepath.Join(filepath.Dir(local), caseRenamed(dir, name))
+	fmt.Fprintln(os.Stderr, i18n.T("status.case_renamed", name, existing, renamed))
+	return renamed, nil
+}
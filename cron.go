@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"wsbox/internal/cron"
+	"wsbox/internal/i18n"
+)
+
+/* ---------- 客户端：cron 命令 ---------- */
+
+// cronCommands 是 cron 可以定时执行的子命令
+var cronCommands = map[string]bool{
+	"list": true, "add": true, "get": true, "delete": true, "lock": true, "test": true, "counts": true, "doctor": true,
+}
+
+// cronRunner 在前台按计划反复执行一个客户端子命令。每次执行都是一个新的子进程，
+// 子命令出错时直接退出进程的行为不会影响调度
+type cronRunner struct {
+	argv       []string // 子进程的完整参数（不含可执行文件）
+	label      string   // 日志中显示的子命令
+	retries    int
+	retryDelay time.Duration
+
+	mu      sync.Mutex
+	running bool
+	cmd     *exec.Cmd // 正在执行的子进程，第二次收到信号时强制结束
+	wg      sync.WaitGroup
+}
+
+func (c *clientCmd) cron(args []string) {
+	fs := newFlagSet("client cron")
+	jitter := fs.Duration("jitter", 30*time.Second, "delay each run by a random amount up to this, to spread load from many clients")
+	retries := fs.Int("retries", 2, "retry a failed run up to this many times, as long as the retry starts before the next scheduled run")
+	retryDelay := fs.Duration("retry-delay", time.Minute, "wait between retries of a failed run")
+	// 不用 parseFlags：spec 之后的参数属于子命令，其中的标志不能被这里解析
+	fs.Parse(args)
+	rest := fs.Args()
+	if len(rest) < 2 {
+		printUsage("client cron")
+		os.Exit(exitUsage)
+	}
+	sched, err := cron.Parse(rest[0])
+	if err != nil {
+		usageFail(err)
+	}
+	if sched.Next(time.Now()).IsZero() {
+		usageFail(fmt.Sprintf("schedule %q never fires", rest[0]))
+	}
+	if !cronCommands[rest[1]] {
+		usageFail(fmt.Sprintf("cron cannot run %q, expected one of: list, add, get, delete, lock, test, counts, doctor", rest[1]))
+	}
+	if *jitter < 0 || *retries < 0 || *retryDelay < 0 {
+		usageFail("-jitter, -retries and -retry-delay must not be negative")
+	}
+
+	r := &cronRunner{
+		argv:       append(append([]string{"-lang", i18n.Lang(), "client"}, c.globals...), rest[1:]...),
+		label:      strings.Join(rest[1:], " "),
+		retries:    *retries,
+		retryDelay: *retryDelay,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("cron: schedule %q, command %q", rest[0], r.label)
+	r.loop(ctx, sched, *jitter)
+}
+
+// loop 等待每个触发时间，上一次执行还没结束时跳过本次。收到信号后不再开始新的执行，
+// 等正在进行的执行结束后返回；再次收到信号时强制结束子进程
+func (r *cronRunner) loop(ctx context.Context, sched *cron.Schedule, jitter time.Duration) {
+	for seq := 1; ; seq++ {
+		next := sched.Next(time.Now())
+		var delay time.Duration
+		if jitter > 0 {
+			delay = rand.N(jitter)
+		}
+		log.Printf("cron: run %d at %s", seq, next.Add(delay).Format("2006-01-02 15:04:05"))
+		t := time.NewTimer(time.Until(next) + delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			r.shutdown()
+			return
+		case <-t.C:
+		}
+		r.mu.Lock()
+		busy := r.running
+		if !busy {
+			r.running = true
+		}
+		r.mu.Unlock()
+		if busy {
+			log.Printf("cron: run=%d status=skipped reason=%q", seq, "previous run still in progress")
+			continue
+		}
+		r.wg.Add(1)
+		go r.run(ctx, seq, sched.Next(time.Now()))
+	}
+}
+
+// shutdown 等待正在进行的执行结束
+func (r *cronRunner) shutdown() {
+	r.mu.Lock()
+	busy := r.running
+	r.mu.Unlock()
+	if busy {
+		log.Printf("cron: stopping, waiting for the current run to finish (signal again to kill it)")
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigs)
+		done := make(chan struct{})
+		go func() { r.wg.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-sigs:
+			r.mu.Lock()
+			if r.cmd != nil && r.cmd.Process != nil {
+				r.cmd.Process.Kill()
+			}
+			r.mu.Unlock()
+			<-done
+		}
+	}
+	log.Printf("cron: stopped")
+}
+
+// run 执行一次子命令，失败时在下一次触发时间之前重试，最后写一行汇总日志
+func (r *cronRunner) run(ctx context.Context, seq int, deadline time.Time) {
+	defer r.wg.Done()
+	defer func() {
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+	start := time.Now()
+	attempts := 0
+	var err error
+	for {
+		attempts++
+		if err = r.exec(); err == nil {
+			break
+		}
+		log.Printf("cron: run=%d attempt=%d error=%q", seq, attempts, err)
+		if attempts > r.retries || !time.Now().Add(r.retryDelay).Before(deadline) || !sleepCtx(ctx, r.retryDelay) {
+			break
+		}
+	}
+	status := "ok"
+	if err != nil {
+		status = "failed"
+	}
+	log.Printf("cron: run=%d status=%s attempts=%d duration=%s command=%q", seq, status, attempts, time.Since(start).Round(time.Millisecond), r.label)
+}
+
+// exec 启动一个子进程执行子命令，子进程的输出直接写到本进程的标准输出和标准错误
+func (r *cronRunner) exec() error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(self, r.argv...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	// 终端的 Ctrl-C 只发给 cron 本身，由它决定是否等待子进程结束
+	detachProcessGroup(cmd)
+	r.mu.Lock()
+	err = cmd.Start()
+	if err == nil {
+		r.cmd = cmd
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	err = cmd.Wait()
+	r.mu.Lock()
+	r.cmd = nil
+	r.mu.Unlock()
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return fmt.Errorf("exit status %d", ee.ExitCode())
+	}
+	return err
+}
+
+// sleepCtx 等待 d，ctx 先结束时返回 false
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
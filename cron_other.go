@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// detachProcessGroup 在非 Unix 平台上不做处理，控制台的 Ctrl-C 会同时送达子进程
+func detachProcessGroup(cmd *exec.Cmd) {}
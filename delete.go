@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：delete 命令 ---------- */
+
+func (c *clientCmd) delete(args []string) {
+	fs := newFlagSet("client delete")
+	recursive := fs.Bool("r", false, "delete directories and their contents")
+	var guard guardFlags
+	guard.registerYes(fs, "with -r, skip the confirmation for a protected profile")
+	args = parseFlags(fs, args)
+	if len(args) < 1 {
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+	remote := args[0]
+	if !strings.HasPrefix(remote, "/") {
+		remote = "/" + remote
+	}
+	if *recursive {
+		if err := guard.confirmProtected(c.profile, c.server, "delete -r "+remote); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	if err := cl.Delete(remote, *recursive); err != nil {
+		var re *client.RemoteError
+		if errors.As(err, &re) {
+			fmt.Fprintln(os.Stderr, describeErr(err))
+		} else {
+			fmt.Fprintln(os.Stderr, i18n.T("status.delete_failed", err))
+		}
+		os.Exit(exitCode(err))
+	}
+	fmt.Println(i18n.T("status.delete_done", remote))
+}
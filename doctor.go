@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/internal/protocol"
+	"wsbox/internal/textfmt"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：连通性诊断 ---------- */
+
+// 诊断结果状态
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// checkResult 是单项检查的结果
+type checkResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Mandatory  bool   `json:"mandatory"`
+	Detail     string `json:"detail,omitempty"`
+	Hint       string `json:"hint,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// doctorReport 是 doctor 命令的完整输出
+type doctorReport struct {
+	SchemaVersion int           `json:"schema_version"`
+	Server        string        `json:"server"`
+	OK            bool          `json:"ok"`
+	Checks        []checkResult `json:"checks"`
+}
+
+// doctor 依次执行各项检查，任一必需检查失败时以非零状态退出
+type doctor struct {
+	c       *clientCmd
+	timeout time.Duration
+	report  doctorReport
+
+	u            *url.URL
+	addr         string
+	cl           *client.Client
+	caps         *client.Capabilities
+	unauthorized bool
+	failed       bool // 前置检查失败后，后续依赖它的检查直接跳过
+}
+
+func (c *clientCmd) doctor(args []string) {
+	fs := newFlagSet("client doctor")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	timeout := fs.Duration("timeout", 5*time.Second, "time limit for each individual check")
+	parseFlags(fs, args)
+
+	u, err := url.Parse(c.server)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("doctor.bad_url", err))
+		os.Exit(1)
+	}
+	u.User = nil
+	d := &doctor{c: c, timeout: *timeout, report: doctorReport{SchemaVersion: protocol.SchemaVersion, Server: u.String(), OK: true}}
+	d.run()
+	if d.cl != nil {
+		d.cl.Close()
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(d.report)
+	} else {
+		d.print()
+	}
+	if !d.report.OK {
+		os.Exit(1)
+	}
+}
+
+func (d *doctor) run() {
+	d.check("url", true, d.checkURL)
+	d.check("dns", true, d.checkDNS)
+	d.check("tcp", true, d.checkTCP)
+	d.check("tls", true, d.checkTLS)
+	d.check("websocket", true, d.checkUpgrade)
+	d.check("auth", true, d.checkAuth)
+	d.check("list", true, d.checkList)
+	d.check("features", false, d.checkFeatures)
+	d.check("clock", false, d.checkClock)
+	d.check("write", true, d.checkWrite)
+}
+
+// check 在限定时间内执行单项检查；超时后不再等待该检查返回
+func (d *doctor) check(name string, mandatory bool, fn func(ctx context.Context) (string, string, string)) {
+	res := checkResult{Name: name, Mandatory: mandatory}
+	start := time.Now()
+	if d.failed {
+		res.Status, res.Detail = checkSkip, "skipped because an earlier check failed"
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		done := make(chan [3]string, 1)
+		go func() {
+			status, detail, hint := fn(ctx)
+			done <- [3]string{status, detail, hint}
+		}()
+		select {
+		case out := <-done:
+			res.Status, res.Detail, res.Hint = out[0], out[1], out[2]
+		case <-ctx.Done():
+			res.Status = checkFail
+			res.Detail = fmt.Sprintf("timed out after %s", d.timeout)
+			res.Hint = "the host may be unreachable or a firewall is dropping packets"
+		}
+		cancel()
+	}
+	res.DurationMs = time.Since(start).Milliseconds()
+
+	if res.Status == checkFail && mandatory {
+		d.report.OK = false
+		d.failed = true
+	}
+	d.report.Checks = append(d.report.Checks, res)
+}
+
+func (d *doctor) print() {
+	fmt.Printf("wsbox doctor: %s\n", d.report.Server)
+	for _, r := range d.report.Checks {
+		took := textfmt.Duration(time.Duration(r.DurationMs) * time.Millisecond)
+		fmt.Printf("[%s] %-10s %s (%s)\n", strings.ToUpper(r.Status), r.Name, r.Detail, took)
+		if r.Hint != "" && (r.Status == checkFail || r.Status == checkWarn) {
+			fmt.Printf("       hint: %s\n", r.Hint)
+		}
+	}
+	if d.report.OK {
+		fmt.Println("all mandatory checks passed")
+	} else {
+		fmt.Println("one or more mandatory checks failed")
+	}
+}
+
+func (d *doctor) checkURL(ctx context.Context) (string, string, string) {
+	u, err := url.Parse(d.c.server)
+	if err != nil {
+		return checkFail, err.Error(), "use the form ws://token@host:port/ws"
+	}
+	port := u.Port()
+	switch u.Scheme {
+	case "ws":
+		if port == "" {
+			port = "80"
+		}
+	case "wss":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return checkFail, fmt.Sprintf("unsupported scheme %q", u.Scheme), "the server url must start with ws:// or wss://"
+	}
+	if u.User == nil {
+		return checkFail, "no token in url", "put the token before the host: ws://token@host:port/ws"
+	}
+	d.u = u
+	d.addr = net.JoinHostPort(u.Hostname(), port)
+	return checkPass, "target " + d.addr, ""
+}
+
+func (d *doctor) checkDNS(ctx context.Context) (string, string, string) {
+	host := d.u.Hostname()
+	if net.ParseIP(host) != nil {
+		return checkPass, "literal address " + host, ""
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return checkFail, err.Error(), "check the hostname spelling and the resolver configuration"
+	}
+	return checkPass, "resolved to " + strings.Join(addrs, ", "), ""
+}
+
+func (d *doctor) checkTCP(ctx context.Context) (string, string, string) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return checkFail, err.Error(), "make sure the server is running and the port is open in the firewall"
+	}
+	conn.Close()
+	return checkPass, "connected to " + d.addr, ""
+}
+
+func (d *doctor) checkTLS(ctx context.Context) (string, string, string) {
+	if d.u.Scheme != "wss" {
+		return checkWarn, "plain ws:// connection, traffic is not encrypted", "enable TLS on the server and use wss://"
+	}
+	cfg, err := d.c.tlsConfig()
+	if err != nil {
+		return checkFail, "-cacert: " + err.Error(), "pass a PEM file containing the CA certificate"
+	}
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg.ServerName = d.u.Hostname()
+	dialer := tls.Dialer{Config: cfg}
+	conn, err := dialer.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return checkFail, err.Error(), "the certificate chain is not trusted or does not match the hostname; use -cacert for a private CA"
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	leaf := certs[0]
+	left := time.Until(leaf.NotAfter)
+	detail := fmt.Sprintf("subject %s, issuer %s, expires %s", leaf.Subject.CommonName, leaf.Issuer.CommonName, leaf.NotAfter.Format(time.DateOnly))
+	if left < 14*24*time.Hour {
+		return checkWarn, detail, "the certificate expires soon, renew it"
+	}
+	if d.c.insecure {
+		return checkWarn, detail, "-insecure skips certificate verification, use -cacert to trust the certificate instead"
+	}
+	return checkPass, detail, ""
+}
+
+func (d *doctor) checkUpgrade(ctx context.Context) (string, string, string) {
+	cl, err := d.c.connect(ctx)
+	if err != nil {
+		var he *client.HandshakeError
+		if errors.As(err, &he) {
+			if he.StatusCode == 401 {
+				// 网关已响应，只是token不对，交给 auth 检查报告
+				d.unauthorized = true
+				return checkPass, "gateway reached, upgrade requires a valid token", ""
+			}
+			return checkFail, "upgrade refused with HTTP " + he.Status, "check the path of the url (usually /ws) and any reverse proxy websocket settings"
+		}
+		return checkFail, err.Error(), "a proxy in between may not support websocket upgrades"
+	}
+	d.cl = cl
+	return checkPass, "upgraded to websocket", ""
+}
+
+func (d *doctor) checkAuth(ctx context.Context) (string, string, string) {
+	if d.unauthorized {
+		return checkFail, "the token was rejected", "check the token printed in the server banner"
+	}
+	return checkPass, "token accepted", ""
+}
+
+func (d *doctor) checkList(ctx context.Context) (string, string, string) {
+	d.setDeadline(ctx)
+	res, err := d.cl.List("/")
+	if err != nil {
+		var re *client.RemoteError
+		if errors.As(err, &re) {
+			return checkFail, fmt.Sprintf("status %d: %s", re.Status, re.Message()), "the sandbox directory may be missing or unreadable on the server"
+		}
+		return checkFail, err.Error(), "the connection was dropped by the server or an intermediary"
+	}
+	return checkPass, fmt.Sprintf("root has %d entries", len(res.Entries)), ""
+}
+
+func (d *doctor) fetchCaps(ctx context.Context) error {
+	if d.caps != nil {
+		return nil
+	}
+	d.setDeadline(ctx)
+	caps, err := d.cl.Caps()
+	if err != nil {
+		return err
+	}
+	d.caps = caps
+	return nil
+}
+
+func (d *doctor) checkFeatures(ctx context.Context) (string, string, string) {
+	if err := d.fetchCaps(ctx); err != nil {
+		return checkWarn, "capabilities unavailable: " + err.Error(), "the server predates capability reporting, upgrade it"
+	}
+	return checkPass, strings.Join(d.caps.Features, ", "), ""
+}
+
+func (d *doctor) checkClock(ctx context.Context) (string, string, string) {
+	d.setDeadline(ctx)
+	est, err := d.cl.ClockOffset(clockSamples)
+	if err != nil {
+		return checkSkip, "server time unavailable", ""
+	}
+	detail := fmt.Sprintf("server clock differs by %s (rtt %s)", est.Offset.Round(time.Millisecond), est.RTT.Round(time.Millisecond))
+	if est.Offset > client.ClockSkewWarn || est.Offset < -client.ClockSkewWarn {
+		return checkWarn, detail, "synchronize both machines with NTP; test -nt/-ot adjusts remote times by the measured offset"
+	}
+	return checkPass, detail, ""
+}
+
+func (d *doctor) checkWrite(ctx context.Context) (string, string, string) {
+	if d.caps == nil || !d.caps.HasFeature("delete") {
+		return checkSkip, "server cannot delete files, skipping to avoid leaving scratch files behind", ""
+	}
+	d.setDeadline(ctx)
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	scratch := "/.wsbox-doctor/" + hex.EncodeToString(b)
+	payload := []byte("wsbox doctor " + scratch)
+
+	if _, err := d.cl.Upload(scratch, bytes.NewReader(payload)); err != nil {
+		return checkFail, "upload failed: " + describeErr(err), "the sandbox may not be writable by the server process"
+	}
+	var got bytes.Buffer
+	if _, err := d.cl.Download(scratch, &got); err != nil {
+		return checkFail, "download failed: " + describeErr(err), "the file was written but could not be read back"
+	}
+	if !bytes.Equal(got.Bytes(), payload) {
+		return checkFail, "downloaded content differs from uploaded content", "an intermediary may be altering binary frames"
+	}
+	if err := d.cl.Delete(scratch, false); err != nil {
+		return checkWarn, "cleanup failed: " + describeErr(err), "remove " + scratch + " from the sandbox manually"
+	}
+	return checkPass, fmt.Sprintf("round-tripped %d bytes via %s", len(payload), scratch), ""
+}
+
+// setDeadline 让websocket读写遵守检查的时间限制
+func (d *doctor) setDeadline(ctx context.Context) {
+	if deadline, ok := ctx.Deadline(); ok {
+		d.cl.SetDeadline(deadline)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"wsbox/internal/clientstate"
+	"wsbox/internal/i18n"
+	"wsbox/internal/protocol"
+	"wsbox/internal/textfmt"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：上传预估 ---------- */
+
+// estimateOptions 是 add -estimate 的参数
+type estimateOptions struct {
+	probe     bool          // 为 false 时不测速，只用保存的吞吐历史（-no-probe）
+	probeSize int64         // 测速发送的总字节数
+	probeTime time.Duration // 测速的最长用时
+	json      bool
+}
+
+// estimateReport 是 add -estimate -json 输出的对象
+type estimateReport struct {
+	SchemaVersion int     `json:"schema_version"`
+	Files         int     `json:"files"`
+	Bytes         int64   `json:"bytes"`
+	Skipped       int     `json:"skipped"`    // 符号链接、设备文件等不会上传的条目
+	OverLimit     int     `json:"over_limit"` // 超过服务端上传大小限制、会被拒绝的文件（已计入 Files）
+	Source        string  `json:"source"`     // 吞吐来源：probe、history，没有可用的测量时为 none
+	MinRate       float64 `json:"min_bytes_per_sec,omitempty"`
+	MaxRate       float64 `json:"max_bytes_per_sec,omitempty"`
+	RTTMillis     int64   `json:"rtt_ms,omitempty"`          // 测速时的往返时延，每个文件计一次
+	ETAMin        float64 `json:"eta_min_seconds,omitempty"` // 按最高吞吐
+	ETAMax        float64 `json:"eta_max_seconds,omitempty"` // 按最低吞吐
+}
+
+// estimateUpload 完成上传的规划（与 add 选择同样的文件，不含 tf 排除的路径），然后测速或读取吞吐历史，输出预计的数据量和用时，不传输文件
+func (c *clientCmd) estimateUpload(local string, fi os.FileInfo, tf *treeFilter, followLinks bool, opts estimateOptions) {
+	cl := c.dial()
+	defer cl.Close()
+	limit, _ := cl.UploadLimit()
+
+	rep := estimateReport{SchemaVersion: protocol.SchemaVersion, Source: "none"}
+	add := func(size int64) {
+		rep.Files++
+		rep.Bytes += size
+		if limit > 0 && size > limit {
+			rep.OverLimit++
+		}
+	}
+	if fi.IsDir() {
+		filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if rel, _ := filepath.Rel(local, p); p != local && tf.skip(filepath.ToSlash(rel), d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			// 与 addTree 相同：符号链接只在 followLinks 且指向普通文件时上传，其他非普通文件跳过
+			if d.Type()&fs.ModeSymlink == 0 && !d.Type().IsRegular() || d.Type()&fs.ModeSymlink != 0 && !followLinks {
+				rep.Skipped++
+				return nil
+			}
+			if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+				add(fi.Size())
+			} else {
+				rep.Skipped++
+			}
+			return nil
+		})
+	} else {
+		add(fi.Size())
+	}
+
+	var rtt time.Duration
+	if opts.probe {
+		p, err := cl.ProbeUpload(opts.probeSize, opts.probeTime)
+		switch {
+		case errors.Is(err, client.ErrBenchUnsupported):
+			fmt.Fprintln(os.Stderr, i18n.T("estimate.probe_unsupported"))
+		case err != nil:
+			c.fail(err)
+		default:
+			rep.Source, rep.MinRate, rep.MaxRate, rtt = "probe", p.Min, p.Max, p.RTT
+			rep.RTTMillis = rtt.Milliseconds()
+			c.recordThroughput((p.Min + p.Max) / 2)
+			if !opts.json {
+				fmt.Fprintln(os.Stderr, i18n.T("estimate.probed", textfmt.Size(p.Bytes), textfmt.Duration(p.Elapsed), textfmt.Duration(p.RTT)))
+			}
+		}
+	}
+	if rep.Source == "none" {
+		if lo, hi, n := c.throughputHistory(); n > 0 {
+			rep.Source, rep.MinRate, rep.MaxRate = "history", lo, hi
+			if !opts.json {
+				fmt.Fprintln(os.Stderr, i18n.T("estimate.from_history", n))
+			}
+		}
+	}
+	if rep.Source != "none" {
+		overhead := time.Duration(rep.Files) * rtt
+		rep.ETAMin = (time.Duration(float64(rep.Bytes)/rep.MaxRate*float64(time.Second)) + overhead).Seconds()
+		rep.ETAMax = (time.Duration(float64(rep.Bytes)/rep.MinRate*float64(time.Second)) + overhead).Seconds()
+	}
+
+	if opts.json {
+		json.NewEncoder(os.Stdout).Encode(rep)
+		return
+	}
+	fmt.Println(i18n.T("estimate.plan", rep.Files, c.format.Size(rep.Bytes), rep.Skipped))
+	if rep.OverLimit > 0 {
+		fmt.Println(i18n.T("estimate.over_limit", rep.OverLimit, c.format.Size(limit)))
+	}
+	if rep.Source == "none" {
+		fmt.Println(i18n.T("estimate.no_throughput"))
+		return
+	}
+	fmt.Println(i18n.T("estimate.throughput", rateString(rep.MinRate), rateString(rep.MaxRate)))
+	fmt.Println(i18n.T("estimate.eta", seconds(rep.ETAMin), seconds(rep.ETAMax)))
+}
+
+func rateString(r float64) string { return textfmt.Size(int64(r)) + "/s" }
+
+func seconds(s float64) string { return textfmt.Duration(time.Duration(s * float64(time.Second))) }
+
+/* ---------- 客户端：吞吐历史 ---------- */
+
+// throughputFile 是客户端状态目录中按服务端保存的上行吞吐历史，-no-probe 时用它预估
+const throughputFile = "throughput.json"
+
+// throughputKeep 是每个服务端保留的最近样本数
+const throughputKeep = 10
+
+// minThroughputSample 小于它的传输主要由往返时延决定，不计入吞吐历史
+const minThroughputSample = 1 << 20
+
+type throughputSample struct {
+	Time        time.Time `json:"time"`
+	BytesPerSec float64   `json:"bytes_per_sec"`
+}
+
+// historyKey 是吞吐历史中服务端的键：去掉其中的token
+func (c *clientCmd) historyKey() string {
+	u, err := url.Parse(c.server)
+	if err != nil {
+		return c.server
+	}
+	u.User = nil
+	return u.String()
+}
+
+// noteTransfer 在一次上传完成后记下它的吞吐
+func (c *clientCmd) noteTransfer(bytes int64, d time.Duration) {
+	if bytes >= minThroughputSample && d > 0 {
+		c.recordThroughput(float64(bytes) / d.Seconds())
+	}
+}
+
+// recordThroughput 追加一个吞吐样本。历史只用于预估，状态目录不可用时静默放弃
+func (c *clientCmd) recordThroughput(rate float64) {
+	dir, err := clientstate.DefaultDir()
+	if err != nil {
+		return
+	}
+	st, err := clientstate.Open(dir)
+	if err != nil {
+		return
+	}
+	history := map[string][]throughputSample{}
+	st.UpdateJSON(throughputFile, &history, func() error {
+		key := c.historyKey()
+		s := append(history[key], throughputSample{Time: time.Now().UTC(), BytesPerSec: rate})
+		history[key] = s[max(len(s)-throughputKeep, 0):]
+		return nil
+	})
+}
+
+// throughputHistory 返回保存的样本中最低和最高的吞吐及样本数
+func (c *clientCmd) throughputHistory() (lo, hi float64, n int) {
+	dir, err := clientstate.DefaultDir()
+	if err != nil {
+		return 0, 0, 0
+	}
+	st, err := clientstate.Open(dir)
+	if err != nil {
+		return 0, 0, 0
+	}
+	history := map[string][]throughputSample{}
+	if st.ReadJSON(throughputFile, &history) != nil {
+		return 0, 0, 0
+	}
+	for i, s := range history[c.historyKey()] {
+		if i == 0 || s.BytesPerSec < lo {
+			lo = s.BytesPerSec
+		}
+		hi = max(hi, s.BytesPerSec)
+		n++
+	}
+	return lo, hi, n
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：退出码 ---------- */
+
+// 客户端命令的退出码，脚本和CI据此区分失败的原因。test 和 find 的退出码沿用 POSIX test 与 grep 的约定，不在此列
+const (
+	exitFailure  = 1 // 其他错误：服务端返回的其他错误状态、本地文件错误、部分文件失败
+	exitUsage    = 2 // 用法错误：缺少参数、无效或冲突的标志，与 flag 包的约定相同
+	exitNotFound = 3 // 远程路径不存在（404）
+	exitAuth     = 4 // 认证失败：token不对、没有权限（401/403）或token被吊销
+	exitConn     = 5 // 无法建立连接（包括代理拒绝）、连接中断或超时
+)
+
+// exitCode 把客户端操作返回的错误映射为退出码，服务端的错误状态取自响应头中的数字状态
+func exitCode(err error) int {
+	var re *client.RemoteError
+	var he *client.HandshakeError
+	var te *client.TimeoutError
+	var pe *client.ProxyError
+	switch {
+	case errors.As(err, &te), errors.As(err, &pe):
+		return exitConn
+	case errors.As(err, &he):
+		if he.StatusCode == http.StatusUnauthorized || he.StatusCode == http.StatusForbidden {
+			return exitAuth
+		}
+		return exitConn
+	case client.IsTokenRevoked(err):
+		return exitAuth
+	case client.IsReadOnly(err):
+		// 只读模式的 403 与token无关，换token也无济于事
+		return exitFailure
+	case errors.As(err, &re):
+		switch re.Status {
+		case http.StatusNotFound:
+			return exitNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitAuth
+		}
+		return exitFailure
+	case client.IsConnectionLost(err):
+		return exitConn
+	}
+	return exitFailure
+}
+
+// dialExitCode 是建立连接失败时的退出码：网关拒绝了token时为 exitAuth，其他原因（地址、网络、TLS）都是 exitConn
+func dialExitCode(err error) int {
+	if exitCode(err) == exitAuth {
+		return exitAuth
+	}
+	return exitConn
+}
+
+// usageFail 输出用法错误并以 exitUsage 退出
+func usageFail(a ...any) {
+	fmt.Fprintln(os.Stderr, a...)
+	os.Exit(exitUsage)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+	"wsbox/pkg/client"
+	"wsbox/pkg/server"
+)
+
+// 设置了 WSBOX_TEST_MAIN 时测试二进制直接作为 wsbox 运行，参数取自这个变量（按换行分隔），
+// 检查退出码和输出的测试通过 runWsbox 重新执行自己
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv("WSBOX_TEST_MAIN"); ok {
+		os.Args = append([]string{"wsbox"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runWsbox 以 args 运行 wsbox，返回退出码、stdout 和 stderr
+func runWsbox(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	return runWsboxStdin(t, "", args...)
+}
+
+// runWsboxStdin 与 runWsbox 相同，标准输入的内容是 stdin
+func runWsboxStdin(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Env = append(os.Environ(), "WSBOX_TEST_MAIN="+strings.Join(args, "\n"), "WSBOX_LANG=en", "HOME="+t.TempDir(), "XDG_CONFIG_HOME=")
+	var out, errOut strings.Builder
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var ee *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &ee):
+		code = ee.ExitCode()
+	default:
+		t.Fatalf("run wsbox %q: %v", args, err)
+	}
+	return code, out.String(), errOut.String()
+}
+
+// closedAddr 返回一个没有监听的本地地址
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestExitCodeUsage(t *testing.T) {
+	server := "ws://" + closedAddr(t) + "/ws"
+	tests := []struct {
+		args   []string
+		want   int
+		stderr string
+	}{
+		{[]string{"client", "-s", server, "-token", "x", "lst", "/"}, exitUsage, "did you mean 'list'"},
+		{[]string{"client", "-s", server, "-token", "x", "no-such-command"}, exitUsage, "unknown command 'no-such-command'"},
+		{[]string{"lst"}, exitUsage, "did you mean 'client list'"},
+		{[]string{"client", "-no-such-flag"}, exitUsage, "-no-such-flag"},
+		{[]string{"client", "-s", server, "-token", "x", "list", "-no-such-flag"}, exitUsage, "-no-such-flag"},
+		{[]string{"client", "-s", server, "-token", "x", "list", "/"}, exitConn, ""},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runWsbox(t, tt.args...)
+		if code != tt.want {
+			t.Errorf("wsbox %s: exit code %d, want %d (stderr %q)", strings.Join(tt.args, " "), code, tt.want, stderr)
+		}
+		if !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("wsbox %s: stderr %q does not mention %q", strings.Join(tt.args, " "), stderr, tt.stderr)
+		}
+	}
+}
+
+func TestExitCodeMapping(t *testing.T) {
+	readOnly := []byte(fmt.Sprintf(`{"code":%q,"message":"server is read-only"}`, protocol.ReadOnlyCode))
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"plain", errors.New("boom"), exitFailure},
+		{"remote 404", &client.RemoteError{Status: http.StatusNotFound}, exitNotFound},
+		{"wrapped remote 404", fmt.Errorf("stat /a: %w", &client.RemoteError{Status: http.StatusNotFound}), exitNotFound},
+		{"remote 401", &client.RemoteError{Status: http.StatusUnauthorized}, exitAuth},
+		{"remote 403", &client.RemoteError{Status: http.StatusForbidden}, exitAuth},
+		{"read-only 403", &client.RemoteError{Status: http.StatusForbidden, Body: readOnly}, exitFailure},
+		{"remote 500", &client.RemoteError{Status: http.StatusInternalServerError}, exitFailure},
+		{"handshake 401", &client.HandshakeError{StatusCode: http.StatusUnauthorized}, exitAuth},
+		{"handshake 502", &client.HandshakeError{StatusCode: http.StatusBadGateway}, exitConn},
+		{"timeout", &client.TimeoutError{Phase: "read"}, exitConn},
+		{"proxy", &client.ProxyError{Proxy: "http://proxy", Reason: "407 Proxy Authentication Required"}, exitConn},
+		{"token revoked", &websocket.CloseError{Code: protocol.CloseTokenRevoked}, exitAuth},
+		{"connection closed", &websocket.CloseError{Code: websocket.CloseAbnormalClosure}, exitConn},
+		{"unexpected EOF", io.ErrUnexpectedEOF, exitConn},
+		{"local file", &os.PathError{Op: "open", Path: "a.txt", Err: os.ErrNotExist}, exitFailure},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if got := dialExitCode(errors.New("dial tcp: connection refused")); got != exitConn {
+		t.Errorf("dialExitCode(refused) = %d, want %d", got, exitConn)
+	}
+	if got := dialExitCode(&client.HandshakeError{StatusCode: http.StatusUnauthorized}); got != exitAuth {
+		t.Errorf("dialExitCode(401) = %d, want %d", got, exitAuth)
+	}
+}
+
+// "wsbox server audit" 在有高危发现时以非零状态退出，-json 输出可以解析的报告
+func TestServerAuditExit(t *testing.T) {
+	dir := t.TempDir()
+	os.Chmod(dir, 0o755)
+	code, stdout, _ := runWsbox(t, "server", "audit", "-addr", "127.0.0.1:8080", "-dir", dir, "-json")
+	var report server.AuditReport
+	decodeOne(t, "server audit -json", stdout, &report)
+	if code != 0 || !report.OK {
+		t.Errorf("clean configuration: exit %d, %+v", code, report)
+	}
+
+	code, stdout, _ = runWsbox(t, "server", "audit", "-addr", ":8080", "-dir", dir, "-token", "secret")
+	if code == 0 || !strings.Contains(stdout, "[HIGH] TOKEN_WEAK") || !strings.Contains(stdout, "[HIGH] TLS_DISABLED") {
+		t.Errorf("weak token on a clear-text listener: exit %d\n%s", code, stdout)
+	}
+}
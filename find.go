@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：find 命令 ---------- */
+
+// find 的退出码与 grep 相同：0 有匹配，1 没有匹配，2 出错
+const (
+	findNoMatch = 1
+	findError   = 2
+)
+
+// find 在服务端查找名字匹配的条目，每行输出一个远程路径（dir 加上相对路径，目录以 "/" 结尾），
+// 可以直接交给 get 等命令。结果被截断时在 stderr 提示，已有的匹配照常输出
+func (c *clientCmd) find(args []string) {
+	fs := newFlagSet("client find")
+	regex := fs.Bool("regex", false, "treat the pattern as a regular expression matched against the path relative to dir")
+	typ := fs.String("type", "", "only files (f) or only directories (d)")
+	maxDepth := fs.Int("maxdepth", 0, "descend at most `n` levels below dir, 1 = its direct entries (0 = unlimited)")
+	limit := fs.Int("n", 0, "stop after `n` matches (0 = the server's -find-limit)")
+	nul := fs.Bool("0", false, "separate paths with NUL bytes instead of newlines (for xargs -0)")
+	asJSON := fs.Bool("json", false, "print the raw result as JSON")
+	rest := parseFlags(fs, args)
+	if len(rest) != 2 {
+		printUsage("client find")
+		os.Exit(findError)
+	}
+	if *typ != "" && *typ != "f" && *typ != "d" {
+		fmt.Fprintln(os.Stderr, i18n.T("find.bad_type"))
+		os.Exit(findError)
+	}
+	if *maxDepth < 0 || *limit < 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("find.negative"))
+		os.Exit(findError)
+	}
+	dir := rest[0]
+
+	cl, err := c.connect(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("status.dial_failed", err))
+		os.Exit(findError)
+	}
+	defer cl.Close()
+	res, err := cl.Find(dir, client.FindOptions{Pattern: rest[1], Regex: *regex, Type: *typ, MaxDepth: *maxDepth, Limit: *limit})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, describeErr(err))
+		cl.Close()
+		os.Exit(findError)
+	}
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(res)
+	} else {
+		paths := make([]string, len(res.Matches))
+		for i, m := range res.Matches {
+			paths[i] = path.Join(dir, m)
+			if strings.HasSuffix(m, "/") {
+				paths[i] += "/"
+			}
+		}
+		writeRecords(os.Stdout, paths, *nul)
+	}
+	if res.Warning != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("find.incomplete", res.Warning.Message))
+	}
+	if len(res.Matches) == 0 {
+		cl.Close()
+		os.Exit(findNoMatch)
+	}
+}
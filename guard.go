@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"wsbox/internal/clientconfig"
+	"wsbox/internal/i18n"
+	"wsbox/internal/textfmt"
+)
+
+/* ---------- 客户端：危险调用的防护 ---------- */
+
+// forceFlag 允许以 /、家目录或当前目录为根的递归操作。
+// flag 包同时接受一个和两个横线，帮助中写成 --i-know-what-im-doing 以示醒目
+const forceFlag = "i-know-what-im-doing"
+
+// defaultConfirmOver 是 add -r 需要确认的默认总大小
+const defaultConfirmOver = 1 << 30
+
+// sizeFlag 是接受 "512M"、"2G" 这类写法的大小标志
+type sizeFlag int64
+
+func (s *sizeFlag) String() string { return textfmt.Size(int64(*s)) }
+
+func (s *sizeFlag) Set(v string) error {
+	n, err := textfmt.ParseSize(v)
+	if err != nil {
+		return err
+	}
+	*s = sizeFlag(n)
+	return nil
+}
+
+// guardFlags 是递归命令共用的防护标志
+type guardFlags struct {
+	force       bool
+	yes         bool
+	confirmOver sizeFlag
+}
+
+// register 注册防护标志；withConfirm 为 false 时不注册大小确认相关的标志
+func (g *guardFlags) register(fs *flag.FlagSet, withConfirm bool) {
+	fs.BoolVar(&g.force, forceFlag, false, "with -r, allow a local root of /, the home directory or the current directory")
+	if withConfirm {
+		g.confirmOver = defaultConfirmOver
+		fs.Var(&g.confirmOver, "confirm-over", "with -r, ask for confirmation before uploading more than this `size` (0 = never ask)")
+		g.registerYes(fs, "with -r, upload without asking for confirmation")
+	}
+}
+
+// registerYes 只注册 -yes，供没有大小确认、但可能需要 protected profile 确认的命令使用
+func (g *guardFlags) registerYes(fs *flag.FlagSet, usage string) {
+	fs.BoolVar(&g.yes, "yes", false, usage)
+}
+
+// stdinIsTerminal 决定能否在终端上确认；重定向自 /dev/null 时不算终端，确认直接拒绝
+var stdinIsTerminal = isTTY(os.Stdin)
+
+// riskyLocalRoot 判断本地目录是否是文件系统根、家目录或当前目录，返回对应的说明，否则返回空串。
+// 用 os.SameFile 比较，经由符号链接或相对路径指向这些目录时同样识别；目录不存在时视为安全
+func riskyLocalRoot(dir string) string {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return ""
+	}
+	same := func(other string) bool {
+		ofi, err := os.Stat(other)
+		return err == nil && os.SameFile(fi, ofi)
+	}
+	abs, _ := filepath.Abs(dir)
+	home, err := os.UserHomeDir()
+	switch {
+	case same(filepath.VolumeName(abs) + string(filepath.Separator)):
+		return i18n.T("guard.fs_root")
+	case err == nil && same(home):
+		return i18n.T("guard.home")
+	case same("."):
+		return i18n.T("guard.cwd")
+	}
+	return ""
+}
+
+// checkRoots 拒绝以危险目录为根的递归操作，force 时放行。
+// remote 为空表示不检查远程根；远程根为沙箱根时意味着镜像整个沙箱
+func (g *guardFlags) checkRoots(local, remote string) error {
+	if g.force {
+		return nil
+	}
+	reason := riskyLocalRoot(local)
+	target := local
+	if reason == "" && remote != "" && path.Join("/", remote) == "/" {
+		reason, target = i18n.T("guard.sandbox_root"), remote
+	}
+	if reason == "" {
+		return nil
+	}
+	return errors.New(i18n.T("guard.refused", target, reason, "--"+forceFlag))
+}
+
+// confirmUpload 在递归上传前统计本地目录，总大小超过 -confirm-over 时显示绝对路径和文件数并要求确认。
+// 与 add -r 一样不统计 tf 排除的路径。标准输入不是终端时无法确认，除非指定 -yes，否则拒绝
+func (g *guardFlags) confirmUpload(local, remote string, tf *treeFilter, followLinks bool) error {
+	if g.yes || g.confirmOver <= 0 {
+		return nil
+	}
+	var files int
+	var size int64
+	filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if rel, _ := filepath.Rel(local, p); p != local && tf.skip(filepath.ToSlash(rel), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 && !followLinks {
+			return nil
+		}
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+			files++
+			size += fi.Size()
+		}
+		return nil
+	})
+	if size <= int64(g.confirmOver) {
+		return nil
+	}
+	abs, _ := filepath.Abs(local)
+	fmt.Fprintln(os.Stderr, i18n.T("guard.upload_summary", abs, files, textfmt.Size(size), remote))
+	if !stdinIsTerminal {
+		return errors.New(i18n.T("guard.need_yes", textfmt.Size(int64(g.confirmOver))))
+	}
+	fmt.Fprint(os.Stderr, i18n.T("guard.prompt"))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errors.New(i18n.T("guard.aborted"))
+}
+
+// confirmProtected 在对 protected profile 执行 sync -delete、delete -r 这类删除前显示 profile 和服务端主机名，
+// 并要求在终端上输入主机名（或 profile 名）确认。标准输入不是终端时无法确认，除非指定 -yes，否则拒绝
+func (g *guardFlags) confirmProtected(prof *clientconfig.Profile, server, action string) error {
+	if prof == nil || !prof.Protected || g.yes {
+		return nil
+	}
+	host := server
+	if u, err := url.Parse(server); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	fmt.Fprintln(os.Stderr, i18n.T("guard.protected_summary", action, prof.Name, host))
+	if !stdinIsTerminal {
+		return errors.New(i18n.T("guard.protected_need_yes", prof.Name))
+	}
+	fmt.Fprint(os.Stderr, i18n.T("guard.protected_prompt", host))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.TrimSpace(answer) {
+	case host, prof.Name:
+		return nil
+	}
+	return errors.New(i18n.T("guard.aborted"))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wsbox/internal/clientconfig"
+	"wsbox/pkg/server"
+)
+
+// withStdin 让防护的确认从 input 读取答案，terminal 决定标准输入是否算作终端
+func withStdin(t *testing.T, terminal bool, input string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(input)
+	w.Close()
+	oldStdin, oldTerminal := os.Stdin, stdinIsTerminal
+	os.Stdin, stdinIsTerminal = r, terminal
+	t.Cleanup(func() {
+		os.Stdin, stdinIsTerminal = oldStdin, oldTerminal
+		r.Close()
+	})
+}
+
+func TestCheckRoots(t *testing.T) {
+	home, cwd, safe := t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Chdir(cwd)
+	link := filepath.Join(safe, "home-link")
+	if err := os.Symlink(home, link); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		local  string
+		remote string
+		force  bool
+		refuse bool
+	}{
+		{"filesystem root", "/", "", false, true},
+		{"home", home, "", false, true},
+		{"symlink to home", link, "", false, true},
+		{"cwd", ".", "", false, true},
+		{"cwd absolute", cwd, "", false, true},
+		{"safe dir", safe, "", false, false},
+		{"missing dir", filepath.Join(safe, "missing"), "", false, false},
+		{"sandbox root", safe, "/", false, true},
+		{"sandbox root without slash", safe, "", false, false},
+		{"remote subdir", safe, "/data", false, false},
+		{"forced root", "/", "/", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := guardFlags{force: tt.force}
+			err := g.checkRoots(tt.local, tt.remote)
+			if (err != nil) != tt.refuse {
+				t.Errorf("checkRoots(%q, %q) force=%t = %v, want refused=%t", tt.local, tt.remote, tt.force, err, tt.refuse)
+			}
+		})
+	}
+}
+
+func TestConfirmUpload(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "big"), make([]byte, 4096), 0o644)
+	tests := []struct {
+		name        string
+		confirmOver sizeFlag
+		yes         bool
+		terminal    bool
+		input       string
+		refuse      bool
+	}{
+		{"under the limit", 1 << 20, false, false, "", false},
+		{"never ask", 0, false, false, "", false},
+		{"over, -yes", 1024, true, false, "", false},
+		{"over, not a terminal", 1024, false, false, "y\n", true},
+		{"over, answered y", 1024, false, true, "y\n", false},
+		{"over, answered yes", 1024, false, true, "YES\n", false},
+		{"over, answered n", 1024, false, true, "n\n", true},
+		{"over, no answer", 1024, false, true, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withStdin(t, tt.terminal, tt.input)
+			g := guardFlags{confirmOver: tt.confirmOver, yes: tt.yes}
+			err := g.confirmUpload(dir, "/up", nil, false)
+			if (err != nil) != tt.refuse {
+				t.Errorf("confirmUpload = %v, want refused=%t", err, tt.refuse)
+			}
+		})
+	}
+}
+
+func TestConfirmProtected(t *testing.T) {
+	prod := &clientconfig.Profile{Name: "prod", URL: "wss://files.example.com/ws", Protected: true}
+	dev := &clientconfig.Profile{Name: "dev", URL: "ws://127.0.0.1:8080/ws"}
+	const server = "wss://tok@files.example.com:8443/ws"
+	tests := []struct {
+		name     string
+		prof     *clientconfig.Profile
+		yes      bool
+		terminal bool
+		input    string
+		refuse   bool
+	}{
+		{"no profile", nil, false, false, "", false},
+		{"unprotected profile", dev, false, false, "", false},
+		{"-yes", prod, true, false, "", false},
+		{"not a terminal", prod, false, false, "files.example.com\n", true},
+		{"typed the hostname", prod, false, true, "files.example.com\n", false},
+		{"typed the profile name", prod, false, true, " prod \n", false},
+		{"typed y", prod, false, true, "y\n", true},
+		{"typed the hostname with port", prod, false, true, "files.example.com:8443\n", true},
+		{"no answer", prod, false, true, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withStdin(t, tt.terminal, tt.input)
+			g := guardFlags{yes: tt.yes}
+			err := g.confirmProtected(tt.prof, server, "sync -delete /releases")
+			if (err != nil) != tt.refuse {
+				t.Errorf("confirmProtected = %v, want refused=%t", err, tt.refuse)
+			}
+		})
+	}
+}
+
+// 受保护的 profile：非终端上的 delete -r 和 sync -delete 不加 -yes 时拒绝且不删除任何东西，加 -yes 时照常执行
+func TestProtectedProfileDelete(t *testing.T) {
+	t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+	sandbox := t.TempDir()
+	url := startTestServerConfig(t, server.Config{Dir: sandbox})
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(config, []byte("default: prod\nprofiles:\n  prod:\n    url: "+url+"\n    token: "+testToken+"\n    protected: true\n"), 0o600)
+	t.Setenv("WSBOX_CONFIG", config)
+	os.MkdirAll(filepath.Join(sandbox, "d", "old"), 0o755)
+	src := t.TempDir()
+
+	for _, args := range [][]string{{"delete", "-r", "/d/old"}, {"sync", "-delete", src, "/d"}} {
+		code, _, stderr := runWsbox(t, append([]string{"client"}, args...)...)
+		if code == 0 || !strings.Contains(stderr, "-yes") {
+			t.Errorf("%v without -yes: exit %d, stderr %q; want a refusal naming -yes", args, code, stderr)
+		}
+		if _, err := os.Stat(filepath.Join(sandbox, "d", "old")); err != nil {
+			t.Fatalf("%v without -yes deleted the remote directory", args)
+		}
+	}
+	if code, _, stderr := runWsbox(t, "client", "sync", "-delete", "-yes", src, "/d"); code != 0 {
+		t.Fatalf("sync -delete -yes: exit %d: %s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(sandbox, "d", "old")); err == nil {
+		t.Error("sync -delete -yes kept the remote directory")
+	}
+}
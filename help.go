@@ -0,0 +1,561 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"wsbox/internal/i18n"
+)
+
+/* ---------- 命令表与帮助 ---------- */
+
+// 命令的分派和帮助都以命令表为准：用法、说明和示例登记在这里，标志及其默认值在显示帮助时
+// 从命令实际解析参数的 FlagSet 读取，两者不会脱节。带标志的命令用 newFlagSet 创建 FlagSet，
+// "wsbox help <命令>" 以 -h 运行该命令，由它自己的 FlagSet 打印帮助后退出
+
+// command 是命令表中的一项
+type command struct {
+	name     string
+	usage    []string // 用法，每种一行，不含命令本身
+	summary  string   // 一句话说明的消息ID
+	details  string   // 命令页中附加说明的消息ID，可为空
+	examples []string // 完整的命令行
+	flags    bool     // run 用 newFlagSet 解析标志，-h 时打印帮助
+	sub      func() []command
+	run      func(args []string)
+}
+
+// rootCommand 是 "wsbox" 本身，帮助中列出顶层命令
+func rootCommand() command {
+	return command{
+		name:    "wsbox",
+		usage:   []string{"<command> [args...]"},
+		summary: "summary.wsbox",
+		examples: []string{
+			"wsbox server -addr :8080 -dir ./files -token mysecret",
+			"wsbox client -s ws://mysecret@server:8080/ws list",
+			"wsbox help client add",
+		},
+		sub: topCommands,
+	}
+}
+
+func topCommands() []command {
+	return []command{
+		{
+			name:    "server",
+			usage:   []string{"[flags]", "<command> [flags]"},
+			summary: "summary.server",
+			examples: []string{
+				"wsbox server -addr :8080 -dir ./files -token mysecret",
+				"wsbox server -addr :8443 -dir ./files -cert server.crt -key server.key",
+			},
+			flags: true,
+			sub:   serverCommands,
+			run:   runServerCommand,
+		},
+		{
+			name:     "client",
+			usage:    []string{"[flags] <command> [args...]"},
+			summary:  "summary.client",
+			details:  "details.client",
+			examples: []string{"wsbox client -s ws://server:8080/ws -token-file ~/.wsbox-token list", "wsbox client -profile prod list", "wsbox client -s wss://token@server:8443/ws -cacert ca.pem get report.pdf"},
+			flags:    true,
+			sub:      func() []command { return new(clientCmd).commands() },
+			run:      runClient,
+		},
+		{
+			name:     "schema",
+			usage:    []string{"[name]"},
+			summary:  "summary.schema",
+			examples: []string{"wsbox schema", "wsbox schema list"},
+			run:      runSchema,
+		},
+		{
+			name:     "help",
+			usage:    []string{"[command [subcommand]]"},
+			summary:  "summary.help",
+			examples: []string{"wsbox help client", "wsbox help client add"},
+			run:      runHelp,
+		},
+	}
+}
+
+func serverCommands() []command {
+	return []command{
+		{
+			name:     "audit",
+			usage:    []string{"[-json] [server flags]"},
+			summary:  "summary.server.audit",
+			examples: []string{"wsbox server audit -addr :8080 -dir ./files -token mysecret", "wsbox server audit -json -dir ./files"},
+			flags:    true,
+			run:      runAudit,
+		},
+		{
+			name:     "state",
+			usage:    []string{"verify|compact -state-dir DIR [-json]"},
+			summary:  "summary.server.state",
+			examples: []string{"wsbox server state verify -state-dir /var/lib/wsbox", "wsbox server state compact -state-dir /var/lib/wsbox"},
+			flags:    true,
+			run:      runState,
+		},
+		{
+			name:     "verify-audit",
+			usage:    []string{"[-json] FILE"},
+			summary:  "summary.server.verify_audit",
+			examples: []string{"wsbox server verify-audit /var/log/wsbox/audit.jsonl"},
+			flags:    true,
+			run:      runVerifyAudit,
+		},
+	}
+}
+
+// commands 是客户端的子命令，run 绑定到 c
+func (c *clientCmd) commands() []command {
+	return []command{
+		{
+			name:     "list",
+			usage:    []string{"[-latest N] [-l] [-json|-jsonl|-0] [dir]", "-R|-depth N [-json|-jsonl|-0] [dir]"},
+			summary:  "summary.client.list",
+			examples: []string{"wsbox client list uploads/", "wsbox client list -depth 2 releases", "wsbox client list -l -jsonl /", "wsbox client list -0 logs | xargs -0 -n1 echo"},
+			flags:    true,
+			run:      c.list,
+		},
+		{
+			name: "add",
+			usage: []string{
+				"[-f] [-resume] <local> [remote]",
+				"-r [-P n] [-fail-fast] [-follow-symlinks] [-exclude glob]... [-include glob]... [-confirm-over 1G] [-yes] <dir> [remote]",
+				"[-r] -if-changed <local> [remote]",
+				"-estimate [-no-probe] [-json] [-r] <local> [remote]",
+				"-extract [-f] [-format tgz|zip] <archive> [remoteDir]",
+				"- <remote>",
+			},
+			summary:  "summary.client.add",
+			details:  "details.client.transfer",
+			examples: []string{"wsbox client add report.pdf docs/report.pdf", "wsbox client add -r ./build releases/v2", "wsbox client add -r -exclude node_modules/ -exclude '*.log' ./app apps/app", "wsbox client add -r -P 8 ./photos photos", "wsbox client add -estimate -r ./dataset", "tar cz . | wsbox client add - backups/snap.tgz", "wsbox client add -extract site.tgz www/site"},
+			flags:    true,
+			run:      c.add,
+		},
+		{
+			name:     "append",
+			usage:    []string{"<local> <remote>", "- <remote>"},
+			summary:  "summary.client.append",
+			details:  "details.client.append",
+			examples: []string{"wsbox client append batch.log logs/app.log", "journalctl --since -5min | wsbox client append - logs/journal.log"},
+			flags:    true,
+			run:      c.append,
+		},
+		{
+			name:     "get",
+			usage:    []string{"[-case-collision rename|overwrite|fail] <remote> [local]", "-r [-P n] [-skip-existing] [-exclude glob]... [-include glob]... <remoteDir> [localDir]", "-r -as-archive [-symlinks skip|store] <remoteDir> [localDir]", "-archive [-format tgz|zip] [-symlinks skip|store] <remoteDir> [out|-]", "<remote> -"},
+			summary:  "summary.client.get",
+			details:  "details.client.transfer",
+			examples: []string{"wsbox client get docs/report.pdf", "wsbox client get -r -skip-existing releases/v2 ./v2", "wsbox client get logs/app.log - | grep ERROR", "wsbox client get -archive releases/v2 v2.zip", "wsbox client get -r -as-archive releases/v2 ./v2"},
+			flags:    true,
+			run:      c.get,
+		},
+		{
+			name:     "delete",
+			usage:    []string{"[-r] <remote>"},
+			summary:  "summary.client.delete",
+			examples: []string{"wsbox client delete old/report.pdf", "wsbox client delete -r tmp/"},
+			flags:    true,
+			run:      c.delete,
+		},
+		{
+			name:     "mkdir",
+			usage:    []string{"<remote>"},
+			summary:  "summary.client.mkdir",
+			examples: []string{"wsbox client mkdir reports/2024/q1"},
+			flags:    true,
+			run:      c.mkdir,
+		},
+		{
+			name:     "mv",
+			usage:    []string{"[-f] <src> <dst>"},
+			summary:  "summary.client.mv",
+			examples: []string{"wsbox client mv drafts/report.pdf reports/2024/report.pdf", "wsbox client mv -f report-v2.pdf report.pdf", "wsbox client mv old-dir/ archive/"},
+			flags:    true,
+			run:      c.mv,
+		},
+		{
+			name:     "sync",
+			usage:    []string{"[-P n] [-delete] [-dry-run] [-checksum|-if-changed] [-exclude glob]... [-include glob]... <localDir> <remoteDir>"},
+			summary:  "summary.client.sync",
+			details:  "details.client.sync",
+			examples: []string{"wsbox client sync ./build releases/build", "wsbox client sync -delete -dry-run ./site www", "wsbox client sync -checksum ./data backup/data"},
+			flags:    true,
+			run:      c.sync,
+		},
+		{
+			name:     "watch",
+			usage:    []string{"[-delete] [-interval 1s] [-debounce 500ms] [-exclude glob]... [-include glob]... <localDir> <remoteDir>"},
+			summary:  "summary.client.watch",
+			details:  "details.client.watch",
+			examples: []string{"wsbox client watch ./src remote/src", "wsbox client watch -delete -exclude '*.swp' -exclude node_modules/ ./site www"},
+			flags:    true,
+			run:      c.watch,
+		},
+		{
+			name:     "shell",
+			usage:    []string{"[dir]"},
+			summary:  "summary.client.shell",
+			details:  "details.client.shell",
+			examples: []string{"wsbox client shell", "wsbox client shell releases", "printf 'cd logs\\nget app.log\\n' | wsbox client shell"},
+			flags:    true,
+			run:      c.shell,
+		},
+		{
+			name:     "profiles",
+			usage:    []string{""},
+			summary:  "summary.client.profiles",
+			details:  "details.client.profiles",
+			examples: []string{"wsbox client profiles", "wsbox client -config ./ci.yaml profiles"},
+			flags:    true,
+			run:      c.profiles,
+		},
+		{
+			name:     "cat",
+			usage:    []string{"[-n] <remote>..."},
+			summary:  "summary.client.cat",
+			examples: []string{"wsbox client cat config/app.yaml", "wsbox client cat -n scripts/deploy.sh"},
+			flags:    true,
+			run:      c.cat,
+		},
+		{
+			name:     "tail",
+			usage:    []string{"[-n 10] [-f] [-s 2s] <remote>"},
+			summary:  "summary.client.tail",
+			details:  "details.client.tail",
+			examples: []string{"wsbox client tail -n 50 logs/app.log", "wsbox client tail -f logs/app.log | grep ERROR"},
+			flags:    true,
+			run:      c.tail,
+		},
+		{
+			name:     "pull",
+			usage:    []string{"[-P n] [-delete] [-dry-run] [-exclude glob]... [-include glob]... <remoteDir> <localDir>"},
+			summary:  "summary.client.pull",
+			details:  "details.client.pull",
+			examples: []string{"wsbox client pull artifacts/cache ./cache", "wsbox client pull -delete -dry-run www ./site"},
+			flags:    true,
+			run:      c.pull,
+		},
+		{
+			name:     "stat",
+			usage:    []string{"[-json] [-hash] <remote>"},
+			summary:  "summary.client.stat",
+			details:  "details.client.stat",
+			examples: []string{"wsbox client stat reports/q1.pdf", "wsbox client stat -json -hash reports/q1.pdf", "if wsbox client stat -json done.flag >/dev/null; then echo ready; fi"},
+			flags:    true,
+			run:      c.stat,
+		},
+		{
+			name:     "doctor",
+			usage:    []string{"[-json] [-timeout 5s]"},
+			summary:  "summary.client.doctor",
+			examples: []string{"wsbox client -s ws://token@server:8080/ws doctor"},
+			flags:    true,
+			run:      c.doctor,
+		},
+		{
+			name:     "lock",
+			usage:    []string{"acquire <remote> [-ttl 10m] [-holder name]", "release <remote> [-holder name]", "list [dir]"},
+			summary:  "summary.client.lock",
+			examples: []string{"wsbox client lock acquire jobs/nightly -ttl 30m", "wsbox client lock release jobs/nightly", "wsbox client lock list jobs"},
+			flags:    true,
+			run:      c.lock,
+		},
+		{
+			name:     "du",
+			usage:    []string{"[-h] [-json] [dir]"},
+			summary:  "summary.client.du",
+			examples: []string{"wsbox client du -h", "wsbox client du -h releases"},
+			flags:    true,
+			run:      c.du,
+		},
+		{
+			name:     "find",
+			usage:    []string{"[-regex] [-type f|d] [-maxdepth n] [-n limit] [-0|-json] <dir> <pattern>"},
+			summary:  "summary.client.find",
+			examples: []string{"wsbox client find logs '*.gz'", "wsbox client find -type d -maxdepth 2 / 'build*'", "wsbox client find -regex releases '^v2/.*\\.tar$'"},
+			flags:    true,
+			run:      c.find,
+		},
+		{
+			name:     "counts",
+			usage:    []string{"[-n 20] [-json]"},
+			summary:  "summary.client.counts",
+			examples: []string{"wsbox client counts -n 5"},
+			flags:    true,
+			run:      c.counts,
+		},
+		{
+			name:     "activity",
+			usage:    []string{"[-n 50] [-follow] [-interval 2s] [-json]"},
+			summary:  "summary.client.activity",
+			examples: []string{"wsbox client activity -n 20", "wsbox client activity -follow -json"},
+			flags:    true,
+			run:      c.activity,
+		},
+		{
+			name:     "cron",
+			usage:    []string{"[-jitter 30s] [-retries 2] [-retry-delay 1m] \"<schedule>\" <command> [args...]"},
+			summary:  "summary.client.cron",
+			details:  "details.client.cron",
+			examples: []string{"wsbox client -s ws://token@server:8080/ws cron \"*/15 * * * *\" add -r ./reports reports"},
+			flags:    true,
+			run:      c.cron,
+		},
+		{
+			name:     "test",
+			usage:    []string{"-e|-f|-d|-s <path>", "<path> -nt|-ot <path>", "! <expression>"},
+			summary:  "summary.client.test",
+			details:  "details.client.test",
+			examples: []string{"wsbox client test -f reports/today.csv && echo present", "wsbox client test local:data.csv -nt data.csv || echo up to date"},
+			run:      c.test,
+		},
+		{
+			name:     "browse",
+			usage:    []string{"[dir]"},
+			summary:  "summary.client.browse",
+			details:  "details.client.browse",
+			examples: []string{"wsbox client -s ws://token@server:8080/ws browse reports"},
+			run:      c.browse,
+		},
+		{
+			name:     "help",
+			usage:    []string{"[command]"},
+			summary:  "summary.help",
+			examples: []string{"wsbox client help add"},
+			run:      func(args []string) { runHelp(append([]string{"client"}, args...)) },
+		},
+	}
+}
+
+// dispatch 按 args[0] 在 table 中找到命令并运行，parent 是上一级命令的路径（顶层为空）
+func dispatch(parent string, table []command, args []string) {
+	name := args[0]
+	if name == "-h" || name == "-help" || name == "--help" {
+		name = "help"
+	}
+	cmd, ok := lookupCommand(table, name)
+	if !ok {
+		unknownCommand(parent, name, table)
+	}
+	cmd.run(args[1:])
+}
+
+func lookupCommand(table []command, name string) (command, bool) {
+	for _, cmd := range table {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// findCommand 按路径（如 "client add"）在命令表中查找命令，空路径是 wsbox 本身
+func findCommand(path string) (command, bool) {
+	cmd := rootCommand()
+	for _, name := range strings.Fields(path) {
+		if cmd.sub == nil {
+			return command{}, false
+		}
+		next, ok := lookupCommand(cmd.sub(), name)
+		if !ok {
+			return command{}, false
+		}
+		cmd = next
+	}
+	return cmd, true
+}
+
+// unknownCommand 报告未知命令并以 exitUsage 结束，有相近的命令名时给出提示；顶层还会在客户端命令中找
+func unknownCommand(parent, name string, table []command) {
+	guess := closestCommand(name, table)
+	if guess == "" && parent == "" {
+		// "wsbox lst" 多半是漏写了 client
+		if g := closestCommand(name, new(clientCmd).commands()); g != "" {
+			guess = "client " + g
+		}
+	}
+	if guess != "" {
+		fmt.Fprintln(os.Stderr, i18n.T("help.did_you_mean", name, guess))
+	} else {
+		fmt.Fprintln(os.Stderr, i18n.T("help.unknown", name))
+	}
+	fmt.Fprintln(os.Stderr, i18n.T("help.see", program(parent)))
+	os.Exit(exitUsage)
+}
+
+// closestCommand 返回编辑距离最近且不超过2的命令名，距离不小于名字本身的长度时不算相近
+func closestCommand(name string, table []command) string {
+	best, bestDist := "", 3
+	for _, cmd := range table {
+		d := editDistance(name, cmd.name)
+		if d < bestDist && d < len(name) {
+			best, bestDist = cmd.name, d
+		}
+	}
+	return best
+}
+
+// editDistance 是两个字符串之间的 Levenshtein 距离
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// usageLine 是一行用法，不带参数的命令登记为空字符串
+func usageLine(path, usage string) string {
+	return strings.TrimSpace(program(path) + " " + usage)
+}
+
+func program(path string) string {
+	return strings.TrimSpace("wsbox " + path)
+}
+
+// newFlagSet 创建命令的 FlagSet，-h 时打印由命令表和该 FlagSet 生成的帮助
+func newFlagSet(path string) *flag.FlagSet {
+	fs := flag.NewFlagSet(path, flag.ExitOnError)
+	fs.Usage = func() { printHelp(os.Stdout, path, fs) }
+	return fs
+}
+
+// runHelp 实现 "wsbox help [命令 [子命令]]"
+func runHelp(args []string) {
+	cmd, path := rootCommand(), ""
+	for _, name := range args {
+		if cmd.sub == nil {
+			break
+		}
+		next, ok := lookupCommand(cmd.sub(), name)
+		if !ok {
+			unknownCommand(path, name, cmd.sub())
+		}
+		cmd, path = next, strings.TrimSpace(path+" "+name)
+	}
+	if cmd.flags {
+		// 由命令自己的 FlagSet 打印帮助并退出。用 -help 而不是 -h：du 把 -h 定义为人类可读的大小
+		cmd.run([]string{"-help"})
+	}
+	printHelp(os.Stdout, path, nil)
+}
+
+// printUsage 向 stderr 输出命令的用法，用于参数错误
+func printUsage(path string) {
+	cmd, _ := findCommand(path)
+	fmt.Fprintln(os.Stderr, i18n.T("help.usage"))
+	for _, u := range cmd.usage {
+		fmt.Fprintf(os.Stderr, "  %s\n", usageLine(path, u))
+	}
+}
+
+// printHelp 输出命令的帮助：用法、说明、标志（fs 不为 nil 时）、子命令和示例
+func printHelp(w io.Writer, path string, fs *flag.FlagSet) {
+	cmd, ok := findCommand(path)
+	if !ok {
+		// 命令表中缺少这个 FlagSet 对应的命令，只能列出标志
+		fs.PrintDefaults()
+		return
+	}
+	fmt.Fprintln(w, i18n.T("help.usage"))
+	for _, u := range cmd.usage {
+		fmt.Fprintf(w, "  %s\n", usageLine(path, u))
+	}
+	fmt.Fprintf(w, "\n%s\n", i18n.T(cmd.summary))
+	if cmd.details != "" {
+		fmt.Fprintf(w, "\n%s\n", strings.TrimRight(i18n.T(cmd.details), "\n"))
+	}
+	if fs != nil && hasFlags(fs) {
+		fmt.Fprintf(w, "\n%s\n", i18n.T("help.flags"))
+		printFlags(w, fs)
+	}
+	if cmd.sub != nil {
+		fmt.Fprintf(w, "\n%s\n", i18n.T("help.commands"))
+		sub := cmd.sub()
+		width := 0
+		for _, s := range sub {
+			width = max(width, len(s.name))
+		}
+		for _, s := range sub {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, s.name, i18n.T(s.summary))
+		}
+	}
+	if path == "" {
+		fmt.Fprintf(w, "\n%s\n%s\n", i18n.T("help.global_flags"), i18n.T("help.lang_flag"))
+	}
+	if len(cmd.examples) > 0 {
+		fmt.Fprintf(w, "\n%s\n", i18n.T("help.examples"))
+		for _, e := range cmd.examples {
+			fmt.Fprintf(w, "  %s\n", e)
+		}
+	}
+	if cmd.sub != nil {
+		fmt.Fprintf(w, "\n%s\n", i18n.T("help.more", program(path)))
+	}
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	return n > 0
+}
+
+// printFlags 按名字顺序列出标志，默认值取自 FlagSet，零值不显示
+func printFlags(w io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		head := "  -" + f.Name
+		if name != "" {
+			head += " " + name
+		}
+		if !isZeroValue(f) {
+			def := f.DefValue
+			if g, ok := f.Value.(flag.Getter); ok {
+				if _, isString := g.Get().(string); isString {
+					def = fmt.Sprintf("%q", def)
+				}
+			}
+			usage += " " + i18n.T("help.default", def)
+		}
+		if len(head) < 17 {
+			fmt.Fprintf(w, "%-18s%s\n", head, usage)
+		} else {
+			fmt.Fprintf(w, "%s\n%18s%s\n", head, "", usage)
+		}
+	})
+}
+
+// isZeroValue 判断标志的默认值是否为其类型的零值，做法与 flag.PrintDefaults 相同
+func isZeroValue(f *flag.Flag) bool {
+	t := reflect.TypeOf(f.Value)
+	var z reflect.Value
+	if t.Kind() == reflect.Pointer {
+		z = reflect.New(t.Elem())
+	} else {
+		z = reflect.Zero(t)
+	}
+	v, ok := z.Interface().(flag.Value)
+	return ok && f.DefValue == v.String()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"wsbox/internal/i18n"
+)
+
+// walkCommands 按路径（如 "client add"）访问命令表中的每个命令，空路径是 wsbox 本身
+func walkCommands(path string, cmd command, visit func(path string, cmd command)) {
+	visit(path, cmd)
+	if cmd.sub == nil {
+		return
+	}
+	for _, s := range cmd.sub() {
+		walkCommands(strings.TrimSpace(path+" "+s.name), s, visit)
+	}
+}
+
+// 每个登记的命令都要有说明、用法和至少一个示例，"wsbox help <命令>" 打印的帮助包含它们，
+// 新命令不能不带文档就发布
+func TestHelpCoversEveryCommand(t *testing.T) {
+	i18n.SetLang("en")
+	n := 0
+	walkCommands("", rootCommand(), func(path string, cmd command) {
+		n++
+		name := program(path)
+		summary := i18n.T(cmd.summary)
+		if cmd.summary == "" || summary == cmd.summary {
+			t.Errorf("%s: summary %q has no English message", name, cmd.summary)
+		}
+		if cmd.details != "" && i18n.T(cmd.details) == cmd.details {
+			t.Errorf("%s: details %q has no English message", name, cmd.details)
+		}
+		if len(cmd.usage) == 0 {
+			t.Errorf("%s: no usage line", name)
+			return
+		}
+		if len(cmd.examples) == 0 {
+			t.Errorf("%s: no example", name)
+		}
+		for _, e := range cmd.examples {
+			// 示例可以是管道的一部分，也可以在命令之前带着上级命令的标志（wsbox client -s ... add）
+			if !strings.Contains(e, "wsbox") || !strings.Contains(e, " "+cmd.name) && path != "" {
+				t.Errorf("%s: example %q does not run the command", name, e)
+			}
+		}
+
+		code, stdout, stderr := runWsbox(t, append([]string{"help"}, strings.Fields(path)...)...)
+		if code != 0 {
+			t.Errorf("wsbox help %s: exit %d: %s", path, code, stderr)
+			return
+		}
+		want := []string{"Usage:\n  " + usageLine(path, cmd.usage[0]) + "\n", "\n" + summary + "\n", "\nExamples:\n"}
+		for _, e := range cmd.examples {
+			want = append(want, "  "+e+"\n")
+		}
+		for _, w := range want {
+			if !strings.Contains(stdout, w) {
+				t.Errorf("wsbox help %s: output lacks %q:\n%s", path, w, stdout)
+			}
+		}
+		if cmd.sub != nil {
+			for _, s := range cmd.sub() {
+				if !strings.Contains(stdout, "  "+s.name+" ") {
+					t.Errorf("wsbox help %s: %s is not listed", path, s.name)
+				}
+			}
+		}
+	})
+	if n < 10 {
+		t.Fatalf("walked only %d commands", n)
+	}
+}
+
+// 标志的默认值取自命令实际使用的 FlagSet，"wsbox client add -h" 与 "wsbox client help add" 相同
+func TestHelpFlagDefaults(t *testing.T) {
+	code, stdout, _ := runWsbox(t, "help", "server")
+	if code != 0 || !strings.Contains(stdout, `-addr string`) || !strings.Contains(stdout, `(default ":8080")`) {
+		t.Errorf("wsbox help server: exit %d\n%s", code, stdout)
+	}
+	_, viaHelp, _ := runWsbox(t, "client", "help", "add")
+	code, viaFlag, _ := runWsbox(t, "client", "add", "-h")
+	if code != 0 || viaHelp != viaFlag || !strings.Contains(viaFlag, "Usage:\n  wsbox client add ") {
+		t.Errorf("client add -h (exit %d) differs from client help add:\n%s\n---\n%s", code, viaFlag, viaHelp)
+	}
+}
+
+func TestUnknownCommandSuggestion(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"client", "lst"}, "unknown command 'lst', did you mean 'list'?"},
+		{[]string{"lst"}, "unknown command 'lst', did you mean 'client list'?"},
+		{[]string{"srever"}, "unknown command 'srever', did you mean 'server'?"},
+		{[]string{"help", "client", "ad"}, "unknown command 'ad', did you mean 'add'?"},
+		{[]string{"client", "frobnicate"}, "unknown command 'frobnicate'\n"},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runWsbox(t, tt.args...)
+		if code != exitUsage || !strings.Contains(stderr, tt.want) {
+			t.Errorf("wsbox %s: exit %d, stderr %q; want exit %d and %q", strings.Join(tt.args, " "), code, stderr, exitUsage, tt.want)
+		}
+	}
+}
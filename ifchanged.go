@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：内容未变时跳过上传（-if-changed） ---------- */
+
+// add -if-changed 和 sync -if-changed 在上传之前先查询远程文件：大小相同时再比较两边的 SHA-256，
+// 内容一致就跳过这个文件，计为 "skipped (unchanged)"。服务端按路径、大小和修改时间缓存摘要，
+// 反复核对同一批未变的文件时不会每次读取整个文件（见 pkg/server/hashcache.go）。
+// 内容相同时修改时间和权限不会更新
+
+// remoteUnchanged 判断远程文件 remote 与本地文件 local 的内容是否相同。
+// 大小不同时不请求摘要；服务端不支持在 stat 中给出摘要时返回错误
+func remoteUnchanged(cl *client.Client, local, remote string) (bool, error) {
+	fi, err := os.Stat(local)
+	if err != nil {
+		return false, err
+	}
+	st, err := cl.Stat(remote)
+	if err != nil {
+		return false, err
+	}
+	if !st.Exists || st.IsDir || st.Size != fi.Size() {
+		return false, nil
+	}
+	want, err := hashLocalFile(local)
+	if err != nil {
+		return false, &client.LocalReadError{Err: err}
+	}
+	st, err = cl.StatHash(remote)
+	if err != nil {
+		return false, err
+	}
+	if st.SHA256 == "" {
+		return false, errors.New(i18n.T("stat.hash_unsupported"))
+	}
+	return st.Exists && st.Size == fi.Size() && st.SHA256 == want, nil
+}
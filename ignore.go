@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：排除规则（.wsboxignore、-exclude 与 -include） ---------- */
+
+// 规则与 .gitignore 的写法相同：! 开头的规则重新包含，以 / 结尾的只匹配目录，
+// 开头或中间含 / 的相对于传输根目录匹配，否则匹配任意层级的名字；** 匹配任意多层目录。
+// 先是源目录根下的 .wsboxignore，再是 -exclude，最后是 -include（相当于 ! 规则），最后一条匹配的规则决定结果。
+// 被排除的目录不再遍历，其中的文件无法再被 ! 或 -include 包含回来（与 git 相同）
+
+const ignoreFileName = ".wsboxignore"
+
+// ignorePattern 是一条排除规则
+type ignorePattern struct {
+	text    string   // 原始写法，演练时显示
+	segs    []string // 以 / 分开的各段，"**" 匹配任意多层
+	negate  bool
+	dirOnly bool
+}
+
+func parseIgnorePattern(s string) (ignorePattern, error) {
+	p := ignorePattern{text: s}
+	if strings.HasPrefix(s, "!") {
+		p.negate = true
+		s = s[1:]
+	}
+	if strings.HasSuffix(s, "/") {
+		p.dirOnly = true
+		s = strings.TrimRight(s, "/")
+	}
+	anchored := strings.Contains(s, "/")
+	s = strings.TrimLeft(s, "/")
+	if s == "" {
+		return p, fmt.Errorf("empty ignore pattern")
+	}
+	p.segs = strings.Split(s, "/")
+	for _, seg := range p.segs {
+		if _, err := path.Match(seg, ""); err != nil {
+			return p, fmt.Errorf("ignore pattern %q: %w", p.text, err)
+		}
+	}
+	if !anchored {
+		p.segs = append([]string{"**"}, p.segs...)
+	}
+	return p, nil
+}
+
+// match 判断相对于根目录、以 / 分隔的路径 rel 是否匹配
+func (p ignorePattern) match(rel string, dir bool) bool {
+	if p.dirOnly && !dir {
+		return false
+	}
+	return matchSegments(p.segs, strings.Split(rel, "/"))
+}
+
+// matchSegments 逐段匹配。"**" 可以匹配零层，结尾的 "**" 至少匹配一层（"dir/**" 是目录里的内容，不是目录本身）
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			rest := pat[1:]
+			if len(rest) == 0 {
+				return len(name) > 0
+			}
+			for i := range len(name) + 1 {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignoreRules 是按顺序排列的规则，最后一条匹配的决定结果
+type ignoreRules []ignorePattern
+
+// match 返回决定排除 rel 的规则，rel 不被排除时 ok 为 false
+func (r ignoreRules) match(rel string, dir bool) (p ignorePattern, ok bool) {
+	for i := len(r) - 1; i >= 0; i-- {
+		if r[i].match(rel, dir) {
+			return r[i], !r[i].negate
+		}
+	}
+	return p, false
+}
+
+// readIgnore 读取 .wsboxignore 的内容。空行和 # 开头的行被忽略，无效的规则给出警告后跳过
+func readIgnore(r io.Reader, name string) ignoreRules {
+	var rules ignoreRules
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parseIgnorePattern(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", name, n, err)
+			continue
+		}
+		rules = append(rules, p)
+	}
+	return rules
+}
+
+// filterFlags 是递归传输共用的 -exclude 和 -include
+type filterFlags struct {
+	exclude, include headerFlag
+	rules            ignoreRules // parse 之后的标志规则，排在 .wsboxignore 之后
+}
+
+func (f *filterFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.exclude, "exclude", "skip files and directories matching this `glob`, like a line of .wsboxignore (repeatable)")
+	fs.Var(&f.include, "include", "transfer paths matching this `glob` even if an earlier rule excludes them, like !glob in .wsboxignore (repeatable)")
+}
+
+// parse 检查标志中的规则，无效时是用法错误
+func (f *filterFlags) parse() {
+	for _, e := range f.exclude {
+		p, err := parseIgnorePattern(e)
+		if err != nil {
+			usageFail("-exclude:", err)
+		}
+		f.rules = append(f.rules, p)
+	}
+	for _, e := range f.include {
+		p, err := parseIgnorePattern("!" + e)
+		if err != nil {
+			usageFail("-include:", err)
+		}
+		p.text = e
+		f.rules = append(f.rules, p)
+	}
+}
+
+// set 判断是否给出了 -exclude 或 -include
+func (f *filterFlags) set() bool {
+	return len(f.rules) > 0
+}
+
+// local 返回以本地目录 root 为源的过滤器，读取 root 下的 .wsboxignore
+func (f *filterFlags) local(root string) *treeFilter {
+	name := filepath.Join(root, ignoreFileName)
+	var rules ignoreRules
+	if data, err := os.ReadFile(name); err == nil {
+		rules = readIgnore(bytes.NewReader(data), name)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return newTreeFilter(append(rules, f.rules...))
+}
+
+// remote 返回以远程目录 root 为源的过滤器，在 cl 上下载 root 下的 .wsboxignore；文件不存在时只用标志中的规则
+func (f *filterFlags) remote(cl *client.Client, root string) (*treeFilter, error) {
+	name := path.Join("/", root, ignoreFileName)
+	var buf bytes.Buffer
+	_, err := cl.Download(name, &buf)
+	var re *client.RemoteError
+	switch {
+	case errors.As(err, &re) && re.Status == http.StatusNotFound:
+		return newTreeFilter(f.rules), nil
+	case err != nil:
+		return nil, err
+	}
+	return newTreeFilter(append(readIgnore(&buf, name), f.rules...)), nil
+}
+
+// treeFilter 在遍历一棵树时决定跳过哪些路径，并记下被排除的路径
+type treeFilter struct {
+	rules    ignoreRules
+	excluded map[string]string // 被排除的路径（目录以 / 结尾）到决定它的规则
+}
+
+func newTreeFilter(rules ignoreRules) *treeFilter {
+	return &treeFilter{rules: rules, excluded: map[string]string{}}
+}
+
+// skip 判断 rel 是否被排除；被排除的目录调用方不再深入。f 为 nil 时不排除任何路径
+func (f *treeFilter) skip(rel string, dir bool) bool {
+	if f == nil {
+		return false
+	}
+	p, ok := f.rules.match(rel, dir)
+	if !ok {
+		return false
+	}
+	if dir {
+		rel += "/"
+	}
+	f.excluded[rel] = p.text
+	return true
+}
+
+// report 按路径顺序向 w 输出被排除的路径，每行用 key 的格式（路径、规则）
+func (f *treeFilter) report(w io.Writer, key string) {
+	if f == nil {
+		return
+	}
+	rels := make([]string, 0, len(f.excluded))
+	for rel := range f.excluded {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		fmt.Fprintln(w, i18n.T(key, rel, f.excluded[rel]))
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string // .wsboxignore 的内容
+		rel   string
+		dir   bool
+		want  bool // 是否排除
+	}{
+		// 不含 / 的规则匹配任意层级的名字
+		{"name at root", "*.log", "a.log", false, true},
+		{"name nested", "*.log", "x/y/a.log", false, true},
+		{"name no match", "*.log", "a.txt", false, false},
+		{"name matches a directory", "build", "src/build", true, true},
+		{"glob does not cross /", "a*b", "a/b", false, false},
+
+		// 以 / 结尾的只匹配目录
+		{"dir-only on a dir", "cache/", "cache", true, true},
+		{"dir-only nested", "cache/", "x/cache", true, true},
+		{"dir-only on a file", "cache/", "cache", false, false},
+
+		// 开头或中间有 / 的规则相对于根目录
+		{"leading slash at root", "/todo.txt", "todo.txt", false, true},
+		{"leading slash nested", "/todo.txt", "docs/todo.txt", false, false},
+		{"middle slash", "docs/*.md", "docs/a.md", false, true},
+		{"middle slash nested", "docs/*.md", "x/docs/a.md", false, false},
+		{"middle slash one level only", "docs/*.md", "docs/sub/a.md", false, false},
+		{"anchored dir-only", "/out/", "out", true, true},
+		{"anchored dir-only nested", "/out/", "src/out", true, false},
+
+		// ** 匹配任意多层
+		{"leading ** at root", "**/foo", "foo", false, true},
+		{"leading ** nested", "**/foo", "a/b/foo", false, true},
+		{"middle ** zero levels", "a/**/b", "a/b", false, true},
+		{"middle ** several levels", "a/**/b", "a/x/y/b", false, true},
+		{"middle ** other root", "a/**/b", "c/x/b", false, false},
+		{"trailing ** contents", "logs/**", "logs/x/y.txt", false, true},
+		{"trailing ** not the dir itself", "logs/**", "logs", true, false},
+		{"** with glob", "**/*.tmp", "a/b/c.tmp", false, true},
+
+		// ! 重新包含，最后一条匹配的规则决定结果
+		{"negation", "*.log\n!keep.log", "keep.log", false, false},
+		{"negation other file", "*.log\n!keep.log", "drop.log", false, true},
+		{"negation before exclude", "!keep.log\n*.log", "keep.log", false, true},
+		{"negated dir-only", "*\n!src/", "src", true, false},
+		{"negated dir-only leaves files", "*\n!src/", "src", false, true},
+		{"negation anchored", "*.md\n!/README.md", "README.md", false, false},
+		{"negation anchored nested", "*.md\n!/README.md", "docs/README.md", false, true},
+
+		// 空行、注释和首尾空白
+		{"comment", "# *.log\n\n", "a.log", false, false},
+		{"whitespace", "  *.log  ", "a.log", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := readIgnore(strings.NewReader(tt.rules), ignoreFileName)
+			if _, got := rules.match(tt.rel, tt.dir); got != tt.want {
+				t.Errorf("rules %q: match(%q, dir=%t) = %t, want %t", tt.rules, tt.rel, tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIgnorePatternErrors(t *testing.T) {
+	for _, s := range []string{"/", "!", "!/", "[", "a/[b"} {
+		if _, err := parseIgnorePattern(s); err == nil {
+			t.Errorf("parseIgnorePattern(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+// 被排除的目录不再遍历，其中的文件即使被 ! 或 -include 包含也不会出现
+func TestIgnorePrunesDirectories(t *testing.T) {
+	root := t.TempDir()
+	for _, p := range []string{"node_modules/x/index.js", "node_modules/keep.js", "src/a.go", "src/gen/b.go", "notes.log"} {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(p)), 0o755)
+		os.WriteFile(filepath.Join(root, p), nil, 0o644)
+	}
+	os.WriteFile(filepath.Join(root, ignoreFileName), []byte("node_modules/\n!node_modules/keep.js\n*.log\n"), 0o644)
+	f := filterFlags{exclude: headerFlag{"gen/"}, include: headerFlag{"notes.log"}}
+	f.parse()
+	tf := f.local(root)
+	tree, err := walkLocalTree(root, tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rel := range tree {
+		got = append(got, rel)
+	}
+	sort.Strings(got)
+	want := []string{ignoreFileName, "notes.log", "src", "src/a.go"}
+	if !slices.Equal(got, want) {
+		t.Errorf("walked %q, want %q", got, want)
+	}
+	var excluded []string
+	for rel := range tf.excluded {
+		excluded = append(excluded, rel)
+	}
+	sort.Strings(excluded)
+	if want := []string{"node_modules/", "src/gen/"}; !slices.Equal(excluded, want) {
+		t.Errorf("excluded %q, want %q (pruned directories only, not their contents)", excluded, want)
+	}
+}
@@ -0,0 +1,421 @@
+// Package clientconfig 读取客户端的配置文件：一组命名的服务端 profile，每个包含地址、token、证书选项和默认的全局标志。
+//
+// 文件是 YAML 的一个子集，只用到空格缩进的映射、标量（可加单引号或双引号）和字符串列表（"- x" 或 [a, b]），
+// 不依赖第三方库：
+//
+//	default: dev
+//	profiles:
+//	  prod:
+//	    url: wss://files.example.com/ws
+//	    token: 3f9c...
+//	    protected: true
+//	    cacert: /etc/wsbox/ca.pem
+//	    flags: [-iso, -mtime-slack, 2s]
+//	  dev:
+//	    url: ws://127.0.0.1:8080/ws
+//	    insecure: true
+package clientconfig
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileName 是默认配置目录下的文件名
+const FileName = "config.yaml"
+
+// ErrNotFound 表示配置文件不存在
+var ErrNotFound = errors.New("config file not found")
+
+// Profile 是一个命名的服务端配置
+type Profile struct {
+	Name     string
+	URL      string
+	Token    string
+	Insecure *bool // 未设置时为 nil
+	CACert   string
+	Flags    []string // 放在命令行上的全局标志之前，命令行上显式给出的标志优先
+	// Protected 为 true 时 sync -delete 和 delete -r 要求在终端上输入主机名确认
+	Protected bool
+}
+
+// Config 是解析后的配置文件
+type Config struct {
+	Path     string
+	Default  string     // 没有选择 profile 时使用的 profile，可以为空
+	Profiles []*Profile // 按文件中的顺序
+}
+
+// DefaultPath 返回默认的配置文件路径：$WSBOX_CONFIG，否则为用户配置目录下的 wsbox/config.yaml（Linux 上是 ~/.config/wsbox/config.yaml）
+func DefaultPath() (string, error) {
+	if p := os.Getenv("WSBOX_CONFIG"); p != "" {
+		return p, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "wsbox", FileName), nil
+}
+
+// Load 读取并校验配置文件，文件不存在时返回 ErrNotFound
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.Path = path
+	return cfg, nil
+}
+
+// Parse 解析配置文件的内容
+func Parse(data []byte) (*Config, error) {
+	root, err := parseYAML(string(data))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	for _, n := range root {
+		switch n.key {
+		case "default":
+			if cfg.Default, err = n.scalar(); err != nil {
+				return nil, err
+			}
+		case "profiles":
+			if n.isList || n.value != "" {
+				return nil, n.errorf("profiles must be a mapping of profile names")
+			}
+			for _, pn := range n.children {
+				p, err := parseProfile(pn)
+				if err != nil {
+					return nil, err
+				}
+				cfg.Profiles = append(cfg.Profiles, p)
+			}
+		default:
+			return nil, n.errorf("unknown key %q", n.key)
+		}
+	}
+	if cfg.Default != "" && cfg.Profile(cfg.Default) == nil {
+		return nil, fmt.Errorf("default profile %q is not defined", cfg.Default)
+	}
+	return cfg, nil
+}
+
+func parseProfile(n *node) (*Profile, error) {
+	if n.isList || n.value != "" {
+		return nil, n.errorf("profile %q must be a mapping", n.key)
+	}
+	p := &Profile{Name: n.key}
+	for _, f := range n.children {
+		var err error
+		switch f.key {
+		case "url":
+			p.URL, err = f.scalar()
+		case "token":
+			p.Token, err = f.scalar()
+		case "cacert":
+			p.CACert, err = f.scalar()
+		case "insecure":
+			var s string
+			if s, err = f.scalar(); err == nil {
+				var b bool
+				if b, err = strconv.ParseBool(s); err != nil {
+					err = f.errorf("insecure must be true or false, not %q", s)
+				}
+				p.Insecure = &b
+			}
+		case "protected":
+			var s string
+			if s, err = f.scalar(); err == nil {
+				if p.Protected, err = strconv.ParseBool(s); err != nil {
+					err = f.errorf("protected must be true or false, not %q", s)
+				}
+			}
+		case "flags":
+			switch {
+			case f.isList:
+				p.Flags = f.list
+			case f.hasValue:
+				// 也接受写在一行里的 "-iso -bytes"
+				p.Flags = strings.Fields(f.value)
+			}
+		default:
+			err = f.errorf("profile %q: unknown key %q", n.key, f.key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Profile 按名字查找 profile，不存在时返回 nil
+func (c *Config) Profile(name string) *Profile {
+	for _, p := range c.Profiles {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// CheckPermissions 返回配置文件对组或其他用户可读时的提示，文件中有token时应当只有所有者可读。Windows 上不检查
+func CheckPermissions(path string) string {
+	if filepath.Separator == '\\' {
+		return ""
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode().Perm()&0o077 == 0 {
+		return ""
+	}
+	return fmt.Sprintf("warning: %s is accessible by other users (mode %v), it may contain tokens; chmod 600 it", path, fi.Mode().Perm())
+}
+
+// MaskToken 只保留token的前4个字符，短token整个隐藏
+func MaskToken(token string) string {
+	switch {
+	case token == "":
+		return ""
+	case len(token) < 12:
+		return "****"
+	}
+	return token[:4] + "****"
+}
+
+/* ---------- YAML 子集 ---------- */
+
+// node 是映射中的一项：标量值、字符串列表或下一层映射
+type node struct {
+	line     int
+	key      string
+	value    string
+	hasValue bool
+	list     []string
+	isList   bool
+	children []*node
+}
+
+func (n *node) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", n.line, fmt.Sprintf(format, args...))
+}
+
+func (n *node) scalar() (string, error) {
+	if n.isList || len(n.children) > 0 {
+		return "", n.errorf("%s must be a single value", n.key)
+	}
+	return n.value, nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+func parseYAML(src string) ([]*node, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(src, "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", i+1)
+		}
+		text = strings.TrimSpace(stripComment(text))
+		if text == "" || text == "---" {
+			continue
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: text})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	nodes, next, err := parseMapping(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[next].num)
+	}
+	return nodes, nil
+}
+
+// parseMapping 解析从 lines[i] 开始、缩进为 indent 的一组键，返回它们和之后第一行的下标
+func parseMapping(lines []yamlLine, i, indent int) ([]*node, int, error) {
+	var nodes []*node
+	seen := map[string]bool{}
+	for i < len(lines) && lines[i].indent == indent {
+		l := lines[i]
+		if strings.HasPrefix(l.text, "- ") || l.text == "-" {
+			return nil, 0, fmt.Errorf("line %d: unexpected list item", l.num)
+		}
+		key, rest, ok := splitKey(l.text)
+		if !ok {
+			return nil, 0, fmt.Errorf("line %d: expected \"key: value\"", l.num)
+		}
+		if seen[key] {
+			return nil, 0, fmt.Errorf("line %d: duplicate key %q", l.num, key)
+		}
+		seen[key] = true
+		n := &node{line: l.num, key: key}
+		nodes = append(nodes, n)
+		i++
+		if rest != "" {
+			var err error
+			if strings.HasPrefix(rest, "[") {
+				n.isList = true
+				n.list, err = parseFlowList(rest)
+			} else {
+				n.hasValue = true
+				n.value, err = unquote(rest)
+			}
+			if err != nil {
+				return nil, 0, fmt.Errorf("line %d: %w", l.num, err)
+			}
+			continue
+		}
+		if i >= len(lines) || lines[i].indent <= indent {
+			// 空值
+			n.hasValue = true
+			continue
+		}
+		child := lines[i].indent
+		if strings.HasPrefix(lines[i].text, "-") {
+			n.isList = true
+			for i < len(lines) && lines[i].indent == child && strings.HasPrefix(lines[i].text, "-") {
+				item, err := unquote(strings.TrimSpace(strings.TrimPrefix(lines[i].text, "-")))
+				if err != nil {
+					return nil, 0, fmt.Errorf("line %d: %w", lines[i].num, err)
+				}
+				n.list = append(n.list, item)
+				i++
+			}
+			continue
+		}
+		var err error
+		if n.children, i, err = parseMapping(lines, i, child); err != nil {
+			return nil, 0, err
+		}
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, 0, fmt.Errorf("line %d: unexpected indentation", lines[i].num)
+	}
+	return nodes, i, nil
+}
+
+// splitKey 把 "key: value" 或 "key:" 拆开，键可以加引号
+func splitKey(text string) (key, rest string, ok bool) {
+	if q := text[0]; q == '"' || q == '\'' {
+		end := strings.IndexByte(text[1:], q)
+		if end < 0 || !strings.HasPrefix(text[end+2:], ":") {
+			return "", "", false
+		}
+		key, rest = text[1:end+1], text[end+3:]
+	} else {
+		i := strings.Index(text, ": ")
+		switch {
+		case i >= 0:
+			key, rest = text[:i], text[i+2:]
+		case strings.HasSuffix(text, ":"):
+			key = strings.TrimSuffix(text, ":")
+		default:
+			return "", "", false
+		}
+	}
+	key = strings.TrimSpace(key)
+	return key, strings.TrimSpace(rest), key != ""
+}
+
+// stripComment 去掉行尾注释：行首或空白之后、不在引号中的 #
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// unquote 解析一个标量：双引号中支持 \" \\ \n \t 等转义，单引号中连续两个单引号表示一个单引号，否则原样
+func unquote(s string) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted string %s", s)
+		}
+		return v, nil
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'"):
+		return "", fmt.Errorf("unterminated quoted string %s", s)
+	}
+	return s, nil
+}
+
+// parseFlowList 解析一行内的 [a, "b c", 'd']
+func parseFlowList(s string) ([]string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("unterminated list %s", s)
+	}
+	body := strings.TrimSpace(s[1 : len(s)-1])
+	if body == "" {
+		return []string{}, nil
+	}
+	var items []string
+	for body != "" {
+		var item string
+		if q := body[0]; q == '"' || q == '\'' {
+			end := 1
+			for end < len(body) && body[end] != q {
+				if q == '"' && body[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(body) {
+				return nil, fmt.Errorf("unterminated quoted string in %s", s)
+			}
+			v, err := unquote(body[:end+1])
+			if err != nil {
+				return nil, err
+			}
+			item, body = v, strings.TrimSpace(body[end+1:])
+			if body != "" && !strings.HasPrefix(body, ",") {
+				return nil, fmt.Errorf("expected \",\" after %s in %s", item, s)
+			}
+		} else {
+			i := strings.IndexByte(body, ',')
+			if i < 0 {
+				i = len(body)
+			}
+			item, body = strings.TrimSpace(body[:i]), body[i:]
+		}
+		items = append(items, item)
+		body = strings.TrimSpace(strings.TrimPrefix(body, ","))
+	}
+	return items, nil
+}
@@ -0,0 +1,190 @@
+// Package clientstate 管理客户端保存在本地的状态文件（配置、信任库、历史、队列、缓存等）。
+//
+// CI 中可能同时运行几十个 wsbox client 进程，它们读写同一组文件。
+// 每次修改都在文件锁内完成，并通过"临时文件 + fsync + rename"原子替换，
+// 读者要么看到旧内容要么看到新内容，不会看到写了一半的文件。
+package clientstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LockTimeout 是等待文件锁的最长时间，超时后返回 ErrLocked
+var LockTimeout = 10 * time.Second
+
+// ErrLocked 表示在 LockTimeout 内没有拿到文件锁
+var ErrLocked = errors.New("state file is locked by another wsbox process")
+
+// Store 是一个状态目录，目录下每个名字对应一个独立加锁的文件
+type Store struct {
+	dir string
+}
+
+// DefaultDir 返回默认的状态目录：$WSBOX_STATE_DIR，否则为用户配置目录下的 wsbox
+func DefaultDir() (string, error) {
+	if d := os.Getenv("WSBOX_STATE_DIR"); d != "" {
+		return d, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "wsbox"), nil
+}
+
+// Open 打开（必要时创建）状态目录
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Path 返回状态文件的完整路径
+func (s *Store) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// Read 在共享锁下读取状态文件，文件不存在时返回 nil, nil
+func (s *Store) Read(name string) ([]byte, error) {
+	var data []byte
+	err := s.withLock(name, false, func() error {
+		b, err := os.ReadFile(s.Path(name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		data = b
+		return err
+	})
+	return data, err
+}
+
+// Update 在排他锁下读取旧内容、调用 fn 计算新内容并原子写回。
+// fn 返回错误时文件保持不变；fn 返回 nil 切片时删除该文件
+func (s *Store) Update(name string, fn func(old []byte) ([]byte, error)) error {
+	return s.withLock(name, true, func() error {
+		old, err := os.ReadFile(s.Path(name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		data, err := fn(old)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			err := os.Remove(s.Path(name))
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		return writeAtomic(s.Path(name), data)
+	})
+}
+
+// Append 在排他锁下向文件末尾追加一行，适用于历史日志这类只追加的文件
+func (s *Store) Append(name string, line []byte) error {
+	return s.withLock(name, true, func() error {
+		f, err := os.OpenFile(s.Path(name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		if len(line) == 0 || line[len(line)-1] != '\n' {
+			line = append(line, '\n')
+		}
+		if _, err := f.Write(line); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// ReadJSON 读取并解析 JSON 状态文件，文件不存在时 v 保持不变
+func (s *Store) ReadJSON(name string, v any) error {
+	b, err := s.Read(name)
+	if err != nil || b == nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %w", s.Path(name), err)
+	}
+	return nil
+}
+
+// UpdateJSON 在排他锁下把文件解析到 v，调用 fn 修改 v 后写回
+func (s *Store) UpdateJSON(name string, v any, fn func() error) error {
+	return s.Update(name, func(old []byte) ([]byte, error) {
+		if len(old) > 0 {
+			if err := json.Unmarshal(old, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.Path(name), err)
+			}
+		}
+		if err := fn(); err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(v, "", "  ")
+	})
+}
+
+// withLock 获取 name 对应的锁文件后执行 fn。锁被占用时带抖动重试，直到 LockTimeout
+func (s *Store) withLock(name string, exclusive bool, fn func() error) error {
+	lockPath := s.Path(name) + ".lock"
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		unlock, err := lockFile(lockPath, exclusive)
+		if err == nil {
+			defer unlock()
+			return fn()
+		}
+		if !errors.Is(err, errWouldBlock) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s: %w", s.Path(name), ErrLocked)
+		}
+		time.Sleep(time.Duration(5+rand.Intn(20)) * time.Millisecond)
+	}
+}
+
+// rename 是 writeAtomic 最后一步用的重命名，测试中替换它来模拟写到一半时中断
+var rename = os.Rename
+
+// writeAtomic 写入同目录下的临时文件并 fsync，然后重命名覆盖目标文件
+func writeAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
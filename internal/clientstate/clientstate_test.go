@@ -0,0 +1,169 @@
+package clientstate
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain 在设置了 WSBOX_TEST_HOLD_LOCK（"目录\n名字"）时充当另一个进程：
+// 在 Update 中输出 "locked" 后一直持有排他锁，直到 stdin 关闭或被杀掉
+func TestMain(m *testing.M) {
+	if v, ok := os.LookupEnv("WSBOX_TEST_HOLD_LOCK"); ok {
+		dir, name, _ := strings.Cut(v, "\n")
+		s, err := Open(dir)
+		if err == nil {
+			err = s.Update(name, func(old []byte) ([]byte, error) {
+				os.Stdout.WriteString("locked\n")
+				io.Copy(io.Discard, os.Stdin)
+				return []byte("from the other process"), nil
+			})
+		}
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// 多个 goroutine 同时做读-改-写，每次递增都不丢失
+func TestConcurrentUpdate(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每次写入都要 fsync，慢的磁盘上排队可能超过默认的 LockTimeout
+	old := LockTimeout
+	LockTimeout = time.Minute
+	t.Cleanup(func() { LockTimeout = old })
+	const workers, rounds = 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*rounds)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				var counter struct{ N int }
+				errs <- s.UpdateJSON("counter.json", &counter, func() error {
+					counter.N++
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var counter struct{ N int }
+	if err := s.ReadJSON("counter.json", &counter); err != nil {
+		t.Fatal(err)
+	}
+	if counter.N != workers*rounds {
+		t.Errorf("counter = %d after %d increments", counter.N, workers*rounds)
+	}
+}
+
+// 另一个进程持有锁时读写都等到 LockTimeout 后返回 ErrLocked，文件不变；
+// 那个进程崩溃（被杀掉）时内核释放锁，它没写完的修改不会出现
+func TestLockedByAnotherProcess(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update("queue", func([]byte) ([]byte, error) { return []byte("before"), nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "WSBOX_TEST_HOLD_LOCK="+dir+"\nqueue")
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	if line, _ := bufio.NewReader(stdout).ReadString('\n'); line != "locked\n" {
+		cmd.Process.Kill()
+		t.Fatalf("helper process said %q", line)
+	}
+
+	old := LockTimeout
+	LockTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { LockTimeout = old })
+	start := time.Now()
+	err = s.Update("queue", func([]byte) ([]byte, error) { return []byte("mine"), nil })
+	if !errors.Is(err, ErrLocked) {
+		t.Errorf("Update while another process holds the lock: %v, want ErrLocked", err)
+	}
+	if waited := time.Since(start); waited < LockTimeout {
+		t.Errorf("gave up after %v, before LockTimeout", waited)
+	}
+	if _, err := s.Read("queue"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Read while another process holds the lock: %v, want ErrLocked", err)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	if b, err := s.Read("queue"); err != nil || string(b) != "before" {
+		t.Errorf("after the other process died: %q, %v; want the previous content", b, err)
+	}
+	if err := s.Update("queue", func([]byte) ([]byte, error) { return []byte("mine"), nil }); err != nil {
+		t.Errorf("lock not released after the other process died: %v", err)
+	}
+}
+
+// 原子写在重命名之前中断：原来的文件完整保留，临时文件被清理；
+// 崩溃留下的写了一半的临时文件不影响读取和之后的写入
+func TestInterruptedWrite(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update("profiles.json", func([]byte) ([]byte, error) { return []byte(`{"v":1}`), nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	rename = func(string, string) error { return errors.New("power lost") }
+	err = s.Update("profiles.json", func([]byte) ([]byte, error) { return []byte(`{"v":2}`), nil })
+	rename = os.Rename
+	if err == nil {
+		t.Fatal("Update succeeded although the rename failed")
+	}
+	if b, _ := s.Read("profiles.json"); string(b) != `{"v":1}` {
+		t.Errorf("after an interrupted write the file is %q, want the previous content", b)
+	}
+	if tmps, _ := filepath.Glob(s.Path(".profiles.json.tmp-*")); len(tmps) != 0 {
+		t.Errorf("temporary files left behind: %v", tmps)
+	}
+
+	// 进程在写临时文件时崩溃，来不及清理
+	os.WriteFile(s.Path(".profiles.json.tmp-123"), []byte(`{"v":`), 0o600)
+	if b, _ := s.Read("profiles.json"); string(b) != `{"v":1}` {
+		t.Errorf("a torn temporary file changed the content to %q", b)
+	}
+	for i := 2; i <= 3; i++ {
+		if err := s.Update("profiles.json", func([]byte) ([]byte, error) { return []byte(`{"v":` + strconv.Itoa(i) + `}`), nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b, _ := s.Read("profiles.json"); string(b) != `{"v":3}` {
+		t.Errorf("after the crash: %q", b)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !unix
+
+package clientstate
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+var errWouldBlock = errors.New("lock busy")
+
+// staleLockAge 之后的锁文件视为持有进程已崩溃，可以被清理
+const staleLockAge = 30 * time.Second
+
+// lockFile 在没有 flock 的平台上以 O_EXCL 创建锁文件作为互斥锁。
+// 共享锁同样按排他处理，读者之间会串行，但保证正确性
+func lockFile(path string, exclusive bool) (func(), error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if fi, serr := os.Stat(path); serr == nil && time.Since(fi.ModTime()) > staleLockAge {
+			os.Remove(path)
+		}
+		return nil, errWouldBlock
+	}
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
@@ -0,0 +1,304 @@
+// Package compat 是协议版本之间的兼容性矩阵：把冻结的 v1 客户端、服务端（一问一答的最初协议）
+// 与当前实现两两组合，在每个组合上跑同一套操作（列表、上传、下载、删除、错误、空文件、非ASCII文件名），
+// 任何一个组合出错即视为回归。整个包只有测试文件，随 go test ./... 运行。
+//
+// 新的协议特性必须在 Features 中声明协商方式，否则矩阵直接失败。默认只跑四个基本组合作为冒烟测试，
+// -tags compat 时还会对每个可以单独关闭的特性在当前实现之间再跑一轮"协商关闭"的组合（见 fullMatrix）
+package compat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"wsbox/pkg/client"
+	"wsbox/pkg/server"
+)
+
+/* ---------- 对端 ---------- */
+
+// Client 是操作集需要的客户端能力，v1 和当前实现各有一个适配
+type Client interface {
+	List(dir string) ([]string, error)
+	Upload(remote string, data []byte) error
+	Download(remote string) ([]byte, error)
+	Delete(remote string) error
+	Mkdir(remote string) error
+	Move(src, dst string) error
+	Tail(remote string, lines int) ([]byte, error)
+	Du(dir string) (total int64, err error)
+	Close() error
+}
+
+// StatusError 是服务端返回的错误状态。连接在此之后仍然可用，与网络错误区分
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.Status, e.Message)
+}
+
+// peer 是服务端的一个实例
+type peer interface {
+	URL() string
+	Close() error
+}
+
+// Version 是参与组合的实现
+type Version string
+
+const (
+	V1      Version = "v1"
+	Current Version = "current"
+)
+
+const token = "compat-token"
+
+// activitySize 打开活动记录，与命令行的默认配置一样让服务端公布 activity 特性
+const activitySize = 100
+
+// Setup 是一个组合的配置，Features 中的 Off 通过修改它来关闭特性
+type Setup struct {
+	Server  server.Config
+	Client  client.Options
+	Disable map[string]bool // 不调用 Feature.Use 的特性
+}
+
+// currentServer 包装 pkg/server
+type currentServer struct {
+	s   *server.Server
+	url string
+}
+
+func startCurrentServer(cfg server.Config) (*currentServer, error) {
+	s, err := server.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go s.Serve(ln)
+	return &currentServer{s: s, url: "ws://" + ln.Addr().String() + "/ws"}, nil
+}
+
+func (s *currentServer) URL() string { return s.url }
+
+func (s *currentServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.s.Shutdown(ctx)
+}
+
+// currentClient 包装 pkg/client，下载走命令行同样使用的 DownloadFile
+type currentClient struct {
+	c   *client.Client
+	tmp string
+}
+
+func (c *currentClient) List(dir string) ([]string, error) {
+	res, err := c.c.List(dir)
+	if err != nil {
+		return nil, wrapRemote(err)
+	}
+	return res.Entries, nil
+}
+
+func (c *currentClient) Upload(remote string, data []byte) error {
+	_, err := c.c.Upload(remote, bytes.NewReader(data))
+	return wrapRemote(err)
+}
+
+func (c *currentClient) Download(remote string) ([]byte, error) {
+	local := filepath.Join(c.tmp, "download")
+	defer os.Remove(local)
+	if _, err := c.c.DownloadFile(remote, local, nil); err != nil {
+		return nil, wrapRemote(err)
+	}
+	return os.ReadFile(local)
+}
+
+func (c *currentClient) Delete(remote string) error {
+	return wrapRemote(c.c.Delete(remote, false))
+}
+
+func (c *currentClient) Mkdir(remote string) error {
+	_, err := c.c.Mkdir(remote)
+	return wrapRemote(err)
+}
+
+func (c *currentClient) Move(src, dst string) error {
+	return wrapRemote(c.c.Move(src, dst, false))
+}
+
+func (c *currentClient) Tail(remote string, lines int) ([]byte, error) {
+	b, err := c.c.Tail(remote, lines, -1)
+	return b, wrapRemote(err)
+}
+
+func (c *currentClient) Du(dir string) (int64, error) {
+	res, err := c.c.Du(dir)
+	if err != nil {
+		return 0, wrapRemote(err)
+	}
+	return res.Total, nil
+}
+
+func (c *currentClient) Close() error { return c.c.Close() }
+
+func wrapRemote(err error) error {
+	var re *client.RemoteError
+	if errors.As(err, &re) {
+		return &StatusError{Status: re.Status, Message: re.Message()}
+	}
+	return err
+}
+
+/* ---------- 矩阵 ---------- */
+
+// Result 是一个组合上一项操作的结果
+type Result struct {
+	Op     string
+	Status string // ok、failed 或 skipped
+	Detail string
+}
+
+// pairing 是一个组合
+type pairing struct {
+	name           string
+	client, server Version
+	off            *Feature // 完整矩阵中关闭的特性
+}
+
+// pairings 返回 v1 与当前实现的四个组合，full 时另加每个可关闭特性的"当前 x 当前，该特性关闭"
+func pairings(full bool) []pairing {
+	var ps []pairing
+	for _, cv := range []Version{V1, Current} {
+		for _, sv := range []Version{V1, Current} {
+			ps = append(ps, pairing{name: fmt.Sprintf("%s client x %s server", cv, sv), client: cv, server: sv})
+		}
+	}
+	if full {
+		for i := range Features {
+			if f := &Features[i]; f.Off != nil {
+				ps = append(ps, pairing{name: "current x current, " + f.Name + " off", client: Current, server: Current, off: f})
+			}
+		}
+	}
+	return ps
+}
+
+// TestCompat 运行矩阵，每个组合是一个子测试；不带 -tags compat 时只跑四个基本组合
+func TestCompat(t *testing.T) {
+	ctx := t.Context()
+	if err := checkDeclared(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pairings(fullMatrix) {
+		t.Run(p.name, func(t *testing.T) {
+			res, err := runPairing(ctx, p)
+			if err != nil {
+				t.Fatalf("setup: %v", err)
+			}
+			for _, r := range res {
+				switch r.Status {
+				case "failed":
+					t.Errorf("%s: %s", r.Op, r.Detail)
+				case "skipped":
+					t.Logf("%s: skipped", r.Op)
+				}
+			}
+		})
+	}
+}
+
+// runPairing 在临时沙箱中启动服务端，连接后执行操作集
+func runPairing(ctx context.Context, p pairing) ([]Result, error) {
+	dir, err := os.MkdirTemp("", "wsbox-compat-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	sandbox, tmp := filepath.Join(dir, "sandbox"), filepath.Join(dir, "client")
+	os.Mkdir(sandbox, 0755)
+	os.Mkdir(tmp, 0755)
+
+	setup := &Setup{
+		Server:  server.Config{Dir: sandbox, Token: token, FlowWindow: client.FlowWindow, ActivitySize: activitySize, Pipeline: 8},
+		Client:  client.Options{Pipeline: 4},
+		Disable: map[string]bool{},
+	}
+	if p.off != nil {
+		p.off.Off(setup)
+	}
+	var srv peer
+	if p.server == V1 {
+		srv, err = startV1Server(sandbox, token)
+	} else {
+		srv, err = startCurrentServer(setup.Server)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer srv.Close()
+
+	var cl Client
+	caps := map[string]bool{}
+	if p.client == V1 {
+		cl, err = dialWithRetry(ctx, func() (Client, error) { return dialV1(ctx, srv.URL(), token) })
+	} else {
+		cl, err = dialWithRetry(ctx, func() (Client, error) {
+			c, err := client.DialContext(ctx, srv.URL(), token, setup.Client)
+			if err != nil {
+				return nil, err
+			}
+			if res, err := c.Caps(); err == nil {
+				for _, f := range res.Features {
+					caps[f] = true
+				}
+			}
+			// 服务端不支持的特性由 Use 自己退回，操作集照常进行
+			for _, f := range Features {
+				if f.Use != nil && caps[f.Name] && !setup.Disable[f.Name] {
+					if err := f.Use(c); err != nil {
+						c.Close()
+						return nil, fmt.Errorf("enable %s: %w", f.Name, err)
+					}
+				}
+			}
+			return &currentClient{c: c, tmp: tmp}, nil
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+	env := &env{client: cl, clientVersion: p.client, serverVersion: p.server}
+	return runSuite(env), nil
+}
+
+// dialWithRetry 等待刚启动的服务端开始接受连接
+func dialWithRetry(ctx context.Context, dial func() (Client, error)) (Client, error) {
+	var err error
+	for i := 0; i < 50; i++ {
+		var c Client
+		if c, err = dial(); err == nil {
+			return c, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	return nil, err
+}
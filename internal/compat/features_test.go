@@ -0,0 +1,131 @@
+package compat
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"wsbox/pkg/client"
+	"wsbox/pkg/server"
+)
+
+/* ---------- 特性声明 ---------- */
+
+// Negotiation 是特性的协商方式
+type Negotiation int
+
+const (
+	// Baseline 是 v1 就有的能力，不需要协商
+	Baseline Negotiation = iota
+	// Upgrade 在 websocket 升级时用请求头协商，对端不认识时双方回到 v1 的帧格式
+	Upgrade
+	// Caps 由服务端在 /_caps 中公布，客户端使用前先查询，旧服务端上不使用
+	Caps
+)
+
+// Feature 声明一个协议特性的协商行为。服务端在 /_caps 中公布的每个特性都必须在 Features 中声明
+type Feature struct {
+	Name        string // 与 /_caps 中的名字相同
+	Negotiation Negotiation
+	// Off 在当前实现之间关闭该特性，完整矩阵据此跑一轮协商关闭的组合。
+	// 为 nil 时关闭的路径只由 v1 对端覆盖（当前客户端连 v1 服务端时该特性不可用）
+	Off func(*Setup)
+	// Use 让当前客户端用上该特性，只在服务端公布了它时调用；为 nil 表示操作集会自动用到或不涉及它
+	Use func(*client.Client) error
+}
+
+// disable 返回不调用 Use 的 Off
+func disable(name string) func(*Setup) {
+	return func(s *Setup) { s.Disable[name] = true }
+}
+
+// Features 是所有协议特性的协商声明。新增特性时在这里登记，否则矩阵失败
+var Features = []Feature{
+	{Name: "list", Negotiation: Baseline},
+	{Name: "upload", Negotiation: Baseline},
+	{Name: "download", Negotiation: Baseline},
+	{Name: "flow-control", Negotiation: Upgrade, Off: func(s *Setup) { s.Server.FlowWindow = 0 }},
+	{Name: "stream-upload", Negotiation: Upgrade, Off: func(s *Setup) { s.Client.NoStreaming = true }},
+	{Name: "progress", Negotiation: Upgrade, Off: func(s *Setup) { s.Client.NoProgress = true }},
+	{Name: "canonical-path", Negotiation: Upgrade, Off: func(s *Setup) { s.Client.NoCanonical = true }},
+	{Name: "pipeline", Negotiation: Upgrade, Off: func(s *Setup) { s.Client.Pipeline = 0 }},
+	{Name: "json-frames", Negotiation: Upgrade, Off: func(s *Setup) { s.Client.LegacyProtocol = true }},
+	{Name: "sparse", Negotiation: Caps},
+	{Name: "stat", Negotiation: Caps},
+	{Name: "lock", Negotiation: Caps},
+	{Name: "delete", Negotiation: Caps},
+	{Name: "stream-list", Negotiation: Caps},
+	{Name: "list-long", Negotiation: Caps},
+	{Name: "dir-counts", Negotiation: Caps},
+	{Name: "resume-upload", Negotiation: Caps},
+	{Name: "activity", Negotiation: Caps},
+	{Name: "upload-limit", Negotiation: Caps},
+	{Name: "bench", Negotiation: Caps},
+	{Name: "overwrite", Negotiation: Caps},
+	{Name: "mkdir", Negotiation: Caps},
+	{Name: "move", Negotiation: Caps},
+	{Name: "tail", Negotiation: Caps},
+	{Name: "du", Negotiation: Caps},
+	{Name: "find", Negotiation: Caps},
+	{Name: "tree", Negotiation: Caps},
+	{Name: "archive", Negotiation: Caps},
+	{Name: "extract", Negotiation: Caps},
+	{Name: "append", Negotiation: Caps},
+	{
+		Name: "metadata", Negotiation: Caps, Off: disable("metadata"),
+		Use: func(c *client.Client) error { return c.SetMetadata(map[string]string{"compat": "matrix"}) },
+	},
+	{
+		Name: "sha256", Negotiation: Caps, Off: disable("sha256"),
+		Use: func(c *client.Client) error { return c.SetVerify(true) },
+	},
+	{
+		Name: "attrs", Negotiation: Caps, Off: disable("attrs"),
+		Use: func(c *client.Client) error { return c.SetPreserve(true) },
+	},
+	// 开启校验后自动使用；流式上传关闭时（stream-upload off）退回请求行中声明的摘要
+	{Name: "sha256-trailer", Negotiation: Caps},
+}
+
+// checkDeclared 启动一个当前服务端，确认它公布的特性都有声明，声明的特性也都还存在
+func checkDeclared(ctx context.Context) error {
+	dir, err := os.MkdirTemp("", "wsbox-compat-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	srv, err := startCurrentServer(server.Config{Dir: dir, Token: token, FlowWindow: client.FlowWindow, ActivitySize: activitySize, Pipeline: 8})
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+	var caps *client.Capabilities
+	_, err = dialWithRetry(ctx, func() (Client, error) {
+		c, err := client.DialContext(ctx, srv.URL(), token, client.Options{})
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		caps, err = c.Caps()
+		return nil, err
+	})
+	if err != nil {
+		return err
+	}
+	declared := map[string]bool{}
+	for _, f := range Features {
+		declared[f.Name] = true
+		if f.Negotiation == Upgrade && f.Off == nil {
+			return fmt.Errorf("feature %q is negotiated on upgrade but declares no Off", f.Name)
+		}
+		if !caps.HasFeature(f.Name) {
+			return fmt.Errorf("feature %q is declared in the compatibility matrix but not advertised by the server", f.Name)
+		}
+	}
+	for _, name := range caps.Features {
+		if !declared[name] {
+			return fmt.Errorf("feature %q is advertised by the server but has no negotiation declaration in compat.Features", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+//go:build compat
+
+package compat
+
+// fullMatrix 为 true：另跑每个可关闭特性的"当前 x 当前，该特性关闭"组合
+const fullMatrix = true
@@ -0,0 +1,6 @@
+//go:build !compat
+
+package compat
+
+// fullMatrix 为 false：go test ./... 只跑四个基本组合，完整矩阵用 -tags compat
+const fullMatrix = false
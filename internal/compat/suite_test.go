@@ -0,0 +1,244 @@
+package compat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+)
+
+/* ---------- 操作集 ---------- */
+
+// env 是一个组合上的操作环境
+type env struct {
+	client        Client
+	clientVersion Version
+	serverVersion Version
+}
+
+// errSkip 表示该操作不适用于这个组合（如 v1 客户端没有删除）
+var errSkip = errors.New("skipped")
+
+type op struct {
+	name string
+	run  func(e *env) error
+}
+
+// largeSize 跨过上传分块（1MiB）和下载流控块（64KiB）的边界，且不是它们的整数倍
+const largeSize = 5<<19 + 123
+
+func payload(n int) []byte {
+	b := make([]byte, n)
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := range b {
+		b[i] = byte(r.Uint32())
+	}
+	return b
+}
+
+// roundTrip 上传后下载，核对内容一致
+func roundTrip(e *env, remote string, data []byte) error {
+	if err := e.client.Upload(remote, data); err != nil {
+		return fmt.Errorf("upload: %w", err)
+	}
+	got, err := e.client.Download(remote)
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	if !bytes.Equal(got, data) {
+		return fmt.Errorf("downloaded %d bytes differ from the %d uploaded", len(got), len(data))
+	}
+	return nil
+}
+
+// wantStatus 要求 err 是服务端返回的错误状态（连接仍可用），status 为0时不限具体状态码
+func wantStatus(err error, status int) error {
+	var se *StatusError
+	switch {
+	case err == nil:
+		return errors.New("succeeded, expected an error status")
+	case !errors.As(err, &se):
+		return fmt.Errorf("expected an error status, got %v", err)
+	case status != 0 && se.Status != status:
+		return fmt.Errorf("expected status %d, got %d (%s)", status, se.Status, se.Message)
+	}
+	return nil
+}
+
+// wantList 要求目录条目与 want 相同，不计顺序
+func wantList(e *env, dir string, want ...string) error {
+	got, err := e.client.List(dir)
+	if err != nil {
+		return err
+	}
+	got = slices.Clone(got)
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		return fmt.Errorf("list %s: got %q, want %q", dir, got, want)
+	}
+	return nil
+}
+
+const unicodeName = "données-日本語.txt"
+
+// oddName 含有在请求行中有特殊含义的字符：空格分隔字段，# 和 ? 在URL中截断路径，% 是转义符
+const oddName = "a b#1?%20 é.txt"
+
+var suite = []op{
+	{"small file", func(e *env) error { return roundTrip(e, "/compat/hello.txt", []byte("hello, wsbox\n")) }},
+	{"empty file", func(e *env) error { return roundTrip(e, "/compat/empty", []byte{}) }},
+	{"unicode name", func(e *env) error { return roundTrip(e, "/compat/"+unicodeName, []byte("unicode\n")) }},
+	{"large file", func(e *env) error { return roundTrip(e, "/compat/sub/deep/blob.bin", payload(largeSize)) }},
+	{"overwrite", func(e *env) error { return roundTrip(e, "/compat/hello.txt", []byte("hello again\n")) }},
+	{"list", func(e *env) error { return wantList(e, "/compat", "hello.txt", "empty", unicodeName, "sub/") }},
+	{"list nested", func(e *env) error { return wantList(e, "/compat/sub", "deep/") }},
+	{"special characters", func(e *env) error {
+		if e.clientVersion == V1 {
+			// v1 客户端不转义路径，空格会截断请求行
+			return errSkip
+		}
+		if err := roundTrip(e, "/compat-names/my dir/"+oddName, []byte("odd\n")); err != nil {
+			return err
+		}
+		if err := wantList(e, "/compat-names", "my dir/"); err != nil {
+			return err
+		}
+		return wantList(e, "/compat-names/my dir", oddName)
+	}},
+	{"missing file", func(e *env) error {
+		_, err := e.client.Download("/compat/missing.txt")
+		return wantStatus(err, http.StatusNotFound)
+	}},
+	{"missing dir", func(e *env) error {
+		_, err := e.client.List("/compat/missing")
+		return wantStatus(err, http.StatusNotFound)
+	}},
+	{"delete", func(e *env) error {
+		if e.clientVersion == V1 {
+			return errSkip
+		}
+		err := e.client.Delete("/compat/hello.txt")
+		if e.serverVersion == V1 {
+			// v1 服务端没有 DELETE：必须是干净的错误状态，文件保持原样
+			if err := wantStatus(err, http.StatusMethodNotAllowed); err != nil {
+				return err
+			}
+			_, err := e.client.Download("/compat/hello.txt")
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		_, err = e.client.Download("/compat/hello.txt")
+		return wantStatus(err, http.StatusNotFound)
+	}},
+	{"mkdir", func(e *env) error {
+		if e.clientVersion == V1 {
+			return errSkip
+		}
+		err := e.client.Mkdir("/compat-dirs/a/b")
+		if e.serverVersion == V1 {
+			// v1 服务端不认识 MKDIR：必须是干净的错误状态
+			return wantStatus(err, http.StatusMethodNotAllowed)
+		}
+		if err != nil {
+			return err
+		}
+		// 空目录出现在列表中，重复创建不是错误
+		if err := wantList(e, "/compat-dirs/a", "b/"); err != nil {
+			return err
+		}
+		return e.client.Mkdir("/compat-dirs/a/b")
+	}},
+	{"move", func(e *env) error {
+		if e.clientVersion == V1 {
+			return errSkip
+		}
+		if err := e.client.Upload("/compat/move-src.txt", []byte("move")); err != nil {
+			return err
+		}
+		err := e.client.Move("/compat/move-src.txt", "/compat-moved/dst.txt")
+		if e.serverVersion == V1 {
+			// v1 服务端不认识 MOVE：必须是干净的错误状态，源文件保持原样
+			if err := wantStatus(err, http.StatusMethodNotAllowed); err != nil {
+				return err
+			}
+			_, err := e.client.Download("/compat/move-src.txt")
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := e.client.Download("/compat/move-src.txt"); wantStatus(err, http.StatusNotFound) != nil {
+			return fmt.Errorf("source still present after move: %v", err)
+		}
+		_, err = e.client.Download("/compat-moved/dst.txt")
+		return err
+	}},
+	{"tail", func(e *env) error {
+		if e.clientVersion == V1 {
+			return errSkip
+		}
+		if err := e.client.Upload("/compat/tail.txt", []byte("one\ntwo\nthree\n")); err != nil {
+			return err
+		}
+		got, err := e.client.Tail("/compat/tail.txt", 2)
+		if e.serverVersion == V1 {
+			// v1 服务端把 /_tail 当作下载不存在的文件
+			return wantStatus(err, http.StatusNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if string(got) != "two\nthree\n" {
+			return fmt.Errorf("tail returned %q", got)
+		}
+		return nil
+	}},
+	{"du", func(e *env) error {
+		if e.clientVersion == V1 {
+			return errSkip
+		}
+		for remote, data := range map[string]string{"/compat-du/a/x.txt": "abc", "/compat-du/y.txt": "de"} {
+			if err := e.client.Upload(remote, []byte(data)); err != nil {
+				return err
+			}
+		}
+		total, err := e.client.Du("/compat-du")
+		if e.serverVersion == V1 {
+			// v1 服务端没有 /_caps，Du 在查询特性时就得到干净的 404，不会发出 /_du
+			return wantStatus(err, http.StatusNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if total != 5 {
+			return fmt.Errorf("du reported %d bytes, want 5", total)
+		}
+		return nil
+	}},
+	{"connection reusable", func(e *env) error {
+		_, err := e.client.List("/")
+		return err
+	}},
+}
+
+// runSuite 依次执行操作集，某一项失败不影响后面的项
+func runSuite(e *env) []Result {
+	var res []Result
+	for _, o := range suite {
+		err := o.run(e)
+		switch {
+		case errors.Is(err, errSkip):
+			res = append(res, Result{Op: o.name, Status: "skipped"})
+		case err != nil:
+			res = append(res, Result{Op: o.name, Status: "failed", Detail: err.Error()})
+		default:
+			res = append(res, Result{Op: o.name, Status: "ok"})
+		}
+	}
+	return res
+}
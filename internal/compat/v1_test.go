@@ -0,0 +1,274 @@
+package compat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+/* ---------- 冻结的 v1 实现 ---------- */
+
+// 这里是最初版本的一问一答协议的冻结副本：请求是文本帧 "METHOD PATH"，POST 的正文是紧随其后的一个二进制帧，
+// 响应是文本帧 "status len" 加一个正文帧；没有任何升级协商，/_list 返回名字数组，也没有 DELETE。
+// 不要为了新特性修改这里，它代表的是已经部署在外的旧版对端
+
+var errNotInV1 = errors.New("not implemented in v1")
+
+// v1Server 是最初的服务端：网关把每个请求转发给只监听回环地址的本地处理器
+type v1Server struct {
+	dir, token string
+	gw, local  *http.Server
+	url        string
+}
+
+func startV1Server(dir, token string) (*v1Server, error) {
+	s := &v1Server{dir: dir, token: token}
+	localLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	gwLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		localLn.Close()
+		return nil, err
+	}
+	s.local = &http.Server{Handler: http.HandlerFunc(s.localHandler)}
+	go s.local.Serve(localLn)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.gatewayHandler("http://"+localLn.Addr().String()))
+	s.gw = &http.Server{Handler: mux}
+	go s.gw.Serve(gwLn)
+	s.url = "ws://" + gwLn.Addr().String() + "/ws"
+	return s, nil
+}
+
+func (s *v1Server) URL() string { return s.url }
+
+func (s *v1Server) Close() error {
+	s.gw.Close()
+	return s.local.Close()
+}
+
+// securePath 把请求路径限制在沙箱内
+func (s *v1Server) securePath(p string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(filepath.Clean("/"+p)))
+}
+
+func (s *v1Server) localHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if r.URL.Path == "/_list" {
+			dir := r.URL.Query().Get("dir")
+			if dir == "" {
+				dir = "/"
+			}
+			stat, err := os.Stat(s.securePath(dir))
+			if err != nil {
+				if os.IsNotExist(err) {
+					http.Error(w, "directory not found", http.StatusNotFound)
+				} else {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+			if !stat.IsDir() {
+				http.Error(w, "not a directory", http.StatusBadRequest)
+				return
+			}
+			entries, err := os.ReadDir(s.securePath(dir))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			var names []string
+			for _, e := range entries {
+				n := e.Name()
+				if e.IsDir() {
+					n += "/"
+				}
+				names = append(names, n)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(names)
+			return
+		}
+		real := s.securePath(r.URL.Path)
+		fi, err := os.Stat(real)
+		if err != nil || fi.IsDir() {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename=`+strconv.Quote(filepath.Base(real)))
+		http.ServeFile(w, r, real)
+
+	case "POST":
+		real := s.securePath(r.URL.Path)
+		if err := os.MkdirAll(filepath.Dir(real), 0755); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, err := os.Create(real)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, err = io.Copy(f, r.Body)
+		f.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintln(w, "ok")
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+var v1Upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+func (s *v1Server) gatewayHandler(local string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.token {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := v1Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			msgType, payload, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if msgType != websocket.TextMessage {
+				continue
+			}
+			parts := strings.SplitN(string(payload), " ", 3)
+			if len(parts) < 2 {
+				continue
+			}
+			method, path := parts[0], parts[1]
+			var body io.Reader
+			if method == "POST" {
+				_, fileData, err := conn.ReadMessage()
+				if err != nil {
+					conn.WriteMessage(websocket.TextMessage, []byte("ERR "+err.Error()))
+					continue
+				}
+				body = bytes.NewReader(fileData)
+			} else if len(parts) == 3 {
+				body = strings.NewReader(parts[2])
+			}
+			req, err := http.NewRequest(method, local+path, body)
+			if err != nil {
+				conn.WriteMessage(websocket.TextMessage, []byte("ERR "+err.Error()))
+				continue
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				conn.WriteMessage(websocket.TextMessage, []byte("ERR "+err.Error()))
+				continue
+			}
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%d %d", resp.StatusCode, len(b))))
+			conn.WriteMessage(websocket.BinaryMessage, b)
+		}
+	}
+}
+
+// v1Client 是最初的客户端：每个命令一问一答，不协商任何参数
+type v1Client struct {
+	conn *websocket.Conn
+}
+
+func dialV1(ctx context.Context, rawURL, token string) (Client, error) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer "+token)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, rawURL, h)
+	if err != nil {
+		return nil, err
+	}
+	return &v1Client{conn: conn}, nil
+}
+
+// roundTrip 发送请求并读取 "status len" 与正文帧
+func (c *v1Client) roundTrip(req string, body []byte) ([]byte, error) {
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+		return nil, err
+	}
+	if body != nil {
+		if err := c.conn.WriteMessage(websocket.BinaryMessage, body); err != nil {
+			return nil, err
+		}
+	}
+	_, headerMsg, err := c.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Fields(string(headerMsg))
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("bad header: %s", headerMsg)
+	}
+	status, _ := strconv.Atoi(parts[0])
+	_, bodyMsg, err := c.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if status >= 400 {
+		return nil, &StatusError{Status: status, Message: strings.TrimSpace(string(bodyMsg))}
+	}
+	return bodyMsg, nil
+}
+
+func (c *v1Client) List(dir string) ([]string, error) {
+	body, err := c.roundTrip("GET /_list?dir="+url.QueryEscape(dir), nil)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(body, &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (c *v1Client) Upload(remote string, data []byte) error {
+	if data == nil {
+		data = []byte{}
+	}
+	_, err := c.roundTrip("POST "+remote, data)
+	return err
+}
+
+func (c *v1Client) Download(remote string) ([]byte, error) {
+	return c.roundTrip("GET "+remote, nil)
+}
+
+func (c *v1Client) Delete(string) error { return errNotInV1 }
+
+func (c *v1Client) Mkdir(string) error { return errNotInV1 }
+
+func (c *v1Client) Move(string, string) error { return errNotInV1 }
+
+func (c *v1Client) Tail(string, int) ([]byte, error) { return nil, errNotInV1 }
+
+func (c *v1Client) Du(string) (int64, error) { return 0, errNotInV1 }
+
+func (c *v1Client) Close() error { return c.conn.Close() }
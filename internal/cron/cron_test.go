@@ -0,0 +1,162 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		spec, want string
+	}{
+		{"", "expected 5 fields"},
+		{"* * * *", "got 4"},
+		{"* * * * * *", "got 6"},
+		{"@fortnightly", "unknown schedule"},
+		{"60 * * * *", `minute: "60" is not between 0 and 59`},
+		{"* 24 * * *", "hour"},
+		{"* * 0 * *", "day of month"},
+		{"* * 32 * *", "day of month"},
+		{"* * * 13 *", "month"},
+		{"* * * * 8", "day of week"},
+		{"* * * foo *", `month: "foo"`},
+		{"*/0 * * * *", `minute: bad step "0"`},
+		{"*/x * * * *", "bad step"},
+		{"*/-5 * * * *", "bad step"},
+		{"30-10 * * * *", "backwards"},
+		{"1,,2 * * * *", `minute: ""`},
+		{"a-5 * * * *", "minute"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) = %v, want an error containing %q", tt.spec, err, tt.want)
+		}
+	}
+}
+
+// set 把值列表转成字段的位集合，方便和解析结果比较
+func set(vs ...int) uint64 {
+	var b uint64
+	for _, v := range vs {
+		b |= 1 << v
+	}
+	return b
+}
+
+func span(lo, hi, step int) uint64 {
+	var b uint64
+	for v := lo; v <= hi; v += step {
+		b |= 1 << v
+	}
+	return b
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Schedule
+	}{
+		{"* * * * *", Schedule{span(0, 59, 1), span(0, 23, 1), span(1, 31, 1), span(1, 12, 1), span(0, 6, 1), true, true}},
+		{"*/15 9-17 1,15 * mon-fri", Schedule{set(0, 15, 30, 45), span(9, 17, 1), set(1, 15), span(1, 12, 1), span(1, 5, 1), false, false}},
+		{"5/20 0 * jan,JUL sun", Schedule{set(5, 25, 45), set(0), span(1, 31, 1), set(1, 7), set(0), true, false}},
+		{"0 0 * * 7", Schedule{set(0), set(0), span(1, 31, 1), span(1, 12, 1), set(0), true, false}},         // 7 也是周日
+		{"0 0 * * 5-7", Schedule{set(0), set(0), span(1, 31, 1), span(1, 12, 1), set(0, 5, 6), true, false}}, // 包含周日的范围
+		{"0-30/10 */6 */2 */3 *", Schedule{set(0, 10, 20, 30), set(0, 6, 12, 18), span(1, 31, 2), set(1, 4, 7, 10), span(0, 6, 1), true, true}},
+		{"@hourly", Schedule{set(0), span(0, 23, 1), span(1, 31, 1), span(1, 12, 1), span(0, 6, 1), true, true}},
+		{"  @Weekly ", Schedule{set(0), set(0), span(1, 31, 1), span(1, 12, 1), set(0), true, false}},
+		{"@yearly", Schedule{set(0), set(0), set(1), set(1), span(0, 6, 1), false, true}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if *s != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.spec, *s, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2024-05-01 是周三
+	from := time.Date(2024, 5, 1, 13, 22, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want string // 空表示永远不会触发
+	}{
+		{"* * * * *", "2024-05-01 13:23"},
+		{"22 13 * * *", "2024-05-02 13:22"}, // 严格晚于 from，同一分钟不算
+		{"*/15 * * * *", "2024-05-01 13:30"},
+		{"0 * * * *", "2024-05-01 14:00"},
+		{"30 9 * * mon-fri", "2024-05-02 09:30"},
+		{"0 0 * * sun", "2024-05-05 00:00"},
+		{"0 0 * * 7", "2024-05-05 00:00"},
+		{"0 0 1 * *", "2024-06-01 00:00"},
+		{"@yearly", "2025-01-01 00:00"},
+		{"0 12 31 * *", "2024-05-31 12:00"},
+		{"0 12 31 6 *", ""}, // 6月没有31日
+		{"0 0 29 2 *", "2028-02-29 00:00"},
+		{"0 0 30 2 *", ""},
+		// 日和周都指定时满足其一即可：13日或周五，5月3日是周五
+		{"0 0 13 * fri", "2024-05-03 00:00"},
+		// 其中一个是 "*" 时两者都要满足：周五且为任意日
+		{"0 0 * * fri", "2024-05-03 00:00"},
+		// 带步长的 "*" 仍然算 "*"：*/2 日且周一，5月13日
+		{"0 0 */2 * mon", "2024-05-13 00:00"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		got := s.Next(from)
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%q: Next = %v, want never", tt.spec, got)
+			}
+			continue
+		}
+		if f := got.Format("2006-01-02 15:04"); f != tt.want {
+			t.Errorf("%q: Next = %s, want %s", tt.spec, f, tt.want)
+		}
+	}
+}
+
+// 时间按传入的时区解释；夏令时跳过的时刻当天不触发，查找不会停在跳变处
+func TestNextLocation(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+	s, _ := Parse("30 2 * * *")
+	// 2024-03-10 02:00 跳到 03:00，当天没有 02:30
+	got := s.Next(time.Date(2024, 3, 9, 12, 0, 0, 0, ny))
+	if want := time.Date(2024, 3, 11, 2, 30, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("across spring forward: Next = %v, want %v", got, want)
+	}
+	// 每天 02:xx 的表达式在跳过的那一小时也不会卡住
+	s, _ = Parse("*/20 2 * * *")
+	if got := s.Next(time.Date(2024, 3, 10, 1, 59, 0, 0, ny)); !got.Equal(time.Date(2024, 3, 11, 2, 0, 0, 0, ny)) {
+		t.Errorf("hour skipped by spring forward: Next = %v", got)
+	}
+	// 2024-11-03 01:30 出现两次，触发时间仍然严格递增
+	s, _ = Parse("30 1 * * *")
+	first := s.Next(time.Date(2024, 11, 3, 0, 0, 0, 0, ny))
+	second := s.Next(first)
+	if first.Hour() != 1 || first.Minute() != 30 || !second.After(first) {
+		t.Errorf("across fall back: Next = %v then %v", first, second)
+	}
+
+	// 同一个绝对时刻在不同时区得到不同的下一次触发
+	s, _ = Parse("0 9 * * *")
+	from := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if got := s.Next(from.In(ny)); !got.Equal(time.Date(2024, 5, 1, 9, 0, 0, 0, ny)) {
+		t.Errorf("New York: Next = %v", got)
+	}
+	if got := s.Next(from); !got.Equal(time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("UTC: Next = %v", got)
+	}
+}
@@ -0,0 +1,321 @@
+package i18n
+
+// 英文目录是所有消息ID的基准，其他语言缺少的条目回退到这里
+func init() {
+	register("en", map[string]string{
+		"usage.missing_local":         "missing local-file",
+		"usage.missing_remote":        "missing remote-file",
+		"status.dial_failed":          "dial: %v",
+		"status.metadata_failed":      "metadata: %s",
+		"status.metadata_unsupported": "this server does not accept request metadata (-header); upgrade the server",
+		"status.remote_error":         "remote error (%d): %s",
+		"status.read_only":            "server is read-only",
+		"status.busy":                 "the server is busy with other directory walks, try again in a few seconds",
+		"status.exists":               "the remote file already exists and the server does not overwrite files; use add -f to replace it",
+		"estimate.plan":               "plan: %d files, %s (%d skipped)",
+		"estimate.over_limit":         "warning: %d files exceed the server's upload limit (%s) and would be rejected",
+		"estimate.probed":             "measured %s in %s (round trip %s)",
+		"estimate.probe_unsupported":  "this server cannot measure throughput, using the saved history",
+		"estimate.from_history":       "using %d saved throughput samples",
+		"estimate.no_throughput":      "no throughput measurement available; run without -no-probe or after an upload to this server",
+		"estimate.throughput":         "throughput: %s - %s",
+		"estimate.eta":                "estimated time: %s - %s",
+		"status.too_large":            "file exceeds the server's upload limit (%s)",
+		"status.token_revoked":        "token revoked by the server, reconnect with the new token",
+		"status.token_required":       "the server requires a token: give it with -token-file, $WSBOX_TOKEN, -token or ws://token@host",
+		"status.token_rejected":       "the token was rejected by the server",
+		"status.shutdown":             "the server is shutting down, try again shortly",
+		"status.message_too_big":      "message exceeds server limit (-max-message-size); use a client and server that negotiate chunked uploads, or raise the limit",
+		"status.response_too_big":     "the server sent a message larger than -max-message-size; raise it, or use a server that supports flow control so downloads arrive in chunks",
+		"status.aliased":              "note: %s is an alias on the server, the canonical path is %s; update saved references",
+		"status.clock_skew":           "warning: the server clock differs from this machine by %s, remote modification times are adjusted",
+		"status.upload_done":          "upload done: %s",
+		"status.upload_unchanged":     "skipped %s (unchanged)",
+		"status.upload_resumed":       "resuming: %s of %s are already on the server",
+		"status.download_done":        "download done -> %s",
+		"status.download_resumed":     "resumed: %s of %s were already downloaded",
+		"status.partial_kept":         "the partial download is kept in %s, run the same command again to resume",
+		"status.download_failed":      "download failed: %v",
+		"status.retrying":             "attempt %d of %d failed: %s; retrying in %s",
+		"status.timeout_connect":      "timed out after %s connecting to the server",
+		"status.timeout_response":     "timed out after %s waiting for the server to respond",
+		"status.timeout_transfer":     "transfer stalled: no data moved for %s",
+		"status.proxy_refused":        "the proxy %s refused the connection: %s",
+		"status.proxy_failed":         "cannot connect through the proxy %s: %v",
+		"status.read_failed":          "read file error: %v",
+		"status.digest_mismatch":      "SHA-256 mismatch for %s: expected %s, got %s; the file was removed",
+		"status.verify_unsupported":   "warning: the server does not support SHA-256 verification, transfers are not verified",
+		"status.verified":             "SHA-256 verified",
+		"status.flow_window":          "flow control: window %d chunks x %s (requested %d)",
+		"status.flow_unsupported":     "flow control: not supported by server, using single-frame responses",
+		"status.stream_chunks":        "upload streaming: %s chunks",
+		"status.stream_unsupported":   "upload streaming: not supported by server, sending files as a single frame",
+		"status.prealloc_failed":      "cannot allocate %d bytes for the download: %v",
+		"status.dir_upload":           "%s is a directory, use add -r to upload it",
+		"status.case_collision":       "%s differs only by case from existing local file %s",
+		"status.case_renamed":         "%s differs only by case from existing local file %s, saving as %s",
+		"status.tree_file_done":       "uploaded %s (%s)",
+		"status.tree_file_failed":     "failed %s: %v",
+		"status.tree_skipped":         "skipped symlink %s",
+		"status.tree_excluded":        "excluded %s (%s)",
+		"status.tree_summary":         "%d files uploaded, %s, %d failed, %d skipped",
+		"status.tree_file_unchanged":  "skipped %s (unchanged)",
+		"status.tree_unchanged":       "%d files skipped (unchanged)",
+		"status.fail_fast":            "stopped after the first failure: %s",
+		"status.parallel_dial":        "could not open another connection (%d in use): %s",
+		"status.tree_fetched":         "fetched %s (%s)",
+		"status.tree_exists":          "skipped %s, same size exists locally",
+		"status.tree_truncated":       "warning: listing of %s is incomplete, some files may be missing",
+		"status.tree_fetch_summary":   "%d files fetched, %s, %d skipped, %d failed",
+		"status.archive_done":         "archive saved -> %s (%d files, %s)",
+		"status.archive_skipped":      "note: the server skipped %d entries (symlinks, special or unreadable files)",
+		"status.archive_changed":      "warning: %d files changed on the server while they were archived, their content may be inconsistent",
+		"status.archive_fallback":     "the server cannot build archives, downloading file by file",
+		"status.extract_done":         "extracted %d files (%s) into %s",
+		"status.append_done":          "appended %s to %s (now %s)",
+		"status.activity_gap":         "note: some operations were missed (the server restarted or its activity buffer overflowed)",
+		"status.extract_skipped":      "note: the server did not extract %d links or special files",
+		"status.extract_format":       "cannot tell the archive format of %s from its name, use -format tgz or -format zip",
+		"status.delete_done":          "deleted: %s",
+		"status.delete_failed":        "delete failed: %v",
+		"status.mkdir_done":           "created: %s",
+		"status.mkdir_exists":         "already exists: %s",
+		"status.mkdir_failed":         "mkdir failed: %v",
+		"status.mkdir_unsupported":    "this server cannot create directories; upgrade the server or upload a file into the directory",
+		"status.move_done":            "moved: %s -> %s",
+		"status.move_exists":          "%s already exists; use mv -f to replace it",
+		"status.move_failed":          "move failed: %v",
+		"status.move_unsupported":     "this server cannot move files; upgrade the server",
+		"stat.missing":                "%s does not exist",
+		"stat.path":                   "path:",
+		"stat.type":                   "type:",
+		"stat.size":                   "size:",
+		"stat.modified":               "modified:",
+		"stat.mode":                   "mode:",
+		"stat.locked":                 "locked:",
+		"stat.lock_detail":            "by %s since %s, ttl %s",
+		"stat.hash_unsupported":       "this server does not return SHA-256 in stat; upgrade the server",
+		"find.bad_type":               "-type must be f or d",
+		"find.negative":               "-maxdepth and -n must not be negative",
+		"find.incomplete":             "warning: results are incomplete: %s",
+		"list.truncated":              "(truncated: %s)",
+		"list.incomplete":             "warning: listing is incomplete: %s",
+		"du.incomplete":               "warning: sizes are incomplete: %s",
+		"counts.first_scan":           "note: the first scan is still running, %d directories counted so far",
+		"counts.summary":              "%d directories, last full scan %s",
+		"status.sparse_stats":         "sparse transfer: %d extents, %s of %s sent, holes skipped",
+		"status.recv_stats":           "received %s in %d chunks, sent %d acks",
+		"status.sent_stats":           "sent %s in %d chunks",
+		"status.parallel_workers":     "transferring %d files at once over %d connections (pipelined: %d)",
+		"state.need_dir":              "-state-dir is required",
+		"state.compact_failed":        "compact: %v",
+		"test.error":                  "test: %v",
+		"test.clock":                  "clock offset %s (rtt %s)",
+		"test.operand":                "%s: exists=%t dir=%t size=%d mtime=%s",
+		"doctor.bad_url":              "invalid server url: %v",
+		"schema.unknown":              "unknown schema %q, run \"wsbox schema\" to list them",
+		"sync.not_dir":                "%s is not a directory; use add to upload a single file",
+		"sync.delete_truncated":       "warning: the listing of %s is incomplete, -delete is disabled for this run",
+		"sync.would_upload":           "upload %s (%s, %s)",
+		"sync.would_mkdir":            "mkdir %s",
+		"sync.would_delete":           "delete %s",
+		"sync.would_exclude":          "skip %s (excluded by %s)",
+		"sync.dry_run_summary":        "dry run: %d files to upload (%s), %d unchanged, %d to delete",
+		"sync.summary":                "%d files uploaded (%s), %d unchanged, %d deleted, %d failed",
+		"watch.start":                 "watching %s -> %s, press Ctrl-C to stop",
+		"watch.flushing":              "stopping: uploading the remaining changes",
+		"watch.disconnected":          "connection lost: %s",
+		"watch.reconnect_failed":      "reconnect failed: %s, retrying in %s",
+		"watch.reconnected":           "reconnected",
+		"watch.unflushed":             "%d changes were not uploaded",
+		"watch.summary":               "%d files uploaded (%s), %d deleted, %d failed",
+		"shell.welcome":               "connected to %s; type help for commands, exit or Ctrl-D to quit",
+		"shell.unknown":               "unknown command %q, type help for the list",
+		"shell.interrupted":           "interrupted",
+		"shell.reconnecting":          "connection lost (%s), reconnecting",
+		"shell.put_dir":               "%s is a directory; put uploads single files, use add -r or sync for trees",
+		"shell.put_exists":            "%s already exists; use put -f to replace it",
+		"shell.refreshed":             "%s: %d entries",
+		"shell.cmd.ls":                "list a directory, -l with mode, size and modification time",
+		"shell.cmd.cd":                "change the current remote directory (cd - goes back, cd alone to /, -f ignores cached listings)",
+		"shell.cmd.pwd":               "print the current remote directory",
+		"shell.cmd.get":               "download a file",
+		"shell.cmd.put":               "upload a file, -f replaces an existing one",
+		"shell.cmd.rm":                "delete files, -r also directories",
+		"shell.cmd.mkdir":             "create directories and missing parents",
+		"shell.cmd.stat":              "show the metadata of a path",
+		"shell.cmd.refresh":           "list a directory again and replace its cached listing and those below it; without dir, drop the whole cache",
+		"shell.cmd.help":              "show this list",
+		"shell.cmd.exit":              "close the connection and quit (also Ctrl-D)",
+		"profile.no_config":           "no client config file at %s",
+		"profile.not_found":           "profile %q is not defined in %s",
+		"profile.none":                "%s defines no profiles",
+		"profile.col_name":            "NAME",
+		"profile.col_url":             "URL",
+		"profile.col_token":           "TOKEN",
+		"profile.col_flags":           "FLAGS",
+		"profile.default":             "(default)",
+		"profile.protected":           "(protected)",
+		"profile.file":                "config file: %s",
+		"pull.not_dir":                "%s exists and is not a directory",
+		"pull.not_remote_dir":         "%s is not a remote directory",
+		"pull.would_download":         "download %s (%s, %s)",
+		"pull.dry_run_summary":        "dry run: %d files to download (%s), %d unchanged, %d to delete",
+		"pull.summary":                "%d files downloaded (%s), %d unchanged, %d deleted, %d failed",
+		"status.stdio_single":         "\"-\" (stdin/stdout) works with single-file transfers only, not with -r, -resume or -estimate",
+		"status.stdin_unsupported":    "this server cannot receive uploads of unknown size; upgrade the server or upload a file",
+		"tail.not_file":               "%s is not a remote file",
+		"tail.unsupported":            "this server cannot read the end of a file; upgrade the server or use get",
+		"tail.missing":                "%s has been removed, waiting for it to reappear",
+		"tail.truncated":              "%s was truncated or replaced, following from the start",
+		"browse.no_terminal":          "browse needs an interactive terminal",
+		"browse.help":                 "↑↓ move  ⏎ open  ← up  / filter  d download  y copy path  s stat  r refresh  Tab details  q quit",
+		"browse.truncated":            "listing incomplete, showing %d entries",
+		"browse.no_preview":           "no preview: %v",
+		"browse.empty_file":           "(empty file)",
+		"browse.binary":               "(binary file, no preview)",
+		"browse.copied":               "copied %s (printed again on exit)",
+		"browse.dir_download":         "directories cannot be downloaded here, use get -r",
+		"browse.downloading":          "downloading %s ...",
+		"browse.downloaded":           "downloaded %s (%s)",
+		"browse.overwrite":            "%s exists locally, overwrite? [y/N]",
+		"browse.too_small":            "terminal too small",
+		"browse.no_entries":           "(no entries)",
+		"browse.count":                "%d/%d entries",
+		"browse.file":                 "file",
+		"browse.directory":            "directory",
+		"browse.size":                 "size: %s",
+		"browse.modified":             "modified: %s",
+		"guard.fs_root":               "the filesystem root",
+		"guard.home":                  "your home directory",
+		"guard.cwd":                   "the current directory",
+		"guard.sandbox_root":          "the whole sandbox",
+		"guard.refused":               "refusing recursive operation on %s: it is %s; pass %s if this is intended",
+		"guard.upload_summary":        "about to upload %s: %d files, %s, to %s",
+		"guard.need_yes":              "the upload exceeds -confirm-over %s and stdin is not a terminal; pass -yes to confirm",
+		"guard.prompt":                "continue? [y/N] ",
+		"guard.aborted":               "aborted",
+		"guard.protected_summary":     "about to %s on protected profile %s (%s)",
+		"guard.protected_need_yes":    "profile %s is protected and stdin is not a terminal; pass -yes to confirm",
+		"guard.protected_prompt":      "type %s to continue: ",
+		"server.sandbox":              "sandbox: %s",
+		"server.token":                "fixed token: %s",
+		"server.token_file":           "token: read from %s (re-read on SIGHUP)",
+		"server.read_only":            "read-only: uploads, deletes and locks are refused",
+
+		"help.usage":                  "Usage:",
+		"help.flags":                  "Flags:",
+		"help.commands":               "Commands:",
+		"help.examples":               "Examples:",
+		"help.global_flags":           "Global Flags:",
+		"help.lang_flag":              "  -lang string    output language (en, zh), accepted anywhere on the command line;\n                  defaults to WSBOX_LANG, LC_ALL, LC_MESSAGES, LANG, then English",
+		"help.default":                "(default %s)",
+		"help.more":                   "Run \"%s help <command>\" for the flags and examples of a command.",
+		"help.unknown":                "unknown command '%s'",
+		"help.did_you_mean":           "unknown command '%s', did you mean '%s'?",
+		"help.see":                    "Run \"%s help\" for the list of commands.",
+		"summary.wsbox":               "wsbox shares a sandbox directory over WebSocket: a file server, and a client to list, upload and download files.",
+		"summary.server":              "start the file server",
+		"summary.server.audit":        "check the configuration for security issues, exits non-zero on high-severity findings",
+		"summary.server.state":        "check or compact the state store while the server is stopped",
+		"summary.server.verify_audit": "check the sequence numbers and hash chain of an -audit-log file, exits non-zero if it was altered",
+		"summary.client":              "connect to a server and operate on files",
+		"summary.schema":              "print the JSON Schema of a JSON output, or list the schemas without a name",
+		"summary.help":                "show the help of a command",
+		"summary.client.list":         "list a directory as a tree, or the newest files with -latest",
+		"summary.client.append":       "append a local file or stdin to the end of a remote file",
+		"summary.client.add":          "upload a file, or a directory tree with -r; -extract unpacks an archive on the server",
+		"summary.client.get":          "download a file, or a directory tree with -r or as one archive with -archive",
+		"summary.client.delete":       "delete a remote file, or a directory and its contents with -r",
+		"summary.client.mkdir":        "create a remote directory and any missing parents",
+		"summary.client.mv":           "move or rename a remote file or directory",
+		"summary.client.sync":         "upload the changes of a local directory to a remote directory",
+		"summary.client.watch":        "keep running and upload local changes to a remote directory as they happen",
+		"summary.client.shell":        "dial once and run ls, cd, get, put and more at an interactive prompt",
+		"summary.client.profiles":     "list the profiles of the client config file, tokens masked",
+		"summary.client.cat":          "print remote files to stdout",
+		"summary.client.tail":         "print the last lines of a remote file, and follow it with -f",
+		"summary.client.pull":         "download the changes of a remote directory to a local directory",
+		"summary.client.stat":         "show the metadata of a remote path without downloading it",
+		"summary.client.doctor":       "diagnose connectivity to the server and suggest fixes",
+		"summary.client.lock":         "acquire, release or list exclusive lock markers; only one client gets a lock",
+		"summary.client.du":           "recursive size of each entry in a directory and the total, like du -s *",
+		"summary.client.find":         "find entries whose name matches a glob (or whose path matches -regex) on the server",
+		"summary.client.counts":       "show the directories with the most entries",
+		"summary.client.activity":     "show recently completed uploads, downloads and deletes",
+		"summary.client.cron":         "run a client command on a schedule in the foreground",
+		"summary.client.test":         "check a path for scripts, the answer is the exit status",
+		"summary.client.browse":       "read-only terminal browser",
+		"details.client.transfer": `Recursive transfers refuse /, the home directory, the current directory and (for get) the
+sandbox root as the tree root unless --i-know-what-im-doing is given.
+The SHA-256 of each file is verified with the server: a mismatched upload is rejected, a mismatched
+download is deleted and the command exits non-zero; -no-verify skips the check.
+Modification times and permissions are preserved in both directions (only times on Windows);
+-no-preserve gives files the transfer time and default permissions instead.
+add -if-changed skips files whose remote copy has the same size and SHA-256.
+Single-file transfers show a progress bar (bytes, percent, rate, ETA) when stdout is a terminal.
+-retries n retries dial failures, dropped connections and 5xx responses with exponential backoff from
+-retry-delay; 4xx responses are never retried and a retried download continues from its .part file.
+-r skips paths matching .wsboxignore in the source root (gitignore syntax), -exclude or -include;
+excluded directories are not walked, -v lists what was excluded.`,
+		"details.client.append": `The remote file is created if it does not exist. The server receives the whole body before writing it
+in one piece, so concurrent appends to the same file never interleave and a failed append leaves the
+file unchanged. The new size of the remote file is printed (and reported by the global -json).
+Appends are not retried automatically, as repeating a successful one would duplicate the data.`,
+		"details.client.cron": `Schedules are five cron fields ("*/15 * * * *") or @hourly, @daily, @weekly, @monthly.
+A run still in progress skips the next one, failed runs are retried before the next run.
+SIGINT/SIGTERM waits for the current run, a second signal kills it.`,
+		"details.client.test": `Prints nothing: exit status 0 means true, 1 false, 2 an error.
+Operands are remote paths unless prefixed with "local:"; -nt and -ot compare modification times
+after adjusting remote times for the server's clock offset (see the client flag -mtime-slack).`,
+		"details.client.sync": `Files are uploaded when they are new, differ in size, or have a different modification time than the
+remote copy, which keeps the local time when the server supports it (see -mtime-slack); with -no-preserve
+or an older server, only files modified locally after the remote copy was uploaded are sent (remote times
+are adjusted for the server's clock offset). -checksum compares SHA-256 instead; -if-changed compares
+SHA-256 only when the modification time differs and skips files with the same content.
+Missing remote directories are created. -delete also removes remote entries that do not exist locally. Changed files are replaced even if the server refuses overwrites.
+Everything runs over one connection; -P n runs up to n uploads at once (pipelined on that connection
+when the server allows it, otherwise over extra connections). The
+reason for each upload is shown by -dry-run (new, size, mtime, checksum, type), together with the paths
+excluded by .wsboxignore, -exclude or -include; excluded remote paths are neither compared nor deleted.`,
+		"details.client.watch": `The local directory is scanned every -interval; a changed file is uploaded once it has not changed for
+-debounce, so an editor saving in several writes causes one upload. The directory as it is at start is
+the baseline and is not uploaded (run sync first to align both sides). -delete removes the remote copy
+of removed files and directories. Paths excluded by .wsboxignore in the local directory (gitignore syntax,
+reread when it changes), -exclude or -include are skipped. Everything runs over one connection, which is redialed with backoff if it drops.
+Ctrl-C uploads the remaining changes before exiting, a second Ctrl-C exits at once.`,
+		"details.client.shell": `Dials once and runs commands at a prompt; relative paths are resolved against the current remote
+directory. On a terminal the line can be edited (arrows, Ctrl-A/E/U/K/W), Up/Down browse the history
+(kept in the client state directory) and Tab completes commands and remote names (local names for put).
+If the connection drops, the shell redials with the same address and token and retries the command once;
+Ctrl-C during a command aborts it. Running client without a command on a terminal also starts the shell.
+With input from a pipe, commands are read one per line without a prompt and the exit status is 1 if any failed.`,
+		"details.client": `The token is taken from the first of: -token, -token-file (first line of the file), $WSBOX_TOKEN,
+the token of the selected profile (not when -s is given), and the user part of the address (ws://token@host).
+The token is sent in the Authorization header, never in the URL; prefer -token-file or $WSBOX_TOKEN, since
+-token and ws://token@host are visible in ps output and shell history.
+
+Exit status: 0 success, 1 other errors (server errors including read-only mode, local files, some files of a tree failed), 2 usage
+errors, 3 remote path not found (404), 4 authentication failed (401/403, token revoked), 5 cannot connect,
+the connection was lost or timed out. test and find keep the conventions of POSIX test and grep.
+
+-connect-timeout (default 30s) limits dialing, -op-timeout how long a request waits for the server to start
+answering, -transfer-stall-timeout how long a transfer may go without moving any data.
+-proxy (http://, https:// or socks5://, with user:password@ for authentication) overrides $HTTPS_PROXY,
+$HTTP_PROXY and $NO_PROXY.`,
+		"details.client.profiles": `The active profile is marked with *. A profile is chosen with -profile, $WSBOX_PROFILE or the file's
+default key; explicit command-line flags override it, and -token, -token-file and $WSBOX_TOKEN override its token.`,
+		"details.client.tail": `The server reads the file backwards and returns only the requested lines, so the end of a large log
+is cheap. With -f the file size is checked every -s over the same connection and appended data is
+printed; if the file shrinks (truncated or rotated) it is followed from the start.`,
+		"details.client.pull": `The reverse of sync: files missing locally or differing in size or modification time are downloaded,
+and keep the remote modification time; -mtime-slack loosens the comparison for coarse filesystems.
+Missing local directories are created; -delete also removes local entries that do not exist on the server.
+The rules of .wsboxignore in the remote directory, -exclude and -include apply to both sides as for sync.
+The exit status is non-zero if any file failed.`,
+		"details.client.stat": `Exit status: 0 if the path exists, 3 if it does not, otherwise as for every client command (see "wsbox help client").
+With -json the result is printed even when the path does not exist (see "wsbox schema stat").`,
+		"details.client.browse": `Navigate directories, preview the start of files, filter with /, download the selected file (d),
+copy its remote path (y), show its details (s) and refresh (r). Linux terminals only.`,
+	})
+}
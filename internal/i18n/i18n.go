@@ -0,0 +1,102 @@
+// Package i18n 是命令行输出的消息目录。每种语言是一张以消息ID为键的表，
+// 增加语言只需新增一个注册表格的文件；缺少译文的消息回退到英文。
+// 错误码、日志和 JSON 输出不经过这里，始终与语言无关。
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Fallback 是缺少译文或无法识别语言时使用的语言
+const Fallback = "en"
+
+var (
+	catalogs = map[string]map[string]string{}
+	current  = Fallback
+)
+
+// register 由各语言文件在 init 中调用
+func register(lang string, messages map[string]string) {
+	catalogs[lang] = messages
+}
+
+// SetLang 设置当前语言，未登记的语言回退到英文
+func SetLang(lang string) {
+	if _, ok := catalogs[lang]; ok {
+		current = lang
+		return
+	}
+	current = Fallback
+}
+
+// Lang 返回当前语言
+func Lang() string {
+	return current
+}
+
+// Detect 依次根据显式指定的语言、WSBOX_LANG、LC_ALL、LC_MESSAGES、LANG 选择语言，
+// 如 "zh_CN.UTF-8" 识别为 "zh"。都不可用时返回英文
+func Detect(explicit string) string {
+	candidates := []string{explicit, os.Getenv("WSBOX_LANG"), os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")}
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		lang := normalize(c)
+		if _, ok := catalogs[lang]; ok {
+			return lang
+		}
+		// 显式指定或环境变量给出但不支持的语言不再继续往下找，直接回退到英文
+		return Fallback
+	}
+	return Fallback
+}
+
+func normalize(locale string) string {
+	l := strings.ToLower(locale)
+	if i := strings.IndexAny(l, "_.-@"); i >= 0 {
+		l = l[:i]
+	}
+	return l
+}
+
+// T 返回当前语言的消息，带参数时按 fmt.Sprintf 格式化。
+// 当前语言缺少译文时回退到英文，英文也缺少时返回消息ID本身
+func T(id string, args ...any) string {
+	msg, ok := catalogs[current][id]
+	if !ok {
+		msg, ok = catalogs[Fallback][id]
+	}
+	if !ok {
+		msg = id
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// SplitFlag 从参数中取出 -lang/--lang，支持 "-lang zh" 和 "--lang=zh" 两种写法，
+// 使该标志可以出现在任意子命令的任意位置
+func SplitFlag(args []string) (rest []string, lang string) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			return append(rest, args[i:]...), lang
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if !strings.HasPrefix(a, "-") || name != "lang" {
+			rest = append(rest, a)
+			continue
+		}
+		if hasValue {
+			lang = value
+		} else if i+1 < len(args) {
+			lang = args[i+1]
+			i++
+		}
+	}
+	return rest, lang
+}
@@ -0,0 +1,97 @@
+package i18n
+
+import (
+	"maps"
+	"regexp"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// 每种语言的目录与英文目录的消息ID一一对应，且没有空的消息
+func TestCatalogsComplete(t *testing.T) {
+	en := catalogs[Fallback]
+	if len(en) == 0 {
+		t.Fatal("the English catalog is empty")
+	}
+	for lang, msgs := range catalogs {
+		for id, msg := range msgs {
+			if msg == "" {
+				t.Errorf("%s: %s is empty", lang, id)
+			}
+			if _, ok := en[id]; !ok {
+				t.Errorf("%s: %s is not in the English catalog", lang, id)
+			}
+		}
+		if lang == Fallback {
+			continue
+		}
+		var missing []string
+		for id := range en {
+			if _, ok := msgs[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		sort.Strings(missing)
+		for _, id := range missing {
+			t.Errorf("%s: missing %s", lang, id)
+		}
+	}
+}
+
+var verbRE = regexp.MustCompile(`%[-+# 0]*(?:\[([0-9]+)\])?[0-9]*(?:\.[0-9]+)?([a-zA-Z%])`)
+
+// argVerbs 返回消息中每个参数（从1开始）对应的格式动词，支持译文用 %[n]s 调整参数顺序
+func argVerbs(msg string) map[int]string {
+	verbs := map[int]string{}
+	n := 0
+	for _, m := range verbRE.FindAllStringSubmatch(msg, -1) {
+		if m[2] == "%" {
+			continue
+		}
+		if m[1] != "" {
+			n, _ = strconv.Atoi(m[1])
+		} else {
+			n++
+		}
+		verbs[n] = m[2]
+	}
+	return verbs
+}
+
+// 译文与英文的每个参数使用相同的格式动词，否则 T 的参数会错位
+func TestCatalogVerbs(t *testing.T) {
+	en := catalogs[Fallback]
+	for lang, msgs := range catalogs {
+		if lang == Fallback {
+			continue
+		}
+		for id, msg := range msgs {
+			if want, got := argVerbs(en[id]), argVerbs(msg); !maps.Equal(want, got) {
+				t.Errorf("%s: %s uses arguments %v, English uses %v", lang, id, got, want)
+			}
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for _, env := range []string{"WSBOX_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		t.Setenv(env, "")
+	}
+	tests := []struct {
+		explicit, lang, want string
+	}{
+		{"", "", Fallback},
+		{"zh", "", "zh"},
+		{"", "zh_CN.UTF-8", "zh"},
+		{"", "en_US.UTF-8", "en"},
+		{"fr", "zh_CN.UTF-8", Fallback},
+		{"", "C", Fallback},
+	}
+	for _, tt := range tests {
+		t.Setenv("LANG", tt.lang)
+		if got := Detect(tt.explicit); got != tt.want {
+			t.Errorf("Detect(%q) with LANG=%q = %q, want %q", tt.explicit, tt.lang, got, tt.want)
+		}
+	}
+}
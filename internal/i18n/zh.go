@@ -0,0 +1,301 @@
+package i18n
+
+// 简体中文
+func init() {
+	register("zh", map[string]string{
+		"usage.missing_local":         "缺少本地文件参数",
+		"usage.missing_remote":        "缺少远程文件参数",
+		"status.dial_failed":          "连接失败: %v",
+		"status.metadata_failed":      "元数据: %s",
+		"status.metadata_unsupported": "服务端不支持请求元数据 (-header)，请升级服务端",
+		"status.remote_error":         "服务端错误 (%d): %s",
+		"status.read_only":            "服务器是只读的",
+		"status.busy":                 "服务器正忙于其他目录遍历，请稍后再试",
+		"status.exists":               "远程文件已存在，服务器不允许覆盖；用 add -f 强制替换",
+		"estimate.plan":               "计划: %d 个文件，%s (跳过 %d 个)",
+		"estimate.over_limit":         "警告: %d 个文件超过服务器的上传大小限制 (%s)，会被拒绝",
+		"estimate.probed":             "测速: %s 用时 %s (往返 %s)",
+		"estimate.probe_unsupported":  "该服务器不支持测速，使用保存的吞吐历史",
+		"estimate.from_history":       "使用保存的 %d 个吞吐样本",
+		"estimate.no_throughput":      "没有可用的吞吐数据；去掉 -no-probe，或向该服务器上传过文件后再试",
+		"estimate.throughput":         "吞吐: %s - %s",
+		"estimate.eta":                "预计用时: %s - %s",
+		"status.too_large":            "文件超过了服务器的上传大小限制 (%s)",
+		"status.token_revoked":        "token已被服务端吊销，请使用新token重新连接",
+		"status.token_required":       "服务端要求token：请用 -token-file、$WSBOX_TOKEN、-token 或 ws://token@host 提供",
+		"status.token_rejected":       "token被服务端拒绝",
+		"status.shutdown":             "服务器正在关闭，请稍后重试",
+		"status.message_too_big":      "消息超过服务器的上限（-max-message-size）；请使用支持分块上传的客户端和服务器，或提高上限",
+		"status.response_too_big":     "服务器发来的消息超过 -max-message-size；请提高它，或使用支持流控的服务器让下载分块到达",
+		"status.aliased":              "提示：%s 是服务端的别名，规范路径为 %s，请更新保存的路径",
+		"status.clock_skew":           "警告：服务端时钟与本机相差 %s，远程修改时间已按此换算",
+		"status.upload_done":          "上传完成: %s",
+		"status.upload_unchanged":     "跳过 %s（内容未变）",
+		"status.upload_resumed":       "续传：%s（共 %s）已在服务端",
+		"status.download_done":        "下载完成 -> %s",
+		"status.download_resumed":     "续传：%s（共 %s）已在上次下载",
+		"status.partial_kept":         "已下载的部分保留在 %s，再次执行同一命令即可续传",
+		"status.download_failed":      "下载失败: %v",
+		"status.retrying":             "第 %d 次尝试（共 %d 次）失败: %s；%s 后重试",
+		"status.timeout_connect":      "连接服务端超时（%s）",
+		"status.timeout_response":     "等待服务端响应超时（%s）",
+		"status.timeout_transfer":     "传输停滞: %s 内没有任何数据",
+		"status.proxy_refused":        "代理 %s 拒绝了连接: %s",
+		"status.proxy_failed":         "无法通过代理 %s 连接: %v",
+		"status.read_failed":          "读取文件失败: %v",
+		"status.digest_mismatch":      "%s 的 SHA-256 不一致：应为 %s，实际为 %s；文件已删除",
+		"status.verify_unsupported":   "警告: 服务端不支持 SHA-256 校验，传输内容未经核对",
+		"status.verified":             "SHA-256 校验通过",
+		"status.flow_window":          "流控: 窗口 %d 块 x %s（请求 %d 块）",
+		"status.flow_unsupported":     "流控: 服务端不支持，响应以单帧发送",
+		"status.stream_chunks":        "分块上传: 每块 %s",
+		"status.stream_unsupported":   "分块上传: 服务端不支持，文件以单帧发送",
+		"status.prealloc_failed":      "无法为下载预分配 %d 字节: %v",
+		"status.dir_upload":           "%s 是目录，上传目录请使用 add -r",
+		"status.case_collision":       "%s 与本地已有文件 %s 仅大小写不同",
+		"status.case_renamed":         "%s 与本地已有文件 %s 仅大小写不同，另存为 %s",
+		"status.tree_file_done":       "已上传 %s (%s)",
+		"status.tree_file_failed":     "失败 %s: %v",
+		"status.tree_skipped":         "跳过符号链接 %s",
+		"status.tree_excluded":        "已排除 %s (%s)",
+		"status.tree_summary":         "共上传 %d 个文件，%s，失败 %d 个，跳过 %d 个",
+		"status.tree_file_unchanged":  "跳过 %s（内容未变）",
+		"status.tree_unchanged":       "内容未变而跳过 %d 个文件",
+		"status.fail_fast":            "遇到第一个失败后停止：%s",
+		"status.parallel_dial":        "无法建立更多连接（已有 %d 个）：%s",
+		"status.tree_fetched":         "已下载 %s (%s)",
+		"status.tree_exists":          "跳过 %s，本地已有相同大小的文件",
+		"status.tree_truncated":       "警告: %s 的列表不完整，可能缺少部分文件",
+		"status.tree_fetch_summary":   "共下载 %d 个文件，%s，跳过 %d 个，失败 %d 个",
+		"status.archive_done":         "归档已保存 -> %s（%d 个文件，%s）",
+		"status.archive_skipped":      "注意：服务端跳过了 %d 个条目（符号链接、特殊文件或无法读取的文件）",
+		"status.archive_changed":      "警告：%d 个文件在打包期间被修改，内容可能不一致",
+		"status.archive_fallback":     "服务端不支持打包下载，改为逐个文件下载",
+		"status.extract_done":         "已解包 %d 个文件（%s）到 %s",
+		"status.append_done":          "已追加 %s 到 %s（现在 %s）",
+		"status.activity_gap":         "注意：漏掉了部分操作（服务端重启过或活动缓冲区已溢出）",
+		"status.extract_skipped":      "注意：服务端没有解出 %d 个链接或特殊文件",
+		"status.extract_format":       "无法从文件名判断 %s 的归档格式，请用 -format tgz 或 -format zip 指定",
+		"status.delete_done":          "已删除: %s",
+		"status.delete_failed":        "删除失败: %v",
+		"status.mkdir_done":           "已创建: %s",
+		"status.mkdir_exists":         "已存在: %s",
+		"status.mkdir_failed":         "创建目录失败: %v",
+		"status.mkdir_unsupported":    "该服务器不支持创建目录；请升级服务器，或向目录中上传一个文件",
+		"status.move_done":            "已移动: %s -> %s",
+		"status.move_exists":          "%s 已存在；用 mv -f 替换",
+		"status.move_failed":          "移动失败: %v",
+		"status.move_unsupported":     "该服务器不支持移动文件，请升级服务器",
+		"stat.missing":                "%s 不存在",
+		"stat.path":                   "路径:",
+		"stat.type":                   "类型:",
+		"stat.size":                   "大小:",
+		"stat.modified":               "修改时间:",
+		"stat.mode":                   "权限:",
+		"stat.locked":                 "锁:",
+		"stat.lock_detail":            "%s 持有，获取于 %s，TTL %s",
+		"stat.hash_unsupported":       "该服务器的 stat 不返回 SHA-256，请升级服务器",
+		"find.bad_type":               "-type 只能是 f 或 d",
+		"find.negative":               "-maxdepth 和 -n 不能为负数",
+		"find.incomplete":             "警告: 结果不完整: %s",
+		"list.truncated":              "（已截断：%s）",
+		"list.incomplete":             "警告：列表不完整：%s",
+		"du.incomplete":               "警告：大小统计不完整：%s",
+		"counts.first_scan":           "注意：第一轮巡检尚未完成，已统计 %d 个目录",
+		"counts.summary":              "%d 个目录，上次完整巡检于 %s",
+		"status.sparse_stats":         "稀疏传输：%d 个区段，发送 %s（共 %s），跳过空洞",
+		"status.recv_stats":           "接收 %s，共 %d 个分块，发送 %d 个确认",
+		"status.sent_stats":           "发送 %s，共 %d 个分块",
+		"status.parallel_workers":     "同时传输 %d 个文件，使用 %d 个连接（流水线：%d）",
+		"state.need_dir":              "需要 -state-dir",
+		"state.compact_failed":        "压缩失败：%v",
+		"test.error":                  "test：%v",
+		"test.clock":                  "时钟偏差 %s（往返 %s）",
+		"test.operand":                "%s：存在=%t 目录=%t 大小=%d 修改时间=%s",
+		"doctor.bad_url":              "无效的服务端地址：%v",
+		"schema.unknown":              "没有名为 %q 的结构，运行 \"wsbox schema\" 查看列表",
+		"sync.not_dir":                "%s 不是目录；上传单个文件请用 add",
+		"sync.delete_truncated":       "警告: %s 的列表不完整，本次不执行 -delete",
+		"sync.would_upload":           "上传 %s (%s，%s)",
+		"sync.would_mkdir":            "创建目录 %s",
+		"sync.would_delete":           "删除 %s",
+		"sync.would_exclude":          "跳过 %s (由 %s 排除)",
+		"sync.dry_run_summary":        "演练: 需上传 %d 个文件 (%s)，%d 个未变化，需删除 %d 项",
+		"sync.summary":                "上传 %d 个文件 (%s)，%d 个未变化，删除 %d 项，失败 %d 项",
+		"watch.start":                 "正在监视 %s -> %s，按 Ctrl-C 停止",
+		"watch.flushing":              "正在停止: 上传剩余的改动",
+		"watch.disconnected":          "连接已断开: %s",
+		"watch.reconnect_failed":      "重连失败: %s，%s 后重试",
+		"watch.reconnected":           "已重新连接",
+		"watch.unflushed":             "%d 项改动未能上传",
+		"watch.summary":               "上传 %d 个文件 (%s)，删除 %d 项，失败 %d 项",
+		"shell.welcome":               "已连接到 %s；输入 help 查看命令，exit 或 Ctrl-D 退出",
+		"shell.unknown":               "未知命令 %q，输入 help 查看命令列表",
+		"shell.interrupted":           "已中止",
+		"shell.reconnecting":          "连接已断开（%s），正在重连",
+		"shell.put_dir":               "%s 是目录；put 只上传单个文件，目录树请用 add -r 或 sync",
+		"shell.put_exists":            "%s 已存在；用 put -f 替换",
+		"shell.refreshed":             "%s: %d 个条目",
+		"shell.cmd.ls":                "列出目录，-l 显示权限、大小和修改时间",
+		"shell.cmd.cd":                "切换当前远程目录（cd - 回到上一个目录，不带参数回到 /，-f 不使用缓存的列表）",
+		"shell.cmd.pwd":               "显示当前远程目录",
+		"shell.cmd.get":               "下载文件",
+		"shell.cmd.put":               "上传文件，-f 替换已有的文件",
+		"shell.cmd.rm":                "删除文件，-r 也删除目录",
+		"shell.cmd.mkdir":             "创建目录及缺少的上级目录",
+		"shell.cmd.stat":              "查看路径的元数据",
+		"shell.cmd.refresh":           "重新列出目录，替换它及其下目录的缓存；不带参数时清空整个缓存",
+		"shell.cmd.help":              "显示这个列表",
+		"shell.cmd.exit":              "关闭连接并退出（也可以按 Ctrl-D）",
+		"profile.no_config":           "没有客户端配置文件 %s",
+		"profile.not_found":           "%[2]s 中没有名为 %[1]q 的 profile",
+		"profile.none":                "%s 中没有定义 profile",
+		"profile.col_name":            "名称",
+		"profile.col_url":             "地址",
+		"profile.col_token":           "TOKEN",
+		"profile.col_flags":           "标志",
+		"profile.default":             "(默认)",
+		"profile.protected":           "(受保护)",
+		"profile.file":                "配置文件: %s",
+		"pull.not_dir":                "%s 已存在且不是目录",
+		"pull.not_remote_dir":         "%s 不是远程目录",
+		"pull.would_download":         "下载 %s (%s，%s)",
+		"pull.dry_run_summary":        "演练: 需下载 %d 个文件 (%s)，%d 个未变化，需删除 %d 项",
+		"pull.summary":                "下载 %d 个文件 (%s)，%d 个未变化，删除 %d 项，失败 %d 项",
+		"status.stdio_single":         "\"-\"（标准输入/输出）只用于单个文件的传输，不能与 -r、-resume 或 -estimate 同用",
+		"status.stdin_unsupported":    "该服务器不支持大小未知的上传；请升级服务器，或上传一个文件",
+		"tail.not_file":               "%s 不是远程文件",
+		"tail.unsupported":            "该服务器不支持读取文件末尾；请升级服务器，或使用 get",
+		"tail.missing":                "%s 已被删除，等待它重新出现",
+		"tail.truncated":              "%s 被截断或替换，从头继续跟踪",
+		"browse.no_terminal":          "browse 需要在交互式终端中运行",
+		"browse.help":                 "↑↓ 移动  ⏎ 打开  ← 上级  / 过滤  d 下载  y 复制路径  s stat  r 刷新  Tab 详情  q 退出",
+		"browse.truncated":            "列表不完整，显示 %d 个条目",
+		"browse.no_preview":           "无法预览: %v",
+		"browse.empty_file":           "（空文件）",
+		"browse.binary":               "（二进制文件，不预览）",
+		"browse.copied":               "已复制 %s（退出时还会输出）",
+		"browse.dir_download":         "这里不能下载目录，请用 get -r",
+		"browse.downloading":          "正在下载 %s ...",
+		"browse.downloaded":           "已下载 %s（%s）",
+		"browse.overwrite":            "本地已有 %s，覆盖？[y/N]",
+		"browse.too_small":            "终端太小",
+		"browse.no_entries":           "（没有条目）",
+		"browse.count":                "%d/%d 个条目",
+		"browse.file":                 "文件",
+		"browse.directory":            "目录",
+		"browse.size":                 "大小: %s",
+		"browse.modified":             "修改时间: %s",
+		"guard.fs_root":               "文件系统根目录",
+		"guard.home":                  "你的家目录",
+		"guard.cwd":                   "当前目录",
+		"guard.sandbox_root":          "整个沙箱",
+		"guard.refused":               "拒绝对 %s 执行递归操作：它是%s；确有此意请加 %s",
+		"guard.upload_summary":        "即将上传 %s：%d 个文件，%s，目标 %s",
+		"guard.need_yes":              "上传总量超过 -confirm-over %s，且标准输入不是终端；请加 -yes 确认",
+		"guard.prompt":                "是否继续？[y/N] ",
+		"guard.aborted":               "已取消",
+		"guard.protected_summary":     "即将在受保护的 profile %[2]s（%[3]s）上执行 %[1]s",
+		"guard.protected_need_yes":    "profile %s 受保护，且标准输入不是终端；请加 -yes 确认",
+		"guard.protected_prompt":      "输入 %s 以继续：",
+		"server.sandbox":              "沙箱目录: %s",
+		"server.token":                "固定Token: %s",
+		"server.token_file":           "Token: 读取自 %s（收到 SIGHUP 时重新读取）",
+		"server.read_only":            "只读模式: 拒绝上传、删除和加锁",
+
+		"help.usage":                  "用法：",
+		"help.flags":                  "标志：",
+		"help.commands":               "命令：",
+		"help.examples":               "示例：",
+		"help.global_flags":           "全局标志：",
+		"help.lang_flag":              "  -lang string    输出语言 (en, zh)，可以出现在命令行的任意位置；\n                  未指定时依次参考 WSBOX_LANG、LC_ALL、LC_MESSAGES、LANG，最后使用英文",
+		"help.default":                "(默认 %s)",
+		"help.more":                   "运行 \"%s help <命令>\" 查看命令的标志和示例。",
+		"help.unknown":                "未知命令 '%s'",
+		"help.did_you_mean":           "未知命令 '%s'，是否要使用 '%s'？",
+		"help.see":                    "运行 \"%s help\" 查看命令列表。",
+		"summary.wsbox":               "wsbox 通过 WebSocket 共享一个沙箱目录：文件服务器，以及用来列表、上传和下载文件的客户端。",
+		"summary.server":              "启动文件服务器",
+		"summary.server.audit":        "检查配置的安全隐患，存在高危项时以非零状态退出",
+		"summary.server.state":        "在服务停止时检查或压缩状态存储",
+		"summary.server.verify_audit": "检查 -audit-log 文件的编号和哈希链，被改动过时以非零状态退出",
+		"summary.client":              "连接到服务器进行文件操作",
+		"summary.schema":              "打印 JSON 输出结构的 JSON Schema，不带名字时列出所有结构",
+		"summary.help":                "显示命令的帮助",
+		"summary.client.list":         "以树状结构列出目录，-latest 列出最新的文件",
+		"summary.client.append":       "把本地文件或标准输入追加到远程文件末尾",
+		"summary.client.add":          "上传文件，-r 上传整个目录树，-extract 由服务端解开上传的归档",
+		"summary.client.get":          "下载文件，-r 下载整个目录树，-archive 打包下载目录",
+		"summary.client.delete":       "删除远程文件，-r 同时删除目录及其内容",
+		"summary.client.mkdir":        "创建远程目录，缺少的上级目录一并创建",
+		"summary.client.mv":           "移动或重命名远程文件或目录",
+		"summary.client.sync":         "把本地目录的变化上传到远程目录",
+		"summary.client.watch":        "持续运行，把本地目录的改动随时上传到远程目录",
+		"summary.client.shell":        "只连接一次，在交互式提示符下执行 ls、cd、get、put 等命令",
+		"summary.client.profiles":     "列出客户端配置文件中的 profile，token 只显示开头",
+		"summary.client.cat":          "把远程文件输出到标准输出",
+		"summary.client.tail":         "输出远程文件的最后几行，-f 持续跟踪",
+		"summary.client.pull":         "把远程目录的变化下载到本地目录",
+		"summary.client.stat":         "查看远程路径的元数据，不下载文件",
+		"summary.client.doctor":       "诊断与服务器的连通性并给出修复建议",
+		"summary.client.lock":         "获取、释放或列出独占的锁标记，只有一个客户端能拿到锁",
+		"summary.client.du":           "递归统计目录下每个条目的大小及合计，相当于 du -s *",
+		"summary.client.find":         "在服务端查找名字匹配 glob（或路径匹配 -regex）的条目",
+		"summary.client.counts":       "显示条目最多的目录",
+		"summary.client.activity":     "显示最近完成的上传、下载和删除",
+		"summary.client.cron":         "在前台按计划反复执行客户端命令",
+		"summary.client.test":         "供脚本判断路径状态，结果通过退出码返回",
+		"summary.client.browse":       "只读的终端浏览界面",
+		"details.client.transfer": `递归传输拒绝以 /、家目录、当前目录以及（get）沙箱根目录为根，除非指定 --i-know-what-im-doing。
+每个文件都与服务端核对 SHA-256：上传不一致时被拒绝，下载不一致时删除本地文件并以非零退出码结束；-no-verify 跳过校验。
+修改时间和权限在两个方向上都会保留（Windows 上只保留修改时间）；-no-preserve 时文件以传输时间为修改时间、使用默认权限。
+add -if-changed 跳过远程副本大小和 SHA-256 都相同的文件。
+单个文件的传输在 stdout 是终端时显示进度条（字节数、百分比、速度、剩余时间）。
+-retries n 在连接失败、连接中断和服务端返回 5xx 时从 -retry-delay 开始按指数退避重试；4xx 从不重试，重试的下载从 .part 文件续传。
+-r 跳过匹配源目录根下 .wsboxignore（gitignore 的写法）、-exclude 或 -include 排除的路径，被排除的目录不再遍历，-v 列出被排除的路径。`,
+		"details.client.append": `远程文件不存在时创建。服务端收到完整的正文后才一次写入，同时向同一文件追加的内容不会交错，
+追加失败时文件保持不变。输出远程文件追加后的大小（全局 -json 时同样给出）。
+追加不会自动重试：重复一次成功的追加会使内容重复。`,
+		"details.client.cron": `计划为五段 cron 表达式（"*/15 * * * *"）或 @hourly、@daily、@weekly、@monthly。
+上一次还在执行时跳过本次，失败时在下一次之前重试。
+收到 SIGINT/SIGTERM 时等当前这次执行完，再次收到时强制结束。`,
+		"details.client.test": `不输出内容：退出码 0 为真、1 为假、2 为出错。
+操作数默认为远程路径，"local:" 前缀表示本地路径；-nt 和 -ot 比较修改时间，远程时间先按服务端的时钟偏差换算
+（见客户端标志 -mtime-slack）。`,
+		"details.client.sync": `新文件、大小不同的文件，以及修改时间与远程副本不同的文件会被上传，服务端支持时远程副本保留本地的修改时间
+（见 -mtime-slack）；-no-preserve 或旧版服务端时只上传在远程副本上传之后本地又修改过的文件（远程时间按服务端的时钟偏差换算）。
+-checksum 改为比较 SHA-256；-if-changed 只在修改时间不同时比较 SHA-256，内容相同的文件不上传。缺少的远程目录会被创建。-delete 同时删除本地没有的远程条目。
+有变化的文件即使服务端不允许覆盖也会被替换。默认所有操作共用一个连接，-P n 同时进行最多 n 个上传（服务端允许时在这个连接上流水线进行，否则使用额外的连接）；-dry-run 显示每个文件的上传原因
+（new、size、mtime、checksum、type），以及被 .wsboxignore、-exclude 或 -include 排除的路径；被排除的远程路径既不比较也不删除。`,
+		"details.client.watch": `每隔 -interval 扫描一次本地目录，改动的文件在 -debounce 内不再变化后才上传，编辑器分几次写入的一次保存只上传一次。
+启动时的目录内容作为基线，不上传（需要先对齐两边时先执行 sync）。-delete 在本地文件或目录被删除时删除远程副本。
+本地目录中 .wsboxignore（gitignore 的写法，修改后重新读取）、-exclude 或 -include 排除的路径被跳过。
+所有操作共用一个连接，断开后按退避时间重连。Ctrl-C 上传完剩余的改动后退出，第二次 Ctrl-C 立即退出。`,
+		"details.client.shell": `只连接一次，在提示符下依次执行命令，相对路径按当前远程目录解析。在终端上可以编辑输入的行（方向键、Ctrl-A/E/U/K/W），
+上下键翻阅历史（保存在客户端状态目录中），Tab 补全命令和远程名字（put 补全本地名字）。
+连接断开时用同一个地址和token重连，并把这个命令再执行一次；命令执行期间按 Ctrl-C 中止它。在终端上不带命令运行 client 也进入 shell。
+从管道输入时每行一个命令，不显示提示符，有命令失败时退出码为 1。`,
+		"details.client": `token 依次取以下第一个给出的：-token、-token-file（文件的第一行）、$WSBOX_TOKEN、
+选中的 profile 的 token（给出 -s 时不使用）、地址中的用户名部分（ws://token@host）。
+token 放在 Authorization 请求头中发送，不出现在URL里；-token 和 ws://token@host 会出现在 ps 输出和 shell 历史中，
+建议使用 -token-file 或 $WSBOX_TOKEN。
+
+退出码：0 成功，1 其他错误（服务端错误，包括只读模式；本地文件错误；目录树中有文件失败），2 用法错误，3 远程路径不存在（404），
+4 认证失败（401/403、token被吊销），5 无法连接、连接中断或超时。test 和 find 沿用 POSIX test 与 grep 的约定。
+
+-connect-timeout（默认 30s）限制建立连接，-op-timeout 限制请求等待服务端开始响应的时间，
+-transfer-stall-timeout 限制传输中没有任何数据流动的时间。
+-proxy（http://、https:// 或 socks5://，user:password@ 用于认证）优先于 $HTTPS_PROXY、$HTTP_PROXY 和 $NO_PROXY。`,
+		"details.client.profiles": `当前使用的 profile 以 * 标出。profile 由 -profile、$WSBOX_PROFILE 或文件中的 default 选择；
+命令行上显式给出的标志优先于它，-token、-token-file 和 $WSBOX_TOKEN 优先于它的 token。`,
+		"details.client.tail": `服务端从文件末尾向前读取，只返回要求的行，查看大日志的末尾代价很小。
+-f 时每隔 -s 通过同一个连接查询文件大小并输出新增的内容；文件变短（被截断或轮转）时从头跟踪。`,
+		"details.client.pull": `sync 的反方向：本地缺少的文件、大小或修改时间不同的文件会被下载，并保留远程的修改时间；
+修改时间精度较粗的文件系统可用 -mtime-slack 放宽比较。缺少的本地目录会被创建；-delete 同时删除服务端没有的本地条目。
+远程目录中 .wsboxignore、-exclude 和 -include 的规则与 sync 一样作用于两边。有任何文件失败时退出码非零。`,
+		"details.client.stat": `退出码：路径存在时为 0，不存在时为 3，其他情况与所有客户端命令相同（见 "wsbox help client"）。
+-json 在路径不存在时同样输出结果（结构见 "wsbox schema stat"）。`,
+		"details.client.browse": `浏览目录、预览文件开头的内容、用 / 过滤、下载选中的文件（d）、复制远程路径（y）、
+查看详情（s）和刷新（r）。仅支持 Linux 终端。`,
+	})
+}
@@ -0,0 +1,486 @@
+// Package journal 是服务端状态（文件摘要缓存、目录条目计数等）的嵌入式存储。
+//
+// 数据按命名空间分组，每个命名空间是一组键到 JSON 值的映射，全部常驻内存。
+// 每次 Update 先把整批修改作为一条带校验和的记录追加到预写日志并 fsync，再应用到内存，
+// 因此一次 Update 内的多个键要么全部生效要么全部不生效。
+// 日志增长到一定大小后写出快照（临时文件 + fsync + rename）并清空日志。
+// 打开时加载快照并重放日志，进程在写入中途崩溃留下的残缺记录会被截掉。
+package journal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	snapshotName = "snapshot.json"
+	journalName  = "journal.wal"
+	lockName     = "LOCK"
+
+	// CompactThreshold 是触发自动压缩的日志大小
+	CompactThreshold = 4 << 20
+
+	// maxRecord 限制单条记录的大小，长度字段超过它视为损坏
+	maxRecord = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrLocked 表示状态目录正被另一个 wsbox 进程使用
+var ErrLocked = errors.New("state directory is in use by another wsbox process")
+
+// op 是一次修改，Value 为 nil 表示删除
+type op struct {
+	NS    string          `json:"ns"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// record 是日志中的一条记录，对应一次 Update
+type record struct {
+	Seq uint64 `json:"seq"`
+	Ops []op   `json:"ops"`
+}
+
+// snapshot 是快照文件的内容，Seq 之前（含）的记录都已包含在内
+type snapshot struct {
+	Seq  uint64                                `json:"seq"`
+	Data map[string]map[string]json.RawMessage `json:"data"`
+}
+
+// Recovery 描述打开存储时的恢复情况
+type Recovery struct {
+	Replayed       int   // 从日志重放的记录数
+	TruncatedBytes int64 // 截掉的残缺日志尾部字节数，非零说明上次未正常退出
+}
+
+// Store 是一个打开的状态存储。dir 为空时只保存在内存中
+type Store struct {
+	mu     sync.RWMutex
+	dir    string
+	data   map[string]map[string]json.RawMessage
+	seq    uint64
+	log    *os.File
+	logLen int64
+	unlock func()
+}
+
+// Open 打开（必要时创建）状态目录并恢复数据。dir 为空时返回纯内存存储
+func Open(dir string) (*Store, Recovery, error) {
+	s := &Store{dir: dir, data: map[string]map[string]json.RawMessage{}}
+	if dir == "" {
+		return s, Recovery{}, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, Recovery{}, err
+	}
+	unlock, err := lockDir(filepath.Join(dir, lockName))
+	if err != nil {
+		return nil, Recovery{}, err
+	}
+	s.unlock = unlock
+	rec, err := s.recover()
+	if err != nil {
+		unlock()
+		return nil, Recovery{}, err
+	}
+	return s, rec, nil
+}
+
+func (s *Store) recover() (Recovery, error) {
+	var rec Recovery
+	snap, err := readSnapshot(filepath.Join(s.dir, snapshotName))
+	if err != nil {
+		return rec, err
+	}
+	s.data, s.seq = snap.Data, snap.Seq
+
+	f, err := os.OpenFile(filepath.Join(s.dir, journalName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return rec, err
+	}
+	records, good, err := scan(f)
+	if err != nil {
+		f.Close()
+		return rec, err
+	}
+	for _, r := range records {
+		if r.Seq <= s.seq {
+			continue // 已包含在快照中
+		}
+		s.apply(r)
+		rec.Replayed++
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return rec, err
+	}
+	if size > good {
+		rec.TruncatedBytes = size - good
+		if err := f.Truncate(good); err != nil {
+			f.Close()
+			return rec, err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return rec, err
+		}
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return rec, err
+	}
+	s.log, s.logLen = f, good
+	return rec, nil
+}
+
+func readSnapshot(path string) (snapshot, error) {
+	snap := snapshot{Data: map[string]map[string]json.RawMessage{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return snap, fmt.Errorf("%s: %w", path, err)
+	}
+	if snap.Data == nil {
+		snap.Data = map[string]map[string]json.RawMessage{}
+	}
+	return snap, nil
+}
+
+// scan 顺序读取日志记录，遇到残缺或校验失败的记录即停止，返回最后一条完好记录之后的偏移
+func scan(r io.Reader) ([]record, int64, error) {
+	br := bufio.NewReader(r)
+	var records []record
+	var good int64
+	head := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(br, head); err != nil {
+			return records, good, nil
+		}
+		n := binary.BigEndian.Uint32(head[:4])
+		sum := binary.BigEndian.Uint32(head[4:])
+		if n > maxRecord {
+			return records, good, nil
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return records, good, nil
+		}
+		if crc32.Checksum(payload, crcTable) != sum {
+			return records, good, nil
+		}
+		var rec record
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return records, good, nil
+		}
+		if len(records) > 0 && rec.Seq <= records[len(records)-1].Seq {
+			return records, good, fmt.Errorf("journal sequence goes backwards at offset %d", good)
+		}
+		records = append(records, rec)
+		good += int64(8 + n)
+	}
+}
+
+func (s *Store) apply(r record) {
+	for _, o := range r.Ops {
+		if o.Value == nil {
+			delete(s.data[o.NS], o.Key)
+			continue
+		}
+		ns := s.data[o.NS]
+		if ns == nil {
+			ns = map[string]json.RawMessage{}
+			s.data[o.NS] = ns
+		}
+		ns[o.Key] = o.Value
+	}
+	s.seq = r.Seq
+}
+
+// Get 把命名空间 ns 中 key 的值解析到 v，不存在时返回 false
+func (s *Store) Get(ns, key string, v any) (bool, error) {
+	s.mu.RLock()
+	raw, ok := s.data[ns][key]
+	s.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Keys 返回命名空间 ns 中的所有键，按字母排序
+func (s *Store) Keys(ns string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.data[ns]))
+	for k := range s.data[ns] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Len 返回命名空间 ns 中的键数量
+func (s *Store) Len(ns string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data[ns])
+}
+
+// Tx 收集一次 Update 中的修改，读取时能看到本事务尚未提交的写入
+type Tx struct {
+	s   *Store
+	ops []op
+}
+
+// Put 写入一个值，v 按 JSON 编码
+func (tx *Tx) Put(ns, key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tx.ops = append(tx.ops, op{NS: ns, Key: key, Value: b})
+	return nil
+}
+
+// Delete 删除一个键
+func (tx *Tx) Delete(ns, key string) {
+	tx.ops = append(tx.ops, op{NS: ns, Key: key})
+}
+
+// Get 读取一个值，优先返回本事务中的写入
+func (tx *Tx) Get(ns, key string, v any) (bool, error) {
+	for i := len(tx.ops) - 1; i >= 0; i-- {
+		if o := tx.ops[i]; o.NS == ns && o.Key == key {
+			if o.Value == nil {
+				return false, nil
+			}
+			return true, json.Unmarshal(o.Value, v)
+		}
+	}
+	raw, ok := tx.s.data[ns][key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Update 在排他锁下执行 fn，fn 返回 nil 时把所有修改作为一条日志记录原子提交
+func (s *Store) Update(fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := &Tx{s: s}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	rec := record{Seq: s.seq + 1, Ops: tx.ops}
+	if s.log != nil {
+		if err := s.appendRecord(rec); err != nil {
+			return err
+		}
+	}
+	s.apply(rec)
+	if s.log != nil && s.logLen > CompactThreshold {
+		return s.compactLocked()
+	}
+	return nil
+}
+
+func (s *Store) appendRecord(rec record) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[8:], payload)
+	_, err = s.log.Write(buf)
+	if err == nil {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		// 回退到写入前的位置，避免未生效的记录在下次打开时被重放
+		s.log.Truncate(s.logLen)
+		s.log.Seek(s.logLen, io.SeekStart)
+		return err
+	}
+	s.logLen += int64(len(buf))
+	return nil
+}
+
+// Compact 写出快照并清空日志
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return nil
+	}
+	return s.compactLocked()
+}
+
+func (s *Store) compactLocked() error {
+	b, err := json.Marshal(snapshot{Seq: s.seq, Data: s.data})
+	if err != nil {
+		return err
+	}
+	if err := writeAtomic(filepath.Join(s.dir, snapshotName), b); err != nil {
+		return err
+	}
+	// 快照落盘后日志中的记录都已被快照包含，崩溃在这之后重放时会被跳过
+	if err := s.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.logLen = 0
+	return s.log.Sync()
+}
+
+// Close 关闭日志并释放目录锁
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if s.log != nil {
+		err = s.log.Close()
+		s.log = nil
+	}
+	if s.unlock != nil {
+		s.unlock()
+		s.unlock = nil
+	}
+	return err
+}
+
+// Stats 描述存储的当前状态
+type Stats struct {
+	Seq        uint64         `json:"seq"`
+	JournalLen int64          `json:"journal_bytes"`
+	Namespaces map[string]int `json:"namespaces"`
+}
+
+// Stats 返回序号、日志大小和每个命名空间的键数量
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := Stats{Seq: s.seq, JournalLen: s.logLen, Namespaces: map[string]int{}}
+	for ns, m := range s.data {
+		if len(m) > 0 {
+			st.Namespaces[ns] = len(m)
+		}
+	}
+	return st
+}
+
+// writeAtomic 写入同目录下的临时文件并 fsync，然后重命名覆盖目标文件并同步目录
+func writeAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if d, err := os.Open(filepath.Dir(path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Report 是 Verify 的检查结果
+type Report struct {
+	SnapshotSeq    uint64         `json:"snapshot_seq"`
+	Records        int            `json:"journal_records"`
+	Pending        int            `json:"pending_records"` // 快照之后、需要重放的记录数
+	TruncatedBytes int64          `json:"corrupt_tail_bytes"`
+	Gaps           []string       `json:"gaps,omitempty"`
+	Namespaces     map[string]int `json:"namespaces"`
+	OK             bool           `json:"ok"`
+}
+
+// Verify 只读地检查状态目录：快照能否解析、日志记录的校验和与序号是否连续、
+// 末尾是否有残缺记录。目录被其他进程占用时返回 ErrLocked
+func Verify(dir string) (Report, error) {
+	var rep Report
+	unlock, err := lockDir(filepath.Join(dir, lockName))
+	if err != nil {
+		return rep, err
+	}
+	defer unlock()
+
+	snap, err := readSnapshot(filepath.Join(dir, snapshotName))
+	if err != nil {
+		return rep, err
+	}
+	rep.SnapshotSeq = snap.Seq
+	s := &Store{data: snap.Data, seq: snap.Seq}
+
+	f, err := os.Open(filepath.Join(dir, journalName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return rep, err
+	}
+	if f != nil {
+		defer f.Close()
+		records, good, err := scan(f)
+		if err != nil {
+			rep.Gaps = append(rep.Gaps, err.Error())
+		}
+		rep.Records = len(records)
+		next := snap.Seq + 1
+		for _, r := range records {
+			if r.Seq <= snap.Seq {
+				continue
+			}
+			if r.Seq != next {
+				rep.Gaps = append(rep.Gaps, fmt.Sprintf("expected seq %d, found %d", next, r.Seq))
+			}
+			s.apply(r)
+			rep.Pending++
+			next = r.Seq + 1
+		}
+		if fi, err := f.Stat(); err == nil && fi.Size() > good {
+			rep.TruncatedBytes = fi.Size() - good
+		}
+	}
+	rep.Namespaces = s.Stats().Namespaces
+	rep.OK = len(rep.Gaps) == 0
+	return rep, nil
+}
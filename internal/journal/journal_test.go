@@ -0,0 +1,245 @@
+package journal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func open(t *testing.T, dir string) (*Store, Recovery) {
+	t.Helper()
+	s, rec, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, rec
+}
+
+// put 在一次 Update 中写入 kv（"a", 1, "b", 2 ...）
+func put(t *testing.T, s *Store, ns string, kv ...any) {
+	t.Helper()
+	err := s.Update(func(tx *Tx) error {
+		for i := 0; i < len(kv); i += 2 {
+			if err := tx.Put(ns, kv[i].(string), kv[i+1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// state 返回命名空间中所有键的整数值
+func state(t *testing.T, s *Store, ns string) map[string]int {
+	t.Helper()
+	m := map[string]int{}
+	for _, k := range s.Keys(ns) {
+		var v int
+		if _, err := s.Get(ns, k, &v); err != nil {
+			t.Fatal(err)
+		}
+		m[k] = v
+	}
+	return m
+}
+
+func sameState(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// 没有快照时重新打开靠重放日志恢复全部修改，包括删除；压缩之后从快照恢复，不再重放
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := open(t, dir)
+	put(t, s, "counts", "/a", 1, "/b", 2)
+	put(t, s, "counts", "/a", 3)
+	put(t, s, "hashes", "/f", 7)
+	s.Update(func(tx *Tx) error { tx.Delete("counts", "/b"); return nil })
+	want := state(t, s, "counts")
+	s.Close()
+
+	s, rec := open(t, dir)
+	if rec.Replayed != 4 || rec.TruncatedBytes != 0 {
+		t.Errorf("recovery = %+v, want 4 records replayed and nothing truncated", rec)
+	}
+	if got := state(t, s, "counts"); !sameState(got, want) || len(got) != 1 || got["/a"] != 3 {
+		t.Errorf("after replay counts = %v, want %v", got, want)
+	}
+	if got := state(t, s, "hashes"); got["/f"] != 7 {
+		t.Errorf("after replay hashes = %v", got)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	put(t, s, "counts", "/c", 5)
+	s.Close()
+
+	s, rec = open(t, dir)
+	defer s.Close()
+	if rec.Replayed != 1 {
+		t.Errorf("after compact replayed %d records, want only the one written since", rec.Replayed)
+	}
+	if got := state(t, s, "counts"); got["/a"] != 3 || got["/c"] != 5 || len(got) != 2 {
+		t.Errorf("after compact counts = %v", got)
+	}
+	if st := s.Stats(); st.Seq != 5 {
+		t.Errorf("seq = %d, want 5", st.Seq)
+	}
+}
+
+// 崩溃注入：日志在任意一个字节处截断（写到一半的尾部记录）时，重新打开得到的恰好是完整写入的那些 Update，
+// 一次 Update 中的多个键同时出现或同时不出现；残缺的尾部被截掉，之后的写入和再次打开都正常
+func TestTruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := open(t, dir)
+	// 每次 Update 把两个键都改成 i，截断后两个键必须相同
+	var sizes []int64
+	for i := 1; i <= 5; i++ {
+		put(t, s, "pair", "x", i, "y", i)
+		sizes = append(sizes, s.Stats().JournalLen)
+	}
+	s.Close()
+	wal, err := os.ReadFile(filepath.Join(dir, journalName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cut := int64(0); cut <= int64(len(wal)); cut++ {
+		crash := t.TempDir()
+		os.WriteFile(filepath.Join(crash, journalName), wal[:cut], 0o600)
+		s, rec := open(t, crash)
+		committed := 0
+		for committed < len(sizes) && sizes[committed] <= cut {
+			committed++
+		}
+		got := state(t, s, "pair")
+		if committed == 0 && len(got) != 0 || committed > 0 && (got["x"] != committed || got["y"] != committed) {
+			t.Fatalf("cut at %d: state %v, want both keys = %d", cut, got, committed)
+		}
+		good := int64(0)
+		if committed > 0 {
+			good = sizes[committed-1]
+		}
+		if rec.Replayed != committed || rec.TruncatedBytes != cut-good {
+			t.Fatalf("cut at %d: recovery %+v, want %d replayed and %d bytes truncated", cut, rec, committed, cut-good)
+		}
+		// 截掉残缺的尾部之后继续写，再打开时新写入的记录在
+		put(t, s, "pair", "x", 100, "y", 100)
+		s.Close()
+		s, rec = open(t, crash)
+		if got := state(t, s, "pair"); got["x"] != 100 || got["y"] != 100 || rec.TruncatedBytes != 0 {
+			t.Fatalf("cut at %d: after writing on: %v, %+v", cut, got, rec)
+		}
+		s.Close()
+	}
+}
+
+// 写坏的记录（长度完整但内容损坏，如掉电时写乱的扇区）校验失败，它和之后的记录都不重放
+func TestTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := open(t, dir)
+	put(t, s, "ns", "a", 1)
+	first := s.Stats().JournalLen
+	put(t, s, "ns", "a", 2, "b", 2)
+	put(t, s, "ns", "c", 3)
+	s.Close()
+
+	path := filepath.Join(dir, journalName)
+	wal, _ := os.ReadFile(path)
+	wal[first+12] ^= 0xff // 第二条记录正文中的一个字节
+	os.WriteFile(path, wal, 0o600)
+
+	rep, err := Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Records != 1 || rep.TruncatedBytes != int64(len(wal))-first {
+		t.Errorf("Verify = %+v, want 1 good record and the rest reported as a corrupt tail", rep)
+	}
+	s, rec := open(t, dir)
+	defer s.Close()
+	if got := state(t, s, "ns"); len(got) != 1 || got["a"] != 1 {
+		t.Errorf("after a torn write: %v, want only the first record", got)
+	}
+	if rec.Replayed != 1 || rec.TruncatedBytes == 0 {
+		t.Errorf("recovery = %+v", rec)
+	}
+}
+
+// 压缩时快照已经落盘、日志还没清空就崩溃：快照包含的记录不会再次重放
+func TestCrashDuringCompact(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := open(t, dir)
+	put(t, s, "ns", "a", 1)
+	put(t, s, "ns", "a", 2)
+	s.Close()
+	wal, _ := os.ReadFile(filepath.Join(dir, journalName))
+
+	s, _ = open(t, dir)
+	s.Compact()
+	s.Close()
+	// 恢复压缩前的日志，相当于清空日志之前崩溃
+	os.WriteFile(filepath.Join(dir, journalName), wal, 0o600)
+
+	s, rec := open(t, dir)
+	defer s.Close()
+	if rec.Replayed != 0 {
+		t.Errorf("replayed %d records already in the snapshot", rec.Replayed)
+	}
+	if got := state(t, s, "ns"); got["a"] != 2 {
+		t.Errorf("state = %v", got)
+	}
+	put(t, s, "ns", "a", 3)
+	if st := s.Stats(); st.Seq != 3 {
+		t.Errorf("seq after the crash = %d, want 3", st.Seq)
+	}
+}
+
+// 同一个状态目录不能同时被两个存储打开
+func TestOpenLocked(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := open(t, dir)
+	if _, _, err := Open(dir); !errors.Is(err, ErrLocked) {
+		t.Errorf("second Open: %v, want ErrLocked", err)
+	}
+	if _, err := Verify(dir); !errors.Is(err, ErrLocked) {
+		t.Errorf("Verify of an open store: %v, want ErrLocked", err)
+	}
+	s.Close()
+	s, _ = open(t, dir)
+	s.Close()
+}
+
+// 内存存储同样支持事务，只是不落盘
+func TestInMemory(t *testing.T) {
+	s, _ := open(t, "")
+	put(t, s, "ns", "a", 1)
+	err := s.Update(func(tx *Tx) error {
+		tx.Put("ns", "a", 2)
+		var v int
+		if ok, _ := tx.Get("ns", "a", &v); !ok || v != 2 {
+			t.Errorf("a transaction does not see its own write: %d", v)
+		}
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Fatal("aborted Update returned nil")
+	}
+	if got := state(t, s, "ns"); got["a"] != 1 || s.Len("ns") != 1 {
+		t.Errorf("an aborted Update changed the state: %v", got)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
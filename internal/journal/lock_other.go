@@ -0,0 +1,24 @@
+//go:build !unix
+
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// lockDir 在没有 flock 的平台上以 O_EXCL 创建锁文件。锁在服务运行期间一直持有，
+// 无法按时间判断是否残留，进程崩溃后需要手动删除
+func lockDir(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("%w (remove %s if no wsbox process is running)", ErrLocked, path)
+		}
+		return nil, err
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
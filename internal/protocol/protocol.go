@@ -0,0 +1,746 @@
+// Package protocol 定义网关与客户端之间的线上格式：升级时协商的请求头、分帧常量，
+// 以及所有 JSON 响应体。服务端和客户端包都只通过这里约定格式，互不依赖
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+/* ---------- 结构版本 ---------- */
+
+// SchemaVersion 是所有 JSON 输出结构的版本号。
+// 任何结构体字段的增删改都必须递增它，旧客户端据此拒绝看不懂的响应
+const SchemaVersion = 2
+
+// CheckSchema 拒绝比本客户端更新的响应结构
+func CheckSchema(v int) error {
+	if v > SchemaVersion {
+		return fmt.Errorf("server response uses schema version %d but this client only understands up to %d; upgrade wsbox", v, SchemaVersion)
+	}
+	return nil
+}
+
+/* ---------- 升级时协商的参数 ---------- */
+
+// 流控：客户端通过 FlowHeader 请求窗口（单位：块），服务端在升级响应中回写协商结果。
+// 协商成功后该连接上的每个响应正文都按 FlowChunkSize 分成多个二进制帧发送，
+// 发送方在未确认的块达到窗口大小时暂停，直到收到客户端的 "ACK n"（n 为累计收到的块数）。
+// 未协商的连接保持原来的"状态头 + 单个正文帧"格式
+const (
+	FlowHeader    = "X-Wsbox-Window"
+	FlowChunkSize = 64 * 1024
+)
+
+// 分块上传：客户端携带 StreamHeader: 1，服务端回写同一个头表示同意。
+// 协商成功后 POST 的请求正文按 StreamChunkSize 分成多个二进制帧，最后以文本帧 StreamEnd 结束；
+// 客户端中途读文件失败时发送 StreamAbort，服务端放弃本次上传
+const (
+	StreamHeader    = "X-Wsbox-Stream"
+	StreamChunkSize = 1 << 20
+	StreamEnd       = "END"
+	StreamAbort     = "ABORT"
+)
+
+// 单帧上限：服务端在升级响应中以 MaxMessageHeader 告知它读取的单帧上限（字节），没有该头表示不限。
+// 上限不小于 MinMessageSize，分块上传的每一帧（StreamChunkSize 加上开销）和流控的响应块总能放下；
+// 超过上限的一方以 CloseMessageTooBig（RFC 6455 的 1009）关闭连接
+const (
+	MaxMessageHeader   = "X-Wsbox-Max-Message"
+	MinMessageSize     = StreamChunkSize + 64<<10
+	CloseMessageTooBig = 1009
+)
+
+// token被吊销时，网关以 CloseTokenRevoked 关闭用旧token建立的连接，关闭原因为 TokenRevokedReason；
+// 关闭前收到的新请求得到 401 UNAUTHORIZED
+const (
+	CloseTokenRevoked  = 4001
+	TokenRevokedReason = "token revoked"
+)
+
+// 服务端关闭时，网关在连接空闲（或等待超时）后以 CloseGoingAway（RFC 6455 的 1001）关闭连接，
+// 关闭原因为 ShutdownReason，客户端可以据此重连到新实例
+const (
+	CloseGoingAway = 1001
+	ShutdownReason = "server shutting down"
+)
+
+// 只读服务端以 403 和 Code 为 ReadOnlyCode 的 APIError 拒绝 GET 以外的所有请求
+const ReadOnlyCode = "READ_ONLY"
+
+// 目录遍历等重操作超过服务端的并发和排队上限时，服务端以 429 和 Code 为 BusyCode 的 APIError 拒绝，
+// HTTP 响应同时带 Retry-After
+const BusyCode = "SERVER_BUSY"
+
+// 通过服务端路径别名的写操作在 -alias-writes 为 deny（默认）时以 403 和 Code 为 AliasReadOnlyCode 的 APIError 拒绝
+const AliasReadOnlyCode = "ALIAS_READ_ONLY"
+
+// -tokens-file 中权限为 ro 的token发出的写请求由网关以 403 和 Code 为 TokenReadOnlyCode 的 APIError 拒绝；
+// 限定了子目录的token使用汇总整个沙箱的接口（/_counts、/_activity）时得到 403 和 OutOfScopeCode
+const (
+	TokenReadOnlyCode = "TOKEN_READ_ONLY"
+	OutOfScopeCode    = "OUT_OF_SCOPE"
+)
+
+// 规范路径：客户端携带 CanonicalHeader: 1，服务端回写同一个头表示同意。协商成功后，经过服务端路径别名的请求
+// 在状态头末尾多一个字段 CanonicalField + 转义后的规范路径（url.PathEscape），客户端据此更新保存的路径
+const (
+	CanonicalHeader = "X-Wsbox-Canonical"
+	CanonicalField  = "canonical="
+)
+
+// MKDIR 的路径或其上级已经是文件时，服务端以 409 和 Code 为 NotDirectoryCode 的 APIError 拒绝
+const NotDirectoryCode = "NOT_A_DIRECTORY"
+
+// 新建的目录或文件违反服务端的名字规则（-max-depth、-max-name-len、-name-charset）时，
+// 服务端以 422 和 Code 为 NamePolicyCode 的 APIError 拒绝，Message 写明规则和出问题的那一级名字
+const NamePolicyCode = "NAME_POLICY"
+
+// 覆盖策略为 deny 的服务端以 409 和 Code 为 ExistsCode 的 APIError 拒绝覆盖已有文件的上传，
+// 除非请求带 OverwriteParam=1（客户端 add -f）
+const (
+	ExistsCode     = "FILE_EXISTS"
+	OverwriteParam = "overwrite"
+)
+
+// 进度帧：客户端携带 ProgressHeader: 1，服务端回写同一个头表示同意。
+// 协商成功后，请求在返回状态头之前每隔 ProgressInterval 收到一条文本帧
+// {"id":N,"progress":{"done":1234,"phase":"walking"}}，用于保持连接活跃并显示进度。
+// 客户端收到第一条进度帧后开始按 ProgressIdleTimeout 计算读超时
+const (
+	ProgressHeader      = "X-Wsbox-Progress"
+	ProgressInterval    = 5 * time.Second
+	ProgressIdleTimeout = 30 * time.Second
+)
+
+// 保活：客户端和网关在连接上定期发送 websocket Ping，使经过代理（如 nginx 默认60秒）的空闲连接不被断开。
+// 网关在 -idle-timeout 内收不到任何帧时关闭连接，PingInterval 应明显小于它
+const PingInterval = 30 * time.Second
+
+// StreamedSize 出现在状态头的长度字段，表示流式列表：头部帧、若干条目帧、摘要帧
+const StreamedSize = -1
+
+// 完整性校验：上传请求带 DigestParam=<十六进制 SHA-256>，服务端边写边计算，不一致时以 422 DIGEST_MISMATCH
+// 拒绝并丢弃写入的内容。下载请求带 WantDigestParam=sha256 时，服务端在状态头之后附加整个文件的 SHA-256，
+// 即 "status len <hex>"（区段请求也是整个文件的摘要）；没有请求的连接不会收到第三个字段
+const (
+	DigestParam     = "sha256"
+	WantDigestParam = "digest"
+)
+
+// 分块上传可以在结束时才给出摘要，客户端边读边算，不必为此先把文件读一遍：请求带 DigestParam=DigestTrailer，
+// 结束标记写成 "END <hex>"。服务端在 /_caps 中公布 sha256-trailer 特性，不支持的服务端会把这样的结束标记当作错误的帧
+const DigestTrailer = "trailer"
+
+// 保留属性：上传请求带 MtimeParam=<Unix 秒，可带小数部分> 和 ModeParam=<八进制权限，如 0755> 时，
+// 服务端在提交之前把它们设到文件上（权限只取 0777 的部分，属主总是可读）。版本2连接上的文件下载响应
+// 在 ResponseHeader 中给出文件的 mtime 和 mode，写法相同。服务端在 /_caps 中公布 attrs 特性
+const (
+	MtimeParam = "mtime"
+	ModeParam  = "mode"
+)
+
+// FormatMtime 把修改时间写成 Unix 秒，有不足一秒的部分时带九位小数
+func FormatMtime(t time.Time) string {
+	if ns := t.Nanosecond(); ns != 0 {
+		return fmt.Sprintf("%d.%09d", t.Unix(), ns)
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// ParseMtime 解析 FormatMtime 的结果，小数部分最多九位
+func ParseMtime(s string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(s, ".")
+	n, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil || len(frac) > 9 {
+		return time.Time{}, fmt.Errorf("bad modification time %q", s)
+	}
+	var ns int64
+	if frac != "" {
+		if ns, err = strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64); err != nil || ns < 0 {
+			return time.Time{}, fmt.Errorf("bad modification time %q", s)
+		}
+	}
+	return time.Unix(n, ns), nil
+}
+
+// FormatMode 把权限位写成四位八进制，如 "0755"
+func FormatMode(m fs.FileMode) string {
+	return fmt.Sprintf("%04o", m.Perm())
+}
+
+// ParseMode 解析八进制的权限位，只接受 0 到 0777
+func ParseMode(s string) (fs.FileMode, error) {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf("bad file mode %q, expected octal permissions such as 0644", s)
+	}
+	return fs.FileMode(n), nil
+}
+
+// ValidDigest 检查 s 是否为64位小写十六进制的 SHA-256
+func ValidDigest(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAck 识别流控确认帧 "ACK n"
+func ParseAck(payload []byte) (int, bool) {
+	rest, ok := strings.CutPrefix(string(payload), "ACK ")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(rest)
+	return n, err == nil
+}
+
+// 流水线：客户端携带 PipelineHeader: n 请求最多同时进行 n 个请求，服务端回写协商后的值（不超过其 -pipeline）。
+// 协商后连接上的所有数据帧（文本和二进制，两个方向）都以十进制请求ID和一个空格开头，如 "42 GET /path"、
+// "42 200 1234"。客户端为每个请求分配一个新的ID，该请求的正文块、上传块、确认和进度帧都带同一个ID，
+// 各请求的帧可以任意交错；控制帧（Ping、Pong、Close）不带ID
+const PipelineHeader = "X-Wsbox-Pipeline"
+
+// TagFrame 在帧内容前加上请求ID
+func TagFrame(id uint64, payload []byte) []byte {
+	b := strconv.AppendUint(make([]byte, 0, 21+len(payload)), id, 10)
+	b = append(b, ' ')
+	return append(b, payload...)
+}
+
+// SplitFrame 拆出帧开头的请求ID，格式不对时返回 false
+func SplitFrame(msg []byte) (uint64, []byte, bool) {
+	i := 0
+	for i < len(msg) && i < 20 && msg[i] >= '0' && msg[i] <= '9' {
+		i++
+	}
+	if i == 0 || i >= len(msg) || msg[i] != ' ' {
+		return 0, nil, false
+	}
+	id, err := strconv.ParseUint(string(msg[:i]), 10, 64)
+	return id, msg[i+1:], err == nil
+}
+
+/* ---------- 请求帧与状态头 ---------- */
+
+// 协议版本：客户端携带 VersionHeader: 它支持的最高版本，服务端回写双方都支持的最高版本。
+// 没有这个头（或服务端没有回写）时使用 LegacyVersion：请求是文本帧 "METHOD path?query [body]"，
+// 状态头是 "status len [sha256] [canonical=...]"，路径按空格切分，必须转义。
+// 版本2的请求帧是 JSON 的 Request，状态头是 JSON 的 ResponseHeader，其余帧（正文块、确认、结束标记、进度帧）不变；
+// 流水线连接上请求ID仍是帧开头的前缀（见 PipelineHeader）。服务端不再接受版本1时以 426 拒绝升级
+const (
+	VersionHeader = "X-Wsbox-Protocol"
+	Version       = 2
+	LegacyVersion = 1
+)
+
+// 浏览器中的 WebSocket 不能设置请求头，改用子协议：提供 Subprotocol 相当于 VersionHeader: Version，
+// 服务端选中它作为连接的子协议；token 以 base64url（无填充）编码后放在 TokenSubprotocolPrefix 之后，
+// 与 Authorization: Bearer 等价，两者都有时以 Authorization 为准
+const (
+	Subprotocol            = "wsbox"
+	TokenSubprotocolPrefix = "wsbox.token."
+)
+
+// Request 是版本2的请求帧。Path 是未转义的路径，Args 是查询参数，Body 是没有正文帧的请求的内联正文
+type Request struct {
+	Op   string     `json:"op"`
+	Path string     `json:"path"`
+	Args url.Values `json:"args,omitempty"`
+	Body string     `json:"body,omitempty"`
+}
+
+// Target 返回转义后的 "path?query"，与版本1请求行的第二个字段相同
+func (r *Request) Target() string {
+	u := url.URL{Path: r.Path, RawQuery: r.Args.Encode()}
+	return u.RequestURI()
+}
+
+// ParseRequestLine 把版本1的请求行转换成 Request，路径必须已经转义
+func ParseRequestLine(line string) (Request, error) {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return Request{}, fmt.Errorf("bad request line %q", line)
+	}
+	u, err := url.ParseRequestURI(parts[1])
+	if err != nil {
+		return Request{}, fmt.Errorf("bad request line %q: %w", line, err)
+	}
+	r := Request{Op: parts[0], Path: u.Path}
+	if u.RawQuery != "" {
+		r.Args = u.Query()
+	}
+	if len(parts) == 3 {
+		r.Body = parts[2]
+	}
+	return r, nil
+}
+
+// ResponseHeader 是版本2的状态头。Size 为 StreamedSize 表示流式列表；
+// SHA256 只在请求了摘要的下载响应中出现，Canonical 只在协商了规范路径且请求经过别名时出现；
+// MTime 和 Mode 只在文件下载的响应中出现（见 MtimeParam）
+type ResponseHeader struct {
+	Status    int    `json:"status"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256,omitempty"`
+	Canonical string `json:"canonical,omitempty"`
+	MTime     string `json:"mtime,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+}
+
+type ProgressInfo struct {
+	Done  int64  `json:"done"`
+	Phase string `json:"phase"`
+}
+
+type ProgressFrame struct {
+	ID       uint64       `json:"id"`
+	Progress ProgressInfo `json:"progress"`
+}
+
+// ParseProgress 识别文本帧中的进度帧。版本2的状态头也是 JSON，要求带 progress 字段
+func ParseProgress(payload []byte) (ProgressFrame, bool) {
+	var f struct {
+		ID       uint64        `json:"id"`
+		Progress *ProgressInfo `json:"progress"`
+	}
+	if len(payload) == 0 || payload[0] != '{' || json.Unmarshal(payload, &f) != nil || f.Progress == nil {
+		return ProgressFrame{}, false
+	}
+	return ProgressFrame{ID: f.ID, Progress: *f.Progress}, true
+}
+
+/* ---------- 响应体 ---------- */
+
+// APIError 是结构化的错误响应体，Code 供脚本判断，Message 供人阅读
+type APIError struct {
+	SchemaVersion int    `json:"schema_version"`
+	Code          string `json:"code"`
+	Message       string `json:"message"`
+	Verdict       string `json:"verdict,omitempty"`
+	Entry         string `json:"entry,omitempty"` // 解包上传中出问题的条目名
+}
+
+// Describe 把服务端返回的错误正文转换为可读文本，兼容纯文本错误
+func Describe(body []byte) string {
+	var e APIError
+	if json.Unmarshal(body, &e) == nil && e.Code != "" {
+		if e.Verdict != "" {
+			return fmt.Sprintf("%s: %s (%s)", e.Code, e.Message, e.Verdict)
+		}
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// Warning 附在部分结果上的结构化警告
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Capabilities 是 /_caps 的响应体
+type Capabilities struct {
+	SchemaVersion int       `json:"schema_version"`
+	ServerTime    time.Time `json:"server_time"`
+	Features      []string  `json:"features"`
+}
+
+// HasFeature 报告服务端是否支持某个特性
+func (c *Capabilities) HasFeature(name string) bool {
+	for _, f := range c.Features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+/* ---------- 请求元数据 ---------- */
+
+// 上传和下载请求可以携带调用方定义的元数据（如关联ID、目标环境），以重复的查询参数
+// MetadataParam=key=value 传递。wsbox 只校验和记录它们，交给钩子使用，自身不解释其含义
+const (
+	MetadataParam          = "meta"
+	MetadataReservedPrefix = "wsbox-" // 保留给 wsbox 自身，不区分大小写
+)
+
+// MetadataLimits 是 /_caps/metadata 的响应体，客户端可以据此在发送前校验
+type MetadataLimits struct {
+	SchemaVersion  int    `json:"schema_version"`
+	MaxEntries     int    `json:"max_entries"`
+	MaxKeyBytes    int    `json:"max_key_bytes"`
+	MaxValueBytes  int    `json:"max_value_bytes"`
+	MaxTotalBytes  int    `json:"max_total_bytes"` // 所有键和值的字节数之和
+	KeyCharset     string `json:"key_charset"`
+	ReservedPrefix string `json:"reserved_prefix"`
+}
+
+// DefaultMetadataLimits 是服务端使用的限制
+var DefaultMetadataLimits = MetadataLimits{
+	SchemaVersion:  SchemaVersion,
+	MaxEntries:     16,
+	MaxKeyBytes:    64,
+	MaxValueBytes:  1024,
+	MaxTotalBytes:  4096,
+	KeyCharset:     "A-Z a-z 0-9 . _ -",
+	ReservedPrefix: MetadataReservedPrefix,
+}
+
+// validMetadataKey 检查键只含字母、数字、点、下划线和连字符
+func validMetadataKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for _, c := range k {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Check 按限制校验元数据：键的字符集、保留前缀、条目数和长度；值必须是不含控制字符的UTF-8
+func (l *MetadataLimits) Check(md map[string]string) error {
+	if len(md) > l.MaxEntries {
+		return fmt.Errorf("too many metadata entries: %d, at most %d", len(md), l.MaxEntries)
+	}
+	total := 0
+	for k, v := range md {
+		if !validMetadataKey(k) {
+			return fmt.Errorf("metadata key %q: only letters, digits, '.', '_' and '-' are allowed", k)
+		}
+		if strings.HasPrefix(strings.ToLower(k), l.ReservedPrefix) {
+			return fmt.Errorf("metadata key %q: the %q prefix is reserved", k, l.ReservedPrefix)
+		}
+		if len(k) > l.MaxKeyBytes {
+			return fmt.Errorf("metadata key %q: longer than %d bytes", k, l.MaxKeyBytes)
+		}
+		if len(v) > l.MaxValueBytes {
+			return fmt.Errorf("metadata %q: value longer than %d bytes", k, l.MaxValueBytes)
+		}
+		if !utf8.ValidString(v) || strings.IndexFunc(v, unicode.IsControl) >= 0 {
+			return fmt.Errorf("metadata %q: value must be UTF-8 text without control characters", k)
+		}
+		total += len(k) + len(v)
+	}
+	if total > l.MaxTotalBytes {
+		return fmt.Errorf("metadata is %d bytes in total, at most %d", total, l.MaxTotalBytes)
+	}
+	return nil
+}
+
+// ParseMetadata 把 key=value 形式的条目解析为元数据，重复的键视为错误；不检查限制
+func ParseMetadata(entries []string) (map[string]string, error) {
+	md := map[string]string{}
+	for _, e := range entries {
+		k, v, ok := strings.Cut(e, "=")
+		if !ok {
+			return nil, fmt.Errorf("metadata %q: expected key=value", e)
+		}
+		if _, dup := md[k]; dup {
+			return nil, fmt.Errorf("metadata key %q given more than once", k)
+		}
+		md[k] = v
+	}
+	return md, nil
+}
+
+// ListResult 是 /_list?format=object 的响应体，可以表示截断的结果
+type ListResult struct {
+	SchemaVersion int      `json:"schema_version"`
+	Entries       []string `json:"entries"`
+	Truncated     bool     `json:"truncated"`
+	Warning       *Warning `json:"warning,omitempty"`
+}
+
+// ListEntry 是带元数据的目录项。Name 不带结尾的 "/"，目录由 Dir 标识，目录的 Size 为0；
+// Mode 是 fs.FileMode 的字符串形式，如 "-rw-r--r--"、"drwxr-xr-x"，符号链接为 "Lrwxrwxrwx" 且 Symlink 为 true
+type ListEntry struct {
+	Name    string    `json:"name"`
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Mode    string    `json:"mode"`
+	Symlink bool      `json:"symlink,omitempty"` // Size、ModTime 和 Mode 是链接本身的
+}
+
+// LongListResult 是 /_list?format=long 的响应体，在 ListEntry 之外还能表示截断的结果
+type LongListResult struct {
+	SchemaVersion int         `json:"schema_version"`
+	Entries       []ListEntry `json:"entries"`
+	Truncated     bool        `json:"truncated"`
+	Warning       *Warning    `json:"warning,omitempty"`
+}
+
+// ListHeader 是流式列表的第一帧
+type ListHeader struct {
+	SchemaVersion int    `json:"schema_version"`
+	Dir           string `json:"dir"`
+}
+
+// ListSummary 是流式列表的最后一帧
+type ListSummary struct {
+	Count     int      `json:"count"`
+	Truncated bool     `json:"truncated"`
+	Warning   *Warning `json:"warning,omitempty"`
+}
+
+// LatestEntry 是最近修改文件列表中的一项
+type LatestEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// LatestResult 是 /_latest 的响应体
+type LatestResult struct {
+	SchemaVersion int           `json:"schema_version"`
+	Entries       []LatestEntry `json:"entries"`
+	Truncated     bool          `json:"truncated"`
+	Warning       *Warning      `json:"warning,omitempty"`
+}
+
+// DuEntry 是目录占用统计中的一个直接条目。Size 是其下所有文件表观大小之和（目录递归统计），Files 是文件数
+type DuEntry struct {
+	Name  string `json:"name"`
+	Dir   bool   `json:"dir"`
+	Size  int64  `json:"size"`
+	Files int64  `json:"files"`
+}
+
+// DuResult 是 /_du 的响应体，条目按名字排序。截断时已统计的大小偏小
+type DuResult struct {
+	SchemaVersion int       `json:"schema_version"`
+	Dir           string    `json:"dir"`
+	Entries       []DuEntry `json:"entries"`
+	Total         int64     `json:"total"`
+	Files         int64     `json:"files"`
+	Truncated     bool      `json:"truncated"`
+	Warning       *Warning  `json:"warning,omitempty"`
+}
+
+// TreeEntry 是目录树中的一个条目。Path 是相对树根的路径（"/" 分隔，目录不带结尾的 "/"），Depth 从 1 开始
+type TreeEntry struct {
+	Path  string `json:"path"`
+	Dir   bool   `json:"dir"`
+	Depth int    `json:"depth"`
+}
+
+// TreeResult 是 /_tree 的响应体，条目按先序排列：每个目录紧跟着它的内容，同级按名字排序。
+// 条目数达到服务端上限时 Limited 为 true，超出遍历预算时 Truncated 为 true，两种情况都有 Warning
+type TreeResult struct {
+	SchemaVersion int         `json:"schema_version"`
+	Dir           string      `json:"dir"`
+	Entries       []TreeEntry `json:"entries"`
+	Limited       bool        `json:"limited"`
+	Truncated     bool        `json:"truncated"`
+	Warning       *Warning    `json:"warning,omitempty"`
+}
+
+// FindResult 是 /_find 的响应体。Matches 是相对 Dir 的路径，目录以 "/" 结尾；
+// 匹配数达到上限时 Limited 为 true，超出遍历预算时 Truncated 为 true，两种情况都有 Warning
+type FindResult struct {
+	SchemaVersion int      `json:"schema_version"`
+	Dir           string   `json:"dir"`
+	Matches       []string `json:"matches"`
+	Limited       bool     `json:"limited"`
+	Truncated     bool     `json:"truncated"`
+	Warning       *Warning `json:"warning,omitempty"`
+}
+
+// 打包下载的格式，见 /_archive
+const (
+	ArchiveTarGz = "tgz"
+	ArchiveZip   = "zip"
+)
+
+// ArchiveHeader 是打包下载的第一帧，之后是归档数据，以 ArchiveSummary 结束
+type ArchiveHeader struct {
+	SchemaVersion int    `json:"schema_version"`
+	Dir           string `json:"dir"`
+	Format        string `json:"format"`
+}
+
+// ArchiveSummary 是打包下载的最后一帧。Bytes 是文件内容的字节数（压缩前）；Skipped 是没有放入归档的条目
+// （未打开的文件、未存储的符号链接、设备等），Changed 是打包期间变短或读取出错、内容以零补足的文件。
+// Error 不为空时归档不完整，已收到的数据应当丢弃
+type ArchiveSummary struct {
+	Files   int    `json:"files"`
+	Dirs    int    `json:"dirs"`
+	Links   int    `json:"links"`
+	Skipped int    `json:"skipped"`
+	Changed int    `json:"changed"`
+	Bytes   int64  `json:"bytes"`
+	Error   string `json:"error,omitempty"`
+}
+
+// 解包上传：上传请求带 ExtractParam=ArchiveTarGz|ArchiveZip 时，请求路径是目标目录，正文是归档，
+// 服务端把它解到目标目录中，成功时以 201 和 ExtractResult 回复。不安全的条目（绝对路径、含 ".."、保留名）
+// 和超过大小限制的条目使整个请求以 422 失败，APIError.Entry 是出问题的条目名，已解出的内容全部删除
+const ExtractParam = "extract"
+
+// 解包上传被拒绝时 APIError 的 Code
+const (
+	UnsafeEntryCode     = "UNSAFE_ENTRY"
+	EntryTooLargeCode   = "ENTRY_TOO_LARGE"
+	ArchiveTooLargeCode = "ARCHIVE_TOO_LARGE"
+	BadArchiveCode      = "BAD_ARCHIVE"
+)
+
+// ExtractResult 是解包上传成功的响应体。Skipped 是没有解出的符号链接、硬链接和设备等条目，
+// Bytes 是解出的文件内容的字节数
+type ExtractResult struct {
+	SchemaVersion int    `json:"schema_version"`
+	Dir           string `json:"dir"`
+	Files         int    `json:"files"`
+	Dirs          int    `json:"dirs"`
+	Skipped       int    `json:"skipped"`
+	Bytes         int64  `json:"bytes"`
+}
+
+// 追加上传：上传请求带 AppendParam=1 时正文追加到目标文件末尾，文件不存在时创建，成功时以 201 和 AppendResult 回复。
+// 服务端先完整收到正文（并核对摘要），再在同一路径的锁下一次写入，同时追加的请求不会交错
+const AppendParam = "append"
+
+// AppendResult 是追加上传成功的响应体：Appended 是这次追加的字节数，Size 是追加之后的文件大小
+type AppendResult struct {
+	SchemaVersion int    `json:"schema_version"`
+	Path          string `json:"path"`
+	Appended      int64  `json:"appended"`
+	Size          int64  `json:"size"`
+}
+
+// StatInfo 是 /_stat 的响应体。路径不存在时 Exists 为 false 而不是返回错误，
+// 便于 "test" 命令区分"假"和"出错"。Mode 是八进制的权限位（如 "0644"），
+// SHA256 只在请求带 hash=1 且路径是文件时给出，旧服务端忽略该参数
+type StatInfo struct {
+	SchemaVersion int       `json:"schema_version"`
+	Path          string    `json:"path"`
+	Exists        bool      `json:"exists"`
+	IsDir         bool      `json:"is_dir"`
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"mod_time"`
+	Mode          string    `json:"mode,omitempty"`
+	SHA256        string    `json:"sha256,omitempty"`
+	Lock          *LockInfo `json:"lock,omitempty"` // 路径上尚未过期的锁（持有者、获取时间和 TTL）
+}
+
+// UploadOffset 是 /_upload_offset 的响应体，也是续传上传尚未完整时 POST 返回的 202 响应体：
+// 部分上传文件已有的字节数，下一次从这里继续发送
+type UploadOffset struct {
+	SchemaVersion int    `json:"schema_version"`
+	Path          string `json:"path"`
+	Offset        int64  `json:"offset"`
+}
+
+// Extent 是文件中的一段连续数据，区段之外是空洞
+type Extent struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// ExtentsResult 是 /_extents 的响应体
+type ExtentsResult struct {
+	SchemaVersion int      `json:"schema_version"`
+	Size          int64    `json:"size"`
+	Extents       []Extent `json:"extents"`
+}
+
+// Sparse 报告文件是否含有空洞
+func (r *ExtentsResult) Sparse() bool {
+	var data int64
+	for _, e := range r.Extents {
+		data += e.Length
+	}
+	return data < r.Size
+}
+
+// DirCount 是一个目录的直接条目数
+type DirCount struct {
+	Dir   string `json:"dir"`
+	Count int    `json:"count"`
+}
+
+// DirCountsResult 是 /_counts 的响应体。计数在两次巡检之间可能有偏差，
+// Passes 为0表示第一轮巡检尚未完成，此时只含已统计过的目录
+type DirCountsResult struct {
+	SchemaVersion int        `json:"schema_version"`
+	Entries       []DirCount `json:"entries"`
+	Dirs          int        `json:"dirs"` // 已统计的目录总数
+	Passes        int        `json:"passes"`
+	ReconciledAt  time.Time  `json:"reconciled_at"` // 最近一轮巡检完成的时间
+}
+
+// ActivityEntry 是活动记录中一次完成的操作
+type ActivityEntry struct {
+	Seq    uint64    `json:"seq"` // 同一次运行内递增，从1开始
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"` // upload、download 或 delete
+	Path   string    `json:"path"`
+	Size   int64     `json:"size"`  // 上传为写入的字节数，下载为文件大小，删除为0
+	Token  string    `json:"token"` // 发起操作的token指纹
+}
+
+// ActivityResult 是 /_activity 的响应体，条目按 Seq 从旧到新排列。
+// Run 标识服务端的这次运行，重启后改变、Seq 重新从1开始；轮询时把 Run 和 Last 原样带回（run=、since=）。
+// Gap 为 true 表示 since 之后的部分条目已经不在缓冲区中（被挤出或服务端重启过），此时返回的是缓冲区中现有的条目
+type ActivityResult struct {
+	SchemaVersion int             `json:"schema_version"`
+	Run           string          `json:"run"`
+	Entries       []ActivityEntry `json:"entries"`
+	Last          uint64          `json:"last"` // 已返回的最后一条的 Seq，没有条目时为请求的 since
+	More          bool            `json:"more"` // 受 limit 限制，还有更新的条目
+	Gap           bool            `json:"gap"`
+}
+
+// UploadLimits 是 /_caps/upload 的响应体
+type UploadLimits struct {
+	SchemaVersion int   `json:"schema_version"`
+	MaxSize       int64 `json:"max_size"` // 单个上传的最大字节数，0表示不限
+}
+
+// 超过 UploadLimits.MaxSize 的上传以 413 和 Code 为 TooLargeCode 的 APIError 拒绝，写入的部分被删除
+const TooLargeCode = "UPLOAD_TOO_LARGE"
+
+// BenchResult 是 POST /_bench/sink 的响应体。服务端读取并丢弃正文，客户端据此测量上行吞吐
+type BenchResult struct {
+	SchemaVersion int   `json:"schema_version"`
+	Bytes         int64 `json:"bytes"` // 收到的正文字节数
+}
+
+// BenchSinkMax 是 /_bench/sink 单次接受的最大正文，超过时以 413 拒绝
+const BenchSinkMax = 64 << 20
+
+// LockInfo 记录一个锁的持有者和有效期
+type LockInfo struct {
+	SchemaVersion int       `json:"schema_version"`
+	Path          string    `json:"path"`
+	Holder        string    `json:"holder"`
+	Token         string    `json:"token"` // token指纹，不保存原始token
+	AcquiredAt    time.Time `json:"acquired_at"`
+	TTL           int64     `json:"ttl_seconds"`
+}
+
+func (l *LockInfo) Expires() time.Time {
+	return l.AcquiredAt.Add(time.Duration(l.TTL) * time.Second)
+}
+
+func (l *LockInfo) Expired() bool {
+	return time.Now().After(l.Expires())
+}
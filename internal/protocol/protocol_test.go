@@ -0,0 +1,163 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata from the current structs")
+
+// golden 比较 got 与 testdata 中的文件，-update 时改为写入
+func golden(t *testing.T, name string, got []byte) []byte {
+	t.Helper()
+	file := filepath.Join("testdata", "frames", name)
+	if *update {
+		if err := os.WriteFile(file, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s changed:\n got %s\nwant %s\nthe wire format is part of protocol version %d; if the change is intended, keep it compatible and run go test -update",
+			name, bytes.TrimSpace(got), bytes.TrimSpace(want), Version)
+	}
+	return want
+}
+
+// frameFixtures 是版本2的每种 JSON 帧，文件名在 testdata/frames 下
+var frameFixtures = []struct {
+	file  string
+	frame any
+}{
+	{"request-get.json", &Request{Op: "GET", Path: "/docs/a b.txt"}},
+	{"request-upload.json", &Request{Op: "POST", Path: "/up/file.bin", Args: url.Values{
+		DigestParam: {DigestTrailer},
+		MtimeParam:  {"1700000000.5"},
+		ModeParam:   {"0644"},
+	}}},
+	{"request-move.json", &Request{Op: "MOVE", Path: "/a/c.txt", Args: url.Values{"dst": {"/b/c.txt"}, "force": {"1"}}}},
+	{"request-lock.json", &Request{Op: "LOCK", Path: "/jobs/nightly", Args: url.Values{"holder": {"ci-42"}, "ttl": {"30s"}}}},
+	{"request-inline-body.json", &Request{Op: "POST", Path: "/notes/todo.txt", Body: "buy milk"}},
+	{"response-download.json", &ResponseHeader{
+		Status: 200, Size: 1234,
+		SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		MTime:  "1700000000.500000000", Mode: "0644",
+	}},
+	{"response-streamed.json", &ResponseHeader{Status: 200, Size: StreamedSize}},
+	{"response-canonical.json", &ResponseHeader{Status: 200, Canonical: "/data/real/file.txt"}},
+	{"response-error.json", &ResponseHeader{Status: 404, Size: 58}},
+	{"progress.json", &ProgressFrame{ID: 7, Progress: ProgressInfo{Done: 1 << 20, Phase: "hash"}}},
+}
+
+// 每种帧编码后与 golden 文件逐字节相同，golden 文件解码后与原值相等
+func TestFrameGolden(t *testing.T) {
+	for _, tt := range frameFixtures {
+		got, err := json.Marshal(tt.frame)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		want := golden(t, tt.file, append(got, '\n'))
+
+		decoded := reflect.New(reflect.TypeOf(tt.frame).Elem())
+		dec := json.NewDecoder(bytes.NewReader(want))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(decoded.Interface()); err != nil {
+			t.Errorf("%s: decode: %v", tt.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded.Interface(), tt.frame) {
+			t.Errorf("%s: decoded %+v, want %+v", tt.file, decoded.Elem(), reflect.ValueOf(tt.frame).Elem())
+		}
+	}
+}
+
+// 进度帧与状态头共用文本帧，只有带 progress 字段的才被识别为进度帧
+func TestParseProgressGolden(t *testing.T) {
+	for _, tt := range frameFixtures {
+		b, err := os.ReadFile(filepath.Join("testdata", "frames", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, ok := ParseProgress(bytes.TrimSpace(b))
+		want, isProgress := tt.frame.(*ProgressFrame)
+		if ok != isProgress {
+			t.Errorf("%s: ParseProgress ok = %v, want %v", tt.file, ok, isProgress)
+		}
+		if isProgress && f != *want {
+			t.Errorf("%s: ParseProgress = %+v, want %+v", tt.file, f, *want)
+		}
+	}
+}
+
+// 流水线连接上的帧是请求ID、一个空格和原来的帧
+func TestPipelinedFrameGolden(t *testing.T) {
+	tests := []struct {
+		file  string
+		id    uint64
+		frame any
+	}{
+		{"pipelined-request.frame", 42, &Request{Op: "GET", Path: "/logs/app.log"}},
+		{"pipelined-response.frame", 42, &ResponseHeader{Status: 200, Size: 5}},
+	}
+	for _, tt := range tests {
+		payload, err := json.Marshal(tt.frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := golden(t, tt.file, append(TagFrame(tt.id, payload), '\n'))
+		id, rest, ok := SplitFrame(bytes.TrimSuffix(want, []byte("\n")))
+		if !ok || id != tt.id {
+			t.Fatalf("%s: SplitFrame = %d, %v; want %d", tt.file, id, ok, tt.id)
+		}
+		decoded := reflect.New(reflect.TypeOf(tt.frame).Elem())
+		if err := json.Unmarshal(rest, decoded.Interface()); err != nil {
+			t.Fatalf("%s: decode: %v", tt.file, err)
+		}
+		if !reflect.DeepEqual(decoded.Interface(), tt.frame) {
+			t.Errorf("%s: decoded %+v, want %+v", tt.file, decoded.Elem(), reflect.ValueOf(tt.frame).Elem())
+		}
+	}
+}
+
+func TestSplitFrameRejects(t *testing.T) {
+	for _, msg := range []string{"", "42", "42{}", " 42 GET /", "x42 GET /", "123456789012345678901 GET /", "99999999999999999999 GET /"} {
+		if id, _, ok := SplitFrame([]byte(msg)); ok {
+			t.Errorf("SplitFrame(%q) = %d, ok; want rejected", msg, id)
+		}
+	}
+}
+
+// 版本1的请求行与版本2的请求帧可以互相转换：Target 等于请求行的第二个字段
+func TestRequestLineRoundTrip(t *testing.T) {
+	for _, tt := range frameFixtures {
+		r, ok := tt.frame.(*Request)
+		if !ok {
+			continue
+		}
+		line := r.Op + " " + r.Target()
+		if r.Body != "" {
+			line += " " + r.Body
+		}
+		got, err := ParseRequestLine(line)
+		if err != nil {
+			t.Fatalf("%s: ParseRequestLine(%q): %v", tt.file, line, err)
+		}
+		if !reflect.DeepEqual(&got, r) {
+			t.Errorf("%s: %q parsed as %+v, want %+v", tt.file, line, got, *r)
+		}
+	}
+	for _, line := range []string{"GET", "GET relative/path", "GET /%zz"} {
+		if _, err := ParseRequestLine(line); err == nil {
+			t.Errorf("ParseRequestLine(%q) accepted a malformed line", line)
+		}
+	}
+}
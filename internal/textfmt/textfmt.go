@@ -0,0 +1,166 @@
+// Package textfmt 提供客户端所有命令共用的人类可读格式：文件大小、时间、时长和对齐表格。
+// JSON 输出不经过这里，始终保留原始数值。
+package textfmt
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Options 控制格式化方式，对应客户端的 -bytes 和 -iso 标志
+type Options struct {
+	Bytes bool // 大小显示为原始字节数
+	ISO   bool // 时间显示为 RFC3339
+}
+
+// Size 格式化文件大小，如 "512B"、"1.4K"、"23M"、"2.3G"
+func (o Options) Size(n int64) string {
+	if o.Bytes {
+		return fmt.Sprintf("%d", n)
+	}
+	return Size(n)
+}
+
+// Time 格式化时间，一天以内显示相对时间，更早的显示本地日期时间
+func (o Options) Time(t time.Time) string {
+	if o.ISO {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return Time(t, time.Now())
+}
+
+// Size 使用1024进制格式化字节数，小于10的值保留一位小数
+func Size(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	const units = "KMGTPE"
+	v := float64(n)
+	i := -1
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	// 按舍入后的值选择格式和单位，9.96K 显示为 "10K"，1023.6K 显示为 "1.0M"
+	if math.Round(v) >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if math.Round(v*10) < 100 {
+		return fmt.Sprintf("%.1f%c", v, units[i])
+	}
+	return fmt.Sprintf("%.0f%c", v, units[i])
+}
+
+// ParseSize 解析 Size 的输出格式（"512"、"512B"、"1.5K"、"2G"，1024进制，大小写不敏感），用于大小类的命令行参数
+func ParseSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := 1.0
+	if num != "" {
+		if i := strings.IndexByte("KMGTPE", num[len(num)-1]); i >= 0 {
+			num = num[:len(num)-1]
+			for ; i >= 0; i-- {
+				mult *= 1024
+			}
+		}
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * mult), nil
+}
+
+// Time 相对 now 格式化时间：一天以内为 "2h ago"，否则为 "2024-05-01 13:22"
+func Time(t, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	age := now.Sub(t)
+	switch {
+	case age < 0 || age >= 24*time.Hour:
+		return t.Local().Format("2006-01-02 15:04")
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age/time.Minute))
+	default:
+		return fmt.Sprintf("%dh ago", int(age/time.Hour))
+	}
+}
+
+// Duration 格式化时长：不足1秒显示毫秒，否则截断到秒，如 "850ms"、"1m32s"、"2h5m0s"
+func Duration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return d.Truncate(time.Second).String()
+}
+
+// Align 表示列的对齐方式
+type Align int
+
+const (
+	Left Align = iota
+	Right
+)
+
+// Table 缓存所有行，Flush 时按列宽对齐输出。数值列通常右对齐
+type Table struct {
+	w      io.Writer
+	aligns []Align
+	rows   [][]string
+}
+
+// NewTable 创建表格，aligns 依次指定每列的对齐方式，未指定的列左对齐
+func NewTable(w io.Writer, aligns ...Align) *Table {
+	return &Table{w: w, aligns: aligns}
+}
+
+// Row 追加一行
+func (t *Table) Row(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// Flush 输出所有行，列之间以两个空格分隔，最后一列不补齐空格
+func (t *Table) Flush() error {
+	var widths []int
+	for _, row := range t.rows {
+		for i, c := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(c); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for _, row := range t.rows {
+		var b strings.Builder
+		for i, c := range row {
+			if i > 0 {
+				b.WriteString("  ")
+			}
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c))
+			switch {
+			case i < len(t.aligns) && t.aligns[i] == Right:
+				b.WriteString(pad + c)
+			case i == len(row)-1:
+				b.WriteString(c)
+			default:
+				b.WriteString(c + pad)
+			}
+		}
+		b.WriteByte('\n')
+		if _, err := io.WriteString(t.w, b.String()); err != nil {
+			return err
+		}
+	}
+	t.rows = nil
+	return nil
+}
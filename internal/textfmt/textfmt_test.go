@@ -0,0 +1,122 @@
+package textfmt
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden 比较输出与 testdata/<name>.golden，-update 时改为写入。各命令的输出都经过这里，
+// golden 文件的变化意味着所有命令的显示都变了
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	file := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(file, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s changed:\n--- got\n%s--- want\n%s", file, got, want)
+	}
+}
+
+func TestSizeGolden(t *testing.T) {
+	sizes := []int64{
+		0, 1, 512, 1023, 1024, 1025, 1536, 10189, 10240, 10250, 102400,
+		1<<20 - 1, 1 << 20, 1468006, 23 << 20, 1<<30 - 1, 2469606195, 1 << 40, 1 << 50, 1 << 60, math.MaxInt64,
+	}
+	var b bytes.Buffer
+	t2 := NewTable(&b, Right, Right, Right)
+	t2.Row("bytes", "Size", "-bytes")
+	for _, n := range sizes {
+		t2.Row(fmt.Sprint(n), Size(n), Options{Bytes: true}.Size(n))
+	}
+	t2.Flush()
+	golden(t, "size", b.Bytes())
+}
+
+// Size 的输出可以作为大小类参数读回，误差不超过显示的精度
+func TestParseSizeRoundTrip(t *testing.T) {
+	for _, n := range []int64{0, 1, 512, 1024, 1536, 10189, 1 << 20, 1468006, 23 << 20, 2469606195, 1 << 40} {
+		got, err := ParseSize(Size(n))
+		if err != nil {
+			t.Fatalf("ParseSize(%q): %v", Size(n), err)
+		}
+		if diff := math.Abs(float64(got-n)) / math.Max(float64(n), 1); diff > 0.05 {
+			t.Errorf("ParseSize(Size(%d)) = %d via %q", n, got, Size(n))
+		}
+	}
+	for _, s := range []string{"", "K", "-1K", "1X", "1.2.3M"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("ParseSize(%q) accepted an invalid size", s)
+		}
+	}
+}
+
+func TestTimeGolden(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	now := time.Date(2024, 5, 1, 13, 22, 0, 0, time.UTC)
+	ages := []time.Duration{
+		0, 30 * time.Second, 59 * time.Second, time.Minute, 59 * time.Minute, time.Hour,
+		2*time.Hour + 30*time.Minute, 23*time.Hour + 59*time.Minute, 24 * time.Hour, 400 * 24 * time.Hour,
+		-time.Hour, // 未来的时间（时钟偏差）显示日期
+	}
+	var b bytes.Buffer
+	tab := NewTable(&b, Left, Left, Left)
+	tab.Row("age", "Time", "-iso")
+	tab.Row("zero", Time(time.Time{}, now), "-")
+	for _, age := range ages {
+		ts := now.Add(-age)
+		tab.Row(age.String(), Time(ts, now), Options{ISO: true}.Time(ts))
+	}
+	tab.Flush()
+	golden(t, "time", b.Bytes())
+}
+
+func TestDurationGolden(t *testing.T) {
+	ds := []time.Duration{
+		0, 999 * time.Microsecond, 850 * time.Millisecond, 999 * time.Millisecond, time.Second,
+		1500 * time.Millisecond, 92 * time.Second, time.Hour + 5*time.Minute + 59*time.Second + 900*time.Millisecond,
+		50 * time.Hour,
+	}
+	var b bytes.Buffer
+	tab := NewTable(&b, Right, Right)
+	for _, d := range ds {
+		tab.Row(d.String(), Duration(d))
+	}
+	tab.Flush()
+	golden(t, "duration", b.Bytes())
+}
+
+// 表格：右对齐的列左侧补空格，最后一列不补齐，宽度按字符而不是字节计算，行的列数可以不同
+func TestTableGolden(t *testing.T) {
+	var b bytes.Buffer
+	tab := NewTable(&b, Left, Right, Right)
+	tab.Row("-rw-r--r--", "512B", "just now", "a.txt")
+	tab.Row("drwxr-xr-x", "4.0K", "2h ago", "目录/")
+	tab.Row("-rw-------", "2.3G", "2024-05-01 13:22", "很长的文件名.tar.gz")
+	tab.Row("short")
+	if err := tab.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// Flush 之后表格是空的，可以接着使用
+	tab.Row("x", "1B")
+	tab.Flush()
+	golden(t, "table", b.Bytes())
+}
@@ -0,0 +1,101 @@
+// Package throttle 提供按字节计的令牌桶，客户端的 -bwlimit 和服务端的 -bwlimit-per-conn 共用。
+// 桶只存得下约 100ms 的流量，超出的部分记为欠账、由下一次等待补上，
+// 因此长时间的平均速率等于设定值，也不会在空闲之后一口气放出几秒的突发。
+package throttle
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Limiter 是一条连接的字节令牌桶，可以被多个 goroutine 同时使用。nil 表示不限速
+type Limiter struct {
+	rate  float64 // 每秒的字节数
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64 // 可以为负：之前的等待欠下的字节
+	last   time.Time
+}
+
+// New 返回每秒 rate 字节的令牌桶，rate 不大于0时返回 nil
+func New(rate int64) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	burst := max(float64(rate)/10, 1)
+	return &Limiter{rate: float64(rate), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait 记下 n 个字节，令牌不够时等到补足为止
+func (l *Limiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	d := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// piece 是读写一次最多经过的字节数，大块被拆开，速率在一块之内也是平滑的
+func (l *Limiter) piece() int {
+	return max(int(l.burst), 1)
+}
+
+// Reader 返回按 l 限速的 Reader，l 为 nil 时原样返回 r
+func Reader(r io.Reader, l *Limiter) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{r: r, l: l}
+}
+
+// Writer 返回按 l 限速的 Writer，l 为 nil 时原样返回 w
+func Writer(w io.Writer, l *Limiter) io.Writer {
+	if l == nil {
+		return w
+	}
+	return &writer{w: w, l: l}
+}
+
+type reader struct {
+	r io.Reader
+	l *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.l.piece() {
+		p = p[:r.l.piece()]
+	}
+	n, err := r.r.Read(p)
+	r.l.Wait(n)
+	return n, err
+}
+
+type writer struct {
+	w io.Writer
+	l *Limiter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		b := p[:min(len(p), w.l.piece())]
+		w.l.Wait(len(b))
+		n, err := w.w.Write(b)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
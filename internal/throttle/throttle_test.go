@@ -0,0 +1,114 @@
+package throttle
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// within 检查传输 n 字节在 rate 下用的时间与理论值相差不超过宽松的容差：
+// 下限扣掉桶里初始的约 100ms 令牌，上限给调度留出余量
+func within(t *testing.T, what string, elapsed time.Duration, n, rate int64) {
+	t.Helper()
+	want := time.Duration(float64(n) / float64(rate) * float64(time.Second))
+	if elapsed < want-150*time.Millisecond || elapsed > want*2+200*time.Millisecond {
+		t.Errorf("%s: %d bytes at %d B/s took %v, want about %v", what, n, rate, elapsed, want)
+	}
+}
+
+func TestReaderRate(t *testing.T) {
+	const rate, n = 2 << 20, 1 << 20 // 2 MiB/s 读 1 MiB，约 500ms
+	start := time.Now()
+	got, err := io.Copy(io.Discard, Reader(bytes.NewReader(make([]byte, n)), New(rate)))
+	if err != nil || got != n {
+		t.Fatalf("copied %d bytes: %v", got, err)
+	}
+	within(t, "Reader", time.Since(start), n, rate)
+}
+
+func TestWriterRate(t *testing.T) {
+	const rate, n = 2 << 20, 1 << 20
+	var dst bytes.Buffer
+	start := time.Now()
+	// 一次写入整块，Writer 自己拆开
+	if got, err := Writer(&dst, New(rate)).Write(make([]byte, n)); err != nil || got != n {
+		t.Fatalf("wrote %d bytes: %v", got, err)
+	}
+	within(t, "Writer", time.Since(start), n, rate)
+	if dst.Len() != n {
+		t.Errorf("destination got %d bytes", dst.Len())
+	}
+}
+
+// 空闲之后不会一口气放出积攒的令牌：桶最多存约 100ms 的流量
+func TestNoBurstAfterIdle(t *testing.T) {
+	const rate, n = 2 << 20, 1 << 20
+	l := New(rate)
+	time.Sleep(500 * time.Millisecond)
+	start := time.Now()
+	io.Copy(io.Discard, Reader(bytes.NewReader(make([]byte, n)), l))
+	within(t, "after idling", time.Since(start), n, rate)
+}
+
+// 每次读写经过的字节不超过桶的容量，速率在一个大块之内也是平滑的
+func TestSmoothPieces(t *testing.T) {
+	const rate = 1 << 20
+	l := New(rate)
+	r := Reader(bytes.NewReader(make([]byte, 1<<20)), l)
+	buf := make([]byte, 512<<10)
+	n, _ := r.Read(buf)
+	if n > rate/10+1 {
+		t.Errorf("one Read passed %d bytes, more than the %d-byte bucket", n, rate/10)
+	}
+
+	var sizes []int
+	w := Writer(writerFunc(func(p []byte) (int, error) {
+		sizes = append(sizes, len(p))
+		return len(p), nil
+	}), New(rate))
+	w.Write(make([]byte, 300<<10))
+	for _, s := range sizes {
+		if s > rate/10+1 {
+			t.Fatalf("Writer passed a %d-byte piece, more than the %d-byte bucket", s, rate/10)
+		}
+	}
+}
+
+// 同一个 Limiter 被多个 goroutine 共用时（一条连接上的多个请求），合计速率仍是设定值
+func TestSharedLimiter(t *testing.T) {
+	const rate, n, workers = 2 << 20, 256 << 10, 4
+	l := New(rate)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			io.Copy(io.Discard, Reader(bytes.NewReader(make([]byte, n)), l))
+		}()
+	}
+	wg.Wait()
+	within(t, "4 readers sharing a limiter", time.Since(start), n*workers, rate)
+}
+
+func TestUnlimited(t *testing.T) {
+	if New(0) != nil || New(-1) != nil {
+		t.Fatal("New with a non-positive rate returned a limiter")
+	}
+	r := bytes.NewReader(nil)
+	if Reader(r, nil) != io.Reader(r) {
+		t.Error("Reader with a nil limiter wrapped the reader")
+	}
+	var w bytes.Buffer
+	if Writer(&w, nil) != io.Writer(&w) {
+		t.Error("Writer with a nil limiter wrapped the writer")
+	}
+	var l *Limiter
+	l.Wait(1 << 30) // nil 不限速，立即返回
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
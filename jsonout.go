@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：全局 -json 输出 ---------- */
+
+// 全局 -json 时 list、stat、add、get、append 向 stdout 输出且只输出一个 JSON 文档，其他提示都写到 stderr；
+// 失败时输出 jsonError 并按 exitCode 退出。其他命令使用各自的 -json 标志
+
+// jsonCommands 是支持全局 -json 的命令
+var jsonCommands = map[string]bool{"list": true, "stat": true, "add": true, "get": true, "append": true}
+
+// transferResult 是全局 -json 时 add 和 get 成功后的输出，SHA256 只在内容与服务端核对过时给出；
+// add -if-changed 跳过了内容相同的文件时 Unchanged 为 true，Bytes 为0
+type transferResult struct {
+	Path       string `json:"path"`
+	Local      string `json:"local,omitempty"`
+	Bytes      int64  `json:"bytes"`
+	DurationMS int64  `json:"duration_ms"`
+	SHA256     string `json:"sha256,omitempty"`
+	Unchanged  bool   `json:"unchanged,omitempty"`
+}
+
+// jsonError 是全局 -json 时命令失败的输出，Status 是服务端响应的 HTTP 状态，不是服务端拒绝时省略
+type jsonError struct {
+	Error  string `json:"error"`
+	Status int    `json:"status,omitempty"`
+}
+
+// printJSON 向 stdout 输出一个 JSON 文档
+func printJSON(v any) {
+	json.NewEncoder(os.Stdout).Encode(v)
+}
+
+// fail 在 stderr 上输出错误的可读描述并按 exitCode 退出；全局 -json 时同时向 stdout 输出 jsonError
+func (c *clientCmd) fail(err error) {
+	c.failWith(describeErr(err), err, exitCode(err))
+}
+
+// failWith 与 fail 相同，但提示为 msg、退出码为 code；err 只用来取得 HTTP 状态，可以为 nil
+func (c *clientCmd) failWith(msg string, err error, code int) {
+	fmt.Fprintln(os.Stderr, msg)
+	if c.json {
+		printJSON(jsonError{Error: msg, Status: errorStatus(err)})
+	}
+	os.Exit(code)
+}
+
+// errorStatus 返回错误对应的 HTTP 状态：服务端返回的错误状态或网关拒绝升级的状态，其他错误为0
+func errorStatus(err error) int {
+	var re *client.RemoteError
+	var he *client.HandshakeError
+	switch {
+	case errors.As(err, &re):
+		return re.Status
+	case errors.As(err, &he):
+		return he.StatusCode
+	}
+	return 0
+}
+
+// printTransfer 在全局 -json 时输出一次成功传输的结果，local 为本地文件，从标准输入上传时为空
+func (c *clientCmd) printTransfer(remote, local string, st client.TransferStats, elapsed time.Duration) {
+	n := st.Size
+	if n == 0 {
+		n = st.Bytes
+	}
+	printJSON(transferResult{Path: path.Join("/", remote), Local: local, Bytes: n, DurationMS: elapsed.Milliseconds(), SHA256: st.SHA256})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wsbox/internal/protocol"
+	"wsbox/pkg/server"
+)
+
+const testToken = "test-token"
+
+// startTestServer 在本机的随机端口上运行以临时目录为沙箱的服务端，返回 websocket 地址，测试结束时关闭
+func startTestServer(t *testing.T) string {
+	t.Helper()
+	return startTestServerConfig(t, server.Config{Dir: t.TempDir()})
+}
+
+// startTestServerConfig 与 startTestServer 相同，但使用给定的配置；cfg.Token 总是 testToken
+func startTestServerConfig(t *testing.T, cfg server.Config) string {
+	t.Helper()
+	cfg.Token = testToken
+	s, err := server.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return "ws://" + ln.Addr().String() + "/ws"
+}
+
+// decodeOne 把 stdout 严格解析为 v：恰好一个 JSON 文档，没有未知字段
+func decodeOne(t *testing.T, what, stdout string, v any) {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(stdout))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		t.Fatalf("%s: stdout %q is not a %T: %v", what, stdout, v, err)
+	}
+	if dec.More() {
+		t.Fatalf("%s: stdout has more than one JSON document: %q", what, stdout)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	url := startTestServer(t)
+	local := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(local, []byte("hello json"), 0o644)
+	wsbox := func(args ...string) (int, string, string) {
+		return runWsbox(t, append([]string{"client", "-s", url, "-token", testToken, "-json"}, args...)...)
+	}
+
+	code, stdout, stderr := wsbox("add", local, "/d/a.txt")
+	var added transferResult
+	decodeOne(t, "add", stdout, &added)
+	if code != 0 || added.Path != "/d/a.txt" || added.Local != local || added.Bytes != 10 {
+		t.Errorf("add: exit %d, %+v (stderr %q)", code, added, stderr)
+	}
+
+	got := filepath.Join(t.TempDir(), "b.txt")
+	code, stdout, _ = wsbox("get", "/d/a.txt", got)
+	var fetched transferResult
+	decodeOne(t, "get", stdout, &fetched)
+	if code != 0 || fetched.Path != "/d/a.txt" || fetched.Local != got || fetched.Bytes != 10 {
+		t.Errorf("get: exit %d, %+v", code, fetched)
+	}
+	if b, _ := os.ReadFile(got); string(b) != "hello json" {
+		t.Errorf("get wrote %q", b)
+	}
+
+	code, stdout, _ = wsbox("list", "/d")
+	var entries []protocol.ListEntry
+	decodeOne(t, "list", stdout, &entries)
+	if code != 0 || len(entries) != 1 || entries[0].Name != "a.txt" || entries[0].Size != 10 || entries[0].Dir || entries[0].ModTime.IsZero() {
+		t.Errorf("list: exit %d, %+v", code, entries)
+	}
+	// 空目录是空数组，不是 null
+	if code, _, stderr := runWsbox(t, "client", "-s", url, "-token", testToken, "mkdir", "/e"); code != 0 {
+		t.Fatalf("mkdir /e: exit %d: %s", code, stderr)
+	}
+	code, stdout, _ = wsbox("list", "/e")
+	entries = nil
+	decodeOne(t, "list of an empty directory", stdout, &entries)
+	if code != 0 || entries == nil || len(entries) != 0 {
+		t.Errorf("list /e: exit %d, %q", code, stdout)
+	}
+
+	code, stdout, _ = wsbox("stat", "/d/a.txt")
+	var info protocol.StatInfo
+	decodeOne(t, "stat", stdout, &info)
+	if code != 0 || !info.Exists || info.IsDir || info.Size != 10 || info.Path != "/d/a.txt" || info.SchemaVersion != protocol.SchemaVersion {
+		t.Errorf("stat: exit %d, %+v", code, info)
+	}
+	code, stdout, _ = wsbox("stat", "/missing")
+	info = protocol.StatInfo{}
+	decodeOne(t, "stat of a missing path", stdout, &info)
+	if code != exitNotFound || info.Exists {
+		t.Errorf("stat /missing: exit %d, %+v", code, info)
+	}
+}
+
+// 失败时 stdout 上是一个 jsonError，可读的描述在 stderr 上，退出码与不带 -json 时相同
+func TestJSONOutputErrors(t *testing.T) {
+	url := startTestServer(t)
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		status int
+	}{
+		{"get of a missing file", []string{"-token", testToken, "get", "/missing.txt", filepath.Join(t.TempDir(), "x")}, exitNotFound, 404},
+		{"list of a missing directory", []string{"-token", testToken, "list", "/missing"}, exitNotFound, 404},
+		{"add of a missing local file", []string{"-token", testToken, "add", filepath.Join(t.TempDir(), "nope"), "/x"}, exitFailure, 0},
+		{"rejected token", []string{"-token", "wrong", "stat", "/"}, exitAuth, 401},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runWsbox(t, append([]string{"client", "-s", url, "-json"}, tt.args...)...)
+		var e jsonError
+		decodeOne(t, tt.name, stdout, &e)
+		if code != tt.code || e.Status != tt.status || e.Error == "" {
+			t.Errorf("%s: exit %d, %+v; want exit %d, status %d", tt.name, code, e, tt.code, tt.status)
+		}
+		if !strings.Contains(stderr, e.Error) {
+			t.Errorf("%s: stderr %q does not describe the error", tt.name, stderr)
+		}
+	}
+
+	code, stdout, _ := runWsbox(t, "client", "-s", "ws://"+closedAddr(t)+"/ws", "-token", testToken, "-json", "stat", "/")
+	var e jsonError
+	decodeOne(t, "connection refused", stdout, &e)
+	if code != exitConn || e.Status != 0 || e.Error == "" {
+		t.Errorf("connection refused: exit %d, %+v", code, e)
+	}
+	if bytes.Count([]byte(stdout), []byte("\n")) != 1 {
+		t.Errorf("connection refused: stdout %q is not one line", stdout)
+	}
+}
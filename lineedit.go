@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/* ---------- 终端：行编辑 ---------- */
+
+// lineEditor 读取一行命令。标准输入和输出都是终端且支持原始模式（Linux）时提供行内编辑、历史和 Tab 补全，
+// 否则逐行读取（管道输入、其他平台）。只在读取时切换到原始模式，命令执行期间终端保持原来的设置。
+// 与 browse 一样按字符数计算宽度，超过一行的输入在窄终端上重绘可能错位
+
+// errLineInterrupted 表示输入时按了 Ctrl-C，这一行被放弃
+var errLineInterrupted = errors.New("interrupted")
+
+type lineEditor struct {
+	in      *bufio.Reader
+	keys    []string // 已经读到、尚未处理的按键（粘贴多行时）
+	history []string
+	// complete 返回光标前最后一个词的起始位置、去掉引号和转义后的内容，以及替换它的候选
+	complete func(line []rune) (start int, word string, candidates []string)
+	plain    bool // 不使用原始模式，逐行读取
+	prompt   bool // 输出提示符（标准输入是终端）
+}
+
+func newLineEditor() *lineEditor {
+	interactive := isTerminal(os.Stdin)
+	return &lineEditor{
+		in:     bufio.NewReader(os.Stdin),
+		plain:  !interactive || !stdoutIsTerminal,
+		prompt: interactive,
+	}
+}
+
+// readLine 输出提示符并读取一行，不含换行符。输入结束（Ctrl-D）时返回 io.EOF，Ctrl-C 时返回 errLineInterrupted
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if !e.plain {
+		restore, err := makeRaw(int(os.Stdin.Fd()))
+		if err == nil {
+			defer restore()
+			return e.edit(prompt)
+		}
+		e.plain = true
+	}
+	if e.prompt {
+		fmt.Print(prompt)
+	}
+	line, err := e.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// addHistory 把执行过的一行加入历史，与上一条相同时不重复记录
+func (e *lineEditor) addHistory(line string) {
+	if line == "" || len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+}
+
+func (e *lineEditor) nextKey() (string, error) {
+	if len(e.keys) == 0 {
+		buf := make([]byte, 256)
+		n, err := e.in.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		e.keys = splitKeys(string(buf[:n]))
+	}
+	k := e.keys[0]
+	e.keys = e.keys[1:]
+	return k, nil
+}
+
+// edit 在原始模式下读取一行。原始模式关闭了输出处理，换行要写成 \r\n
+func (e *lineEditor) edit(prompt string) (string, error) {
+	out := bufio.NewWriter(os.Stdout)
+	var line []rune
+	pos := 0
+	hist := len(e.history) // 正在显示的历史条目，len(e.history) 是正在输入的新行
+	var draft []rune       // 浏览历史之前输入的内容
+	tabs := 0
+
+	redraw := func() {
+		out.WriteString("\r" + prompt + string(line) + "\x1b[K")
+		if n := len(line) - pos; n > 0 {
+			fmt.Fprintf(out, "\x1b[%dD", n)
+		}
+		out.Flush()
+	}
+	insert := func(s string) {
+		r := []rune(s)
+		line = append(line[:pos], append(r, line[pos:]...)...)
+		pos += len(r)
+	}
+	show := func(i int) {
+		if hist == len(e.history) {
+			draft = line
+		}
+		hist = i
+		if i == len(e.history) {
+			line = draft
+		} else {
+			line = []rune(e.history[i])
+		}
+		pos = len(line)
+	}
+
+	redraw()
+	for {
+		k, err := e.nextKey()
+		if err != nil {
+			out.WriteString("\r\n")
+			out.Flush()
+			return "", err
+		}
+		if k == "\t" {
+			tabs++
+		} else {
+			tabs = 0
+		}
+		switch k {
+		case "\r", "\n":
+			pos = len(line)
+			redraw()
+			out.WriteString("\r\n")
+			out.Flush()
+			return string(line), nil
+		case "\x03": // Ctrl-C
+			out.WriteString("^C\r\n")
+			out.Flush()
+			return "", errLineInterrupted
+		case "\x04": // Ctrl-D：空行时结束输入，否则删除光标处的字符
+			if len(line) == 0 {
+				out.WriteString("\r\n")
+				out.Flush()
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case "\x7f", "\x08":
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case "\x1b[3~":
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case "\x1b[D", "\x1bOD", "\x02":
+			pos = max(pos-1, 0)
+		case "\x1b[C", "\x1bOC", "\x06":
+			pos = min(pos+1, len(line))
+		case "\x1b[H", "\x1bOH", "\x1b[1~", "\x01":
+			pos = 0
+		case "\x1b[F", "\x1bOF", "\x1b[4~", "\x05":
+			pos = len(line)
+		case "\x1b[A", "\x1bOA", "\x10":
+			if hist > 0 {
+				show(hist - 1)
+			}
+		case "\x1b[B", "\x1bOB", "\x0e":
+			if hist < len(e.history) {
+				show(hist + 1)
+			}
+		case "\x15": // Ctrl-U
+			line, pos = append([]rune(nil), line[pos:]...), 0
+		case "\x0b": // Ctrl-K
+			line = line[:pos]
+		case "\x17": // Ctrl-W：删除光标前的一个词
+			i := pos
+			for i > 0 && unicode.IsSpace(line[i-1]) {
+				i--
+			}
+			for i > 0 && !unicode.IsSpace(line[i-1]) {
+				i--
+			}
+			line, pos = append(line[:i], line[pos:]...), i
+		case "\x0c": // Ctrl-L
+			out.WriteString("\x1b[H\x1b[2J")
+		case "\t":
+			if e.complete == nil {
+				break
+			}
+			start, word, cands := e.complete(line[:pos])
+			repl, list := completion(word, cands)
+			switch {
+			case repl != "":
+				line = append(line[:start], line[pos:]...)
+				pos = start
+				insert(repl)
+			case list && tabs > 1:
+				// 第二次 Tab 列出所有候选
+				out.WriteString("\r\n")
+				cols, _, err := terminalSize(int(os.Stdout.Fd()))
+				if err != nil {
+					cols = 80
+				}
+				printColumns(out, shortNames(cands), cols, "\r\n")
+			default:
+				out.WriteString("\a")
+			}
+		default:
+			if r, _ := utf8.DecodeRuneInString(k); utf8.RuneCountInString(k) == 1 && unicode.IsPrint(r) {
+				insert(k)
+			}
+		}
+		redraw()
+	}
+}
+
+// completion 根据候选决定 Tab 的效果：唯一的候选整个补全（不是目录时再加一个空格），
+// 多个候选有更长的公共前缀时补全到公共前缀，否则 list 为 true，由再次按 Tab 列出候选。
+// repl 是转义后替换当前词的文本，为空表示没有可补全的内容
+func completion(word string, cands []string) (repl string, list bool) {
+	switch len(cands) {
+	case 0:
+		return "", false
+	case 1:
+		if strings.HasSuffix(cands[0], "/") {
+			return escapeWord(cands[0]), false
+		}
+		return escapeWord(cands[0]) + " ", false
+	}
+	common := cands[0]
+	for _, c := range cands[1:] {
+		for !strings.HasPrefix(c, common) {
+			_, n := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-n]
+		}
+	}
+	if len(common) > len(word) {
+		return escapeWord(common), false
+	}
+	return "", true
+}
+
+// shortNames 列出候选时只显示最后一级名字
+func shortNames(cands []string) []string {
+	names := make([]string, len(cands))
+	for i, c := range cands {
+		dir := strings.HasSuffix(c, "/")
+		c = strings.TrimSuffix(c, "/")
+		if i := strings.LastIndex(c, "/"); i >= 0 {
+			c = c[i+1:]
+		}
+		if dir {
+			c += "/"
+		}
+		names[i] = c
+	}
+	return names
+}
+
+// printColumns 把名字按列排成不超过 width 个字符宽的若干行，列优先排列，nl 是换行符
+func printColumns(w io.Writer, names []string, width int, nl string) {
+	if len(names) == 0 {
+		return
+	}
+	colw := 0
+	for _, n := range names {
+		colw = max(colw, utf8.RuneCountInString(n)+2)
+	}
+	cols := max(width/colw, 1)
+	rows := (len(names) + cols - 1) / cols
+	for r := 0; r < rows; r++ {
+		var b strings.Builder
+		for c := 0; c < cols; c++ {
+			i := c*rows + r
+			if i >= len(names) {
+				break
+			}
+			if c < cols-1 && i+rows < len(names) {
+				b.WriteString(fit(names[i], colw))
+			} else {
+				b.WriteString(names[i])
+			}
+		}
+		fmt.Fprint(w, b.String()+nl)
+	}
+}
+
+// shellWords 按 shell 的规则拆分一行：空白分隔，单引号内原样保留，双引号内和引号外的反斜杠转义下一个字符。
+// last 是最后一个词在 line 中的起始位置；line 为空或以空白结尾时 last 为 len(line)，words 中没有空的最后一个词。
+// 引号没有闭合时 err 不为 nil，words 和 last 仍按已经读到的内容给出，补全时使用
+func shellWords(line []rune) (words []string, last int, err error) {
+	var cur strings.Builder
+	in := false // 正在一个词中
+	var quote rune
+	last = len(line)
+	for i := 0; i < len(line); i++ {
+		r := line[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+			continue
+		case quote == '"':
+			switch {
+			case r == '"':
+				quote = 0
+			case r == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\'):
+				i++
+				cur.WriteRune(line[i])
+			default:
+				cur.WriteRune(r)
+			}
+			continue
+		case unicode.IsSpace(r):
+			if in {
+				words = append(words, cur.String())
+				cur.Reset()
+				in = false
+			}
+			continue
+		}
+		if !in {
+			in, last = true, i
+		}
+		switch r {
+		case '\'', '"':
+			quote = r
+		case '\\':
+			if i+1 < len(line) {
+				i++
+				cur.WriteRune(line[i])
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if in {
+		words = append(words, cur.String())
+	} else {
+		last = len(line)
+	}
+	if quote != 0 {
+		err = errors.New("unterminated quote")
+	}
+	return words, last, err
+}
+
+// escapeWord 转义 s 中的空白、引号和反斜杠，使 shellWords 把它还原为一个词
+func escapeWord(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsSpace(r) || strings.ContainsRune(`'"\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
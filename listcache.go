@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"wsbox/internal/clientstate"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：远程目录列表缓存 ---------- */
+
+// 交互式 shell 和 sync、pull 共用的远程目录列表缓存，条目是 /_list?format=long 的结果。
+// 缓存按服务端地址和token分开保存在状态目录的 listings.json 中：shell 结束时、sync 和 pull 遍历之后写回，
+// 之后的命令在 TTL 之内直接使用，不再逐层列出。只有 shell 默认使用缓存；sync 和 pull 按列表决定上传和删除，
+// 用过期的列表会漏掉其他客户端的修改，默认 -cache-ttl 0 每次完整列出。每个服务端最多保存 -cache-dirs 个目录，按最近使用淘汰。
+// 本进程自己做出的修改（上传、删除、创建目录）使涉及的目录失效，也从文件中删除；
+// 其他客户端的修改只能等 TTL 过期，shell 的 refresh 和 cd -f 立即重新列出
+
+// listCacheFile 是状态目录中保存目录列表的文件
+const listCacheFile = "listings.json"
+
+// 缓存的默认值，defaultListCacheTTL 是 shell 的，sync 和 pull 默认不用缓存
+const (
+	defaultListCacheTTL  = 30 * time.Second
+	defaultListCacheDirs = 256
+)
+
+// cachedListing 是缓存中的一个目录
+type cachedListing struct {
+	Entries   []client.ListEntry `json:"entries"`
+	Truncated bool               `json:"truncated,omitempty"`
+	Listed    time.Time          `json:"listed"` // 列出的时间，TTL 从这里算起
+	Used      time.Time          `json:"used"`   // 最近使用的时间，淘汰按它
+}
+
+// listCacheFlags 是 -cache-ttl 和 -cache-dirs
+type listCacheFlags struct {
+	ttl  *time.Duration
+	dirs *int
+}
+
+func (f *listCacheFlags) register(fs *flag.FlagSet, ttl time.Duration) {
+	f.ttl = fs.Duration("cache-ttl", ttl, "reuse remote directory listings younger than this, shared between shell, sync and pull (0 = always list)")
+	f.dirs = fs.Int("cache-dirs", defaultListCacheDirs, "keep at most this many cached directory listings per server")
+}
+
+// listCache 是一个服务端的目录缓存。nil 表示不使用缓存，各方法照常工作
+type listCache struct {
+	key     string
+	ttl     time.Duration
+	max     int
+	dirs    map[string]*cachedListing
+	dropped map[string]bool // 本进程使之失效的目录，保存时也从文件中删除；true 表示连同其下的整棵子树
+}
+
+// listCacheKey 是缓存中服务端的键：地址加上token的摘要，不同token（可能限定在不同子目录）看到的目录不共用
+func (c *clientCmd) listCacheKey() string {
+	token := c.token
+	if u, err := url.Parse(c.server); err == nil && token == "" && u.User != nil {
+		token = u.User.String()
+	}
+	sum := sha256.Sum256([]byte(token))
+	return c.historyKey() + "#" + hex.EncodeToString(sum[:6])
+}
+
+// openListCache 读取保存的目录列表，-cache-ttl 为 0 时返回 nil。状态目录不可用时从空缓存开始
+func (c *clientCmd) openListCache(f listCacheFlags) *listCache {
+	if *f.ttl <= 0 {
+		return nil
+	}
+	lc := &listCache{key: c.listCacheKey(), ttl: *f.ttl, max: max(*f.dirs, 1), dirs: map[string]*cachedListing{}, dropped: map[string]bool{}}
+	if st := openClientState(); st != nil {
+		all := map[string]map[string]*cachedListing{}
+		if st.ReadJSON(listCacheFile, &all) == nil {
+			for dir, l := range all[lc.key] {
+				if lc.fresh(l) {
+					lc.dirs[dir] = l
+				}
+			}
+		}
+	}
+	return lc
+}
+
+// openClientState 打开默认的状态目录，不可用时返回 nil
+func openClientState() *clientstate.Store {
+	dir, err := clientstate.DefaultDir()
+	if err != nil {
+		return nil
+	}
+	st, err := clientstate.Open(dir)
+	if err != nil {
+		return nil
+	}
+	return st
+}
+
+func (lc *listCache) fresh(l *cachedListing) bool {
+	return time.Since(l.Listed) < lc.ttl
+}
+
+// get 返回 dir 在 TTL 之内的列表
+func (lc *listCache) get(dir string) (*cachedListing, bool) {
+	if lc == nil {
+		return nil, false
+	}
+	l, ok := lc.dirs[dir]
+	if !ok || !lc.fresh(l) {
+		return nil, false
+	}
+	l.Used = time.Now().UTC()
+	return l, true
+}
+
+// put 记下 dir 刚列出的结果
+func (lc *listCache) put(dir string, res *client.LongListResult) {
+	if lc == nil {
+		return
+	}
+	now := time.Now().UTC()
+	// dropped 里的标记保留：保存时文件中的旧列表仍要去掉，这里的新列表比它新，合并时照样写入
+	lc.dirs[dir] = &cachedListing{Entries: res.Entries, Truncated: res.Truncated, Listed: now, Used: now}
+	lc.evict()
+}
+
+// list 返回 dir 的列表：force 为 false 且缓存中有未过期的结果时直接使用，否则向服务端列出并记下
+func (lc *listCache) list(cl *client.Client, dir string, force bool) (*client.LongListResult, error) {
+	if !force {
+		if l, ok := lc.get(dir); ok {
+			return &client.LongListResult{Entries: l.Entries, Truncated: l.Truncated}, nil
+		}
+	}
+	res, err := cl.ListLong(dir)
+	if err != nil {
+		return nil, err
+	}
+	lc.put(dir, res)
+	return res, nil
+}
+
+// drop 使 dir 以及其下所有目录的列表失效
+func (lc *listCache) drop(dir string) {
+	if lc == nil {
+		return
+	}
+	for d := range lc.dirs {
+		if d == dir || dir == "/" || strings.HasPrefix(d, dir+"/") {
+			delete(lc.dirs, d)
+		}
+	}
+	lc.dropped[dir] = true
+}
+
+// dropDir 只使 dir 本身的列表失效
+func (lc *listCache) dropDir(dir string) {
+	delete(lc.dirs, dir)
+	if !lc.dropped[dir] {
+		lc.dropped[dir] = false
+	}
+}
+
+// changed 使因为 p 被创建、修改或删除而可能变化的列表失效：p 之下的整棵子树、p 的上级目录，
+// 以及缓存中还没有下一级目录的祖先（上传和 mkdir 会创建缺少的上级目录）
+func (lc *listCache) changed(p string) {
+	if lc == nil {
+		return
+	}
+	lc.drop(p)
+	for child := p; child != "/"; child = path.Dir(child) {
+		dir := path.Dir(child)
+		l, ok := lc.dirs[dir]
+		if ok && child != p && hasDirEntry(l.Entries, path.Base(child)) {
+			break // 这一级原来就有，上面的目录没有变化
+		}
+		lc.dropDir(dir)
+	}
+}
+
+func hasDirEntry(entries []client.ListEntry, name string) bool {
+	for _, e := range entries {
+		if e.Dir && e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// evict 按最近使用淘汰超出上限的目录
+func (lc *listCache) evict() {
+	if len(lc.dirs) <= lc.max {
+		return
+	}
+	dirs := make([]string, 0, len(lc.dirs))
+	for d := range lc.dirs {
+		dirs = append(dirs, d)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return lc.dirs[dirs[i]].Used.Before(lc.dirs[dirs[j]].Used) })
+	for _, d := range dirs[:len(dirs)-lc.max] {
+		delete(lc.dirs, d)
+	}
+}
+
+// save 把缓存与状态文件合并后写回：本进程失效的目录从文件中删除，同一目录保留较新的列表，
+// 过期的条目丢弃，再按最近使用裁剪到上限。失败时静默放弃，缓存只影响速度
+func (lc *listCache) save() {
+	if lc == nil {
+		return
+	}
+	st := openClientState()
+	if st == nil {
+		return
+	}
+	all := map[string]map[string]*cachedListing{}
+	st.UpdateJSON(listCacheFile, &all, func() error {
+		merged := &listCache{ttl: lc.ttl, max: lc.max, dirs: map[string]*cachedListing{}}
+		for dir, l := range all[lc.key] {
+			if merged.fresh(l) && !lc.droppedUnder(dir) {
+				merged.dirs[dir] = l
+			}
+		}
+		for dir, l := range lc.dirs {
+			if old, ok := merged.dirs[dir]; !ok || old.Listed.Before(l.Listed) {
+				merged.dirs[dir] = l
+			}
+		}
+		merged.evict()
+		if len(merged.dirs) == 0 {
+			delete(all, lc.key)
+		} else {
+			all[lc.key] = merged.dirs
+		}
+		// 其他服务端过期的条目顺便清掉，文件不会无限增长
+		for key, dirs := range all {
+			for dir, l := range dirs {
+				if !merged.fresh(l) {
+					delete(dirs, dir)
+				}
+			}
+			if len(dirs) == 0 {
+				delete(all, key)
+			}
+		}
+		return nil
+	})
+}
+
+// droppedUnder 判断 dir 的列表是否被本进程失效：dir 本身失效，或在失效的子树之下
+func (lc *listCache) droppedUnder(dir string) bool {
+	for d, tree := range lc.dropped {
+		if d == dir || tree && (d == "/" || strings.HasPrefix(dir, d+"/")) {
+			return true
+		}
+	}
+	return false
+}
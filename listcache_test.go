@@ -0,0 +1,197 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"wsbox/pkg/client"
+)
+
+// newTestListCache 在临时状态目录中打开一个缓存
+func newTestListCache(t *testing.T, ttl time.Duration, dirs int) *listCache {
+	t.Helper()
+	c := &clientCmd{server: "ws://127.0.0.1:1/ws", token: "tok"}
+	return c.openListCache(listCacheFlags{ttl: &ttl, dirs: &dirs})
+}
+
+// listing 构造一个列表，名字以 / 结尾的是目录
+func listing(names ...string) *client.LongListResult {
+	res := &client.LongListResult{}
+	for _, n := range names {
+		if len(n) > 1 && n[len(n)-1] == '/' {
+			res.Entries = append(res.Entries, client.ListEntry{Name: n[:len(n)-1], Dir: true})
+		} else {
+			res.Entries = append(res.Entries, client.ListEntry{Name: n})
+		}
+	}
+	return res
+}
+
+func cachedDirs(lc *listCache) []string {
+	var dirs []string
+	for d := range lc.dirs {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+func TestListCacheTTL(t *testing.T) {
+	t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+	lc := newTestListCache(t, time.Minute, 10)
+	lc.put("/a", listing("x.txt", "y/"))
+	l, ok := lc.get("/a")
+	if !ok || len(l.Entries) != 2 {
+		t.Fatalf("get /a = %v, %v; want the stored listing", l, ok)
+	}
+	if _, ok := lc.get("/b"); ok {
+		t.Error("get /b hit a directory that was never listed")
+	}
+	lc.dirs["/a"].Listed = time.Now().Add(-2 * time.Minute)
+	if _, ok := lc.get("/a"); ok {
+		t.Error("get /a returned a listing older than the TTL")
+	}
+
+	if lc := newTestListCache(t, 0, 10); lc != nil {
+		t.Fatal("-cache-ttl 0 opened a cache")
+	}
+	// 关闭缓存时各方法照常可用
+	var nilCache *listCache
+	nilCache.put("/a", listing("x"))
+	nilCache.changed("/a/x")
+	nilCache.drop("/")
+	nilCache.save()
+	if _, ok := nilCache.get("/a"); ok {
+		t.Error("a nil cache returned a listing")
+	}
+}
+
+func TestListCacheEvict(t *testing.T) {
+	t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+	lc := newTestListCache(t, time.Minute, 2)
+	lc.put("/a", listing())
+	lc.put("/b", listing())
+	lc.dirs["/a"].Used = time.Now().Add(-time.Second)
+	lc.dirs["/b"].Used = time.Now().Add(-2 * time.Second)
+	lc.get("/b") // 最近使用过，不淘汰
+	lc.put("/c", listing())
+	if got := cachedDirs(lc); len(got) != 2 || got[0] != "/b" || got[1] != "/c" {
+		t.Errorf("after evicting: %v, want [/b /c]", got)
+	}
+}
+
+func TestListCacheChanged(t *testing.T) {
+	tests := []struct {
+		changed string
+		want    []string // 仍然缓存的目录
+	}{
+		// 文件变化：只有所在目录失效
+		{"/a/b/new.txt", []string{"/", "/a", "/x"}},
+		// 目录被删除：整棵子树和上级目录失效
+		{"/a/b", []string{"/", "/x"}},
+		// 上传到新的子目录：缺少下一级的祖先也失效，直到原来就有下一级的那一层
+		{"/a/c/d/e.txt", []string{"/", "/a/b", "/x"}},
+		{"/n/m.txt", []string{"/a", "/a/b", "/x"}},
+		{"/", nil},
+	}
+	for _, tt := range tests {
+		t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+		lc := newTestListCache(t, time.Minute, 10)
+		lc.put("/", listing("a/", "x/", "f.txt"))
+		lc.put("/a", listing("b/"))
+		lc.put("/a/b", listing("old.txt"))
+		lc.put("/x", listing())
+		lc.changed(tt.changed)
+		got := cachedDirs(lc)
+		if len(got) != len(tt.want) {
+			t.Errorf("changed(%s): cached %v, want %v", tt.changed, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("changed(%s): cached %v, want %v", tt.changed, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// 保存时与文件合并：其他进程保存的列表保留，本进程失效的目录从文件中删除，其他服务端的条目不受影响
+func TestListCacheSave(t *testing.T) {
+	t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+	first := newTestListCache(t, time.Minute, 10)
+	second := newTestListCache(t, time.Minute, 10)
+	other := (&clientCmd{server: "ws://127.0.0.1:1/ws", token: "other"}).openListCache(listCacheFlags{ttl: ptr(time.Minute), dirs: ptr(10)})
+	if first.key == other.key {
+		t.Fatal("different tokens share a cache key")
+	}
+
+	first.put("/", listing("a/", "b/"))
+	first.put("/a", listing("f.txt"))
+	first.put("/a/sub", listing())
+	first.put("/b", listing())
+	first.save()
+	other.put("/a", listing("secret.txt"))
+	other.save()
+
+	// second 在 first 保存之前打开，它删除 /a 后保存，不能把 first 的其他列表冲掉
+	second.put("/b", listing("g.txt"))
+	second.changed("/a")
+	second.save()
+
+	got := newTestListCache(t, time.Minute, 10)
+	if dirs := cachedDirs(got); len(dirs) != 1 || dirs[0] != "/b" {
+		t.Fatalf("after merging: cached %v, want [/b]", dirs)
+	}
+	if l, _ := got.get("/b"); len(l.Entries) != 1 {
+		t.Errorf("/b = %v, want the newer listing from the second process", l.Entries)
+	}
+	otherAgain := (&clientCmd{server: "ws://127.0.0.1:1/ws", token: "other"}).openListCache(listCacheFlags{ttl: ptr(time.Minute), dirs: ptr(10)})
+	if _, ok := otherAgain.get("/a"); !ok {
+		t.Error("saving one server's cache dropped another token's listing")
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// sync 默认不用缓存：一次没有变化的同步之后，由另一个进程删掉的远程文件会被下一次同步发现并重新上传。
+// 显式给了 -cache-ttl 时用缓存中的列表，发现不了（这正是默认关闭的原因）
+func TestSyncDefaultListsAfterOutsideChange(t *testing.T) {
+	t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+	url := startTestServer(t)
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "x.txt"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(src, "y.txt"), []byte("y"), 0o644)
+	client := func(args ...string) string {
+		t.Helper()
+		code, stdout, stderr := runWsbox(t, append([]string{"client", "-s", url, "-token", testToken}, args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit %d: %s", args, code, stderr)
+		}
+		return stdout
+	}
+	tests := []struct {
+		dst  string
+		ttl  string
+		want string
+	}{
+		{"/default", "", "1 files uploaded"},
+		{"/cached", "30s", "0 files uploaded"},
+	}
+	for _, tt := range tests {
+		args := []string{"sync", src, tt.dst}
+		if tt.ttl != "" {
+			args = []string{"sync", "-cache-ttl", tt.ttl, src, tt.dst}
+		}
+		client(args...)
+		client(args...) // 没有变化，缓存中留下 tt.dst 的列表
+		client("delete", tt.dst+"/x.txt")
+		if out := client(args...); !strings.Contains(out, tt.want) {
+			t.Errorf("-cache-ttl %q: sync after an outside delete printed %q, want %q", tt.ttl, out, tt.want)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"wsbox/internal/i18n"
+	"wsbox/internal/textfmt"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：list 命令 ---------- */
+
+// writeRecords 逐条输出记录，nul 为 true 时以NUL分隔（文件名中可能含有换行）
+func writeRecords(w io.Writer, records []string, nul bool) error {
+	bw := bufio.NewWriter(w)
+	sep := byte('\n')
+	if nul {
+		sep = 0
+	}
+	for _, r := range records {
+		bw.WriteString(r)
+		bw.WriteByte(sep)
+	}
+	return bw.Flush()
+}
+
+func (c *clientCmd) list(args []string) {
+	fs := newFlagSet("client list")
+	latest := fs.Int("latest", 0, "recursively list the N most recently modified files")
+	asJSON := fs.Bool("json", false, "print the raw result as JSON")
+	jsonl := fs.Bool("jsonl", false, "print one JSON value per entry and line as entries arrive")
+	nul := fs.Bool("0", false, "print bare entry names separated by NUL bytes (for xargs -0) instead of the tree")
+	long := fs.Bool("l", false, "long format: mode, size and modification time of each entry")
+	recursive := fs.Bool("R", false, "list the whole tree below dir in one request")
+	depth := fs.Int("depth", 0, "list the tree down to `n` levels below dir in one request (implies -R)")
+	rest := parseFlags(fs, args)
+	if (*nul && (*asJSON || *jsonl)) || (*asJSON && *jsonl) {
+		usageFail("-0, -json and -jsonl cannot be combined")
+	}
+	if *long && (*nul || *latest > 0) {
+		usageFail("-l cannot be combined with -0 or -latest")
+	}
+	if *depth < 0 {
+		usageFail("-depth must not be negative")
+	}
+	tree := *recursive || *depth > 0
+	if tree && (*long || *latest > 0) {
+		usageFail("-R and -depth cannot be combined with -l or -latest")
+	}
+	if tree && *nul {
+		// 树状显示面向人阅读；脚本需要整棵树的路径时用 -jsonl 或 find -0
+		usageFail("-R and -depth cannot be combined with -0; use -jsonl, or find -0 <dir> '*' for NUL-separated paths")
+	}
+	if c.json && (*jsonl || *nul) {
+		usageFail("the global -json cannot be combined with -jsonl or -0")
+	}
+	*asJSON = *asJSON || c.json
+	dir := "/"
+	if len(rest) > 0 {
+		dir = rest[0]
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	defer c.noteCanonical(cl, dir)
+
+	if tree {
+		c.printTree(cl, dir, *depth, *asJSON, *jsonl)
+		return
+	}
+	if c.json && *latest == 0 {
+		c.printEntries(cl, dir)
+		return
+	}
+	// 长格式需要 stat 每个条目并排序，以完整响应返回
+	if *long {
+		c.printLongList(cl, dir, *asJSON, *jsonl)
+		return
+	}
+	// 目录列表以流式请求，服务端边读边发；最新文件要遍历完才能确定，仍是完整响应
+	if *latest == 0 {
+		if err := c.printListStream(cl, dir, *asJSON, *jsonl, *nul); err != nil {
+			c.fail(err)
+		}
+		return
+	}
+	res, err := cl.Latest(dir, *latest)
+	if err != nil {
+		c.fail(err)
+	}
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(res)
+		return
+	}
+	switch {
+	case *jsonl:
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range res.Entries {
+			enc.Encode(e)
+		}
+	case *nul:
+		// 表格面向人阅读，-0 只输出原始路径，截断警告写到stderr
+		var names []string
+		for _, e := range res.Entries {
+			names = append(names, e.Path)
+		}
+		writeRecords(os.Stdout, names, true)
+	default:
+		t := textfmt.NewTable(os.Stdout, textfmt.Left, textfmt.Right)
+		for _, e := range res.Entries {
+			t.Row(c.format.Time(e.ModTime), c.format.Size(e.Size), e.Path)
+		}
+		t.Flush()
+		if res.Warning != nil {
+			fmt.Println(i18n.T("list.truncated", res.Warning.Message))
+		}
+	}
+	if res.Warning != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("list.incomplete", res.Warning.Message))
+	}
+}
+
+// printLongList 实现 list -l：树状显示每个条目的权限、大小和修改时间，大小列右对齐
+func (c *clientCmd) printLongList(cl *client.Client, dir string, asJSON, jsonl bool) {
+	res, err := cl.ListLong(dir)
+	if err != nil {
+		c.fail(err)
+	}
+	switch {
+	case asJSON:
+		json.NewEncoder(os.Stdout).Encode(res)
+	case jsonl:
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range res.Entries {
+			enc.Encode(e)
+		}
+	default:
+		displayLongTree(res.Entries, dir, c.format)
+		if res.Warning != nil {
+			fmt.Println(i18n.T("list.truncated", res.Warning.Message))
+		}
+	}
+	if res.Warning != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("list.incomplete", res.Warning.Message))
+	}
+}
+
+// printEntries 实现全局 -json 的 list：输出带权限、大小和修改时间的条目数组（结构见 "wsbox schema list-entries"），
+// 结果被截断时在 stderr 上警告
+func (c *clientCmd) printEntries(cl *client.Client, dir string) {
+	res, err := cl.ListLong(dir)
+	if err != nil {
+		c.fail(err)
+	}
+	entries := res.Entries
+	if entries == nil {
+		entries = []client.ListEntry{}
+	}
+	printJSON(entries)
+	if res.Warning != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("list.incomplete", res.Warning.Message))
+	}
+}
+
+// printTree 实现 list -R 和 list -depth：一次请求取得整棵树，树状显示，-json 输出原始结果，-jsonl 每行一个条目对象。
+// 不接受 -0（见 list）
+func (c *clientCmd) printTree(cl *client.Client, dir string, depth int, asJSON, jsonl bool) {
+	res, err := cl.Tree(dir, depth)
+	if err != nil {
+		c.fail(err)
+	}
+	switch {
+	case asJSON:
+		json.NewEncoder(os.Stdout).Encode(res)
+	case jsonl:
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range res.Entries {
+			enc.Encode(e)
+		}
+	default:
+		paths := make([]string, len(res.Entries))
+		for i, e := range res.Entries {
+			paths[i] = e.Path
+			if e.Dir {
+				paths[i] += "/"
+			}
+		}
+		displayTree(paths, dir)
+		if res.Warning != nil {
+			fmt.Println(i18n.T("list.truncated", res.Warning.Message))
+		}
+	}
+	if res.Warning != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("list.incomplete", res.Warning.Message))
+	}
+}
+
+// printListStream 边接收边输出流式列表。-json 逐步写出与 client.ListResult 相同结构的对象，
+// -jsonl 每行一个条目名，-0 以NUL分隔；树状显示需要排序，整个目录收完后再输出，期间在终端上显示计数
+func (c *clientCmd) printListStream(cl *client.Client, dir string, asJSON, jsonl, nul bool) error {
+	ls, err := cl.OpenList(dir)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	tree := !asJSON && !jsonl && !nul
+	var names []string
+	var line progressLine
+	if asJSON {
+		fmt.Fprintf(out, `{"schema_version":%d,"entries":[`, ls.Header.SchemaVersion)
+	}
+	count := 0
+	for {
+		batch, more, err := ls.Next()
+		if err != nil {
+			line.Clear()
+			return err
+		}
+		if !more {
+			break
+		}
+		for _, n := range batch {
+			switch {
+			case asJSON:
+				if count > 0 {
+					out.WriteByte(',')
+				}
+				b, _ := json.Marshal(n)
+				out.Write(b)
+			case jsonl:
+				b, _ := json.Marshal(n)
+				out.Write(b)
+				out.WriteByte('\n')
+			case nul:
+				out.WriteString(n)
+				out.WriteByte(0)
+			default:
+				names = append(names, n)
+			}
+			count++
+		}
+		if tree {
+			line.Show("listing", int64(count))
+		} else if err := out.Flush(); err != nil {
+			return err
+		}
+	}
+	line.Clear()
+
+	warning := ls.Summary.Warning
+	switch {
+	case asJSON:
+		fmt.Fprintf(out, `],"truncated":%s`, strconv.FormatBool(ls.Summary.Truncated))
+		if warning != nil {
+			b, _ := json.Marshal(warning)
+			fmt.Fprintf(out, `,"warning":%s`, b)
+		}
+		out.WriteString("}\n")
+		return nil
+	case tree:
+		sort.Strings(names)
+		out.Flush()
+		displayTree(names, dir)
+		if warning != nil {
+			fmt.Println(i18n.T("list.truncated", warning.Message))
+		}
+	}
+	if warning != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("list.incomplete", warning.Message))
+	}
+	return nil
+}
+
+/* ---------- 客户端：counts 命令 ---------- */
+
+// counts 显示服务端统计的条目最多的目录，用于发现条目过多、拖慢列表的目录
+func (c *clientCmd) counts(args []string) {
+	fs := newFlagSet("client counts")
+	n := fs.Int("n", 20, "number of directories to show")
+	asJSON := fs.Bool("json", false, "print the raw result as JSON")
+	parseFlags(fs, args)
+	if *n <= 0 {
+		usageFail("-n must be positive")
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	res, err := cl.DirCounts(*n)
+	if err != nil {
+		c.fail(err)
+	}
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(res)
+		return
+	}
+	t := textfmt.NewTable(os.Stdout, textfmt.Right, textfmt.Left)
+	for _, e := range res.Entries {
+		t.Row(strconv.Itoa(e.Count), e.Dir)
+	}
+	t.Flush()
+	if res.Passes == 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("counts.first_scan", res.Dirs))
+	} else {
+		fmt.Fprintln(os.Stderr, i18n.T("counts.summary", res.Dirs, c.format.Time(res.ReconciledAt)))
+	}
+}
+
+/* ---------- 客户端：du 命令 ---------- */
+
+// du 显示目录下每个直接条目递归占用的大小和合计，与 "du -sh *" 相当。
+// 默认显示精确字节数，-h 使用 1.4M 形式；目录名以 "/" 结尾
+func (c *clientCmd) du(args []string) {
+	fs := newFlagSet("client du")
+	human := fs.Bool("h", false, "show sizes in human-readable units such as 1.4M")
+	asJSON := fs.Bool("json", false, "print the raw result as JSON")
+	rest := parseFlags(fs, args)
+	dir := "/"
+	if len(rest) > 0 {
+		dir = rest[0]
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	res, err := cl.Du(dir)
+	if err != nil {
+		c.fail(err)
+	}
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(res)
+	} else {
+		size := func(n int64) string { return strconv.FormatInt(n, 10) }
+		if *human {
+			size = textfmt.Size
+		}
+		t := textfmt.NewTable(os.Stdout, textfmt.Right, textfmt.Left)
+		for _, e := range res.Entries {
+			name := e.Name
+			if e.Dir {
+				name += "/"
+			}
+			t.Row(size(e.Size), name)
+		}
+		t.Row(size(res.Total), "total")
+		t.Flush()
+		if res.Warning != nil {
+			fmt.Println(i18n.T("list.truncated", res.Warning.Message))
+		}
+	}
+	if res.Warning != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("du.incomplete", res.Warning.Message))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"wsbox/pkg/server"
+)
+
+// 名字中含换行的文件经 list -0、find -0 和 get -files-from - -0 往返，名字和内容都不变
+func TestNulSeparatedEndToEnd(t *testing.T) {
+	t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+	sandbox := t.TempDir()
+	url := startTestServerConfig(t, server.Config{Dir: sandbox})
+	names := []string{"two\nlines.txt", "plain.txt", "trailing\n"}
+	os.MkdirAll(filepath.Join(sandbox, "logs", "sub\ndir"), 0o755)
+	for _, n := range names {
+		os.WriteFile(filepath.Join(sandbox, "logs", n), []byte("content of "+n), 0o644)
+	}
+	os.WriteFile(filepath.Join(sandbox, "logs", "sub\ndir", "deep\n.log"), []byte("deep"), 0o644)
+	run := func(stdin string, args ...string) string {
+		t.Helper()
+		code, stdout, stderr := runWsboxStdin(t, stdin, append([]string{"client", "-s", url, "-token", testToken}, args...)...)
+		if code != 0 {
+			t.Fatalf("%q: exit %d: %s", args, code, stderr)
+		}
+		return stdout
+	}
+	records := func(out string) []string {
+		t.Helper()
+		if !strings.HasSuffix(out, "\x00") {
+			t.Fatalf("output %q does not end with a NUL", out)
+		}
+		r := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+		slices.Sort(r)
+		return r
+	}
+
+	want := []string{"plain.txt", "sub\ndir/", "trailing\n", "two\nlines.txt"}
+	if got := records(run("", "list", "-0", "/logs")); !slices.Equal(got, want) {
+		t.Errorf("list -0 = %q, want %q", got, want)
+	}
+
+	found := run("", "find", "-0", "-type", "f", "/", "*")
+	want = []string{"/logs/plain.txt", "/logs/sub\ndir/deep\n.log", "/logs/trailing\n", "/logs/two\nlines.txt"}
+	if got := records(found); !slices.Equal(got, want) {
+		t.Fatalf("find -0 = %q, want %q", got, want)
+	}
+
+	local := t.TempDir()
+	run(found, "get", "-files-from", "-", "-0", "/", local)
+	for _, rel := range want {
+		src, _ := os.ReadFile(filepath.Join(sandbox, filepath.FromSlash(rel)))
+		got, err := os.ReadFile(filepath.Join(local, filepath.FromSlash(rel)))
+		if err != nil || string(got) != string(src) {
+			t.Errorf("get -files-from: %q = %q, %v; want %q", rel, got, err, src)
+		}
+	}
+}
+
+// -R 和 -depth 是树状显示，不接受 -0；-files-from 中写出本地目录的路径计为失败
+func TestNulSeparatedRefusals(t *testing.T) {
+	t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+	url := startTestServer(t)
+	for _, args := range [][]string{{"list", "-R", "-0", "/"}, {"list", "-depth", "2", "-0", "/"}, {"get", "-0", "/a", "b"}} {
+		code, stdout, stderr := runWsbox(t, append([]string{"client", "-s", url, "-token", testToken}, args...)...)
+		if code != exitUsage || stdout != "" || !strings.Contains(stderr, "-0") {
+			t.Errorf("%q: exit %d, stdout %q, stderr %q; want a usage error about -0", args, code, stdout, stderr)
+		}
+	}
+
+	local := t.TempDir()
+	code, _, stderr := runWsboxStdin(t, "../escape\x00", "client", "-s", url, "-token", testToken, "get", "-files-from", "-", "-0", "/", filepath.Join(local, "out"))
+	if code == 0 || !strings.Contains(stderr, "invalid entry name") {
+		t.Errorf("get -files-from with ..: exit %d, stderr %q; want the record reported as failed", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(local, "escape")); err == nil {
+		t.Error("get -files-from wrote outside the local directory")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/internal/textfmt"
+)
+
+/* ---------- 客户端：lock 命令 ---------- */
+
+func (c *clientCmd) lock(args []string) {
+	host, _ := os.Hostname()
+	fs := newFlagSet("client lock")
+	ttl := fs.Duration("ttl", 10*time.Minute, "with acquire, how long the lock stays valid")
+	holder := fs.String("holder", host, "label identifying the lock holder")
+	args = parseFlags(fs, args)
+	if len(args) < 1 {
+		printUsage("client lock")
+		os.Exit(exitUsage)
+	}
+	rest := args[1:]
+
+	switch args[0] {
+	case "acquire", "release":
+		if len(rest) < 1 {
+			usageFail(i18n.T("usage.missing_remote"))
+		}
+		remote := rest[0]
+		if !strings.HasPrefix(remote, "/") {
+			remote = "/" + remote
+		}
+
+		cl := c.dial()
+		defer cl.Close()
+		if args[0] == "acquire" {
+			if _, err := cl.Lock(remote, *holder, *ttl); err != nil {
+				c.fail(err)
+			}
+			fmt.Printf("lock acquired: %s (holder %s, ttl %s)\n", remote, *holder, textfmt.Duration(*ttl))
+		} else {
+			if err := cl.Unlock(remote, *holder); err != nil {
+				c.fail(err)
+			}
+			fmt.Println("lock released:", remote)
+		}
+
+	case "list":
+		dir := "/"
+		if len(rest) > 0 {
+			dir = rest[0]
+		}
+		cl := c.dial()
+		defer cl.Close()
+		locks, err := cl.Locks(dir)
+		if err != nil {
+			c.fail(err)
+		}
+		t := textfmt.NewTable(os.Stdout)
+		t.Row("PATH", "HOLDER", "ACQUIRED", "TTL", "STATE")
+		for _, l := range locks {
+			state := "active"
+			if l.Expired() {
+				state = "expired"
+			}
+			t.Row(l.Path, l.Holder, c.format.Time(l.AcquiredAt), textfmt.Duration(time.Duration(l.TTL)*time.Second), state)
+		}
+		t.Flush()
+
+	default:
+		usageFail(fmt.Sprintf("unknown lock command %q", args[0]))
+	}
+}
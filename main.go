@@ -1,617 +1,1036 @@
 package main
 
 import (
-	"bytes"
-	"crypto/rand"
-	"encoding/hex"
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"wsbox/internal/clientconfig"
+	"wsbox/internal/i18n"
+	"wsbox/internal/protocol"
+	"wsbox/internal/textfmt"
+	"wsbox/pkg/client"
+	"wsbox/pkg/server"
 )
 
-const helpText = `wsbox [command] [flags]
-
-Commands:
-  server    启动文件服务器
-  client    连接到服务器进行文件操作
-  help      显示帮助信息
-
-Server Usage:
-  wsbox server [flags]
-
-Server Flags:
-  -addr string    服务器监听地址 (默认 ":8080")
-  -dir string     文件存储目录 (默认 ".")
-  -token string   访问Token (留空自动生成)
-
-Client Usage:
-  wsbox client [flags] <command> [args...]
-
-Client Flags:
-  -s string    WebSocket服务器地址 (默认 "ws://127.0.0.1:8080/ws")
-
-Client Commands:
-  list [dir]              列出目录内容（树状结构）
-  add <local> [remote]    上传文件到服务器
-  get <remote> [local]    从服务器下载文件
-
-Examples:
-  wsbox server -addr :8080 -dir ./files -token mysecret
-  wsbox client -s ws://token@server:8080/ws list
-  wsbox client -s ws://token@server:8080/ws add file.txt uploads/file.txt
-`
-
-/* ---------- 日志辅助 ---------- */
-func logEvent(ip, action, event string) {
-	fmt.Printf("[%s][%s][%s][%s]\n", ip, action, time.Now().Format("2006-01-02 15:04:05"), event)
+/* ---------- 客户端 ---------- */
+type clientCmd struct {
+	server  string
+	token   string          // 按 -token、-token-file、$WSBOX_TOKEN、profile 的顺序决定，为空时使用地址中的token
+	format  textfmt.Options // 人类可读输出的格式，JSON输出不受影响
+	verbose bool            // 向stderr输出协商参数与传输统计
+
+	insecure bool   // 不校验服务端证书
+	caCert   string // 额外信任的CA证书文件
+
+	mtimeSlack time.Duration // 比较修改时间时视为相同的差距，远程时间已按时钟偏差换算
+
+	metadata   map[string]string // 传输命令的 -header，dial 时交给连接
+	verify     bool              // 传输命令的 SHA-256 校验（-no-verify 关闭）
+	force      bool              // add -f：在不允许覆盖的服务端上也替换已有文件
+	noPreserve bool              // add、get 和 sync 的 -no-preserve：不保留修改时间和权限
+	progress   string            // 传输进度的显示方式，空表示不显示（见 registerProgress）
+	transfer   *transferProgress // 单个文件的 add/get 在 dial 之前设置，显示这次传输的进度
+	stdoutData bool              // get - 把文件内容写到 stdout，状态和进度只能写到 stderr
+	json       bool              // 全局 -json：stdout 上只输出一个 JSON 文档（见 jsonout.go）
+	bwLimit    int64             // 全局 -bwlimit：每秒最多传输的正文字节数，0表示不限
+	maxMessage int64             // 全局 -max-message-size：从服务端读取的单帧上限，0表示不限
+	timeouts   clientTimeouts    // 全局 -connect-timeout、-op-timeout 和 -transfer-stall-timeout
+	proxy      *url.URL          // 全局 -proxy，nil 时按环境变量选择代理
+	parallel   *int              // 传输命令的 -P，大于1时 connect 请求同样多的流水线（见 registerParallel）
+	retries    int               // 传输命令的 -retries，见 retry.go
+	retryDelay time.Duration     // 传输命令的 -retry-delay
+	globals    []string          // 命令行上 "client" 之后、子命令之前的全局标志，cron 启动子进程时原样传递
+
+	config  *clientconfig.Config  // 读到的配置文件，没有时为 nil
+	profile *clientconfig.Profile // 选中的 profile，没有时为 nil
 }
 
-/* ---------- 服务端 ---------- */
-type serverCmd struct {
-	addr  string
-	dir   string
-	token string
+func (c *clientCmd) run(args []string) {
+	dispatch("client", c.commands(), args)
 }
 
-func (s *serverCmd) run() {
-	if s.token == "" {
-		b := make([]byte, 16)
-		rand.Read(b)
-		s.token = hex.EncodeToString(b)
+// parseFlags 解析子命令参数，允许标志出现在位置参数之后（如 "lock acquire a.txt -ttl 5m"）
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...)
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
-	fmt.Println("=== wsbox ===")
-	fmt.Printf("sandbox: %s\n", s.dir)
-	fmt.Printf("fixed token: %s\n", s.token)
-
-	localMux := http.NewServeMux()
-	localMux.HandleFunc("/", s.localHandler)
-	localLn, _ := net.Listen("tcp", "127.0.0.1:0")
-	go http.Serve(localLn, localMux)
-	localURL := "http://" + localLn.Addr().String()
-	log.Printf("local file server @ %s", localURL)
-
-	gwMux := http.NewServeMux()
-	gwMux.HandleFunc("/ws", s.gatewayHandler(localURL))
-	log.Printf("gateway websocket @ %s", s.addr)
-	log.Fatal(http.ListenAndServe(s.addr, gwMux))
 }
 
-/* ---------- 服务端：本地文件处理（带日志） ---------- */
-func (s *serverCmd) localHandler(w http.ResponseWriter, r *http.Request) {
-	clientIP := r.RemoteAddr
-	path := r.URL.Path
-
-	switch r.Method {
-	case "GET":
-		if path == "/_list" {
-			dir := r.URL.Query().Get("dir")
-			if dir == "" {
-				dir = "/"
-			}
-
-			// 安全路径验证
-			real, err := securePath(dir, s.dir)
-			if err != nil {
-				logEvent(clientIP, "LIST", "invalid path: "+err.Error())
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			// 检查目录是否存在
-			stat, err := os.Stat(real)
-			if err != nil {
-				if os.IsNotExist(err) {
-					logEvent(clientIP, "LIST", "directory not found: "+dir)
-					http.Error(w, "directory not found", http.StatusNotFound)
-				} else {
-					logEvent(clientIP, "LIST", "stat failed: "+err.Error())
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-				}
-				return
-			}
-
-			// 确保是目录
-			if !stat.IsDir() {
-				logEvent(clientIP, "LIST", "not a directory: "+dir)
-				http.Error(w, "not a directory", http.StatusBadRequest)
-				return
-			}
-
-			entries, err := os.ReadDir(real)
-			if err != nil {
-				logEvent(clientIP, "LIST", "read dir failed: "+err.Error())
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+// connect 建立连接并请求流控窗口、分块上传和进度帧，失败时返回错误而不是退出进程
+func (c *clientCmd) connect(ctx context.Context) (*client.Client, error) {
+	opts, err := c.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.Progress = &progressLine{}
+	if c.transfer != nil {
+		opts.Transfer = c.transfer
+	}
+	if c.parallel != nil && *c.parallel > 1 {
+		opts.Pipeline = *c.parallel
+	}
+	cl, err := client.DialContext(ctx, c.server, c.token, opts)
+	return cl, c.explainDial(err)
+}
 
-			var names []string
-			for _, e := range entries {
-				n := e.Name()
-				if e.IsDir() {
-					n += "/"
-				}
-				names = append(names, n)
-			}
-			logEvent(clientIP, "LIST", fmt.Sprintf("dir=%s count=%d", dir, len(names)))
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(names)
-			return
-		}
+// dialOptions 返回由全局标志决定的连接选项：证书、代理、超时和带宽限制
+func (c *clientCmd) dialOptions() (client.Options, error) {
+	cfg, err := c.tlsConfig()
+	if err != nil {
+		return client.Options{}, fmt.Errorf("-cacert: %w", err)
+	}
+	opts := client.Options{TLSConfig: cfg, BandwidthLimit: c.bwLimit, MaxMessageSize: c.maxMessage}
+	if c.proxy != nil {
+		opts.Proxy = http.ProxyURL(c.proxy)
+	}
+	c.timeouts.apply(&opts)
+	return opts, nil
+}
 
-		// 下载
-		real, err := securePath(path, s.dir)
-		if err != nil {
-			logEvent(clientIP, "DOWNLOAD", "invalid path: "+err.Error())
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		fi, err := os.Stat(real)
-		if err != nil || fi.IsDir() {
-			logEvent(clientIP, "DOWNLOAD", "file not found: "+path)
-			http.Error(w, "not found", http.StatusNotFound)
-			return
+// explainDial 在网关因为token拒绝连接时说明原因：没有任何token时列出提供token的方式。
+// 原来的 HandshakeError 仍然可以用 errors.As 取得
+func (c *clientCmd) explainDial(err error) error {
+	var he *client.HandshakeError
+	if !errors.As(err, &he) || he.StatusCode != http.StatusUnauthorized {
+		return err
+	}
+	if c.token == "" {
+		if u, perr := url.Parse(c.server); perr == nil && u.User == nil {
+			return fmt.Errorf("%s: %w", i18n.T("status.token_required"), err)
 		}
-		logEvent(clientIP, "DOWNLOAD", "file: "+path)
-		w.Header().Set("Content-Disposition", `attachment; filename=`+strconv.Quote(filepath.Base(real)))
-		http.ServeFile(w, r, real)
+	}
+	return fmt.Errorf("%s: %w", i18n.T("status.token_rejected"), err)
+}
 
-	case "POST":
-		real, err := securePath(path, s.dir)
-		if err != nil {
-			logEvent(clientIP, "UPLOAD", "invalid path: "+err.Error())
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+// dial 建立连接，失败时按 -retries 重试，仍然失败时退出进程；-v 时输出服务端同意的参数
+func (c *clientCmd) dial() *client.Client {
+	cl, err := c.connect(context.Background())
+	for attempt := 1; err != nil && c.backoff(attempt, err); attempt++ {
+		cl, err = c.connect(context.Background())
+	}
+	if err != nil {
+		c.failWith(i18n.T("status.dial_failed", describeErr(err)), err, dialExitCode(err))
+	}
+	if len(c.metadata) > 0 {
+		if err := c.applyMetadata(cl); err != nil {
+			c.failWith(i18n.T("status.metadata_failed", describeErr(err)), err, exitCode(err))
 		}
-
-		// 安全检查：验证目录创建的安全性
-		if err := s.secureCreateDir(filepath.Dir(real), s.dir, clientIP); err != nil {
-			logEvent(clientIP, "UPLOAD", "secure mkdir failed: "+err.Error())
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+	}
+	cl.SetOverwrite(c.force)
+	if err := cl.SetPreserve(!c.noPreserve); err != nil {
+		c.failWith(i18n.T("status.dial_failed", describeErr(err)), err, exitCode(err))
+	}
+	if c.verify {
+		if err := cl.SetVerify(true); errors.Is(err, client.ErrVerifyUnsupported) {
+			fmt.Fprintln(os.Stderr, i18n.T("status.verify_unsupported"))
+		} else if err != nil {
+			c.failWith(i18n.T("status.dial_failed", describeErr(err)), err, exitCode(err))
 		}
-
-		f, err := os.Create(real)
-		if err != nil {
-			logEvent(clientIP, "UPLOAD", "create file failed: "+err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	}
+	if c.verbose {
+		if w := cl.Window(); w > 0 {
+			fmt.Fprintln(os.Stderr, i18n.T("status.flow_window", w, textfmt.Size(protocol.FlowChunkSize), client.FlowWindow))
+		} else {
+			fmt.Fprintln(os.Stderr, i18n.T("status.flow_unsupported"))
 		}
-		n, err := io.Copy(f, r.Body)
-		f.Close()
-		if err != nil {
-			logEvent(clientIP, "UPLOAD", "write body failed: "+err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if cl.Streaming() {
+			fmt.Fprintln(os.Stderr, i18n.T("status.stream_chunks", textfmt.Size(protocol.StreamChunkSize)))
+		} else {
+			fmt.Fprintln(os.Stderr, i18n.T("status.stream_unsupported"))
 		}
-		logEvent(clientIP, "UPLOAD", fmt.Sprintf("file=%s size=%d", path, n))
-		w.WriteHeader(http.StatusCreated)
-		fmt.Fprintln(w, "ok")
-
-	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
+	return cl
 }
 
-/* ---------- 服务端：网关 ---------- */
-var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
-
-func (s *serverCmd) gatewayHandler(local string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("Authorization") != "Bearer "+s.token {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			return
-		}
-		defer conn.Close()
-
-		for {
-			msgType, payload, err := conn.ReadMessage()
-			if err != nil {
-				return
-			}
-
-			// 处理文本消息（请求头）
-			if msgType == websocket.TextMessage {
-				parts := strings.SplitN(string(payload), " ", 3)
-				if len(parts) < 2 {
-					continue
-				}
-				method, path := parts[0], parts[1]
-				var body io.Reader
-
-				// 对于POST请求，需要等待下一个二进制消息作为请求体
-				if method == "POST" {
-					// 读取文件数据
-					_, fileData, err := conn.ReadMessage()
-					if err != nil {
-						conn.WriteMessage(websocket.TextMessage, []byte("ERR "+err.Error()))
-						continue
-					}
-					// 使用bytes.NewReader来保持二进制数据完整性
-					body = bytes.NewReader(fileData)
-				} else if len(parts) == 3 {
-					body = strings.NewReader(parts[2])
-				}
+// describeErr 把客户端库返回的错误转换为本地化的提示
+func describeErr(err error) string {
+	var re *client.RemoteError
+	var le *client.LocalReadError
+	var pe *client.PreallocError
+	var de *client.DigestError
+	var te *client.TooLargeError
+	var to *client.TimeoutError
+	var pxe *client.ProxyError
+	switch {
+	case errors.As(err, &to):
+		return describeTimeout(to)
+	case errors.As(err, &pxe) && pxe.Reason != "":
+		return i18n.T("status.proxy_refused", pxe.Proxy, pxe.Reason)
+	case errors.As(err, &pxe):
+		return i18n.T("status.proxy_failed", pxe.Proxy, pxe.Err)
+	case client.IsTokenRevoked(err):
+		return i18n.T("status.token_revoked")
+	case client.IsServerShutdown(err):
+		return i18n.T("status.shutdown")
+	case client.IsMessageTooBig(err):
+		return i18n.T("status.message_too_big")
+	case client.IsResponseTooBig(err):
+		return i18n.T("status.response_too_big")
+	case client.IsReadOnly(err):
+		return i18n.T("status.read_only")
+	case client.IsExists(err):
+		return i18n.T("status.exists")
+	case client.IsBusy(err):
+		return i18n.T("status.busy")
+	case errors.As(err, &te) && te.Limit > 0:
+		return i18n.T("status.too_large", textfmt.Size(te.Limit))
+	case errors.As(err, &re):
+		return i18n.T("status.remote_error", re.Status, re.Message())
+	case errors.As(err, &le):
+		return i18n.T("status.read_failed", le.Err)
+	case errors.As(err, &pe):
+		return i18n.T("status.prealloc_failed", pe.Size, pe.Err)
+	case errors.As(err, &de):
+		return i18n.T("status.digest_mismatch", de.Path, de.Want, de.Got)
+	}
+	return err.Error()
+}
 
-				req, err := http.NewRequest(method, local+path, body)
-				if err != nil {
-					conn.WriteMessage(websocket.TextMessage, []byte("ERR "+err.Error()))
-					continue
-				}
-				resp, err := http.DefaultClient.Do(req)
-				if err != nil || resp == nil {
-					conn.WriteMessage(websocket.TextMessage, []byte("ERR "+err.Error()))
-					continue
-				}
-				b, _ := io.ReadAll(resp.Body)
-				resp.Body.Close()
+// noteCanonical 在请求经过服务端的路径别名时提示规范路径，保存了旧路径的脚本应当更新
+func (c *clientCmd) noteCanonical(cl *client.Client, remote string) {
+	if p := cl.CanonicalPath(); p != "" {
+		fmt.Fprintln(os.Stderr, i18n.T("status.aliased", remote, p))
+	}
+}
 
-				// 统一协议：分两次发——状态头 + 正文
-				header := fmt.Sprintf("%d %d", resp.StatusCode, len(b))
-				conn.WriteMessage(websocket.TextMessage, []byte(header))
-				conn.WriteMessage(websocket.BinaryMessage, b)
-			}
-		}
+// reportTransfer 在 -v 时输出一次传输的统计
+func (c *clientCmd) reportTransfer(cl *client.Client, st client.TransferStats) {
+	switch {
+	case !c.verbose:
+	case st.Extents > 0:
+		fmt.Fprintln(os.Stderr, i18n.T("status.sparse_stats", st.Extents, c.format.Size(st.Bytes), c.format.Size(st.Size)))
+	case cl.Window() > 0:
+		fmt.Fprintln(os.Stderr, i18n.T("status.recv_stats", c.format.Size(st.Bytes), st.Chunks, st.Acks))
+	}
+	if c.verbose && st.Verified {
+		fmt.Fprintln(os.Stderr, i18n.T("status.verified"))
 	}
 }
 
-/* ---------- 客户端 ---------- */
-type clientCmd struct {
-	server string
+// reportResume 说明这次下载是从上次中断处续传的
+func (c *clientCmd) reportResume(st client.TransferStats) {
+	if st.Resumed > 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("status.download_resumed", c.format.Size(st.Resumed), c.format.Size(st.Size)))
+	}
 }
 
-func (c *clientCmd) run(args []string) {
-	if len(args) < 1 {
-		fmt.Print(helpText)
-		os.Exit(1)
+// displayTree 以树状结构显示文件列表。paths 是相对 dirName 的路径，按先序排列（每个目录紧跟着它的内容），
+// 目录以 "/" 结尾；单层列表就是只有一层的情况。每一行只显示最后一级名字，用 │ 连接尚有后续兄弟的上级
+func displayTree(paths []string, dirName string) {
+	if dirName == "/" {
+		dirName = "root"
 	}
-	cmd := args[0]
-	switch cmd {
-	case "list":
-		dir := "/"
-		if len(args) > 1 {
-			dir = args[1]
-		}
-		c.list(dir)
-	case "add":
-		if len(args) < 2 {
-			fmt.Fprint(os.Stderr, "missing local-file\n")
-			os.Exit(1)
+	fmt.Printf("%s/\n", dirName)
+
+	depths := make([]int, len(paths))
+	for i, p := range paths {
+		depths[i] = strings.Count(strings.TrimSuffix(p, "/"), "/") + 1
+	}
+	// 倒序扫描：某一层在后面还有兄弟（中间没有更浅的条目）时，该条目不是最后一个
+	last := make([]bool, len(paths))
+	more := map[int]bool{}
+	for i := len(paths) - 1; i >= 0; i-- {
+		d := depths[i]
+		last[i] = !more[d]
+		more[d] = true
+		for k := range more {
+			if k > d {
+				delete(more, k)
+			}
 		}
-		local := args[1]
-		remote := filepath.Base(local)
-		if len(args) > 2 {
-			remote = args[2]
+	}
+
+	var open []bool // open[k] 表示第 k+1 层的上级还有后续兄弟，需要画 │
+	for i, p := range paths {
+		d := depths[i]
+		open = open[:d-1]
+		var b strings.Builder
+		for _, o := range open {
+			if o {
+				b.WriteString("│  ")
+			} else {
+				b.WriteString("   ")
+			}
 		}
-		c.add(local, remote)
-	case "get":
-		if len(args) < 2 {
-			fmt.Fprint(os.Stderr, "missing remote-file\n")
-			os.Exit(1)
+		if last[i] {
+			b.WriteString("└─ ")
+		} else {
+			b.WriteString("├─ ")
 		}
-		remote := args[1]
-		local := filepath.Base(remote)
-		if len(args) > 2 {
-			local = args[2]
+		name := strings.TrimSuffix(p, "/")
+		name = name[strings.LastIndex(name, "/")+1:]
+		if strings.HasSuffix(p, "/") {
+			name += "/"
 		}
-		c.get(remote, local)
-	case "help":
-		fmt.Print(helpText)
-		return
-	default:
-		fmt.Print(helpText)
-		os.Exit(1)
+		b.WriteString(name)
+		fmt.Println(b.String())
+		open = append(open, !last[i])
 	}
 }
 
-func (c *clientCmd) dial() *websocket.Conn {
-	h := http.Header{}
-	u, _ := url.Parse(c.server)
-	if u.User != nil {
-		h.Set("Authorization", "Bearer "+u.User.Username())
-		c.server = strings.Replace(c.server, u.User.String()+"@", "", 1)
-	}
-	conn, _, err := websocket.DefaultDialer.Dial(c.server, h)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "dial:", err)
-		os.Exit(1)
-	}
-	return conn
-}
-
-// displayTree 以树状结构显示文件列表
-func displayTree(names []string, dirName string) {
+// displayLongTree 以树状结构显示带元数据的条目；旧服务端没有返回元数据时对应的列显示 "-"
+func displayLongTree(entries []client.ListEntry, dirName string, f textfmt.Options) {
 	if dirName == "/" {
 		dirName = "root"
 	}
 	fmt.Printf("%s/\n", dirName)
-	
-	for i, name := range names {
-		isLast := i == len(names)-1
-		if isLast {
-			fmt.Printf("└─ %s\n", name)
-		} else {
-			fmt.Printf("├─ %s\n", name)
+
+	t := textfmt.NewTable(os.Stdout, textfmt.Left, textfmt.Right)
+	for i, e := range entries {
+		mode, size, mtime := "-", "-", "-"
+		if e.Mode != "" {
+			mode, mtime = e.Mode, f.Time(e.ModTime)
+			if !e.Dir {
+				size = f.Size(e.Size)
+			}
+		}
+		branch, name := "├─", e.Name
+		if i == len(entries)-1 {
+			branch = "└─"
 		}
+		if e.Dir {
+			name += "/"
+		} else if e.Symlink {
+			name += "@"
+		}
+		t.Row(mode, size, mtime, branch+" "+name)
 	}
+	t.Flush()
 }
 
-func (c *clientCmd) list(dir string) {
-	conn := c.dial()
-	defer conn.Close()
-
-	req := fmt.Sprintf("GET /_list?dir=%s", url.QueryEscape(dir))
-	if err := conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
+func (c *clientCmd) add(args []string) {
+	fs := newFlagSet("client add")
+	recursive := fs.Bool("r", false, "upload a directory tree")
+	failFast := fs.Bool("fail-fast", false, "with -r, stop at the first failed file")
+	followLinks := fs.Bool("follow-symlinks", false, "with -r, upload files that symlinks point to instead of skipping them")
+	parallel := c.registerParallel(fs)
+	resume := fs.Bool("resume", false, "continue an interrupted upload of the same file; the partial upload is kept on the server if this one is interrupted too")
+	noVerify := fs.Bool("no-verify", false, "skip the SHA-256 check of the uploaded content (saves reading each file twice)")
+	force := fs.Bool("f", false, "replace an existing remote file even if the server refuses overwrites (-overwrite deny)")
+	noPreserve := fs.Bool("no-preserve", false, "do not give remote files the local modification time and permissions")
+	ifChanged := fs.Bool("if-changed", false, "skip files whose remote copy already has the same size and SHA-256")
+	estimate := fs.Bool("estimate", false, "plan the upload and predict its size and duration without transferring anything")
+	noProbe := fs.Bool("no-probe", false, "with -estimate, use the saved throughput history instead of a measuring burst")
+	probeSize := sizeFlag(8 << 20)
+	fs.Var(&probeSize, "probe-size", "with -estimate, `size` of the data sent to measure throughput")
+	probeTime := fs.Duration("probe-time", 3*time.Second, "with -estimate, stop measuring after this long")
+	asJSON := fs.Bool("json", false, "with -estimate, print the estimate as a JSON object")
+	extract := fs.Bool("extract", false, "upload a tar.gz or zip archive and have the server unpack it into the remote directory")
+	format := fs.String("format", "", "with -extract: tgz or zip (default from the file extension)")
+	var filter filterFlags
+	filter.register(fs)
+	var guard guardFlags
+	guard.register(fs, true)
+	headers := c.registerHeaders(fs)
+	progress := c.registerProgress(fs)
+	retry := c.registerRetry(fs)
+	args = parseFlags(fs, args)
+	filter.parse()
+	c.verify = !*noVerify
+	c.force = *force
+	c.noPreserve = *noPreserve
+	if err := headers(); err != nil {
+		usageFail("-header:", err)
 	}
-	// 连续读两条消息
-	_, headerMsg, err := conn.ReadMessage()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
+	if err := progress(); err != nil {
+		usageFail(err)
 	}
-	parts := strings.Fields(string(headerMsg))
-	if len(parts) != 2 {
-		fmt.Fprintln(os.Stderr, "bad header:", string(headerMsg))
-		return
+	if err := retry(); err != nil {
+		usageFail(err)
 	}
-	status, _ := strconv.Atoi(parts[0])
-	if status >= 400 {
-		_, bodyMsg, _ := conn.ReadMessage()
-		fmt.Fprintln(os.Stderr, "remote error:", string(bodyMsg))
-		return
+	if len(args) < 1 {
+		usageFail(i18n.T("usage.missing_local"))
 	}
-	_, bodyMsg, err := conn.ReadMessage()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	local := args[0]
+	if c.json && (*recursive || *extract || *estimate) {
+		usageFail("the global -json supports single-file add only, not -r, -extract or -estimate (which has its own -json)")
+	}
+	if *extract {
+		if *recursive || *resume || *estimate || *ifChanged {
+			usageFail("-extract uploads a single archive, it does not combine with -r, -resume, -estimate or -if-changed")
+		}
+		c.addExtract(args, *format)
 		return
 	}
-	var names []string
-	if err := json.Unmarshal(bodyMsg, &names); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	remote := filepath.Base(local)
+	if len(args) > 1 {
+		remote = args[1]
+	}
+	// 确保远程路径以/开头
+	if !strings.HasPrefix(remote, "/") {
+		remote = "/" + remote
+	}
+	if local == stdioArg {
+		c.addStdin(args, remote, *recursive || *resume || *estimate || *ifChanged)
 		return
 	}
-	
-	// 使用树状结构显示
-	displayTree(names, dir)
-}
 
-func (c *clientCmd) add(local, remote string) {
 	f, err := os.Open(local)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
+		c.fail(err)
 	}
 	defer f.Close()
 	fi, _ := f.Stat()
-	if fi.IsDir() {
-		fmt.Fprintln(os.Stderr, "directory upload not implemented")
-		return
+	if fi.IsDir() && !*recursive {
+		usageFail(i18n.T("status.dir_upload", local))
 	}
-
-	conn := c.dial()
-	defer conn.Close()
-
-	// 确保远程路径以/开头
-	if !strings.HasPrefix(remote, "/") {
-		remote = "/" + remote
+	var tf *treeFilter
+	if fi.IsDir() {
+		tf = filter.local(local)
+	} else if filter.set() {
+		usageFail("-exclude and -include apply to directory trees (-r) only")
 	}
-
-	// 首先发送请求头
-	req := fmt.Sprintf("POST %s", remote)
-	if err := conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	if *estimate {
+		if *resume {
+			usageFail("-estimate does not combine with -resume")
+		}
+		c.estimateUpload(local, fi, tf, *followLinks, estimateOptions{probe: !*noProbe, probeSize: int64(probeSize), probeTime: *probeTime, json: *asJSON})
 		return
 	}
-
-	// 然后发送文件内容
-	data, err := io.ReadAll(f)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "read file error:", err)
+	if fi.IsDir() {
+		if *resume {
+			usageFail("-resume works on single files, not with -r")
+		}
+		if err := guard.checkRoots(local, ""); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := guard.confirmUpload(local, remote, tf, *followLinks); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !c.addTree(local, remote, tf, *failFast, *followLinks, *ifChanged, *parallel) {
+			os.Exit(1)
+		}
 		return
 	}
 
-	if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
-		fmt.Fprintln(os.Stderr, "write file data error:", err)
-		return
+	c.transfer = c.newTransferProgress("upload", remote)
+	cl := c.dial()
+	// 重试时 cl 可能被换成新的连接
+	defer func() { cl.Close() }()
+	// 大小已知时先对照服务端的限制，免得传完才被拒绝
+	if fi.Mode().IsRegular() {
+		if limit, err := cl.UploadLimit(); err == nil && limit > 0 && fi.Size() > limit {
+			c.failWith(i18n.T("status.too_large", c.format.Size(limit)), nil, exitFailure)
+		}
 	}
 
-	// 读取响应
-	_, headerMsg, err := conn.ReadMessage()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "read header error:", err)
-		return
+	var st client.TransferStats
+	start := time.Now()
+	if *ifChanged {
+		var same bool
+		err := c.retrying(&cl, func(cl *client.Client) (err error) {
+			same, err = remoteUnchanged(cl, local, remote)
+			return err
+		})
+		if err != nil {
+			c.fail(err)
+		}
+		if same {
+			switch {
+			case c.json:
+				printJSON(transferResult{Path: remote, Local: local, Bytes: 0, Unchanged: true})
+			case c.progress != progressJSON:
+				fmt.Println(i18n.T("status.upload_unchanged", remote))
+			}
+			return
+		}
 	}
-
-	parts := strings.Fields(string(headerMsg))
-	if len(parts) != 2 {
-		fmt.Fprintln(os.Stderr, "bad header:", string(headerMsg))
-		return
+	if *resume {
+		if !fi.Mode().IsRegular() {
+			usageFail("-resume needs a regular file")
+		}
+		err = c.retrying(&cl, func(cl *client.Client) (err error) {
+			st, err = cl.UploadResume(remote, f, fi.Size())
+			if st.Resumed > 0 {
+				fmt.Fprintln(os.Stderr, i18n.T("status.upload_resumed", c.format.Size(st.Resumed), c.format.Size(st.Size)))
+			}
+			return err
+		})
+	} else {
+		attempts := 0
+		err = c.retrying(&cl, func(cl *client.Client) (err error) {
+			// 重试时从头上传；不是普通文件时无法回到开头，不再重试
+			if attempts++; attempts > 1 {
+				if _, err := f.Seek(0, io.SeekStart); err != nil {
+					return &client.LocalReadError{Err: err}
+				}
+			}
+			st, err = cl.Upload(remote, f)
+			return err
+		})
 	}
-
-	status, _ := strconv.Atoi(parts[0])
-	if status >= 400 {
-		_, bodyMsg, _ := conn.ReadMessage()
-		fmt.Fprintln(os.Stderr, "remote error:", string(bodyMsg))
-		return
+	if c.verbose && cl.Streaming() {
+		fmt.Fprintln(os.Stderr, i18n.T("status.sent_stats", c.format.Size(st.Bytes), st.Chunks))
+	}
+	if c.verbose && st.Verified {
+		fmt.Fprintln(os.Stderr, i18n.T("status.verified"))
 	}
-
-	// 读取响应体（即使成功也需要读取，以清空连接）
-	_, bodyMsg, err := conn.ReadMessage()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "read body error:", err)
-		return
+		c.fail(err)
 	}
-
-	if status >= 200 && status < 300 {
-		fmt.Println("upload done:", string(bodyMsg))
-	} else {
-		fmt.Fprintln(os.Stderr, "upload failed:", string(bodyMsg))
+	elapsed := time.Since(start)
+	c.noteTransfer(st.Bytes, elapsed)
+	switch {
+	case c.json:
+		c.printTransfer(remote, local, st, elapsed)
+	case c.progress != progressJSON:
+		fmt.Println(i18n.T("status.upload_done", remote))
 	}
 }
 
-func (c *clientCmd) get(remote, local string) {
-	conn := c.dial()
-	defer conn.Close()
-
-	// 确保远程路径以/开头
-	if !strings.HasPrefix(remote, "/") {
-		remote = "/" + remote
+func (c *clientCmd) get(args []string) {
+	fs := newFlagSet("client get")
+	casePolicy := fs.String("case-collision", caseRename, "when the local directory has a name differing only by case: rename, overwrite or fail")
+	recursive := fs.Bool("r", false, "download a directory tree")
+	skipExisting := fs.Bool("skip-existing", false, "with -r, skip files that already exist locally with the same size")
+	filesFrom := fs.String("files-from", "", "download only the paths listed in `file` (- for stdin), relative to <remoteDir>, one per line")
+	from0 := fs.Bool("0", false, "with -files-from, the paths are separated by NUL bytes (as printed by list -0 and find -0)")
+	parallel := c.registerParallel(fs)
+	noVerify := fs.Bool("no-verify", false, "skip the SHA-256 check of downloaded files (saves hashing on both ends)")
+	noPreserve := fs.Bool("no-preserve", false, "do not give local files the remote modification time and permissions")
+	asFile := fs.Bool("archive", false, "download <remoteDir> as one tar.gz or zip archive built by the server, saved as [local] (default <name>.tgz, - for stdout)")
+	asArchive := fs.Bool("as-archive", false, "with -r, fetch the tree as one tar.gz stream and extract it locally instead of file by file")
+	var archive archiveFlags
+	fs.StringVar(&archive.format, "format", "", "with -archive: tgz or zip (default from the file extension, else tgz)")
+	fs.StringVar(&archive.symlinks, "symlinks", "skip", "with -archive or -as-archive, symlinks inside the tree: skip or store (as links, never followed)")
+	var filter filterFlags
+	filter.register(fs)
+	var guard guardFlags
+	guard.register(fs, false)
+	headers := c.registerHeaders(fs)
+	progress := c.registerProgress(fs)
+	retry := c.registerRetry(fs)
+	args = parseFlags(fs, args)
+	filter.parse()
+	c.verify = !*noVerify
+	c.noPreserve = *noPreserve
+	if err := headers(); err != nil {
+		usageFail("-header:", err)
 	}
-
-	req := fmt.Sprintf("GET %s", remote)
-	if err := conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
+	if err := progress(); err != nil {
+		usageFail(err)
 	}
-	_, headerMsg, err := conn.ReadMessage()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
+	if err := retry(); err != nil {
+		usageFail(err)
 	}
-	parts := strings.Fields(string(headerMsg))
-	if len(parts) != 2 {
-		fmt.Fprintln(os.Stderr, "bad header:", string(headerMsg))
-		return
+	if len(args) < 1 {
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+	if err := validCasePolicy(*casePolicy, caseRename, caseOverwrite, caseFail); err != nil {
+		usageFail(err)
 	}
-	status, _ := strconv.Atoi(parts[0])
-	if status >= 400 {
-		_, bodyMsg, _ := conn.ReadMessage()
-		fmt.Fprintln(os.Stderr, "remote error:", string(bodyMsg))
+	switch {
+	case *asFile && *recursive:
+		usageFail("-archive downloads the whole tree already, use -r -as-archive to extract it")
+	case *asArchive && !*recursive:
+		usageFail("-as-archive requires -r")
+	case *asArchive && *skipExisting:
+		usageFail("-as-archive cannot be combined with -skip-existing")
+	case *from0 && *filesFrom == "":
+		usageFail("-0 requires -files-from")
+	case *filesFrom != "" && (*recursive || *asFile || filter.set()):
+		usageFail("-files-from cannot be combined with -r, -archive, -exclude or -include")
+	case filter.set() && (!*recursive || *asArchive):
+		// 打包由服务端完成，不经过排除规则
+		usageFail("-exclude and -include apply to get -r only, not to single files, -archive or -as-archive")
+	}
+	remote := args[0]
+	if c.json && (*recursive || *asFile || *filesFrom != "" || len(args) > 1 && args[1] == stdioArg) {
+		usageFail("the global -json supports single-file get to a local file only, not -r, -archive, -files-from or -")
+	}
+	if *asFile {
+		out := ""
+		if len(args) > 1 {
+			out = args[1]
+		}
+		c.getArchive(remote, out, archive)
 		return
 	}
-	_, bodyMsg, err := conn.ReadMessage()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	local := filepath.Base(remote)
+	if len(args) > 1 {
+		local = args[1]
+	}
+	if *filesFrom != "" {
+		// 只写出列出的文件，不像 get -r 那样检查本地根
+		if len(args) < 2 && (local == "/" || local == ".") {
+			local = "."
+		}
+		if !c.getFilesFrom(remote, local, *filesFrom, *from0, *casePolicy, *skipExisting, *parallel) {
+			os.Exit(1)
+		}
 		return
 	}
-	f, err := os.Create(local)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	if local == stdioArg && len(args) > 1 {
+		if *recursive {
+			usageFail(i18n.T("status.stdio_single"))
+		}
+		c.getStdout(remote)
 		return
 	}
-	defer f.Close()
-	if _, err := f.Write(bodyMsg); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	if *recursive {
+		if len(args) < 2 && (local == "/" || local == ".") {
+			local = "."
+		}
+		if err := guard.checkRoots(local, remote); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fetch := func() bool { return c.getTree(remote, local, &filter, *casePolicy, *skipExisting, *parallel) }
+		var ok bool
+		if *asArchive {
+			ok = c.getTreeArchive(remote, local, archive, fetch)
+		} else {
+			ok = fetch()
+		}
+		if !ok {
+			os.Exit(1)
+		}
 		return
 	}
-	fmt.Println("download done ->", local)
-}
-
-// secureCreateDir 安全地创建目录，包含额外的安全检查
-func (s *serverCmd) secureCreateDir(dirPath, rootPath, clientIP string) error {
-	absRoot, _ := filepath.Abs(rootPath)
-
-	// 检查目录是否已存在
-	if _, err := os.Stat(dirPath); err == nil {
-		return nil // 目录已存在，无需创建
+	local, err := resolveLocalCase(local, *casePolicy)
+	if err != nil {
+		c.fail(err)
 	}
 
-	// 检查路径深度，防止创建过深的目录结构
-	relPath, err := filepath.Rel(absRoot, dirPath)
+	c.transfer = c.newTransferProgress("download", remote)
+	cl := c.dial()
+	defer func() { cl.Close() }()
+
+	start := time.Now()
+	var st client.TransferStats
+	// 中断的下载留下 .part 文件，重试时从那里续传
+	err = c.retrying(&cl, func(cl *client.Client) (err error) {
+		st, err = cl.DownloadFile(remote, local, nil)
+		return err
+	})
 	if err != nil {
-		return errors.New("invalid directory path")
+		msg := describeErr(err)
+		var re *client.RemoteError
+		if !errors.As(err, &re) {
+			msg = i18n.T("status.download_failed", msg)
+		}
+		if _, serr := os.Stat(local + client.PartSuffix); serr == nil {
+			fmt.Fprintln(os.Stderr, i18n.T("status.partial_kept", local+client.PartSuffix))
+		}
+		c.failWith(msg, err, exitCode(err))
 	}
-
-	// 限制目录深度为最多5层
-	pathParts := strings.Split(filepath.ToSlash(relPath), "/")
-	if len(pathParts) > 5 {
-		return errors.New("directory depth too deep (max 5 levels)")
+	c.reportResume(st)
+	c.reportTransfer(cl, st)
+	switch {
+	case c.json:
+		c.printTransfer(remote, local, st, time.Since(start))
+	case c.progress != progressJSON:
+		fmt.Println(i18n.T("status.download_done", local))
 	}
+	c.noteCanonical(cl, remote)
+}
 
-	// 检查每个路径部分是否安全
-	for _, part := range pathParts {
-		if part == "" || part == "." || part == ".." {
-			continue
+// serverFlags 在 fs 上注册服务端标志，解析后调用返回的函数得到 server.Config 和退出时的等待时间，同时应用日志时间戳的设置。
+// "wsbox server" 和 "wsbox server audit" 共用同一组标志
+func serverFlags(fs *flag.FlagSet) func() (server.Config, time.Duration) {
+	addr := fs.String("addr", ":8080", "gateway listen address, or unix:///path/to/wsbox.sock for a unix domain socket")
+	socketMode := fs.String("socket-mode", fmt.Sprintf("%04o", server.DefaultSocketMode), "octal permissions of the -addr unix socket")
+	noTokenOnUnix := fs.Bool("no-token-on-unix", false, "let requests over the -addr unix socket in without a token; the socket permissions gate access")
+	dir := fs.String("dir", ".", "sandbox directory")
+	token := fs.String("token", "", "fixed token (auto-generated if empty)")
+	tokenFile := fs.String("token-file", "", "read the token from the first line of this file instead of -token, so it is not visible in the process list; re-read on SIGHUP")
+	tokensFile := fs.String("tokens-file", "", "additional tokens, one \"<token> <ro|rw> [subdir]\" per line; re-read on SIGHUP")
+	authFailLimit := fs.Int("auth-fail-limit", 10, "after this many failed authentications from one IP within -auth-fail-window, refuse it with 429 for the same period (0 = off)")
+	authFailWindow := fs.Duration("auth-fail-window", time.Minute, "window for counting failed authentications, also the lockout period")
+	rateLimit := fs.Float64("rate-limit", 0, "requests per second per connection, excess requests are delayed (0 = unlimited)")
+	var bwLimit sizeFlag
+	fs.Var(&bwLimit, "bwlimit-per-conn", "cap the file data each connection transfers, uploads and downloads combined, at this `size` per second, e.g. 2M (0 = unlimited)")
+	pingInterval := fs.Duration("ping-interval", protocol.PingInterval, "send a websocket ping to each client this often so proxies keep idle connections open (0 = off)")
+	legacyProtocol := fs.Bool("legacy-protocol", true, "also accept clients that only speak the version 1 text request lines (to be removed in the next release)")
+	pipeline := fs.Int("pipeline", 8, "requests a client may have in flight at once on one connection, each tagged with an id (0 = lock-step only)")
+	idleTimeout := fs.Duration("idle-timeout", 3*protocol.PingInterval, "close a connection when nothing, not even a pong, arrives from the client for this long while it is idle (0 = never)")
+	cert := fs.String("cert", "", "TLS certificate file (PEM); with -key the gateway serves wss://")
+	key := fs.String("key", "", "TLS private key file (PEM)")
+	walkTimeout := fs.Duration("walk-timeout", 10*time.Second, "time budget for directory walks, partial results are returned when exceeded (0 = unlimited)")
+	statConcurrency := fs.Int("stat-concurrency", 8, "number of concurrent stat calls during directory walks")
+	findLimit := fs.Int("find-limit", 1000, "most matches one find request may return; clients can ask for fewer")
+	treeLimit := fs.Int("tree-limit", 10000, "most entries one recursive listing (list -R) may return; larger trees are cut off with a warning")
+	slowLog := fs.Duration("slow-log", 2*time.Second, "log a timing breakdown for requests slower than this (0 = off)")
+	scanCommand := fs.String("scan-command", "", "command run on each staged upload, the file path is appended; non-zero exit rejects it")
+	scanClamd := fs.String("scan-clamd", "", "clamd address (tcp://host:3310) used to scan uploads")
+	scanTimeout := fs.Duration("scan-timeout", 30*time.Second, "time limit for scanning one upload")
+	scanFailOpen := fs.Bool("scan-fail-open", false, "accept uploads when the scanner is unavailable")
+	uploadHook := fs.String("upload-hook", "", "command run on each staged upload before it is renamed into place; the staged path and the sandbox path are appended and WSBOX_* variables set; non-zero exit rejects it with 422 and its stderr")
+	uploadHookTimeout := fs.Duration("upload-hook-timeout", 30*time.Second, "time limit for one -upload-hook run; exceeding it rejects the upload with 503")
+	uploadHookConcurrency := fs.Int("upload-hook-concurrency", 4, "how many -upload-hook commands may run at once; further uploads wait")
+	flowWindow := fs.Int("flow-window", 16, "maximum number of unacknowledged 64KiB download chunks per connection (0 = no flow control)")
+	stateDir := fs.String("state-dir", "", "directory for the journaled server state store (in memory if empty)")
+	caseCollision := fs.String("case-collision", server.CaseWarn, "uploads whose name differs only by case from an existing entry: warn, reject or allow")
+	overwrite := fs.String("overwrite", server.OverwriteAllow, "uploads to an existing file: allow (replace it), deny (409 unless the client passes -f) or version (keep the old file as name.~N~)")
+	followSymlinks := fs.Bool("follow-symlinks", false, "follow symlinks inside the sandbox that resolve to a path inside it (by default any path through a symlink is refused)")
+	maxDepth := fs.Int("max-depth", 5, "deepest directory level clients may create in the sandbox, files count by their directory (0 = unlimited)")
+	maxNameLen := fs.Int("max-name-len", 255, "longest file or directory name, in bytes, clients may create (0 = unlimited)")
+	nameCharset := fs.String("name-charset", server.NameAny, "characters allowed in new names: strict (ASCII letters, digits, . _ -), windows-safe (no <>:\"\\|?*, control characters, trailing dot or space, or device names such as CON) or any (no restriction)")
+	warnDirEntries := fs.Int("warn-dir-entries", 50000, "log a warning the first time a directory holds more entries than this (0 = off)")
+	var maxMessage sizeFlag
+	fs.Var(&maxMessage, "max-message-size", "close gateway connections that send a single websocket message larger than this `size`, e.g. 64M, with 1009; at least 1.1M so chunked uploads fit (0 = unlimited)")
+	var maxUpload sizeFlag
+	fs.Var(&maxUpload, "max-upload-size", "largest accepted upload `size`, e.g. 100M or 2G; larger uploads get 413 (0 = unlimited)")
+	extractMaxSize := sizeFlag(1 << 30)
+	fs.Var(&extractMaxSize, "extract-max-size", "most data one uploaded archive (add -extract) may unpack to, as a `size`; larger archives get 422 (0 = unlimited)")
+	extractMaxEntry := sizeFlag(256 << 20)
+	fs.Var(&extractMaxEntry, "extract-max-entry", "largest single file `size` in an uploaded archive (0 = unlimited)")
+	heavyOps := fs.Int("heavy-ops", 2, "how many directory walks and recursive deletes run at once, a recursive delete counts twice (0 = unlimited)")
+	heavyQueue := fs.Int("heavy-queue", 16, "how many such requests may wait for their turn; more get 429 SERVER_BUSY")
+	var aliases headerFlag // 与 -header 一样收集可重复的值
+	fs.Var(&aliases, "alias", "serve an old path prefix from a new location inside the sandbox, given as `/old=/new`, e.g. /old/reports=/archive/2023/reports (repeatable)")
+	aliasFile := fs.String("alias-file", "", "file with one /old=/new alias per line, re-read on SIGHUP")
+	aliasWrites := fs.String("alias-writes", server.AliasWritesDeny, "uploads, deletes and locks through an alias: deny (403 ALIAS_READ_ONLY) or allow")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus /metrics on this separate address without a token (default: on the gateway, token required)")
+	activitySize := fs.Int("activity-size", 1000, "number of recent operations kept for GET /_activity (0 = off)")
+	readOnly := fs.Bool("readonly", false, "serve downloads and listings only; uploads, deletes and locks are refused with 403")
+	auditLog := fs.String("audit-log", "", "append one JSON line per completed operation (who, what, bytes, status) to this file, fsynced, for compliance; check it with \"wsbox server verify-audit\"")
+	auditChain := fs.Bool("audit-chain", false, "chain -audit-log entries: each carries the SHA-256 of the previous line, so edits and removals are detectable")
+	webhookURL := fs.String("webhook-url", "", "POST a JSON notification {event, path, size, sha256, ts, client_ip} to this http(s) URL after each successful upload and delete; sent in the background, retried on 5xx")
+	webhookSecret := fs.String("webhook-secret", "", "sign -webhook-url notifications with HMAC-SHA256 of the body under this key")
+	webhookSigHeader := fs.String("webhook-signature-header", server.DefaultWebhookSignatureHeader, "header carrying the -webhook-secret signature as sha256=<hex>")
+	var allowCIDR, denyCIDR headerFlag // 与 -header 一样收集可重复的值
+	fs.Var(&allowCIDR, "allow-cidr", "only accept gateway requests from this `cidr` or address, e.g. 10.0.0.0/8, checked before the token (repeatable)")
+	fs.Var(&denyCIDR, "deny-cidr", "reject gateway requests from this `cidr` or address; wins over -allow-cidr (repeatable)")
+	trustProxy := fs.Bool("trust-proxy-header", false, "take the client address from X-Forwarded-For/X-Real-IP for filtering, lockouts and logs; only behind a reverse proxy that sets them")
+	allowedOrigins := fs.String("allowed-origins", "", "comma-separated browser origins allowed to use the gateway and its HTTP API cross-origin, e.g. https://app.example.com (* = any; default: any Origin, no CORS headers)")
+	webUI := fs.Bool("webui", false, "serve a browser UI at / on the gateway for browsing, uploading and downloading with the token")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 10*time.Second, "on SIGTERM, how long to wait for in-flight requests before exiting; exits 1 when it runs out")
+	fs.DurationVar(shutdownTimeout, "drain-timeout", 10*time.Second, "alias of -shutdown-timeout")
+	logTimezone := fs.String("log-timezone", "UTC", "time zone of log timestamps: UTC, local or an IANA name such as Europe/Berlin")
+	logTimeFormat := fs.String("log-time-format", server.DefaultLogTimeFormat, "layout of log timestamps in Go time format; must include the zone offset unless -log-timezone is UTC")
+	logFormat := fs.String("log-format", server.LogFormatText, "access log format: text or json (one object per line)")
+	logFile := fs.String("log-file", "", "append the access log to this file instead of stdout; SIGHUP reopens it")
+
+	return func() (server.Config, time.Duration) {
+		// 日志的时间戳、格式和去向是进程级的设置，不属于 server.Config；出错时与其他错误的标志一样以退出码2结束
+		loc, err := server.ParseLogTimezone(*logTimezone)
+		if err == nil {
+			err = server.SetLogTime(loc, *logTimeFormat)
 		}
-		// 检查是否包含危险字符
-		if strings.ContainsAny(part, "<>:\"|?*") {
-			return errors.New("directory name contains illegal characters")
+		if err == nil {
+			err = server.SetLogFormat(*logFormat)
 		}
-		// 限制目录名长度
-		if len(part) > 50 {
-			return errors.New("directory name too long (max 50 characters)")
+		if err == nil {
+			err = server.SetLogFile(*logFile)
 		}
-	}
-
-	// 逐级创建目录，确保每一级都在安全范围内
-	currentPath := absRoot
-	for _, part := range pathParts {
-		if part == "" || part == "." {
-			continue
+		mode, perr := strconv.ParseUint(*socketMode, 8, 32)
+		if err == nil && (perr != nil || mode > 0o777) {
+			err = fmt.Errorf("-socket-mode: %q is not an octal permission such as 0660", *socketMode)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
 		}
-		currentPath = filepath.Join(currentPath, part)
+		return server.Config{
+			Addr:                   *addr,
+			SocketMode:             os.FileMode(mode),
+			NoTokenOnUnix:          *noTokenOnUnix,
+			Dir:                    *dir,
+			Token:                  *token,
+			TokenFile:              *tokenFile,
+			CertFile:               *cert,
+			KeyFile:                *key,
+			WalkTimeout:            *walkTimeout,
+			StatConcurrency:        *statConcurrency,
+			SlowLog:                *slowLog,
+			FindLimit:              *findLimit,
+			TreeLimit:              *treeLimit,
+			ScanCommand:            *scanCommand,
+			ScanClamd:              *scanClamd,
+			ScanTimeout:            *scanTimeout,
+			ScanFailOpen:           *scanFailOpen,
+			UploadHook:             *uploadHook,
+			UploadHookTimeout:      *uploadHookTimeout,
+			UploadHookConcurrency:  *uploadHookConcurrency,
+			FlowWindow:             *flowWindow,
+			CaseCollision:          *caseCollision,
+			Overwrite:              *overwrite,
+			FollowSymlinks:         *followSymlinks,
+			MaxDepth:               *maxDepth,
+			MaxNameLen:             *maxNameLen,
+			NameCharset:            *nameCharset,
+			StateDir:               *stateDir,
+			WarnDirEntries:         *warnDirEntries,
+			ReadOnly:               *readOnly,
+			ActivitySize:           *activitySize,
+			MaxUploadSize:          int64(maxUpload),
+			MaxMessageSize:         int64(maxMessage),
+			ExtractMaxSize:         int64(extractMaxSize),
+			ExtractMaxEntry:        int64(extractMaxEntry),
+			HeavyOps:               *heavyOps,
+			HeavyQueue:             *heavyQueue,
+			MetricsAddr:            *metricsAddr,
+			Aliases:                aliases,
+			AliasFile:              *aliasFile,
+			AliasWrites:            *aliasWrites,
+			TokensFile:             *tokensFile,
+			AuthFailLimit:          *authFailLimit,
+			AuthFailWindow:         *authFailWindow,
+			RateLimit:              *rateLimit,
+			BandwidthLimit:         int64(bwLimit),
+			PingInterval:           *pingInterval,
+			IdleTimeout:            *idleTimeout,
+			Pipeline:               *pipeline,
+			RejectLegacy:           !*legacyProtocol,
+			WebUI:                  *webUI,
+			AllowCIDR:              allowCIDR,
+			DenyCIDR:               denyCIDR,
+			TrustProxyHeader:       *trustProxy,
+			AllowedOrigins:         splitList(*allowedOrigins),
+			AuditLog:               *auditLog,
+			AuditChain:             *auditChain,
+			WebhookURL:             *webhookURL,
+			WebhookSecret:          *webhookSecret,
+			WebhookSignatureHeader: *webhookSigHeader,
+		}, *shutdownTimeout
+	}
+}
 
-		// 确保当前路径仍在根目录内
-		if !strings.HasPrefix(currentPath, absRoot) {
-			return errors.New("directory creation would escape sandbox")
+// splitList 把逗号分隔的标志值拆成列表，去掉空白和空项
+func splitList(v string) []string {
+	var out []string
+	for _, f := range strings.Split(v, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
 		}
+	}
+	return out
+}
 
-		// 创建目录
-		if err := os.Mkdir(currentPath, 0755); err != nil && !os.IsExist(err) {
-			return fmt.Errorf("failed to create directory: %v", err)
+// runServer 启动服务端，收到 SIGTERM 或 Ctrl-C 时等待进行中的请求结束后退出
+func runServer(s *server.Server, shutdownTimeout time.Duration) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// SIGHUP 重新打开 -log-file（配合 logrotate）、重新读取 -tokens-file 和 -alias-file，并重新读取 -token-file 或状态目录下的token文件，旧token建立的连接被吊销
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.ListenAndServe() }()
+wait:
+	for {
+		select {
+		case err := <-errc:
+			fatal(err)
+		case <-hup:
+			if err := server.ReopenLogFile(); err != nil {
+				server.Logf("SIGHUP: %v", err)
+			}
+			if err := s.ReloadTokens(); err != nil {
+				server.Logf("SIGHUP: %v", err)
+			}
+			if err := s.ReloadAliases(); err != nil {
+				server.Logf("SIGHUP: %v", err)
+			}
+			if err := s.ReloadToken(); err != nil {
+				server.Logf("SIGHUP: %v", err)
+			}
+		case <-ctx.Done():
+			break wait
 		}
 	}
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	drainErr := s.Shutdown(sctx)
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		server.Logf("%v", err)
+	}
+	// 没能在时限内等到所有请求完成时以非零退出码结束，编排系统可以区分干净的退出
+	if drainErr != nil {
+		os.Exit(1)
+	}
+}
 
-	return nil
+// fatal 按服务端日志的时间戳格式输出错误后退出
+func fatal(err error) {
+	server.Logf("%v", err)
+	os.Exit(1)
 }
 
-func securePath(raw string, root string) (string, error) {
-	clean := filepath.Clean("/" + raw)
-	if strings.Contains(clean, "..") {
-		return "", errors.New("illegal path")
+func main() {
+	// -lang 可以出现在任意位置，先取出它再分派子命令
+	argv, lang := i18n.SplitFlag(os.Args[1:])
+	i18n.SetLang(i18n.Detect(lang))
+	if len(argv) < 1 {
+		printHelp(os.Stdout, "", nil)
+		os.Exit(1)
 	}
-	absRoot, _ := filepath.Abs(root)
-	target := filepath.Join(absRoot, clean)
-	if !strings.HasPrefix(target, absRoot) {
-		return "", errors.New("path escape")
+	dispatch("", topCommands(), argv)
+}
+
+// runServerCommand 实现 "wsbox server"，audit 和 state 子命令在命令表 serverCommands 中
+func runServerCommand(args []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		dispatch("server", serverCommands(), args)
+		return
+	}
+	fs := newFlagSet("server")
+	build := serverFlags(fs)
+	audit := fs.Bool("audit", false, "audit the configuration before starting and refuse to start on high-severity findings")
+	fs.Parse(args)
+	cfg, shutdownTimeout := build()
+	server.StartReaper()
+	s, err := server.New(cfg)
+	if err != nil {
+		fatal(err)
+	}
+	if *audit && !printAudit(os.Stdout, s.Audit(), false) {
+		os.Exit(1)
 	}
-	return target, nil
+	if err := s.Open(); err != nil {
+		fatal(err)
+	}
+	fmt.Println("=== wsbox ===")
+	fmt.Println(i18n.T("server.sandbox", cfg.Dir))
+	if cfg.TokenFile != "" {
+		fmt.Println(i18n.T("server.token_file", cfg.TokenFile))
+	} else {
+		fmt.Println(i18n.T("server.token", s.Token()))
+	}
+	if cfg.ReadOnly {
+		fmt.Println(i18n.T("server.read_only"))
+	}
+	runServer(s, shutdownTimeout)
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Print(helpText)
+// clientFlags 是 "wsbox client" 的全局标志，profile 的 flags 也按它校验
+type clientFlags struct {
+	server     *string
+	rawBytes   *bool
+	iso        *bool
+	verbose    *bool
+	insecure   *bool
+	caCert     *string
+	mtimeSlack *time.Duration
+	profile    *string
+	config     *string
+	token      *string
+	tokenFile  *string
+	json       *bool
+	bwLimit    *sizeFlag
+	maxMessage *sizeFlag
+
+	proxy          *string
+	connectTimeout *time.Duration
+	opTimeout      *time.Duration
+	stallTimeout   *time.Duration
+}
+
+func registerClientFlags(fs *flag.FlagSet) *clientFlags {
+	bwLimit := new(sizeFlag)
+	fs.Var(bwLimit, "bwlimit", "limit file data sent and received to this `size` per second, e.g. 2M (0 = unlimited)")
+	maxMessage := new(sizeFlag)
+	fs.Var(maxMessage, "max-message-size", "largest websocket message `size` accepted from the server, e.g. 64M; at least 1.1M (0 = unlimited)")
+	return &clientFlags{
+		server:     fs.String("s", "ws://127.0.0.1:8080/ws", "websocket server address"),
+		rawBytes:   fs.Bool("bytes", false, "show sizes as exact byte counts"),
+		iso:        fs.Bool("iso", false, "show times as RFC3339 instead of relative times"),
+		verbose:    fs.Bool("v", false, "print negotiated protocol parameters and transfer statistics to stderr"),
+		insecure:   fs.Bool("insecure", false, "skip verification of the server certificate (self-signed certificates)"),
+		caCert:     fs.String("cacert", "", "PEM bundle of CA certificates to trust for wss://"),
+		mtimeSlack: fs.Duration("mtime-slack", 0, "modification times closer than this are treated as equal when comparing remote and local files"),
+		profile:    fs.String("profile", "", "use this profile of the config file (default $WSBOX_PROFILE, then the file's default)"),
+		config:     fs.String("config", "", "client config file with named profiles (default $WSBOX_CONFIG or ~/.config/wsbox/config.yaml)"),
+		token:      fs.String("token", "", "access token (visible in ps and shell history, prefer -token-file or $WSBOX_TOKEN)"),
+		tokenFile:  fs.String("token-file", "", "read the access token from the first line of this file"),
+		json:       fs.Bool("json", false, "list, stat, add and get print exactly one JSON document to stdout, also on failure; messages go to stderr"),
+		bwLimit:    bwLimit,
+		maxMessage: maxMessage,
+
+		proxy:          fs.String("proxy", "", "connect through this `url` (http://, https:// or socks5://, user:password@ for authentication) instead of $HTTPS_PROXY/$HTTP_PROXY/$NO_PROXY"),
+		connectTimeout: fs.Duration("connect-timeout", 30*time.Second, "give up connecting (TCP, TLS and websocket upgrade) after this long (0 = no limit)"),
+		opTimeout:      fs.Duration("op-timeout", 0, "give up when the server has not started to answer a request after this long; progress frames reset it (0 = no limit)"),
+		stallTimeout:   fs.Duration("transfer-stall-timeout", 0, "abort a transfer when no data moves in either direction for this long (0 = no limit)"),
+	}
+}
+
+// runClient 实现 "wsbox client"：解析全局标志、应用选中的 profile 后分派子命令
+func runClient(args []string) {
+	fs := newFlagSet("client")
+	g := registerClientFlags(fs)
+	fs.Parse(args)
+	rest := fs.Args()
+	globals := args[:len(args)-fs.NArg()]
+	if len(rest) == 0 {
+		// 在终端上不带命令时进入交互式 shell，脚本中仍然是用法错误
+		if !isTerminal(os.Stdin) {
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		rest = []string{"shell"}
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	cfg, prof, err := selectProfile(*g.config, explicit["config"], *g.profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	switch os.Args[1] {
-	case "server":
-		fs := flag.NewFlagSet("server", flag.ExitOnError)
-		addr := fs.String("addr", ":8080", "gateway listen address")
-		dir := fs.String("dir", ".", "sandbox directory")
-		token := fs.String("token", "", "fixed token (auto-generated if empty)")
-		fs.Parse(os.Args[2:])
-		(&serverCmd{addr: *addr, dir: *dir, token: *token}).run()
-
-	case "client":
-		fs := flag.NewFlagSet("client", flag.ExitOnError)
-		s := fs.String("s", "ws://127.0.0.1:8080/ws", "websocket server")
-		fs.Parse(os.Args[2:])
-		(&clientCmd{server: *s}).run(fs.Args())
-
-	case "help":
-		fmt.Print(helpText)
-		os.Exit(0)
-
-	default:
-		fmt.Print(helpText)
+	if prof != nil {
+		pre, err := profileArgs(prof)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// profile 的设置放在命令行标志之前重新解析，命令行上显式给出的标志后出现，因而优先
+		fs.Parse(append(pre, globals...))
+	}
+	token, err := resolveToken(*g.token, *g.tokenFile, explicit["s"], prof)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+	var proxy *url.URL
+	if *g.proxy != "" {
+		if proxy, err = client.ParseProxyURL(*g.proxy); err != nil {
+			usageFail("-proxy:", err)
+		}
+	}
+	if *g.json && !jsonCommands[rest[0]] {
+		usageFail(fmt.Sprintf("the global -json supports list, stat, add, get and append; use the -json of %q instead where it has one", rest[0]))
+	}
+	(&clientCmd{
+		server:     serverURL(*g.server, explicit["s"], prof),
+		token:      token,
+		format:     textfmt.Options{Bytes: *g.rawBytes, ISO: *g.iso},
+		verbose:    *g.verbose,
+		insecure:   *g.insecure,
+		caCert:     *g.caCert,
+		mtimeSlack: *g.mtimeSlack,
+		json:       *g.json,
+		bwLimit:    int64(*g.bwLimit),
+		maxMessage: int64(*g.maxMessage),
+		proxy:      proxy,
+		timeouts:   clientTimeouts{connect: *g.connectTimeout, op: *g.opTimeout, stall: *g.stallTimeout},
+		globals:    globals,
+		config:     cfg,
+		profile:    prof,
+	}).run(rest)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+
+	"wsbox/internal/i18n"
+	"wsbox/internal/protocol"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：请求元数据 ---------- */
+
+// headerFlag 收集可重复的 -header key=value
+type headerFlag []string
+
+func (h *headerFlag) String() string { return strings.Join(*h, ",") }
+
+func (h *headerFlag) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
+// registerHeaders 在传输命令上注册 -header，解析后调用返回的函数把元数据记到 c 上，
+// 之后 dial 建立的连接都会携带它们
+func (c *clientCmd) registerHeaders(fs *flag.FlagSet) func() error {
+	var h headerFlag
+	fs.Var(&h, "header", "attach `key=value` metadata to each transfer request for server hooks (repeatable)")
+	return func() error {
+		if len(h) == 0 {
+			return nil
+		}
+		md, err := protocol.ParseMetadata(h)
+		if err != nil {
+			return err
+		}
+		// 先按默认限制检查字符集和保留前缀，连接前就能发现拼写错误
+		if err := protocol.DefaultMetadataLimits.Check(md); err != nil {
+			return err
+		}
+		c.metadata = md
+		return nil
+	}
+}
+
+// applyMetadata 确认服务端支持元数据并按它公布的限制校验，然后让连接携带元数据。
+// 旧版服务端会忽略未知的查询参数，为避免元数据被静默丢弃，这里直接报错
+func (c *clientCmd) applyMetadata(cl *client.Client) error {
+	caps, err := cl.Caps()
+	if err != nil {
+		return err
+	}
+	if !caps.HasFeature("metadata") {
+		return errors.New(i18n.T("status.metadata_unsupported"))
+	}
+	limits, err := cl.MetadataLimits()
+	if err != nil {
+		return err
+	}
+	if err := limits.Check(c.metadata); err != nil {
+		return err
+	}
+	return cl.SetMetadata(c.metadata)
+}
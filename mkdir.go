@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：mkdir 命令 ---------- */
+
+func (c *clientCmd) mkdir(args []string) {
+	fs := newFlagSet("client mkdir")
+	args = parseFlags(fs, args)
+	if len(args) < 1 {
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+	remote := args[0]
+	if !strings.HasPrefix(remote, "/") {
+		remote = "/" + remote
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	created, err := cl.Mkdir(remote)
+	if err != nil {
+		var re *client.RemoteError
+		switch {
+		case errors.As(err, &re) && re.Status == http.StatusMethodNotAllowed:
+			fmt.Fprintln(os.Stderr, i18n.T("status.mkdir_unsupported"))
+		case errors.As(err, &re):
+			fmt.Fprintln(os.Stderr, describeErr(err))
+		default:
+			fmt.Fprintln(os.Stderr, i18n.T("status.mkdir_failed", err))
+		}
+		os.Exit(exitCode(err))
+	}
+	c.noteCanonical(cl, remote)
+	if created {
+		fmt.Println(i18n.T("status.mkdir_done", remote))
+	} else {
+		fmt.Println(i18n.T("status.mkdir_exists", remote))
+	}
+}
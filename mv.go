@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：mv 命令 ---------- */
+
+func (c *clientCmd) mv(args []string) {
+	fs := newFlagSet("client mv")
+	force := fs.Bool("f", false, "replace the destination if it already exists")
+	args = parseFlags(fs, args)
+	if len(args) < 2 {
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+	src, dst := args[0], args[1]
+	if !strings.HasPrefix(src, "/") {
+		src = "/" + src
+	}
+	if !strings.HasPrefix(dst, "/") {
+		dst = "/" + dst
+	}
+	if strings.HasSuffix(dst, "/") {
+		// 目标以 / 结尾时移动到该目录下，保留原名
+		dst += src[strings.LastIndex(src, "/")+1:]
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	moved, err := cl.MoveTo(src, dst, *force)
+	if err != nil {
+		var re *client.RemoteError
+		switch {
+		case errors.As(err, &re) && re.Status == http.StatusMethodNotAllowed:
+			fmt.Fprintln(os.Stderr, i18n.T("status.move_unsupported"))
+		case client.IsExists(err):
+			fmt.Fprintln(os.Stderr, i18n.T("status.move_exists", dst))
+		case errors.As(err, &re):
+			fmt.Fprintln(os.Stderr, describeErr(err))
+		default:
+			fmt.Fprintln(os.Stderr, i18n.T("status.move_failed", err))
+		}
+		os.Exit(exitCode(err))
+	}
+	c.noteCanonical(cl, moved)
+	fmt.Println(i18n.T("status.move_done", src, moved))
+}
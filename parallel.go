@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：多连接并发传输 ---------- */
+
+// add -r、get -r、sync 和 pull 的 -P n 同时传输最多 n 个文件。服务端支持流水线时这些传输共用一个连接
+// （见 client.Lane），否则每个传输使用自己的连接。
+// 遍历、建目录和删除仍在第一个连接上依次进行，只有逐个文件的传输分给工作连接；
+// 每行输出都带着文件路径，汇总在所有传输结束后输出
+
+// registerParallel 在 fs 上注册 -P，connect 按它请求流水线
+func (c *clientCmd) registerParallel(fs *flag.FlagSet) *int {
+	c.parallel = fs.Int("P", 1, "transfer up to `n` files at once, pipelined over one connection when the server supports it")
+	return c.parallel
+}
+
+// poolWorker 是一个工作连接。任务可以在连接断开后替换 cl（重新连接）
+type poolWorker struct {
+	cl *client.Client
+}
+
+// runParallel 用最多 n 个连接执行 count 个任务，按下标顺序分发。first 是已有的连接，作为第一个工作连接，
+// 其余连接事先建立：优先是 first 上的 lane，不可用时单独连接，建立失败时少用一个连接继续。
+// work 返回 true 时不再分发新的任务，进行中的任务照常完成。
+// 返回第一个工作连接（可能已被替换），其余连接在返回前关闭
+func (c *clientCmd) runParallel(n int, first *client.Client, count int, work func(w *poolWorker, i int) (stop bool)) *client.Client {
+	workers := []*poolWorker{{cl: first}}
+	conns := 1 // 单独建立的连接数（含 first）
+	for len(workers) < min(n, count) {
+		cl, err := first.Lane()
+		if err == nil {
+			cl.SetProgress(&progressLine{})
+		} else if cl, err = c.dialWorker(); err == nil {
+			conns++
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("status.parallel_dial", len(workers), describeErr(err)))
+			break
+		}
+		workers = append(workers, &poolWorker{cl: cl})
+	}
+	if c.verbose && len(workers) > 1 {
+		fmt.Fprintln(os.Stderr, i18n.T("status.parallel_workers", len(workers), conns, first.Pipelined()))
+	}
+
+	var next atomic.Int64
+	var stopped atomic.Bool
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stopped.Load() {
+				i := int(next.Add(1) - 1)
+				if i >= count {
+					return
+				}
+				if work(w, i) {
+					stopped.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, w := range workers[1:] {
+		w.cl.Close()
+	}
+	return workers[0].cl
+}
+
+// dialWorker 为 -P 建立额外的工作连接，设置与 dial 相同，但失败时返回错误，也不重复输出协商的参数
+func (c *clientCmd) dialWorker() (*client.Client, error) {
+	cl, err := c.connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if len(c.metadata) > 0 {
+		if err := c.applyMetadata(cl); err != nil {
+			cl.Close()
+			return nil, err
+		}
+	}
+	cl.SetOverwrite(c.force)
+	if err := cl.SetPreserve(!c.noPreserve); err != nil {
+		cl.Close()
+		return nil, err
+	}
+	if c.verify {
+		if err := cl.SetVerify(true); err != nil && !errors.Is(err, client.ErrVerifyUnsupported) {
+			cl.Close()
+			return nil, err
+		}
+	}
+	return cl, nil
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 追加上传 ---------- */
+
+// ErrAppendUnsupported 表示服务端不支持追加上传（旧版本）
+var ErrAppendUnsupported = errors.New("the server does not support append uploads")
+
+// Append 把 r 的内容追加到远程文件末尾，文件不存在时创建，返回追加的字节数和追加后的文件大小。
+// 与 Upload 一样分块发送并按 SetVerify 校验；服务端收到完整的正文后才一次写入，
+// 失败时远程文件不变，同时向同一文件追加的其他客户端的内容不会与这次交错
+func (c *Client) Append(remote string, r io.Reader) (*AppendResult, TransferStats, error) {
+	caps, err := c.Caps()
+	if err != nil {
+		return nil, TransferStats{}, err
+	}
+	if !caps.HasFeature("append") {
+		return nil, TransferStats{}, ErrAppendUnsupported
+	}
+	st, body, err := c.upload("POST "+linePath(remote)+"?"+protocol.AppendParam+"=1", r)
+	if err != nil {
+		return nil, st, err
+	}
+	var res AppendResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, st, fmt.Errorf("bad append response: %q", body)
+	}
+	return &res, st, protocol.CheckSchema(res.SchemaVersion)
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 打包下载 ---------- */
+
+// ErrArchiveUnsupported 表示服务端没有 /_archive（旧版本），只能逐个文件下载
+var ErrArchiveUnsupported = errors.New("the server does not support archive downloads")
+
+// ArchiveOptions 是打包下载的参数
+type ArchiveOptions struct {
+	Format        string // protocol.ArchiveTarGz（默认）或 protocol.ArchiveZip
+	StoreSymlinks bool   // 把符号链接作为链接存入归档，默认跳过；服务端从不跟随链接
+}
+
+// DownloadArchive 让服务端把目录 dir 打包，边接收边写入 w，字节进度报告给 TransferReporter（总数未知）。
+// 服务端在打包中途失败时返回摘要和错误，w 中的数据不完整；服务端不支持时返回 ErrArchiveUnsupported。
+// w 写入失败时连接上还有未读完的数据，调用方应当关闭连接
+func (c *Client) DownloadArchive(dir string, opts ArchiveOptions, w io.Writer) (*ArchiveSummary, error) {
+	caps, err := c.Caps()
+	if err != nil {
+		return nil, err
+	}
+	if !caps.HasFeature("archive") {
+		return nil, ErrArchiveUnsupported
+	}
+	q := url.Values{"dir": {dir}}
+	if opts.Format != "" {
+		q.Set("format", opts.Format)
+	}
+	if opts.StoreSymlinks {
+		q.Set("symlinks", "store")
+	}
+	if err := c.sendRequest("GET /_archive?" + q.Encode()); err != nil {
+		return nil, err
+	}
+	status, size, err := c.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if size != protocol.StreamedSize {
+		body, err := c.readBody(size)
+		if err != nil {
+			return nil, err
+		}
+		if status >= 400 {
+			return nil, &RemoteError{Status: status, Body: body}
+		}
+		return nil, fmt.Errorf("unexpected archive response: %q", body)
+	}
+	msgType, payload, err := c.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var h ArchiveHeader
+	if msgType != websocket.TextMessage || json.Unmarshal(payload, &h) != nil {
+		return nil, fmt.Errorf("bad archive header: %q", payload)
+	}
+	if err := protocol.CheckSchema(h.SchemaVersion); err != nil {
+		return nil, err
+	}
+
+	defer c.begin(-1, 0)()
+	out := c.meterWriter(w)
+	for {
+		msgType, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if msgType == websocket.BinaryMessage {
+			if _, err := out.Write(payload); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var sum ArchiveSummary
+		if err := json.Unmarshal(payload, &sum); err != nil {
+			return nil, fmt.Errorf("bad archive summary: %q", payload)
+		}
+		if sum.Error != "" {
+			return &sum, fmt.Errorf("the server could not finish the archive: %s", sum.Error)
+		}
+		return &sum, nil
+	}
+}
+
+/* ---------- 解包上传 ---------- */
+
+// ErrExtractUnsupported 表示服务端不能解包上传的归档（旧版本），需要在本地解开后用 add -r 上传
+var ErrExtractUnsupported = errors.New("the server does not support extracting uploaded archives")
+
+// UploadExtract 上传归档 r（format 为 protocol.ArchiveTarGz 或 protocol.ArchiveZip），由服务端解到目录 remoteDir。
+// 与 Upload 一样分块发送并按 SetVerify 校验，覆盖已有文件的规则与 SetOverwrite 相同。
+// 归档中有不安全或超过服务端限制的条目时返回 *RemoteError（422，APIError.Entry 是条目名），服务端不保留任何解出的内容
+func (c *Client) UploadExtract(remoteDir string, r io.Reader, format string) (*ExtractResult, TransferStats, error) {
+	caps, err := c.Caps()
+	if err != nil {
+		return nil, TransferStats{}, err
+	}
+	if !caps.HasFeature("extract") {
+		return nil, TransferStats{}, ErrExtractUnsupported
+	}
+	req := "POST " + linePath(remoteDir) + "?" + protocol.ExtractParam + "=" + url.QueryEscape(format)
+	st, body, err := c.upload(req, r)
+	if err != nil {
+		return nil, st, err
+	}
+	var res ExtractResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, st, fmt.Errorf("bad extract response: %q", body)
+	}
+	return &res, st, protocol.CheckSchema(res.SchemaVersion)
+}
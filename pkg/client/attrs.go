@@ -0,0 +1,75 @@
+package client
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 保留修改时间与权限 ---------- */
+
+// 开启了保留（见 SetPreserve）时，上传普通文件的请求带上它的修改时间和权限，服务端在提交前设到文件上；
+// DownloadFile 在写完本地文件后设上下载响应给出的修改时间和权限（Windows 上只设修改时间），设置失败不算下载失败。
+// 版本2的下载响应总是带着这两项，Download 在 TransferStats 中给出
+
+// SetPreserve 开关上传和 DownloadFile 保留修改时间和权限。服务端不支持（没有 attrs 特性）时保持关闭，不返回错误：
+// 文件照常传输，只是时间和权限由服务端决定
+func (c *Client) SetPreserve(on bool) error {
+	if !on {
+		c.preserve = false
+		return nil
+	}
+	caps, err := c.Caps()
+	if err != nil {
+		return err
+	}
+	c.preserve = caps.HasFeature("attrs")
+	return nil
+}
+
+// Preserving 报告传输是否保留修改时间和权限，这时远程文件的修改时间与本地一致，可以直接比较
+func (c *Client) Preserving() bool {
+	return c.preserve
+}
+
+// withAttrs 在开启了保留、r 是普通文件时给上传请求行附加它的修改时间和权限
+func (c *Client) withAttrs(req string, r io.Reader) string {
+	if !c.preserve {
+		return req
+	}
+	f, ok := r.(interface{ Stat() (os.FileInfo, error) })
+	if !ok {
+		return req
+	}
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return req
+	}
+	return withQuery(req, protocol.MtimeParam+"="+protocol.FormatMtime(fi.ModTime())+"&"+protocol.ModeParam+"="+protocol.FormatMode(fi.Mode()))
+}
+
+// parseAttrs 记下状态头中的修改时间和权限，格式不对的值当作没有
+func (c *Client) parseAttrs(mtime, mode string) {
+	if t, err := protocol.ParseMtime(mtime); err == nil {
+		c.modTime = t
+	}
+	if m, err := protocol.ParseMode(mode); err == nil {
+		c.mode = m
+	}
+}
+
+// applyAttrs 在开启了保留时把下载响应给出的修改时间和权限设到本地文件上，尽力而为
+func (c *Client) applyAttrs(local string, mtime time.Time, mode fs.FileMode) {
+	if !c.preserve {
+		return
+	}
+	if mode != 0 {
+		chmodPreserved(local, mode)
+	}
+	if !mtime.IsZero() {
+		os.Chtimes(local, mtime, mtime)
+	}
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 上行测速 ---------- */
+
+// ErrBenchUnsupported 表示服务端没有 /_bench/sink（旧版本），无法测速
+var ErrBenchUnsupported = errors.New("the server does not support throughput probes")
+
+// probeRounds 是测速分几轮发送，各轮吞吐的最低和最高值给出估计的范围
+const probeRounds = 4
+
+// Probe 是一次上行测速的结果
+type Probe struct {
+	Bytes    int64         // 实际发送的字节数
+	Elapsed  time.Duration // 各轮的总用时
+	RTT      time.Duration // 空请求的往返时延，每个文件的上传至少要付出一次
+	Min, Max float64       // 各轮中最低和最高的吞吐（字节/秒）
+}
+
+// ProbeUpload 向 /_bench/sink 发送共 size 字节的随机数据测量上行吞吐。数据分 probeRounds 轮发送，
+// 总用时超过 limit 时在当前一轮之后停止（至少完成一轮）。服务端不支持时返回 ErrBenchUnsupported
+func (c *Client) ProbeUpload(size int64, limit time.Duration) (*Probe, error) {
+	caps, err := c.Caps()
+	if err != nil {
+		return nil, err
+	}
+	if !caps.HasFeature("bench") {
+		return nil, ErrBenchUnsupported
+	}
+	p := &Probe{}
+	start := time.Now()
+	if _, _, err := c.post("POST /_bench/sink", &randomReader{}, nil); err != nil {
+		return nil, err
+	}
+	p.RTT = time.Since(start)
+
+	round := min(max(size/probeRounds, 64<<10), protocol.BenchSinkMax)
+	for i := 0; i < probeRounds && (i == 0 || p.Elapsed < limit); i++ {
+		start := time.Now()
+		st, _, err := c.post("POST /_bench/sink", &randomReader{left: round}, nil)
+		if err != nil {
+			return nil, err
+		}
+		d := time.Since(start)
+		// 扣除一次往返，只剩传输数据的时间
+		rate := float64(st.Bytes) / max(d-p.RTT, time.Millisecond).Seconds()
+		if i == 0 || rate < p.Min {
+			p.Min = rate
+		}
+		p.Max = max(p.Max, rate)
+		p.Bytes += st.Bytes
+		p.Elapsed += d
+	}
+	return p, nil
+}
+
+// randomReader 产生 left 字节的伪随机数据，避免链路上的压缩让测速偏快
+type randomReader struct {
+	left int64
+	rng  *rand.ChaCha8
+}
+
+func (r *randomReader) Read(b []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, io.EOF
+	}
+	if r.rng == nil {
+		r.rng = rand.NewChaCha8([32]byte{})
+	}
+	b = b[:min(int64(len(b)), r.left)]
+	n, _ := r.rng.Read(b)
+	r.left -= int64(n)
+	return n, nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package client
+
+import (
+	"io/fs"
+	"os"
+)
+
+// chmodPreserved 把下载响应给出的权限设到本地文件上
+func chmodPreserved(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
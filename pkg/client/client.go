@@ -0,0 +1,551 @@
+// Package client 是 wsbox 的客户端：一条 websocket 连接上依次执行的请求。
+// 命令行的 "wsbox client" 只是它的一层外壳，其他 Go 程序可以直接嵌入：
+//
+//	c, err := client.Dial("ws://127.0.0.1:8080/ws", "secret")
+//	if err != nil { ... }
+//	defer c.Close()
+//	res, err := c.List("/")
+//
+// 连接上的请求严格按顺序执行，一个 Client 不能被多个协程同时使用。
+// 服务端返回的错误状态以 *RemoteError 返回，连接仍可继续使用；其他错误通常表示连接已不可用
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+	"wsbox/internal/throttle"
+)
+
+/* ---------- 响应结构 ---------- */
+
+// 响应体与服务端共用 protocol 包中的定义
+type (
+	Capabilities    = protocol.Capabilities
+	Warning         = protocol.Warning
+	ListResult      = protocol.ListResult
+	ListEntry       = protocol.ListEntry
+	LongListResult  = protocol.LongListResult
+	ListHeader      = protocol.ListHeader
+	ListSummary     = protocol.ListSummary
+	LatestEntry     = protocol.LatestEntry
+	LatestResult    = protocol.LatestResult
+	DuEntry         = protocol.DuEntry
+	DuResult        = protocol.DuResult
+	FindResult      = protocol.FindResult
+	TreeEntry       = protocol.TreeEntry
+	TreeResult      = protocol.TreeResult
+	ArchiveHeader   = protocol.ArchiveHeader
+	ArchiveSummary  = protocol.ArchiveSummary
+	ExtractResult   = protocol.ExtractResult
+	AppendResult    = protocol.AppendResult
+	StatInfo        = protocol.StatInfo
+	Extent          = protocol.Extent
+	ExtentsResult   = protocol.ExtentsResult
+	LockInfo        = protocol.LockInfo
+	MetadataLimits  = protocol.MetadataLimits
+	UploadOffset    = protocol.UploadOffset
+	UploadLimits    = protocol.UploadLimits
+	DirCountsResult = protocol.DirCountsResult
+	ActivityEntry   = protocol.ActivityEntry
+	ActivityResult  = protocol.ActivityResult
+)
+
+/* ---------- 错误 ---------- */
+
+// RemoteError 是服务端返回的错误状态，正文为结构化错误或纯文本
+type RemoteError struct {
+	Status int
+	Body   []byte
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.Message()
+}
+
+// Message 返回服务端错误的可读描述，不带前缀
+func (e *RemoteError) Message() string {
+	return protocol.Describe(e.Body)
+}
+
+// LocalReadError 表示读取本地文件失败，与网络错误区分以便给出对应的提示
+type LocalReadError struct {
+	Err error
+}
+
+func (e *LocalReadError) Error() string { return e.Err.Error() }
+func (e *LocalReadError) Unwrap() error { return e.Err }
+
+// DigestError 表示下载内容的 SHA-256 与服务端提供的不一致。DownloadFile 已删除写入的本地文件，
+// Path 是被删除的文件；Download 写入调用方的 Writer，Path 是远程路径
+type DigestError struct {
+	Path      string
+	Want, Got string
+}
+
+func (e *DigestError) Error() string {
+	return fmt.Sprintf("SHA-256 mismatch for %s: expected %s, got %s", e.Path, e.Want, e.Got)
+}
+
+// TooLargeError 表示上传超过了服务端的大小限制（413）。Limit 是服务端的限制，查询失败时为0
+type TooLargeError struct {
+	Limit int64
+	Err   *RemoteError
+}
+
+func (e *TooLargeError) Error() string { return e.Err.Error() }
+func (e *TooLargeError) Unwrap() error { return e.Err }
+
+// HandshakeError 表示网关拒绝了websocket升级，StatusCode 为 401 时是token不对
+type HandshakeError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("%v (HTTP %s)", websocket.ErrBadHandshake, e.Status)
+}
+
+func (e *HandshakeError) Unwrap() error { return websocket.ErrBadHandshake }
+
+// IsTokenRevoked 判断错误是否因为服务端吊销了本连接使用的token，此时需要用新token重新连接
+func IsTokenRevoked(err error) bool {
+	var ce *websocket.CloseError
+	return errors.As(err, &ce) && ce.Code == protocol.CloseTokenRevoked
+}
+
+// MessageTooBigError 表示不分块上传的文件超过了服务端的单帧上限，在发送之前就已拒绝，连接仍然可用
+type MessageTooBigError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e *MessageTooBigError) Error() string {
+	return fmt.Sprintf("message of %d bytes exceeds the server limit of %d bytes", e.Size, e.Limit)
+}
+
+// IsMessageTooBig 判断错误是否因为发出的消息超过了服务端的单帧上限（-max-message-size）：
+// 服务端以 1009 关闭了连接，或者客户端在发送前就发现会超过（*MessageTooBigError）
+func IsMessageTooBig(err error) bool {
+	var ce *websocket.CloseError
+	var me *MessageTooBigError
+	return errors.As(err, &me) || errors.As(err, &ce) && ce.Code == protocol.CloseMessageTooBig
+}
+
+// IsResponseTooBig 判断错误是否因为服务端发来的消息超过了 Options.MaxMessageSize，连接已关闭
+func IsResponseTooBig(err error) bool {
+	return errors.Is(err, websocket.ErrReadLimit)
+}
+
+// IsServerShutdown 判断错误是否因为服务端正在关闭而关闭了连接，稍后重新连接即可（通常连到新实例）
+func IsServerShutdown(err error) bool {
+	var ce *websocket.CloseError
+	return errors.As(err, &ce) && ce.Code == protocol.CloseGoingAway
+}
+
+// IsReadOnly 判断错误是否因为服务端以只读模式运行而拒绝了写操作
+func IsReadOnly(err error) bool {
+	var re *RemoteError
+	if !errors.As(err, &re) || re.Status != http.StatusForbidden {
+		return false
+	}
+	var e protocol.APIError
+	return json.Unmarshal(re.Body, &e) == nil && e.Code == protocol.ReadOnlyCode
+}
+
+// IsBusy 判断错误是否因为服务端的重操作（目录树遍历、递归删除）已达并发和排队上限，稍后重试即可
+func IsBusy(err error) bool {
+	var re *RemoteError
+	if !errors.As(err, &re) || re.Status != http.StatusTooManyRequests {
+		return false
+	}
+	var e protocol.APIError
+	return json.Unmarshal(re.Body, &e) == nil && e.Code == protocol.BusyCode
+}
+
+// IsExists 判断错误是否因为远程文件已存在、服务端不允许覆盖（-overwrite deny），见 SetOverwrite
+func IsExists(err error) bool {
+	var re *RemoteError
+	if !errors.As(err, &re) || re.Status != http.StatusConflict {
+		return false
+	}
+	var e protocol.APIError
+	return json.Unmarshal(re.Body, &e) == nil && e.Code == protocol.ExistsCode
+}
+
+// IsConnectionLost 判断错误是否因为连接无法使用（网络错误、连接被关闭或中断），而不是服务端返回的错误状态；
+// token被吊销导致的关闭不算在内，见 IsTokenRevoked。本地文件的错误也不算：syscall.Errno 同样满足 net.Error
+func IsConnectionLost(err error) bool {
+	var pe *fs.PathError
+	if IsTokenRevoked(err) || errors.As(err, &pe) {
+		return false
+	}
+	var ce *websocket.CloseError
+	var ne net.Error
+	return errors.As(err, &ce) || errors.As(err, &ne) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// closeCause 在写入失败后尝试读出服务端发来的关闭帧，它说明了连接被关闭的原因（如token被吊销）；
+// 没有关闭帧时返回原来的错误
+func (c *Client) closeCause(err error) error {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, _, rerr := c.conn.ReadMessage()
+		var ce *websocket.CloseError
+		if errors.As(rerr, &ce) {
+			return rerr
+		}
+		if rerr != nil {
+			return err
+		}
+	}
+}
+
+/* ---------- 连接 ---------- */
+
+// FlowWindow 是客户端请求的下载流控窗口（块），服务端可能协商为更小的值
+const FlowWindow = 16
+
+// ProgressReporter 显示服务端在长时间操作期间发来的进度帧
+type ProgressReporter interface {
+	Show(phase string, done int64)
+	Clear()
+}
+
+// TransferReporter 显示文件上传、下载正文的字节进度。列表等普通请求的响应不报告
+type TransferReporter interface {
+	// Begin 在一次传输开始时调用：total 是文件的总字节数（未知时为 -1），done 是续传时已经传输过的字节数
+	Begin(total, done int64)
+	// Advance 在每发送或写入 n 字节正文后调用
+	Advance(n int64)
+	// End 在传输结束时调用，无论成功与否
+	End()
+}
+
+// Options 是建立连接时的可选参数
+type Options struct {
+	TLSConfig *tls.Config      // wss:// 使用的TLS配置，为 nil 时使用系统信任的根证书
+	Progress  ProgressReporter // 为 nil 时不显示进度
+	Transfer  TransferReporter // 为 nil 时不报告传输进度
+
+	// 以下开关让连接不请求对应的协商，回到旧版的帧格式，用于排查中间设备问题和兼容性矩阵
+	NoFlowControl bool
+	NoStreaming   bool
+	NoProgress    bool
+	NoCanonical   bool
+
+	// LegacyProtocol 让连接只使用协议版本1的文本请求行和状态头（见 protocol.VersionHeader）
+	LegacyProtocol bool
+
+	// Pipeline 大于0时请求流水线：这条连接上最多 Pipeline 个请求同时进行（见 Client.Lane），服务端可能协商为更小的值。
+	// 为0时请求严格依次进行，与旧版服务端相同
+	Pipeline int
+
+	// PingInterval 是在连接上发送 websocket Ping 的间隔，让代理和服务端的 -idle-timeout 不把空闲的连接当作断开；
+	// 0 表示使用 protocol.PingInterval，负数表示不发送
+	PingInterval time.Duration
+
+	// ConnectTimeout 限制建立连接的时间，OpTimeout 限制等待响应的时间，StallTimeout 限制传输中没有任何帧的时间，
+	// 超过时返回 *TimeoutError（见 timeout.go）；0表示不限
+	ConnectTimeout time.Duration
+	OpTimeout      time.Duration
+	StallTimeout   time.Duration
+
+	// Proxy 返回连接要经过的代理（见 proxy.go），为 nil 时按 HTTPS_PROXY、HTTP_PROXY 和 NO_PROXY 选择
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// MaxMessageSize 大于0时限制从服务端读取的单个websocket消息的字节数，超过时连接以 1009 关闭并返回
+	// IsResponseTooBig 为真的错误；不能小于 protocol.MinMessageSize。未协商流控时下载的文件整个在一帧里，也受它限制
+	MaxMessageSize int64
+
+	// BandwidthLimit 大于0时限制这条连接每秒传输的正文字节数（上传和下载合计，流水线的各个 lane 共用），0表示不限
+	BandwidthLimit int64
+}
+
+// Client 是一条已建立的连接
+type Client struct {
+	conn      frameConn // 流水线连接上是一个 lane
+	mux       *mux      // 协商了流水线时共用连接的各个 lane，否则为 nil
+	window    int       // 下载流控窗口，0表示单帧响应
+	stream    bool      // 是否支持分块上传
+	maxMsg    int64     // 服务端接受的单帧上限（protocol.MaxMessageHeader），0表示不限
+	version   int       // 协议版本，决定请求帧和状态头的格式
+	progress  ProgressReporter
+	transfer  TransferReporter
+	metadata  string      // 附加到上传和下载请求的元数据查询参数，已编码
+	verify    bool        // 上传时声明、下载后核对 SHA-256
+	force     bool        // 上传时要求覆盖已有文件（overwrite=1）
+	trailer   bool        // 服务端接受在分块上传的结束标记中给出摘要（sha256-trailer）
+	digest    string      // 最近一个状态头中服务端附带的文件摘要
+	canonical string      // 最近一个状态头中服务端附带的规范路径
+	preserve  bool        // 上传时带上文件的修改时间和权限（见 attrs.go）
+	modTime   time.Time   // 最近一个状态头中下载文件的修改时间，没有时为零值
+	mode      fs.FileMode // 最近一个状态头中下载文件的权限，没有时为0
+	stopPing  func()
+
+	bw *throttle.Limiter // Options.BandwidthLimit，流水线的各个 lane 共用，nil 表示不限
+
+	opTimeout, stallTimeout time.Duration // Options.OpTimeout 和 StallTimeout，Lane 用它们包装新的 lane
+}
+
+// Dial 使用默认选项连接服务端，见 DialContext
+func Dial(rawURL, token string) (*Client, error) {
+	return DialContext(context.Background(), rawURL, token, Options{})
+}
+
+// DialContext 连接服务端并协商流控、分块上传和进度帧。token 为空时使用URL中的用户名（ws://token@host/ws），
+// URL中的凭据不会发送到请求行里。ws+unix:///run/wsbox.sock:/ws 经由 Unix 域套接字连接，见 unix.go
+func DialContext(ctx context.Context, rawURL, token string, opts Options) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.User != nil {
+		if token == "" {
+			token = u.User.Username()
+		}
+		u.User = nil
+	}
+	socket, u, err := unixTarget(u)
+	if err != nil {
+		return nil, err
+	}
+	h := http.Header{}
+	if token != "" {
+		h.Set("Authorization", "Bearer "+token)
+	}
+	if !opts.NoFlowControl {
+		h.Set(protocol.FlowHeader, strconv.Itoa(FlowWindow))
+	}
+	if !opts.NoStreaming {
+		h.Set(protocol.StreamHeader, "1")
+	}
+	if !opts.NoProgress {
+		h.Set(protocol.ProgressHeader, "1")
+	}
+	if !opts.NoCanonical {
+		h.Set(protocol.CanonicalHeader, "1")
+	}
+	if opts.Pipeline > 0 {
+		h.Set(protocol.PipelineHeader, strconv.Itoa(opts.Pipeline))
+	}
+	if !opts.LegacyProtocol {
+		h.Set(protocol.VersionHeader, strconv.Itoa(protocol.Version))
+	}
+
+	if opts.MaxMessageSize > 0 && opts.MaxMessageSize < protocol.MinMessageSize {
+		return nil, fmt.Errorf("max message size %d is below the protocol minimum of %d bytes", opts.MaxMessageSize, protocol.MinMessageSize)
+	}
+
+	d := *websocket.DefaultDialer
+	d.TLSClientConfig = opts.TLSConfig
+	d.HandshakeTimeout = max(opts.ConnectTimeout, 0)
+	// 代理由 proxyDialer 处理，失败时能与服务端的拒绝区分开；Unix 域套接字不经过代理
+	d.Proxy = nil
+	if socket != "" {
+		d.NetDialContext = unixDialer(socket)
+	} else {
+		proxy, err := proxyFor(u, opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		if proxy != nil {
+			d.NetDialContext = proxyDialer(proxy)
+		}
+	}
+	conn, resp, err := d.DialContext(ctx, u.String(), h)
+	if err != nil {
+		var pe *ProxyError
+		if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+			return nil, &HandshakeError{StatusCode: resp.StatusCode, Status: resp.Status}
+		}
+		if errors.As(err, &pe) {
+			return nil, err
+		}
+		if opts.ConnectTimeout > 0 && (isTimeout(err) || errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil) {
+			return nil, &TimeoutError{Phase: PhaseConnect, Timeout: opts.ConnectTimeout, Err: err}
+		}
+		return nil, err
+	}
+	if opts.MaxMessageSize > 0 {
+		conn.SetReadLimit(opts.MaxMessageSize)
+	}
+	c := &Client{conn: conn, progress: opts.Progress, transfer: opts.Transfer, bw: throttle.New(opts.BandwidthLimit),
+		opTimeout: opts.OpTimeout, stallTimeout: opts.StallTimeout}
+	if n, _ := strconv.Atoi(resp.Header.Get(protocol.PipelineHeader)); n > 0 && opts.Pipeline > 0 {
+		c.mux = newMux(conn, n)
+		c.conn, _ = c.mux.lane(true)
+	}
+	c.conn = withTimeouts(c.conn, c.opTimeout, c.stallTimeout)
+	c.window, _ = strconv.Atoi(resp.Header.Get(protocol.FlowHeader))
+	c.stream = resp.Header.Get(protocol.StreamHeader) == "1"
+	c.maxMsg, _ = strconv.ParseInt(resp.Header.Get(protocol.MaxMessageHeader), 10, 64)
+	c.version = protocol.LegacyVersion
+	if v, _ := strconv.Atoi(resp.Header.Get(protocol.VersionHeader)); v > protocol.LegacyVersion && !opts.LegacyProtocol {
+		c.version = min(v, protocol.Version)
+	}
+	interval := opts.PingInterval
+	if interval == 0 {
+		interval = protocol.PingInterval
+	}
+	c.stopPing = c.startPing(interval)
+	return c, nil
+}
+
+// startPing 每隔 interval 发送一个 Ping，直到返回的函数被调用或写入失败。
+// Ping 由 WriteControl 写出，可以与请求并发；服务端的 Pong 在下一次读取响应时被处理，不影响请求的顺序
+func (c *Client) startPing(interval time.Duration) (stop func()) {
+	if interval < 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)) != nil {
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func (c *Client) Close() error {
+	c.stopPing()
+	return c.conn.Close()
+}
+
+// Shutdown 先发送关闭帧（1000 正常关闭）并等待服务端回应的关闭帧（最多一秒），再关闭连接，
+// 服务端因此能区分客户端正常退出和连接中断。不能与其他请求并发调用；连接已经断开时与 Close 相同
+func (c *Client) Shutdown() error {
+	c.stopPing()
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)) == nil {
+		c.conn.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			if _, _, err := c.conn.ReadMessage(); err != nil {
+				break
+			}
+		}
+	}
+	return c.conn.Close()
+}
+
+// Window 返回协商的下载流控窗口（块），0表示服务端不支持流控，响应以单帧发送
+func (c *Client) Window() int {
+	return c.window
+}
+
+// CanonicalPath 在最近一个请求经过服务端的路径别名时返回规范路径，否则为空。
+// 脚本中保存的旧路径应当更新为它，服务端随时可能去掉别名
+func (c *Client) CanonicalPath() string {
+	return c.canonical
+}
+
+// Streaming 报告服务端是否支持分块上传，不支持时上传的文件整个放在一帧里
+func (c *Client) Streaming() bool {
+	return c.stream
+}
+
+// SetDeadline 设置连接读写的截止时间，零值表示不限
+func (c *Client) SetDeadline(t time.Time) {
+	c.conn.SetReadDeadline(t)
+	c.conn.SetWriteDeadline(t)
+}
+
+// SetMetadata 设置之后每个上传和下载请求携带的元数据，nil 表示不再携带。
+// 这里只校验键的字符集、保留前缀和默认限制；服务端的实际限制可以用 MetadataLimits 查询
+func (c *Client) SetMetadata(md map[string]string) error {
+	if err := protocol.DefaultMetadataLimits.Check(md); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	q := make([]string, 0, len(keys))
+	for _, k := range keys {
+		q = append(q, protocol.MetadataParam+"="+url.QueryEscape(k+"="+md[k]))
+	}
+	c.metadata = strings.Join(q, "&")
+	return nil
+}
+
+// SetOverwrite 为 true 时上传请求带 overwrite=1，在不允许覆盖的服务端上也替换已有文件。
+// 允许覆盖的服务端和旧版服务端忽略这个参数
+func (c *Client) SetOverwrite(force bool) {
+	c.force = force
+}
+
+// SetTransfer 替换连接建立时 Options.Transfer 给出的传输进度显示，nil 表示不再报告。
+// 在一个连接上依次传输多个文件、每个文件使用自己的进度条时调用
+func (c *Client) SetTransfer(t TransferReporter) {
+	c.transfer = t
+}
+
+// SetProgress 替换连接建立时 Options.Progress 给出的进度显示，如为 Lane 返回的 Client 换上自己的
+func (c *Client) SetProgress(p ProgressReporter) {
+	c.progress = p
+}
+
+// uploadLine 为上传请求行附加元数据和覆盖参数
+func (c *Client) uploadLine(req string) string {
+	if c.force {
+		req = withQuery(req, protocol.OverwriteParam+"=1")
+	}
+	return c.withMetadata(req)
+}
+
+// withMetadata 把元数据追加到请求行的查询参数中
+func (c *Client) withMetadata(req string) string {
+	return withQuery(req, c.metadata)
+}
+
+// withQuery 把已编码的查询参数附加到请求行
+func withQuery(req, q string) string {
+	if q == "" {
+		return req
+	}
+	if strings.Contains(req, "?") {
+		return req + "&" + q
+	}
+	return req + "?" + q
+}
+
+// remotePath 补全远程路径开头的 "/"
+func remotePath(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		return "/" + p
+	}
+	return p
+}
+
+// linePath 返回放进请求行的转义路径，空格、#、% 等字符不会截断请求行或被当作查询参数
+func linePath(p string) string {
+	u := url.URL{Path: remotePath(p)}
+	return u.EscapedPath()
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"errors"
+	"time"
+)
+
+/* ---------- 时钟偏差 ---------- */
+
+// ClockSkewWarn 是值得提醒用户的时钟偏差，小于它的偏差通常来自没有及时同步的 NTP
+const ClockSkewWarn = 30 * time.Second
+
+// ClockEstimate 是对服务端时钟的一次估计
+type ClockEstimate struct {
+	Offset time.Duration // 服务端时钟减去本机时钟，正值表示服务端走得快
+	RTT    time.Duration // 所用样本的往返时间，Offset 的误差不超过它的一半
+}
+
+// ToLocal 把服务端时钟上的时刻换算到本机时钟
+func (e ClockEstimate) ToLocal(t time.Time) time.Time {
+	return t.Add(-e.Offset)
+}
+
+// clockSample 是一次 /_caps 请求：发出和收到响应的本机时间，以及响应中的服务端时间
+type clockSample struct {
+	sent, received, server time.Time
+}
+
+// estimateClock 取往返时间最短的样本，假设请求和响应在路上的时间相同，服务端时间对应往返的中点。
+// 排队和重传只会拉长往返，最短的样本误差最小
+func estimateClock(samples []clockSample) (ClockEstimate, error) {
+	var best ClockEstimate
+	found := false
+	for _, s := range samples {
+		if s.server.IsZero() {
+			continue
+		}
+		rtt := s.received.Sub(s.sent)
+		if found && rtt >= best.RTT {
+			continue
+		}
+		best = ClockEstimate{Offset: s.server.Sub(s.sent.Add(rtt / 2)), RTT: rtt}
+		found = true
+	}
+	if !found {
+		return ClockEstimate{}, errors.New("the server does not report its time")
+	}
+	return best, nil
+}
+
+// ClockOffset 用 samples 次 /_caps 请求估计服务端与本机的时钟偏差，用于比较远程和本地文件的修改时间
+func (c *Client) ClockOffset(samples int) (ClockEstimate, error) {
+	var list []clockSample
+	for range max(samples, 1) {
+		sent := time.Now()
+		caps, err := c.Caps()
+		if err != nil {
+			return ClockEstimate{}, err
+		}
+		list = append(list, clockSample{sent: sent, received: time.Now(), server: caps.ServerTime})
+	}
+	return estimateClock(list)
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+// skewedServer 是一个只回答 /_caps 的版本1网关，报告的时间比本机快 skew。
+// 第 i 个请求在读取时间之前先等 delays[i%len(delays)]，模拟请求在路上排队：这段时间只出现在往返的一侧
+func skewedServer(t *testing.T, skew time.Duration, delays ...time.Duration) string {
+	t.Helper()
+	var mu sync.Mutex
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := new(websocket.Upgrader).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(string(msg), "GET /_caps") {
+				conn.WriteMessage(websocket.TextMessage, []byte("404 0"))
+				conn.WriteMessage(websocket.BinaryMessage, nil)
+				continue
+			}
+			mu.Lock()
+			var d time.Duration
+			if len(delays) > 0 {
+				d = delays[n%len(delays)]
+			}
+			n++
+			mu.Unlock()
+			time.Sleep(d)
+			body, _ := json.Marshal(protocol.Capabilities{SchemaVersion: protocol.SchemaVersion, ServerTime: time.Now().Add(skew).UTC()})
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("200 %d", len(body))))
+			conn.WriteMessage(websocket.BinaryMessage, body)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+// 对快或慢几分钟的服务端，估计的偏差与实际相差不超过所用样本往返时间的一半
+func TestClockOffsetSkewedServer(t *testing.T) {
+	for _, skew := range []time.Duration{0, 3 * time.Minute, -7*time.Minute - 250*time.Millisecond, 26 * time.Hour} {
+		cl, err := Dial(skewedServer(t, skew), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		est, err := cl.ClockOffset(4)
+		cl.Close()
+		if err != nil {
+			t.Fatalf("skew %v: %v", skew, err)
+		}
+		if diff := (est.Offset - skew).Abs(); diff > est.RTT/2+time.Millisecond {
+			t.Errorf("skew %v: estimated %v (rtt %v), off by %v", skew, est.Offset, est.RTT, diff)
+		}
+		// 服务端上的"现在"换算回本机时钟是本机的现在
+		if d := time.Since(est.ToLocal(time.Now().Add(skew))).Abs(); d > est.RTT/2+10*time.Millisecond {
+			t.Errorf("skew %v: ToLocal is off by %v", skew, d)
+		}
+	}
+}
+
+// 排队只拉长部分样本的往返：估计取最短的那个，不被排队带偏
+func TestClockOffsetPicksFastestSample(t *testing.T) {
+	const skew = 90 * time.Second
+	queued := 120 * time.Millisecond
+	cl, err := Dial(skewedServer(t, skew, queued, queued, 0, queued), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	est, err := cl.ClockOffset(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.RTT >= queued {
+		t.Errorf("used a queued sample with rtt %v", est.RTT)
+	}
+	// 用排队的样本会偏出约 queued/2 = 60ms
+	if diff := (est.Offset - skew).Abs(); diff > est.RTT/2+time.Millisecond {
+		t.Errorf("estimated %v, off by %v (rtt %v)", est.Offset, diff, est.RTT)
+	}
+}
+
+func TestEstimateClock(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+	skew := 5 * time.Minute
+	est, err := estimateClock([]clockSample{
+		{sent: at(0), received: at(100), server: at(80).Add(skew)},    // 往返 100ms，响应排队
+		{sent: at(200), received: at(220), server: at(210).Add(skew)}, // 往返 20ms，对称
+		{sent: at(300), received: at(400), server: at(310).Add(skew)}, // 往返 100ms，请求排队
+		{sent: at(500), received: at(505)},                            // 没有服务端时间（旧服务端）
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Offset != skew || est.RTT != 20*time.Millisecond {
+		t.Errorf("estimate = %+v, want offset %v from the 20ms sample", est, skew)
+	}
+	if _, err := estimateClock([]clockSample{{sent: at(0), received: at(10)}}); err == nil {
+		t.Error("estimated a clock from a server that does not report its time")
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 完整性校验 ---------- */
+
+// ErrVerifyUnsupported 表示服务端不支持 SHA-256 校验，传输仍可进行但不经核对
+var ErrVerifyUnsupported = errors.New("the server does not support SHA-256 verification")
+
+// SetVerify 开关传输的完整性校验：上传时声明内容的 SHA-256，服务端不一致时拒绝；
+// 下载时请求服务端的文件摘要，写完本地文件后核对，不一致时删除本地文件并返回 *DigestError。
+// 服务端不支持时返回 ErrVerifyUnsupported，校验保持关闭
+func (c *Client) SetVerify(on bool) error {
+	if !on {
+		c.verify = false
+		return nil
+	}
+	caps, err := c.Caps()
+	if err != nil {
+		return err
+	}
+	if !caps.HasFeature("sha256") {
+		return ErrVerifyUnsupported
+	}
+	c.verify = true
+	c.trailer = caps.HasFeature("sha256-trailer")
+	return nil
+}
+
+// streamDigest 报告上传能否边发送边计算摘要、在结束标记中给出，这样本地文件只需读一遍
+func (c *Client) streamDigest() bool {
+	return c.verify && c.trailer && c.stream
+}
+
+// wantDigest 返回下载请求要附加的查询参数，未开启校验时为空
+func (c *Client) wantDigest() string {
+	if !c.verify {
+		return ""
+	}
+	return protocol.WantDigestParam + "=sha256"
+}
+
+// digestFrom 计算 r 从当前位置到结尾（或 n 字节，n 小于0时不限）的 SHA-256，然后回到原来的位置
+func digestFrom(r io.ReadSeeker, n int64) (string, error) {
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if n < 0 {
+		_, err = io.Copy(h, r)
+	} else {
+		_, err = io.CopyN(h, r, n)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkFile 核对写完的本地文件与服务端的摘要，不一致时删除文件。want 为空（服务端没有提供）时不核对，返回 false
+func checkFile(name, want string) (bool, error) {
+	if want == "" {
+		return false, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	got, err := digestFrom(f, -1)
+	f.Close()
+	if err != nil {
+		return false, err
+	}
+	if got != want {
+		os.Remove(name)
+		return false, &DigestError{Path: name, Want: want, Got: got}
+	}
+	return true, nil
+}
@@ -0,0 +1,243 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 响应：状态头与流控正文 ---------- */
+
+// errUnexpectedStream 表示只接受普通响应的请求收到了流式响应
+var errUnexpectedStream = errors.New("unexpected streamed response")
+
+// TransferStats 记录一次传输的统计
+type TransferStats struct {
+	Bytes    int64       // 实际传输的正文字节数
+	Chunks   int         // 正文帧数
+	Acks     int         // 发出的流控确认数
+	Size     int64       // 文件大小，稀疏下载时可能大于 Bytes
+	Extents  int         // 稀疏下载的数据区段数，整体下载时为0
+	Resumed  int64       // 续传时已经传输过、这次跳过的字节数
+	Verified bool        // 内容的 SHA-256 已与服务端核对一致
+	SHA256   string      // 核对过的 SHA-256（十六进制），Verified 为 false 时为空
+	ModTime  time.Time   // 下载文件在服务端的修改时间，旧版服务端不提供时为零值
+	Mode     fs.FileMode // 下载文件在服务端的权限，不提供时为0
+}
+
+// ackEvery 返回客户端发送确认的间隔，保证窗口耗尽前至少确认一次
+func ackEvery(window int) int {
+	if window < 2 {
+		return 1
+	}
+	return window / 2
+}
+
+// readHeader 读取响应的状态头，跳过之前的进度帧。版本2的连接上是 JSON 的 protocol.ResponseHeader，
+// 版本1是 "status len"，len 为 protocol.StreamedSize 表示流式列表。
+// 请求了摘要的下载响应还有第三个字段，记在 c.digest 中；经过服务端别名的响应最后还有规范路径，记在 c.canonical 中。
+// 版本2的下载响应还带着文件的修改时间和权限，记在 c.modTime 和 c.mode 中。
+// 收到进度帧后按 protocol.ProgressIdleTimeout 设置读超时，拿到状态头后恢复
+func (c *Client) readHeader() (int, int64, error) {
+	var headerMsg []byte
+	c.digest, c.canonical = "", ""
+	c.modTime, c.mode = time.Time{}, 0
+	shown := false
+	defer func() {
+		if shown {
+			c.progress.Clear()
+		}
+	}()
+	for alive := false; ; alive = true {
+		msgType, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			return 0, 0, err
+		}
+		var f protocol.ProgressFrame
+		ok := false
+		if msgType == websocket.TextMessage {
+			f, ok = protocol.ParseProgress(payload)
+		}
+		if !ok {
+			if alive {
+				c.conn.SetReadDeadline(time.Time{})
+			}
+			c.awaitResponse(false)
+			headerMsg = payload
+			break
+		}
+		c.conn.SetReadDeadline(time.Now().Add(protocol.ProgressIdleTimeout))
+		if c.progress != nil {
+			c.progress.Show(f.Progress.Phase, f.Progress.Done)
+			shown = true
+		}
+	}
+	if msg, ok := strings.CutPrefix(string(headerMsg), "ERR "); ok {
+		// 旧版服务端转发失败时只发送这一帧，没有正文
+		return 0, 0, &RemoteError{Status: http.StatusBadGateway, Body: []byte(msg)}
+	}
+	if c.version >= protocol.Version {
+		var h protocol.ResponseHeader
+		if err := json.Unmarshal(headerMsg, &h); err != nil || h.Size < protocol.StreamedSize {
+			return 0, 0, fmt.Errorf("bad header: %s", headerMsg)
+		}
+		if protocol.ValidDigest(h.SHA256) {
+			c.digest = h.SHA256
+		}
+		c.canonical = h.Canonical
+		c.parseAttrs(h.MTime, h.Mode)
+		return h.Status, h.Size, nil
+	}
+	parts := strings.Fields(string(headerMsg))
+	if n := len(parts); n > 2 && strings.HasPrefix(parts[n-1], protocol.CanonicalField) {
+		c.canonical, _ = url.PathUnescape(strings.TrimPrefix(parts[n-1], protocol.CanonicalField))
+		parts = parts[:n-1]
+	}
+	if len(parts) == 3 && protocol.ValidDigest(parts[2]) {
+		c.digest, parts = parts[2], parts[:2]
+	}
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("bad header: %s", headerMsg)
+	}
+	status, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad header: %s", headerMsg)
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || size < protocol.StreamedSize {
+		return 0, 0, fmt.Errorf("bad header: %s", headerMsg)
+	}
+	return status, size, nil
+}
+
+// readBody 读取状态头之后 size 字节的正文，兼容流控与单帧两种连接，只用于较小的响应正文
+func (c *Client) readBody(size int64) ([]byte, error) {
+	if c.window == 0 {
+		_, body, err := c.conn.ReadMessage()
+		return body, err
+	}
+	var buf bytes.Buffer
+	_, err := c.recvChunked(size, &buf)
+	return buf.Bytes(), err
+}
+
+// readResponse 读取一个完整的响应
+func (c *Client) readResponse() (int, []byte, error) {
+	status, size, err := c.readHeader()
+	if err != nil {
+		return 0, nil, err
+	}
+	if size == protocol.StreamedSize {
+		return 0, nil, errUnexpectedStream
+	}
+	body, err := c.readBody(size)
+	return status, body, err
+}
+
+// roundTrip 发送一个请求（可带单帧正文）并读取完整的响应
+func (c *Client) roundTrip(req string, body []byte) (int, []byte, error) {
+	if err := c.sendRequest(req); err != nil {
+		return 0, nil, err
+	}
+	if body != nil {
+		if err := c.conn.WriteMessage(websocket.BinaryMessage, body); err != nil {
+			// 服务端可能因为正文帧超过上限而关闭了连接，关闭帧说明了原因
+			return 0, nil, c.closeCause(err)
+		}
+	}
+	return c.readResponse()
+}
+
+// request 发送一个没有正文的请求并返回成功响应的正文，错误状态以 *RemoteError 返回
+func (c *Client) request(req string) ([]byte, error) {
+	status, body, err := c.roundTrip(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status >= 400 {
+		return nil, &RemoteError{Status: status, Body: body}
+	}
+	return body, nil
+}
+
+// receive 发送请求并把成功响应的正文写入 open 返回的 Writer，open 在得知正文长度后调用。
+// 兼容流控与单帧两种连接，错误状态以 *RemoteError 返回
+func (c *Client) receive(req string, open func(size int64) (io.Writer, error)) (TransferStats, error) {
+	if c.window == 0 {
+		body, err := c.request(req)
+		if err != nil {
+			return TransferStats{}, err
+		}
+		w, err := open(int64(len(body)))
+		if err != nil {
+			return TransferStats{}, err
+		}
+		_, err = w.Write(body)
+		return TransferStats{Chunks: 1, Bytes: int64(len(body))}, err
+	}
+	if err := c.sendRequest(req); err != nil {
+		return TransferStats{}, err
+	}
+	status, size, err := c.readHeader()
+	if err != nil {
+		return TransferStats{}, err
+	}
+	if size == protocol.StreamedSize {
+		return TransferStats{}, errUnexpectedStream
+	}
+	if status >= 400 {
+		var buf bytes.Buffer
+		if _, err := c.recvChunked(size, &buf); err != nil {
+			return TransferStats{}, err
+		}
+		return TransferStats{}, &RemoteError{Status: status, Body: buf.Bytes()}
+	}
+	w, err := open(size)
+	if err != nil {
+		return TransferStats{}, err
+	}
+	return c.recvChunked(size, w)
+}
+
+// recvChunked 接收 size 字节的分块正文写入 w，每收到 ackEvery(window) 块确认一次。
+// 最后一块不再确认，避免遗留的确认帧被当作下一个请求
+func (c *Client) recvChunked(size int64, w io.Writer) (TransferStats, error) {
+	var st TransferStats
+	every := ackEvery(c.window)
+	for st.Chunks == 0 || st.Bytes < size {
+		msgType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return st, err
+		}
+		if msgType != websocket.BinaryMessage {
+			return st, fmt.Errorf("unexpected frame during transfer: %q", data)
+		}
+		st.Chunks++
+		st.Bytes += int64(len(data))
+		if st.Bytes > size {
+			return st, fmt.Errorf("server sent %d bytes, expected %d", st.Bytes, size)
+		}
+		if _, err := w.Write(data); err != nil {
+			return st, err
+		}
+		if st.Bytes < size && st.Chunks%every == 0 {
+			if err := c.conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("ACK %d", st.Chunks))); err != nil {
+				return st, err
+			}
+			st.Acks++
+		}
+	}
+	return st, nil
+}
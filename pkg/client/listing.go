@@ -0,0 +1,340 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 目录列表 ---------- */
+
+// Caps 查询服务端支持的协议特性和服务端时间
+func (c *Client) Caps() (*Capabilities, error) {
+	body, err := c.request("GET /_caps")
+	if err != nil {
+		return nil, err
+	}
+	var caps Capabilities
+	if err := json.Unmarshal(body, &caps); err != nil {
+		return nil, err
+	}
+	if err := protocol.CheckSchema(caps.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// MetadataLimits 查询服务端接受的请求元数据限制，不支持元数据的旧服务端返回错误
+func (c *Client) MetadataLimits() (*MetadataLimits, error) {
+	body, err := c.request("GET /_caps/metadata")
+	if err != nil {
+		return nil, err
+	}
+	var l MetadataLimits
+	if err := json.Unmarshal(body, &l); err != nil {
+		return nil, err
+	}
+	if err := protocol.CheckSchema(l.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// List 返回目录的直接条目（目录以 "/" 结尾），按名字排序；超出服务端的遍历预算时 Truncated 为 true。
+// 兼容只返回名字数组的旧服务端
+func (c *Client) List(dir string) (*ListResult, error) {
+	body, err := c.request("GET /_list?format=object&dir=" + url.QueryEscape(dir))
+	if err != nil {
+		return nil, err
+	}
+	return parseList(body)
+}
+
+func parseList(body []byte) (*ListResult, error) {
+	var res ListResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		// 旧服务端忽略 format 参数，直接返回名字数组
+		var names []string
+		if json.Unmarshal(body, &names) != nil {
+			return nil, err
+		}
+		return &ListResult{Entries: names}, nil
+	}
+	if err := protocol.CheckSchema(res.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListLong 返回目录的直接条目及其大小、修改时间和权限，按名字排序。
+// 旧服务端不认识 format=long，返回名字数组，此时条目只有 Name 和 Dir
+func (c *Client) ListLong(dir string) (*LongListResult, error) {
+	body, err := c.request("GET /_list?format=long&dir=" + url.QueryEscape(dir))
+	if err != nil {
+		return nil, err
+	}
+	var res LongListResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		var names []string
+		if json.Unmarshal(body, &names) != nil {
+			return nil, err
+		}
+		res.Entries = []ListEntry{}
+		for _, n := range names {
+			name, isDir := strings.CutSuffix(n, "/")
+			res.Entries = append(res.Entries, ListEntry{Name: name, Dir: isDir})
+		}
+		return &res, nil
+	}
+	if err := protocol.CheckSchema(res.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Latest 递归列出目录下最近修改的 n 个文件，按修改时间从新到旧排列
+func (c *Client) Latest(dir string, n int) (*LatestResult, error) {
+	body, err := c.request(fmt.Sprintf("GET /_latest?n=%d&dir=%s", n, url.QueryEscape(dir)))
+	if err != nil {
+		return nil, err
+	}
+	var res LatestResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	if err := protocol.CheckSchema(res.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ErrTreeUnsupported 表示服务端没有 /_tree（旧版本），无法一次取得整棵目录树
+var ErrTreeUnsupported = errors.New("the server does not support recursive listings")
+
+// Tree 一次请求取得 dir 下前 depth 层（0 不限）的目录树，条目按先序排列，空目录也在其中。
+// 条目数达到服务端上限时 Limited 为 true，超出遍历预算时 Truncated 为 true；服务端不支持时返回 ErrTreeUnsupported
+func (c *Client) Tree(dir string, depth int) (*TreeResult, error) {
+	caps, err := c.Caps()
+	if err != nil {
+		return nil, err
+	}
+	if !caps.HasFeature("tree") {
+		return nil, ErrTreeUnsupported
+	}
+	body, err := c.request(fmt.Sprintf("GET /_tree?depth=%d&dir=%s", depth, url.QueryEscape(dir)))
+	if err != nil {
+		return nil, err
+	}
+	var res TreeResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	if err := protocol.CheckSchema(res.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ErrDuUnsupported 表示服务端没有 /_du（旧版本），无法统计目录占用
+var ErrDuUnsupported = errors.New("the server does not support directory usage")
+
+// Du 递归统计目录下每个直接条目占用的字节数和文件数，遍历期间的进度通过进度帧显示。
+// 超出服务端的遍历预算时 Truncated 为 true，大小偏小；服务端不支持时返回 ErrDuUnsupported
+func (c *Client) Du(dir string) (*DuResult, error) {
+	caps, err := c.Caps()
+	if err != nil {
+		return nil, err
+	}
+	if !caps.HasFeature("du") {
+		return nil, ErrDuUnsupported
+	}
+	body, err := c.request("GET /_du?dir=" + url.QueryEscape(dir))
+	if err != nil {
+		return nil, err
+	}
+	var res DuResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	if err := protocol.CheckSchema(res.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ErrFindUnsupported 表示服务端没有 /_find（旧版本），无法在服务端查找
+var ErrFindUnsupported = errors.New("the server does not support find")
+
+// FindOptions 是 Find 的查找条件
+type FindOptions struct {
+	Pattern  string // 与名字比较的 glob（如 "*.log"），Regex 时是与相对路径比较的正则；为空时匹配所有条目
+	Regex    bool
+	Type     string // "f" 只要普通文件，"d" 只要目录，为空不限
+	MaxDepth int    // 只查找前几层，1 为直接条目，0 不限
+	Limit    int    // 最多返回的匹配数，0 使用服务端的上限（-find-limit），更大的值按上限处理
+}
+
+// Find 在服务端遍历 dir 查找匹配的条目，返回相对 dir 的路径。
+// 匹配数达到上限时 Limited 为 true，超出遍历预算时 Truncated 为 true；服务端不支持时返回 ErrFindUnsupported
+func (c *Client) Find(dir string, opts FindOptions) (*FindResult, error) {
+	caps, err := c.Caps()
+	if err != nil {
+		return nil, err
+	}
+	if !caps.HasFeature("find") {
+		return nil, ErrFindUnsupported
+	}
+	q := url.Values{"dir": {dir}, "pattern": {opts.Pattern}}
+	if opts.Regex {
+		q.Set("regex", "1")
+	}
+	if opts.Type != "" {
+		q.Set("type", opts.Type)
+	}
+	if opts.MaxDepth > 0 {
+		q.Set("maxdepth", strconv.Itoa(opts.MaxDepth))
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	body, err := c.request("GET /_find?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var res FindResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	if err := protocol.CheckSchema(res.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DirCounts 返回服务端统计的条目最多的 n 个目录。计数由后台巡检维护，可能略有滞后
+func (c *Client) DirCounts(n int) (*DirCountsResult, error) {
+	body, err := c.request(fmt.Sprintf("GET /_counts?n=%d", n))
+	if err != nil {
+		return nil, err
+	}
+	var res DirCountsResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	if err := protocol.CheckSchema(res.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Activity 返回服务端最近完成的操作：since 为 nil 时取最近的 limit 条，否则取 *since 之后最早的 limit 条。
+// 轮询时把上次结果的 Run 和 Last 带回，服务端据此判断是否有条目已经丢失（见 ActivityResult.Gap）
+func (c *Client) Activity(run string, since *uint64, limit int) (*ActivityResult, error) {
+	req := fmt.Sprintf("GET /_activity?limit=%d", limit)
+	if since != nil {
+		req += fmt.Sprintf("&since=%d&run=%s", *since, url.QueryEscape(run))
+	}
+	body, err := c.request(req)
+	if err != nil {
+		return nil, err
+	}
+	var res ActivityResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	if err := protocol.CheckSchema(res.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+/* ---------- 流式目录列表 ---------- */
+
+// ListStream 按服务端读目录的节奏逐批返回条目，条目不排序。
+// 读完之前连接上不能发送其他请求
+type ListStream struct {
+	Header  ListHeader
+	Summary ListSummary // Next 返回 false 之后有效
+
+	c       *Client
+	pending []string // 旧版服务端一次返回的全部条目
+	legacy  bool
+}
+
+// OpenList 以流式请求目录列表并读取头部帧。旧版服务端返回完整的列表，
+// 此时全部条目在第一次 Next 中返回
+func (c *Client) OpenList(dir string) (*ListStream, error) {
+	if err := c.sendRequest("GET /_list?format=stream&dir=" + url.QueryEscape(dir)); err != nil {
+		return nil, err
+	}
+	status, size, err := c.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	ls := &ListStream{c: c}
+	if size != protocol.StreamedSize {
+		body, err := c.readBody(size)
+		if err != nil {
+			return nil, err
+		}
+		if status >= 400 {
+			return nil, &RemoteError{Status: status, Body: body}
+		}
+		res, err := parseList(body)
+		if err != nil {
+			return nil, err
+		}
+		ls.legacy = true
+		ls.pending = res.Entries
+		ls.Header = ListHeader{SchemaVersion: res.SchemaVersion, Dir: dir}
+		ls.Summary = ListSummary{Count: len(res.Entries), Truncated: res.Truncated, Warning: res.Warning}
+		return ls, nil
+	}
+	msgType, payload, err := c.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if msgType != websocket.TextMessage || json.Unmarshal(payload, &ls.Header) != nil {
+		return nil, fmt.Errorf("bad list header: %q", payload)
+	}
+	if err := protocol.CheckSchema(ls.Header.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return ls, nil
+}
+
+// Next 返回下一批条目名，读到摘要帧时返回 false，摘要保存在 ls.Summary
+func (ls *ListStream) Next() ([]string, bool, error) {
+	if ls.legacy {
+		names := ls.pending
+		ls.pending = nil
+		return names, names != nil, nil
+	}
+	msgType, payload, err := ls.c.conn.ReadMessage()
+	if err != nil {
+		return nil, false, err
+	}
+	if msgType == websocket.TextMessage {
+		if err := json.Unmarshal(payload, &ls.Summary); err != nil {
+			return nil, false, fmt.Errorf("bad list summary: %q", payload)
+		}
+		return nil, false, nil
+	}
+	var names []string
+	for _, line := range bytes.Split(bytes.TrimSuffix(payload, []byte("\n")), []byte("\n")) {
+		var n string
+		if err := json.Unmarshal(line, &n); err != nil {
+			return nil, false, fmt.Errorf("bad list entry: %q", line)
+		}
+		names = append(names, n)
+	}
+	return names, true, nil
+}
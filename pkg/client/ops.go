@@ -0,0 +1,134 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 单个路径上的操作 ---------- */
+
+// Stat 返回远程路径的状态，路径不存在时 Exists 为 false 而不是返回错误
+func (c *Client) Stat(remote string) (*StatInfo, error) {
+	return c.stat(remote, false)
+}
+
+// StatHash 与 Stat 相同，但要求服务端读取整个文件给出 SHA-256；旧服务端不支持时 SHA256 为空
+func (c *Client) StatHash(remote string) (*StatInfo, error) {
+	return c.stat(remote, true)
+}
+
+func (c *Client) stat(remote string, hash bool) (*StatInfo, error) {
+	q := url.Values{"path": {remote}}
+	if hash {
+		q.Set("hash", "1")
+	}
+	body, err := c.request("GET /_stat?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var st StatInfo
+	if err := json.Unmarshal(body, &st); err != nil {
+		return nil, fmt.Errorf("bad stat response: %w", err)
+	}
+	if err := protocol.CheckSchema(st.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Delete 删除远程文件；recursive 为 true 时也删除目录及其内容，沙箱根目录始终拒绝
+func (c *Client) Delete(remote string, recursive bool) error {
+	target := &url.URL{Path: remotePath(remote)}
+	if recursive {
+		target.RawQuery = "recursive=1"
+	}
+	_, err := c.request("DELETE " + target.String())
+	return err
+}
+
+// Mkdir 逐级创建远程目录，目录已经存在时 created 为 false；路径上有文件时返回状态为 409 的 *RemoteError
+func (c *Client) Mkdir(remote string) (created bool, err error) {
+	target := &url.URL{Path: remotePath(remote)}
+	status, body, err := c.roundTrip("MKDIR "+target.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	if status >= 400 {
+		return false, &RemoteError{Status: status, Body: body}
+	}
+	return status == http.StatusCreated, nil
+}
+
+// Move 在服务端移动或重命名 src 到 dst，缺少的上级目录一并创建。dst 已存在时只有 force 为 true 才替换，
+// 否则返回状态为 409 的 *RemoteError
+func (c *Client) Move(src, dst string, force bool) error {
+	_, err := c.MoveTo(src, dst, force)
+	return err
+}
+
+// MoveTo 与 Move 相同，另外返回服务端实际移动到的路径（清理过 ".."，限定子目录的token看到的形式）；
+// 旧服务端不回报时是本地清理的 dst
+func (c *Client) MoveTo(src, dst string, force bool) (string, error) {
+	q := url.Values{"dst": {remotePath(dst)}}
+	if force {
+		q.Set("force", "1")
+	}
+	target := &url.URL{Path: remotePath(src), RawQuery: q.Encode()}
+	body, err := c.request("MOVE " + target.String())
+	if err != nil {
+		return "", err
+	}
+	if moved := strings.TrimSpace(string(body)); strings.HasPrefix(moved, "/") {
+		return moved, nil
+	}
+	return path.Clean(remotePath(dst)), nil
+}
+
+/* ---------- 锁 ---------- */
+
+// Lock 以独占创建的方式获取远程路径上的锁，已被持有时返回状态为 423 的 *RemoteError
+func (c *Client) Lock(remote, holder string, ttl time.Duration) (*LockInfo, error) {
+	q := url.Values{"holder": {holder}, "ttl": {ttl.String()}}
+	target := &url.URL{Path: remotePath(remote), RawQuery: q.Encode()}
+	body, err := c.request("LOCK " + target.String())
+	if err != nil {
+		return nil, err
+	}
+	var l LockInfo
+	if err := json.Unmarshal(body, &l); err != nil {
+		return nil, fmt.Errorf("bad lock response: %w", err)
+	}
+	return &l, nil
+}
+
+// Unlock 释放自己持有的锁，token 和 holder 都必须与获取时相同
+func (c *Client) Unlock(remote, holder string) error {
+	target := &url.URL{Path: remotePath(remote), RawQuery: url.Values{"holder": {holder}}.Encode()}
+	_, err := c.request("UNLOCK " + target.String())
+	return err
+}
+
+// Locks 递归列出目录下的所有锁，包括已过期但尚未回收的
+func (c *Client) Locks(dir string) ([]LockInfo, error) {
+	body, err := c.request("GET /_locks?dir=" + url.QueryEscape(dir))
+	if err != nil {
+		return nil, err
+	}
+	var locks []LockInfo
+	if err := json.Unmarshal(body, &locks); err != nil {
+		return nil, err
+	}
+	for _, l := range locks {
+		if err := protocol.CheckSchema(l.SchemaVersion); err != nil {
+			return nil, err
+		}
+	}
+	return locks, nil
+}
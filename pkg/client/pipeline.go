@@ -0,0 +1,255 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 流水线 ---------- */
+
+// 协商了流水线（Options.Pipeline，见 protocol.PipelineHeader）的连接上，一个读协程按帧开头的请求ID把帧分给各个 lane。
+// 每个 Client 占用一个 lane，在上面依次发送请求，每个请求使用新的ID；Lane 返回共用同一连接的另一个 Client，
+// 不同 Client 的请求同时进行，帧在连接上交错
+
+// frameConn 是 Client 收发帧的方式：普通连接上是 *websocket.Conn，流水线连接上是 lane
+type frameConn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(int, []byte) error
+	WriteControl(int, []byte, time.Time) error
+	SetReadDeadline(time.Time) error
+	SetWriteDeadline(time.Time) error
+	Close() error
+}
+
+// ErrPipelineUnsupported 表示连接没有协商流水线（Options.Pipeline 为0或服务端不支持），Lane 不可用
+var ErrPipelineUnsupported = errors.New("pipelined requests not negotiated on this connection")
+
+// ErrNoLane 表示这条连接上的 Client 已达协商的并发数，见 Pipelined
+var ErrNoLane = errors.New("all pipelined lanes of the connection are in use")
+
+type muxFrame struct {
+	typ  int
+	data []byte
+}
+
+// mux 把一条流水线连接分给多个 lane
+type mux struct {
+	conn  *websocket.Conn
+	limit int        // 协商的并发数，也是 lane 的上限
+	wmu   sync.Mutex // 串行化写入
+
+	mu     sync.Mutex
+	lanes  map[uint64]*lane // 当前请求ID -> lane
+	nextID uint64
+	open   int   // 未关闭的 lane
+	err    error // 读协程退出的原因，之后所有读取都返回它
+}
+
+// lane 是 mux 上的一个 Client 的请求序列，实现 frameConn
+type lane struct {
+	m         *mux
+	primary   bool          // DialContext 返回的 Client 使用的 lane，关闭它时关闭连接
+	id        uint64        // 当前请求的ID，由 m.mu 保护
+	queue     []muxFrame    // 由 m.mu 保护
+	ready     chan struct{} // 容量1，队列有新帧或连接出错时通知
+	closed    bool          // 由 m.mu 保护
+	rdeadline time.Time
+	wdeadline time.Time
+}
+
+func newMux(conn *websocket.Conn, limit int) *mux {
+	m := &mux{conn: conn, limit: limit, lanes: map[uint64]*lane{}}
+	go m.read()
+	return m
+}
+
+// read 把收到的帧放进当前请求ID对应的 lane，不属于任何请求的帧（被放弃的请求的剩余部分）丢弃
+func (m *mux) read() {
+	for {
+		typ, msg, err := m.conn.ReadMessage()
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		id, payload, ok := protocol.SplitFrame(msg)
+		if !ok {
+			m.fail(fmt.Errorf("pipelined frame without a request id: %q", msg[:min(len(msg), 32)]))
+			m.conn.Close()
+			return
+		}
+		m.mu.Lock()
+		if l := m.lanes[id]; l != nil {
+			l.queue = append(l.queue, muxFrame{typ, payload})
+			l.notify()
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *mux) fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+	for _, l := range m.lanes {
+		l.notify()
+	}
+}
+
+// lane 分配一个新的 lane，已达上限时返回 ErrNoLane
+func (m *mux) lane(primary bool) (*lane, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.open >= m.limit {
+		return nil, ErrNoLane
+	}
+	m.open++
+	return &lane{m: m, primary: primary, ready: make(chan struct{}, 1)}, nil
+}
+
+func (l *lane) notify() {
+	select {
+	case l.ready <- struct{}{}:
+	default:
+	}
+}
+
+// begin 为下一个请求分配新的ID，上一个请求还没收到的帧此后被丢弃
+func (l *lane) begin() {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	delete(l.m.lanes, l.id)
+	l.m.nextID++
+	l.id = l.m.nextID
+	l.queue = nil
+	l.m.lanes[l.id] = l
+}
+
+func (l *lane) ReadMessage() (int, []byte, error) {
+	var timeout <-chan time.Time
+	if !l.rdeadline.IsZero() {
+		t := time.NewTimer(time.Until(l.rdeadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+	for {
+		l.m.mu.Lock()
+		if len(l.queue) > 0 {
+			f := l.queue[0]
+			l.queue = l.queue[1:]
+			l.m.mu.Unlock()
+			return f.typ, f.data, nil
+		}
+		err := l.m.err
+		l.m.mu.Unlock()
+		if err != nil {
+			return 0, nil, err
+		}
+		select {
+		case <-l.ready:
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (l *lane) WriteMessage(typ int, data []byte) error {
+	l.m.wmu.Lock()
+	defer l.m.wmu.Unlock()
+	// 写超时属于 lane，写之前换成自己的
+	l.m.conn.SetWriteDeadline(l.wdeadline)
+	l.m.mu.Lock()
+	id := l.id
+	l.m.mu.Unlock()
+	return l.m.conn.WriteMessage(typ, protocol.TagFrame(id, data))
+}
+
+func (l *lane) WriteControl(typ int, data []byte, deadline time.Time) error {
+	return l.m.conn.WriteControl(typ, data, deadline)
+}
+
+func (l *lane) SetReadDeadline(t time.Time) error {
+	l.rdeadline = t
+	return nil
+}
+
+func (l *lane) SetWriteDeadline(t time.Time) error {
+	l.wdeadline = t
+	return nil
+}
+
+// Close 释放 lane；主 lane 关闭整条连接
+func (l *lane) Close() error {
+	l.m.mu.Lock()
+	if l.closed {
+		l.m.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.m.open--
+	delete(l.m.lanes, l.id)
+	l.m.mu.Unlock()
+	if l.primary {
+		return l.m.conn.Close()
+	}
+	return nil
+}
+
+// sendRequest 写出请求，req 是版本1的请求行（路径已转义，见 linePath），版本2的连接上转换成 JSON 请求帧。
+// 流水线连接上为这个请求分配新的ID
+func (c *Client) sendRequest(req string) error {
+	frame := []byte(req)
+	if c.version >= protocol.Version {
+		r, err := protocol.ParseRequestLine(req)
+		if err != nil {
+			return err
+		}
+		if frame, err = json.Marshal(r); err != nil {
+			return err
+		}
+	}
+	if l, ok := c.conn.(interface{ begin() }); ok {
+		l.begin()
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+		return err
+	}
+	c.awaitResponse(true)
+	return nil
+}
+
+// Pipelined 返回连接协商的流水线并发数，即共用这条连接的 Client（含自己）最多有几个；0表示没有协商
+func (c *Client) Pipelined() int {
+	if c.mux == nil {
+		return 0
+	}
+	return c.mux.limit
+}
+
+// Lane 返回与 c 共用同一条连接的新 Client，设置（元数据、校验、覆盖）与 c 相同。
+// 两者的请求可以同时进行，服务端按请求ID分别回复；每个 Client 仍只能由一个协程使用。
+// 进度显示也与 c 共用，需要时用 SetProgress 替换。
+// 新 Client 的 Close 只释放它自己，c 的 Close 关闭整条连接。
+// 连接没有协商流水线时返回 ErrPipelineUnsupported，已达 Pipelined 个时返回 ErrNoLane
+func (c *Client) Lane() (*Client, error) {
+	if c.mux == nil {
+		return nil, ErrPipelineUnsupported
+	}
+	l, err := c.mux.lane(false)
+	if err != nil {
+		return nil, err
+	}
+	nc := *c
+	nc.conn = withTimeouts(l, c.opTimeout, c.stallTimeout)
+	nc.stopPing = func() {}
+	nc.digest, nc.canonical = "", ""
+	nc.modTime, nc.mode = time.Time{}, 0
+	return &nc, nil
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package client
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize 是 FALLOC_FL_KEEP_SIZE，syscall 包中没有定义
+const fallocKeepSize = 0x1
+
+// reserve 用 fallocate 为文件中的一段预留磁盘空间但不改变文件大小，文件系统不支持时忽略
+func reserve(f *os.File, off, n int64) error {
+	if n == 0 {
+		return nil
+	}
+	err := syscall.Fallocate(int(f.Fd()), fallocKeepSize, off, n)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return nil
+	}
+	return err
+}
+
+// preallocateRange 为文件中的一段分配空间，不支持时忽略
+func preallocateRange(f *os.File, off, n int64) error {
+	if n == 0 {
+		return nil
+	}
+	err := syscall.Fallocate(int(f.Fd()), 0, off, n)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return nil
+	}
+	return err
+}
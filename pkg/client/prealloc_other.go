@@ -0,0 +1,14 @@
+//go:build !linux
+
+package client
+
+import "os"
+
+// reserve 在没有 fallocate 的平台上不预留空间：截断到目标大小会让中断的临时文件看起来已经下载完整，无法续传
+func reserve(f *os.File, off, n int64) error {
+	return nil
+}
+
+func preallocateRange(f *os.File, off, n int64) error {
+	return nil
+}
@@ -0,0 +1,256 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+/* ---------- 客户端：HTTP 与 SOCKS5 代理 ---------- */
+
+// Options.Proxy 为 nil 时按 HTTPS_PROXY、HTTP_PROXY 和 NO_PROXY 选择代理（ws:// 用 HTTP_PROXY，wss:// 用 HTTPS_PROXY）。
+// http:// 和 https:// 代理用 CONNECT 建立隧道，https:// 与代理之间另有一层 TLS；socks5:// 和 socks5h:// 由代理解析服务端地址。
+// 代理URL中的用户名和密码用于 Proxy-Authorization（Basic）或 SOCKS5 的用户名/密码认证。
+// 代理拒绝隧道、认证失败或连不上代理时返回 *ProxyError，与服务端拒绝升级的 *HandshakeError 区分
+
+// ProxyError 表示连接经过代理时失败，服务端还没有收到请求
+type ProxyError struct {
+	Proxy  string // 代理地址，已隐去密码
+	Reason string // 代理的回复，如 "407 Proxy Authentication Required"；连不上代理时为空
+	Err    error  // 连接代理本身的错误，代理有回复时为 nil
+}
+
+func (e *ProxyError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("proxy %s refused the connection: %s", e.Proxy, e.Reason)
+	}
+	return fmt.Sprintf("proxy %s: %v", e.Proxy, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error { return e.Err }
+
+// ParseProxyURL 解析并检查代理地址，支持 http、https、socks5 和 socks5h
+func ParseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use http://, https:// or socks5://", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy address %q has no host", raw)
+	}
+	return u, nil
+}
+
+// proxyFor 返回连接 u（ws:// 或 wss://）要经过的代理，不使用代理时为 nil
+func proxyFor(u *url.URL, proxy func(*http.Request) (*url.URL, error)) (*url.URL, error) {
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	hu := *u
+	hu.Scheme = "http"
+	if u.Scheme == "wss" {
+		hu.Scheme = "https"
+	}
+	p, err := proxy(&http.Request{URL: &hu})
+	if err != nil || p == nil {
+		return nil, err
+	}
+	if _, err := ParseProxyURL(p.String()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// proxyDialer 返回经过代理 p 连接 addr 的拨号函数，作为 websocket.Dialer 的 NetDialContext
+func proxyDialer(p *url.URL) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+		fail := func(reason string, err error) (net.Conn, error) {
+			if conn != nil {
+				conn.Close()
+			}
+			return nil, &ProxyError{Proxy: p.Redacted(), Reason: reason, Err: err}
+		}
+		var d net.Dialer
+		if conn, err = d.DialContext(ctx, network, proxyHostPort(p)); err != nil {
+			return fail("", err)
+		}
+		// 与代理的交换同样受连接超时的限制
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+			defer conn.SetDeadline(time.Time{})
+		}
+		if p.Scheme == "https" {
+			tc := tls.Client(conn, &tls.Config{ServerName: p.Hostname()})
+			if err := tc.HandshakeContext(ctx); err != nil {
+				return fail("", err)
+			}
+			conn = tc
+		}
+		var reason string
+		if p.Scheme == "http" || p.Scheme == "https" {
+			reason, err = httpConnect(conn, p, addr)
+		} else {
+			reason, err = socks5Connect(conn, p, addr)
+		}
+		if reason != "" || err != nil {
+			return fail(reason, err)
+		}
+		return conn, nil
+	}
+}
+
+// proxyHostPort 返回代理的 host:port，没有端口时按协议取默认端口
+func proxyHostPort(p *url.URL) string {
+	if port := p.Port(); port != "" {
+		return p.Host
+	}
+	port := "1080"
+	switch p.Scheme {
+	case "http":
+		port = "80"
+	case "https":
+		port = "443"
+	}
+	return net.JoinHostPort(p.Hostname(), port)
+}
+
+// httpConnect 请求 HTTP 代理建立到 addr 的隧道，代理拒绝时返回它的状态行
+func httpConnect(conn net.Conn, p *url.URL, addr string) (string, error) {
+	req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: http.Header{}}
+	if p.User != nil {
+		pass, _ := p.User.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(p.User.Username()+":"+pass)))
+	}
+	if err := req.Write(conn); err != nil {
+		return "", err
+	}
+	// 代理在回复 CONNECT 之后才转发服务端的数据，丢掉缓冲的读取器不会丢数据
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.Status, nil
+	}
+	return "", nil
+}
+
+// socks5Reasons 是 SOCKS5 CONNECT 回复码的含义（RFC 1928）
+var socks5Reasons = map[byte]string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused by the destination",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5Connect 与 SOCKS5 代理协商认证（RFC 1929 的用户名/密码）并请求连接 addr，代理拒绝时返回原因
+func socks5Connect(conn net.Conn, p *url.URL, addr string) (string, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || len(host) > 255 {
+		return "", fmt.Errorf("bad address %q", addr)
+	}
+	methods := []byte{0}
+	if p.User != nil {
+		methods = []byte{0, 2}
+	}
+	if _, err := conn.Write(append([]byte{5, byte(len(methods))}, methods...)); err != nil {
+		return "", err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return "", err
+	}
+	switch {
+	case reply[0] != 5:
+		return "", errors.New("not a SOCKS5 proxy")
+	case reply[1] == 0xff:
+		return "no acceptable authentication method (the proxy may require a user name and password)", nil
+	case reply[1] == 2:
+		if p.User == nil {
+			return "", errors.New("SOCKS5 proxy chose password authentication that was not offered")
+		}
+		user := p.User.Username()
+		pass, _ := p.User.Password()
+		if len(user) > 255 || len(pass) > 255 {
+			return "", errors.New("SOCKS5 user name and password must be at most 255 bytes")
+		}
+		msg := append([]byte{1, byte(len(user))}, user...)
+		msg = append(append(msg, byte(len(pass))), pass...)
+		if _, err := conn.Write(msg); err != nil {
+			return "", err
+		}
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return "", err
+		}
+		if reply[1] != 0 {
+			return "authentication failed", nil
+		}
+	case reply[1] != 0:
+		return "", fmt.Errorf("SOCKS5 proxy chose unsupported authentication method %d", reply[1])
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(append(req, 1), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, 4), ip.To16()...)
+	} else {
+		req = append(append(req, 3, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return "", err
+	}
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return "", err
+	}
+	if head[1] != 0 {
+		if r, ok := socks5Reasons[head[1]]; ok {
+			return r, nil
+		}
+		return fmt.Sprintf("SOCKS5 reply %d", head[1]), nil
+	}
+	// 跳过代理回复的绑定地址和端口
+	var skip int
+	switch head[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return "", err
+		}
+		skip = int(n[0])
+	default:
+		return "", fmt.Errorf("SOCKS5 reply with unknown address type %d", head[3])
+	}
+	_, err = io.CopyN(io.Discard, conn, int64(skip+2))
+	return "", err
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+/* ---------- 客户端：连接、响应与传输超时 ---------- */
+
+// Options.ConnectTimeout 限制建立连接（TCP、TLS 和升级）的时间；Options.OpTimeout 限制发出请求后等待响应的时间，
+// 每收到一个进度帧重新计时；Options.StallTimeout 限制正文传输中两帧之间的间隔，任何一帧都算进展。
+// 后两者由包在连接外面的 timedConn 在每次读写之前设置截止时间，比调用方用 SetDeadline 设置的更早时才生效
+
+// 超时发生的阶段，见 TimeoutError
+const (
+	PhaseConnect  = "connect"
+	PhaseResponse = "response"
+	PhaseTransfer = "transfer"
+)
+
+// TimeoutError 表示连接在 Phase 阶段超过 Timeout 没有进展。连接此后不可再用
+type TimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	switch e.Phase {
+	case PhaseConnect:
+		return fmt.Sprintf("timed out after %s connecting to the server", e.Timeout)
+	case PhaseResponse:
+		return fmt.Sprintf("timed out after %s waiting for the server to respond", e.Timeout)
+	}
+	return fmt.Sprintf("transfer stalled: no data moved for %s", e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// isTimeout 判断错误是否因为截止时间已过
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// timedConn 在每次读写之前按当前阶段设置截止时间，超时以 *TimeoutError 返回
+type timedConn struct {
+	frameConn
+	op, stall time.Duration
+	waiting   bool      // 请求已发出、还没收到状态头，见 Client.awaitResponse
+	rd, wd    time.Time // 调用方设置的截止时间
+}
+
+// withTimeouts 在设置了 OpTimeout 或 StallTimeout 时给 conn 包上 timedConn
+func withTimeouts(conn frameConn, op, stall time.Duration) frameConn {
+	if op <= 0 && stall <= 0 {
+		return conn
+	}
+	return &timedConn{frameConn: conn, op: max(op, 0), stall: max(stall, 0)}
+}
+
+// limit 返回下一次读取的超时及其阶段，为0表示不限
+func (t *timedConn) limit() (time.Duration, string) {
+	if t.waiting {
+		if t.op > 0 {
+			return t.op, PhaseResponse
+		}
+		return t.stall, PhaseResponse
+	}
+	return t.stall, PhaseTransfer
+}
+
+func (t *timedConn) ReadMessage() (int, []byte, error) {
+	d, phase := t.limit()
+	if d == 0 {
+		return t.frameConn.ReadMessage()
+	}
+	deadline := time.Now().Add(d)
+	own := t.rd.IsZero() || deadline.Before(t.rd)
+	if own {
+		t.frameConn.SetReadDeadline(deadline)
+		defer t.frameConn.SetReadDeadline(t.rd)
+	}
+	typ, data, err := t.frameConn.ReadMessage()
+	if err != nil && own && isTimeout(err) {
+		err = &TimeoutError{Phase: phase, Timeout: d, Err: err}
+	}
+	return typ, data, err
+}
+
+func (t *timedConn) WriteMessage(typ int, data []byte) error {
+	d := t.stall
+	if d == 0 {
+		d = t.op
+	}
+	deadline := time.Now().Add(d)
+	own := t.wd.IsZero() || deadline.Before(t.wd)
+	if own {
+		t.frameConn.SetWriteDeadline(deadline)
+		defer t.frameConn.SetWriteDeadline(t.wd)
+	}
+	err := t.frameConn.WriteMessage(typ, data)
+	if err != nil && own && isTimeout(err) {
+		phase := PhaseTransfer
+		if t.stall == 0 {
+			phase = PhaseResponse
+		}
+		err = &TimeoutError{Phase: phase, Timeout: d, Err: err}
+	}
+	return err
+}
+
+func (t *timedConn) SetReadDeadline(d time.Time) error {
+	t.rd = d
+	return t.frameConn.SetReadDeadline(d)
+}
+
+func (t *timedConn) SetWriteDeadline(d time.Time) error {
+	t.wd = d
+	return t.frameConn.SetWriteDeadline(d)
+}
+
+// begin 转给流水线的 lane，见 sendRequest
+func (t *timedConn) begin() {
+	if l, ok := t.frameConn.(*lane); ok {
+		l.begin()
+	}
+}
+
+// awaitResponse 标记是否正在等待状态头，等待期间读取按 OpTimeout 计时
+func (c *Client) awaitResponse(waiting bool) {
+	if t, ok := c.conn.(*timedConn); ok {
+		t.waiting = waiting
+	}
+}
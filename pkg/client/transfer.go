@@ -0,0 +1,605 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+	"wsbox/internal/throttle"
+)
+
+/* ---------- 上传：分块发送 ---------- */
+
+// Upload 把 r 的内容上传到远程路径，远程目录由服务端按需创建。
+// 协商了分块上传时按 protocol.StreamChunkSize 分帧发送，内存占用与文件大小无关；
+// 否则读完 r 后作为单帧发送（旧版服务端）。r 是普通文件时向 TransferReporter 报告总大小。
+// 开启了校验（见 SetVerify）时声明内容的 SHA-256，服务端收到的内容不一致时拒绝：服务端支持时边发送边计算，
+// 在结束标记中给出；否则只有 r 可以定位时才校验，先读一遍计算摘要随请求声明。
+// 读取 r 失败时返回 *LocalReadError，连接仍可继续使用
+func (c *Client) Upload(remote string, r io.Reader) (TransferStats, error) {
+	st, _, err := c.upload(c.withAttrs("POST "+linePath(remote), r), r)
+	return st, err
+}
+
+// upload 发送上传请求 req，正文为 r，按连接的能力附加摘要，返回统计和成功响应的正文
+func (c *Client) upload(req string, r io.Reader) (TransferStats, []byte, error) {
+	total := int64(-1)
+	if f, ok := r.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			total = fi.Size()
+		}
+	}
+	defer c.begin(total, 0)()
+	if c.streamDigest() {
+		h := sha256.New()
+		st, _, body, err := c.postBody(c.uploadLine(withQuery(req, protocol.DigestParam+"="+protocol.DigestTrailer)), c.meterReader(io.TeeReader(r, h)), h)
+		if st.Verified = err == nil; st.Verified {
+			st.SHA256 = hex.EncodeToString(h.Sum(nil))
+		}
+		return st, body, err
+	}
+	rs, verify := r.(io.ReadSeeker)
+	if verify {
+		// 管道等不能定位的文件也实现了 Seek，只能试一下
+		_, err := rs.Seek(0, io.SeekCurrent)
+		verify = c.verify && err == nil
+	}
+	var sum string
+	if verify {
+		var err error
+		if sum, err = digestFrom(rs, -1); err != nil {
+			return TransferStats{}, nil, &LocalReadError{err}
+		}
+		req = withQuery(req, protocol.DigestParam+"="+sum)
+	}
+	st, _, body, err := c.postBody(c.uploadLine(req), c.meterReader(r), nil)
+	if st.Verified = verify && err == nil; st.Verified {
+		st.SHA256 = sum
+	}
+	return st, body, err
+}
+
+// UploadResume 以可续传的方式上传 size 字节的 r：先查询服务端已有的部分上传，从那里接着发送，
+// 中断后再次调用即可继续。完成后核对远程文件的大小，不一致时返回错误。
+// 两次调用之间本地内容不能改变，服务端只按长度判断从哪里继续
+func (c *Client) UploadResume(remote string, r io.ReadSeeker, size int64) (TransferStats, error) {
+	remote = remotePath(remote)
+	var st TransferStats
+	caps, err := c.Caps()
+	if err != nil {
+		return st, err
+	}
+	if !caps.HasFeature("resume-upload") {
+		return st, ErrResumeUnsupported
+	}
+	offset, err := c.UploadOffset(remote)
+	if err != nil {
+		return st, err
+	}
+	if offset > size {
+		// 本地文件比上次短，已有的部分不可能属于它，从头开始
+		offset = 0
+	}
+	req := c.withAttrs(fmt.Sprintf("POST %s?offset=%d&total=%d", linePath(remote), offset, size), r)
+	// 服务端在最后一次续传完成时核对整个文件：能在结束标记中给出摘要时只需另读服务端已有的那部分
+	var h hash.Hash
+	var sum string
+	var body io.Reader = io.LimitReader(r, size-offset)
+	switch {
+	case c.streamDigest():
+		h = sha256.New()
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return st, &LocalReadError{err}
+		}
+		if _, err := io.CopyN(h, r, offset); err != nil {
+			return st, &LocalReadError{err}
+		}
+		req = withQuery(req, protocol.DigestParam+"="+protocol.DigestTrailer)
+		body = io.TeeReader(body, h)
+	case c.verify:
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return st, &LocalReadError{err}
+		}
+		if sum, err = digestFrom(r, size); err != nil {
+			return st, &LocalReadError{err}
+		}
+		req = withQuery(req, protocol.DigestParam+"="+sum)
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return st, &LocalReadError{err}
+	}
+	end := c.begin(size, offset)
+	st, status, err := c.post(c.uploadLine(req), c.meterReader(body), h)
+	end()
+	st.Size, st.Resumed = size, offset
+	if err != nil {
+		return st, err
+	}
+	if status == http.StatusAccepted {
+		return st, fmt.Errorf("upload of %s is incomplete: local data ended after %d of %d bytes", remote, offset+st.Bytes, size)
+	}
+	info, err := c.Stat(remote)
+	if err != nil {
+		return st, err
+	}
+	if !info.Exists || info.Size != size {
+		return st, fmt.Errorf("size mismatch after upload of %s: remote has %d bytes, local %d", remote, info.Size, size)
+	}
+	if h != nil {
+		sum = hex.EncodeToString(h.Sum(nil))
+	}
+	if st.Verified = c.verify; st.Verified {
+		st.SHA256 = sum
+	}
+	return st, nil
+}
+
+// ErrResumeUnsupported 表示服务端不支持可续传的上传
+var ErrResumeUnsupported = errors.New("the server does not support resumable uploads")
+
+// UploadOffset 查询远程路径的部分上传已有的字节数，没有部分上传时为0
+func (c *Client) UploadOffset(remote string) (int64, error) {
+	body, err := c.request("GET /_upload_offset?path=" + url.QueryEscape(remotePath(remote)))
+	if err != nil {
+		return 0, err
+	}
+	var res UploadOffset
+	if err := json.Unmarshal(body, &res); err != nil {
+		return 0, err
+	}
+	if err := protocol.CheckSchema(res.SchemaVersion); err != nil {
+		return 0, err
+	}
+	return res.Offset, nil
+}
+
+// UploadLimit 返回服务端接受的单个上传的最大字节数，0表示不限；旧版服务端没有 /_caps/upload 时也返回0
+func (c *Client) UploadLimit() (int64, error) {
+	body, err := c.request("GET /_caps/upload")
+	var re *RemoteError
+	if errors.As(err, &re) && re.Status == http.StatusNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var l UploadLimits
+	if err := json.Unmarshal(body, &l); err != nil {
+		return 0, err
+	}
+	if err := protocol.CheckSchema(l.SchemaVersion); err != nil {
+		return 0, err
+	}
+	return l.MaxSize, nil
+}
+
+// post 发送一个带正文的请求，返回状态码；非 2xx 时返回 *RemoteError（超过大小限制时为 *TooLargeError）。
+// digest 不为 nil 时它累计了正文的摘要，在分块上传的结束标记中给出（只用于 sha256-trailer）
+func (c *Client) post(req string, r io.Reader, digest hash.Hash) (TransferStats, int, error) {
+	st, status, _, err := c.postBody(req, r, digest)
+	return st, status, err
+}
+
+// postBody 与 post 相同，另外返回成功响应的正文
+func (c *Client) postBody(req string, r io.Reader, digest hash.Hash) (TransferStats, int, []byte, error) {
+	var st TransferStats
+	var status int
+	var body []byte
+	if c.stream {
+		sent, chunks, err := c.sendStream(req, r, digest)
+		var le *LocalReadError
+		if err != nil && !errors.As(err, &le) {
+			return st, 0, nil, c.closeCause(err)
+		}
+		st.Bytes, st.Chunks = sent, chunks
+		// 中止的上传同样有响应，读掉它以保持连接上的请求顺序
+		status, body, err = c.readResponse()
+		if le != nil {
+			return st, 0, nil, le
+		}
+		if err != nil {
+			return st, 0, nil, err
+		}
+	} else {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return st, 0, nil, &LocalReadError{err}
+		}
+		if c.maxMsg > 0 && int64(len(data)) > c.maxMsg {
+			// 整个文件是一帧，服务端读到帧头就会关闭连接，不必发送
+			return st, 0, nil, &MessageTooBigError{Size: int64(len(data)), Limit: c.maxMsg}
+		}
+		st.Bytes, st.Chunks = int64(len(data)), 1
+		status, body, err = c.roundTrip(req, data)
+		if err != nil {
+			return st, 0, nil, err
+		}
+	}
+	st.Size = st.Bytes
+	if status < 200 || status >= 300 {
+		re := &RemoteError{Status: status, Body: body}
+		var e protocol.APIError
+		if status == http.StatusRequestEntityTooLarge && json.Unmarshal(body, &e) == nil && e.Code == protocol.TooLargeCode {
+			limit, _ := c.UploadLimit()
+			return st, status, nil, &TooLargeError{Limit: limit, Err: re}
+		}
+		return st, status, nil, re
+	}
+	return st, status, body, nil
+}
+
+// sendStream 以分块帧发送请求正文并写入结束标记，返回发送的字节数和块数；digest 不为 nil 时结束标记带上它的值。
+// 读取 body 失败时发送 protocol.StreamAbort，让服务端丢弃已收到的部分
+func (c *Client) sendStream(req string, body io.Reader, digest hash.Hash) (int64, int, error) {
+	if err := c.sendRequest(req); err != nil {
+		return 0, 0, err
+	}
+	buf := make([]byte, protocol.StreamChunkSize)
+	var sent int64
+	chunks := 0
+	for {
+		n, err := io.ReadFull(body, buf)
+		if n > 0 {
+			if werr := c.conn.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+				return sent, chunks, werr
+			}
+			sent += int64(n)
+			chunks++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			end := protocol.StreamEnd
+			if digest != nil {
+				end += " " + hex.EncodeToString(digest.Sum(nil))
+			}
+			return sent, chunks, c.conn.WriteMessage(websocket.TextMessage, []byte(end))
+		}
+		if err != nil {
+			if werr := c.conn.WriteMessage(websocket.TextMessage, []byte(protocol.StreamAbort)); werr != nil {
+				return sent, chunks, werr
+			}
+			return sent, chunks, &LocalReadError{err}
+		}
+	}
+}
+
+/* ---------- 下载：预分配与稀疏文件 ---------- */
+
+// PreallocError 表示本地磁盘空间不足以容纳下载的文件，在传输开始前报告
+type PreallocError struct {
+	Size int64
+	Err  error
+}
+
+func (e *PreallocError) Error() string {
+	return fmt.Sprintf("cannot allocate %d bytes for the download: %v", e.Size, e.Err)
+}
+
+func (e *PreallocError) Unwrap() error { return e.Err }
+
+// Download 把远程文件的内容写入 w。开启了校验时边写边计算 SHA-256，与服务端不一致时返回 *DigestError，
+// 此时内容已经写入 w
+func (c *Client) Download(remote string, w io.Writer) (TransferStats, error) {
+	h := sha256.New()
+	req := withQuery(c.withMetadata("GET "+linePath(remote)), c.wantDigest())
+	end := func() {}
+	st, err := c.receive(req, func(size int64) (io.Writer, error) {
+		end = c.begin(size, 0)
+		return c.meterWriter(io.MultiWriter(w, h)), nil
+	})
+	end()
+	st.Size = st.Bytes
+	st.ModTime, st.Mode = c.modTime, c.mode
+	if err == nil && c.digest != "" {
+		if got := hex.EncodeToString(h.Sum(nil)); got != c.digest {
+			return st, &DigestError{Path: remotePath(remote), Want: c.digest, Got: got}
+		}
+		st.Verified, st.SHA256 = true, c.digest
+	}
+	return st, err
+}
+
+// Extents 查询远程文件的数据区段，旧版服务端没有 /_extents 时返回错误
+func (c *Client) Extents(remote string) (*ExtentsResult, error) {
+	body, err := c.request("GET /_extents?path=" + url.QueryEscape(remotePath(remote)))
+	if err != nil {
+		return nil, err
+	}
+	var r ExtentsResult
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("bad extents response: %w", err)
+	}
+	if err := protocol.CheckSchema(r.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ReadRange 读取远程文件从 offset 开始的 length 个字节，范围超出文件时返回 416 的 *RemoteError。
+// 注册了下载变换的服务端不支持区段请求，同样返回 416
+func (c *Client) ReadRange(remote string, offset, length int64) ([]byte, error) {
+	var buf bytes.Buffer
+	req := c.withMetadata(fmt.Sprintf("GET %s?offset=%d&length=%d", linePath(remote), offset, length))
+	_, err := c.receive(req, func(n int64) (io.Writer, error) {
+		if n > length {
+			// 旧版服务端忽略区段参数，返回了整个文件
+			return nil, fmt.Errorf("server returned %d bytes for a range of %d", n, length)
+		}
+		return &buf, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Tail 返回远程文件在 end 偏移之前的最后 lines 行（原始字节），end 小于0时读到文件当前的末尾。
+// 服务端从后向前读取，只传输这几行；不支持的旧服务端返回 404 的 *RemoteError
+func (c *Client) Tail(remote string, lines int, end int64) ([]byte, error) {
+	q := url.Values{"path": {remotePath(remote)}, "lines": {strconv.Itoa(lines)}}
+	if end >= 0 {
+		q.Set("end", strconv.FormatInt(end, 10))
+	}
+	var buf bytes.Buffer
+	_, err := c.receive(c.withMetadata("GET /_tail?"+q.Encode()), func(int64) (io.Writer, error) { return &buf, nil })
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DownloadFile 下载远程文件到本地路径：含空洞的文件只传输数据区段，其余情况在得知大小后预留空间再整体下载，
+// 整体下载中断后再次调用时续传（见 getDense）。
+// ext 是事先用 Extents 查询到的结果，为 nil 时由 DownloadFile 自己查询；查询失败时按稠密文件下载。
+// 失败时删除写了一半的本地文件
+func (c *Client) DownloadFile(remote, local string, ext *ExtentsResult) (TransferStats, error) {
+	remote = remotePath(remote)
+	if ext == nil {
+		ext, _ = c.Extents(remote)
+	}
+	if ext != nil && ext.Sparse() {
+		st, err := c.getSparse(remote, local, ext)
+		if err == nil {
+			c.applyAttrs(local, st.ModTime, st.Mode)
+		}
+		return st, err
+	}
+	st, err := c.getDense(remote, local)
+	if st.Verified {
+		st.SHA256 = c.digest
+	}
+	if err == nil {
+		st.ModTime, st.Mode = c.modTime, c.mode
+		c.applyAttrs(local, st.ModTime, st.Mode)
+	}
+	return st, err
+}
+
+// getSparse 按数据区段下载稀疏文件：先把本地文件截断到目标大小（整体为空洞），
+// 再为每个区段预分配空间并写入对应偏移，空洞部分不写入任何数据
+func (c *Client) getSparse(remote, local string, ext *ExtentsResult) (st TransferStats, err error) {
+	f, err := os.Create(local)
+	if err != nil {
+		return st, err
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(local)
+		}
+	}()
+	if err := f.Truncate(ext.Size); err != nil {
+		return st, err
+	}
+	for _, e := range ext.Extents {
+		if err := preallocateRange(f, e.Offset, e.Length); err != nil {
+			return st, err
+		}
+	}
+	st.Size, st.Extents = ext.Size, len(ext.Extents)
+	var data int64
+	for _, e := range ext.Extents {
+		data += e.Length
+	}
+	defer c.begin(data, 0)()
+	var want string
+	for i, e := range ext.Extents {
+		req := c.withMetadata(fmt.Sprintf("GET %s?offset=%d&length=%d", linePath(remote), e.Offset, e.Length))
+		if i == 0 {
+			// 摘要是整个文件的，只需要请求一次
+			req = withQuery(req, c.wantDigest())
+		}
+		part, err := c.receive(req, func(int64) (io.Writer, error) {
+			return c.meterWriter(io.NewOffsetWriter(f, e.Offset)), nil
+		})
+		if i == 0 {
+			want = c.digest
+			st.ModTime, st.Mode = c.modTime, c.mode
+		}
+		st.Bytes += part.Bytes
+		st.Chunks += part.Chunks
+		st.Acks += part.Acks
+		if err != nil {
+			return st, err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return st, err
+	}
+	if st.Verified, err = checkFile(local, want); st.Verified {
+		st.SHA256 = want
+	}
+	return st, err
+}
+
+// PartSuffix 是整体下载过程中的临时文件后缀。下载中断时保留它，下次下载同一文件时从已有的字节之后续传
+const PartSuffix = ".part"
+
+// getDense 整体下载文件：写入 local+PartSuffix，大小核对无误后重命名为 local。
+// 已有临时文件时只请求剩余的字节（见 resumeOffset），服务端不接受区段请求时从头下载
+func (c *Client) getDense(remote, local string) (TransferStats, error) {
+	part := local + PartSuffix
+	offset, size := c.resumeOffset(remote, part)
+	if offset > 0 && offset == size {
+		// 上次在重命名之前中断，内容已经完整；没有发出下载请求，也就没有摘要可以核对
+		_, err := c.finishPart(part, local, size, "", nil)
+		return TransferStats{Size: size, Resumed: offset}, err
+	}
+	if offset > 0 {
+		req := withQuery(fmt.Sprintf("GET %s?offset=%d&length=%d", linePath(remote), offset, size-offset), c.wantDigest())
+		st, err := c.receivePart(req, part, offset, size)
+		var re *RemoteError
+		if !errors.As(err, &re) || re.Status != http.StatusRequestedRangeNotSatisfiable {
+			st.Size, st.Resumed = size, offset
+			st.Verified, err = c.finishPart(part, local, size, c.digest, err)
+			return st, err
+		}
+		// 注册了下载变换的服务端不支持区段请求
+	}
+	st, err := c.receivePart(withQuery("GET "+linePath(remote), c.wantDigest()), part, 0, -1)
+	st.Size = st.Bytes
+	st.Verified, err = c.finishPart(part, local, st.Bytes, c.digest, err)
+	return st, err
+}
+
+// resumeOffset 检查本地的临时文件能否续传，返回已有的字节数和远程文件大小；不能续传时返回0。
+// 服务端需要支持区段请求（sparse 特性），远程文件不能比临时文件更大或更晚修改过，否则拼接的内容不可信
+func (c *Client) resumeOffset(remote, part string) (offset, size int64) {
+	fi, err := os.Stat(part)
+	if err != nil || fi.Size() == 0 {
+		return 0, 0
+	}
+	caps, err := c.Caps()
+	if err != nil || !caps.HasFeature("sparse") {
+		return 0, 0
+	}
+	info, err := c.Stat(remote)
+	if err != nil || !info.Exists || info.IsDir || fi.Size() > info.Size || !info.ModTime.Before(fi.ModTime()) {
+		return 0, 0
+	}
+	return fi.Size(), info.Size
+}
+
+// receivePart 把响应正文写入临时文件的 offset 处，offset 为0时新建（截断）临时文件。
+// 写入前为剩余部分预留磁盘空间但不改变文件大小，进程被强行终止时文件大小仍等于已收到的字节数，可以续传
+func (c *Client) receivePart(req, part string, offset, size int64) (TransferStats, error) {
+	var f *os.File
+	end := func() {}
+	defer func() { end() }()
+	st, err := c.receive(c.withMetadata(req), func(n int64) (io.Writer, error) {
+		if offset > 0 && offset+n != size {
+			// 旧版服务端忽略区段参数，返回了整个文件
+			return nil, fmt.Errorf("server returned %d bytes for a range of %d", n, size-offset)
+		}
+		flags := os.O_WRONLY | os.O_CREATE
+		if offset == 0 {
+			flags |= os.O_TRUNC
+		}
+		var err error
+		if f, err = os.OpenFile(part, flags, 0644); err != nil {
+			return nil, err
+		}
+		if err := reserve(f, offset, n); err != nil {
+			return nil, &PreallocError{Size: n, Err: err}
+		}
+		end = c.begin(offset+n, offset)
+		return c.meterWriter(io.NewOffsetWriter(f, offset)), nil
+	})
+	if f != nil {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return st, err
+}
+
+// finishPart 在下载成功、临时文件大小等于 size 且与摘要 want 一致时把它重命名为 local，返回是否核对过摘要。
+// 空间不足或摘要不一致时删除临时文件，其他失败保留它供下次续传
+func (c *Client) finishPart(part, local string, size int64, want string, err error) (bool, error) {
+	var pe *PreallocError
+	if errors.As(err, &pe) {
+		os.Remove(part)
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+	fi, err := os.Stat(part)
+	if err != nil {
+		return false, err
+	}
+	if fi.Size() != size {
+		return false, fmt.Errorf("%s has %d bytes after download, expected %d", part, fi.Size(), size)
+	}
+	verified, err := checkFile(part, want)
+	if err != nil {
+		return false, err
+	}
+	return verified, os.Rename(part, local)
+}
+
+/* ---------- 传输进度 ---------- */
+
+// begin 开始向 TransferReporter 报告一次传输，返回结束报告的函数；没有设置 TransferReporter 时什么也不做
+func (c *Client) begin(total, done int64) func() {
+	if c.transfer == nil {
+		return func() {}
+	}
+	c.transfer.Begin(total, done)
+	return c.transfer.End
+}
+
+// meterReader 返回按 Options.BandwidthLimit 限速、并把读出的字节数报告给 TransferReporter 的 Reader
+func (c *Client) meterReader(r io.Reader) io.Reader {
+	r = throttle.Reader(r, c.bw)
+	if c.transfer == nil {
+		return r
+	}
+	return &meteredReader{r: r, rep: c.transfer}
+}
+
+// meterWriter 返回按 Options.BandwidthLimit 限速、并把写入的字节数报告给 TransferReporter 的 Writer
+func (c *Client) meterWriter(w io.Writer) io.Writer {
+	w = throttle.Writer(w, c.bw)
+	if c.transfer == nil {
+		return w
+	}
+	return &meteredWriter{w: w, rep: c.transfer}
+}
+
+type meteredReader struct {
+	r   io.Reader
+	rep TransferReporter
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	if n > 0 {
+		m.rep.Advance(int64(n))
+	}
+	return n, err
+}
+
+type meteredWriter struct {
+	w   io.Writer
+	rep TransferReporter
+}
+
+func (m *meteredWriter) Write(p []byte) (int, error) {
+	n, err := m.w.Write(p)
+	if n > 0 {
+		m.rep.Advance(int64(n))
+	}
+	return n, err
+}
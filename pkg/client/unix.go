@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+/* ---------- 客户端：Unix 域套接字 ---------- */
+
+// ws+unix:///run/wsbox.sock:/ws 通过 Unix 域套接字连接同一台机器上的服务端（服务端 -addr unix:///run/wsbox.sock），
+// wss+unix:// 同理。第一个冒号之前是套接字的绝对路径，之后是请求路径，省略时为 /ws。
+// 这样的连接不经过代理；token 与 ws:// 一样发送，服务端开了 -no-token-on-unix 时可以不带
+
+// unixTarget 把 ws+unix:// 地址拆成套接字路径和经由它请求的 ws:// 地址，不是这种地址时返回空路径
+func unixTarget(u *url.URL) (string, *url.URL, error) {
+	scheme, ok := strings.CutSuffix(u.Scheme, "+unix")
+	if !ok {
+		return "", u, nil
+	}
+	if scheme != "ws" && scheme != "wss" {
+		return "", nil, fmt.Errorf("unsupported scheme %q, use ws+unix:// or wss+unix://", u.Scheme)
+	}
+	socket, path, _ := strings.Cut(u.Path, ":")
+	if u.Host != "" || !strings.HasPrefix(socket, "/") {
+		return "", nil, fmt.Errorf("%s:// needs an absolute socket path, e.g. %s:///run/wsbox.sock:/ws", u.Scheme, u.Scheme)
+	}
+	if path == "" {
+		path = "/ws"
+	}
+	t := *u
+	t.Scheme, t.Host, t.Path, t.RawPath = scheme, "localhost", path, ""
+	return socket, &t, nil
+}
+
+// unixDialer 返回总是连接 socket 的拨号函数，作为 websocket.Dialer 的 NetDialContext
+func unixDialer(socket string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：活动记录 ---------- */
+
+// activityLog 在内存中保存最近完成的操作（上传、下载、删除），供看板的"最近活动"轮询。
+// 容量固定，写满后挤掉最旧的条目；不持久化，重启后 run 改变、序号重新从1开始
+type activityLog struct {
+	mu    sync.Mutex
+	run   string
+	buf   []protocol.ActivityEntry // 环形缓冲区
+	head  int                      // 最旧条目的下标
+	count int
+	next  uint64 // 下一条的序号
+}
+
+func newActivityLog(size int) *activityLog {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return &activityLog{run: hex.EncodeToString(b), buf: make([]protocol.ActivityEntry, size), next: 1}
+}
+
+// record 追加一条操作记录，size 为0时（活动记录关闭）什么也不做
+func (a *activityLog) record(action, path string, size int64, token string) {
+	if len(a.buf) == 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e := protocol.ActivityEntry{Seq: a.next, Time: time.Now().UTC(), Action: action, Path: path, Size: size, Token: token}
+	a.next++
+	if a.count < len(a.buf) {
+		a.buf[(a.head+a.count)%len(a.buf)] = e
+		a.count++
+		return
+	}
+	a.buf[a.head] = e
+	a.head = (a.head + 1) % len(a.buf)
+}
+
+// query 返回 since 之后最早的 limit 条；没有给出 since 时返回最近的 limit 条。
+// run 与本次运行不同、since 之后有条目已被挤出、或 since 超出了已分配的序号时标记 Gap，从缓冲区中最旧的条目开始返回
+func (a *activityLog) query(run string, since uint64, hasSince bool, limit int) protocol.ActivityResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	res := protocol.ActivityResult{SchemaVersion: protocol.SchemaVersion, Run: a.run, Entries: []protocol.ActivityEntry{}, Last: since}
+	oldest := a.next - uint64(a.count)
+	start := 0 // 在缓冲区中的起始位置（相对最旧条目）
+	switch {
+	case !hasSince:
+		start = max(a.count-limit, 0)
+	case run != "" && run != a.run, since+1 < oldest, since >= a.next:
+		res.Gap = true
+	default:
+		start = int(since + 1 - oldest)
+	}
+	end := min(start+limit, a.count)
+	for i := start; i < end; i++ {
+		res.Entries = append(res.Entries, a.buf[(a.head+i)%len(a.buf)])
+	}
+	if n := len(res.Entries); n > 0 {
+		res.Last = res.Entries[n-1].Seq
+	}
+	res.More = end < a.count
+	return res
+}
+
+// handleActivity 实现 GET /_activity?limit=50&since=<seq>&run=<id>，见 protocol.ActivityResult
+func (s *Server) handleActivity(w http.ResponseWriter, r *http.Request, clientIP string) {
+	if len(s.activity.buf) == 0 {
+		http.Error(w, "activity feed is disabled on this server", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	var since uint64
+	if v := q.Get("since"); v != "" {
+		var err error
+		if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+	}
+	res := s.activity.query(q.Get("run"), since, q.Has("since"), limit)
+	logEvent(logEntry{IP: clientIP, Action: "ACTIVITY", Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("since=%d count=%d gap=%t", since, len(res.Entries), res.Gap)})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 路径别名 ---------- */
+
+// 别名把旧的路径前缀映射到沙箱中的新位置（-alias /old/reports=/archive/2023/reports），整理沙箱后已有的客户端脚本仍然可用。
+// 别名在 resolveSandboxPath 中解析，解析后的路径同样经过 SecurePath 校验。通过别名的请求在响应头 canonicalHeader 中
+// 给出规范路径，网关在协商了 protocol.CanonicalHeader 的连接上把它附加到状态头
+
+// canonicalHeader 是本地处理器告诉网关规范路径的响应头
+const canonicalHeader = "X-Wsbox-Canonical-Path"
+
+// Config.AliasWrites 的取值
+const (
+	AliasWritesDeny  = "deny"  // 通过别名的上传、删除、加锁以 403 ALIAS_READ_ONLY 拒绝（默认）
+	AliasWritesAllow = "allow" // 写入别名指向的位置
+)
+
+func validAliasWrites(v string) error {
+	switch v {
+	case AliasWritesDeny, AliasWritesAllow:
+		return nil
+	}
+	return fmt.Errorf("invalid -alias-writes %q, expected %s or %s", v, AliasWritesDeny, AliasWritesAllow)
+}
+
+// pathAlias 是一条别名，两端都是规范化的沙箱路径
+type pathAlias struct {
+	from, to string
+}
+
+// parseAlias 解析 "/old=/new" 形式的别名
+func parseAlias(spec string) (pathAlias, error) {
+	from, to, ok := strings.Cut(spec, "=")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ok || from == "" || to == "" {
+		return pathAlias{}, fmt.Errorf("invalid alias %q, expected /old/path=/new/path", spec)
+	}
+	for _, p := range []string{from, to} {
+		if err := validPathValue(p); err != nil {
+			return pathAlias{}, fmt.Errorf("alias %q: %w", spec, err)
+		}
+	}
+	a := pathAlias{from: path.Clean("/" + from), to: path.Clean("/" + to)}
+	switch {
+	case a.from == "/":
+		return pathAlias{}, fmt.Errorf("alias %q: the sandbox root cannot be an alias", spec)
+	case strings.HasPrefix(a.from, "/_"):
+		// /_list、/_stat 等接口的路径
+		return pathAlias{}, fmt.Errorf("alias %q: paths starting with /_ are reserved", spec)
+	}
+	return a, nil
+}
+
+// underPath 判断 p 是否为 dir 本身或在它下面，按路径分量比较
+func underPath(p, dir string) bool {
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// checkAliases 拒绝重叠和链式（包括循环）的别名：一个请求路径最多匹配一条别名，解析的结果不会再次命中别名
+func checkAliases(aliases []pathAlias) error {
+	for i, a := range aliases {
+		for j, b := range aliases {
+			if i < j && (underPath(a.from, b.from) || underPath(b.from, a.from)) {
+				return fmt.Errorf("aliases %s and %s overlap", a.from, b.from)
+			}
+			if underPath(a.to, b.from) {
+				if i == j {
+					return fmt.Errorf("alias %s=%s points into itself", a.from, a.to)
+				}
+				return fmt.Errorf("alias %s=%s points into alias %s, aliases cannot chain", a.from, a.to, b.from)
+			}
+		}
+	}
+	return nil
+}
+
+// aliasTable 是生效的别名：命令行的 -alias 加上 -alias-file 中的，后者在 SIGHUP 时重新读取
+type aliasTable struct {
+	static []pathAlias
+	file   string
+	writes string
+
+	mu   sync.Mutex
+	list []pathAlias
+}
+
+func newAliasTable(specs []string, file, writes string) (*aliasTable, error) {
+	if writes == "" {
+		writes = AliasWritesDeny
+	}
+	if err := validAliasWrites(writes); err != nil {
+		return nil, err
+	}
+	t := &aliasTable{file: file, writes: writes}
+	for _, spec := range specs {
+		a, err := parseAlias(spec)
+		if err != nil {
+			return nil, err
+		}
+		t.static = append(t.static, a)
+	}
+	if err := checkAliases(t.static); err != nil {
+		return nil, err
+	}
+	t.list = t.static
+	return t, nil
+}
+
+// load 读取别名文件并与 -alias 合并检查，有问题时保留原来的别名
+func (t *aliasTable) load() (int, error) {
+	list := append([]pathAlias(nil), t.static...)
+	if t.file != "" {
+		fromFile, err := readAliasFile(t.file)
+		if err != nil {
+			return 0, err
+		}
+		list = append(list, fromFile...)
+	}
+	if err := checkAliases(list); err != nil {
+		return 0, err
+	}
+	t.mu.Lock()
+	t.list = list
+	t.mu.Unlock()
+	return len(list), nil
+}
+
+// readAliasFile 读取别名文件：每行一条 /old=/new，空行和 # 开头的行被忽略
+func readAliasFile(name string) ([]pathAlias, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("alias file: %w", err)
+	}
+	defer f.Close()
+	var list []pathAlias
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		a, err := parseAlias(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		list = append(list, a)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("alias file: %w", err)
+	}
+	return list, nil
+}
+
+// resolve 返回 p 经过别名后的规范路径，没有命中别名时 ok 为 false
+func (t *aliasTable) resolve(p string) (canonical string, ok bool) {
+	p = path.Clean("/" + p)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, a := range t.list {
+		if underPath(p, a.from) {
+			return path.Join(a.to, strings.TrimPrefix(p, a.from)), true
+		}
+	}
+	return p, false
+}
+
+// ReloadAliases 重新读取 -alias-file，配合 SIGHUP 调用；没有别名文件时什么也不做。
+// 新的内容有问题（格式错误、重叠、链式）时继续使用原来的别名
+func (s *Server) ReloadAliases() error {
+	if s.aliases.file == "" {
+		return nil
+	}
+	n, err := s.aliases.load()
+	if err != nil {
+		return fmt.Errorf("reload aliases: %w", err)
+	}
+	logf("aliases reloaded: %d in effect", n)
+	return nil
+}
+
+// checkAlias 在分发之前找出请求中经过别名的路径（请求路径或登记的路径参数），在响应头中给出规范路径；
+// -alias-writes 为 deny 时拒绝通过别名的写操作。返回 false 时已经写了响应
+func (s *Server) checkAlias(w http.ResponseWriter, r *http.Request) bool {
+	var raws []string
+	if !strings.HasPrefix(r.URL.Path, "/_") {
+		raws = append(raws, r.URL.Path)
+	}
+	q := r.URL.Query()
+	for _, name := range pathParams {
+		raws = append(raws, q[name]...)
+	}
+	for _, raw := range raws {
+		p, ok, err := s.scopedPath(r, raw)
+		if err != nil || !ok {
+			// 越出子目录的路径由 resolveSandboxPath 拒绝
+			continue
+		}
+		canonical := visiblePath(r, p)
+		w.Header().Set(canonicalHeader, canonical)
+		// 与只读模式一样按方法判断：GET 以外的方法都可能写入
+		if r.Method != "GET" && s.aliases.writes == AliasWritesDeny {
+			msg := fmt.Sprintf("%s is an alias of %s and does not accept writes; use the canonical path", raw, canonical)
+			logEvent(logEntry{IP: r.RemoteAddr, Action: r.Method, Path: raw, Status: http.StatusForbidden, Duration: elapsedSince(r), Err: "write through alias"})
+			writeError(w, http.StatusForbidden, &APIError{Code: protocol.AliasReadOnlyCode, Message: msg})
+			return false
+		}
+		return true
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：追加上传 ---------- */
+
+// POST <path>?append=1 把正文追加到文件末尾（见 protocol.AppendParam），用于持续发送日志之类只增长的文件。
+// 正文先完整写入同目录的暂存文件，核对摘要、通过提交前钩子后，在这个路径的锁（appendLocks）下一次追加到目标：
+// 同时追加同一文件的请求按到达顺序整段写入，不会交错；中断或校验失败的请求不留下任何内容。
+// 追加写到一半失败时把文件截回原来的大小。覆盖策略不适用（已有内容不被替换），上传变换不适用（变换针对整个文件）
+
+// pathLocks 是按路径区分的互斥锁，不用的锁随即删除
+type pathLocks struct {
+	mu sync.Mutex
+	m  map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock 锁住路径 key，返回解锁的函数
+func (p *pathLocks) lock(key string) (unlock func()) {
+	p.mu.Lock()
+	if p.m == nil {
+		p.m = map[string]*pathLock{}
+	}
+	l := p.m[key]
+	if l == nil {
+		l = &pathLock{}
+		p.m[key] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		p.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(p.m, key)
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (s *Server) handleAppend(w http.ResponseWriter, r *http.Request, clientIP string) {
+	path, real, err := s.resolveSandboxPath(r, "")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "APPEND", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fail := func(status int, n int64, e *APIError) {
+		logEvent(logEntry{IP: clientIP, Action: "APPEND", Path: path, Status: status, Bytes: n, Duration: elapsedSince(r), Err: e.Message})
+		writeError(w, status, e)
+	}
+	md, err := requestMetadata(r)
+	if err != nil {
+		rejectMetadata(w, clientIP, "APPEND", err)
+		return
+	}
+	want, err := expectedDigest(r)
+	if err != nil {
+		fail(http.StatusBadRequest, 0, &APIError{Code: "BAD_DIGEST", Message: err.Error()})
+		return
+	}
+	if len(s.hooks.transformUpload) > 0 {
+		// 变换可能依赖偏移（如CTR计数器），接在已有内容之后的部分无法单独变换
+		fail(http.StatusConflict, 0, &APIError{Code: "APPEND_UNAVAILABLE", Message: "append uploads are unavailable for transformed uploads"})
+		return
+	}
+	if isReservedName(filepath.Base(real)) {
+		fail(http.StatusBadRequest, 0, &APIError{Code: "INVALID_PATH", Message: "reserved name"})
+		return
+	}
+	if fi, err := os.Stat(real); err == nil && fi.IsDir() {
+		fail(http.StatusConflict, 0, &APIError{Code: "IS_DIRECTORY", Message: path + " is a directory"})
+		return
+	} else if err == nil && !fi.Mode().IsRegular() {
+		fail(http.StatusBadRequest, 0, &APIError{Code: "INVALID_PATH", Message: path + " is not a regular file"})
+		return
+	}
+	if rejected := s.checkNewPath(real, false); rejected != nil {
+		fail(http.StatusUnprocessableEntity, 0, rejected)
+		return
+	}
+	if s.maxUpload > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	}
+	if _, err := s.createDirs(filepath.Dir(real)); err != nil {
+		fail(http.StatusBadRequest, 0, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	if rejected := s.checkCaseCollision(real, path, clientIP); rejected != nil {
+		writeError(w, http.StatusConflict, rejected)
+		return
+	}
+	if l := activeLock(real); l != nil {
+		fail(http.StatusLocked, 0, &APIError{Code: "LOCKED", Message: "path is locked by " + l.Holder})
+		return
+	}
+
+	stage, err := os.CreateTemp(filepath.Dir(real), "."+filepath.Base(real)+tempMarker+"*")
+	if err != nil {
+		fail(http.StatusInternalServerError, 0, &APIError{Code: "UPLOAD_FAILED", Message: err.Error()})
+		return
+	}
+	defer os.Remove(stage.Name())
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(stage, h), r.Body)
+	if err == nil {
+		_, err = stage.Seek(0, io.SeekStart)
+	}
+	defer stage.Close()
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			fail(http.StatusRequestEntityTooLarge, n, s.tooLarge())
+			return
+		}
+		fail(http.StatusBadRequest, n, &APIError{Code: "UPLOAD_ABORTED", Message: "receiving the appended data failed: " + err.Error()})
+		return
+	}
+	if want == protocol.DigestTrailer {
+		if want = trailerDigest(r); want == "" {
+			fail(http.StatusBadRequest, n, &APIError{Code: "BAD_DIGEST", Message: "the upload declared a trailing SHA-256 but its end marker carried none"})
+			return
+		}
+	}
+	ev := TransferEvent{Path: path, Size: n, Hash: hex.EncodeToString(h.Sum(nil)), Identity: r.Header.Get("X-Wsbox-Token"), ClientIP: clientIP, Metadata: md}
+	if want != "" && ev.Hash != want {
+		fail(http.StatusUnprocessableEntity, n, digestMismatch(want, ev.Hash))
+		return
+	}
+	ev.Staged = stage.Name()
+	if status, rejected := runPreHooks(r.Context(), s.hooks.uploadStaged, ev); rejected != nil {
+		fail(status, n, rejected)
+		return
+	}
+	ev.Staged = ""
+
+	size, isNew, err := s.appendStaged(stage, real)
+	if err != nil {
+		fail(http.StatusInternalServerError, n, &APIError{Code: "UPLOAD_FAILED", Message: err.Error()})
+		return
+	}
+	if isNew {
+		s.noteCreated(real)
+	}
+	logEvent(logEntry{IP: clientIP, Action: "APPEND", Path: path, Status: http.StatusCreated, Bytes: n, Duration: elapsedSince(r),
+		Detail: strings.TrimSpace(fmt.Sprintf("size=%d", size) + formatMetadata(md))})
+	runPostHooks(r.Context(), s.hooks.uploadComplete, ev, "APPEND")
+	s.activity.record("append", path, n, ev.Identity)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(protocol.AppendResult{SchemaVersion: protocol.SchemaVersion, Path: path, Appended: n, Size: size})
+}
+
+// appendStaged 在 real 的锁下把暂存文件的内容追加到 real 末尾并落盘，返回追加后的大小和 real 是否是新建的
+func (s *Server) appendStaged(stage *os.File, real string) (size int64, isNew bool, err error) {
+	defer s.appendLocks.lock(real)()
+	_, statErr := os.Lstat(real)
+	isNew = os.IsNotExist(statErr)
+	f, err := os.OpenFile(real, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	before := fi.Size()
+	n, err := io.Copy(f, stage)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		// 不留下半段内容，下一次追加接在完整的内容之后
+		if isNew {
+			f.Close()
+			os.Remove(real)
+		} else {
+			f.Truncate(before)
+		}
+		return 0, false, err
+	}
+	s.hashes.forget(real)
+	return before + n, isNew, nil
+}
@@ -0,0 +1,386 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：目录打包下载 ---------- */
+
+// GET /_archive?dir=&format=tgz|zip&symlinks=skip|store 边遍历边把目录打包输出，不在内存或磁盘上缓存归档。
+// 处理器先输出一行 protocol.ArchiveHeader，然后是归档本身，写完后在 trailer 中给出 protocol.ArchiveSummary。
+// 网关识别 archiveType 的响应，状态头的长度字段写为 -1，然后按帧转发：
+//
+//	{"status":200,"size":-1}                 状态头
+//	{"schema_version":1,"dir":"/a",...}      文本帧：头部
+//	<归档数据>                               二进制帧，每帧最多 protocol.FlowChunkSize 字节
+//	{"files":12,"bytes":40960,...}           文本帧：摘要，流结束
+//
+// 与流式列表一样不参与流控确认，背压由 TCP 提供。归档中途出错时（如处理器 panic）摘要的 error 不为空，
+// 客户端据此丢弃已收到的数据；连接仍可继续使用。
+// 遍历不跟随符号链接：symlinks=skip（默认）时跳过，store 时作为链接本身存入，目标原样记录、从不读取
+const archiveType = "application/x-wsbox-archive"
+
+// archiveSummaryHeader 是处理器写完归档后设置的 trailer，值为 JSON 编码的 protocol.ArchiveSummary
+const archiveSummaryHeader = "X-Wsbox-Archive-Summary"
+
+// 源文件的问题不影响归档本身：errSourceSkipped 表示文件没有写入归档（打不开，或者与遍历时看到的不是同一个文件），
+// errSourceChanged 表示条目已经写入，但文件在打包期间变短或读取出错，缺少的内容以零补足
+var (
+	errSourceSkipped = errors.New("file could not be archived")
+	errSourceChanged = errors.New("file changed while archiving")
+)
+
+func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request, clientIP string) {
+	dir, real, err := s.resolveSandboxPath(r, "dir")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "ARCHIVE", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fail := func(status int, e *APIError) {
+		logEvent(logEntry{IP: clientIP, Action: "ARCHIVE", Path: dir, Status: status, Duration: elapsedSince(r), Err: e.Message})
+		writeError(w, status, e)
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = protocol.ArchiveTarGz
+	}
+	if format != protocol.ArchiveTarGz && format != protocol.ArchiveZip {
+		fail(http.StatusBadRequest, &APIError{Code: "BAD_FORMAT", Message: "format must be tgz or zip"})
+		return
+	}
+	storeLinks := false
+	switch q.Get("symlinks") {
+	case "", "skip":
+	case "store":
+		storeLinks = true
+	default:
+		fail(http.StatusBadRequest, &APIError{Code: "BAD_SYMLINKS", Message: "symlinks must be skip or store"})
+		return
+	}
+	fi, err := os.Stat(real)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fail(http.StatusNotFound, &APIError{Code: "NOT_FOUND", Message: "directory not found"})
+		} else {
+			fail(http.StatusInternalServerError, &APIError{Code: "STAT_FAILED", Message: err.Error()})
+		}
+		return
+	}
+	if !fi.IsDir() {
+		fail(http.StatusBadRequest, &APIError{Code: protocol.NotDirectoryCode, Message: "not a directory"})
+		return
+	}
+
+	// 打包持续到传输结束，不受 -walk-timeout 限制，客户端断开时停止
+	release, _, ok := s.heavy(w, r, clientIP, "ARCHIVE", weightWalk)
+	if !ok {
+		return
+	}
+	defer release()
+
+	w.Header().Set("Content-Type", archiveType)
+	json.NewEncoder(w).Encode(protocol.ArchiveHeader{SchemaVersion: protocol.SchemaVersion, Dir: dir, Format: format})
+	aw := newArchiveWriter(format, w)
+
+	var sum protocol.ArchiveSummary
+	skip := func(p string, err error) {
+		sum.Skipped++
+		logf("archive %s: skipped %s: %v", dir, p, err)
+	}
+	err = filepath.WalkDir(real, func(p string, d fs.DirEntry, err error) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			if p == real {
+				return err
+			}
+			skip(p, err)
+			return nil
+		}
+		if p == real || isReservedName(d.Name()) {
+			return nil
+		}
+		rel, _ := filepath.Rel(real, p)
+		name := filepath.ToSlash(rel)
+		info, err := d.Info()
+		if err != nil {
+			skip(p, err)
+			return nil
+		}
+		switch {
+		case d.IsDir():
+			sum.Dirs++
+			return aw.dir(name, info)
+		case d.Type()&fs.ModeSymlink != 0:
+			if !storeLinks {
+				sum.Skipped++
+				return nil
+			}
+			target, err := os.Readlink(p)
+			if err != nil {
+				skip(p, err)
+				return nil
+			}
+			sum.Links++
+			return aw.link(name, target, info)
+		case d.Type().IsRegular():
+			n, err := archiveFile(aw, name, p, info)
+			switch {
+			case errors.Is(err, errSourceSkipped):
+				skip(p, err)
+				return nil
+			case errors.Is(err, errSourceChanged):
+				sum.Changed++
+				logf("archive %s: %s: %v", dir, p, err)
+			case err != nil:
+				return err
+			}
+			sum.Files++
+			sum.Bytes += n
+			return nil
+		}
+		// 设备、管道、套接字
+		sum.Skipped++
+		return nil
+	})
+	if cerr := aw.Close(); err == nil {
+		err = cerr
+	}
+	status := http.StatusOK
+	if err != nil {
+		sum.Error = err.Error()
+		status = http.StatusInternalServerError
+	}
+	b, _ := json.Marshal(sum)
+	w.Header().Set(http.TrailerPrefix+archiveSummaryHeader, string(b))
+	logEvent(logEntry{IP: clientIP, Action: "ARCHIVE", Path: dir, Status: status, Duration: elapsedSince(r),
+		Detail: fmt.Sprintf("format=%s files=%d dirs=%d links=%d skipped=%d bytes=%d", format, sum.Files, sum.Dirs, sum.Links, sum.Skipped, sum.Bytes), Err: sum.Error})
+}
+
+// archiveFile 把文件 p 的内容以 name 写入归档，返回读到的字节数。打开的文件与遍历时看到的不是同一个
+// （期间被换成了符号链接或别的文件）时不写入，返回 errSourceSkipped；其余错误来自归档的写入，归档已不可用
+func archiveFile(aw archiveWriter, name, p string, walked fs.FileInfo) (int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errSourceSkipped, err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errSourceSkipped, err)
+	}
+	if !os.SameFile(fi, walked) || !fi.Mode().IsRegular() {
+		return 0, fmt.Errorf("%w: replaced during the walk", errSourceSkipped)
+	}
+	src := &sourceReader{r: f}
+	n, err := aw.file(name, src, fi)
+	if err == nil && (n < fi.Size() || src.err != nil) {
+		if src.err != nil {
+			return n, fmt.Errorf("%w: %v", errSourceChanged, src.err)
+		}
+		return n, errSourceChanged
+	}
+	return n, err
+}
+
+// sourceReader 把读取源文件的错误当作文件结束，记在 err 中，与写入归档的错误区分开
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+		err = io.EOF
+	}
+	return n, err
+}
+
+// archiveWriter 是 tar.gz 与 zip 的共同接口，name 是 "/" 分隔的相对路径
+type archiveWriter interface {
+	dir(name string, fi fs.FileInfo) error
+	link(name, target string, fi fs.FileInfo) error
+	file(name string, r io.Reader, fi fs.FileInfo) (int64, error)
+	Close() error
+}
+
+func newArchiveWriter(format string, w io.Writer) archiveWriter {
+	if format == protocol.ArchiveZip {
+		return &zipArchive{zw: zip.NewWriter(w)}
+	}
+	gz := gzip.NewWriter(w)
+	return &tarArchive{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+type tarArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarArchive) header(name, link string, fi fs.FileInfo) (*tar.Header, error) {
+	h, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return nil, err
+	}
+	h.Name = name
+	if fi.IsDir() {
+		h.Name += "/"
+	}
+	// 服务端的用户名和组名对下载方没有意义
+	h.Uname, h.Gname = "", ""
+	return h, nil
+}
+
+func (a *tarArchive) dir(name string, fi fs.FileInfo) error {
+	h, err := a.header(name, "", fi)
+	if err != nil {
+		return err
+	}
+	return a.tw.WriteHeader(h)
+}
+
+func (a *tarArchive) link(name, target string, fi fs.FileInfo) error {
+	h, err := a.header(name, target, fi)
+	if err != nil {
+		return err
+	}
+	return a.tw.WriteHeader(h)
+}
+
+// file 返回从 r 读到的字节数。r 提前结束时用零补足头部声明的长度，条目仍然完整
+func (a *tarArchive) file(name string, r io.Reader, fi fs.FileInfo) (int64, error) {
+	h, err := a.header(name, "", fi)
+	if err != nil {
+		return 0, err
+	}
+	if err := a.tw.WriteHeader(h); err != nil {
+		return 0, err
+	}
+	n, err := io.CopyN(a.tw, r, h.Size)
+	if err == io.EOF {
+		_, err = io.CopyN(a.tw, zeroReader{}, h.Size-n)
+	}
+	return n, err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) create(name string, fi fs.FileInfo, method uint16) (io.Writer, error) {
+	h, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return nil, err
+	}
+	h.Name = name
+	if fi.IsDir() {
+		h.Name += "/"
+	}
+	h.Method = method
+	return a.zw.CreateHeader(h)
+}
+
+func (a *zipArchive) dir(name string, fi fs.FileInfo) error {
+	_, err := a.create(name, fi, zip.Store)
+	return err
+}
+
+// link 按 Info-ZIP 的约定存储符号链接：权限位带 ModeSymlink，内容是链接目标
+func (a *zipArchive) link(name, target string, fi fs.FileInfo) error {
+	w, err := a.create(name, fi, zip.Store)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, target)
+	return err
+}
+
+func (a *zipArchive) file(name string, r io.Reader, fi fs.FileInfo) (int64, error) {
+	w, err := a.create(name, fi, zip.Deflate)
+	if err != nil {
+		return 0, err
+	}
+	// zip 在数据之后记录长度，r 提前结束时条目就短一些
+	n, err := io.CopyN(w, r, fi.Size())
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (a *zipArchive) Close() error { return a.zw.Close() }
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// relayArchive 转发打包下载的响应，帧格式见 archiveType。处理器中途失败时仍以摘要帧结束，错误写在摘要中
+func relayArchive(conn frameConn, resp *http.Response, t transfer) error {
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(t.statusHeader(resp, protocol.StreamedSize))); err != nil {
+		return err
+	}
+	br := bufio.NewReaderSize(resp.Body, protocol.FlowChunkSize)
+	header, err := br.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("archive: read header: %w", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, bytes.TrimSuffix(header, []byte("\n"))); err != nil {
+		return err
+	}
+	buf := make([]byte, protocol.FlowChunkSize)
+	var readErr error
+	for {
+		n, err := io.ReadFull(br, buf)
+		if n > 0 {
+			if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	summary := []byte(resp.Trailer.Get(archiveSummaryHeader))
+	if readErr != nil || len(summary) == 0 {
+		if readErr == nil {
+			readErr = errors.New("archive ended without a summary")
+		}
+		summary, _ = json.Marshal(protocol.ArchiveSummary{Error: readErr.Error()})
+	}
+	return conn.WriteMessage(websocket.TextMessage, summary)
+}
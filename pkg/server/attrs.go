@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：保留修改时间与权限 ---------- */
+
+// 上传请求带 protocol.MtimeParam 和 protocol.ModeParam 时，处理器在提交（重命名到目标路径）之前把它们设到暂存文件上，
+// 其他读者看到的文件从一开始就带着客户端的修改时间和权限，/_stat 和 /_list 也就如实反映它们。
+// 权限只取 0777 的部分，并且总是保留属主的读权限，否则服务端自己也无法再提供下载。
+// 下载时处理器把文件的修改时间和权限放在 mtimeHeader 和 modeHeader 中，网关附加到版本2的状态头
+
+// 本地处理器告诉网关下载文件属性的响应头
+const (
+	mtimeHeader = "X-Wsbox-Mtime"
+	modeHeader  = "X-Wsbox-Mode"
+)
+
+// fileAttrs 是上传请求要求保留的属性，零值表示没有要求
+type fileAttrs struct {
+	mtime   time.Time
+	mode    fs.FileMode
+	hasMode bool
+}
+
+// uploadAttrs 解析上传请求的 mtime 和 mode 参数，格式不对时返回错误
+func uploadAttrs(r *http.Request) (fileAttrs, error) {
+	var a fileAttrs
+	q := r.URL.Query()
+	if v := q.Get(protocol.MtimeParam); v != "" {
+		t, err := protocol.ParseMtime(v)
+		if err != nil {
+			return a, err
+		}
+		a.mtime = t
+	}
+	if v := q.Get(protocol.ModeParam); v != "" {
+		m, err := protocol.ParseMode(v)
+		if err != nil {
+			return a, err
+		}
+		a.mode, a.hasMode = m|0400, true
+	}
+	return a, nil
+}
+
+// apply 把属性设到文件 name 上
+func (a fileAttrs) apply(name string) error {
+	if a.hasMode {
+		if err := chmodPreserved(name, a.mode); err != nil {
+			return fmt.Errorf("set mode: %w", err)
+		}
+	}
+	if !a.mtime.IsZero() {
+		if err := os.Chtimes(name, a.mtime, a.mtime); err != nil {
+			return fmt.Errorf("set modification time: %w", err)
+		}
+	}
+	return nil
+}
+
+// setAttrHeaders 在下载响应中给出文件的修改时间和权限
+func setAttrHeaders(w http.ResponseWriter, fi os.FileInfo) {
+	w.Header().Set(mtimeHeader, protocol.FormatMtime(fi.ModTime()))
+	w.Header().Set(modeHeader, protocol.FormatMode(fi.Mode()))
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：配置安全审计 ---------- */
+
+// 审计发现的严重程度。存在 high 时 AuditReport.OK 为 false，"wsbox server audit" 以非零状态退出
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+)
+
+// AuditFinding 是一条审计发现，Code 供流水线按规则豁免
+type AuditFinding struct {
+	Code     string   `json:"code"`
+	Severity string   `json:"severity"`
+	Message  string   `json:"message"`
+	Hint     string   `json:"hint,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+}
+
+// AuditReport 是 "wsbox server audit -json" 的输出
+type AuditReport struct {
+	SchemaVersion int            `json:"schema_version"`
+	Addr          string         `json:"addr"`
+	Dir           string         `json:"dir"`
+	OK            bool           `json:"ok"`
+	Findings      []AuditFinding `json:"findings"`
+}
+
+// secretPatterns 是常见的敏感文件名，出现在沙箱中即可被任何持有token的客户端下载
+var secretPatterns = []string{
+	".env", ".env.*", "*.pem", "*.key", "id_rsa", "id_dsa", "id_ecdsa", "id_ed25519",
+	".netrc", ".git-credentials", ".npmrc", ".pypirc", "credentials", "*.kdbx", ".htpasswd",
+}
+
+// auditSecretScanLimit 限制查找敏感文件时访问的目录项数量，避免在大目录上卡住
+const auditSecretScanLimit = 20000
+
+// Audit 评估当前配置，没有高危发现时 report.OK 为 true。
+// 只读取配置和沙箱目录，可以在 Open 之前调用
+func (s *Server) Audit() AuditReport {
+	report := AuditReport{SchemaVersion: protocol.SchemaVersion, Addr: s.addr, Dir: s.dir, OK: true, Findings: s.auditFindings()}
+	for _, f := range report.Findings {
+		if f.Severity == SeverityHigh {
+			report.OK = false
+		}
+	}
+	return report
+}
+
+func (s *Server) auditFindings() []AuditFinding {
+	var out []AuditFinding
+	add := func(f *AuditFinding) {
+		if f != nil {
+			out = append(out, *f)
+		}
+	}
+	add(auditToken(s.token))
+	add(auditListener(s.addr, s.certFile != ""))
+	if s.origins == nil {
+		add(auditOrigin())
+	}
+	if s.trustProxy {
+		add(auditTrustProxy(s.addr, s.ipFilter))
+	}
+	if s.unixNoToken {
+		add(auditUnixNoToken(s.socketMode))
+	}
+	out = append(out, auditSandbox(s.dir)...)
+	add(auditUploadLimits())
+	add(auditSecrets(s.dir))
+	if len(s.scanners) > 0 && s.scanFailOpen {
+		add(&AuditFinding{Code: "SCAN_FAIL_OPEN", Severity: SeverityMedium,
+			Message: "uploads are accepted unscanned when the content scanner is unavailable",
+			Hint:    "drop -scan-fail-open unless availability matters more than scanning"})
+	}
+	if s.walkTimeout <= 0 {
+		add(&AuditFinding{Code: "WALK_UNBOUNDED", Severity: SeverityLow,
+			Message: "directory walks have no time budget, one request on a huge tree can hold a worker indefinitely",
+			Hint:    "set -walk-timeout to a positive duration"})
+	}
+	return out
+}
+
+// auditToken 检查固定token的长度与熵；留空时自动生成128位随机token，不产生发现
+func auditToken(token string) *AuditFinding {
+	if token == "" {
+		return nil
+	}
+	bits := tokenEntropy(token)
+	switch {
+	case len(token) < 16 || bits < 64:
+		return &AuditFinding{Code: "TOKEN_WEAK", Severity: SeverityHigh,
+			Message: fmt.Sprintf("fixed token is %d characters with an estimated %.0f bits of entropy", len(token), bits),
+			Hint:    "use at least 32 random hex characters, e.g. openssl rand -hex 16, or omit -token"}
+	case bits < 128:
+		return &AuditFinding{Code: "TOKEN_WEAK", Severity: SeverityMedium,
+			Message: fmt.Sprintf("fixed token has an estimated %.0f bits of entropy, below 128", bits),
+			Hint:    "use at least 32 random hex characters, e.g. openssl rand -hex 16, or omit -token"}
+	}
+	return nil
+}
+
+// tokenEntropy 按字符频率估算token的香农熵（位），对重复和单一字符集的token偏保守
+func tokenEntropy(token string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range token {
+		counts[r]++
+		n++
+	}
+	var perChar float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		perChar -= p * math.Log2(p)
+	}
+	return perChar * float64(n)
+}
+
+// auditListener 检查网关是否以明文监听在非回环地址上
+func auditListener(addr string, tls bool) *AuditFinding {
+	if _, ok := unixSocketPath(addr); ok {
+		// Unix 域套接字不经过网络
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return &AuditFinding{Code: "ADDR_INVALID", Severity: SeverityHigh,
+			Message: fmt.Sprintf("cannot parse listen address %q: %v", addr, err)}
+	}
+	if tls || host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return &AuditFinding{Code: "TLS_DISABLED", Severity: SeverityHigh,
+		Message: fmt.Sprintf("gateway listens on %s without TLS, the token and file contents cross the network in clear text", addr),
+		Hint:    "pass -cert and -key, or listen on 127.0.0.1 behind a TLS-terminating reverse proxy"}
+}
+
+// auditOrigin 报告网关接受任意 Origin（没有 -allowed-origins）。token 不在 cookie 中，别的网页不知道token就无法借用浏览器连接，风险较低
+func auditOrigin() *AuditFinding {
+	return &AuditFinding{Code: "ORIGIN_UNCHECKED", Severity: SeverityLow,
+		Message: "the websocket upgrader accepts any Origin; only the bearer token protects the gateway",
+		Hint:    "pass -allowed-origins with the origins of your web frontends, or restrict Origin at the reverse proxy"}
+}
+
+// auditTrustProxy 报告信任代理头、而网关不只监听回环地址又没有 -allow-cidr 的情况：客户端可以直接连接并伪造自己的地址
+func auditTrustProxy(addr string, f *ipFilter) *AuditFinding {
+	if f != nil && len(f.allow) > 0 {
+		return nil
+	}
+	if _, ok := unixSocketPath(addr); ok {
+		return nil
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return &AuditFinding{Code: "PROXY_HEADER_SPOOFABLE", Severity: SeverityMedium,
+		Message: "-trust-proxy-header takes the client address from X-Forwarded-For, but clients can reach the gateway directly and forge it",
+		Hint:    "listen on 127.0.0.1 behind the proxy, or restrict the gateway to the proxy's address with -allow-cidr"}
+}
+
+// auditUnixNoToken 报告 -no-token-on-unix：能连接套接字就有完整权限，套接字对所有用户可写时更严重
+func auditUnixNoToken(mode os.FileMode) *AuditFinding {
+	f := &AuditFinding{Code: "UNIX_NO_TOKEN", Severity: SeverityLow,
+		Message: "requests over the unix socket need no token, whoever can open the socket has full access",
+		Hint:    "keep -socket-mode limited to the users that should have access, and do not put a reverse proxy in front of the socket"}
+	if mode&0o002 != 0 {
+		f.Severity = SeverityHigh
+		f.Message = fmt.Sprintf("the unix socket is writable by every local user (mode %04o) and needs no token", mode)
+	}
+	return f
+}
+
+// auditSandbox 检查沙箱目录本身：是否为根目录或家目录、是否全局可写
+func auditSandbox(dir string) []AuditFinding {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return []AuditFinding{{Code: "SANDBOX_INVALID", Severity: SeverityHigh, Message: err.Error()}}
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return []AuditFinding{{Code: "SANDBOX_INVALID", Severity: SeverityHigh,
+			Message: fmt.Sprintf("sandbox %s is not accessible: %v", abs, err)}}
+	}
+	if !fi.IsDir() {
+		return []AuditFinding{{Code: "SANDBOX_INVALID", Severity: SeverityHigh,
+			Message: fmt.Sprintf("sandbox %s is not a directory", abs)}}
+	}
+
+	var out []AuditFinding
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = real
+	}
+	if filepath.Dir(abs) == abs {
+		out = append(out, AuditFinding{Code: "SANDBOX_ROOT", Severity: SeverityHigh,
+			Message: fmt.Sprintf("sandbox is the filesystem root %s", abs),
+			Hint:    "serve a dedicated directory instead"})
+	} else if home, err := os.UserHomeDir(); err == nil {
+		if real, err := filepath.EvalSymlinks(home); err == nil {
+			home = real
+		}
+		if rel, err := filepath.Rel(abs, home); err == nil && !strings.HasPrefix(rel, "..") {
+			out = append(out, AuditFinding{Code: "SANDBOX_HOME", Severity: SeverityHigh,
+				Message: fmt.Sprintf("sandbox %s contains the home directory %s", abs, home),
+				Hint:    "serve a dedicated directory instead"})
+		}
+	}
+	if fi.Mode().Perm()&0o002 != 0 {
+		out = append(out, AuditFinding{Code: "SANDBOX_WORLD_WRITABLE", Severity: SeverityMedium,
+			Message: fmt.Sprintf("sandbox %s is world-writable (%s), any local user can plant files served to clients", abs, fi.Mode().Perm()),
+			Hint:    "chmod o-w " + abs})
+	}
+	return out
+}
+
+// auditUploadLimits 报告上传没有大小或配额限制，wsbox 当前不支持这类限制
+func auditUploadLimits() *AuditFinding {
+	return &AuditFinding{Code: "UPLOAD_UNLIMITED", Severity: SeverityMedium,
+		Message: "uploads have no size or quota limit, a client holding the token can fill the disk",
+		Hint:    "put the sandbox on its own filesystem or enforce a quota there"}
+}
+
+// auditSecrets 查找沙箱中的常见敏感文件。wsbox 没有拒绝规则，它们都可以被下载
+func auditSecrets(dir string) *AuditFinding {
+	var found []string
+	seen := 0
+	errLimit := errors.New("limit")
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if seen++; seen > auditSecretScanLimit {
+			return errLimit
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != dir && (name == ".ssh" || name == ".aws" || name == ".gnupg") {
+				rel, _ := filepath.Rel(dir, p)
+				found = append(found, rel+"/")
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isReservedName(name) {
+			return nil
+		}
+		for _, pat := range secretPatterns {
+			if ok, _ := filepath.Match(pat, name); ok {
+				rel, _ := filepath.Rel(dir, p)
+				found = append(found, rel)
+				break
+			}
+		}
+		return nil
+	})
+	if len(found) == 0 {
+		return nil
+	}
+	return &AuditFinding{Code: "SECRETS_EXPOSED", Severity: SeverityHigh,
+		Message: fmt.Sprintf("%d file(s) matching common secret names are downloadable, wsbox has no deny patterns", len(found)),
+		Hint:    "move them out of the sandbox",
+		Paths:   found}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// strongToken 是128位以上熵的固定token，不触发 TOKEN_WEAK
+const strongToken = "9f2c4a7e1b8d3f60c5a9e2d47b1f8c3a6e0d5b2c"
+
+// auditConfig 是审计没有可报告内容的配置（上传限制除外，wsbox 总会报告 UPLOAD_UNLIMITED）：
+// 回环地址、强token、限定 Origin、有遍历时限、权限为 0755 的空沙箱，HOME 不在沙箱内
+func auditConfig(t *testing.T) Config {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", t.TempDir())
+	return Config{
+		Addr: "127.0.0.1:8080", Dir: dir, Token: strongToken,
+		AllowedOrigins: []string{"https://app.example.com"}, WalkTimeout: time.Minute,
+	}
+}
+
+// auditCodes 对 cfg 运行审计，按 Code 返回发现；Audit 不需要 Open
+func auditCodes(t *testing.T, cfg Config) (AuditReport, map[string]AuditFinding) {
+	t.Helper()
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	report := s.Audit()
+	codes := map[string]AuditFinding{}
+	for _, f := range report.Findings {
+		codes[f.Code] = f
+	}
+	return report, codes
+}
+
+// 基线配置只有 UPLOAD_UNLIMITED 一条中危发现，报告 OK；每个检查的测试都从它出发，只改一处
+func TestAuditBaseline(t *testing.T) {
+	report, codes := auditCodes(t, auditConfig(t))
+	if !report.OK || len(codes) != 1 || codes["UPLOAD_UNLIMITED"].Severity != SeverityMedium {
+		t.Fatalf("baseline audit: %+v", report)
+	}
+}
+
+// expectFinding 检查 cfg 的审计中有 code 这条发现，严重程度为 severity，并据此决定报告是否 OK
+func expectFinding(t *testing.T, cfg Config, code, severity string) AuditFinding {
+	t.Helper()
+	report, codes := auditCodes(t, cfg)
+	f, ok := codes[code]
+	if !ok {
+		t.Fatalf("no %s finding in %+v", code, report.Findings)
+	}
+	if f.Severity != severity {
+		t.Errorf("%s has severity %s, want %s", code, f.Severity, severity)
+	}
+	if report.OK != (severity != SeverityHigh) {
+		t.Errorf("%s (%s): report.OK = %v", code, severity, report.OK)
+	}
+	return f
+}
+
+func TestAuditWeakToken(t *testing.T) {
+	tests := []struct {
+		token    string
+		severity string
+	}{
+		{"secret", SeverityHigh},                               // 太短
+		{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", SeverityHigh}, // 够长但没有熵
+		{"0123456789abcdef0123", SeverityMedium},               // 约80位
+	}
+	for _, tt := range tests {
+		cfg := auditConfig(t)
+		cfg.Token = tt.token
+		expectFinding(t, cfg, "TOKEN_WEAK", tt.severity)
+	}
+	// 不指定token时自动生成随机token，没有发现
+	cfg := auditConfig(t)
+	cfg.Token = ""
+	if _, codes := auditCodes(t, cfg); codes["TOKEN_WEAK"].Code != "" {
+		t.Errorf("a generated token was reported as weak")
+	}
+}
+
+func TestAuditTLSDisabled(t *testing.T) {
+	for _, addr := range []string{":8080", "0.0.0.0:8080", "192.0.2.10:8080", "[::]:8080"} {
+		cfg := auditConfig(t)
+		cfg.Addr = addr
+		f := expectFinding(t, cfg, "TLS_DISABLED", SeverityHigh)
+		if !strings.Contains(f.Message, addr) {
+			t.Errorf("%s: message %q does not name the address", addr, f.Message)
+		}
+	}
+	// 回环地址、localhost 和 Unix 域套接字不经过网络
+	for _, addr := range []string{"127.0.0.1:8080", "[::1]:8080", "localhost:8080", "unix://" + filepath.Join(t.TempDir(), "w.sock")} {
+		cfg := auditConfig(t)
+		cfg.Addr = addr
+		if _, codes := auditCodes(t, cfg); codes["TLS_DISABLED"].Code != "" {
+			t.Errorf("%s was reported as a network listener without TLS", addr)
+		}
+	}
+	// 证书只在 Open 时加载，审计只看是否配置了
+	cfg := auditConfig(t)
+	cfg.Addr, cfg.CertFile, cfg.KeyFile = ":8443", "cert.pem", "key.pem"
+	if _, codes := auditCodes(t, cfg); codes["TLS_DISABLED"].Code != "" {
+		t.Errorf("a listener with -cert was reported as clear text")
+	}
+}
+
+func TestAuditInvalidAddr(t *testing.T) {
+	cfg := auditConfig(t)
+	cfg.Addr = "no-port"
+	expectFinding(t, cfg, "ADDR_INVALID", SeverityHigh)
+}
+
+func TestAuditOriginUnchecked(t *testing.T) {
+	cfg := auditConfig(t)
+	cfg.AllowedOrigins = nil
+	expectFinding(t, cfg, "ORIGIN_UNCHECKED", SeverityLow)
+}
+
+func TestAuditProxyHeaderSpoofable(t *testing.T) {
+	cfg := auditConfig(t)
+	cfg.TrustProxyHeader = true
+	cfg.Addr, cfg.CertFile, cfg.KeyFile = ":8443", "cert.pem", "key.pem"
+	expectFinding(t, cfg, "PROXY_HEADER_SPOOFABLE", SeverityMedium)
+
+	// 只接受代理地址的请求时客户端无法直接连接
+	cfg.AllowCIDR = []string{"10.0.0.5"}
+	if _, codes := auditCodes(t, cfg); codes["PROXY_HEADER_SPOOFABLE"].Code != "" {
+		t.Errorf("-allow-cidr did not clear PROXY_HEADER_SPOOFABLE")
+	}
+}
+
+func TestAuditUnixNoToken(t *testing.T) {
+	cfg := auditConfig(t)
+	cfg.Addr = "unix://" + filepath.Join(t.TempDir(), "w.sock")
+	cfg.NoTokenOnUnix = true
+	expectFinding(t, cfg, "UNIX_NO_TOKEN", SeverityLow)
+
+	cfg.SocketMode = 0o666
+	f := expectFinding(t, cfg, "UNIX_NO_TOKEN", SeverityHigh)
+	if !strings.Contains(f.Message, "0666") {
+		t.Errorf("message %q does not show the socket mode", f.Message)
+	}
+}
+
+func TestAuditSandboxRoot(t *testing.T) {
+	cfg := auditConfig(t)
+	cfg.Dir = "/"
+	expectFinding(t, cfg, "SANDBOX_ROOT", SeverityHigh)
+}
+
+func TestAuditSandboxHome(t *testing.T) {
+	cfg := auditConfig(t)
+	// 沙箱就是家目录，或者包含家目录
+	home := filepath.Join(cfg.Dir, "home", "alice")
+	os.MkdirAll(home, 0o755)
+	t.Setenv("HOME", home)
+	expectFinding(t, cfg, "SANDBOX_HOME", SeverityHigh)
+	cfg.Dir = home
+	expectFinding(t, cfg, "SANDBOX_HOME", SeverityHigh)
+
+	// 家目录下的子目录可以作为沙箱
+	cfg.Dir = filepath.Join(home, "share")
+	os.Mkdir(cfg.Dir, 0o755)
+	if _, codes := auditCodes(t, cfg); codes["SANDBOX_HOME"].Code != "" {
+		t.Errorf("a directory under the home directory was reported as containing it")
+	}
+}
+
+func TestAuditSandboxWorldWritable(t *testing.T) {
+	cfg := auditConfig(t)
+	if err := os.Chmod(cfg.Dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	f := expectFinding(t, cfg, "SANDBOX_WORLD_WRITABLE", SeverityMedium)
+	if f.Hint != "chmod o-w "+cfg.Dir {
+		t.Errorf("hint = %q", f.Hint)
+	}
+}
+
+func TestAuditSandboxInvalid(t *testing.T) {
+	cfg := auditConfig(t)
+	file := filepath.Join(cfg.Dir, "file")
+	os.WriteFile(file, nil, 0o644)
+	for _, dir := range []string{file, filepath.Join(cfg.Dir, "missing")} {
+		cfg.Dir = dir
+		expectFinding(t, cfg, "SANDBOX_INVALID", SeverityHigh)
+	}
+}
+
+func TestAuditUploadUnlimited(t *testing.T) {
+	expectFinding(t, auditConfig(t), "UPLOAD_UNLIMITED", SeverityMedium)
+}
+
+func TestAuditSecretsExposed(t *testing.T) {
+	cfg := auditConfig(t)
+	for _, name := range []string{".env", "deploy/server.key", "deploy/readme.txt", "backup/.ssh/id_rsa", "ok.txt"} {
+		p := filepath.Join(cfg.Dir, name)
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		os.WriteFile(p, []byte("x"), 0o644)
+	}
+	f := expectFinding(t, cfg, "SECRETS_EXPOSED", SeverityHigh)
+	// .ssh 目录整体报告一次，不再列出其中的文件
+	want := []string{".env", "backup/.ssh/", "deploy/server.key"}
+	if strings.Join(f.Paths, ",") != strings.Join(want, ",") {
+		t.Errorf("paths = %q, want %q", f.Paths, want)
+	}
+}
+
+func TestAuditScanFailOpen(t *testing.T) {
+	cfg := auditConfig(t)
+	cfg.ScanCommand = "true"
+	if _, codes := auditCodes(t, cfg); codes["SCAN_FAIL_OPEN"].Code != "" {
+		t.Errorf("SCAN_FAIL_OPEN without -scan-fail-open")
+	}
+	cfg.ScanFailOpen = true
+	expectFinding(t, cfg, "SCAN_FAIL_OPEN", SeverityMedium)
+}
+
+func TestAuditWalkUnbounded(t *testing.T) {
+	cfg := auditConfig(t)
+	cfg.WalkTimeout = 0
+	expectFinding(t, cfg, "WALK_UNBOUNDED", SeverityLow)
+}
@@ -0,0 +1,352 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：审计日志 ---------- */
+
+// -audit-log 把每个完成的操作追加为一行 JSON（AuditLogEntry），与 logEvent 的访问日志分开，供合规留存。
+// 记录的是本地处理器处理的每个请求（/_caps 等能力查询和测速除外），以及网关因token权限在转发之前拒绝的请求；
+// 身份是token SHA-256 的前8位十六进制，从不记录token本身。
+// 条目由一个后台协程按到达顺序写入，每批（最多 auditBatch 条）之后 fsync 一次。
+// -audit-chain 让每条带上前一行的 SHA-256（Prev），Seq 连续编号：改动或删除任何一行都会使后面的链断开，
+// "wsbox server verify-audit" 检查链和编号。重新打开已有的文件时从最后一行接着编号和计算
+
+// auditBatch 是一次 fsync 最多覆盖的条目数
+const auditBatch = 64
+
+// AuditLogEntry 是审计日志的一行
+type AuditLogEntry struct {
+	Seq        uint64  `json:"seq"`
+	TS         string  `json:"ts"` // UTC，RFC 3339，纳秒精度
+	IP         string  `json:"ip"`
+	Token      string  `json:"token"` // token SHA-256 的前8位十六进制
+	Op         string  `json:"op"`    // upload、download、delete、list、mkdir、move……
+	Path       string  `json:"path"`
+	Dst        string  `json:"dst,omitempty"` // move 的目标
+	Bytes      int64   `json:"bytes"`         // 上传或下载的文件字节数
+	Status     int     `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	Prev       string  `json:"prev,omitempty"` // -audit-chain：前一行的 SHA-256，第一行为空
+}
+
+// auditLog 是打开的审计日志文件，nil 表示没有配置 -audit-log
+type auditLog struct {
+	f     *os.File
+	chain bool
+	seq   uint64 // 最后写入的编号
+	prev  string // 最后写入的一行的 SHA-256
+
+	mu     sync.Mutex // 保护 closed 和向 ch 的发送
+	closed bool
+	ch     chan AuditLogEntry
+	done   chan struct{}
+}
+
+// openAuditLog 以追加方式打开 path，读出最后一行以接续编号和哈希链
+func openAuditLog(path string, chain bool) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	l := &auditLog{f: f, chain: chain, ch: make(chan AuditLogEntry, 1024), done: make(chan struct{})}
+	tail, torn, err := tailLines(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	if torn {
+		// 上次写到一半的行保持原样（verify-audit 会指出它），另起一行接着写
+		logf("audit log %s ends with an incomplete line, continuing after it", path)
+		if _, err := f.Write([]byte("\n")); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("audit log: %w", err)
+		}
+	}
+	// 编号接着最后一条完整的条目，哈希链接着最后一行（即使它不完整）
+	for i := len(tail) - 1; i >= 0; i-- {
+		var e AuditLogEntry
+		if json.Unmarshal(tail[i], &e) == nil {
+			l.seq = e.Seq
+			break
+		}
+	}
+	if len(tail) > 0 {
+		l.prev = lineHash(tail[len(tail)-1])
+	}
+	go l.run()
+	return l, nil
+}
+
+// tailLines 返回文件末尾的几行（不含换行），以及文件是否以不完整的行结尾
+func tailLines(f *os.File) ([][]byte, bool, error) {
+	fi, err := f.Stat()
+	if err != nil || fi.Size() == 0 {
+		return nil, false, err
+	}
+	// 一行远小于 64KiB，从末尾往前读这么多足够
+	off := max(fi.Size()-64<<10, 0)
+	buf := make([]byte, fi.Size()-off)
+	if _, err := f.ReadAt(buf, off); err != nil {
+		return nil, false, err
+	}
+	torn := buf[len(buf)-1] != '\n'
+	lines := bytes.Split(bytes.TrimSuffix(buf, []byte("\n")), []byte("\n"))
+	if off > 0 {
+		// 第一段可能是半行
+		lines = lines[1:]
+	}
+	return lines, torn, nil
+}
+
+// lineHash 是哈希链中一行的 SHA-256，不含换行
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// record 把 e 交给后台协程写入。日志已关闭（服务端正在退出）时丢弃
+func (l *auditLog) record(e AuditLogEntry) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.ch <- e
+	}
+}
+
+// run 依次写入条目，编号和哈希链在这里确定，保证与文件中的顺序一致
+func (l *auditLog) run() {
+	defer close(l.done)
+	var buf bytes.Buffer
+	for e := range l.ch {
+		buf.Reset()
+		l.encode(&buf, e)
+	batch:
+		for range auditBatch - 1 {
+			select {
+			case e, ok := <-l.ch:
+				if !ok {
+					break batch
+				}
+				l.encode(&buf, e)
+			default:
+				break batch
+			}
+		}
+		if _, err := l.f.Write(buf.Bytes()); err != nil {
+			logf("audit log: %v", err)
+			continue
+		}
+		if err := l.f.Sync(); err != nil {
+			logf("audit log: %v", err)
+		}
+	}
+}
+
+func (l *auditLog) encode(buf *bytes.Buffer, e AuditLogEntry) {
+	l.seq++
+	e.Seq = l.seq
+	if l.chain {
+		e.Prev = l.prev
+	}
+	line, _ := json.Marshal(e)
+	l.prev = lineHash(line)
+	buf.Write(line)
+	buf.WriteByte('\n')
+}
+
+// close 写完已收到的条目后关闭文件
+func (l *auditLog) close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	l.closed = true
+	close(l.ch)
+	l.mu.Unlock()
+	<-l.done
+	return l.f.Close()
+}
+
+// auditOp 把本地处理器上的请求归为审计日志中的操作和路径；不记录的请求（能力查询、测速）返回空的 op
+func auditOp(method string, u *url.URL) (op, p, dst string) {
+	q := u.Query()
+	if name, ok := strings.CutPrefix(u.Path, "/_"); ok {
+		if strings.HasPrefix(name, "caps") || strings.HasPrefix(name, "bench") {
+			return "", "", ""
+		}
+		for _, param := range pathParams {
+			if v := q.Get(param); v != "" && param != "dst" {
+				p = v
+				break
+			}
+		}
+		if p == "" {
+			p = "/"
+		}
+		return name, p, q.Get("dst")
+	}
+	switch {
+	case method == "POST" && q.Has(protocol.ExtractParam):
+		op = "extract"
+	case method == "POST" && q.Get(protocol.AppendParam) == "1":
+		op = "append"
+	case method == "POST":
+		op = "upload"
+	case method == "GET":
+		op = "download"
+	default:
+		op = strings.ToLower(method)
+	}
+	return op, u.Path, q.Get("dst")
+}
+
+// auditEntry 生成一个请求的审计条目，op 为空表示不记录
+func auditEntry(method string, u *url.URL, clientIP, identity string, status int, n int64, d time.Duration) (AuditLogEntry, bool) {
+	op, p, dst := auditOp(method, u)
+	if op == "" {
+		return AuditLogEntry{}, false
+	}
+	if host, _, err := net.SplitHostPort(clientIP); err == nil {
+		clientIP = host
+	}
+	return AuditLogEntry{
+		TS: time.Now().UTC().Format(time.RFC3339Nano), IP: clientIP, Token: identity, Op: op, Path: p, Dst: dst,
+		Bytes: n, Status: status, DurationMS: float64(d.Microseconds()) / 1000,
+	}, true
+}
+
+// auditing 包装本地处理器，每个请求完成后写一条审计日志；没有 -audit-log 时原样返回 next
+func (s *Server) auditing(next http.HandlerFunc) http.HandlerFunc {
+	if s.auditPath == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		upload := transferDirection(r) == "upload"
+		var body *countingReader
+		if upload {
+			body = &countingReader{ReadCloser: r.Body}
+			r.Body = body
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		next(sw, r)
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		var n int64
+		switch {
+		case upload:
+			n = body.n
+		case transferDirection(r) == "download" && status < 300:
+			n = sw.written
+		}
+		if e, ok := auditEntry(r.Method, r.URL, r.RemoteAddr, r.Header.Get("X-Wsbox-Token"), status, n, time.Since(start)); ok {
+			s.audit.record(e)
+		}
+	}
+}
+
+// auditRejected 记录网关在转发之前以 status 拒绝的请求，target 是 "path?query"
+func (s *Server) auditRejected(method, target, clientIP, token string, status int) {
+	if s.audit == nil {
+		return
+	}
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return
+	}
+	if e, ok := auditEntry(method, u, clientIP, tokenFingerprint(token), status, 0, 0); ok {
+		s.audit.record(e)
+	}
+}
+
+/* ---------- 审计日志的校验 ---------- */
+
+// AuditLogReport 是 "wsbox server verify-audit" 的结果
+type AuditLogReport struct {
+	SchemaVersion int      `json:"schema_version"`
+	OK            bool     `json:"ok"`
+	Entries       int      `json:"entries"`
+	Chained       bool     `json:"chained"` // 是否带有哈希链
+	LastSeq       uint64   `json:"last_seq"`
+	Head          string   `json:"head"`             // 最后一行的 SHA-256，记在别处可以发现末尾被截掉
+	Errors        []string `json:"errors,omitempty"` // 最多 maxAuditErrors 条
+}
+
+const maxAuditErrors = 20
+
+// VerifyAuditLog 逐行检查审计日志：每行都是完整的 JSON，Seq 连续递增；带哈希链的行的 Prev 等于前一行的 SHA-256。
+// 链从第一个带 Prev 的行开始检查，之前没有链的行（启用 -audit-chain 之前写入的）只检查编号
+func VerifyAuditLog(r io.Reader) (AuditLogReport, error) {
+	rep := AuditLogReport{SchemaVersion: protocol.SchemaVersion}
+	fail := func(format string, args ...any) {
+		if len(rep.Errors) < maxAuditErrors {
+			rep.Errors = append(rep.Errors, fmt.Sprintf(format, args...))
+		}
+	}
+	br := bufio.NewReader(r)
+	var prev string
+	var seq uint64
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) == 0 && errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return rep, err
+		}
+		complete := bytes.HasSuffix(line, []byte("\n"))
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		var e AuditLogEntry
+		switch {
+		case !complete:
+			fail("line %d: incomplete line at the end of the file", n)
+		case json.Unmarshal(line, &e) != nil:
+			fail("line %d: not a valid entry", n)
+		default:
+			rep.Entries++
+			switch {
+			case seq == 0 && e.Seq != 1:
+				fail("line %d: the first entry has seq %d instead of 1, the beginning of the file was removed", n, e.Seq)
+			case seq != 0 && e.Seq != seq+1:
+				fail("line %d: seq %d follows %d, entries are missing or out of order", n, e.Seq, seq)
+			}
+			seq = e.Seq
+			// 链一旦开始，之后的每一行都必须带着前一行的哈希；第一行没有前一行，Prev 为空
+			if e.Prev != "" || rep.Chained {
+				if n == 1 {
+					fail("line 1: the first entry continues a hash chain, the beginning of the file was removed")
+				} else if e.Prev != prev {
+					fail("line %d: prev hash does not match line %d, an earlier line was altered or removed", n, n-1)
+				}
+				rep.Chained = true
+			}
+		}
+		prev = lineHash(line)
+	}
+	rep.LastSeq, rep.Head = seq, prev
+	rep.OK = len(rep.Errors) == 0
+	return rep, nil
+}
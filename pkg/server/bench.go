@@ -0,0 +1,31 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：测速 ---------- */
+
+// handleBenchSink 实现 POST /_bench/sink：读取并丢弃正文，返回收到的字节数。
+// 客户端用它测量上行吞吐（add -estimate），不写入沙箱，只读模式下同样可用
+func (s *Server) handleBenchSink(w http.ResponseWriter, r *http.Request, clientIP string) {
+	n, err := io.Copy(io.Discard, http.MaxBytesReader(w, r.Body, protocol.BenchSinkMax))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			http.Error(w, fmt.Sprintf("bench payloads are limited to %d bytes", protocol.BenchSinkMax), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logEvent(logEntry{IP: clientIP, Action: "BENCH", Status: http.StatusOK, Bytes: n, Duration: elapsedSince(r), Detail: "sink"})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(protocol.BenchResult{SchemaVersion: protocol.SchemaVersion, Bytes: n})
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/* ---------- 仅大小写不同的文件名 ---------- */
+
+// Config.CaseCollision 的取值。Linux 上 Readme.md 和 readme.md 是两个文件，
+// 同步回 macOS/Windows 等大小写不敏感的文件系统时会互相覆盖
+const (
+	CaseWarn   = "warn"
+	CaseReject = "reject"
+	CaseAllow  = "allow"
+)
+
+func validCasePolicy(v string) error {
+	switch v {
+	case CaseWarn, CaseReject, CaseAllow:
+		return nil
+	}
+	return fmt.Errorf("invalid -case-collision %q, expected one of %s|%s|%s", v, CaseWarn, CaseReject, CaseAllow)
+}
+
+// caseCollision 返回 dir 中与 name 仅大小写不同的已有条目，没有时返回空串
+func caseCollision(dir, name string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if e.Name() != name && strings.EqualFold(e.Name(), name) && !isReservedName(e.Name()) {
+			return e.Name()
+		}
+	}
+	return ""
+}
+
+// checkCaseCollision 按 Config.CaseCollision 策略检查上传目标，返回非空 *APIError 时拒绝上传
+func (s *Server) checkCaseCollision(real, path, clientIP string) *APIError {
+	if s.caseCollision == CaseAllow {
+		return nil
+	}
+	existing := caseCollision(filepath.Dir(real), filepath.Base(real))
+	if existing == "" {
+		return nil
+	}
+	if s.caseCollision == CaseReject {
+		logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusConflict, Err: "case collision with " + existing})
+		return &APIError{Code: "CASE_COLLISION", Message: fmt.Sprintf("%q differs only by case from existing entry %q", filepath.Base(real), existing)}
+	}
+	logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Detail: "warning: case collision with " + existing})
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package server
+
+import (
+	"io/fs"
+	"os"
+)
+
+// chmodPreserved 把上传请求给出的权限设到文件上
+func chmodPreserved(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
@@ -0,0 +1,8 @@
+package server
+
+import "io/fs"
+
+// chmodPreserved 在 Windows 上什么也不做：那里只有只读属性，设上之后服务端无法再替换这个文件
+func chmodPreserved(name string, mode fs.FileMode) error {
+	return nil
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：容器内运行 ---------- */
+
+// 服务端只写两个位置：沙箱目录（上传、锁标记、扫描前的暂存文件）和 Config.StateDir。
+// StateDir 下的内容都由它派生，根文件系统可以整体只读：
+//
+//	<state-dir>/journal.wal, snapshot.json, LOCK   状态存储
+//	<state-dir>/token                               未指定 -token 时自动生成并保留的token
+const tokenFile = "token"
+
+// childMu 在运行外部命令期间持有读锁，PID 1 的回收协程只在拿到写锁时回收，
+// 避免抢走 exec.Cmd.Wait 的退出状态
+var childMu sync.RWMutex
+
+// loadToken 读取 TokenFile；都未指定时生成token，设置了 StateDir 时保存到其中，重启后沿用同一个token
+func (s *Server) loadToken() error {
+	if s.tokenPath != "" {
+		token, err := readTokenFile(s.tokenPath)
+		if err != nil {
+			return err
+		}
+		s.token = token
+		return nil
+	}
+	if s.token != "" {
+		return nil
+	}
+	var path string
+	if s.stateDir != "" {
+		path = filepath.Join(s.stateDir, tokenFile)
+		if b, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(b))) > 0 {
+			s.token = strings.TrimSpace(string(b))
+			return nil
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	s.token = hex.EncodeToString(b)
+	if path == "" {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(s.token+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readTokenFile 读取 -token-file 的第一行。文件对其他用户可读时记录警告
+func readTokenFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("token file: %w", err)
+	}
+	token, _, _ := strings.Cut(string(b), "\n")
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", fmt.Errorf("token file %s: the first line must be a non-empty token without whitespace", path)
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode().Perm()&0o077 != 0 {
+		logf("warning: token file %s is accessible by other users (mode %v)", path, fi.Mode().Perm())
+	}
+	return token, nil
+}
+
+// checkWritable 在启动时确认需要写入的位置确实可写，只读挂载等问题在启动时暴露，而不是在第一次上传时
+func (s *Server) checkWritable() error {
+	dirs := []string{s.dir}
+	if s.stateDir != "" {
+		dirs = append(dirs, s.stateDir)
+	}
+	for _, d := range dirs {
+		f, err := os.CreateTemp(d, ".wsbox-probe"+tempMarker+"*")
+		if err != nil {
+			return fmt.Errorf("%s is not writable: %w", d, err)
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+	return nil
+}
+
+// drainer 跟踪正在转发的请求，关闭时拒绝新请求并等待已有请求完成
+type drainer struct {
+	mu      sync.Mutex
+	closing bool
+	active  int
+	done    chan struct{}
+}
+
+// enter 登记一个新请求，正在关闭时返回 false
+func (d *drainer) enter() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closing {
+		return false
+	}
+	d.active++
+	return true
+}
+
+func (d *drainer) leave() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active--
+	if d.closing && d.active == 0 {
+		close(d.done)
+	}
+}
+
+// close 开始关闭，返回的 channel 在所有请求完成后关闭
+func (d *drainer) close() (<-chan struct{}, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closing = true
+	d.done = make(chan struct{})
+	if d.active == 0 {
+		close(d.done)
+	}
+	return d.done, d.active
+}
+
+// draining 判断是否已开始关闭
+func (d *drainer) draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closing
+}
+
+// closeSessions 以 protocol.CloseGoingAway 关闭网关连接，idleOnly 时只关闭没有请求在转发的连接。
+// 关闭开始后空闲的连接不会再有请求被接受，可以立即关闭；忙碌的连接在请求结束后由网关循环关闭
+func (s *Server) closeSessions(idleOnly bool) {
+	s.authMu.Lock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for ss := range s.sessions {
+		sessions = append(sessions, ss)
+	}
+	s.authMu.Unlock()
+	for _, ss := range sessions {
+		if !idleOnly || !ss.busy() {
+			ss.closeWith(protocol.CloseGoingAway, protocol.ShutdownReason)
+		}
+	}
+}
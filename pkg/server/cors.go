@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/* ---------- 服务端：Origin 检查与 CORS ---------- */
+
+// 不设置 Config.AllowedOrigins 时网关接受任意 Origin，HTTP 接口也不发送 CORS 头（浏览器只允许同源页面读取响应）。
+// 设置后，带 Origin 的请求只有同源或在列表中才被接受：/ws 的升级、/files/、/api/list 和浏览器界面的token检查都一样，
+// 其余以 403 拒绝并记录日志。列表中的跨源请求在 HTTP 接口上得到 CORS 响应头，预检请求（OPTIONS）直接以 204 回复。
+// "*" 表示接受任意 Origin 并对所有来源发送 CORS 头。token不放在 cookie 中，因此不发送 Access-Control-Allow-Credentials
+
+// originPolicy 是解析后的 Config.AllowedOrigins，nil 表示不检查
+type originPolicy struct {
+	any     bool
+	allowed map[string]bool // 规范化的 "scheme://host[:port]"
+}
+
+// newOriginPolicy 检查并规范化来源列表，列表为空时返回 nil
+func newOriginPolicy(origins []string) (*originPolicy, error) {
+	if len(origins) == 0 {
+		return nil, nil
+	}
+	p := &originPolicy{allowed: map[string]bool{}}
+	for _, o := range origins {
+		o = strings.TrimSpace(o)
+		if o == "*" {
+			p.any = true
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			strings.TrimRight(u.Path, "/") != "" || u.RawQuery != "" || u.User != nil {
+			return nil, fmt.Errorf("-allowed-origins: %q is not an origin such as https://app.example.com", o)
+		}
+		p.allowed[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+	}
+	if !p.any && len(p.allowed) == 0 {
+		return nil, errors.New("-allowed-origins: empty list")
+	}
+	return p, nil
+}
+
+// sameOrigin 判断 Origin 是否就是网关本身（如 -webui 的页面），与 gorilla 的默认检查相同
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// crossOrigin 判断 r 是否是应当接受的跨源请求，调用方需要为它发送 CORS 头
+func (p *originPolicy) crossOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return p != nil && origin != "" && !sameOrigin(r, origin)
+}
+
+// allows 判断 r 的 Origin 是否被接受：没有 Origin（非浏览器客户端）、不检查、同源或在列表中
+func (p *originPolicy) allows(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if p == nil || origin == "" || p.any || sameOrigin(r, origin) {
+		return true
+	}
+	return p.allowed[strings.ToLower(origin)]
+}
+
+// checkOrigin 在 Origin 不被接受时以 403 回复并记录日志，返回 false
+func (s *Server) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if s.origins.allows(r) {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	logEvent(logEntry{IP: remoteIP(r), Action: "ORIGIN", Path: r.URL.Path, Status: http.StatusForbidden, Err: "origin not allowed: " + origin})
+	writeError(w, http.StatusForbidden, &APIError{Code: "ORIGIN_NOT_ALLOWED", Message: "origin " + origin + " is not allowed by the server's -allowed-origins"})
+	return false
+}
+
+// corsExposed 是跨源页面可以读取的响应头：下载的长度、范围和文件名，以及文件的属性和摘要
+var corsExposed = strings.Join([]string{"Content-Length", "Content-Range", "Content-Disposition", "Accept-Ranges",
+	"ETag", "Last-Modified", mtimeHeader, modeHeader, digestHeader}, ", ")
+
+// withCORS 给 HTTP 接口加上 Origin 检查和 CORS 响应头
+func (s *Server) withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.checkOrigin(w, r) {
+			return
+		}
+		if !s.origins.crossOrigin(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+		h.Add("Vary", "Origin")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, DELETE")
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Range, If-Range, If-Match, If-None-Match, If-Modified-Since, If-Unmodified-Since")
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", corsExposed)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：删除 ---------- */
+
+// handleDelete 实现 DELETE /path，目录只有带 ?recursive=1 时才删除，沙箱根目录始终拒绝
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request, clientIP string) {
+	path, real, err := s.resolveLinkPath(r, "")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "DELETE", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	absRoot, _ := filepath.Abs(s.dir)
+	if scope := r.Header.Get(scopeHeader); scope != "" {
+		// 限定了子目录的token看到的根目录就是该子目录，同样不能删除
+		absRoot, _ = SecurePath(scope, s.dir)
+	}
+	if real == absRoot {
+		logEvent(logEntry{IP: clientIP, Action: "DELETE", Path: path, Status: http.StatusForbidden, Duration: elapsedSince(r), Err: "refused: sandbox root"})
+		writeError(w, http.StatusForbidden, &APIError{Code: "ROOT_DELETE", Message: "the sandbox root cannot be deleted"})
+		return
+	}
+	// Lstat：符号链接只删除链接本身
+	fi, err := os.Lstat(real)
+	if err != nil || isReservedName(fi.Name()) {
+		logEvent(logEntry{IP: clientIP, Action: "DELETE", Path: path, Status: http.StatusNotFound, Duration: elapsedSince(r), Err: "not found"})
+		writeError(w, http.StatusNotFound, &APIError{Code: "NOT_FOUND", Message: "not found"})
+		return
+	}
+	// 其他token持有的有效锁不允许删除（目录中有这样的锁时整个目录都不删），与上传和移动一样回复 423；
+	// 持有者自己删除时锁随文件一起去掉
+	token := r.Header.Get("X-Wsbox-Token")
+	if fi.IsDir() {
+		if r.URL.Query().Get("recursive") != "1" {
+			logEvent(logEntry{IP: clientIP, Action: "DELETE", Path: path, Status: http.StatusConflict, Duration: elapsedSince(r), Err: "refused: directory without recursive"})
+			writeError(w, http.StatusConflict, &APIError{Code: "IS_DIRECTORY", Message: path + " is a directory, use recursive=1 to delete it"})
+			return
+		}
+		release, _, ok := s.heavy(w, r, clientIP, "DELETE", weightDelete)
+		if !ok {
+			return
+		}
+		err = removeTree(real, token, track(r))
+		release()
+	} else {
+		// 检查和删除之间不能插入别人的加锁
+		s.lockMu.Lock()
+		if l := lockedByOther(real, token); l != nil {
+			err = &lockedError{path, l}
+		} else if err = os.Remove(real); err == nil {
+			os.Remove(lockMetaPath(real))
+		}
+		s.lockMu.Unlock()
+	}
+	var locked *lockedError
+	if errors.As(err, &locked) {
+		logEvent(logEntry{IP: clientIP, Action: "DELETE", Path: path, Status: http.StatusLocked, Duration: elapsedSince(r), Err: err.Error()})
+		writeError(w, http.StatusLocked, &APIError{Code: "LOCKED", Message: err.Error()})
+		return
+	}
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "DELETE", Path: path, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: err.Error()})
+		writeError(w, http.StatusInternalServerError, &APIError{Code: "DELETE_FAILED", Message: err.Error()})
+		return
+	}
+	s.noteRemoved(real, fi.IsDir())
+	s.hashes.forget(real)
+	logEvent(logEntry{IP: clientIP, Action: "DELETE", Path: path, Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("dir=%t", fi.IsDir())})
+	s.activity.record("delete", path, 0, r.Header.Get("X-Wsbox-Token"))
+	runPostHooks(r.Context(), s.hooks.deleted, TransferEvent{Path: path, Identity: r.Header.Get("X-Wsbox-Token"), ClientIP: clientIP}, "DELETE")
+	fmt.Fprintln(w, "ok")
+}
+
+// lockedError 表示要删除的文件或目录中的某个文件有其他token持有的有效锁
+type lockedError struct {
+	rel  string // 被锁的文件：删除文件时是请求的路径，删除目录时是相对于该目录的路径
+	lock *protocol.LockInfo
+}
+
+func (e *lockedError) Error() string {
+	return e.rel + ": path is locked by " + e.lock.Holder
+}
+
+// removeTree 递归删除目录并报告进度：先遍历收集条目（walking），再自底向上逐个删除（deleting）。
+// 遍历时发现其他token持有的有效锁就什么都不删，返回 *lockedError
+func removeTree(root, token string, p *progress) error {
+	p.begin("walking")
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name, ok := strings.CutSuffix(d.Name(), lockSuffix); ok && !d.IsDir() && strings.HasPrefix(name, ".") {
+			locked := filepath.Join(filepath.Dir(path), name[1:])
+			if l := lockedByOther(locked, token); l != nil {
+				rel, _ := filepath.Rel(root, locked)
+				return &lockedError{filepath.ToSlash(rel), l}
+			}
+		}
+		paths = append(paths, path)
+		p.add(1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.begin("deleting")
+	// WalkDir 按先序遍历，倒序删除保证目录在其内容之后删除
+	for i := len(paths) - 1; i >= 0; i-- {
+		if err := os.Remove(paths[i]); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		p.add(1)
+	}
+	return nil
+}
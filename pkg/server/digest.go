@@ -0,0 +1,56 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：完整性校验 ---------- */
+
+// digestHeader 是本地处理器告诉网关下载文件摘要的响应头，网关把它附加到状态头的第三个字段
+const digestHeader = "X-Wsbox-Sha256"
+
+// expectedDigest 返回上传请求声明的 SHA-256，没有声明时为空；摘要在结束标记中给出时为 protocol.DigestTrailer
+func expectedDigest(r *http.Request) (string, error) {
+	want := strings.ToLower(r.URL.Query().Get(protocol.DigestParam))
+	if want != "" && want != protocol.DigestTrailer && !protocol.ValidDigest(want) {
+		return "", fmt.Errorf("%s=%q is not a hex SHA-256", protocol.DigestParam, r.URL.Query().Get(protocol.DigestParam))
+	}
+	return want, nil
+}
+
+// trailerDigest 返回网关从分块上传的结束标记中取出、放在请求 trailer 里的摘要，只在正文读完之后有效；
+// 没有或格式不对时为空
+func trailerDigest(r *http.Request) string {
+	d := strings.ToLower(r.Trailer.Get(digestHeader))
+	if !protocol.ValidDigest(d) {
+		return ""
+	}
+	return d
+}
+
+// wantsDigest 报告下载请求是否要求附带文件摘要
+func wantsDigest(r *http.Request) bool {
+	return r.URL.Query().Get(protocol.WantDigestParam) == "sha256"
+}
+
+// digestMismatch 是上传内容与声明的摘要不一致时的错误
+func digestMismatch(want, got string) *APIError {
+	return &APIError{Code: "DIGEST_MISMATCH", Message: fmt.Sprintf("content SHA-256 is %s, expected %s", got, want)}
+}
+
+// statusLine 返回响应的状态头，本地处理器提供了摘要时附加在长度之后，请求经过别名时再附加规范路径
+func statusLine(resp *http.Response, size int64) string {
+	line := fmt.Sprintf("%d %d", resp.StatusCode, size)
+	if d := resp.Header.Get(digestHeader); d != "" {
+		line += " " + d
+	}
+	if c := resp.Header.Get(canonicalHeader); c != "" {
+		line += " " + protocol.CanonicalField + url.PathEscape(c)
+	}
+	return line
+}
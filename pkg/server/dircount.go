@@ -0,0 +1,333 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wsbox/internal/journal"
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：目录条目计数 ---------- */
+
+// countReconcileInterval 是后台巡检的间隔，每次巡检受 -walk-timeout 的时间预算限制，
+// 没走完的部分留到下一次继续
+const countReconcileInterval = time.Minute
+
+// dirCounts 记录每个目录的直接条目数（不含保留名），用于发现条目过多的目录。
+// 上传和删除时增量更新已经统计过的目录；新出现的目录和绕过服务端的改动由后台巡检发现，
+// 所以两次巡检之间计数可能有偏差，但每完成一轮巡检都会收敛到实际值。
+// 计数和巡检的轮数保存在状态存储中（countNamespace、countPassNamespace），设置了 -state-dir 时重启后立即可用，
+// 不必等第一轮巡检；巡检进度和告警记录只在内存中，重启后从头开始
+type dirCounts struct {
+	st *journal.Store // openState 之后设置
+
+	mu     sync.Mutex
+	warned map[string]bool // 已经告警过的目录，每个目录只告警一次
+	warnAt int             // 告警阈值，0表示关闭
+
+	queue []string        // 本轮巡检待统计的目录
+	seen  map[string]bool // 本轮巡检已统计的目录，一轮结束时清除其余的计数
+}
+
+// 状态存储中目录计数的命名空间：countNamespace 的键是沙箱内路径（"/"、"/a/b"），值是条目数；
+// countPassNamespace 只有一个键 countPassKey，记录完成的巡检轮数和最近一轮结束的时间
+const (
+	countNamespace     = "dircounts"
+	countPassNamespace = "dircounts-pass"
+	countPassKey       = "last"
+)
+
+// countPass 是完成的巡检轮数和最近一次完整巡检结束的时间
+type countPass struct {
+	Passes     int       `json:"passes"`
+	Reconciled time.Time `json:"reconciled_at"`
+}
+
+func newDirCounts(warnAt int) *dirCounts {
+	return &dirCounts{warned: map[string]bool{}, warnAt: warnAt}
+}
+
+// update 在状态存储中提交一次计数修改，失败时只记日志：计数有偏差会由下一轮巡检纠正
+func (dc *dirCounts) update(fn func(tx *journal.Tx) error) {
+	if err := dc.st.Update(fn); err != nil {
+		logf("directory counts: %v", err)
+	}
+}
+
+// add 调整一个已统计目录的计数，尚未统计的目录留给巡检
+func (dc *dirCounts) add(dir string, delta int) {
+	n := -1
+	dc.update(func(tx *journal.Tx) error {
+		var old int
+		if ok, err := tx.Get(countNamespace, dir, &old); !ok || err != nil {
+			return err
+		}
+		n = max(old+delta, 0)
+		return tx.Put(countNamespace, dir, n)
+	})
+	if n >= 0 {
+		dc.check(dir, n)
+	}
+}
+
+// setNew 记录一个刚创建、含 n 个条目的目录，它的计数是确定的，不必等巡检
+func (dc *dirCounts) setNew(dir string, n int) {
+	dc.update(func(tx *journal.Tx) error {
+		return tx.Put(countNamespace, dir, n)
+	})
+	dc.mu.Lock()
+	if dc.seen != nil {
+		dc.seen[dir] = true
+	}
+	dc.mu.Unlock()
+}
+
+// forget 删除目录及其所有子目录的计数
+func (dc *dirCounts) forget(dir string) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	keys := dc.st.Keys(countNamespace)
+	dc.update(func(tx *journal.Tx) error {
+		for _, d := range keys {
+			if d == dir || strings.HasPrefix(d, prefix) {
+				tx.Delete(countNamespace, d)
+			}
+		}
+		return nil
+	})
+}
+
+// check 在目录第一次超过阈值时写一条警告日志
+func (dc *dirCounts) check(dir string, n int) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.warnAt <= 0 || n <= dc.warnAt || dc.warned[dir] {
+		return
+	}
+	dc.warned[dir] = true
+	logf("warning: directory %s has %d entries, over the -warn-dir-entries threshold of %d", dir, n, dc.warnAt)
+}
+
+// top 返回条目最多的 n 个目录，数量相同时按路径排序
+func (dc *dirCounts) top(n int) protocol.DirCountsResult {
+	var pass countPass
+	dc.st.Get(countPassNamespace, countPassKey, &pass)
+	keys := dc.st.Keys(countNamespace)
+	res := protocol.DirCountsResult{
+		SchemaVersion: protocol.SchemaVersion,
+		Entries:       make([]protocol.DirCount, 0, len(keys)),
+		Dirs:          len(keys),
+		Passes:        pass.Passes,
+		ReconciledAt:  pass.Reconciled,
+	}
+	for _, d := range keys {
+		var c int
+		if ok, _ := dc.st.Get(countNamespace, d, &c); ok {
+			res.Entries = append(res.Entries, protocol.DirCount{Dir: d, Count: c})
+		}
+	}
+	sort.Slice(res.Entries, func(i, j int) bool {
+		a, b := res.Entries[i], res.Entries[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Dir < b.Dir
+	})
+	if len(res.Entries) > n {
+		res.Entries = res.Entries[:n]
+	}
+	return res
+}
+
+// countKey 把沙箱内的真实路径转换为计数使用的沙箱内路径
+func (s *Server) countKey(real string) string {
+	absRoot, _ := filepath.Abs(s.dir)
+	return sandboxKey(absRoot, real)
+}
+
+// sandboxKey 把 absRoot 下的真实路径转换为状态存储中作为键的沙箱内路径（"/"、"/a/b"）
+func sandboxKey(absRoot, real string) string {
+	rel, err := filepath.Rel(absRoot, real)
+	if err != nil || rel == "." {
+		return "/"
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+// missingDirs 返回 dir 及其祖先中尚不存在的目录，从外到内排列
+func missingDirs(dir string) []string {
+	var dirs []string
+	for {
+		if _, err := os.Lstat(dir); !os.IsNotExist(err) {
+			break
+		}
+		dirs = append([]string{dir}, dirs...)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return dirs
+}
+
+// createDirs 在 dirMu 下找出 dir 及其祖先中缺少的目录，通过 SecureCreateDir 创建并记入计数，返回这次新建的目录（从外到内）。
+// 计数在锁内登记，并发请求（如 add -r -P 的多个连接）往同一个新目录里上传时，后来者的 noteCreated 总能找到它
+func (s *Server) createDirs(dir string) ([]string, error) {
+	s.dirMu.Lock()
+	defer s.dirMu.Unlock()
+	newDirs := missingDirs(dir)
+	if err := SecureCreateDir(dir, s.dir); err != nil {
+		return nil, err
+	}
+	if len(newDirs) > 0 {
+		s.counts.add(s.countKey(filepath.Dir(newDirs[0])), 1)
+		for i, d := range newDirs {
+			// 除最内层外，每个新目录里只有下一级新目录
+			s.counts.setNew(s.countKey(d), min(len(newDirs)-1-i, 1))
+		}
+	}
+	return newDirs, nil
+}
+
+// noteCreated 记录 real 作为新条目出现在其父目录中，为它新建的上级目录已由 createDirs 记入
+func (s *Server) noteCreated(real string) {
+	s.counts.add(s.countKey(filepath.Dir(real)), 1)
+}
+
+// noteRemoved 记录 real 从其父目录中删除；删除的是目录时同时清除其下的计数
+func (s *Server) noteRemoved(real string, isDir bool) {
+	if isDir {
+		s.counts.forget(s.countKey(real))
+	}
+	s.counts.add(s.countKey(filepath.Dir(real)), -1)
+}
+
+// reconcileCounts 在后台定期巡检沙箱，直到 ctx 结束
+func (s *Server) reconcileCounts(ctx context.Context) {
+	t := time.NewTicker(countReconcileInterval)
+	defer t.Stop()
+	for {
+		s.reconcileStep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// reconcileStep 在一次遍历预算内按广度优先逐个重新统计目录。预算在某个目录中途耗尽时，
+// 该目录留到下一次；但如果它是本次的第一个目录（单个目录就超出预算），按已读到的数量记下并继续，
+// 保证巡检总能前进。队列走空时一轮结束，清除本轮没有见到的目录（已被删除）
+func (s *Server) reconcileStep(ctx context.Context) {
+	// 巡检不急，重操作配额被请求占满时跳过这一轮
+	if !s.heavyOps.tryAcquire(weightWalk) {
+		return
+	}
+	defer s.heavyOps.release(weightWalk)
+	if s.walkTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.walkTimeout)
+		defer cancel()
+	}
+	dc := s.counts
+	dc.mu.Lock()
+	if len(dc.queue) == 0 {
+		dc.queue = []string{"/"}
+		dc.seen = map[string]bool{}
+	}
+	dc.mu.Unlock()
+
+	absRoot, _ := filepath.Abs(s.dir)
+	for first := true; ; first = false {
+		dc.mu.Lock()
+		if len(dc.queue) == 0 {
+			dc.mu.Unlock()
+			return
+		}
+		dir := dc.queue[0]
+		dc.mu.Unlock()
+
+		n := 0
+		var subdirs []string
+		truncated, err := readDirBatches(ctx, filepath.Join(absRoot, filepath.FromSlash(dir)), func(batch []os.DirEntry) error {
+			for _, e := range batch {
+				if isReservedName(e.Name()) {
+					continue
+				}
+				n++
+				if e.IsDir() {
+					subdirs = append(subdirs, path.Join(dir, e.Name()))
+				}
+			}
+			return nil
+		})
+		if truncated && !first {
+			return
+		}
+
+		dc.mu.Lock()
+		dc.queue = dc.queue[1:]
+		if err == nil {
+			dc.seen[dir] = true
+			dc.queue = append(dc.queue, subdirs...)
+		}
+		done := len(dc.queue) == 0
+		seen := dc.seen
+		dc.mu.Unlock()
+		if err == nil {
+			dc.update(func(tx *journal.Tx) error { return tx.Put(countNamespace, dir, n) })
+			dc.check(dir, n)
+		}
+		if done {
+			// 一轮结束：清除本轮没有见到的目录（已被删除），记下轮数
+			keys := dc.st.Keys(countNamespace)
+			dc.update(func(tx *journal.Tx) error {
+				dc.mu.Lock()
+				defer dc.mu.Unlock()
+				for _, d := range keys {
+					if !seen[d] {
+						tx.Delete(countNamespace, d)
+					}
+				}
+				var pass countPass
+				if _, err := tx.Get(countPassNamespace, countPassKey, &pass); err != nil {
+					return err
+				}
+				pass.Passes++
+				pass.Reconciled = time.Now().UTC()
+				return tx.Put(countPassNamespace, countPassKey, pass)
+			})
+		}
+		if truncated || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// handleCounts 实现 GET /_counts?n=，返回条目最多的 n 个目录（默认20）
+func (s *Server) handleCounts(w http.ResponseWriter, r *http.Request, clientIP string) {
+	n := 20
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+			http.Error(w, "invalid n", http.StatusBadRequest)
+			return
+		}
+	}
+	res := s.counts.top(n)
+	logEvent(logEntry{IP: clientIP, Action: "COUNTS", Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("n=%d dirs=%d", n, res.Dirs)})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
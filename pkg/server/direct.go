@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+/* ---------- 网关：进程内调用本地处理器 ---------- */
+
+// 网关把每个请求直接交给 localHandler，在同一进程内完成。早先的版本在 127.0.0.1 上另开一个 HTTP 监听再转发过去，
+// 本机的任何进程都能不经认证访问它（还能伪造 X-Wsbox-Token 等网关设置的请求头），每个字节也要多经过一次 TCP。
+// 处理器照常写 http.ResponseWriter：响应头在第一次写入、WriteHeader、Flush 或处理器返回时交给网关，
+// 正文经管道边写边转发，网关不再读取时处理器的写入失败
+
+// handlerWriter 是进程内调用时处理器的 http.ResponseWriter，只由处理器所在的协程使用
+type handlerWriter struct {
+	header  http.Header
+	pr      *io.PipeReader
+	pw      *io.PipeWriter
+	resp    *http.Response // 响应头确定后非 nil
+	ready   chan struct{}  // resp 确定时关闭
+	written int64
+}
+
+func (w *handlerWriter) Header() http.Header { return w.header }
+
+func (w *handlerWriter) WriteHeader(code int) {
+	if w.resp != nil {
+		return
+	}
+	// 与 net/http 一样，之后对 Header() 的修改不再生效
+	h := w.header.Clone()
+	size := int64(-1)
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && n >= 0 {
+		size = n
+	}
+	w.resp = &http.Response{
+		Status:        strconv.Itoa(code) + " " + http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		ContentLength: size,
+		Body:          w.pr,
+	}
+	close(w.ready)
+}
+
+func (w *handlerWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	n, err := w.pw.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush 只需要发出响应头，管道中的写入在网关读取之后才返回，没有缓冲
+func (w *handlerWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+// finish 在处理器返回后结束正文：没有写过任何内容时回复 200 和空正文；
+// 正文比 Content-Length 短时以 io.ErrUnexpectedEOF 结束，网关不会把不完整的正文当作成功响应。
+// 处理器以 http.TrailerPrefix 设置的头部成为 resp.Trailer，网关读到正文结束之后才能看到
+func (w *handlerWriter) finish() {
+	w.WriteHeader(http.StatusOK)
+	for k, v := range w.header {
+		if name, ok := strings.CutPrefix(k, http.TrailerPrefix); ok {
+			if w.resp.Trailer == nil {
+				w.resp.Trailer = http.Header{}
+			}
+			w.resp.Trailer[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+	if w.resp.ContentLength >= 0 && w.written < w.resp.ContentLength {
+		w.pw.CloseWithError(io.ErrUnexpectedEOF)
+		return
+	}
+	w.pw.Close()
+}
+
+// roundTrip 在新的协程中用 localHandler 处理 req，响应头确定后返回，正文在 resp.Body 中。
+// clientIP 是网关连接的对端地址，处理器的日志用它。处理器在发出响应头之前 panic 时返回错误，之后 panic 时正文以错误结束
+func (s *Server) roundTrip(req *http.Request, clientIP string) (*http.Response, error) {
+	req.RemoteAddr = clientIP
+	req.RequestURI = req.URL.RequestURI()
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+	pr, pw := io.Pipe()
+	w := &handlerWriter{header: http.Header{}, pr: pr, pw: pw, ready: make(chan struct{})}
+	failed := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				err := fmt.Errorf("local handler panicked: %v", v)
+				logf("%s %s: %v\n%s", req.Method, req.URL.Path, err, debug.Stack())
+				if w.resp == nil {
+					failed <- err
+				}
+				pw.CloseWithError(err)
+				return
+			}
+			w.finish()
+		}()
+		s.metrics.instrument(s.auditing(s.localHandler))(w, req)
+	}()
+	select {
+	case <-w.ready:
+		return w.resp, nil
+	case err := <-failed:
+		return nil, err
+	}
+}
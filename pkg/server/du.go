@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：目录占用统计 ---------- */
+
+// handleDu 实现 GET /_du?dir=：递归统计目录下每个直接条目占用的字节数（文件的表观大小之和）和文件数，
+// 与 "du -s *" 相当。遍历占一个重操作配额，受 -walk-timeout 限制，超出时返回已统计的部分并标记截断；
+// 遍历期间进度帧报告已经走过的条目数，百万级文件的目录也不会让客户端因等待而超时。
+// 符号链接不跟随、不计大小，锁标记和上传临时文件不计入
+func (s *Server) handleDu(w http.ResponseWriter, r *http.Request, clientIP string) {
+	dir, real, err := s.resolveSandboxPath(r, "dir")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "DU", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fi, err := os.Stat(real)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logEvent(logEntry{IP: clientIP, Action: "DU", Path: dir, Status: http.StatusNotFound, Duration: elapsedSince(r), Err: "directory not found"})
+			http.Error(w, "directory not found", http.StatusNotFound)
+		} else {
+			logEvent(logEntry{IP: clientIP, Action: "DU", Path: dir, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "stat failed: " + err.Error()})
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if !fi.IsDir() {
+		logEvent(logEntry{IP: clientIP, Action: "DU", Path: dir, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "not a directory"})
+		http.Error(w, "not a directory", http.StatusBadRequest)
+		return
+	}
+
+	t := newOpTimings()
+	release, wait, ok := s.heavy(w, r, clientIP, "DU", weightWalk)
+	if !ok {
+		return
+	}
+	defer release()
+	t.queue = wait
+
+	ctx, cancel := s.walkContext(r)
+	defer cancel()
+
+	// 遍历协程记录直接条目并把文件交给 stat 池，主协程按第一级名字累加结果
+	var top []protocol.DuEntry
+	items := make(chan statItem, 64)
+	results := s.statAll(ctx, items, t)
+	prog := track(r)
+	prog.begin("walking")
+	walkDone := make(chan struct{})
+	go func() {
+		defer close(walkDone)
+		defer close(items)
+		walkStart := time.Now()
+		err = filepath.WalkDir(real, func(p string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return errWalkBudget
+			}
+			if err != nil {
+				if p == real {
+					return err
+				}
+				return nil
+			}
+			if p == real {
+				return nil
+			}
+			if isReservedName(d.Name()) {
+				return nil
+			}
+			prog.add(1)
+			if filepath.Dir(p) == real {
+				top = append(top, protocol.DuEntry{Name: d.Name(), Dir: d.IsDir()})
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			select {
+			case items <- statItem{path: p, d: d}:
+				return nil
+			case <-ctx.Done():
+				return errWalkBudget
+			}
+		})
+		t.walk = time.Since(walkStart)
+	}()
+
+	type usage struct{ size, files int64 }
+	sums := map[string]*usage{}
+	for res := range results {
+		if res.err != nil {
+			continue
+		}
+		rel, _ := filepath.Rel(real, res.path)
+		name, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		u := sums[name]
+		if u == nil {
+			u = &usage{}
+			sums[name] = u
+		}
+		u.size += res.info.Size()
+		u.files++
+	}
+	<-walkDone
+	truncated := false
+	if ctx.Err() != nil && err == nil {
+		// worker 因超时提前退出时，部分 stat 结果已被丢弃
+		err = errWalkBudget
+	}
+	if errors.Is(err, errWalkBudget) {
+		truncated, err = true, nil
+	}
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "DU", Path: dir, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "walk failed: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := protocol.DuResult{SchemaVersion: protocol.SchemaVersion, Dir: dir, Entries: top, Truncated: truncated}
+	if res.Entries == nil {
+		res.Entries = []protocol.DuEntry{}
+	}
+	for i := range res.Entries {
+		e := &res.Entries[i]
+		if u := sums[e.Name]; u != nil {
+			e.Size, e.Files = u.size, u.files
+		}
+		res.Total += e.Size
+		res.Files += e.Files
+	}
+	sort.Slice(res.Entries, func(i, j int) bool { return res.Entries[i].Name < res.Entries[j].Name })
+	if truncated {
+		res.Warning = s.budgetWarning()
+	}
+	logEvent(logEntry{IP: clientIP, Action: "DU", Path: dir, Status: http.StatusOK, Duration: elapsedSince(r),
+		Detail: fmt.Sprintf("entries=%d files=%d bytes=%d truncated=%t", len(res.Entries), res.Files, res.Total, truncated)})
+	serializeStart := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+	t.serialize = time.Since(serializeStart)
+	s.logSlow(clientIP, "DU", "dir="+dir, t)
+}
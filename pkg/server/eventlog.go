@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* ---------- 访问日志 ---------- */
+
+// 访问日志的格式：text 是 [ip][action][时间][说明] 的一行文本（默认），json 每行一个对象，便于送入 Loki、ELK
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// logEntry 是一条访问日志的结构化字段，两种格式都由它生成
+type logEntry struct {
+	IP       string
+	Action   string
+	Path     string        // 沙箱内的路径
+	Status   int           // 返回给客户端的状态码
+	Bytes    int64         // 上传或下载的正文字节数
+	Duration time.Duration // 请求开始以来的用时
+	Err      string        // 失败原因
+	Detail   string        // 其余的说明，如 count=12 truncated=false
+}
+
+// logRecord 是 json 格式的一行
+type logRecord struct {
+	TS         string  `json:"ts"`
+	IP         string  `json:"ip"`
+	Action     string  `json:"action"`
+	Path       string  `json:"path"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error"`
+	Detail     string  `json:"detail,omitempty"`
+}
+
+// eventSink 是访问日志的去向，与 logTime 一样由进程中的所有服务端共用
+type eventSink struct {
+	mu   sync.Mutex
+	json bool
+	file *os.File // -log-file 打开的文件，为 nil 时写标准输出
+	path string
+}
+
+var events eventSink
+
+// SetLogFormat 选择访问日志的格式：text 或 json
+func SetLogFormat(format string) error {
+	switch format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("invalid -log-format %q: want %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+	events.mu.Lock()
+	events.json = format == LogFormatJSON
+	events.mu.Unlock()
+	return nil
+}
+
+// SetLogFile 把访问日志追加到 path 而不是标准输出，path 为空时恢复标准输出
+func SetLogFile(path string) error {
+	var f *os.File
+	if path != "" {
+		var err error
+		if f, err = openLogFile(path); err != nil {
+			return err
+		}
+	}
+	events.mu.Lock()
+	old := events.file
+	events.file, events.path = f, path
+	events.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// ReopenLogFile 重新打开日志文件，配合 logrotate 在收到 SIGHUP 时调用；没有日志文件时什么也不做。
+// 打开失败时继续写原来的文件
+func ReopenLogFile() error {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if events.file == nil {
+		return nil
+	}
+	f, err := openLogFile(events.path)
+	if err != nil {
+		return err
+	}
+	events.file.Close()
+	events.file = f
+	return nil
+}
+
+func openLogFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("open log file: %w", err)
+	}
+	return f, nil
+}
+
+// logEvent 写一行访问日志，时间戳的时区和格式见 SetLogTime
+func logEvent(e logEntry) {
+	now := time.Now()
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	var w io.Writer = os.Stdout
+	if events.file != nil {
+		w = events.file
+	}
+	if events.json {
+		line, _ := json.Marshal(logRecord{
+			TS: logStamp(now), IP: e.IP, Action: e.Action, Path: e.Path, Status: e.Status, Bytes: e.Bytes,
+			DurationMS: float64(e.Duration.Microseconds()) / 1000, Error: e.Err, Detail: e.Detail,
+		})
+		w.Write(append(line, '\n'))
+		return
+	}
+	fmt.Fprintf(w, "[%s][%s][%s][%s]\n", e.IP, e.Action, logStamp(now), e.text())
+}
+
+// text 是文本格式中的说明部分
+func (e logEntry) text() string {
+	var parts []string
+	if e.Path != "" {
+		parts = append(parts, "path="+e.Path)
+	}
+	if e.Detail != "" {
+		parts = append(parts, e.Detail)
+	}
+	if e.Bytes > 0 {
+		parts = append(parts, "bytes="+strconv.FormatInt(e.Bytes, 10))
+	}
+	// 不到1毫秒的用时对排查没有意义，文本格式中省略
+	if d := e.Duration.Round(time.Millisecond); d > 0 {
+		parts = append(parts, "elapsed="+d.String())
+	}
+	if e.Status >= 400 {
+		parts = append(parts, "status="+strconv.Itoa(e.Status))
+	}
+	if e.Err != "" {
+		parts = append(parts, "error: "+e.Err)
+	}
+	return strings.Join(parts, " ")
+}
+
+// requestStartKey 在请求的上下文中保存本地处理器收到请求的时间
+type requestStartKey struct{}
+
+func withRequestStart(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestStartKey{}, time.Now()))
+}
+
+// elapsedSince 返回请求开始以来的用时，供日志的 Duration 使用。用单调时钟计算，不受系统时间调整影响
+func elapsedSince(r *http.Request) time.Duration {
+	if t, ok := r.Context().Value(requestStartKey{}).(time.Time); ok {
+		return time.Since(t)
+	}
+	return 0
+}
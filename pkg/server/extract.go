@@ -0,0 +1,515 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：解包上传 ---------- */
+
+// POST <dir>?extract=tgz|zip 把上传的归档解到目录 dir（见 protocol.ExtractParam）。
+// tar.gz 边接收边解，zip 的目录在文件末尾，先把正文存进暂存文件再解。条目先解到目标目录下的暂存目录，
+// 全部通过检查（名字、大小限制、摘要、提交前钩子、覆盖策略）后才移到目标位置，任何一步失败时暂存目录整个删除，
+// 目标目录原有的内容不受影响。条目名不可信：绝对路径、含 ".." 或反斜杠的名字和保留名使整个请求失败，
+// 之后仍经过 SecurePath 映射到暂存目录内。符号链接、硬链接和设备不解出，计入 Skipped。
+// 文件的权限与普通上传一样是 0644
+
+// maxExtractEntries 是一个归档最多的条目数，防止大量空文件耗尽 inode
+const maxExtractEntries = 100000
+
+// extractError 是归档本身的问题，status 和 e 原样回复给客户端
+type extractError struct {
+	status int
+	e      *APIError
+}
+
+func (e *extractError) Error() string { return e.e.Message }
+
+// rejectEntry 返回条目 entry 被拒绝的错误（422），msg 说明原因
+func rejectEntry(code, entry, msg string) error {
+	return &extractError{http.StatusUnprocessableEntity, &APIError{Code: code, Message: entry + ": " + msg, Entry: entry}}
+}
+
+// badArchive 返回归档格式错误（422）
+func badArchive(format string, err error) error {
+	return &extractError{http.StatusUnprocessableEntity, &APIError{Code: protocol.BadArchiveCode, Message: fmt.Sprintf("not a valid %s archive: %v", format, err)}}
+}
+
+func (s *Server) handleExtract(w http.ResponseWriter, r *http.Request, clientIP string) {
+	dir, real, err := s.resolveSandboxPath(r, "")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "EXTRACT", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fail := func(status int, e *APIError) {
+		logEvent(logEntry{IP: clientIP, Action: "EXTRACT", Path: dir, Status: status, Duration: elapsedSince(r), Err: e.Message})
+		writeError(w, status, e)
+	}
+	format := r.URL.Query().Get(protocol.ExtractParam)
+	if format != protocol.ArchiveTarGz && format != protocol.ArchiveZip {
+		fail(http.StatusBadRequest, &APIError{Code: "BAD_FORMAT", Message: "extract must be tgz or zip"})
+		return
+	}
+	md, err := requestMetadata(r)
+	if err != nil {
+		rejectMetadata(w, clientIP, "EXTRACT", err)
+		return
+	}
+	want, err := expectedDigest(r)
+	if err != nil {
+		fail(http.StatusBadRequest, &APIError{Code: "BAD_DIGEST", Message: err.Error()})
+		return
+	}
+	if len(s.hooks.transformUpload) > 0 {
+		// 变换作用于单个上传的正文，解出的文件绕过它就会以明文落盘
+		fail(http.StatusConflict, &APIError{Code: "EXTRACT_UNAVAILABLE", Message: "archive extraction is unavailable for transformed uploads"})
+		return
+	}
+	if isReservedName(filepath.Base(real)) {
+		fail(http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: "reserved name"})
+		return
+	}
+	if fi, err := os.Lstat(real); err == nil && !fi.IsDir() {
+		fail(http.StatusConflict, &APIError{Code: protocol.NotDirectoryCode, Message: dir + " exists and is not a directory"})
+		return
+	}
+	if rejected := s.checkNewPath(real, true); rejected != nil {
+		fail(http.StatusUnprocessableEntity, rejected)
+		return
+	}
+	if s.maxUpload > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	}
+
+	release, _, ok := s.heavy(w, r, clientIP, "EXTRACT", weightWalk)
+	if !ok {
+		return
+	}
+	defer release()
+
+	newDirs, err := s.createDirs(real)
+	if err != nil {
+		fail(http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	stage, err := os.MkdirTemp(real, ".extract"+tempMarker+"*")
+	if err != nil {
+		fail(http.StatusInternalServerError, &APIError{Code: "EXTRACT_FAILED", Message: err.Error()})
+		return
+	}
+	committed := false
+	defer func() {
+		os.RemoveAll(stage)
+		if !committed {
+			s.removeNewDirs(newDirs)
+		}
+	}()
+
+	prog := track(r)
+	prog.begin("extracting")
+	src := &sourceReader{r: r.Body}
+	raw := sha256.New()
+	x := &extractor{stage: stage, format: format, maxEntry: s.extractMaxEntry, maxTotal: s.extractMaxSize, prog: prog}
+	body := io.TeeReader(src, raw)
+	if format == protocol.ArchiveZip {
+		err = x.zip(body, real)
+	} else {
+		err = x.tarGz(body)
+	}
+	if err == nil {
+		// 读完正文：gzip 的尾部和结束标记中的摘要都在归档内容之后
+		_, err = io.Copy(io.Discard, body)
+	}
+	var xe *extractError
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.As(src.err, &mbe):
+		fail(http.StatusRequestEntityTooLarge, s.tooLarge())
+		return
+	case src.err != nil:
+		// 接收正文失败（客户端中止或断开），归档的错误只是它的结果
+		fail(http.StatusBadRequest, &APIError{Code: "UPLOAD_ABORTED", Message: "receiving the archive failed: " + src.err.Error()})
+		return
+	case errors.As(err, &xe):
+		fail(xe.status, xe.e)
+		return
+	case err != nil:
+		fail(http.StatusInternalServerError, &APIError{Code: "EXTRACT_FAILED", Message: err.Error()})
+		return
+	}
+	if want == protocol.DigestTrailer {
+		if want = trailerDigest(r); want == "" {
+			fail(http.StatusBadRequest, &APIError{Code: "BAD_DIGEST", Message: "the upload declared a trailing SHA-256 but its end marker carried none"})
+			return
+		}
+	}
+	if got := hex.EncodeToString(raw.Sum(nil)); want != "" && got != want {
+		fail(http.StatusUnprocessableEntity, digestMismatch(want, got))
+		return
+	}
+
+	ev := TransferEvent{Identity: r.Header.Get("X-Wsbox-Token"), ClientIP: clientIP, Metadata: md}
+	res, status, rejected, err := s.commitExtract(r, stage, real, dir, forceOverwrite(r), ev)
+	if rejected != nil {
+		fail(status, rejected)
+		return
+	}
+	committed = true
+	if err != nil {
+		// 已经移到目标位置的条目不能撤回
+		fail(http.StatusInternalServerError, &APIError{Code: "EXTRACT_FAILED", Message: err.Error()})
+		return
+	}
+	res.SchemaVersion = protocol.SchemaVersion
+	res.Dir = dir
+	res.Skipped = x.skipped
+	logEvent(logEntry{IP: clientIP, Action: "EXTRACT", Path: dir, Status: http.StatusCreated, Bytes: res.Bytes, Duration: elapsedSince(r),
+		Detail: fmt.Sprintf("format=%s files=%d dirs=%d skipped=%d", format, res.Files, res.Dirs, res.Skipped) + formatMetadata(md)})
+	s.activity.record("extract", dir, res.Bytes, ev.Identity)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+// removeNewDirs 删除为失败的解包新建的目标目录（从内到外），已经有了其他内容的目录保留
+func (s *Server) removeNewDirs(dirs []string) {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if os.Remove(dirs[i]) != nil {
+			return
+		}
+		s.noteRemoved(dirs[i], true)
+	}
+}
+
+/* ---------- 解到暂存目录 ---------- */
+
+// extractor 把归档的条目写入暂存目录 stage，并检查名字和大小限制（0表示不限）
+type extractor struct {
+	stage    string
+	format   string
+	maxEntry int64
+	maxTotal int64
+	prog     *progress
+
+	entries int
+	total   int64
+	skipped int
+}
+
+func (x *extractor) tarGz(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return badArchive(x.format, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return badArchive(x.format, err)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(h.Name)
+		case tar.TypeReg:
+			err = x.file(h.Name, tr, h.ModTime)
+		case tar.TypeXGlobalHeader:
+		default:
+			err = x.skip(h.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// zip 先把正文存进 spoolDir 下的暂存文件（保留名，上传中断时由 sweepTemp 清理），再按目录逐个解出
+func (x *extractor) zip(r io.Reader, spoolDir string) error {
+	spool, err := os.CreateTemp(spoolDir, ".extract.zip"+tempMarker+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	size, err := io.Copy(spool, r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(spool, size)
+	if err != nil {
+		return badArchive(x.format, err)
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.dir(f.Name)
+		case mode.IsRegular():
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err != nil {
+				return badArchive(x.format, err)
+			}
+			err = x.file(f.Name, rc, f.Modified)
+			rc.Close()
+		default:
+			err = x.skip(f.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// target 检查条目名并返回它在暂存目录中的位置，名字为 "." 时返回暂存目录本身
+func (x *extractor) target(name string) (string, error) {
+	x.entries++
+	if x.entries > maxExtractEntries {
+		return "", rejectEntry(protocol.ArchiveTooLargeCode, name, fmt.Sprintf("the archive has more than %d entries", maxExtractEntries))
+	}
+	x.prog.add(1)
+	n := strings.TrimSuffix(name, "/")
+	if n == "" || strings.HasPrefix(n, "/") || strings.Contains(n, `\`) || validPathValue(n) != nil {
+		return "", rejectEntry(protocol.UnsafeEntryCode, name, "invalid entry name")
+	}
+	for _, part := range strings.Split(n, "/") {
+		if part == ".." {
+			return "", rejectEntry(protocol.UnsafeEntryCode, name, "entry leaves the target directory")
+		}
+		if isReservedName(part) {
+			return "", rejectEntry(protocol.UnsafeEntryCode, name, "reserved name")
+		}
+	}
+	p, err := SecurePath(n, x.stage)
+	if err != nil {
+		return "", rejectEntry(protocol.UnsafeEntryCode, name, err.Error())
+	}
+	return p, nil
+}
+
+func (x *extractor) dir(name string) error {
+	p, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(p); err == nil && !fi.IsDir() {
+		return rejectEntry(protocol.UnsafeEntryCode, name, "a file of the same name is already in the archive")
+	}
+	if err := SecureCreateDir(p, x.stage); err != nil {
+		return rejectEntry(protocol.UnsafeEntryCode, name, err.Error())
+	}
+	return nil
+}
+
+// file 把 r 的内容写到条目 name，超过单个条目或总量的限制时拒绝。同名条目以后出现的为准
+func (x *extractor) file(name string, r io.Reader, mtime time.Time) error {
+	p, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if p == x.stage {
+		return rejectEntry(protocol.UnsafeEntryCode, name, "invalid entry name")
+	}
+	if err := SecureCreateDir(filepath.Dir(p), x.stage); err != nil {
+		return rejectEntry(protocol.UnsafeEntryCode, name, err.Error())
+	}
+	if fi, err := os.Lstat(p); err == nil {
+		if fi.IsDir() {
+			return rejectEntry(protocol.UnsafeEntryCode, name, "a directory of the same name is already in the archive")
+		}
+		os.Remove(p)
+	}
+	// 声明的大小不可信（zip 的目录可以造假），按实际读到的字节数计算，多读一个字节判断是否超出
+	limit := int64(-1)
+	if x.maxEntry > 0 {
+		limit = x.maxEntry
+	}
+	if x.maxTotal > 0 && (limit < 0 || x.maxTotal-x.total < limit) {
+		limit = x.maxTotal - x.total
+	}
+	src := &sourceReader{r: r}
+	var in io.Reader = src
+	if limit >= 0 {
+		in = io.LimitReader(src, limit+1)
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, in)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	switch {
+	case src.err != nil:
+		return badArchive(x.format, fmt.Errorf("%s: %v", name, src.err))
+	case err != nil:
+		return err
+	case x.maxEntry > 0 && n > x.maxEntry:
+		return rejectEntry(protocol.EntryTooLargeCode, name, fmt.Sprintf("entry is larger than the server limit of %d bytes", x.maxEntry))
+	case x.maxTotal > 0 && x.total+n > x.maxTotal:
+		return rejectEntry(protocol.ArchiveTooLargeCode, name, fmt.Sprintf("the archive expands to more than the server limit of %d bytes", x.maxTotal))
+	}
+	x.total += n
+	if !mtime.IsZero() {
+		os.Chtimes(p, mtime, mtime)
+	}
+	return nil
+}
+
+// skip 记录一个不解出的条目，名字同样要合法
+func (x *extractor) skip(name string) error {
+	if _, err := x.target(name); err != nil {
+		return err
+	}
+	x.skipped++
+	return nil
+}
+
+/* ---------- 移到目标目录 ---------- */
+
+// stagedEntry 是暂存目录中的一个条目，rel 是 "/" 分隔的相对路径
+type stagedEntry struct {
+	rel   string
+	dir   bool
+	size  int64
+	isNew bool
+}
+
+// commitExtract 把暂存目录 stage 中的内容移到目标目录 real（沙箱路径为 dir）。先检查全部条目：
+// 与已有目录或文件的类型冲突、覆盖策略、锁、大小写冲突、提交前钩子（内容扫描），
+// 任何一项不通过时返回非空 *APIError，目标目录没有任何改动。之后按先序创建目录、逐个提交文件，
+// 这一步的错误（磁盘错误）以 err 返回，已经提交的文件保留
+func (s *Server) commitExtract(r *http.Request, stage, real, dir string, force bool, ev TransferEvent) (res protocol.ExtractResult, status int, rejected *APIError, err error) {
+	var entries []stagedEntry
+	err = filepath.WalkDir(stage, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == stage {
+			return err
+		}
+		rel, _ := filepath.Rel(stage, p)
+		e := stagedEntry{rel: filepath.ToSlash(rel), dir: d.IsDir()}
+		if !e.dir {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			e.size = info.Size()
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return res, 0, nil, err
+	}
+
+	conflict := func(e stagedEntry, code, msg string) (protocol.ExtractResult, int, *APIError, error) {
+		return res, http.StatusConflict, &APIError{Code: code, Message: e.rel + ": " + msg, Entry: e.rel}, nil
+	}
+	for i := range entries {
+		e := &entries[i]
+		final := filepath.Join(real, filepath.FromSlash(e.rel))
+		p := path.Join(dir, e.rel)
+		fi, statErr := os.Lstat(final)
+		e.isNew = os.IsNotExist(statErr)
+		// 目标目录中已有的符号链接与直接上传时一样按 -follow-symlinks 检查，条目不能经由链接写到别处
+		if err := s.checkSymlinks(final, true); err != nil {
+			return res, http.StatusUnprocessableEntity, &APIError{Code: protocol.UnsafeEntryCode, Message: e.rel + ": " + err.Error(), Entry: e.rel}, nil
+		}
+		if e.isNew {
+			// 条目的名字和层数按放到目标位置之后检查，与直接上传相同
+			if rejected := s.checkNewPath(final, e.dir); rejected != nil {
+				rejected.Message, rejected.Entry = e.rel+": "+rejected.Message, e.rel
+				return res, http.StatusUnprocessableEntity, rejected, nil
+			}
+		}
+		switch {
+		case e.dir && !e.isNew && !fi.IsDir():
+			return conflict(*e, protocol.NotDirectoryCode, "exists and is not a directory")
+		case e.dir:
+			continue
+		case !e.isNew && fi.IsDir():
+			return conflict(*e, "IS_A_DIRECTORY", "exists and is a directory")
+		case !e.isNew && s.overwrite == OverwriteDeny && !force:
+			return conflict(*e, protocol.ExistsCode, "already exists and the server does not overwrite files; upload with overwrite=1 to replace it")
+		}
+		if l := activeLock(final); l != nil {
+			return res, http.StatusLocked, &APIError{Code: "LOCKED", Message: e.rel + ": path is locked by " + l.Holder, Entry: e.rel}, nil
+		}
+		if e.isNew {
+			if rejected := s.checkCaseCollision(final, p, ev.ClientIP); rejected != nil {
+				rejected.Entry = e.rel
+				return res, http.StatusConflict, rejected, nil
+			}
+		}
+		fev := ev
+		fev.Path, fev.Size, fev.Staged = p, e.size, filepath.Join(stage, filepath.FromSlash(e.rel))
+		if s.hooks.needsHash() {
+			if fev.Hash, err = hashFile(fev.Staged); err != nil {
+				return res, 0, nil, err
+			}
+		}
+		if status, rejected := runPreHooks(r.Context(), s.hooks.uploadStaged, fev); rejected != nil {
+			rejected.Entry = e.rel
+			return res, status, rejected, nil
+		}
+	}
+
+	for _, e := range entries {
+		final := filepath.Join(real, filepath.FromSlash(e.rel))
+		p := path.Join(dir, e.rel)
+		if e.dir {
+			if _, err := s.createDirs(final); err != nil {
+				return res, 0, nil, fmt.Errorf("%s: %w", e.rel, err)
+			}
+			res.Dirs++
+			continue
+		}
+		staged := filepath.Join(stage, filepath.FromSlash(e.rel))
+		s.lockMu.Lock()
+		os.Remove(lockMetaPath(final))
+		s.lockMu.Unlock()
+		backup, rejected, err := s.commitUpload(staged, final, p, force)
+		if rejected != nil {
+			// 检查之后有并发的上传创建了它
+			return res, 0, nil, fmt.Errorf("%s: %s", e.rel, rejected.Message)
+		}
+		if err != nil {
+			return res, 0, nil, fmt.Errorf("%s: %w", e.rel, err)
+		}
+		if backup != "" {
+			s.noteCreated(backup)
+		}
+		if e.isNew {
+			s.noteCreated(final)
+		}
+		os.Remove(partialPath(final))
+		res.Files++
+		res.Bytes += e.size
+		fev := ev
+		fev.Path, fev.Size = p, e.size
+		if s.hooks.needsHash() {
+			fev.Hash, _ = hashFile(final)
+		}
+		runPostHooks(r.Context(), s.hooks.uploadComplete, fev, "EXTRACT")
+	}
+	return res, 0, nil, nil
+}
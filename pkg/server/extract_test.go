@@ -0,0 +1,221 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wsbox/internal/protocol"
+)
+
+// fixtureEntry 是测试归档中的一个条目，link 非空时是指向 link 的符号链接（hard 为 true 时是硬链接）
+type fixtureEntry struct {
+	name string
+	body string
+	link string
+	hard bool
+}
+
+func tarGzFixture(t *testing.T, entries []fixtureEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		switch {
+		case e.link != "" && e.hard:
+			h.Typeflag, h.Linkname, h.Size = tar.TypeLink, e.link, 0
+		case e.link != "":
+			h.Typeflag, h.Linkname, h.Size = tar.TypeSymlink, e.link, 0
+		case strings.HasSuffix(e.name, "/"):
+			h.Typeflag, h.Mode = tar.TypeDir, 0o755
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// zipFixture 与 tarGzFixture 相同；zip 没有硬链接，符号链接的内容是它的目标
+func zipFixture(t *testing.T, entries []fixtureEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		body := e.body
+		switch {
+		case e.link != "":
+			h.SetMode(os.ModeSymlink | 0o777)
+			body = e.link
+		case strings.HasSuffix(e.name, "/"):
+			h.SetMode(os.ModeDir | 0o755)
+		default:
+			h.SetMode(0o644)
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+// archiveFixtures 按 ExtractParam 的取值给出构造测试归档的函数
+var archiveFixtures = map[string]func(*testing.T, []fixtureEntry) []byte{
+	protocol.ArchiveTarGz: tarGzFixture,
+	protocol.ArchiveZip:   zipFixture,
+}
+
+// extractFixture 在沙箱 sb 中把归档解到 /dest，返回回复和沙箱外的目录（沙箱与它同在一个临时目录下）
+func extractFixture(t *testing.T, format string, archive []byte) (rec *httptest.ResponseRecorder, dir, outside string) {
+	t.Helper()
+	parent := t.TempDir()
+	dir = filepath.Join(parent, "sb")
+	outside = filepath.Join(parent, "outside")
+	os.Mkdir(dir, 0o755)
+	os.Mkdir(outside, 0o755)
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("top secret"), 0o644)
+	s := newTestServer(t, Config{Dir: dir})
+	rec = httptest.NewRecorder()
+	s.localHandler(rec, httptest.NewRequest("POST", "/dest?"+protocol.ExtractParam+"="+format, bytes.NewReader(archive)))
+	return rec, dir, outside
+}
+
+// assertContained 检查沙箱外没有新文件、沙箱中除 /dest 之外没有解出的内容
+func assertContained(t *testing.T, dir, outside string) {
+	t.Helper()
+	filepath.WalkDir(filepath.Dir(dir), func(p string, d os.DirEntry, err error) error {
+		if err != nil || p == filepath.Dir(dir) {
+			return nil
+		}
+		rel, _ := filepath.Rel(filepath.Dir(dir), p)
+		switch {
+		case rel == "sb" || rel == "outside" || rel == filepath.Join("outside", "secret.txt"):
+		case strings.HasPrefix(rel, filepath.Join("sb", "dest")):
+			if d.Type()&os.ModeSymlink != 0 {
+				t.Errorf("extraction created a symlink: %s", rel)
+			}
+		default:
+			t.Errorf("extraction created %s outside the target directory", rel)
+		}
+		return nil
+	})
+	if b, err := os.ReadFile(filepath.Join(outside, "secret.txt")); err != nil || string(b) != "top secret" {
+		t.Errorf("extraction changed the file outside the sandbox: %v", err)
+	}
+}
+
+func TestExtractRejectsUnsafeNames(t *testing.T) {
+	names := []string{
+		"../evil.txt",
+		"a/../../evil.txt",
+		"a/b/../../../evil.txt",
+		"/evil.txt",
+		"/tmp/evil.txt",
+		`..\evil.txt`,
+		`a\..\..\evil.txt`,
+		"ok/..",
+		"a\x00b", // tar 写不出这样的名字，只用于 zip
+	}
+	for format, build := range archiveFixtures {
+		for _, name := range names {
+			if format == protocol.ArchiveTarGz && strings.Contains(name, "\x00") {
+				continue
+			}
+			// 不安全的条目前后各有一个正常条目：整个请求失败，正常条目也不落盘
+			archive := build(t, []fixtureEntry{{name: "good.txt", body: "good"}, {name: name, body: "evil"}, {name: "after.txt", body: "after"}})
+			rec, dir, outside := extractFixture(t, format, archive)
+			e := decodeAPIError(rec)
+			if rec.Code != http.StatusUnprocessableEntity || e == nil || e.Code != protocol.UnsafeEntryCode || e.Entry != name {
+				t.Errorf("%s entry %q: got %d %q, want 422 %s", format, name, rec.Code, strings.TrimSpace(rec.Body.String()), protocol.UnsafeEntryCode)
+			}
+			for _, f := range []string{"good.txt", "after.txt"} {
+				if _, err := os.Stat(filepath.Join(dir, "dest", f)); err == nil {
+					t.Errorf("%s entry %q: %s was extracted although the request failed", format, name, f)
+				}
+			}
+			assertContained(t, dir, outside)
+		}
+	}
+}
+
+// 符号链接和硬链接条目不解出，计入 Skipped；其后经过同名路径的条目解成普通目录，不会跟着链接走出沙箱
+func TestExtractSkipsLinks(t *testing.T) {
+	tests := []struct {
+		format  string
+		entries []fixtureEntry
+		skipped int
+	}{
+		{protocol.ArchiveTarGz, []fixtureEntry{
+			{name: "abs", link: "/etc/passwd"},
+			{name: "up", link: "../../outside/secret.txt"},
+			{name: "d", link: "../../outside"},
+			{name: "d/x.txt", body: "through the link"},
+			{name: "hard", link: "../../outside/secret.txt", hard: true},
+			{name: "hardabs", link: "/etc/passwd", hard: true},
+			{name: "plain.txt", body: "plain"},
+		}, 5},
+		{protocol.ArchiveZip, []fixtureEntry{
+			{name: "abs", link: "/etc/passwd"},
+			{name: "up", link: "../../outside/secret.txt"},
+			{name: "d", link: "../../outside"},
+			{name: "d/x.txt", body: "through the link"},
+			{name: "plain.txt", body: "plain"},
+		}, 3},
+	}
+	for _, tt := range tests {
+		rec, dir, outside := extractFixture(t, tt.format, archiveFixtures[tt.format](t, tt.entries))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("%s: got %d %q, want 201", tt.format, rec.Code, strings.TrimSpace(rec.Body.String()))
+		}
+		var res protocol.ExtractResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: decode result: %v", tt.format, err)
+		}
+		if res.Skipped != tt.skipped || res.Files != 2 {
+			t.Errorf("%s: files=%d skipped=%d, want files=2 skipped=%d", tt.format, res.Files, res.Skipped, tt.skipped)
+		}
+		if b, err := os.ReadFile(filepath.Join(dir, "dest", "d", "x.txt")); err != nil || string(b) != "through the link" {
+			t.Errorf("%s: d/x.txt was not extracted into a plain directory: %v", tt.format, err)
+		}
+		if fi, err := os.Lstat(filepath.Join(dir, "dest", "d")); err != nil || !fi.IsDir() {
+			t.Errorf("%s: dest/d is not a plain directory: %v", tt.format, err)
+		}
+		if _, err := os.Lstat(filepath.Join(outside, "x.txt")); err == nil {
+			t.Errorf("%s: an entry was written through a symlink entry", tt.format)
+		}
+		assertContained(t, dir, outside)
+	}
+}
+
+func TestExtractFixtureRoundTrip(t *testing.T) {
+	entries := []fixtureEntry{{name: "a/"}, {name: "a/b.txt", body: "bee"}, {name: "c.txt", body: "sea"}}
+	for format, build := range archiveFixtures {
+		rec, dir, outside := extractFixture(t, format, build(t, entries))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("%s: got %d %q, want 201", format, rec.Code, strings.TrimSpace(rec.Body.String()))
+		}
+		for name, want := range map[string]string{"a/b.txt": "bee", "c.txt": "sea"} {
+			if b, err := os.ReadFile(filepath.Join(dir, "dest", name)); err != nil || string(b) != want {
+				t.Errorf("%s: %s = %q, %v; want %q", format, name, b, err, want)
+			}
+		}
+		assertContained(t, dir, outside)
+	}
+}
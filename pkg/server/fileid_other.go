@@ -0,0 +1,10 @@
+//go:build !unix
+
+package server
+
+import "os"
+
+// fileID 在没有 inode 的平台上为空，摘要缓存只比较大小和修改时间
+func fileID(fi os.FileInfo) string {
+	return ""
+}
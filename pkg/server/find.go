@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：按名字查找 ---------- */
+
+// defaultFindLimit 是 Config.FindLimit 为0时一次查找最多返回的匹配数
+const defaultFindLimit = 1000
+
+// handleFind 实现 GET /_find?dir=&pattern=&regex=1&type=f|d&maxdepth=&limit=：在服务端遍历目录树，
+// 返回名字匹配 glob（与 find -name 相同，只比较最后一级名字）或路径匹配正则（regex=1，比较相对路径，不自动锚定）的条目。
+// 结果是相对 dir 的路径，按遍历顺序（字典序）排列，目录以 "/" 结尾。
+// maxdepth 为 n 时只查找前 n 层（1 为直接条目），0 不限。
+// 匹配数达到 limit（不超过 -find-limit）时停止并标记 limited；遍历占一个重操作配额，受 -walk-timeout 限制
+func (s *Server) handleFind(w http.ResponseWriter, r *http.Request, clientIP string) {
+	dir, real, err := s.resolveSandboxPath(r, "dir")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "FIND", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	fail := func(status int, e *APIError) {
+		logEvent(logEntry{IP: clientIP, Action: "FIND", Path: dir, Status: status, Duration: elapsedSince(r), Err: e.Message})
+		writeError(w, status, e)
+	}
+	match, err := findMatcher(q.Get("pattern"), q.Get("regex") == "1")
+	if err != nil {
+		fail(http.StatusBadRequest, &APIError{Code: "BAD_PATTERN", Message: err.Error()})
+		return
+	}
+	typ := q.Get("type")
+	if typ != "" && typ != "f" && typ != "d" {
+		fail(http.StatusBadRequest, &APIError{Code: "BAD_TYPE", Message: "type must be f or d"})
+		return
+	}
+	maxDepth := 0
+	if v := q.Get("maxdepth"); v != "" {
+		if maxDepth, err = strconv.Atoi(v); err != nil || maxDepth < 0 {
+			fail(http.StatusBadRequest, &APIError{Code: "BAD_DEPTH", Message: "maxdepth must be a non-negative integer"})
+			return
+		}
+	}
+	limit := s.findLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fail(http.StatusBadRequest, &APIError{Code: "BAD_LIMIT", Message: "limit must be a positive integer"})
+			return
+		}
+		limit = min(n, limit)
+	}
+	fi, err := os.Stat(real)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fail(http.StatusNotFound, &APIError{Code: "NOT_FOUND", Message: "directory not found"})
+		} else {
+			fail(http.StatusInternalServerError, &APIError{Code: "STAT_FAILED", Message: err.Error()})
+		}
+		return
+	}
+	if !fi.IsDir() {
+		fail(http.StatusBadRequest, &APIError{Code: protocol.NotDirectoryCode, Message: "not a directory"})
+		return
+	}
+
+	t := newOpTimings()
+	release, wait, ok := s.heavy(w, r, clientIP, "FIND", weightWalk)
+	if !ok {
+		return
+	}
+	defer release()
+	t.queue = wait
+
+	ctx, cancel := s.walkContext(r)
+	defer cancel()
+
+	// 名字和类型都来自目录项，查找不需要 stat
+	res := protocol.FindResult{SchemaVersion: protocol.SchemaVersion, Dir: dir, Matches: []string{}}
+	prog := track(r)
+	prog.begin("walking")
+	walkStart := time.Now()
+	err = filepath.WalkDir(real, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return errWalkBudget
+		}
+		if err != nil {
+			if p == real {
+				return err
+			}
+			return nil
+		}
+		if p == real || isReservedName(d.Name()) {
+			return nil
+		}
+		prog.add(1)
+		rel, _ := filepath.Rel(real, p)
+		rel = filepath.ToSlash(rel)
+		if findType(typ, d) && match(d.Name(), rel) {
+			if len(res.Matches) == limit {
+				res.Limited = true
+				return fs.SkipAll
+			}
+			if d.IsDir() {
+				rel += "/"
+			}
+			res.Matches = append(res.Matches, rel)
+		}
+		if d.IsDir() && maxDepth > 0 && strings.Count(rel, "/") >= maxDepth-1 {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	t.walk = time.Since(walkStart)
+	if errors.Is(err, errWalkBudget) {
+		res.Truncated, err = true, nil
+	}
+	if err != nil {
+		fail(http.StatusInternalServerError, &APIError{Code: "READ_FAILED", Message: "walk failed: " + err.Error()})
+		return
+	}
+	switch {
+	case res.Truncated:
+		res.Warning = s.budgetWarning()
+	case res.Limited:
+		res.Warning = &protocol.Warning{
+			Code:    "RESULT_LIMIT",
+			Message: fmt.Sprintf("stopped after %d matches, narrow the pattern or ask for more (the server allows up to %d)", limit, s.findLimit),
+		}
+	}
+	logEvent(logEntry{IP: clientIP, Action: "FIND", Path: dir, Status: http.StatusOK, Duration: elapsedSince(r),
+		Detail: fmt.Sprintf("matches=%d limited=%t truncated=%t", len(res.Matches), res.Limited, res.Truncated)})
+	serializeStart := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+	t.serialize = time.Since(serializeStart)
+	s.logSlow(clientIP, "FIND", "dir="+dir, t)
+}
+
+// findType 判断目录项是否符合 type 参数：f 只要普通文件，d 只要目录，空值不限
+func findType(typ string, d fs.DirEntry) bool {
+	switch typ {
+	case "f":
+		return d.Type().IsRegular()
+	case "d":
+		return d.IsDir()
+	}
+	return true
+}
+
+// findMatcher 返回按名字（glob）或相对路径（正则）判断的匹配函数，空模式匹配所有条目
+func findMatcher(pattern string, regex bool) (func(name, rel string) bool, error) {
+	if regex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		return func(_, rel string) bool { return re.MatchString(rel) }, nil
+	}
+	if pattern == "" {
+		pattern = "*"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return func(name, _ string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}, nil
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 流控：分块响应与确认窗口 ---------- */
+
+// 帧格式见 protocol.FlowHeader。未协商的连接保持原来的"状态头 + 单个正文帧"格式
+
+// flowAckTimeout 发送方等待确认的最长时间
+const flowAckTimeout = time.Minute
+
+// negotiateWindow 取客户端请求的窗口与服务端上限中的较小值，0表示不使用流控
+func negotiateWindow(requested string, max int) int {
+	n, err := strconv.Atoi(requested)
+	if err != nil || n <= 0 || max <= 0 {
+		return 0
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// sendChunked 按窗口分块发送响应正文，在途数据不超过 window*protocol.FlowChunkSize 字节。
+// header 是先发送的状态头（见 transfer.statusHeader）。正文为空时仍发送一个空帧，接收方据此统一处理
+func sendChunked(conn frameConn, header string, size int64, body io.Reader, window int) error {
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(header)); err != nil {
+		return err
+	}
+	buf := make([]byte, protocol.FlowChunkSize)
+	sent, acked := 0, 0
+	remaining := size
+	for first := true; first || remaining > 0; first = false {
+		for sent-acked >= window {
+			n, err := readAck(conn)
+			if err != nil {
+				return err
+			}
+			if n <= acked || n > sent {
+				return fmt.Errorf("flow control: bad ack %d (sent %d, acked %d)", n, sent, acked)
+			}
+			acked = n
+		}
+		n := int64(len(buf))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(body, buf[:n]); err != nil {
+			return fmt.Errorf("flow control: read body: %w", err)
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+			return err
+		}
+		sent++
+		remaining -= n
+	}
+	return nil
+}
+
+// readAck 等待一条 "ACK n" 确认帧
+func readAck(conn frameConn) (int, error) {
+	conn.SetReadDeadline(time.Now().Add(flowAckTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	msgType, payload, err := conn.ReadMessage()
+	if err != nil {
+		return 0, fmt.Errorf("flow control: waiting for ack: %w", err)
+	}
+	n, ok := parseAck(msgType, payload)
+	if !ok {
+		return 0, fmt.Errorf("flow control: expected ack, got %q", payload)
+	}
+	return n, nil
+}
+
+// parseAck 识别文本帧中的确认
+func parseAck(msgType int, payload []byte) (int, bool) {
+	if msgType != websocket.TextMessage {
+		return 0, false
+	}
+	return protocol.ParseAck(payload)
+}
+
+// bodyError 是在向连接写入任何内容之前读取本地处理器的正文失败（正文比 Content-Length 短、处理器中途 panic），
+// 调用方仍可以改为回复一个完整的错误响应
+type bodyError struct{ err error }
+
+func (e *bodyError) Error() string { return "local handler response: " + e.err.Error() }
+func (e *bodyError) Unwrap() error { return e.err }
+
+// relayResponse 把本地处理器的响应转发给客户端，状态头的格式取决于协议版本（见 transfer.statusHeader）。
+// 流式列表和打包下载按帧转发；协商了流控时边读边发，否则读完整个正文后按旧格式发送。
+// 整个读完才发送的正文读取失败时返回 *bodyError
+func relayResponse(conn frameConn, resp *http.Response, t transfer) error {
+	switch resp.Header.Get("Content-Type") {
+	case ndjsonType:
+		return relayStream(conn, resp, t)
+	case archiveType:
+		return relayArchive(conn, resp, t)
+	}
+	if t.window <= 0 {
+		// 读正文失败（如请求因token吊销被取消）时不能把不完整的正文当作成功响应发出
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return &bodyError{err}
+		}
+		header := t.statusHeader(resp, int64(len(b)))
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(header)); err != nil {
+			return err
+		}
+		return conn.WriteMessage(websocket.BinaryMessage, b)
+	}
+	size := resp.ContentLength
+	var body io.Reader = resp.Body
+	if size < 0 {
+		// 长度未知的响应（如JSON）都很小，先读完再分块
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return &bodyError{err}
+		}
+		size, body = int64(len(b)), bytes.NewReader(b)
+	}
+	return sendChunked(conn, t.statusHeader(resp, size), size, body, t.window)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+	"wsbox/internal/throttle"
+)
+
+// chanConn 是内存中的 frameConn：发送方写出的帧进入 out（缓冲很大，相当于不设上限的套接字缓冲区），
+// ReadMessage 从 in 取接收方的确认
+type chanConn struct {
+	out chan []byte
+	in  chan []byte
+}
+
+func (c *chanConn) WriteMessage(_ int, b []byte) error {
+	c.out <- bytes.Clone(b)
+	return nil
+}
+
+func (c *chanConn) ReadMessage() (int, []byte, error) {
+	b, ok := <-c.in
+	if !ok {
+		return 0, nil, errors.New("closed")
+	}
+	return websocket.TextMessage, b, nil
+}
+
+func (c *chanConn) SetReadDeadline(time.Time) error { return nil }
+
+// countingBody 记录发送方从磁盘（这里是内存）读出的字节数
+type countingBody struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (b countingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// 接收方经由限速的 Reader 慢慢读取每一块、每两块确认一次：发送方读出但接收方还没读完的字节
+// 始终不超过 window 块，而套接字缓冲区（out）本身不设上限
+func TestFlowBoundedInFlight(t *testing.T) {
+	const window, chunks = 4, 24
+	size := int64(chunks * protocol.FlowChunkSize)
+	conn := &chanConn{out: make(chan []byte, 2*chunks), in: make(chan []byte, chunks)}
+	var read, consumed, maxInFlight atomic.Int64
+	body := countingBody{bytes.NewReader(bytes.Repeat([]byte("w"), int(size))), &read}
+
+	done := make(chan error, 1)
+	go func() { done <- sendChunked(conn, "200 "+fmt.Sprint(size), size, body, window) }()
+
+	// 8 MiB/s：24 块约 200ms，足够让发送方一次次撞上窗口
+	lim := throttle.New(8 << 20)
+	if h := <-conn.out; string(h) != "200 "+fmt.Sprint(size) {
+		t.Fatalf("status header %q", h)
+	}
+	for i := 1; i <= chunks; i++ {
+		var frame []byte
+		select {
+		case frame = <-conn.out:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("chunk %d never arrived", i)
+		}
+		if inFlight := read.Load() - consumed.Load(); inFlight > maxInFlight.Load() {
+			maxInFlight.Store(inFlight)
+		}
+		n, _ := io.Copy(io.Discard, throttle.Reader(bytes.NewReader(frame), lim))
+		consumed.Add(n)
+		if i%2 == 0 {
+			conn.in <- []byte(fmt.Sprintf("ACK %d", i))
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("sendChunked: %v", err)
+	}
+	if consumed.Load() != size {
+		t.Errorf("received %d bytes, want %d", consumed.Load(), size)
+	}
+	limit := int64(window * protocol.FlowChunkSize)
+	if m := maxInFlight.Load(); m > limit {
+		t.Errorf("%d bytes were in flight, the window allows %d", m, limit)
+	} else if m < limit/2 {
+		t.Errorf("at most %d bytes were in flight, the window of %d was never used", m, limit)
+	}
+}
+
+// 接收方不确认时发送方停在窗口上，不会把整个文件读进缓冲区
+func TestFlowStallsWithoutAck(t *testing.T) {
+	const window = 3
+	size := int64(16 * protocol.FlowChunkSize)
+	conn := &chanConn{out: make(chan []byte, 32), in: make(chan []byte)}
+	var read atomic.Int64
+	body := countingBody{bytes.NewReader(make([]byte, size)), &read}
+	done := make(chan error, 1)
+	go func() { done <- sendChunked(conn, "200", size, body, window) }()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := read.Load(); n != window*protocol.FlowChunkSize {
+		t.Errorf("read %d bytes without an ack, want exactly the window (%d)", n, window*protocol.FlowChunkSize)
+	}
+	if len(conn.out) != 1+window {
+		t.Errorf("%d frames sent without an ack, want the header and %d chunks", len(conn.out), window)
+	}
+	close(conn.in)
+	if err := <-done; err == nil {
+		t.Error("sendChunked succeeded after the receiver went away")
+	}
+}
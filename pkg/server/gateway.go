@@ -0,0 +1,410 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：网关 ---------- */
+
+// tokenFingerprint 返回token的SHA-256前8位十六进制，用于记录身份而不泄露token
+func tokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// transfer 是连接建立时与客户端协商的传输参数
+type transfer struct {
+	window    int  // 下载流控窗口，0表示单帧响应
+	stream    bool // 是否支持分块上传
+	canonical bool // 状态头中可以附带规范路径
+	version   int  // 协议版本，决定请求帧和状态头的格式（见 protocol.VersionHeader）
+}
+
+// negotiateVersion 取客户端支持的最高版本与 protocol.Version 中的较小值，没有这个头的客户端是版本1
+func negotiateVersion(requested string) int {
+	v, err := strconv.Atoi(requested)
+	if err != nil || v < protocol.LegacyVersion {
+		return protocol.LegacyVersion
+	}
+	return min(v, protocol.Version)
+}
+
+// Origin 在升级之前由 checkOrigin 按 Config.AllowedOrigins 检查
+var upgrader = websocket.Upgrader{
+	CheckOrigin:  func(r *http.Request) bool { return true },
+	Subprotocols: []string{protocol.Subprotocol},
+}
+
+// requestedVersion 返回客户端声明的协议版本：VersionHeader，浏览器提供 protocol.Subprotocol 时是当前版本
+func requestedVersion(r *http.Request) string {
+	if v := r.Header.Get(protocol.VersionHeader); v != "" {
+		return v
+	}
+	for _, p := range websocket.Subprotocols(r) {
+		if p == protocol.Subprotocol {
+			return strconv.Itoa(protocol.Version)
+		}
+	}
+	return ""
+}
+
+func (s *Server) gatewayHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.checkOrigin(w, r) {
+			return
+		}
+		if !s.checkAuth(w, r) {
+			return
+		}
+		t := transfer{
+			window:    negotiateWindow(r.Header.Get(protocol.FlowHeader), s.flowWindow),
+			stream:    r.Header.Get(protocol.StreamHeader) == "1",
+			canonical: r.Header.Get(protocol.CanonicalHeader) == "1",
+			version:   negotiateVersion(requestedVersion(r)),
+		}
+		if t.version < protocol.Version && s.rejectLegacy {
+			logf("rejecting %s: client only speaks protocol version %d", r.RemoteAddr, t.version)
+			http.Error(w, fmt.Sprintf("this server requires wsbox protocol version %d; upgrade the client", protocol.Version), http.StatusUpgradeRequired)
+			return
+		}
+		keepAlive := r.Header.Get(protocol.ProgressHeader) == "1"
+		respHeader := http.Header{}
+		if t.window > 0 {
+			respHeader.Set(protocol.FlowHeader, strconv.Itoa(t.window))
+		}
+		if t.stream {
+			respHeader.Set(protocol.StreamHeader, "1")
+		}
+		if keepAlive {
+			respHeader.Set(protocol.ProgressHeader, "1")
+		}
+		if t.canonical {
+			respHeader.Set(protocol.CanonicalHeader, "1")
+		}
+		if t.version > protocol.LegacyVersion {
+			respHeader.Set(protocol.VersionHeader, strconv.Itoa(t.version))
+		}
+		readLimit := s.readLimit()
+		if readLimit > 0 {
+			respHeader.Set(protocol.MaxMessageHeader, strconv.FormatInt(readLimit, 10))
+		}
+		pipeline := negotiatePipeline(r.Header.Get(protocol.PipelineHeader), s.pipeline)
+		if pipeline > 0 {
+			respHeader.Set(protocol.PipelineHeader, strconv.Itoa(pipeline))
+		}
+		conn, err := upgrader.Upgrade(w, r, respHeader)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.metrics.connections.Add(1)
+		defer s.metrics.connections.Add(-1)
+		if readLimit > 0 {
+			// 网关要读完整帧才能转发（未协商分块上传时整个文件就是一帧）；
+			// 限制单帧大小，超过时 gorilla 按帧头的长度以 1009 关闭连接，不会先把它读进内存
+			conn.SetReadLimit(readLimit)
+		}
+		sess := s.openSession(r, conn)
+		if sess == nil {
+			// 升级期间token被换掉
+			(&session{conn: conn}).terminate()
+			return
+		}
+		defer s.closeSession(sess)
+		defer s.heartbeat(conn)()
+		// 因吊销而退出时先发送关闭帧，让客户端知道原因
+		defer func() {
+			if sess.isRevoked() {
+				sess.terminate()
+			}
+		}()
+
+		if pipeline > 0 {
+			s.servePipeline(r, sess, t, keepAlive, pipeline)
+			return
+		}
+		bucket := newTokenBucket(s.rateLimit)
+		for {
+			extendRead(conn, s.idleTimeout)
+			msgType, payload, err := conn.ReadMessage()
+			if err != nil {
+				s.noteReadLimit(r.RemoteAddr, err)
+				if isIdleTimeout(err) {
+					logf("closing idle connection from %s after %s", r.RemoteAddr, s.idleTimeout)
+				}
+				return
+			}
+
+			// 处理文本消息（请求头）
+			if msgType == websocket.TextMessage {
+				// 忽略迟到的流控确认
+				if _, ok := parseAck(msgType, payload); ok {
+					continue
+				}
+				req, ok := t.parseRequest(payload)
+				if !ok {
+					continue
+				}
+				// 超过 -rate-limit 时推迟读取下一个请求，客户端的请求在连接上排队
+				bucket.wait()
+				// 正在关闭时不再接受新请求，关闭连接让客户端重连到新实例
+				if !s.drain.enter() {
+					sess.closeWith(protocol.CloseGoingAway, protocol.ShutdownReason)
+					return
+				}
+				ok = s.serve(throttleConn(conn, sess.bw), sess, r.RemoteAddr, t, keepAlive, req)
+				s.drain.leave()
+				if !ok {
+					return
+				}
+				// 关闭期间完成的请求是这条连接的最后一个
+				if s.drain.draining() {
+					sess.closeWith(protocol.CloseGoingAway, protocol.ShutdownReason)
+					return
+				}
+			}
+		}
+	}
+}
+
+// frameConn 是转发一个请求时收发帧的方式：普通连接上就是 *websocket.Conn，
+// 流水线连接上是带请求ID的 pipeStream（见 pipeline.go）
+type frameConn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(int, []byte) error
+	SetReadDeadline(time.Time) error
+}
+
+// request 是从请求帧解析出的一个请求，target 是转义后的 "path?query"，body 是内联正文。
+// 版本2的请求帧无法解析时 err 非空，serve 以 400 回复
+type request struct {
+	method, target, body string
+	err                  error
+}
+
+// parseRequest 按连接的协议版本解析文本帧。不是请求的帧（如被拒绝上传的结束标记）返回 false，被忽略
+func (t transfer) parseRequest(payload []byte) (request, bool) {
+	if t.version < protocol.Version {
+		parts := strings.SplitN(string(payload), " ", 3)
+		if len(parts) < 2 {
+			return request{}, false
+		}
+		req := request{method: parts[0], target: parts[1]}
+		if len(parts) == 3 {
+			req.body = parts[2]
+		}
+		return req, true
+	}
+	if len(payload) == 0 || payload[0] != '{' {
+		return request{}, false
+	}
+	var pr protocol.Request
+	if err := json.Unmarshal(payload, &pr); err != nil {
+		return request{err: fmt.Errorf("bad request frame: %v", err)}, true
+	}
+	if pr.Op == "" || !strings.HasPrefix(pr.Path, "/") {
+		return request{err: errors.New("bad request frame: op and an absolute path are required")}, true
+	}
+	return request{method: pr.Op, target: pr.Target(), body: pr.Body}, true
+}
+
+// statusHeader 按连接的协议版本返回状态头：版本2是 JSON 的 protocol.ResponseHeader，版本1是 statusLine
+func (t transfer) statusHeader(resp *http.Response, size int64) string {
+	if t.version < protocol.Version {
+		return statusLine(resp, size)
+	}
+	b, _ := json.Marshal(protocol.ResponseHeader{
+		Status:    resp.StatusCode,
+		Size:      size,
+		SHA256:    resp.Header.Get(digestHeader),
+		Canonical: resp.Header.Get(canonicalHeader),
+		MTime:     resp.Header.Get(mtimeHeader),
+		Mode:      resp.Header.Get(modeHeader),
+	})
+	return string(b)
+}
+
+// ctxBody 在请求的上下文结束（token吊销）后停止读取本地处理器的正文
+type ctxBody struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (b ctxBody) Read(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// badGateway 是本地处理器没有给出响应时的回复：502 BAD_GATEWAY，正文说明原因。
+// 与普通响应一样有状态头和正文，客户端按错误状态处理，连接可以继续使用
+func badGateway(err error) *http.Response {
+	return apiResponse(http.StatusBadGateway, &APIError{Code: "BAD_GATEWAY", Message: err.Error()})
+}
+
+// badRequest 是无法转发的请求（请求帧或路径无法解析）的回复：400 BAD_REQUEST
+func badRequest(err error) *http.Response {
+	return apiResponse(http.StatusBadRequest, &APIError{Code: "BAD_REQUEST", Message: err.Error()})
+}
+
+// serve 转发一个请求：会话已吊销时回复 401 UNAUTHORIZED，请求帧无法解析时回复 400，
+// token的权限不允许时回复 403，其余交给 proxy。返回 false 表示连接已不可用
+func (s *Server) serve(conn frameConn, sess *session, clientIP string, t transfer, keepAlive bool, req request) bool {
+	ctx, end, live := sess.begin()
+	if !live {
+		// 已吊销：不转发，连接随后被关闭。POST 随后发来的正文帧不是请求头，会被忽略
+		return relayResponse(conn, unauthorized(), t) == nil
+	}
+	defer end()
+	if req.err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "REQUEST", Status: http.StatusBadRequest, Err: req.err.Error()})
+		return relayResponse(conn, badRequest(req.err), t) == nil
+	}
+	// token的权限在转发之前检查，被拒绝的请求不会到达本地处理器；POST 随后的正文帧同样被忽略
+	if rejected := sess.permissions().forbidden(req.method, req.target); rejected != nil {
+		urlPath, _, _ := strings.Cut(req.target, "?")
+		logEvent(logEntry{IP: clientIP, Action: req.method, Path: urlPath, Status: http.StatusForbidden, Err: rejected.Message})
+		s.auditRejected(req.method, req.target, clientIP, sess.token, http.StatusForbidden)
+		return relayResponse(conn, apiResponse(http.StatusForbidden, rejected), t) == nil
+	}
+	return s.proxy(ctx, sess, conn, clientIP, t, keepAlive, req)
+}
+
+// proxy 把一个请求交给本地处理器（见 roundTrip）并把响应写回连接，返回 false 表示连接已不可用
+func (s *Server) proxy(ctx context.Context, sess *session, conn frameConn, clientIP string, t transfer, keepAlive bool, r request) bool {
+	method, path := r.method, r.target
+	var body io.Reader
+	var upload chan error
+	var ub *uploadBody
+
+	// 对于POST请求，需要等待后续的二进制消息作为请求体
+	if method == "POST" && t.stream {
+		// 分块上传：边收边写入本地处理器，直到结束标记
+		pr, pw := io.Pipe()
+		ub = &uploadBody{pr: pr}
+		upload = make(chan error, 1)
+		go func() { upload <- recvUpload(conn, pw, &ub.digest, s.idleTimeout) }()
+		body = ub
+	} else if method == "POST" {
+		// 读取文件数据。旧客户端把整个文件放在一帧里，读完之前收不到其他帧，不按空闲计时
+		conn.SetReadDeadline(time.Time{})
+		_, fileData, err := conn.ReadMessage()
+		if err != nil {
+			// 连接已断开或正文帧超过了读取上限（gorilla 已关闭连接），无法再回复
+			if !s.noteReadLimit(clientIP, err) {
+				logf("upload %s: %v", path, err)
+			}
+			return false
+		}
+		// 使用bytes.NewReader来保持二进制数据完整性
+		body = bytes.NewReader(fileData)
+	} else if r.body != "" {
+		body = strings.NewReader(r.body)
+	}
+	// 没有正文的写操作在本地处理器上对应 POST /_xxx，路径放在登记过的路径参数中
+	switch method {
+	case "MKDIR":
+		method, path = "POST", mkdirTarget(path)
+	case "MOVE":
+		method, path = "POST", moveTarget(path)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, path, body)
+	invalid := err != nil // 请求行中的路径无法构成URL，不是本地处理器的问题
+	if err == nil {
+		req.Header.Set("X-Wsbox-Token", tokenFingerprint(sess.token))
+		if g := sess.permissions(); g.scope != "/" {
+			req.Header.Set(scopeHeader, g.scope)
+		}
+		if ub != nil {
+			ub.req = req
+			req.Trailer = http.Header{digestHeader: nil}
+		}
+	}
+	var resp *http.Response
+	if err == nil {
+		// 等待处理器期间定期发送进度帧，避免长时间操作被中间设备当作空闲连接断开
+		stop := func() {}
+		if keepAlive {
+			stop = emitProgress(conn, req)
+		}
+		resp, err = s.roundTrip(req, clientIP)
+		stop()
+	}
+	if sess.isRevoked() {
+		// 请求已被吊销取消，不再等待剩余的上传块，由 terminate 关闭连接
+		if upload != nil {
+			body.(io.Closer).Close()
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		logf("%s %s: aborted, %s", method, path, protocol.TokenRevokedReason)
+		return false
+	}
+	if upload != nil {
+		// 处理器可能没有读完正文（如拒绝上传），关闭管道让剩余的块被丢弃，
+		// 等读完结束标记后再发送响应
+		body.(io.Closer).Close()
+		if uerr := <-upload; uerr != nil {
+			if !s.noteReadLimit(clientIP, uerr) {
+				logf("upload %s: %v", path, uerr)
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return false
+		}
+	}
+	if err == nil && resp == nil {
+		err = errors.New("local handler returned no response")
+	}
+	if err != nil {
+		// 本地处理器在发出响应头之前失败：仍以完整的状态头和正文回复，客户端能显示原因
+		logf("%s %s: %v", method, path, err)
+		reply := badGateway(err)
+		if invalid {
+			reply = badRequest(err)
+		}
+		return relayResponse(conn, reply, t) == nil
+	}
+	// 统一协议：状态头 + 正文，协商了流控时正文分块发送。吊销取消请求后不再读取正文，剩下的块不再发送
+	resp.Body = ctxBody{ctx, resp.Body}
+	if !t.canonical {
+		// 旧客户端不认识状态头中多出的字段
+		resp.Header.Del(canonicalHeader)
+	}
+	err = relayResponse(conn, resp, t)
+	resp.Body.Close()
+	if err != nil && sess.isRevoked() {
+		logf("%s %s: aborted, %s", method, path, protocol.TokenRevokedReason)
+		return false
+	}
+	var be *bodyError
+	if errors.As(err, &be) {
+		// 还没有发出任何内容，与处理器没有响应时一样回复 502
+		logf("%s %s: %v", method, path, err)
+		return relayResponse(conn, badGateway(err), t) == nil
+	}
+	if err != nil {
+		logf("relay %s %s: %v", method, path, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+// dialRaw 以 testToken 建立网关连接，h 中是额外的请求头（协议版本、流控窗口）
+func dialRaw(t *testing.T, url string, h http.Header) *websocket.Conn {
+	t.Helper()
+	if h == nil {
+		h = http.Header{}
+	}
+	h.Set("Authorization", "Bearer "+testToken)
+	conn, resp, err := websocket.DefaultDialer.Dial(url, h)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readReply 读取一个版本2的响应：JSON 状态头和正文帧（没有流控时一帧；有流控时正文不超过一块，也是一帧）
+func readReply(t *testing.T, conn *websocket.Conn) (protocol.ResponseHeader, []byte, error) {
+	t.Helper()
+	var h protocol.ResponseHeader
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		return h, nil, err
+	}
+	if err := json.Unmarshal(msg, &h); err != nil {
+		t.Fatalf("status header %q: %v", msg, err)
+	}
+	_, body, err := conn.ReadMessage()
+	return h, body, err
+}
+
+// sendRequest 发送一个版本2的请求帧
+func sendRequest(t *testing.T, conn *websocket.Conn, op, path string) {
+	t.Helper()
+	b, _ := json.Marshal(protocol.Request{Op: op, Path: path})
+	if err := conn.WriteMessage(websocket.TextMessage, b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertUsable 检查连接在出错之后还能正常处理下一个请求
+func assertUsable(t *testing.T, conn *websocket.Conn, what string) {
+	t.Helper()
+	sendRequest(t, conn, "GET", "/_caps")
+	if h, _, err := readReply(t, conn); err != nil || h.Status != http.StatusOK {
+		t.Errorf("%s: the next request got %+v, %v; want 200 on the same connection", what, h, err)
+	}
+}
+
+// withTestRoute 在测试期间给 localRoutes 加上一条路由
+func withTestRoute(t *testing.T, path string, h func(s *Server, w http.ResponseWriter, r *http.Request, clientIP string)) {
+	t.Helper()
+	localRoutes["GET "+path] = h
+	t.Cleanup(func() { delete(localRoutes, "GET "+path) })
+}
+
+// 本地处理器没有给出响应（发出响应头之前 panic）或给出的响应不完整时，网关回复 502 和说明原因的 JSON 正文，
+// 而不是断开连接或把不完整的正文当作成功响应
+func TestGatewayBadGateway(t *testing.T) {
+	withTestRoute(t, "/_test/down", func(*Server, http.ResponseWriter, *http.Request, string) {
+		panic("handler is down")
+	})
+	withTestRoute(t, "/_test/short", func(_ *Server, w http.ResponseWriter, _ *http.Request, _ string) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("short"))
+	})
+	withTestRoute(t, "/_test/midway", func(_ *Server, w http.ResponseWriter, _ *http.Request, _ string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"partial":`))
+		panic("crashed mid-response")
+	})
+	_, url := newTestGateway(t, Config{FlowWindow: 4})
+
+	tests := []struct {
+		path    string
+		window  bool
+		message string
+	}{
+		{"/_test/down", false, "local handler panicked: handler is down"},
+		{"/_test/down", true, "local handler panicked: handler is down"},
+		{"/_test/short", false, "local handler response: unexpected EOF"},
+		{"/_test/midway", false, "local handler response: local handler panicked: crashed mid-response"},
+		{"/_test/midway", true, "local handler response: local handler panicked: crashed mid-response"},
+	}
+	for _, tt := range tests {
+		h := http.Header{protocol.VersionHeader: {strconv.Itoa(protocol.Version)}}
+		if tt.window {
+			h.Set(protocol.FlowHeader, "4")
+		}
+		conn := dialRaw(t, url, h)
+		sendRequest(t, conn, "GET", tt.path)
+		rh, body, err := readReply(t, conn)
+		if err != nil {
+			t.Fatalf("%s (window %v): %v", tt.path, tt.window, err)
+		}
+		var e APIError
+		json.Unmarshal(body, &e)
+		if rh.Status != http.StatusBadGateway || rh.Size != int64(len(body)) || e.Code != "BAD_GATEWAY" || e.Message != tt.message {
+			t.Errorf("%s (window %v): got %+v %s, want 502 BAD_GATEWAY %q", tt.path, tt.window, rh, body, tt.message)
+		}
+		assertUsable(t, conn, tt.path)
+	}
+
+	// 有流控且长度已知时状态头已经发出，正文不完整只能断开连接，客户端不会得到完整的成功响应
+	conn := dialRaw(t, url, http.Header{protocol.VersionHeader: {strconv.Itoa(protocol.Version)}, protocol.FlowHeader: {"4"}})
+	sendRequest(t, conn, "GET", "/_test/short")
+	if rh, body, err := readReply(t, conn); err == nil && rh.Status == http.StatusOK && int64(len(body)) == rh.Size {
+		t.Errorf("/_test/short (window true): relayed an incomplete body as %+v %q", rh, body)
+	}
+}
+
+// 无法转发的请求（请求帧不是合法的 JSON、没有绝对路径、版本1请求行中的路径无法解析）回复 400，连接照常可用
+func TestGatewayBadRequest(t *testing.T) {
+	_, url := newTestGateway(t, Config{})
+	v2 := dialRaw(t, url, http.Header{protocol.VersionHeader: {strconv.Itoa(protocol.Version)}})
+	for _, frame := range []string{`{"op":`, `{"op":"GET","path":"relative"}`, `{"op":"","path":"/a"}`} {
+		v2.WriteMessage(websocket.TextMessage, []byte(frame))
+		rh, body, err := readReply(t, v2)
+		if err != nil {
+			t.Fatalf("%s: %v", frame, err)
+		}
+		var e APIError
+		json.Unmarshal(body, &e)
+		if rh.Status != http.StatusBadRequest || e.Code != "BAD_REQUEST" || !strings.HasPrefix(e.Message, "bad request frame") {
+			t.Errorf("%s: got %+v %s, want 400 BAD_REQUEST", frame, rh, body)
+		}
+		assertUsable(t, v2, frame)
+	}
+
+	v1 := dialRaw(t, url, nil)
+	v1.WriteMessage(websocket.TextMessage, []byte("GET /%zz"))
+	_, header, err := v1.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, body, err := v1.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(string(header))
+	var e APIError
+	json.Unmarshal(body, &e)
+	if len(fields) < 2 || fields[0] != "400" || fields[1] != strconv.Itoa(len(body)) || e.Code != "BAD_REQUEST" || !strings.Contains(e.Message, "%zz") {
+		t.Errorf("v1 GET /%%zz: got %q %s, want 400 BAD_REQUEST", header, body)
+	}
+}
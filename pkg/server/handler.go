@@ -0,0 +1,409 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：本地文件处理（带日志） ---------- */
+
+// localRoutes 是以 /_ 开头的接口，键为 "方法 路径"。localHandler 在只读检查、checkPathParams 和别名检查之后按表分发，
+// 表里没有的请求按方法作用于文件本身（下载、上传、解包、追加、删除、加锁）。新接口登记在这里，
+// sandbox_test.go 会对表里的每个接口检查路径参数
+var localRoutes = map[string]func(s *Server, w http.ResponseWriter, r *http.Request, clientIP string){
+	"GET /_caps": func(s *Server, w http.ResponseWriter, r *http.Request, clientIP string) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(protocol.Capabilities{
+			SchemaVersion: protocol.SchemaVersion,
+			ServerTime:    time.Now().UTC(),
+			Features:      s.features(),
+		})
+	},
+	"GET /_caps/metadata": func(s *Server, w http.ResponseWriter, r *http.Request, clientIP string) { s.handleMetadataLimits(w) },
+	"GET /_caps/upload":   func(s *Server, w http.ResponseWriter, r *http.Request, clientIP string) { s.handleUploadLimits(w) },
+	"GET /_locks":         (*Server).listLocks,
+	"GET /_list":          (*Server).handleList,
+	"GET /_latest":        (*Server).handleLatest,
+	"GET /_stat":          (*Server).handleStat,
+	"GET /_tail":          (*Server).handleTail,
+	"GET /_upload_offset": (*Server).handleUploadOffset,
+	"GET /_extents":       (*Server).handleExtents,
+	"GET /_du":            (*Server).handleDu,
+	"GET /_find":          (*Server).handleFind,
+	"GET /_tree":          (*Server).handleTree,
+	"GET /_archive":       (*Server).handleArchive,
+	"GET /_counts":        (*Server).handleCounts,
+	"GET /_activity":      (*Server).handleActivity,
+	"POST /_bench/sink":   (*Server).handleBenchSink,
+	"POST /_mkdir":        (*Server).handleMkdir,
+	"POST /_move":         (*Server).handleMove,
+}
+
+func (s *Server) localHandler(w http.ResponseWriter, r *http.Request) {
+	r = withRequestStart(r)
+	clientIP := r.RemoteAddr
+	path := r.URL.Path
+
+	// 只读模式按白名单放行：GET 和不写入沙箱的测速（/_bench/sink）之外的方法（包括以后新增的写操作）一律拒绝
+	if s.readOnly && writesSandbox(r.Method, path) {
+		logEvent(logEntry{IP: clientIP, Action: r.Method, Path: path, Status: http.StatusForbidden, Duration: elapsedSince(r), Err: "server is read-only"})
+		writeError(w, http.StatusForbidden, &APIError{Code: protocol.ReadOnlyCode, Message: "server is read-only"})
+		return
+	}
+
+	if err := s.checkPathParams(r); err != nil {
+		logEvent(logEntry{IP: clientIP, Action: r.Method, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	if !s.checkAlias(w, r) {
+		return
+	}
+
+	if h, ok := localRoutes[r.Method+" "+path]; ok {
+		h(s, w, r, clientIP)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		// 下载
+		_, real, err := s.resolveSandboxPath(r, "")
+		if err != nil {
+			logEvent(logEntry{IP: clientIP, Action: "DOWNLOAD", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		md, err := requestMetadata(r)
+		if err != nil {
+			rejectMetadata(w, clientIP, "DOWNLOAD", err)
+			return
+		}
+		fi, err := os.Stat(real)
+		if err != nil || fi.IsDir() || isReservedName(fi.Name()) {
+			logEvent(logEntry{IP: clientIP, Action: "DOWNLOAD", Path: path, Status: http.StatusNotFound, Duration: elapsedSince(r), Err: "file not found"})
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		ev := TransferEvent{Path: path, Size: fi.Size(), Identity: r.Header.Get("X-Wsbox-Token"), ClientIP: clientIP, Metadata: md}
+		if status, rejected := runPreHooks(r.Context(), s.hooks.downloadStart, ev); rejected != nil {
+			logEvent(logEntry{IP: clientIP, Action: "DOWNLOAD", Path: path, Status: status, Duration: elapsedSince(r), Err: "rejected: " + rejected.Code})
+			writeError(w, status, rejected)
+			return
+		}
+		setAttrHeaders(w, fi)
+		// 摘要是整个文件的，变换后的内容与文件不同，此时不提供
+		if wantsDigest(r) && len(s.hooks.transformDownload) == 0 {
+			sum, err := s.fileHash(real)
+			if err != nil {
+				logEvent(logEntry{IP: clientIP, Action: "DOWNLOAD", Path: path, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "hash failed: " + err.Error()})
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set(digestHeader, sum)
+		}
+		if r.URL.Query().Has("offset") {
+			logEvent(logEntry{IP: clientIP, Action: "DOWNLOAD", Path: path, Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("range=%s+%s", r.URL.Query().Get("offset"), r.URL.Query().Get("length")) + formatMetadata(md)})
+			if len(s.hooks.transformDownload) > 0 {
+				// 变换可能依赖偏移（如CTR计数器），不支持从中间开始读取
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, &APIError{Code: "BAD_RANGE", Message: "range requests are unavailable for transformed downloads"})
+				return
+			}
+			serveRange(w, r, real, fi.Size())
+			return
+		}
+		logEvent(logEntry{IP: clientIP, Action: "DOWNLOAD", Path: path, Status: http.StatusOK, Bytes: fi.Size(), Duration: elapsedSince(r), Detail: strings.TrimSpace(formatMetadata(md))})
+		w.Header().Set("Content-Disposition", `attachment; filename=`+strconv.Quote(filepath.Base(real)))
+		// 不用 http.ServeFile：它会把以 /index.html 结尾的请求重定向到所在目录
+		f, err := os.Open(real)
+		if err != nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		if len(s.hooks.transformDownload) > 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+			io.Copy(w, applyTransforms(f, s.hooks.transformDownload))
+		} else {
+			http.ServeContent(w, r, filepath.Base(real), fi.ModTime(), f)
+		}
+		s.activity.record("download", path, fi.Size(), ev.Identity)
+
+	case "POST":
+		if r.URL.Query().Has(protocol.ExtractParam) {
+			s.handleExtract(w, r, clientIP)
+			return
+		}
+		if r.URL.Query().Get(protocol.AppendParam) == "1" {
+			s.handleAppend(w, r, clientIP)
+			return
+		}
+		_, real, err := s.resolveSandboxPath(r, "")
+		if err != nil {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		md, err := requestMetadata(r)
+		if err != nil {
+			rejectMetadata(w, clientIP, "UPLOAD", err)
+			return
+		}
+		resume, offset, total, err := resumeParams(r)
+		if err != nil {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: err.Error()})
+			writeError(w, http.StatusBadRequest, &APIError{Code: "BAD_RANGE", Message: err.Error()})
+			return
+		}
+		want, err := expectedDigest(r)
+		if err != nil {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: err.Error()})
+			writeError(w, http.StatusBadRequest, &APIError{Code: "BAD_DIGEST", Message: err.Error()})
+			return
+		}
+		attrs, err := uploadAttrs(r)
+		if err != nil {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: err.Error()})
+			writeError(w, http.StatusBadRequest, &APIError{Code: "BAD_ATTRS", Message: err.Error()})
+			return
+		}
+		if s.maxUpload > 0 {
+			if resume && total > s.maxUpload {
+				logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusRequestEntityTooLarge, Duration: elapsedSince(r), Err: fmt.Sprintf("too large: total=%d", total)})
+				writeError(w, http.StatusRequestEntityTooLarge, s.tooLarge())
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+		}
+		if resume && len(s.hooks.transformUpload) > 0 {
+			// 变换可能依赖偏移（如CTR计数器），不能从中间接着写
+			writeError(w, http.StatusConflict, &APIError{Code: "RESUME_UNAVAILABLE", Message: "resumable uploads are unavailable for transformed uploads"})
+			return
+		}
+
+		if isReservedName(filepath.Base(real)) {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "reserved name"})
+			http.Error(w, "reserved file name", http.StatusBadRequest)
+			return
+		}
+		if rejected := s.checkNewPath(real, false); rejected != nil {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusUnprocessableEntity, Duration: elapsedSince(r), Err: rejected.Message})
+			writeError(w, http.StatusUnprocessableEntity, rejected)
+			return
+		}
+
+		// 目标原本不存在时上传成功后父目录多一个条目（新建的上级目录由 createDirs 计入）
+		_, statErr := os.Lstat(real)
+		isNew := os.IsNotExist(statErr)
+		// 不允许覆盖时在接收正文之前先拒绝一次；提交时还会在 commitMu 下再检查，防止并发上传
+		force := forceOverwrite(r)
+		if !isNew && s.overwrite == OverwriteDeny && !force {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusConflict, Duration: elapsedSince(r), Err: "rejected: exists"})
+			writeError(w, http.StatusConflict, fileExists(path))
+			return
+		}
+
+		// 安全检查：验证目录创建的安全性
+		if _, err := s.createDirs(filepath.Dir(real)); err != nil {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "secure mkdir failed: " + err.Error()})
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if rejected := s.checkCaseCollision(real, path, clientIP); rejected != nil {
+			writeError(w, http.StatusConflict, rejected)
+			return
+		}
+
+		// 有效的锁标记不允许被上传覆盖，过期的锁随覆盖一起失效
+		s.lockMu.Lock()
+		if l := activeLock(real); l != nil {
+			s.lockMu.Unlock()
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusLocked, Duration: elapsedSince(r), Err: "locked by " + l.Holder})
+			http.Error(w, "path is locked by "+l.Holder, http.StatusLocked)
+			return
+		}
+		os.Remove(lockMetaPath(real))
+		s.lockMu.Unlock()
+
+		// 正文先写入同目录的暂存文件，完整收到、落盘并通过校验和提交前钩子（如内容扫描）后再重命名到目标路径：
+		// 其他读者不会看到写了一半的文件，中断、校验失败或超过限制也不会破坏已有的文件。
+		// 续传时写入部分上传文件，完整后同样经过提交前钩子再重命名
+		var f *os.File
+		if resume {
+			var rejected *APIError
+			if f, rejected = openPartial(real, offset); rejected != nil {
+				logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusConflict, Duration: elapsedSince(r), Err: "resume rejected: " + rejected.Message})
+				writeError(w, http.StatusConflict, rejected)
+				return
+			}
+		} else {
+			f, err = os.CreateTemp(filepath.Dir(real), "."+filepath.Base(real)+tempMarker+"*")
+			if err == nil {
+				f.Chmod(0644) // CreateTemp 默认0600，与直接创建保持一致
+			}
+		}
+		if err != nil {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "create file failed: " + err.Error()})
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var dst io.Writer = f
+		h := sha256.New()
+		if s.hooks.needsHash() && !resume {
+			dst = io.MultiWriter(f, h)
+		}
+		// 声明的摘要针对客户端发送的内容，在上传变换之前计算
+		var body io.Reader = r.Body
+		raw := sha256.New()
+		if want != "" && !resume {
+			body = io.TeeReader(r.Body, raw)
+		}
+		n, err := io.Copy(dst, applyTransforms(body, s.hooks.transformUpload))
+		if err == nil {
+			// 重命名之前落盘，崩溃后目标路径上不会出现内容不完整的文件
+			err = f.Sync()
+		}
+		f.Close()
+		if err != nil {
+			// 分块上传中断时不保留写了一半的文件；续传时保留已写入的部分，客户端重新连接后接着发送
+			if !resume {
+				os.Remove(f.Name())
+			}
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusRequestEntityTooLarge, Bytes: n, Duration: elapsedSince(r), Err: fmt.Sprintf("too large: limit=%d", s.maxUpload)})
+				writeError(w, http.StatusRequestEntityTooLarge, s.tooLarge())
+				return
+			}
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusInternalServerError, Bytes: n, Duration: elapsedSince(r), Err: "write body failed: " + err.Error()})
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if resume {
+			switch size := offset + n; {
+			case size < total:
+				logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusAccepted, Bytes: n, Duration: elapsedSince(r), Detail: fmt.Sprintf("partial=%d/%d", size, total)})
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(protocol.UploadOffset{SchemaVersion: protocol.SchemaVersion, Path: path, Offset: size})
+				return
+			case size > total:
+				os.Remove(f.Name())
+				logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusConflict, Bytes: n, Duration: elapsedSince(r), Err: fmt.Sprintf("size mismatch: %d > %d", size, total)})
+				writeError(w, http.StatusConflict, &APIError{Code: "SIZE_MISMATCH", Message: fmt.Sprintf("received %d bytes but the upload was declared as %d", size, total)})
+				return
+			}
+			n = total
+		}
+		if want == protocol.DigestTrailer {
+			if want = trailerDigest(r); want == "" {
+				os.Remove(f.Name())
+				logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusBadRequest, Bytes: n, Duration: elapsedSince(r), Err: "missing trailing digest"})
+				writeError(w, http.StatusBadRequest, &APIError{Code: "BAD_DIGEST", Message: "the upload declared a trailing SHA-256 but its end marker carried none"})
+				return
+			}
+		}
+		ev := TransferEvent{Path: path, Size: n, Identity: r.Header.Get("X-Wsbox-Token"), ClientIP: clientIP, Metadata: md}
+		if s.hooks.needsHash() || (want != "" && resume) {
+			if resume {
+				if ev.Hash, err = hashFile(f.Name()); err != nil {
+					logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusInternalServerError, Bytes: n, Duration: elapsedSince(r), Err: "hash failed: " + err.Error()})
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			} else {
+				ev.Hash = hex.EncodeToString(h.Sum(nil))
+			}
+		}
+		if want != "" {
+			// 续传不支持上传变换，部分上传文件的摘要就是收到的内容的摘要
+			got := ev.Hash
+			if !resume {
+				got = hex.EncodeToString(raw.Sum(nil))
+			}
+			if got != want {
+				// 续传的部分上传同样删除：内容已经不可信，只能从头再来
+				os.Remove(f.Name())
+				logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusUnprocessableEntity, Bytes: n, Duration: elapsedSince(r), Err: fmt.Sprintf("digest mismatch: got %s, expected %s", got, want)})
+				writeError(w, http.StatusUnprocessableEntity, digestMismatch(want, got))
+				return
+			}
+		}
+		ev.Staged = f.Name()
+		if status, rejected := runPreHooks(r.Context(), s.hooks.uploadStaged, ev); rejected != nil {
+			os.Remove(f.Name())
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: status, Bytes: n, Duration: elapsedSince(r), Err: "rejected: " + rejected.Code})
+			writeError(w, status, rejected)
+			return
+		}
+		ev.Staged = ""
+		if err := attrs.apply(f.Name()); err != nil {
+			os.Remove(f.Name())
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusInternalServerError, Bytes: n, Duration: elapsedSince(r), Err: err.Error()})
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		staged, _ := os.Stat(f.Name())
+		backup, rejected, err := s.commitUpload(f.Name(), real, path, force)
+		if rejected != nil || err != nil {
+			os.Remove(f.Name())
+		}
+		if rejected != nil {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusConflict, Bytes: n, Duration: elapsedSince(r), Err: "rejected: exists"})
+			writeError(w, http.StatusConflict, rejected)
+			return
+		}
+		if err != nil {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusInternalServerError, Bytes: n, Duration: elapsedSince(r), Err: "rename failed: " + err.Error()})
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if backup != "" {
+			logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Detail: "previous version kept as " + filepath.Base(backup)})
+			s.noteCreated(backup)
+		}
+		if !resume {
+			// 普通上传覆盖了目标，之前中断的续传不再有意义
+			os.Remove(partialPath(real))
+		}
+		// 已经算过或核对过内容的摘要时记下，之后的 stat -hash 和校验下载不必再读取文件
+		if ev.Hash != "" {
+			s.noteHash(real, staged, ev.Hash)
+		} else if want != "" && len(s.hooks.transformUpload) == 0 {
+			s.noteHash(real, staged, want)
+		}
+		if isNew {
+			s.noteCreated(real)
+		}
+		logEvent(logEntry{IP: clientIP, Action: "UPLOAD", Path: path, Status: http.StatusCreated, Bytes: n, Duration: elapsedSince(r), Detail: strings.TrimSpace(formatMetadata(md))})
+		runPostHooks(r.Context(), s.hooks.uploadComplete, ev, "UPLOAD")
+		s.activity.record("upload", path, n, ev.Identity)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintln(w, "ok")
+
+	case "DELETE":
+		s.handleDelete(w, r, clientIP)
+
+	case "LOCK":
+		s.acquireLock(w, r, clientIP)
+
+	case "UNLOCK":
+		s.releaseLock(w, r, clientIP)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
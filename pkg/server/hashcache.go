@@ -0,0 +1,132 @@
+package server
+
+import (
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"wsbox/internal/journal"
+)
+
+/* ---------- 服务端：文件摘要缓存 ---------- */
+
+// /_stat?hash=1 和带 digest=sha256 的下载要读完整个文件计算 SHA-256。sync -checksum、add -if-changed 这类
+// 每次运行都核对同一批文件的客户端会让大文件被反复读取，因此摘要按路径缓存，连同计算时文件的大小、修改时间和
+// 身份（设备和 inode，见 fileID）：三者任一变化即失效，经过暂存文件重命名的上传总是换了身份。
+// 服务端自己的写入（上传、追加、移动、删除、解包）另外显式清除对应的条目，保留修改时间的上传即使大小和时间
+// 恰好相同也不会命中旧值。绕过服务端、原地改写又恢复了修改时间的外部修改无法发现。
+// 条目保存在状态存储的 hashes 命名空间中，设置了 -state-dir 时重启之后仍然有效
+
+// hashNamespace 是状态存储中摘要缓存的命名空间，键是沙箱内路径（"/a/b.bin"）
+const hashNamespace = "hashes"
+
+// hashCacheSize 是缓存的条目数上限，满了之后随机淘汰
+const hashCacheSize = 10000
+
+// hashEntry 是一个文件在某个版本下的摘要
+type hashEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	ID      string    `json:"id,omitempty"`
+	Sum     string    `json:"sha256"`
+}
+
+func (e *hashEntry) matches(fi os.FileInfo) bool {
+	return e.Size == fi.Size() && e.ModTime.Equal(fi.ModTime()) && e.ID == fileID(fi)
+}
+
+// hashCache 是按沙箱内路径缓存的文件摘要，在 openState 之后可用
+type hashCache struct {
+	st   *journal.Store
+	root string // 沙箱根目录的绝对路径
+}
+
+// get 返回 real 在 fi 状态下的摘要，没有或已失效时 ok 为 false
+func (c *hashCache) get(real string, fi os.FileInfo) (string, bool) {
+	var e hashEntry
+	if ok, err := c.st.Get(hashNamespace, sandboxKey(c.root, real), &e); !ok || err != nil || !e.matches(fi) {
+		return "", false
+	}
+	return e.Sum, true
+}
+
+// put 记下 real 在 fi 状态下的摘要。写入状态存储失败只是少缓存一个摘要，不影响请求
+func (c *hashCache) put(real string, fi os.FileInfo, sum string) {
+	key := sandboxKey(c.root, real)
+	var evict string
+	if c.st.Len(hashNamespace) >= hashCacheSize {
+		keys := c.st.Keys(hashNamespace)
+		evict = keys[rand.Intn(len(keys))]
+	}
+	err := c.st.Update(func(tx *journal.Tx) error {
+		if evict != "" && evict != key {
+			tx.Delete(hashNamespace, evict)
+		}
+		return tx.Put(hashNamespace, key, hashEntry{Size: fi.Size(), ModTime: fi.ModTime(), ID: fileID(fi), Sum: sum})
+	})
+	if err != nil {
+		logf("hash cache: %v", err)
+	}
+}
+
+// forget 清除 real 以及（real 是目录时）其下所有文件的条目
+func (c *hashCache) forget(real string) {
+	key := sandboxKey(c.root, real)
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	// 键是排好序的，key 和它下面的路径从 key 开始连续排列（"/a"、"/a.txt"、"/a/b" 中间可能夹着别的名字）
+	keys := c.st.Keys(hashNamespace)
+	var drop []string
+	for i := sort.SearchStrings(keys, key); i < len(keys) && strings.HasPrefix(keys[i], key); i++ {
+		if keys[i] == key || strings.HasPrefix(keys[i], prefix) {
+			drop = append(drop, keys[i])
+		}
+	}
+	if len(drop) == 0 {
+		return
+	}
+	err := c.st.Update(func(tx *journal.Tx) error {
+		for _, k := range drop {
+			tx.Delete(hashNamespace, k)
+		}
+		return nil
+	})
+	if err != nil {
+		logf("hash cache: %v", err)
+	}
+}
+
+// sameVersion 判断两次 stat 看到的是否是同一个文件的同一个版本
+func sameVersion(a, b os.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime()) && os.SameFile(a, b)
+}
+
+// fileHash 返回文件 real 的 SHA-256，缓存中有当前版本的摘要时不读取文件。
+// 计算期间文件被修改时结果照常返回，但不缓存
+func (s *Server) fileHash(real string) (string, error) {
+	fi, err := os.Stat(real)
+	if err != nil {
+		return "", err
+	}
+	if sum, ok := s.hashes.get(real, fi); ok {
+		return sum, nil
+	}
+	sum, err := hashFile(real)
+	if err != nil {
+		return "", err
+	}
+	// 刚修改过的文件可能在同一个时间戳内再次被改写（修改时间精度较粗的文件系统），暂不缓存
+	if after, err := os.Stat(real); err == nil && sameVersion(fi, after) && time.Since(fi.ModTime()) > time.Second {
+		s.hashes.put(real, fi, sum)
+	}
+	return sum, nil
+}
+
+// noteHash 在上传提交后记下已知的内容摘要，下次核对时不必再读取文件。staged 是提交前暂存文件的 stat：
+// 重命名不改变文件的身份，提交之后又被别的上传替换时条目自然失效
+func (s *Server) noteHash(real string, staged os.FileInfo, sum string) {
+	if staged != nil && sum != "" {
+		s.hashes.put(real, staged, sum)
+	}
+}
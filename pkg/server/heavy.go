@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：重操作限流 ---------- */
+
+// 遍历目录树（/_latest、/_locks、/_du、/_find、/_tree、/_archive、递归删除）这类操作会占满磁盘IO，同时来上几个就会拖慢普通的上传下载。
+// 它们共用一个服务端范围的加权信号量（-heavy-ops），超出的请求排队（最多 -heavy-queue 个），
+// 队列也满时以 429 SERVER_BUSY 和 Retry-After 拒绝。单个文件的上传下载不经过限流
+
+// 各类重操作占用的配额
+const (
+	weightWalk   = 1 // 只读的遍历
+	weightDelete = 2 // 递归删除：遍历之后还要逐个删除，写入元数据
+)
+
+// heavyRetryAfter 是队列已满时建议客户端等待的时间
+const heavyRetryAfter = 5 * time.Second
+
+var errHeavyQueueFull = errors.New("heavy operation queue is full")
+
+// heavyLimiter 是按先来先服务排队的加权信号量。capacity 为0时不限流
+type heavyLimiter struct {
+	mu       sync.Mutex
+	capacity int64
+	used     int64
+	maxQueue int
+	queue    []*heavyWaiter
+}
+
+type heavyWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+func newHeavyLimiter(capacity, maxQueue int) *heavyLimiter {
+	return &heavyLimiter{capacity: int64(max(capacity, 0)), maxQueue: max(maxQueue, 0)}
+}
+
+// acquire 取得 n 个配额，返回排队等待的时间。n 超过容量时按容量计，避免永远等不到。
+// 队列已满时返回 errHeavyQueueFull，ctx 结束时放弃排队并返回 ctx 的错误
+func (l *heavyLimiter) acquire(ctx context.Context, n int64) (time.Duration, error) {
+	if l.capacity == 0 {
+		return 0, nil
+	}
+	n = min(n, l.capacity)
+	l.mu.Lock()
+	if len(l.queue) == 0 && l.used+n <= l.capacity {
+		l.used += n
+		l.mu.Unlock()
+		return 0, nil
+	}
+	if len(l.queue) >= l.maxQueue {
+		l.mu.Unlock()
+		return 0, errHeavyQueueFull
+	}
+	w := &heavyWaiter{n: n, ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	l.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-w.ready:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.ready:
+			// 放弃的同时轮到了它，配额已经记在 used 上，交给后面的请求
+			l.used -= n
+			l.grant()
+		default:
+			for i, q := range l.queue {
+				if q == w {
+					l.queue = append(l.queue[:i], l.queue[i+1:]...)
+					break
+				}
+			}
+			// 队首离开后，后面较小的请求可能已经放得下
+			l.grant()
+		}
+		return time.Since(start), ctx.Err()
+	}
+}
+
+// tryAcquire 在不需要排队时取得 n 个配额，供后台任务在空闲时使用
+func (l *heavyLimiter) tryAcquire(n int64) bool {
+	if l.capacity == 0 {
+		return true
+	}
+	n = min(n, l.capacity)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) > 0 || l.used+n > l.capacity {
+		return false
+	}
+	l.used += n
+	return true
+}
+
+func (l *heavyLimiter) release(n int64) {
+	if l.capacity == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used -= min(n, l.capacity)
+	l.grant()
+}
+
+// grant 按顺序唤醒放得下的排队者，队首放不下时后面的也不越过它，避免大请求饿死。调用时持有 mu
+func (l *heavyLimiter) grant() {
+	for len(l.queue) > 0 && l.used+l.queue[0].n <= l.capacity {
+		w := l.queue[0]
+		l.queue = l.queue[1:]
+		l.used += w.n
+		close(w.ready)
+	}
+}
+
+// heavy 在执行重操作之前取得配额，排队期间进度帧的阶段为 queued，客户端不会因等待而超时。
+// 队列已满或请求被取消时写好错误响应并返回 ok 为 false；ok 时调用方在操作结束后调用 release
+func (s *Server) heavy(w http.ResponseWriter, r *http.Request, clientIP, action string, n int64) (release func(), wait time.Duration, ok bool) {
+	track(r).begin("queued")
+	wait, err := s.heavyOps.acquire(r.Context(), n)
+	switch {
+	case errors.Is(err, errHeavyQueueFull):
+		logEvent(logEntry{IP: clientIP, Action: action, Status: http.StatusTooManyRequests, Duration: elapsedSince(r), Err: "heavy operation queue is full"})
+		w.Header().Set("Retry-After", strconv.Itoa(int(heavyRetryAfter.Seconds())))
+		writeError(w, http.StatusTooManyRequests, &APIError{Code: protocol.BusyCode,
+			Message: fmt.Sprintf("the server is busy with other directory walks and its queue is full, retry after %s", heavyRetryAfter)})
+		return nil, wait, false
+	case err != nil:
+		logEvent(logEntry{IP: clientIP, Action: action, Status: http.StatusServiceUnavailable, Duration: elapsedSince(r), Err: "gave up while queued: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil, wait, false
+	}
+	if wait > 0 {
+		logEvent(logEntry{IP: clientIP, Action: action, Detail: "queued=" + wait.Round(time.Millisecond).String()})
+	}
+	return func() { s.heavyOps.release(n) }, wait, true
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+/* ---------- 传输钩子 ---------- */
+
+// 钩子在固定的位置调用：
+//
+//	TransformUpload     写入磁盘之前，依次包装请求正文
+//	OnUploadStaged      正文已完整写入同目录的暂存文件、尚未重命名到目标路径；返回错误即拒绝上传
+//	OnUploadComplete    原子重命名之后；尽力而为，失败只记录日志
+//	OnDownloadStart     发送第一个字节之前；返回错误即拒绝下载
+//	OnDelete            删除文件或目录之后；尽力而为，失败只记录日志
+//	TransformDownload   读取磁盘之后，依次包装文件内容
+//
+// 内置的内容扫描（Config.ScanCommand、Config.ScanClamd）就是一个 OnUploadStaged 钩子。
+// 钩子应在 ListenAndServe 之前注册
+
+// TransferEvent 是传给钩子的事件
+type TransferEvent struct {
+	Path     string // 沙箱内的路径，如 /docs/a.txt
+	Size     int64  // 上传为写入磁盘的字节数，下载为文件大小，删除为0
+	Hash     string // 上传内容（变换之后）的 SHA-256 十六进制；下载开始时为空
+	Identity string // 客户端token的指纹
+	ClientIP string
+	Staged   string // 仅 OnUploadStaged：暂存文件的路径，钩子可以读取它检查内容
+
+	// Metadata 是客户端随请求附带的键值（client -header key=value），已按 protocol.DefaultMetadataLimits 校验；
+	// wsbox 不解释它们，没有时为 nil
+	Metadata map[string]string
+}
+
+// HookFunc 是检查或通知类钩子，在处理请求的协程中同步调用
+type HookFunc func(ctx context.Context, ev TransferEvent) error
+
+// TransformFunc 包装传输内容。下载变换必须保持长度不变（例如 CTR 模式加解密），
+// 网关按磁盘上的文件大小告知客户端正文长度
+type TransformFunc func(io.Reader) io.Reader
+
+type hooks struct {
+	uploadStaged      []HookFunc
+	uploadComplete    []HookFunc
+	downloadStart     []HookFunc
+	deleted           []HookFunc
+	transformUpload   []TransformFunc
+	transformDownload []TransformFunc
+}
+
+// OnUploadStaged 注册上传提交前的检查，返回错误时上传被拒绝，暂存文件被删除
+func (s *Server) OnUploadStaged(fn HookFunc) {
+	s.hooks.uploadStaged = append(s.hooks.uploadStaged, fn)
+}
+
+// OnUploadComplete 注册上传完成后的通知（如 webhook），错误只记录日志
+func (s *Server) OnUploadComplete(fn HookFunc) {
+	s.hooks.uploadComplete = append(s.hooks.uploadComplete, fn)
+}
+
+// OnDownloadStart 注册下载开始前的检查，返回错误时下载被拒绝
+func (s *Server) OnDownloadStart(fn HookFunc) {
+	s.hooks.downloadStart = append(s.hooks.downloadStart, fn)
+}
+
+// OnDelete 注册删除之后的通知，目录的递归删除只通知一次，错误只记录日志
+func (s *Server) OnDelete(fn HookFunc) {
+	s.hooks.deleted = append(s.hooks.deleted, fn)
+}
+
+// TransformUpload 注册上传内容的变换，按注册顺序包装
+func (s *Server) TransformUpload(fn TransformFunc) {
+	s.hooks.transformUpload = append(s.hooks.transformUpload, fn)
+}
+
+// TransformDownload 注册下载内容的变换，按注册顺序包装
+func (s *Server) TransformDownload(fn TransformFunc) {
+	s.hooks.transformDownload = append(s.hooks.transformDownload, fn)
+}
+
+// HookRejection 让钩子指定拒绝时的状态码和结构化错误，其他错误按 403 HOOK_REJECTED 返回
+type HookRejection struct {
+	Status int
+	Err    *APIError
+}
+
+func (e *HookRejection) Error() string { return e.Err.Code + ": " + e.Err.Message }
+
+// runPreHooks 依次运行检查类钩子，第一个错误即停止，返回应写给客户端的状态码和错误
+func runPreHooks(ctx context.Context, fns []HookFunc, ev TransferEvent) (int, *APIError) {
+	for _, fn := range fns {
+		err := fn(ctx, ev)
+		if err == nil {
+			continue
+		}
+		var rej *HookRejection
+		if errors.As(err, &rej) {
+			return rej.Status, rej.Err
+		}
+		return http.StatusForbidden, &APIError{Code: "HOOK_REJECTED", Message: err.Error()}
+	}
+	return 0, nil
+}
+
+// runPostHooks 运行通知类钩子，全部执行，失败只记录日志
+func runPostHooks(ctx context.Context, fns []HookFunc, ev TransferEvent, event string) {
+	for i, fn := range fns {
+		if err := fn(ctx, ev); err != nil {
+			logEvent(logEntry{IP: ev.ClientIP, Action: event, Path: ev.Path, Detail: fmt.Sprintf("hook #%d", i+1), Err: err.Error()})
+		}
+	}
+}
+
+func applyTransforms(r io.Reader, fns []TransformFunc) io.Reader {
+	for _, fn := range fns {
+		r = fn(r)
+	}
+	return r
+}
+
+// needsHash 报告上传时是否需要计算内容哈希，没有钩子关心事件时省去这部分开销
+func (h *hooks) needsHash() bool {
+	return len(h.uploadStaged) > 0 || len(h.uploadComplete) > 0
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"wsbox/pkg/client"
+)
+
+// 上传完成后通知：钩子拿到沙箱内的路径、写入的字节数和内容的 SHA-256
+func ExampleServer_OnUploadComplete() {
+	dir, err := os.MkdirTemp("", "wsbox-example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// 访问日志默认写到标准输出，这里丢弃
+	SetLogFile(os.DevNull)
+	defer SetLogFile("")
+
+	s, err := New(Config{Dir: dir, Token: "secret"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.OnUploadComplete(func(ctx context.Context, ev TransferEvent) error {
+		fmt.Printf("stored %s: %d bytes, sha256 %.12s\n", ev.Path, ev.Size, ev.Hash)
+		return nil
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	go s.Serve(ln)
+	defer s.Shutdown(context.Background())
+
+	cl, err := client.Dial("ws://"+ln.Addr().String()+"/ws", "secret")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cl.Close()
+	if _, err := cl.Upload("/reports/q3.txt", strings.NewReader("hello")); err != nil {
+		log.Fatal(err)
+	}
+	// Output: stored /reports/q3.txt: 5 bytes, sha256 2cf24dba5fb0
+}
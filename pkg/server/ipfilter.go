@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+/* ---------- 服务端：来源地址过滤 ---------- */
+
+// Config.AllowCIDR 和 Config.DenyCIDR 在token之外再按网络地址限制网关：每个请求（/ws 的升级、HTTP 接口、浏览器界面、
+// 网关上的 /metrics）在检查 Authorization 之前先检查来源地址。拒绝列表优先；允许列表非空时只接受其中的地址。
+// 被拒绝的请求以 403 ADDRESS_NOT_ALLOWED 回复并记录来源地址，不计入 -auth-fail-limit。
+//
+// 服务端在反向代理后面时，Config.TrustProxyHeader 让有效的客户端地址取自代理写入的 X-Forwarded-For（最右一项，
+// 即代理看到的地址）或 X-Real-IP。有效地址替换请求的 RemoteAddr，地址过滤、认证失败锁定、日志、钩子和审计日志都使用它。
+// 只应在网关只能经由代理访问时打开，否则客户端可以自己填写这些头
+
+// ipFilter 是解析后的允许和拒绝列表，nil 表示不过滤
+type ipFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// newIPFilter 解析 CIDR 列表，单个地址视为 /32 或 /128；两个列表都为空时返回 nil
+func newIPFilter(allow, deny []string) (*ipFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	f := &ipFilter{}
+	var err error
+	if f.allow, err = parsePrefixes("-allow-cidr", allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parsePrefixes("-deny-cidr", deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parsePrefixes(flagName string, list []string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not an address or CIDR such as 10.0.0.0/8", flagName, v)
+			}
+			out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not an address or CIDR such as 10.0.0.0/8", flagName, v)
+		}
+		if p.Addr().Is4In6() {
+			p = netip.PrefixFrom(p.Addr().Unmap(), max(p.Bits()-96, 0))
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+// allows 判断地址是否被接受：不在拒绝列表中，且允许列表为空或包含它。无法解析的地址只在没有允许列表时接受
+func (f *ipFilter) allows(addr string) bool {
+	if f == nil {
+		return true
+	}
+	ip, err := netip.ParseAddr(hostOnly(addr))
+	if err != nil {
+		return len(f.allow) == 0
+	}
+	ip = ip.Unmap().WithZone("")
+	for _, p := range f.deny {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedAddr 返回代理写入的客户端地址，没有或无法解析时返回空串
+func forwardedAddr(r *http.Request) string {
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		// 左边的项可能是客户端自己填的，只有代理追加的最后一项可信
+		parts := strings.Split(xff[len(xff)-1], ",")
+		if ip, err := netip.ParseAddr(strings.TrimSpace(parts[len(parts)-1])); err == nil {
+			return ip.Unmap().String()
+		}
+	}
+	if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return ip.Unmap().String()
+	}
+	return ""
+}
+
+// withClientAddr 把请求的 RemoteAddr 换成有效的客户端地址，再按地址过滤，包在整个网关的最外层
+func (s *Server) withClientAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 经过 Unix 域套接字的连接没有对端地址，也不按地址过滤，除非代理头给出了真实的地址
+		unix := viaUnix(r)
+		if unix {
+			r.RemoteAddr = unixPeer
+		}
+		if s.trustProxy {
+			if addr := forwardedAddr(r); addr != "" {
+				r.RemoteAddr = addr
+				unix = false
+			}
+		}
+		if !unix && !s.ipFilter.allows(r.RemoteAddr) {
+			logEvent(logEntry{IP: r.RemoteAddr, Action: "ADDRESS", Path: r.URL.Path, Status: http.StatusForbidden, Err: "address not allowed"})
+			writeError(w, http.StatusForbidden, &APIError{Code: "ADDRESS_NOT_ALLOWED", Message: "this address is not allowed to use the gateway"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
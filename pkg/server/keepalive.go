@@ -0,0 +1,69 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+/* ---------- 网关：连接保活与空闲回收 ---------- */
+
+// 网关每隔 -ping-interval 向客户端发送 Ping，让中间的代理看到流量；等待下一个请求时读超时为 -idle-timeout，
+// 期间收到的任何帧（请求、上传块、Pong、客户端的 Ping）都会顺延。对端静默（如半开的TCP连接）时读取超时，
+// 连接被关闭，不再留下永远阻塞的协程。请求处理期间网关不读取连接，不算空闲
+
+// pingWriteWait 是写出一个 Ping 或 Pong 控制帧的时限
+const pingWriteWait = 10 * time.Second
+
+// extendRead 把读超时顺延 idle，idle 为0时不设超时
+func extendRead(conn frameConn, idle time.Duration) {
+	if idle > 0 {
+		conn.SetReadDeadline(time.Now().Add(idle))
+	}
+}
+
+// heartbeat 为一条网关连接安装 Ping/Pong 处理并开始定期发送 Ping，返回的函数停止发送
+func (s *Server) heartbeat(conn *websocket.Conn) (stop func()) {
+	conn.SetPongHandler(func(string) error {
+		extendRead(conn, s.idleTimeout)
+		return nil
+	})
+	conn.SetPingHandler(func(data string) error {
+		extendRead(conn, s.idleTimeout)
+		// 与 gorilla 默认的处理相同：回复 Pong，连接正在关闭或写超时不算错误
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(pingWriteWait))
+		var ne net.Error
+		if errors.Is(err, websocket.ErrCloseSent) || errors.As(err, &ne) && ne.Timeout() {
+			return nil
+		}
+		return err
+	})
+	if s.pingInterval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(s.pingInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				// WriteControl 可以与请求的写入并发进行
+				if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingWriteWait)) != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// isIdleTimeout 判断读取错误是否是 -idle-timeout 到期
+func isIdleTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
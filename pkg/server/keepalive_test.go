@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+	"wsbox/pkg/client"
+)
+
+// 对端静默（不回复 Pong、不发送任何帧）时，网关在 -idle-timeout 之后关闭连接，而不是一直等下去
+func TestIdleTimeoutSilentPeer(t *testing.T) {
+	const idle = 300 * time.Millisecond
+	_, url := newTestGateway(t, Config{PingInterval: 50 * time.Millisecond, IdleTimeout: idle})
+	conn := dialRaw(t, url, nil)
+	// 收到 Ping 不回复，像半开的连接一样
+	pings := 0
+	conn.SetPingHandler(func(string) error { pings++; return nil })
+
+	start := time.Now()
+	conn.SetReadDeadline(start.Add(idle + 3*time.Second))
+	_, _, err := conn.ReadMessage()
+	elapsed := time.Since(start)
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		t.Fatalf("the gateway kept a silent connection open for %v", elapsed)
+	}
+	if elapsed < idle {
+		t.Errorf("connection closed after %v, before the idle timeout %v: %v", elapsed, idle, err)
+	}
+	if pings == 0 {
+		t.Errorf("no Ping was sent before the connection was closed")
+	}
+}
+
+// 回复 Pong 的对端即使长时间不发请求也不会被关闭，之后的请求照常处理
+func TestIdleTimeoutPongKeepsAlive(t *testing.T) {
+	const idle = 300 * time.Millisecond
+	_, url := newTestGateway(t, Config{PingInterval: 50 * time.Millisecond, IdleTimeout: idle})
+	conn := dialRaw(t, url, http.Header{protocol.VersionHeader: {strconv.Itoa(protocol.Version)}})
+
+	// 默认的 Ping 处理会回复 Pong，控制帧只在读取时处理，所以一直读着
+	type frame struct {
+		msg []byte
+		err error
+	}
+	frames := make(chan frame, 4)
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			frames <- frame{msg, err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case f := <-frames:
+		t.Fatalf("idle connection answering Pings got %q, %v", f.msg, f.err)
+	case <-time.After(3 * idle):
+	}
+	sendRequest(t, conn, "GET", "/_caps")
+	for i := 0; i < 2; i++ {
+		select {
+		case f := <-frames:
+			if f.err != nil {
+				t.Fatalf("request after idling: %v", f.err)
+			}
+			if i == 0 && !strings.Contains(string(f.msg), `"status":200`) {
+				t.Errorf("request after idling got %s", f.msg)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("no reply to a request after idling")
+		}
+	}
+}
+
+// 完成升级后既不读也不写的TCP连接同样在空闲超时后被回收，连接数回落
+func TestIdleTimeoutHalfOpen(t *testing.T) {
+	const idle = 300 * time.Millisecond
+	_, url := newTestGateway(t, Config{PingInterval: 50 * time.Millisecond, IdleTimeout: idle})
+	metricsURL := "http" + strings.TrimSuffix(strings.TrimPrefix(url, "ws"), "/ws") + "/metrics"
+	before, _ := scrape(t, metricsURL, testToken)
+
+	// 用 NetDial 拿到底层连接，升级之后不再从它读取任何东西
+	var raw net.Conn
+	d := *websocket.DefaultDialer
+	d.NetDial = func(network, addr string) (net.Conn, error) {
+		c, err := net.Dial(network, addr)
+		raw = c
+		return c, err
+	}
+	conn, resp, err := d.Dial(url, http.Header{"Authorization": {"Bearer " + testToken}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	defer conn.Close()
+
+	if now, _ := scrape(t, metricsURL, testToken); now["wsbox_connections"] != before["wsbox_connections"]+1 {
+		t.Fatalf("wsbox_connections = %v after connecting, want %v", now["wsbox_connections"], before["wsbox_connections"]+1)
+	}
+	deadline := time.Now().Add(idle + 3*time.Second)
+	for {
+		now, _ := scrape(t, metricsURL, testToken)
+		if now["wsbox_connections"] == before["wsbox_connections"] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the idle connection was not reaped: wsbox_connections = %v", now["wsbox_connections"])
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// 网关已经关闭了它那一端
+	raw.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 4096)
+	for {
+		if _, err := raw.Read(buf); err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				t.Errorf("the gateway did not close its end of the connection")
+			}
+			break
+		}
+	}
+}
+
+// countingProgress 记录收到的进度帧
+type countingProgress struct{ shown atomic.Int32 }
+
+func (p *countingProgress) Show(string, int64) { p.shown.Add(1) }
+func (p *countingProgress) Clear()             {}
+
+// 遍历比客户端的响应超时和网关的空闲超时都长：协商了进度帧时，进度帧让连接一直保持到响应返回；
+// 不协商时同样的请求在响应超时后失败
+func TestProgressFramesKeepSlowWalkAlive(t *testing.T) {
+	const (
+		files     = 40
+		statDelay = 25 * time.Millisecond // 整个遍历约1秒
+		opTimeout = 300 * time.Millisecond
+	)
+	oldInterval, oldStat := progressInterval, statEntry
+	t.Cleanup(func() { progressInterval, statEntry = oldInterval, oldStat })
+	progressInterval = 50 * time.Millisecond
+	statEntry = func(d fs.DirEntry) (fs.FileInfo, error) {
+		time.Sleep(statDelay)
+		return d.Info()
+	}
+
+	s, url := newTestGateway(t, Config{StatConcurrency: 1, IdleTimeout: 100 * time.Millisecond})
+	for i := 0; i < files; i++ {
+		os.WriteFile(filepath.Join(s.dir, fmt.Sprintf("f%02d.txt", i)), nil, 0o644)
+	}
+	dial := func(noProgress bool, p client.ProgressReporter) *client.Client {
+		t.Helper()
+		cl, err := client.DialContext(context.Background(), url, testToken,
+			client.Options{Progress: p, NoProgress: noProgress, PingInterval: -1, OpTimeout: opTimeout})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { cl.Close() })
+		return cl
+	}
+
+	p := &countingProgress{}
+	start := time.Now()
+	res, err := dial(false, p).Latest("/", 5)
+	if err != nil {
+		t.Fatalf("latest with progress frames after %v: %v", time.Since(start), err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*opTimeout {
+		t.Fatalf("the walk took only %v, not long enough to outlast the %v response timeout", elapsed, opTimeout)
+	}
+	if len(res.Entries) != 5 {
+		t.Errorf("latest returned %d entries, want 5", len(res.Entries))
+	}
+	if n := p.shown.Load(); n < 2 {
+		t.Errorf("client saw %d progress frames during the walk, want several", n)
+	}
+
+	_, err = dial(true, nil).Latest("/", 5)
+	var te *client.TimeoutError
+	if !errors.As(err, &te) || te.Phase != client.PhaseResponse {
+		t.Errorf("latest without progress frames: %v, want a response timeout", err)
+	}
+}
@@ -0,0 +1,346 @@
+package server
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：目录列表 ---------- */
+
+// errWalkBudget 表示遍历超出了时间预算
+var errWalkBudget = errors.New("walk budget exceeded")
+
+// walkContext 为目录遍历类请求附加时间预算
+func (s *Server) walkContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.walkTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), s.walkTimeout)
+}
+
+func (s *Server) budgetWarning() *protocol.Warning {
+	return &protocol.Warning{
+		Code:    "WALK_TIMEOUT",
+		Message: fmt.Sprintf("the server stopped after its %s walk budget, results are incomplete", s.walkTimeout),
+	}
+}
+
+// listDir 分批读取目录，超出时间预算时返回已读到的部分
+func listDir(ctx context.Context, real string) ([]os.DirEntry, bool, error) {
+	var entries []os.DirEntry
+	truncated, err := readDirBatches(ctx, real, func(batch []os.DirEntry) error {
+		entries = append(entries, batch...)
+		return nil
+	})
+	return entries, truncated, err
+}
+
+// readDirBatches 每读到一批目录项调用一次 fn，ctx 结束时停止并报告截断
+func readDirBatches(ctx context.Context, real string, fn func([]os.DirEntry) error) (bool, error) {
+	f, err := os.Open(real)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	for {
+		if ctx.Err() != nil {
+			return true, nil
+		}
+		batch, err := f.ReadDir(256)
+		if len(batch) > 0 {
+			if ferr := fn(batch); ferr != nil {
+				return false, ferr
+			}
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request, clientIP string) {
+	// 安全路径验证
+	dir, real, err := s.resolveSandboxPath(r, "dir")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "LIST", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 检查目录是否存在
+	stat, err := os.Stat(real)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logEvent(logEntry{IP: clientIP, Action: "LIST", Path: dir, Status: http.StatusNotFound, Duration: elapsedSince(r), Err: "directory not found"})
+			http.Error(w, "directory not found", http.StatusNotFound)
+		} else {
+			logEvent(logEntry{IP: clientIP, Action: "LIST", Path: dir, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "stat failed: " + err.Error()})
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// 确保是目录
+	if !stat.IsDir() {
+		logEvent(logEntry{IP: clientIP, Action: "LIST", Path: dir, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "not a directory"})
+		http.Error(w, "not a directory", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "stream" {
+		s.streamList(w, r, clientIP, dir, real)
+		return
+	}
+
+	ctx, cancel := s.walkContext(r)
+	defer cancel()
+	t := newOpTimings()
+	entries, truncated, err := listDir(ctx, real)
+	t.walk = time.Since(t.start)
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "LIST", Path: dir, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "read dir failed: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	format := r.URL.Query().Get("format")
+	var names []string
+	var details []protocol.ListEntry
+	if format == "" || format == "names" || format == "object" {
+		names = []string{}
+		for _, e := range entries {
+			if n, ok := listName(e); ok {
+				names = append(names, n)
+			}
+		}
+	} else {
+		var complete bool
+		details, complete = s.listEntries(ctx, real, entries, t)
+		truncated = truncated || !complete
+	}
+
+	count := len(names) + len(details)
+	if truncated {
+		logEvent(logEntry{IP: clientIP, Action: "LIST", Path: dir, Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("count=%d truncated", count)})
+	} else {
+		logEvent(logEntry{IP: clientIP, Action: "LIST", Path: dir, Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("count=%d", count)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	serializeStart := time.Now()
+	defer func() {
+		t.serialize = time.Since(serializeStart)
+		s.logSlow(clientIP, "LIST", "dir="+dir, t)
+	}()
+
+	// 默认返回名字数组，与最初的协议一致（旧客户端不带 format 参数）；带元数据的条目数组用 format=entries，
+	// 截断信息只能通过对象格式（object、long）返回
+	var warning *protocol.Warning
+	if truncated {
+		warning = s.budgetWarning()
+	}
+	switch format {
+	case "", "names":
+		json.NewEncoder(w).Encode(names)
+	case "object":
+		json.NewEncoder(w).Encode(protocol.ListResult{SchemaVersion: protocol.SchemaVersion, Entries: names, Truncated: truncated, Warning: warning})
+	case "long":
+		json.NewEncoder(w).Encode(protocol.LongListResult{SchemaVersion: protocol.SchemaVersion, Entries: details, Truncated: truncated, Warning: warning})
+	default:
+		json.NewEncoder(w).Encode(details)
+	}
+}
+
+// listEntries 并发获取已排序目录项的元数据，保留名不列出，结果保持原顺序。
+// stat 失败的条目（如读目录之后被删除）跳过；超出时间预算时返回 false，结果只含已完成的部分
+func (s *Server) listEntries(ctx context.Context, real string, entries []os.DirEntry, t *opTimings) ([]protocol.ListEntry, bool) {
+	items := make(chan statItem, 64)
+	results := s.statAll(ctx, items, t)
+	go func() {
+		defer close(items)
+		for _, e := range entries {
+			if isReservedName(e.Name()) {
+				continue
+			}
+			select {
+			case items <- statItem{path: filepath.Join(real, e.Name()), d: e}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	infos := make(map[string]fs.FileInfo, len(entries))
+	for res := range results {
+		if res.err == nil {
+			infos[res.d.Name()] = res.info
+		}
+	}
+	out := []protocol.ListEntry{}
+	for _, e := range entries {
+		fi, ok := infos[e.Name()]
+		if !ok {
+			continue
+		}
+		le := protocol.ListEntry{Name: e.Name(), Dir: e.IsDir(), ModTime: fi.ModTime().UTC(), Mode: fi.Mode().String(), Symlink: fi.Mode()&fs.ModeSymlink != 0}
+		if !le.Dir {
+			le.Size = fi.Size()
+		}
+		out = append(out, le)
+	}
+	return out, ctx.Err() == nil
+}
+
+// listName 返回目录项在列表中的名字，目录以 "/" 结尾；保留名不列出
+func listName(e os.DirEntry) (string, bool) {
+	n := e.Name()
+	if isReservedName(n) {
+		return "", false
+	}
+	if e.IsDir() {
+		n += "/"
+	}
+	return n, true
+}
+
+// latestHeap 是按修改时间排序的小顶堆，堆顶是当前保留项中最旧的
+type latestHeap []protocol.LatestEntry
+
+func (h latestHeap) Len() int           { return len(h) }
+func (h latestHeap) Less(i, j int) bool { return h[i].ModTime.Before(h[j].ModTime) }
+func (h latestHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *latestHeap) Push(x any)        { *h = append(*h, x.(protocol.LatestEntry)) }
+func (h *latestHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// handleLatest 递归遍历目录，只保留最新的n个文件，无需对全部结果排序
+func (s *Server) handleLatest(w http.ResponseWriter, r *http.Request, clientIP string) {
+	q := r.URL.Query()
+	n, err := strconv.Atoi(q.Get("n"))
+	if err != nil || n <= 0 {
+		http.Error(w, "invalid n", http.StatusBadRequest)
+		return
+	}
+	dir, real, err := s.resolveSandboxPath(r, "dir")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "LATEST", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 排队的时间不计入遍历预算，但计入慢日志的总耗时
+	t := newOpTimings()
+	release, wait, ok := s.heavy(w, r, clientIP, "LATEST", weightWalk)
+	if !ok {
+		return
+	}
+	defer release()
+	t.queue = wait
+
+	ctx, cancel := s.walkContext(r)
+	defer cancel()
+
+	h := &latestHeap{}
+	truncated := false
+
+	// 遍历与 stat 分离：遍历只产生目录项，stat 由 worker 池并发完成
+	items := make(chan statItem, 64)
+	results := s.statAll(ctx, items, t)
+	prog := track(r)
+	prog.begin("walking")
+	walkDone := make(chan struct{})
+	go func() {
+		defer close(walkDone)
+		defer close(items)
+		walkStart := time.Now()
+		err = filepath.WalkDir(real, func(p string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return errWalkBudget
+			}
+			if err != nil {
+				if p == real {
+					return err
+				}
+				return nil
+			}
+			prog.add(1)
+			if d.IsDir() || isReservedName(d.Name()) {
+				return nil
+			}
+			select {
+			case items <- statItem{path: p, d: d}:
+				return nil
+			case <-ctx.Done():
+				return errWalkBudget
+			}
+		})
+		t.walk = time.Since(walkStart)
+	}()
+
+	for res := range results {
+		if res.err != nil || !res.info.Mode().IsRegular() {
+			continue
+		}
+		if h.Len() == n && !res.info.ModTime().After((*h)[0].ModTime) {
+			continue
+		}
+		rel, _ := filepath.Rel(real, res.path)
+		heap.Push(h, protocol.LatestEntry{Path: filepath.ToSlash(rel), Size: res.info.Size(), ModTime: res.info.ModTime().UTC()})
+		if h.Len() > n {
+			heap.Pop(h)
+		}
+	}
+	<-walkDone
+	if ctx.Err() != nil && err == nil {
+		// worker 因超时提前退出时，部分 stat 结果已被丢弃
+		err = errWalkBudget
+	}
+	if errors.Is(err, errWalkBudget) {
+		truncated, err = true, nil
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			logEvent(logEntry{IP: clientIP, Action: "LATEST", Path: dir, Status: http.StatusNotFound, Duration: elapsedSince(r), Err: "directory not found"})
+			http.Error(w, "directory not found", http.StatusNotFound)
+			return
+		}
+		logEvent(logEntry{IP: clientIP, Action: "LATEST", Path: dir, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "walk failed: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := protocol.LatestResult{SchemaVersion: protocol.SchemaVersion, Entries: make([]protocol.LatestEntry, h.Len()), Truncated: truncated}
+	for i := len(res.Entries) - 1; i >= 0; i-- {
+		res.Entries[i] = heap.Pop(h).(protocol.LatestEntry)
+	}
+	if truncated {
+		res.Warning = s.budgetWarning()
+	}
+	logEvent(logEntry{IP: clientIP, Action: "LATEST", Path: dir, Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("n=%d count=%d truncated=%t", n, len(res.Entries), truncated)})
+	serializeStart := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+	t.serialize = time.Since(serializeStart)
+	s.logSlow(clientIP, "LATEST", "dir="+dir, t)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 流式目录列表 ---------- */
+
+// 客户端以 /_list?format=stream 请求时，处理器边读目录边输出 NDJSON：
+// 第一行是 protocol.ListHeader，中间每行是一个条目名（JSON 字符串），最后一行是 protocol.ListSummary。
+// 网关识别 ndjsonType 的响应，状态头的长度字段写为 -1，然后按帧转发：
+//
+//	"200 -1"                          状态头
+//	{"schema_version":1,"dir":"/a"}   文本帧：头部
+//	"x.txt"\n"sub/"\n...              二进制帧：一批条目，每行一个
+//	{"count":2,"truncated":false}     文本帧：摘要，流结束
+//
+// 条目按目录中的顺序到达，不排序。流式响应不参与流控确认，背压由 TCP 提供；
+// 客户端断开后网关写入失败并关闭本地请求，处理器在下一批之前停止读目录。
+// 旧版服务端忽略该格式，返回普通的名字数组
+const ndjsonType = "application/x-ndjson"
+
+// streamList 逐批输出目录项，每批写完立即刷新，客户端不必等最慢的一批读完
+func (s *Server) streamList(w http.ResponseWriter, r *http.Request, clientIP, dir, real string) {
+	ctx, cancel := s.walkContext(r)
+	defer cancel()
+	t := newOpTimings()
+	flush := func() {}
+	if f, ok := w.(http.Flusher); ok {
+		flush = f.Flush
+	}
+
+	w.Header().Set("Content-Type", ndjsonType)
+	enc := json.NewEncoder(w)
+	enc.Encode(protocol.ListHeader{SchemaVersion: protocol.SchemaVersion, Dir: dir})
+	flush()
+
+	var sum protocol.ListSummary
+	truncated, err := readDirBatches(ctx, real, func(batch []os.DirEntry) error {
+		for _, e := range batch {
+			if n, ok := listName(e); ok {
+				enc.Encode(n)
+				sum.Count++
+			}
+		}
+		flush()
+		return nil
+	})
+	t.walk = time.Since(t.start)
+	if r.Context().Err() != nil {
+		logEvent(logEntry{IP: clientIP, Action: "LIST", Path: dir, Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("count=%d streamed", sum.Count), Err: "aborted by client"})
+		return
+	}
+	switch {
+	case err != nil:
+		// 头部已经发出，错误只能放在摘要里
+		logEvent(logEntry{IP: clientIP, Action: "LIST", Path: dir, Status: http.StatusOK, Duration: elapsedSince(r), Err: "read dir failed: " + err.Error()})
+		sum.Truncated = true
+		sum.Warning = &protocol.Warning{Code: "READ_FAILED", Message: err.Error()}
+	case truncated:
+		sum.Truncated = true
+		sum.Warning = s.budgetWarning()
+	}
+	logEvent(logEntry{IP: clientIP, Action: "LIST", Path: dir, Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("count=%d truncated=%t streamed", sum.Count, sum.Truncated)})
+	enc.Encode(sum)
+	s.logSlow(clientIP, "LIST", "dir="+dir, t)
+}
+
+// relayStream 把 NDJSON 响应按帧转发：首行和末行作为文本帧，其余行按处理器的刷新节奏成批发送。
+// 末行要等到正文结束才能确认，所以始终暂留最近一行
+func relayStream(conn frameConn, resp *http.Response, t transfer) error {
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(t.statusHeader(resp, protocol.StreamedSize))); err != nil {
+		return err
+	}
+	br := bufio.NewReaderSize(resp.Body, protocol.FlowChunkSize)
+	header, err := br.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("stream: read header: %w", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, bytes.TrimSuffix(header, []byte("\n"))); err != nil {
+		return err
+	}
+	var batch, last []byte
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("stream: read body: %w", err)
+		}
+		batch = append(batch, last...)
+		last = line
+		// 缓冲区读空说明处理器刚刷新完一批
+		if len(batch) > 0 && (br.Buffered() == 0 || len(batch) >= protocol.FlowChunkSize) {
+			if err := conn.WriteMessage(websocket.BinaryMessage, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if last == nil {
+		return errors.New("stream: missing summary")
+	}
+	if len(batch) > 0 {
+		if err := conn.WriteMessage(websocket.BinaryMessage, batch); err != nil {
+			return err
+		}
+	}
+	return conn.WriteMessage(websocket.TextMessage, bytes.TrimSuffix(last, []byte("\n")))
+}
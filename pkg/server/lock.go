@@ -0,0 +1,224 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：文件名锁（独占创建） ---------- */
+
+// lockSuffix 锁元数据文件的后缀，元数据与锁标记文件放在同一目录
+const lockSuffix = ".wsbox-lock"
+
+// lockMetaPath 返回锁标记文件对应的元数据文件路径
+func lockMetaPath(real string) string {
+	return filepath.Join(filepath.Dir(real), "."+filepath.Base(real)+lockSuffix)
+}
+
+func readLock(real string) (*protocol.LockInfo, error) {
+	b, err := os.ReadFile(lockMetaPath(real))
+	if err != nil {
+		return nil, err
+	}
+	var l protocol.LockInfo
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func writeLock(real string, l *protocol.LockInfo) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	meta := lockMetaPath(real)
+	tmp := meta + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, meta)
+}
+
+// activeLock 返回路径上尚未过期的锁，没有锁时返回nil
+func activeLock(real string) *protocol.LockInfo {
+	l, err := readLock(real)
+	if err != nil || l.Expired() {
+		return nil
+	}
+	return l
+}
+
+// lockedByOther 返回路径上由其他token持有的有效锁；持有锁的token自己删除时不受阻拦
+func lockedByOther(real, token string) *protocol.LockInfo {
+	if l := activeLock(real); l != nil && l.Token != token {
+		return l
+	}
+	return nil
+}
+
+// acquireLock 以O_EXCL方式创建零字节锁标记，只有一个请求能成功
+func (s *Server) acquireLock(w http.ResponseWriter, r *http.Request, clientIP string) {
+	_, real, err := s.resolveSandboxPath(r, "")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "LOCK", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	ttl, err := time.ParseDuration(q.Get("ttl"))
+	if err != nil || ttl <= 0 {
+		http.Error(w, "invalid ttl", http.StatusBadRequest)
+		return
+	}
+	holder := q.Get("holder")
+	if holder == "" {
+		http.Error(w, "missing holder", http.StatusBadRequest)
+		return
+	}
+
+	if rejected := s.checkNewPath(real, false); rejected != nil {
+		logEvent(logEntry{IP: clientIP, Action: "LOCK", Path: r.URL.Path, Status: http.StatusUnprocessableEntity, Duration: elapsedSince(r), Err: rejected.Message})
+		writeError(w, http.StatusUnprocessableEntity, rejected)
+		return
+	}
+	if err := SecureCreateDir(filepath.Dir(real), s.dir); err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "LOCK", Path: r.URL.Path, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "secure mkdir failed: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+
+	// 过期的锁可以被回收
+	if l, err := readLock(real); err == nil && l.Expired() {
+		os.Remove(real)
+		os.Remove(lockMetaPath(real))
+		logEvent(logEntry{IP: clientIP, Action: "LOCK", Path: r.URL.Path, Detail: "reclaimed expired lock holder=" + l.Holder})
+	}
+
+	f, err := os.OpenFile(real, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			msg := "path already exists"
+			if l := activeLock(real); l != nil {
+				msg = fmt.Sprintf("locked by %s until %s", l.Holder, l.Expires().Format(time.RFC3339))
+			}
+			logEvent(logEntry{IP: clientIP, Action: "LOCK", Path: r.URL.Path, Status: http.StatusLocked, Duration: elapsedSince(r), Err: "contended"})
+			http.Error(w, msg, http.StatusLocked)
+			return
+		}
+		logEvent(logEntry{IP: clientIP, Action: "LOCK", Path: r.URL.Path, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "create marker failed: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f.Close()
+
+	l := &protocol.LockInfo{
+		SchemaVersion: protocol.SchemaVersion,
+		Path:          r.URL.Path,
+		Holder:        holder,
+		Token:         r.Header.Get("X-Wsbox-Token"),
+		AcquiredAt:    time.Now().UTC(),
+		TTL:           int64(ttl / time.Second),
+	}
+	if err := writeLock(real, l); err != nil {
+		os.Remove(real)
+		logEvent(logEntry{IP: clientIP, Action: "LOCK", Path: r.URL.Path, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "write lock metadata failed: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logEvent(logEntry{IP: clientIP, Action: "LOCK", Path: r.URL.Path, Status: http.StatusCreated, Duration: elapsedSince(r), Detail: fmt.Sprintf("acquired holder=%s ttl=%s", holder, ttl)})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(l)
+}
+
+// releaseLock 删除锁标记，只有持有者（相同token和holder）可以释放
+func (s *Server) releaseLock(w http.ResponseWriter, r *http.Request, clientIP string) {
+	_, real, err := s.resolveSandboxPath(r, "")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "UNLOCK", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+
+	l, err := readLock(real)
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "UNLOCK", Path: r.URL.Path, Status: http.StatusNotFound, Duration: elapsedSince(r), Err: "not locked"})
+		http.Error(w, "not locked", http.StatusNotFound)
+		return
+	}
+	if l.Token != r.Header.Get("X-Wsbox-Token") || l.Holder != r.URL.Query().Get("holder") {
+		logEvent(logEntry{IP: clientIP, Action: "UNLOCK", Path: r.URL.Path, Status: http.StatusForbidden, Duration: elapsedSince(r), Err: "held by " + l.Holder})
+		http.Error(w, "lock is held by "+l.Holder, http.StatusForbidden)
+		return
+	}
+	os.Remove(real)
+	os.Remove(lockMetaPath(real))
+	logEvent(logEntry{IP: clientIP, Action: "UNLOCK", Path: r.URL.Path, Status: http.StatusOK, Duration: elapsedSince(r), Detail: "released holder=" + l.Holder})
+	fmt.Fprintln(w, "ok")
+}
+
+// listLocks 递归列出目录下所有锁（包括已过期但尚未回收的）
+func (s *Server) listLocks(w http.ResponseWriter, r *http.Request, clientIP string) {
+	dir, real, err := s.resolveSandboxPath(r, "dir")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "LOCKS", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	release, _, ok := s.heavy(w, r, clientIP, "LOCKS", weightWalk)
+	if !ok {
+		return
+	}
+	defer release()
+
+	locks := []*protocol.LockInfo{}
+	err = filepath.WalkDir(real, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == real {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() || !isReservedName(d.Name()) {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil
+		}
+		var l protocol.LockInfo
+		if json.Unmarshal(b, &l) == nil {
+			l.SchemaVersion = protocol.SchemaVersion
+			locks = append(locks, &l)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "directory not found", http.StatusNotFound)
+			return
+		}
+		logEvent(logEntry{IP: clientIP, Action: "LOCKS", Path: dir, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "walk failed: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logEvent(logEntry{IP: clientIP, Action: "LOCKS", Path: dir, Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("count=%d", len(locks))})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(locks)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"wsbox/pkg/client"
+)
+
+// 有效的锁：stat 给出持有者、获取时间和 TTL；其他token删除文件或包含它的目录都以 423 拒绝，
+// 持有锁的token自己删除时锁的元数据一并删除
+func TestDeleteLockedPath(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens")
+	os.WriteFile(file, []byte("holder-token-0001 rw\nother-token-00002 rw\n"), 0o600)
+	s, wsURL := newTestGateway(t, Config{TokensFile: file})
+	dial := func(token string) *client.Client {
+		cl, err := client.Dial(wsURL, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { cl.Close() })
+		return cl
+	}
+	a, b := dial("holder-token-0001"), dial("other-token-00002")
+
+	before := time.Now().Add(-time.Second)
+	for _, p := range []string{"/job", "/d/job"} {
+		if _, err := a.Lock(p, "worker-a", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, err := b.Stat("/job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := st.Lock; l == nil || l.Holder != "worker-a" || l.TTL != 60 || l.AcquiredAt.Before(before) || time.Since(l.AcquiredAt) > time.Minute {
+		t.Errorf("stat of a locked path: lock = %+v", st.Lock)
+	}
+
+	locked := func(what string, err error) {
+		t.Helper()
+		var re *client.RemoteError
+		if !errors.As(err, &re) || re.Status != http.StatusLocked {
+			t.Errorf("%s by another token: %v, want 423", what, err)
+		}
+	}
+	locked("delete", b.Delete("/job", false))
+	locked("recursive delete", b.Delete("/d", true))
+	for _, p := range []string{"job", "d/job"} {
+		if _, err := os.Stat(filepath.Join(s.dir, p)); err != nil {
+			t.Errorf("%s is gone after a refused delete: %v", p, err)
+		}
+	}
+
+	if err := a.Delete("/job", false); err != nil {
+		t.Fatalf("delete by the holder: %v", err)
+	}
+	real := filepath.Join(s.dir, "job")
+	if _, err := os.Lstat(lockMetaPath(real)); !os.IsNotExist(err) {
+		t.Errorf("lock metadata left behind after the holder deleted the file: %v", err)
+	}
+	if err := a.Delete("/d", true); err != nil {
+		t.Fatalf("recursive delete by the holder: %v", err)
+	}
+
+	// 没有锁的路径 stat 不带 lock
+	b.Upload("/free.txt", strings.NewReader("x"))
+	if st, err := b.Stat("/free.txt"); err != nil || st.Lock != nil {
+		t.Errorf("stat of an unlocked file: %+v, %v", st, err)
+	}
+}
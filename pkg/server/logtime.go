@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/* ---------- 日志时间戳 ---------- */
+
+// DefaultLogTimeFormat 是日志时间戳的默认格式，带有时区偏移，跨地区的服务器日志可以直接对齐
+const DefaultLogTimeFormat = time.RFC3339Nano
+
+// logClock 是日志时间戳的时区和格式
+type logClock struct {
+	loc    *time.Location
+	layout string
+}
+
+// logTime 由所有日志输出共用。日志函数是包级的，同一进程中的多个服务端共用这一设置
+var logTime atomic.Pointer[logClock]
+
+func init() {
+	logTime.Store(&logClock{loc: time.UTC, layout: DefaultLogTimeFormat})
+}
+
+// ParseLogTimezone 解析 -log-timezone：local（本机时区）、UTC 或 IANA 时区名（如 Asia/Shanghai）
+func ParseLogTimezone(name string) (*time.Location, error) {
+	switch strings.ToLower(name) {
+	case "", "utc":
+		return time.UTC, nil
+	case "local":
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -log-timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// SetLogTime 设置日志时间戳的时区和格式（time 包的布局写法），loc 为 nil 时使用 UTC，layout 为空时使用 DefaultLogTimeFormat。
+// 不含时区偏移的格式只能配合 UTC：其他时区在夏令时结束时同一个墙上时间会出现两次，日志无法排序
+func SetLogTime(loc *time.Location, layout string) error {
+	if loc == nil {
+		loc = time.UTC
+	}
+	if layout == "" {
+		layout = DefaultLogTimeFormat
+	}
+	if loc != time.UTC && !layoutHasZone(layout) {
+		return errors.New("-log-time-format has no zone offset, which is ambiguous outside UTC; add Z07:00 or use -log-timezone UTC")
+	}
+	logTime.Store(&logClock{loc: loc, layout: layout})
+	return nil
+}
+
+// layoutHasZone 判断格式能否区分墙上时间相同、偏移不同的两个时刻
+func layoutHasZone(layout string) bool {
+	a := time.Date(2006, 1, 2, 15, 4, 5, 0, time.FixedZone("A", 3600))
+	b := time.Date(2006, 1, 2, 15, 4, 5, 0, time.FixedZone("B", 7200))
+	return a.Format(layout) != b.Format(layout)
+}
+
+// logStamp 按当前设置格式化 t
+func logStamp(t time.Time) string {
+	c := logTime.Load()
+	return t.In(c.loc).Format(c.layout)
+}
+
+// logf 输出与具体客户端无关的服务端日志（启动、关闭、吊销等）到标准库 log 的输出，
+// 时间戳与 logEvent 相同，不使用 log 包自带的本地时间
+func logf(format string, args ...any) {
+	fmt.Fprintf(log.Writer(), "%s %s\n", logStamp(time.Now()), fmt.Sprintf(format, args...))
+}
+
+// Logf 供嵌入服务端的程序按同样的时间戳设置输出自己的日志
+func Logf(format string, args ...any) {
+	logf(format, args...)
+}
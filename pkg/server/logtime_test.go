@@ -0,0 +1,78 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // 不依赖系统的时区数据库
+)
+
+// 夏令时切换前后的时间戳：回拨时同一个墙上时间出现两次，偏移不同，解析回来仍是原来的时刻；
+// 不含偏移的格式在 UTC 以外被拒绝
+func TestLogStampAcrossDST(t *testing.T) {
+	old := logTime.Load()
+	t.Cleanup(func() { logTime.Store(old) })
+	ny, err := ParseLogTimezone("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLogTime(ny, ""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{"before fall back", time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), "2024-11-03T01:30:00-04:00"},
+		{"after fall back", time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC), "2024-11-03T01:30:00-05:00"},
+		{"before spring forward", time.Date(2024, 3, 10, 6, 59, 59, 0, time.UTC), "2024-03-10T01:59:59-05:00"},
+		{"after spring forward", time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC), "2024-03-10T03:00:00-04:00"},
+	}
+	for _, tt := range tests {
+		got := logStamp(tt.at)
+		if got != tt.want {
+			t.Errorf("%s: logStamp = %q, want %q", tt.name, got, tt.want)
+		}
+		if back, err := time.Parse(DefaultLogTimeFormat, got); err != nil || !back.Equal(tt.at) {
+			t.Errorf("%s: %q parses back to %v, %v; want %v", tt.name, got, back, err, tt.at)
+		}
+	}
+
+	const noZone = "2006-01-02 15:04:05"
+	if err := SetLogTime(ny, noZone); err == nil {
+		t.Error("SetLogTime accepted a layout without a zone offset outside UTC")
+	}
+	if got := logStamp(tests[0].at); got != tests[0].want {
+		t.Errorf("a rejected SetLogTime changed the setting: %q", got)
+	}
+	if err := SetLogTime(nil, noZone); err != nil {
+		t.Errorf("SetLogTime(UTC, %q) = %v", noZone, err)
+	}
+	if got := logStamp(tests[0].at); got != "2024-11-03 05:30:00" {
+		t.Errorf("UTC without offset: logStamp = %q", got)
+	}
+}
+
+func TestParseLogTimezone(t *testing.T) {
+	tests := []struct {
+		name string
+		want *time.Location
+		err  bool
+	}{
+		{"", time.UTC, false},
+		{"utc", time.UTC, false},
+		{"UTC", time.UTC, false},
+		{"Local", time.Local, false},
+		{"Nowhere/Zone", nil, true},
+	}
+	for _, tt := range tests {
+		loc, err := ParseLogTimezone(tt.name)
+		if (err != nil) != tt.err || !tt.err && loc != tt.want {
+			t.Errorf("ParseLogTimezone(%q) = %v, %v", tt.name, loc, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "-log-timezone") {
+			t.Errorf("ParseLogTimezone(%q) error %q does not name the flag", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：请求元数据 ---------- */
+
+// requestMetadata 解析并校验请求携带的元数据，没有时返回 nil
+func requestMetadata(r *http.Request) (map[string]string, error) {
+	entries := r.URL.Query()[protocol.MetadataParam]
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	md, err := protocol.ParseMetadata(entries)
+	if err != nil {
+		return nil, err
+	}
+	if err := protocol.DefaultMetadataLimits.Check(md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// rejectMetadata 写出元数据无效的错误响应
+func rejectMetadata(w http.ResponseWriter, clientIP, action string, err error) {
+	logEvent(logEntry{IP: clientIP, Action: action, Status: http.StatusBadRequest, Err: "invalid metadata: " + err.Error()})
+	writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_METADATA", Message: err.Error()})
+}
+
+// formatMetadata 把元数据格式化为日志后缀，按键排序，值加引号以免换行等字符破坏日志格式
+func formatMetadata(md map[string]string) string {
+	if len(md) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(" meta:")
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%q", k, md[k])
+	}
+	return b.String()
+}
+
+// handleMetadataLimits 实现 GET /_caps/metadata，返回服务端接受的元数据限制
+func (s *Server) handleMetadataLimits(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(protocol.DefaultMetadataLimits)
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* ---------- 服务端：Prometheus 指标 ---------- */
+
+// 指标以 Prometheus 的文本格式在 /metrics 输出。没有 -metrics-addr 时挂在网关上，与 /ws 一样需要token；
+// 指定 -metrics-addr 时只在该地址上提供，不需要token，适合绑定在内网地址上供抓取
+
+// transferBuckets 是传输用时直方图的上界（秒），覆盖小文件到数GB的传输
+var transferBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 1800}
+
+// histogram 是累积计数的直方图
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // counts[i] 是落在 bounds[i] 以内的次数（不累积），最后一个是 +Inf
+	sum    float64
+	total  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.total++
+	h.mu.Unlock()
+}
+
+// write 按文本格式输出各个 le 的累积计数、总和与次数
+func (h *histogram) write(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cum uint64
+	for i, c := range h.counts {
+		cum += c
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", name, labels, le, cum)
+	}
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, strings.TrimSuffix(labels, ","), strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, strings.TrimSuffix(labels, ","), h.total)
+}
+
+// requestKey 是请求计数的标签
+type requestKey struct {
+	method string
+	status int
+}
+
+// metrics 是服务端的全部指标
+type metrics struct {
+	connections   atomic.Int64  // 当前的websocket连接
+	authFailures  atomic.Uint64 // token不对的请求
+	uploadBytes   atomic.Uint64
+	downloadBytes atomic.Uint64
+	uploadTime    *histogram
+	downloadTime  *histogram
+
+	mu       sync.Mutex
+	requests map[requestKey]uint64 // 本地处理器处理的请求，按方法和状态码
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		uploadTime:   newHistogram(transferBuckets),
+		downloadTime: newHistogram(transferBuckets),
+		requests:     make(map[requestKey]uint64),
+	}
+}
+
+// transferDirection 把本地请求归类为上传、下载或其他（列表、锁等以 /_ 开头的接口）
+func transferDirection(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/_") {
+		return ""
+	}
+	switch r.Method {
+	case "POST":
+		return "upload"
+	case "GET":
+		return "download"
+	}
+	return ""
+}
+
+// instrument 包装本地处理器，统计请求的状态码、上传下载的字节数和用时
+func (m *metrics) instrument(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		dir := transferDirection(r)
+		var body *countingReader
+		if dir == "upload" {
+			body = &countingReader{ReadCloser: r.Body}
+			r.Body = body
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		next(sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.mu.Lock()
+		m.requests[requestKey{r.Method, status}]++
+		m.mu.Unlock()
+		switch dir {
+		case "upload":
+			m.uploadBytes.Add(uint64(body.n))
+			m.uploadTime.observe(time.Since(start).Seconds())
+		case "download":
+			// 错误响应的正文（如 not found）不是文件内容
+			if status < 300 {
+				m.downloadBytes.Add(uint64(sw.written))
+			}
+			m.downloadTime.observe(time.Since(start).Seconds())
+		}
+	}
+}
+
+// metricsHandler 输出所有指标；requireToken 为 true 时（挂在网关上）与 /ws 一样校验token
+func (s *Server) metricsHandler(requireToken bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requireToken && !s.authorized(r) {
+			s.metrics.authFailures.Add(1)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.metrics.write(w)
+	}
+}
+
+func (m *metrics) write(w io.Writer) {
+	help := func(name, typ, text string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, text, name, typ)
+	}
+	help("wsbox_connections", "gauge", "Open websocket connections on the gateway.")
+	fmt.Fprintf(w, "wsbox_connections %d\n", m.connections.Load())
+
+	help("wsbox_requests_total", "counter", "Requests handled, by method and status code.")
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "wsbox_requests_total{method=%q,status=\"%d\"} %d\n", k.method, k.status, m.requests[k])
+	}
+	m.mu.Unlock()
+
+	help("wsbox_transfer_bytes_total", "counter", "File content bytes received by uploads and sent by downloads.")
+	fmt.Fprintf(w, "wsbox_transfer_bytes_total{direction=\"upload\"} %d\n", m.uploadBytes.Load())
+	fmt.Fprintf(w, "wsbox_transfer_bytes_total{direction=\"download\"} %d\n", m.downloadBytes.Load())
+
+	help("wsbox_transfer_duration_seconds", "histogram", "Time to handle an upload or download request.")
+	m.uploadTime.write(w, "wsbox_transfer_duration_seconds", `direction="upload",`)
+	m.downloadTime.write(w, "wsbox_transfer_duration_seconds", `direction="download",`)
+
+	help("wsbox_auth_failures_total", "counter", "Requests rejected because of a missing or wrong token.")
+	fmt.Fprintf(w, "wsbox_auth_failures_total %d\n", m.authFailures.Load())
+}
+
+// countingReader 统计上传正文读到的字节数
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// statusWriter 记下响应的状态码和正文字节数，保留 Flush 供流式列表使用
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 让 http.ResponseController 找到底层的 ResponseWriter
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
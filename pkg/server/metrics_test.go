@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"wsbox/pkg/client"
+)
+
+// scrape 取回 /metrics 并按 "名字{标签}" 解析出每个样本的值，同时返回声明了 TYPE 的指标名
+func scrape(t *testing.T, url, token string) (samples map[string]float64, types map[string]string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("GET %s = %d %s", url, resp.StatusCode, b)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", ct)
+	}
+	samples, types = map[string]float64{}, map[string]string{}
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if f := strings.Fields(line); len(f) == 4 && f[0] == "#" && f[1] == "TYPE" {
+			types[f[2]] = f[3]
+			continue
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("bad sample line %q", line)
+		}
+		samples[line[:i]] = v
+	}
+	return samples, types
+}
+
+// 在网关上抓取指标，做几次操作后计数器按预期增加
+func TestMetricsScrape(t *testing.T) {
+	_, wsURL := newTestGateway(t, Config{})
+	metricsURL := "http" + strings.TrimSuffix(strings.TrimPrefix(wsURL, "ws"), "/ws") + "/metrics"
+
+	before, types := scrape(t, metricsURL, testToken)
+	for name, typ := range map[string]string{
+		"wsbox_connections":               "gauge",
+		"wsbox_requests_total":            "counter",
+		"wsbox_transfer_bytes_total":      "counter",
+		"wsbox_transfer_duration_seconds": "histogram",
+		"wsbox_auth_failures_total":       "counter",
+	} {
+		if types[name] != typ {
+			t.Errorf("%s has type %q, want %q", name, types[name], typ)
+		}
+	}
+
+	cl, err := client.Dial(wsURL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("m"), 1000)
+	if _, err := cl.Upload("/m.txt", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.Download("/m.txt", io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.Download("/missing.txt", io.Discard); err == nil {
+		t.Fatal("downloading a missing file succeeded")
+	}
+	if _, err := client.Dial(wsURL, "wrong-token"); err == nil {
+		t.Fatal("a wrong token was accepted")
+	}
+	req, _ := http.NewRequest("GET", metricsURL, nil)
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("/metrics without a token = %d, want 401", resp.StatusCode)
+		}
+	}
+
+	after, _ := scrape(t, metricsURL, testToken)
+	delta := func(key string) float64 { return after[key] - before[key] }
+	for key, want := range map[string]float64{
+		`wsbox_requests_total{method="POST",status="201"}`:                     1,
+		`wsbox_requests_total{method="GET",status="404"}`:                      1,
+		`wsbox_transfer_bytes_total{direction="upload"}`:                       1000,
+		`wsbox_transfer_bytes_total{direction="download"}`:                     1000,
+		`wsbox_transfer_duration_seconds_count{direction="upload"}`:            1,
+		`wsbox_transfer_duration_seconds_count{direction="download"}`:          2,
+		`wsbox_transfer_duration_seconds_bucket{direction="upload",le="+Inf"}`: 1,
+		`wsbox_auth_failures_total`:                                            2,
+		`wsbox_connections`:                                                    1,
+	} {
+		if got := delta(key); got != want {
+			t.Errorf("%s moved by %v, want %v", key, got, want)
+		}
+	}
+	if delta(`wsbox_requests_total{method="GET",status="200"}`) < 1 {
+		t.Errorf("the successful download was not counted")
+	}
+
+	cl.Close()
+	// 连接关闭后连接数回落，服务端处理关闭需要一点时间
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		now, _ := scrape(t, metricsURL, testToken)
+		if now["wsbox_connections"] == before["wsbox_connections"] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("wsbox_connections stayed at %v after the client closed", now["wsbox_connections"])
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// 指定 -metrics-addr 时指标只在单独的监听上提供，不需要token，网关上不再有 /metrics
+func TestMetricsSeparateListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	_, wsURL := newTestGateway(t, Config{MetricsAddr: addr})
+
+	var samples map[string]float64
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		if resp, err := http.Get("http://" + addr + "/metrics"); err == nil {
+			resp.Body.Close()
+			samples, _ = scrape(t, "http://"+addr+"/metrics", "")
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics listener on %s did not come up", addr)
+		}
+	}
+	if _, ok := samples["wsbox_auth_failures_total"]; !ok {
+		t.Errorf("separate listener is missing wsbox_auth_failures_total")
+	}
+
+	gw := "http" + strings.TrimSuffix(strings.TrimPrefix(wsURL, "ws"), "/ws") + "/metrics"
+	req, _ := http.NewRequest("GET", gw, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Errorf("the gateway still serves /metrics when -metrics-addr is set")
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：创建目录 ---------- */
+
+// mkdirTarget 把网关收到的 "MKDIR /a/b/c" 的目标换成本地处理器的 /_mkdir?dir=/a/b/c，
+// 本地处理器上的路径参数都经过 checkPathParams 和 resolveSandboxPath
+func mkdirTarget(target string) string {
+	p, _, _ := strings.Cut(target, "?")
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	return "/_mkdir?dir=" + url.QueryEscape(p)
+}
+
+// handleMkdir 实现 POST /_mkdir?dir=，逐级创建目录，深度和名字的规则与上传时创建上级目录相同（checkNewPath）。
+// 新建时回复 201，已经是目录时回复 200，路径上有文件时以 409 NOT_A_DIRECTORY 拒绝
+func (s *Server) handleMkdir(w http.ResponseWriter, r *http.Request, clientIP string) {
+	path, real, err := s.resolveSandboxPath(r, "dir")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "MKDIR", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	newDirs := missingDirs(real)
+	// 最内层已存在的路径必须是目录，否则是文件挡在路径上
+	existing := real
+	if len(newDirs) > 0 {
+		existing = filepath.Dir(newDirs[0])
+	}
+	if fi, err := os.Stat(existing); err != nil || !fi.IsDir() {
+		logEvent(logEntry{IP: clientIP, Action: "MKDIR", Path: path, Status: http.StatusConflict, Duration: elapsedSince(r), Err: "a file is in the way"})
+		writeError(w, http.StatusConflict, &APIError{Code: protocol.NotDirectoryCode, Message: path + ": a file occupies the path"})
+		return
+	}
+	if len(newDirs) == 0 {
+		logEvent(logEntry{IP: clientIP, Action: "MKDIR", Path: path, Status: http.StatusOK, Duration: elapsedSince(r), Detail: "exists"})
+		fmt.Fprintln(w, "exists")
+		return
+	}
+	for _, d := range newDirs {
+		if isReservedName(filepath.Base(d)) {
+			logEvent(logEntry{IP: clientIP, Action: "MKDIR", Path: path, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "reserved name"})
+			writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: "reserved name " + filepath.Base(d)})
+			return
+		}
+	}
+	if rejected := s.checkNewPath(real, true); rejected != nil {
+		logEvent(logEntry{IP: clientIP, Action: "MKDIR", Path: path, Status: http.StatusUnprocessableEntity, Duration: elapsedSince(r), Err: rejected.Message})
+		writeError(w, http.StatusUnprocessableEntity, rejected)
+		return
+	}
+	// 检查之后可能有并发请求先创建了目录，以真正新建的为准
+	newDirs, err = s.createDirs(real)
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "MKDIR", Path: path, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "secure mkdir failed: " + err.Error()})
+		writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	if len(newDirs) == 0 {
+		logEvent(logEntry{IP: clientIP, Action: "MKDIR", Path: path, Status: http.StatusOK, Duration: elapsedSince(r), Detail: "exists"})
+		fmt.Fprintln(w, "exists")
+		return
+	}
+	logEvent(logEntry{IP: clientIP, Action: "MKDIR", Path: path, Status: http.StatusCreated, Duration: elapsedSince(r), Detail: fmt.Sprintf("created=%d", len(newDirs))})
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：移动与重命名 ---------- */
+
+// moveTarget 把网关收到的 "MOVE /src?dst=/dst[&force=1]" 的目标换成本地处理器的 /_move?src=&dst=[&force=1]
+func moveTarget(target string) string {
+	p, query, _ := strings.Cut(target, "?")
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	q, _ := url.ParseQuery(query)
+	q.Set("src", p)
+	return "/_move?" + q.Encode()
+}
+
+// handleMove 实现 POST /_move?src=&dst=：两端都经过 resolveSandboxPath，目标和新建的上级目录按名字规则检查（checkNewPath），通过 SecureCreateDir 创建，
+// 用 os.Rename 移动，跨文件系统时退回复制后删除。目标已存在时只有带 force=1 才替换，目标是目录时始终拒绝。
+// 成功时正文是清理后的目标路径（客户端看到的形式），参数里的 ".." 不会原样回显
+func (s *Server) handleMove(w http.ResponseWriter, r *http.Request, clientIP string) {
+	src, srcReal, err := s.resolveLinkPath(r, "src")
+	if err == nil && r.URL.Query().Get("dst") == "" {
+		err = errors.New("missing dst")
+	}
+	var dst, dstReal string
+	if err == nil {
+		dst, dstReal, err = s.resolveSandboxPath(r, "dst")
+	}
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "MOVE", Path: src, Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	fail := func(status int, e *APIError) {
+		logEvent(logEntry{IP: clientIP, Action: "MOVE", Path: src, Status: status, Duration: elapsedSince(r), Detail: "dst=" + dst, Err: e.Message})
+		writeError(w, status, e)
+	}
+
+	absRoot, _ := filepath.Abs(s.dir)
+	if scope := r.Header.Get(scopeHeader); scope != "" {
+		absRoot, _ = SecurePath(scope, s.dir)
+	}
+	srcInfo, err := os.Lstat(srcReal)
+	switch {
+	case srcReal == absRoot:
+		fail(http.StatusForbidden, &APIError{Code: "ROOT_MOVE", Message: "the sandbox root cannot be moved"})
+		return
+	case err != nil || isReservedName(srcInfo.Name()):
+		fail(http.StatusNotFound, &APIError{Code: "NOT_FOUND", Message: src + " not found"})
+		return
+	case isReservedName(filepath.Base(dstReal)):
+		fail(http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: "reserved file name"})
+		return
+	case dstReal == srcReal:
+		fail(http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: "source and destination are the same"})
+		return
+	case srcInfo.IsDir() && strings.HasPrefix(dstReal, srcReal+string(filepath.Separator)):
+		fail(http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: "cannot move a directory into itself"})
+		return
+	}
+	// 目标和新建的上级目录按名字规则检查；移动目录时其中最深的目录也不能超过 -max-depth
+	rejected := s.checkNewPath(dstReal, srcInfo.IsDir())
+	if rejected == nil && srcInfo.IsDir() {
+		rejected = s.checkMovedTree(srcReal, dstReal)
+	}
+	if rejected != nil {
+		fail(http.StatusUnprocessableEntity, rejected)
+		return
+	}
+
+	// 与上传提交互斥，覆盖检查和重命名之间不会插入别的上传
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+	dstInfo, statErr := os.Lstat(dstReal)
+	replaced := statErr == nil
+	if replaced {
+		if dstInfo.IsDir() {
+			fail(http.StatusConflict, &APIError{Code: "IS_DIRECTORY", Message: dst + " is a directory"})
+			return
+		}
+		if r.URL.Query().Get("force") != "1" {
+			fail(http.StatusConflict, &APIError{Code: protocol.ExistsCode, Message: dst + " already exists; pass force=1 to replace it"})
+			return
+		}
+	}
+	s.lockMu.Lock()
+	for _, p := range []string{srcReal, dstReal} {
+		if l := activeLock(p); l != nil {
+			s.lockMu.Unlock()
+			fail(http.StatusLocked, &APIError{Code: "LOCKED", Message: "path is locked by " + l.Holder})
+			return
+		}
+	}
+	// 过期的锁随移动一起失效
+	os.Remove(lockMetaPath(srcReal))
+	os.Remove(lockMetaPath(dstReal))
+	s.lockMu.Unlock()
+
+	if _, err := s.createDirs(filepath.Dir(dstReal)); err != nil {
+		fail(http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	if replaced && srcInfo.IsDir() {
+		// rename 不能用目录替换文件
+		if err := os.Remove(dstReal); err != nil {
+			fail(http.StatusInternalServerError, &APIError{Code: "MOVE_FAILED", Message: err.Error()})
+			return
+		}
+	}
+	copied := false
+	err = os.Rename(srcReal, dstReal)
+	if errors.Is(err, syscall.EXDEV) {
+		// 跨文件系统（沙箱内挂载了别的卷）：复制到目标后删除源
+		if err = copyTree(srcReal, dstReal); err == nil {
+			err = os.RemoveAll(srcReal)
+		} else {
+			os.RemoveAll(dstReal)
+		}
+		copied = true
+	}
+	if err != nil {
+		fail(http.StatusInternalServerError, &APIError{Code: "MOVE_FAILED", Message: err.Error()})
+		return
+	}
+	s.noteRemoved(srcReal, srcInfo.IsDir())
+	s.hashes.forget(srcReal)
+	s.hashes.forget(dstReal)
+	if !replaced {
+		s.noteCreated(dstReal)
+	}
+	detail := fmt.Sprintf("dst=%s dir=%t", dst, srcInfo.IsDir())
+	if replaced {
+		detail += " replaced"
+	}
+	if copied {
+		detail += " copied"
+	}
+	logEvent(logEntry{IP: clientIP, Action: "MOVE", Path: src, Status: http.StatusOK, Duration: elapsedSince(r), Detail: detail})
+	moved, _, _ := s.scopedPath(r, dst)
+	fmt.Fprintln(w, visiblePath(r, moved))
+}
+
+// copyTree 把文件或目录树复制到 dst，保留权限和修改时间；文件先写到暂存文件再重命名，符号链接按原样重建
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		return copyFile(p, target, info)
+	})
+}
+
+func copyFile(src, dst string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+tempMarker+"*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), info.Mode().Perm())
+	}
+	if err == nil {
+		os.Chtimes(out.Name(), info.ModTime(), info.ModTime())
+		err = os.Rename(out.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：新建路径的名字规则 ---------- */
+
+// 客户端新建的目录和文件（上传、续传和追加的目标，解包出的条目，MKDIR，MOVE 的目标，锁标记，以及为它们新建的上级目录）
+// 都按同一套规则检查。只检查这次要新建的层级，已经存在的目录和文件不受影响：
+//
+//	Config.MaxDepth     新建目录在沙箱内的最大层数，文件按所在目录计算；0表示不限
+//	Config.MaxNameLen   每一级名字的最大字节数，0表示不限
+//	Config.NameCharset  名字允许的字符，取值见下
+//
+// 违反时以 422 NAME_POLICY 拒绝，消息写明规则和出问题的那一级名字，如 name-charset windows-safe: "a:b" contains ':'
+
+// Config.NameCharset 的取值
+const (
+	NameStrict      = "strict"       // 只允许 ASCII 字母、数字和 . _ -，不以 - 开头，另加 windows-safe 的规则
+	NameWindowsSafe = "windows-safe" // 不允许 <>:"\|?* 和控制字符、结尾的点或空格、CON、NUL、COM1 等设备名
+	NameAny         = "any"          // 不限字符（默认）
+)
+
+func validNameCharset(v string) error {
+	switch v {
+	case NameStrict, NameWindowsSafe, NameAny:
+		return nil
+	}
+	return fmt.Errorf("invalid -name-charset %q, expected one of %s|%s|%s", v, NameStrict, NameWindowsSafe, NameAny)
+}
+
+// namePolicy 是解析后的名字规则
+type namePolicy struct {
+	maxDepth int
+	maxLen   int
+	charset  string
+}
+
+// windowsDevices 是 Windows 上不能用作文件名（带不带扩展名都不行）的设备名
+var windowsDevices = map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true}
+
+func init() {
+	for _, d := range "123456789" {
+		windowsDevices["COM"+string(d)] = true
+		windowsDevices["LPT"+string(d)] = true
+	}
+}
+
+// checkName 检查一级名字的长度和字符
+func (p namePolicy) checkName(name string) error {
+	if p.maxLen > 0 && len(name) > p.maxLen {
+		return fmt.Errorf("max-name-len: %q is %d bytes, the limit is %d", name, len(name), p.maxLen)
+	}
+	if p.charset == NameAny {
+		return nil
+	}
+	if p.charset == NameStrict {
+		if strings.HasPrefix(name, "-") {
+			return fmt.Errorf("name-charset strict: %q starts with '-'", name)
+		}
+		for _, c := range name {
+			if c >= utf8.RuneSelf || !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("._-", c)) {
+				return fmt.Errorf("name-charset strict: %q contains %q", name, c)
+			}
+		}
+	}
+	for _, c := range name {
+		if c < 0x20 || strings.ContainsRune(`<>:"\|?*`, c) {
+			return fmt.Errorf("name-charset %s: %q contains %q", p.charset, name, c)
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return fmt.Errorf("name-charset %s: %q ends with a dot or space", p.charset, name)
+	}
+	stem, _, _ := strings.Cut(name, ".")
+	if windowsDevices[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		return fmt.Errorf("name-charset %s: %q is a reserved device name on Windows", p.charset, name)
+	}
+	return nil
+}
+
+// checkNewPath 检查为沙箱内的 real 新建的各级名字和目录层数，isDir 表示 real 本身是目录。
+// real 已经存在时没有要新建的层级，直接通过
+func (s *Server) checkNewPath(real string, isDir bool) *APIError {
+	root, _ := filepath.Abs(s.dir)
+	// 不用 missingDirs：名字过长时 Lstat 返回 ENAMETOOLONG 而不是不存在，这一级同样要检查
+	var created []string
+	for p := real; p != root && strings.HasPrefix(p, root); p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); err == nil {
+			break
+		}
+		created = append([]string{p}, created...)
+	}
+	for _, p := range created {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(p)
+		if err := s.names.checkName(name); err != nil {
+			return &APIError{Code: protocol.NamePolicyCode, Message: err.Error()}
+		}
+		depth := strings.Count(filepath.ToSlash(rel), "/") + 1
+		if (isDir || p != real) && s.names.maxDepth > 0 && depth > s.names.maxDepth {
+			return &APIError{Code: protocol.NamePolicyCode,
+				Message: fmt.Sprintf("max-depth: %q would be directory level %d, the limit is %d", name, depth, s.names.maxDepth)}
+		}
+	}
+	return nil
+}
+
+// checkMovedTree 检查把目录 src 移动到 dst 之后其中最深的目录是否超过 -max-depth。
+// 子树里的名字在创建时已经检查过，移动只改变层数
+func (s *Server) checkMovedTree(src, dst string) *APIError {
+	if s.names.maxDepth <= 0 {
+		return nil
+	}
+	root, _ := filepath.Abs(s.dir)
+	rel, err := filepath.Rel(root, dst)
+	if err != nil {
+		return nil
+	}
+	base := strings.Count(filepath.ToSlash(rel), "/") + 1
+	var deepest string
+	below := 0
+	filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || p == src {
+			return nil
+		}
+		if r, err := filepath.Rel(src, p); err == nil {
+			if n := strings.Count(filepath.ToSlash(r), "/") + 1; n > below {
+				below, deepest = n, filepath.Base(p)
+			}
+		}
+		if base+below > s.names.maxDepth {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if base+below > s.names.maxDepth {
+		if deepest == "" {
+			deepest = filepath.Base(dst)
+		}
+		return &APIError{Code: protocol.NamePolicyCode,
+			Message: fmt.Sprintf("max-depth: %q would be directory level %d, the limit is %d", deepest, base+below, s.names.maxDepth)}
+	}
+	return nil
+}
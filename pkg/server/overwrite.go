@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 覆盖已有文件 ---------- */
+
+// Config.Overwrite 的取值
+const (
+	OverwriteAllow   = "allow"   // 上传直接替换已有文件（默认）
+	OverwriteDeny    = "deny"    // 目标已存在时以 409 FILE_EXISTS 拒绝，请求带 overwrite=1 时放行
+	OverwriteVersion = "version" // 先把已有文件改名为 name.~1~、name.~2~ ……再放入新内容
+)
+
+func validOverwritePolicy(v string) error {
+	switch v {
+	case OverwriteAllow, OverwriteDeny, OverwriteVersion:
+		return nil
+	}
+	return fmt.Errorf("invalid -overwrite %q, expected one of %s|%s|%s", v, OverwriteAllow, OverwriteDeny, OverwriteVersion)
+}
+
+// forceOverwrite 判断请求是否要求覆盖（overwrite=1）
+func forceOverwrite(r *http.Request) bool {
+	return r.URL.Query().Get(protocol.OverwriteParam) == "1"
+}
+
+func fileExists(path string) *APIError {
+	return &APIError{Code: protocol.ExistsCode, Message: fmt.Sprintf("%s already exists and the server does not overwrite files; upload with overwrite=1 to replace it", path)}
+}
+
+// commitUpload 按覆盖策略把暂存文件 staged 重命名到目标 real。检查目标和重命名在 commitMu 下进行，
+// 同一路径的并发上传在 deny 模式下只有一个成功，在 version 模式下每个被替换的内容都留下一个版本。
+// 返回非空 *APIError 时目标已存在且不允许覆盖；backup 是 version 模式下已有文件的新名字
+func (s *Server) commitUpload(staged, real, path string, force bool) (backup string, rejected *APIError, err error) {
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+	fi, statErr := os.Lstat(real)
+	exists := statErr == nil
+	switch {
+	case !exists || s.overwrite == OverwriteAllow:
+	case s.overwrite == OverwriteDeny && !force:
+		return "", fileExists(path), nil
+	case s.overwrite == OverwriteVersion && fi.Mode().IsRegular():
+		if backup, err = nextVersion(real); err != nil {
+			return "", nil, err
+		}
+		if err := os.Rename(real, backup); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := os.Rename(staged, real); err != nil {
+		if backup != "" {
+			os.Rename(backup, real)
+		}
+		return "", nil, err
+	}
+	s.hashes.forget(real)
+	return backup, nil, nil
+}
+
+// nextVersion 返回 real 的下一个版本名：已有版本中最大的编号加一，与 cp --backup=numbered 相同
+func nextVersion(real string) (string, error) {
+	dir, base := filepath.Split(real)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	n := 0
+	for _, e := range entries {
+		rest, ok := strings.CutPrefix(e.Name(), base+".~")
+		if !ok || !strings.HasSuffix(rest, "~") {
+			continue
+		}
+		if v, err := strconv.Atoi(strings.TrimSuffix(rest, "~")); err == nil && v > n {
+			n = v
+		}
+	}
+	return fmt.Sprintf("%s.~%d~", real, n+1), nil
+}
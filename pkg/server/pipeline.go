@@ -0,0 +1,255 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+	"wsbox/internal/throttle"
+)
+
+/* ---------- 网关：流水线 ---------- */
+
+// 协商了流水线的连接（见 protocol.PipelineHeader）上，网关的读循环按帧开头的请求ID分发：
+// 没见过的ID是一个新请求，在单独的协程中经 serve 转发，最多同时转发 n 个，其余的等待；
+// 已知ID的帧（上传块、流控确认）放进该请求的队列，由它的 pipeStream 读取。
+// 各请求的写入经 pipeline.wmu 串行化，不同请求的帧在连接上交错，ID 保证客户端能对上号
+
+// pipelineBuffered 是一条连接上已收到、还没被请求读取的帧的总字节数上限，
+// 客户端不按协商的并发数发送请求时可能超过，此时以 1008 关闭连接
+const pipelineBuffered = 64 << 20
+
+// negotiatePipeline 取客户端请求的并发数与 -pipeline 中的较小值，0表示不使用流水线
+func negotiatePipeline(requested string, max int) int {
+	return negotiateWindow(requested, max)
+}
+
+type pipeFrame struct {
+	typ  int
+	data []byte
+}
+
+// pipeline 是一条流水线连接上正在转发的请求
+type pipeline struct {
+	conn *websocket.Conn
+	wmu  sync.Mutex        // 串行化写入
+	bw   *throttle.Limiter // 会话的带宽限制，读循环和各请求的写入共用
+
+	mu       sync.Mutex
+	streams  map[uint64]*pipeStream
+	buffered int   // 各队列中的总字节数
+	err      error // 读循环退出的原因，之后所有读取都返回它
+}
+
+// pipeStream 是流水线连接上的一个请求，实现 frameConn：读取该请求的帧，写出的帧带上它的ID
+type pipeStream struct {
+	p        *pipeline
+	id       uint64
+	queue    []pipeFrame   // 由 p.mu 保护
+	ready    chan struct{} // 容量1，队列有新帧或连接出错时通知
+	deadline time.Time     // 只由转发该请求的协程设置和读取
+}
+
+// open 登记一个新请求，等待和正在转发的请求超过 limit 时返回 nil
+func (p *pipeline) open(id uint64, limit int) *pipeStream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.streams) >= limit {
+		return nil
+	}
+	st := &pipeStream{p: p, id: id, ready: make(chan struct{}, 1)}
+	p.streams[id] = st
+	return st
+}
+
+// deliver 把帧放进请求 id 的队列，id 不是正在进行的请求时返回 false。
+// overflow 表示排队的数据超过了 pipelineBuffered
+func (p *pipeline) deliver(id uint64, typ int, data []byte) (known, overflow bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st, ok := p.streams[id]
+	if !ok {
+		return false, false
+	}
+	st.queue = append(st.queue, pipeFrame{typ, data})
+	p.buffered += len(data)
+	st.notify()
+	return true, p.buffered > pipelineBuffered
+}
+
+// finish 注销请求 id，之后它的帧（如迟到的确认）被丢弃
+func (p *pipeline) finish(st *pipeStream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, f := range st.queue {
+		p.buffered -= len(f.data)
+	}
+	st.queue = nil
+	delete(p.streams, st.id)
+}
+
+// active 返回等待和正在转发的请求数
+func (p *pipeline) active() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.streams)
+}
+
+// fail 记下读循环退出的原因并唤醒所有等待帧的请求
+func (p *pipeline) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+	for _, st := range p.streams {
+		st.notify()
+	}
+}
+
+func (st *pipeStream) notify() {
+	select {
+	case st.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (st *pipeStream) ReadMessage() (int, []byte, error) {
+	var timeout <-chan time.Time
+	if !st.deadline.IsZero() {
+		t := time.NewTimer(time.Until(st.deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+	for {
+		st.p.mu.Lock()
+		if len(st.queue) > 0 {
+			f := st.queue[0]
+			st.queue = st.queue[1:]
+			st.p.buffered -= len(f.data)
+			st.p.mu.Unlock()
+			return f.typ, f.data, nil
+		}
+		err := st.p.err
+		st.p.mu.Unlock()
+		if err != nil {
+			return 0, nil, err
+		}
+		select {
+		case <-st.ready:
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (st *pipeStream) WriteMessage(typ int, data []byte) error {
+	// 在取得写锁之前等待，限速的请求不挡住其他请求的状态帧
+	if typ == websocket.BinaryMessage {
+		st.p.bw.Wait(len(data))
+	}
+	st.p.wmu.Lock()
+	defer st.p.wmu.Unlock()
+	return st.p.conn.WriteMessage(typ, protocol.TagFrame(st.id, data))
+}
+
+func (st *pipeStream) SetReadDeadline(t time.Time) error {
+	st.deadline = t
+	return nil
+}
+
+// servePipeline 是流水线连接的读循环，n 是协商的并发数。返回前等待所有请求结束
+func (s *Server) servePipeline(r *http.Request, sess *session, t transfer, keepAlive bool, n int) {
+	conn := sess.conn
+	p := &pipeline{conn: conn, bw: sess.bw, streams: map[uint64]*pipeStream{}}
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	draining := false
+	defer func() {
+		// 连接已不可用，正在转发的请求读写都会失败
+		conn.Close()
+		wg.Wait()
+	}()
+
+	bucket := newTokenBucket(s.rateLimit)
+	for {
+		extendRead(conn, s.idleTimeout)
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			s.noteReadLimit(r.RemoteAddr, err)
+			if isIdleTimeout(err) {
+				logf("closing idle connection from %s after %s", r.RemoteAddr, s.idleTimeout)
+			}
+			p.fail(err)
+			return
+		}
+		id, payload, ok := protocol.SplitFrame(msg)
+		if !ok {
+			sess.closeWith(websocket.CloseProtocolError, "frame without a request id")
+			p.fail(websocket.ErrCloseSent)
+			return
+		}
+		if known, overflow := p.deliver(id, msgType, payload); overflow {
+			logf("closing pipelined connection from %s: over %d bytes buffered", r.RemoteAddr, pipelineBuffered)
+			sess.closeWith(websocket.ClosePolicyViolation, "too much pipelined data")
+			p.fail(websocket.ErrCloseSent)
+			return
+		} else if known {
+			if msgType == websocket.BinaryMessage {
+				p.bw.Wait(len(payload))
+			}
+			continue
+		}
+
+		// 不属于正在进行的请求：新请求，或已结束请求的迟到帧（确认、被拒绝上传的正文块），后者忽略
+		if msgType != websocket.TextMessage {
+			continue
+		}
+		if _, ok := parseAck(msgType, payload); ok {
+			continue
+		}
+		req, ok := t.parseRequest(payload)
+		if !ok || draining {
+			continue
+		}
+		bucket.wait()
+		// 正在关闭时不再接受新请求，进行中的请求结束后关闭连接
+		if !s.drain.enter() {
+			draining = true
+			go func() {
+				wg.Wait()
+				sess.closeWith(protocol.CloseGoingAway, protocol.ShutdownReason)
+			}()
+			continue
+		}
+		// 等待的请求也占用队列，客户端最多应有 n 个请求在途，留出同样多的余量
+		st := p.open(id, 2*n)
+		if st == nil {
+			s.drain.leave()
+			logf("closing pipelined connection from %s: over %d requests pending", r.RemoteAddr, 2*n)
+			sess.closeWith(websocket.ClosePolicyViolation, "too many pipelined requests")
+			p.fail(websocket.ErrCloseSent)
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			ok := s.serve(st, sess, r.RemoteAddr, t, keepAlive, req)
+			<-sem
+			p.finish(st)
+			s.drain.leave()
+			switch {
+			case !ok && sess.isRevoked():
+				sess.terminate()
+			case !ok:
+				conn.Close()
+			case s.drain.draining() && p.active() == 0:
+				// 关闭期间最后一个完成的请求
+				sess.closeWith(protocol.CloseGoingAway, protocol.ShutdownReason)
+			}
+		}()
+	}
+}
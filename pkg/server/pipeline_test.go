@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"wsbox/internal/protocol"
+	"wsbox/pkg/client"
+)
+
+// 一条流水线连接上的所有 lane 同时上传、下载、查看和列出，每个请求都经过 proxy 和 roundTrip，
+// 正文块、确认和状态头在连接上交错。用 go test -race 运行时同时检查网关、roundTrip 和流控的数据竞争
+func TestPipelineStress(t *testing.T) {
+	const lanes, rounds = 8, 24
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+	_, url := newTestGateway(t, Config{Pipeline: lanes, FlowWindow: 4})
+	cl, err := client.DialContext(context.Background(), url, testToken, client.Options{Pipeline: lanes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if cl.Pipelined() != lanes {
+		t.Fatalf("negotiated %d lanes, want %d", cl.Pipelined(), lanes)
+	}
+	clients := []*client.Client{cl}
+	for len(clients) < lanes {
+		l, err := cl.Lane()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		clients = append(clients, l)
+	}
+	if _, err := cl.Lane(); err != client.ErrNoLane {
+		t.Fatalf("lane beyond the negotiated limit: %v, want ErrNoLane", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, lanes)
+	for g, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- pipelineWorker(c, g, rounds)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	// 全部完成后连接仍然可用，每个 lane 的文件都在
+	for g := range clients {
+		res, err := cl.List(fmt.Sprintf("/lane%d", g))
+		if err != nil {
+			t.Fatalf("list after the stress run: %v", err)
+		}
+		if len(res.Entries) != rounds {
+			t.Errorf("/lane%d has %d files, want %d", g, len(res.Entries), rounds)
+		}
+	}
+}
+
+// pipelineWorker 在一个 lane 上依次上传、下载并核对 rounds 个文件，大小从空文件到两个流控块不等，
+// 每隔几个是一个超过流控窗口（4块）的文件，下载时窗口会用满
+func pipelineWorker(c *client.Client, g, rounds int) error {
+	rng := rand.New(rand.NewSource(int64(g)))
+	for i := range rounds {
+		size := rng.Intn(2*protocol.FlowChunkSize + 17)
+		if i%8 == 3 {
+			size = 5*protocol.FlowChunkSize + rng.Intn(1000)
+		}
+		data := make([]byte, size)
+		rng.Read(data)
+		remote := fmt.Sprintf("/lane%d/f%02d.bin", g, i)
+		if _, err := c.Upload(remote, bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("lane %d: upload %s: %w", g, remote, err)
+		}
+		var got bytes.Buffer
+		if _, err := c.Download(remote, &got); err != nil {
+			return fmt.Errorf("lane %d: download %s: %w", g, remote, err)
+		}
+		if !bytes.Equal(got.Bytes(), data) {
+			return fmt.Errorf("lane %d: %s came back as %d bytes, uploaded %d", g, remote, got.Len(), len(data))
+		}
+		st, err := c.Stat(remote)
+		if err != nil || st.Size != int64(len(data)) {
+			return fmt.Errorf("lane %d: stat %s = %+v, %v", g, remote, st, err)
+		}
+		if i%6 == 0 {
+			if _, err := c.ListLong(fmt.Sprintf("/lane%d", g)); err != nil {
+				return fmt.Errorf("lane %d: list: %w", g, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 进度帧：长时间操作的保活 ---------- */
+
+// 帧格式见 protocol.ProgressHeader。旧版客户端不发送该头，不会收到进度帧
+
+// progressIDHeader 由网关转发给本地处理器，用于找到对应的进度
+const progressIDHeader = "X-Wsbox-Request"
+
+// progressInterval 是发送进度帧的间隔，测试中缩短
+var progressInterval = protocol.ProgressInterval
+
+// progress 是一个进行中请求的进度，处理器更新、网关定期读取。
+// 方法对 nil 接收者是空操作，处理器不必关心请求是否来自协商了进度帧的连接
+type progress struct {
+	done  atomic.Int64
+	phase atomic.Value // string
+}
+
+// begin 进入新的阶段，计数从0开始
+func (p *progress) begin(phase string) {
+	if p != nil {
+		p.done.Store(0)
+		p.phase.Store(phase)
+	}
+}
+
+func (p *progress) add(n int64) {
+	if p != nil {
+		p.done.Add(n)
+	}
+}
+
+func (p *progress) snapshot() protocol.ProgressInfo {
+	phase, _ := p.phase.Load().(string)
+	if phase == "" {
+		phase = "running"
+	}
+	return protocol.ProgressInfo{Done: p.done.Load(), Phase: phase}
+}
+
+// progressRegistry 记录网关转发中的请求，按请求ID查找
+type progressRegistry struct {
+	next atomic.Uint64
+	m    sync.Map // uint64 -> *progress
+}
+
+var inflight progressRegistry
+
+// track 返回本地处理器当前请求的进度，请求没有经过协商了进度帧的网关时返回 nil
+func track(r *http.Request) *progress {
+	id, err := strconv.ParseUint(r.Header.Get(progressIDHeader), 10, 64)
+	if err != nil {
+		return nil
+	}
+	p, _ := inflight.m.Load(id)
+	pr, _ := p.(*progress)
+	return pr
+}
+
+// emitProgress 为一个转发中的请求登记进度，并在后台定期发送进度帧。
+// 返回的 stop 在写响应之前调用，它等待发送协程退出，保证连接上同一时间只有一个写者
+func emitProgress(conn frameConn, req *http.Request) (stop func()) {
+	id := inflight.next.Add(1)
+	p := &progress{}
+	inflight.m.Store(id, p)
+	req.Header.Set(progressIDHeader, strconv.FormatUint(id, 10))
+
+	quit := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-t.C:
+				b, _ := json.Marshal(protocol.ProgressFrame{ID: id, Progress: p.snapshot()})
+				if conn.WriteMessage(websocket.TextMessage, b) != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-exited
+		inflight.m.Delete(id)
+	}
+}
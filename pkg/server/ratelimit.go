@@ -0,0 +1,195 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/throttle"
+)
+
+/* ---------- 服务端：认证失败锁定、请求限速与带宽限制 ---------- */
+
+// 同一个IP在 -auth-fail-window 内认证失败 -auth-fail-limit 次后被锁定一个窗口的时间，
+// 期间网关对它的所有升级请求（包括token正确的）回复 429 和 Retry-After，不再检查token。
+// 锁定和解除都写入访问日志（LOCKOUT、RELEASE）。
+// -rate-limit 限制每条连接每秒的请求数：网关读循环在转发请求之前从令牌桶取令牌，取不到时等待，
+// 正文帧和流控确认不计入。
+// -bwlimit-per-conn 限制每条连接每秒的正文字节数，上传和下载共用会话的令牌桶（session.bw）：
+// 读取二进制帧之后、写出二进制帧之前按帧的长度等待。流水线连接在读循环中等待，
+// 让超速的上传停在 TCP 上，而不是堆进各请求的队列
+
+// authFailPruneSize 是失败记录的数量超过它时顺带清理过期记录的阈值，避免扫描过来的大量IP占用内存
+const authFailPruneSize = 1024
+
+// authLimiter 记录各IP最近的认证失败，由所有连接共用
+type authLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu    sync.Mutex
+	fails map[string][]time.Time // 窗口内的失败时间，从旧到新
+	until map[string]time.Time   // 锁定中的IP和解除时间
+}
+
+func newAuthLimiter(limit int, window time.Duration) *authLimiter {
+	if window <= 0 {
+		window = time.Minute
+	}
+	return &authLimiter{limit: max(limit, 0), window: window, fails: map[string][]time.Time{}, until: map[string]time.Time{}}
+}
+
+// remoteIP 返回请求来源的IP，不含端口
+func remoteIP(r *http.Request) string {
+	return hostOnly(r.RemoteAddr)
+}
+
+// hostOnly 去掉地址中的端口，没有端口时原样返回
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// locked 返回 ip 的锁定还剩多久，没有锁定时为0
+func (l *authLimiter) locked(ip string) time.Duration {
+	if l.limit == 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return max(time.Until(l.until[ip]), 0)
+}
+
+// fail 记录一次认证失败，达到上限时锁定 ip 并返回 true
+func (l *authLimiter) fail(ip string) bool {
+	if l.limit == 0 {
+		return false
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.fails) > authFailPruneSize {
+		for k, ts := range l.fails {
+			if now.Sub(ts[len(ts)-1]) > l.window {
+				delete(l.fails, k)
+			}
+		}
+	}
+	ts := append(l.fails[ip], now)
+	for len(ts) > 0 && now.Sub(ts[0]) > l.window {
+		ts = ts[1:]
+	}
+	if len(ts) < l.limit {
+		l.fails[ip] = ts
+		return false
+	}
+	delete(l.fails, ip)
+	l.until[ip] = now.Add(l.window)
+	time.AfterFunc(l.window, func() { l.release(ip) })
+	return true
+}
+
+// succeed 在认证成功后清除 ip 的失败记录
+func (l *authLimiter) succeed(ip string) {
+	if l.limit == 0 {
+		return
+	}
+	l.mu.Lock()
+	delete(l.fails, ip)
+	l.mu.Unlock()
+}
+
+func (l *authLimiter) release(ip string) {
+	l.mu.Lock()
+	delete(l.until, ip)
+	l.mu.Unlock()
+	logEvent(logEntry{IP: ip, Action: "RELEASE", Detail: "authentication lockout ended"})
+}
+
+// checkAuth 检查升级请求的来源是否被锁定以及token是否正确，不通过时写好响应并返回 false
+func (s *Server) checkAuth(w http.ResponseWriter, r *http.Request) bool {
+	ip := remoteIP(r)
+	if left := s.authFails.locked(ip); left > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(left.Seconds()))))
+		http.Error(w, "too many failed authentication attempts", http.StatusTooManyRequests)
+		return false
+	}
+	if !s.authorized(r) {
+		s.metrics.authFailures.Add(1)
+		if s.authFails.fail(ip) {
+			logEvent(logEntry{IP: ip, Action: "LOCKOUT", Status: http.StatusTooManyRequests,
+				Detail: fmt.Sprintf("%d failed authentications within %s, locked for %s", s.authFails.limit, s.authFails.window, s.authFails.window)})
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	s.authFails.succeed(ip)
+	return true
+}
+
+// tokenBucket 是一条连接的请求令牌桶，只在该连接的读循环中使用
+type tokenBucket struct {
+	rate   float64 // 每秒补充的令牌，0表示不限速
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket 返回每秒 rate 个请求的令牌桶，允许一秒的突发（至少1个）
+func newTokenBucket(rate float64) *tokenBucket {
+	burst := max(rate, 1)
+	return &tokenBucket{rate: max(rate, 0), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait 取一个令牌，桶空时等到补充出一个为止
+func (b *tokenBucket) wait() {
+	if b.rate == 0 {
+		return
+	}
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		d := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		time.Sleep(d)
+		b.tokens, b.last = 1, now.Add(d)
+	}
+	b.tokens--
+}
+
+// throttledConn 让经过它的二进制帧按连接的带宽限制等待，文本帧（请求头、状态、确认）不计入
+type throttledConn struct {
+	frameConn
+	bw *throttle.Limiter
+}
+
+// throttleConn 返回按 bw 限速的 conn，bw 为 nil 时原样返回
+func throttleConn(conn frameConn, bw *throttle.Limiter) frameConn {
+	if bw == nil {
+		return conn
+	}
+	return &throttledConn{frameConn: conn, bw: bw}
+}
+
+func (c *throttledConn) ReadMessage() (int, []byte, error) {
+	typ, data, err := c.frameConn.ReadMessage()
+	if err == nil && typ == websocket.BinaryMessage {
+		c.bw.Wait(len(data))
+	}
+	return typ, data, err
+}
+
+func (c *throttledConn) WriteMessage(typ int, data []byte) error {
+	if typ == websocket.BinaryMessage {
+		c.bw.Wait(len(data))
+	}
+	return c.frameConn.WriteMessage(typ, data)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"wsbox/pkg/client"
+)
+
+// 传输 1 MiB 的时间与限速相符：服务端的 -bwlimit-per-conn 和客户端的 -bwlimit 分别起作用，容差很宽
+func TestBandwidthLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing test")
+	}
+	const rate, n = 2 << 20, 1 << 20
+	data := bytes.Repeat([]byte("b"), n)
+	timed := func(what string, f func() error) {
+		t.Helper()
+		start := time.Now()
+		if err := f(); err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		// 1 MiB 在 2 MiB/s 下约 500ms，不限速时本机只要几毫秒
+		if d := time.Since(start); d < 350*time.Millisecond || d > 2*time.Second {
+			t.Errorf("%s of %d bytes at %d B/s took %v, want about 500ms", what, n, rate, d)
+		}
+	}
+
+	_, url := newTestGateway(t, Config{BandwidthLimit: rate})
+	cl, err := client.Dial(url, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	timed("upload with -bwlimit-per-conn", func() error {
+		_, err := cl.Upload("/a.bin", bytes.NewReader(data))
+		return err
+	})
+	timed("download with -bwlimit-per-conn", func() error {
+		_, err := cl.Download("/a.bin", io.Discard)
+		return err
+	})
+
+	_, url = newTestGateway(t, Config{})
+	limited, err := client.DialContext(context.Background(), url, testToken, client.Options{BandwidthLimit: rate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limited.Close()
+	timed("upload with -bwlimit", func() error {
+		_, err := limited.Upload("/a.bin", bytes.NewReader(data))
+		return err
+	})
+	timed("download with -bwlimit", func() error {
+		_, err := limited.Download("/a.bin", io.Discard)
+		return err
+	})
+}
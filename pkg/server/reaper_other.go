@@ -0,0 +1,6 @@
+//go:build !unix
+
+package server
+
+// StartReaper 只在类 Unix 系统上作为 PID 1 时需要
+func StartReaper() {}
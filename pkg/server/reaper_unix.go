@@ -0,0 +1,51 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// reapInterval 兜底的回收周期：收到 SIGCHLD 时可能恰好有命令在运行而跳过了回收
+const reapInterval = 5 * time.Second
+
+// StartReaper 在作为 PID 1 运行时回收被托孤的子进程（例如扫描脚本在后台启动的进程），
+// 否则它们会一直作为僵尸进程占用进程表。不是 PID 1 时由真正的 init 负责
+func StartReaper() {
+	if os.Getpid() != 1 {
+		return
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGCHLD)
+	go func() {
+		t := time.NewTicker(reapInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-sigs:
+			case <-t.C:
+			}
+			reapOrphans()
+		}
+	}()
+	logf("running as PID 1, reaping orphaned child processes")
+}
+
+// reapOrphans 回收所有已退出的子进程。wait4(-1) 会抢走 exec.Cmd.Wait 的退出状态，
+// 所以只在没有命令运行时回收
+func reapOrphans() {
+	if !childMu.TryLock() {
+		return
+	}
+	defer childMu.Unlock()
+	for {
+		var ws syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err != nil || pid <= 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"wsbox/internal/protocol"
+	"wsbox/internal/throttle"
+)
+
+/* ---------- 服务端：HTTP 接口 ---------- */
+
+// 网关上除 /ws 之外还有一组普通 HTTP 接口，curl 和浏览器的链接不必会说 websocket：
+//
+//	GET    /files/<path>   下载，支持 Range 和条件请求
+//	POST   /files/<path>   上传，正文就是文件内容
+//	DELETE /files/<path>   删除，?recursive=1 删除目录
+//	GET    /api/list?dir=  列出目录，参数与 /_list 相同
+//
+// 每个请求单独认证（Authorization: Bearer 或 ?token=，失败计入 -auth-fail-limit），token的权限与 websocket 会话一样在转发之前检查，
+// 然后直接交给本地处理器：SecurePath、只读、大小限制、钩子、日志和指标都与 websocket 请求相同。
+// 正文在请求和响应之间直接流过，不在内存中缓冲。查询参数原样转交，如 ?overwrite=1、?digest=sha256
+
+// restFilesPrefix 是文件接口的路径前缀
+const restFilesPrefix = "/files/"
+
+// restHandler 返回网关上的 HTTP 接口，挂在 /files/ 和 /api/list 上
+func (s *Server) restHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files/{path...}", s.restFiles)
+	mux.HandleFunc("POST /files/{path...}", s.restFiles)
+	mux.HandleFunc("DELETE /files/{path...}", s.restFiles)
+	mux.HandleFunc("GET /api/list", func(w http.ResponseWriter, r *http.Request) {
+		s.restForward(w, r, "GET", (&url.URL{Path: "/_list", RawQuery: restQuery(r)}).RequestURI())
+	})
+	return mux
+}
+
+// restFiles 把 /files/<path> 转成本地处理器上对 /<path> 的同名请求，HEAD 按 GET 处理
+func (s *Server) restFiles(w http.ResponseWriter, r *http.Request) {
+	p := "/" + r.PathValue("path")
+	// 根目录下以 _ 开头的路径是本地处理器的接口（/_list、/_mkdir……），不能借文件接口调用
+	if strings.HasPrefix(path.Clean(p), "/_") {
+		writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH",
+			Message: "paths starting with /_ are reserved for the gateway's endpoints and cannot be reached through " + restFilesPrefix})
+		return
+	}
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	s.restForward(w, r, method, (&url.URL{Path: p, RawQuery: restQuery(r)}).RequestURI())
+}
+
+// restQuery 返回转交给本地处理器的查询参数：去掉 ?token=，token不会出现在处理器和日志中
+func restQuery(r *http.Request) string {
+	q := r.URL.Query()
+	if !q.Has(tokenParam) {
+		return r.URL.RawQuery
+	}
+	q.Del(tokenParam)
+	return q.Encode()
+}
+
+// restHeaders 是转交给本地处理器的请求头：下载的范围和条件请求。其余的请求头（包括网关与处理器之间的内部头）一律不转交
+var restHeaders = []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"}
+
+// restForward 认证 r，检查token的权限后把 method target 交给本地处理器，响应直接写入 w
+func (s *Server) restForward(w http.ResponseWriter, r *http.Request, method, target string) {
+	if !s.checkAuth(w, r) {
+		return
+	}
+	s.authMu.Lock()
+	tok, g, ok := s.lookupToken(r)
+	s.authMu.Unlock()
+	if !ok {
+		// 认证之后token被换掉
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if rejected := g.forbidden(method, target); rejected != nil {
+		urlPath, _, _ := strings.Cut(target, "?")
+		logEvent(logEntry{IP: r.RemoteAddr, Action: method, Path: urlPath, Status: http.StatusForbidden, Err: rejected.Message})
+		s.auditRejected(method, target, r.RemoteAddr, tok, http.StatusForbidden)
+		writeError(w, http.StatusForbidden, rejected)
+		return
+	}
+	if !s.drain.enter() {
+		w.Header().Set("Connection", "close")
+		writeError(w, http.StatusServiceUnavailable, &APIError{Code: "SHUTTING_DOWN", Message: protocol.ShutdownReason})
+		return
+	}
+	defer s.drain.leave()
+
+	lim := throttle.New(s.bwLimit)
+	req, err := http.NewRequestWithContext(r.Context(), method, target, throttle.Reader(r.Body, lim))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &APIError{Code: "BAD_REQUEST", Message: err.Error()})
+		return
+	}
+	req.RemoteAddr = r.RemoteAddr
+	req.RequestURI = target
+	req.ContentLength = r.ContentLength
+	req.Header.Set("X-Wsbox-Token", tokenFingerprint(tok))
+	if g.scope != "/" {
+		req.Header.Set(scopeHeader, g.scope)
+	}
+	for _, h := range restHeaders {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+	if lim != nil {
+		w = &throttledWriter{ResponseWriter: w, w: throttle.Writer(w, lim)}
+	}
+	s.metrics.instrument(s.auditing(s.localHandler))(w, req)
+}
+
+// throttledWriter 按 -bwlimit-per-conn 限制响应正文的速率
+type throttledWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) { return t.w.Write(p) }
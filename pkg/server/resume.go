@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：可续传的上传 ---------- */
+
+// 客户端以 POST <path>?offset=N&total=T 上传时，正文追加到同目录的部分上传文件（partialPath），
+// 追加前检查它的长度正好是 N。连接中断时部分上传文件保留下来，客户端用 GET /_upload_offset?path=
+// 查询已有的长度后从那里继续发送；长度达到 T 时按普通上传提交（运行提交前钩子并重命名到目标路径）
+
+// partialPath 返回目标路径对应的部分上传文件，它带有 tempMarker，列表和计数都不会显示
+func partialPath(real string) string {
+	return filepath.Join(filepath.Dir(real), "."+filepath.Base(real)+tempMarker+"partial")
+}
+
+// resumeParams 解析 offset 和 total 参数，没有 offset 时表示普通上传
+func resumeParams(r *http.Request) (resume bool, offset, total int64, err error) {
+	q := r.URL.Query()
+	if !q.Has("offset") {
+		return false, 0, 0, nil
+	}
+	offset, err1 := strconv.ParseInt(q.Get("offset"), 10, 64)
+	total, err2 := strconv.ParseInt(q.Get("total"), 10, 64)
+	if err1 != nil || err2 != nil || offset < 0 || total < offset {
+		return false, 0, 0, fmt.Errorf("bad resume range offset=%q total=%q", q.Get("offset"), q.Get("total"))
+	}
+	return true, offset, total, nil
+}
+
+// openPartial 以追加方式打开部分上传文件，offset 为0时重新开始。已有长度与 offset 不一致时返回
+// OFFSET_MISMATCH，消息中带有实际长度，客户端应重新查询后再继续
+func openPartial(real string, offset int64) (*os.File, *APIError) {
+	part := partialPath(real)
+	if offset == 0 {
+		f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, &APIError{Code: "UPLOAD_FAILED", Message: err.Error()}
+		}
+		return f, nil
+	}
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, &APIError{Code: "OFFSET_MISMATCH", Message: fmt.Sprintf("no partial upload to resume at offset %d", offset)}
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, &APIError{Code: "UPLOAD_FAILED", Message: err.Error()}
+	}
+	if fi.Size() != offset {
+		f.Close()
+		return nil, &APIError{Code: "OFFSET_MISMATCH", Message: fmt.Sprintf("partial upload has %d bytes, not %d", fi.Size(), offset)}
+	}
+	return f, nil
+}
+
+// hashFile 计算整个文件的 SHA-256，续传的内容分几次写入，只能在提交前重新读取
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// handleUploadOffset 实现 GET /_upload_offset?path=，返回该路径的部分上传文件已有的字节数，没有时为0
+func (s *Server) handleUploadOffset(w http.ResponseWriter, r *http.Request, clientIP string) {
+	p, real, err := s.resolveSandboxPath(r, "path")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "OFFSET", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	res := protocol.UploadOffset{SchemaVersion: protocol.SchemaVersion, Path: p}
+	fi, err := os.Stat(partialPath(real))
+	if err == nil {
+		res.Offset = fi.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusInternalServerError, &APIError{Code: "STAT_FAILED", Message: err.Error()})
+		return
+	}
+	logEvent(logEntry{IP: clientIP, Action: "OFFSET", Path: p, Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("offset=%d", res.Offset)})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
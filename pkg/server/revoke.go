@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+	"wsbox/internal/throttle"
+)
+
+/* ---------- 服务端：token 吊销 ---------- */
+
+// 网关连接只在升级时检查一次token。SetToken 换掉token后，用旧token建立的会话被标记为已吊销：
+// 正在转发的请求被取消（上传的暂存文件由本地处理器删除，下载停止发送后续的块），
+// 之后收到的请求直接回复 401 UNAUTHORIZED；在 revokeGrace 内连接以 protocol.CloseTokenRevoked 关闭
+
+// revokeGrace 是吊销后连接最多还能保留的时间，客户端在此期间收到已中止请求的响应
+const revokeGrace = 2 * time.Second
+
+// session 是一条已认证的网关连接
+type session struct {
+	token string
+	conn  *websocket.Conn
+	bw    *throttle.Limiter // -bwlimit-per-conn，nil 表示不限
+
+	mu      sync.Mutex
+	grant   grant // 权限，重新读取 -tokens-file 时可能变化
+	revoked bool
+	cancels map[uint64]context.CancelFunc // 正在转发的请求，流水线连接上可能有多个
+	nextReq uint64
+	once    sync.Once
+}
+
+// begin 为一个请求创建可被吊销取消的上下文，请求结束时调用返回的 end；会话已吊销时返回 false
+func (ss *session) begin() (context.Context, func(), bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.revoked {
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if ss.cancels == nil {
+		ss.cancels = make(map[uint64]context.CancelFunc)
+	}
+	ss.nextReq++
+	id := ss.nextReq
+	ss.cancels[id] = cancel
+	end := func() {
+		ss.mu.Lock()
+		delete(ss.cancels, id)
+		ss.mu.Unlock()
+		cancel()
+	}
+	return ctx, end, true
+}
+
+// permissions 返回会话当前的权限
+func (ss *session) permissions() grant {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.grant
+}
+
+func (ss *session) setGrant(g grant) {
+	ss.mu.Lock()
+	ss.grant = g
+	ss.mu.Unlock()
+}
+
+func (ss *session) isRevoked() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.revoked
+}
+
+// revoke 标记会话并取消正在转发的请求，grace 之后无论连接处于什么状态都关闭它
+func (ss *session) revoke(grace time.Duration) {
+	ss.mu.Lock()
+	ss.revoked = true
+	for _, cancel := range ss.cancels {
+		cancel()
+	}
+	ss.mu.Unlock()
+	time.AfterFunc(grace, ss.terminate)
+}
+
+// terminate 以吊销为原因关闭连接
+func (ss *session) terminate() {
+	ss.closeWith(protocol.CloseTokenRevoked, protocol.TokenRevokedReason)
+}
+
+// closeWith 发送关闭帧并关闭连接，只执行一次。阻塞在读取上的协程随之返回，正在转发的请求被取消
+func (ss *session) closeWith(code int, reason string) {
+	ss.once.Do(func() {
+		msg := websocket.FormatCloseMessage(code, reason)
+		ss.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		ss.conn.Close()
+		ss.mu.Lock()
+		for _, cancel := range ss.cancels {
+			cancel()
+		}
+		ss.mu.Unlock()
+	})
+}
+
+// busy 判断会话是否有正在转发的请求
+func (ss *session) busy() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return len(ss.cancels) > 0
+}
+
+// unauthorized 是已吊销会话上新请求的响应
+func unauthorized() *http.Response {
+	return apiResponse(http.StatusUnauthorized, &APIError{Code: "UNAUTHORIZED", Message: protocol.TokenRevokedReason})
+}
+
+// apiResponse 构造网关不经本地处理器直接回复的错误响应
+func apiResponse(status int, e *APIError) *http.Response {
+	e.SchemaVersion = protocol.SchemaVersion
+	b, _ := json.Marshal(e)
+	return &http.Response{
+		StatusCode:    status,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		ContentLength: int64(len(b)),
+		Body:          io.NopCloser(bytes.NewReader(b)),
+	}
+}
+
+// authorized 检查请求携带的token是否为当前token或 -tokens-file 中的token
+func (s *Server) authorized(r *http.Request) bool {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	_, _, ok := s.lookupToken(r)
+	return ok
+}
+
+// openSession 登记一条已升级的连接并记下token的权限。升级期间token已被换掉时返回 nil，调用方应以吊销关闭连接
+func (s *Server) openSession(r *http.Request, conn *websocket.Conn) *session {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	tok, g, ok := s.lookupToken(r)
+	if !ok {
+		return nil
+	}
+	ss := &session{token: tok, grant: g, conn: conn, bw: throttle.New(s.bwLimit)}
+	if s.sessions == nil {
+		s.sessions = make(map[*session]struct{})
+	}
+	s.sessions[ss] = struct{}{}
+	return ss
+}
+
+func (s *Server) closeSession(ss *session) {
+	s.authMu.Lock()
+	delete(s.sessions, ss)
+	s.authMu.Unlock()
+}
+
+// SetToken 换掉客户端需要携带的token。用旧token建立的会话被吊销：正在进行的传输中止，
+// 连接在短暂的宽限期后以 "token revoked" 关闭。新token不会写入 Config.StateDir
+func (s *Server) SetToken(token string) error {
+	if token == "" || strings.ContainsAny(token, " \t\r\n") {
+		return errors.New("token must be non-empty and contain no whitespace")
+	}
+	s.authMu.Lock()
+	old := s.token
+	s.token = token
+	var revoked []*session
+	if token != old {
+		for ss := range s.sessions {
+			if ss.token == old {
+				revoked = append(revoked, ss)
+			}
+		}
+	}
+	s.authMu.Unlock()
+	if token == old {
+		return nil
+	}
+	for _, ss := range revoked {
+		ss.revoke(revokeGrace)
+	}
+	logf("token changed, revoked %d sessions", len(revoked))
+	return nil
+}
+
+// ReloadToken 重新读取 Config.TokenFile，没有指定时读取 Config.StateDir 下的token文件，内容变化时按 SetToken 吊销旧token。
+// 指定了固定token或没有 StateDir 时没有可重新读取的文件
+func (s *Server) ReloadToken() error {
+	if s.tokenPath != "" {
+		token, err := readTokenFile(s.tokenPath)
+		if err != nil {
+			return fmt.Errorf("reload token: %w", err)
+		}
+		return s.SetToken(token)
+	}
+	if s.fixedToken {
+		return errors.New("token is fixed by the configuration, nothing to reload")
+	}
+	if s.stateDir == "" {
+		return errors.New("no state directory, nothing to reload")
+	}
+	b, err := os.ReadFile(filepath.Join(s.stateDir, tokenFile))
+	if err != nil {
+		return fmt.Errorf("reload token: %w", err)
+	}
+	return s.SetToken(strings.TrimSpace(string(b)))
+}
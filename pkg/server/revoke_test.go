@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+	"wsbox/pkg/client"
+)
+
+// 下载进行到一半时换掉token：剩下的块不再发送，连接在宽限期内以 CloseTokenRevoked 关闭，
+// 旧token不能再建立连接，新token可以
+func TestRevokeDuringStreamingGet(t *testing.T) {
+	dir := t.TempDir()
+	big := bytes.Repeat([]byte("0123456789abcdef"), 64*protocol.FlowChunkSize/16) // 64 块
+	os.WriteFile(filepath.Join(dir, "big.bin"), big, 0o644)
+	s, url := newTestGateway(t, Config{Dir: dir, FlowWindow: 4})
+
+	conn := dialRaw(t, url, http.Header{protocol.VersionHeader: {strconv.Itoa(protocol.Version)}, protocol.FlowHeader: {"4"}})
+	sendRequest(t, conn, "GET", "/big.bin")
+	// 状态头和第一块到达后吊销，不发送确认，服务端停在窗口上
+	var received int
+	for i := 0; i < 2; i++ {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("before revoking: %v", err)
+		}
+		if i > 0 {
+			received += len(msg)
+		}
+	}
+	if err := s.SetToken("rotated-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(revokeGrace + 3*time.Second))
+	var err error
+	for err == nil {
+		var msg []byte
+		_, msg, err = conn.ReadMessage()
+		received += len(msg)
+	}
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != protocol.CloseTokenRevoked || ce.Text != protocol.TokenRevokedReason {
+		t.Fatalf("connection ended with %v, want close %d %q", err, protocol.CloseTokenRevoked, protocol.TokenRevokedReason)
+	}
+	if received >= len(big) {
+		t.Errorf("the whole file (%d bytes) was sent after the token was revoked", received)
+	}
+
+	if _, err := client.Dial(url, testToken); err == nil {
+		t.Error("the revoked token can still connect")
+	}
+	cl, err := client.Dial(url, "rotated-token")
+	if err != nil {
+		t.Fatalf("the new token cannot connect: %v", err)
+	}
+	defer cl.Close()
+	if _, err := cl.Download("/big.bin", io.Discard); err != nil {
+		t.Errorf("download with the new token: %v", err)
+	}
+}
+
+// 客户端库看到的是可以用 errors.As 取出的 CloseTokenRevoked，命令行据此以认证失败退出
+func TestRevokeDuringClientDownload(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "big.bin"), bytes.Repeat([]byte{1}, 64*protocol.FlowChunkSize), 0o644)
+	s, url := newTestGateway(t, Config{Dir: dir, FlowWindow: 4})
+	cl, err := client.Dial(url, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	w := &revokingWriter{revoke: func() { s.SetToken("rotated-token") }}
+	_, err = cl.Download("/big.bin", w)
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != protocol.CloseTokenRevoked {
+		t.Fatalf("Download = %v, want a close error with code %d", err, protocol.CloseTokenRevoked)
+	}
+}
+
+// revokingWriter 在第一次写入时调用 revoke，并放慢接收，让吊销发生在传输中途
+type revokingWriter struct {
+	revoke func()
+	n      int
+}
+
+func (w *revokingWriter) Write(b []byte) (int, error) {
+	if w.n == 0 {
+		w.revoke()
+	}
+	w.n += len(b)
+	time.Sleep(10 * time.Millisecond)
+	return len(b), nil
+}
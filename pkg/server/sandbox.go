@@ -0,0 +1,211 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/* ---------- 沙箱路径参数 ---------- */
+
+// maxPathParam 路径参数的最大长度（字节），与常见文件系统的 PATH_MAX 一致
+const maxPathParam = 4096
+
+// pathParams 是所有表示沙箱路径的查询参数名。新增接口若通过查询参数接收路径，
+// 必须在这里登记并通过 resolveSandboxPath（或 resolveLinkPath）读取；localHandler 在分发前会校验这些参数
+var pathParams = []string{"dir", "path", "src", "dst"}
+
+// resolveSandboxPath 是处理器读取路径的唯一入口。param 为空时使用请求路径本身，
+// 否则读取同名查询参数，空值视为根目录 "/"。返回用于日志和响应的原始路径以及沙箱内的真实路径（经过子目录限定和别名解析）。
+// 路径经过的符号链接按 -follow-symlinks 检查，见 checkSymlinks
+func (s *Server) resolveSandboxPath(r *http.Request, param string) (string, string, error) {
+	return s.resolvePath(r, param, true)
+}
+
+// resolveLinkPath 与 resolveSandboxPath 相同，但不检查路径的最后一级：删除和移动作用于链接本身，不经过它
+func (s *Server) resolveLinkPath(r *http.Request, param string) (string, string, error) {
+	return s.resolvePath(r, param, false)
+}
+
+func (s *Server) resolvePath(r *http.Request, param string, leaf bool) (string, string, error) {
+	raw := r.URL.Path
+	if param != "" {
+		if !isPathParam(param) {
+			// 编程错误：未登记的参数不会被 checkPathParams 覆盖
+			panic("resolvePath: unregistered path parameter " + param)
+		}
+		raw = r.URL.Query().Get(param)
+	}
+	if raw == "" {
+		raw = "/"
+	}
+	if err := validPathValue(raw); err != nil {
+		return raw, "", err
+	}
+	// 加上token限定的子目录、解析别名之后的路径同样要经过 SecurePath 校验
+	p, _, err := s.scopedPath(r, raw)
+	if err != nil {
+		return raw, "", err
+	}
+	real, err := SecurePath(p, s.dir)
+	if err == nil {
+		err = s.checkSymlinks(real, leaf)
+	}
+	return raw, real, err
+}
+
+func isPathParam(name string) bool {
+	for _, p := range pathParams {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validPathValue 拒绝 securePath 之外的危险输入：NUL 字节会在系统调用处截断路径，
+// 超长值和非 UTF-8 字节序列没有合法用途
+func validPathValue(v string) error {
+	switch {
+	case len(v) > maxPathParam:
+		return fmt.Errorf("path longer than %d bytes", maxPathParam)
+	case strings.IndexByte(v, 0) >= 0:
+		return errors.New("path contains a NUL byte")
+	case !utf8.ValidString(v):
+		return errors.New("path is not valid UTF-8")
+	}
+	return nil
+}
+
+// checkPathParams 在分发到具体处理器之前校验请求路径和所有登记的路径参数（包括重复出现的值），
+// 即使某个处理器遗漏了 resolveSandboxPath，越界的值也到不了它
+func (s *Server) checkPathParams(r *http.Request) error {
+	if err := validPathValue(r.URL.Path); err != nil {
+		return err
+	}
+	if _, err := SecurePath(r.URL.Path, s.dir); err != nil {
+		return err
+	}
+	q := r.URL.Query()
+	for _, name := range pathParams {
+		for _, v := range q[name] {
+			if err := validPathValue(v); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if _, err := SecurePath(v, s.dir); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SecureCreateDir 在沙箱 rootPath 内逐级创建目录 dirPath（绝对路径，通常来自 SecurePath）。
+// 已存在时直接返回；拒绝任何会越出沙箱的层级，路径上已有同名的文件时返回错误。
+// 深度和名字的规则（-max-depth 等）由处理器在创建之前通过 checkNewPath 检查
+func SecureCreateDir(dirPath, rootPath string) error {
+	absRoot, _ := filepath.Abs(rootPath)
+
+	relPath, err := filepath.Rel(absRoot, dirPath)
+	if err != nil {
+		return errors.New("invalid directory path")
+	}
+	if relPath == "." {
+		return nil
+	}
+	if !filepath.IsLocal(relPath) {
+		return errors.New("directory creation would escape sandbox")
+	}
+
+	// 通过 os.Root 逐级创建：每一级都相对已打开的根目录解析，某一级在检查之后被换成指向沙箱外的符号链接时
+	// 创建失败，而不是在链接的目标下建出目录
+	root, err := os.OpenRoot(absRoot)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	defer root.Close()
+	currentPath := ""
+	for _, part := range strings.Split(relPath, string(filepath.Separator)) {
+		currentPath = filepath.Join(currentPath, part)
+		if err := root.Mkdir(currentPath, 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+	}
+	// 最后一级可能早已存在，必须是目录
+	fi, err := root.Stat(relPath)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("failed to create directory: %s is not a directory", relPath)
+	}
+	return nil
+}
+
+// tempMarker 出现在上传暂存文件名中，形如 ".name.wsbox-tmp-123"
+const tempMarker = ".wsbox-tmp-"
+
+// isReservedName 判断文件名是否为wsbox内部使用（锁元数据、上传暂存文件），不允许客户端直接读写
+func isReservedName(name string) bool {
+	return strings.HasPrefix(name, ".") && (strings.HasSuffix(name, lockSuffix) || strings.Contains(name, tempMarker))
+}
+
+// staleTempAge 暂存文件超过这个时间没有写入即视为上次运行中断留下的孤儿。进行中的上传持续写入，修改时间不会这么旧
+const staleTempAge = time.Hour
+
+// sweepTemp 删除沙箱中的孤儿暂存文件（服务端在上传中途崩溃或被杀死时留下）。
+// 部分上传文件（partialPath）是有意保留给续传的，不在此列；只读模式下不改动沙箱
+func (s *Server) sweepTemp() {
+	if s.readOnly {
+		return
+	}
+	removed := 0
+	cutoff := time.Now().Add(-staleTempAge)
+	filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			// 解包上传的暂存目录（见 handleExtract）
+			if p != s.dir && isReservedName(name) {
+				if fi, err := d.Info(); err == nil && fi.ModTime().Before(cutoff) && os.RemoveAll(p) == nil {
+					removed++
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(name, ".") || !strings.Contains(name, tempMarker) || strings.HasSuffix(name, tempMarker+"partial") {
+			return nil
+		}
+		if fi, err := d.Info(); err == nil && fi.ModTime().Before(cutoff) && os.Remove(p) == nil {
+			removed++
+		}
+		return nil
+	})
+	if removed > 0 {
+		logf("removed %d stale upload temp files", removed)
+	}
+}
+
+// SecurePath 把客户端给出的路径映射到沙箱 root 内的绝对路径。路径总是按相对沙箱根目录解释，
+// 清理后仍含 ".." 或落在 root 之外时返回错误；不访问文件系统，也不解析符号链接
+func SecurePath(raw string, root string) (string, error) {
+	clean := filepath.Clean("/" + raw)
+	if strings.Contains(clean, "..") {
+		return "", errors.New("illegal path")
+	}
+	absRoot, _ := filepath.Abs(root)
+	target := filepath.Join(absRoot, clean)
+	if !strings.HasPrefix(target, absRoot) {
+		return "", errors.New("path escape")
+	}
+	return target, nil
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+func TestSecurePath(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		raw  string
+		want string // 相对 root，"" 表示 root 本身
+	}{
+		{"a/b.txt", "a/b.txt"},
+		{"", ""},
+		{"/", ""},
+		{"..", ""},
+		{"../../etc/passwd", "etc/passwd"},
+		{"a/../../b", "b"},
+		{"a/./b/../c", "a/c"},
+		{"/etc/passwd", "etc/passwd"},
+		{"//etc//passwd", "etc/passwd"},
+		{root + "/x", strings.TrimPrefix(root, "/") + "/x"},
+	}
+	for _, tt := range tests {
+		got, err := SecurePath(tt.raw, root)
+		if err != nil {
+			t.Errorf("SecurePath(%q): %v", tt.raw, err)
+			continue
+		}
+		if want := filepath.Join(root, tt.want); got != want {
+			t.Errorf("SecurePath(%q) = %q, want %q", tt.raw, got, want)
+		}
+	}
+}
+
+func TestValidPathValue(t *testing.T) {
+	tests := []struct {
+		v       string
+		wantErr string
+	}{
+		{"a/b.txt", ""},
+		{"../..", ""}, // 由 SecurePath 限制在沙箱内
+		{"a\x00b", "NUL byte"},
+		{"\x00", "NUL byte"},
+		{"a/\xff", "UTF-8"},
+		{strings.Repeat("a", maxPathParam+1), "longer than"},
+	}
+	for _, tt := range tests {
+		err := validPathValue(tt.v)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("validPathValue(%.20q): %v", tt.v, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("validPathValue(%.20q) = %v, want error containing %q", tt.v, err, tt.wantErr)
+		}
+	}
+}
+
+// 沙箱外放一个文件，通过各种写法的路径都不能读到、改动或删除它；".." 被限制在沙箱根上
+func TestLocalHandlerTraversal(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "sb")
+	os.Mkdir(dir, 0o755)
+	secret := filepath.Join(parent, "secret.txt")
+	os.WriteFile(secret, []byte("outside"), 0o644)
+	os.WriteFile(filepath.Join(dir, "inner.txt"), []byte("inside"), 0o644)
+	s := newTestServer(t, Config{Dir: dir})
+
+	reads := []string{
+		"/../secret.txt",
+		"/%2e%2e/secret.txt",
+		"/%2E%2E%2Fsecret.txt",
+		"/" + secret,
+		"/_stat?path=../secret.txt",
+		"/_stat?path=%2e%2e%2fsecret.txt",
+		"/_stat?path=" + url.QueryEscape(secret),
+		"/_tail?path=..%2F..%2Fsb%2F..%2Fsecret.txt",
+		"/_list?dir=..",
+		"/_find?dir=../..&name=secret.txt",
+		"/_archive?dir=..",
+	}
+	for _, target := range reads {
+		rec := httptest.NewRecorder()
+		s.localHandler(rec, httptest.NewRequest("GET", target, nil))
+		// 回复里可能原样带着请求的路径，只有请求里没写文件名时出现文件名才算泄露
+		body := rec.Body.String()
+		if strings.Contains(body, "outside") || !strings.Contains(target, "secret") && strings.Contains(body, "secret") {
+			t.Errorf("GET %s: response reveals the file outside the sandbox: %d %q", target, rec.Code, body)
+		}
+	}
+
+	// 限制在根上的 ".." 仍然可以访问沙箱内的文件
+	rec := httptest.NewRecorder()
+	s.localHandler(rec, httptest.NewRequest("GET", "/%2e%2e/%2e%2e/inner.txt", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "inside" {
+		t.Errorf("GET /../../inner.txt = %d %q, want the file in the sandbox root", rec.Code, rec.Body.String())
+	}
+
+	writes := []struct{ method, target string }{
+		{"POST", "/../escape.txt"},
+		{"POST", "/%2e%2e/escape.txt"},
+		{"POST", "/../escape.txt?append=1"},
+		{"POST", "/_mkdir?dir=../escape.txt"},
+		{"POST", "/_move?src=inner.txt&dst=..%2Fescape.txt"},
+		{"DELETE", "/../secret.txt"},
+		{"DELETE", "/" + secret},
+		{"POST", "/_move?src=../secret.txt&dst=stolen.txt"},
+	}
+	for _, w := range writes {
+		rec := httptest.NewRecorder()
+		s.localHandler(rec, httptest.NewRequest(w.method, w.target, strings.NewReader("payload")))
+		if _, err := os.Lstat(filepath.Join(parent, "escape.txt")); err == nil {
+			t.Fatalf("%s %s created a file outside the sandbox", w.method, w.target)
+		}
+		if b, err := os.ReadFile(secret); err != nil || string(b) != "outside" {
+			t.Fatalf("%s %s changed the file outside the sandbox: %v", w.method, w.target, err)
+		}
+	}
+}
+
+// fileRoutes 是 localRoutes 之外、作用于文件本身的请求，路径放在请求路径上
+var fileRoutes = []string{
+	"GET /f.txt",
+	"POST /f.txt",
+	"POST /f.txt?" + protocol.ExtractParam + "=zip",
+	"POST /f.txt?" + protocol.AppendParam + "=1",
+	"DELETE /f.txt",
+	"LOCK /f.txt",
+	"UNLOCK /f.txt",
+}
+
+// 遍历 localRoutes 的每个接口和每个路径参数：只有这一个参数带 NUL 时，回复必须是 checkPathParams 的
+// 400 INVALID_PATH（消息以参数名开头）。接口若在 checkPathParams 之前被分发，
+// 不读这个参数的接口会照常处理，读这个参数的接口给出的是它自己的错误
+func TestLocalRoutesCheckPathParams(t *testing.T) {
+	s := newTestServer(t, Config{})
+	os.WriteFile(filepath.Join(s.dir, "f.txt"), []byte("x"), 0o644)
+
+	routes := make([]string, 0, len(localRoutes))
+	for route := range localRoutes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	if len(routes) == 0 {
+		t.Fatal("localRoutes is empty")
+	}
+	for _, route := range routes {
+		method, target, _ := strings.Cut(route, " ")
+		if !strings.HasPrefix(target, "/_") {
+			t.Errorf("route %q: local routes must start with /_ so they cannot shadow a file", route)
+		}
+		for _, param := range pathParams {
+			rec := httptest.NewRecorder()
+			s.localHandler(rec, httptest.NewRequest(method, target+"?"+param+"=a%00b", strings.NewReader("x")))
+			want := param + ": path contains a NUL byte"
+			if e := decodeAPIError(rec); rec.Code != http.StatusBadRequest || e == nil || e.Code != "INVALID_PATH" || e.Message != want {
+				t.Errorf("%s?%s=a%%00b: got %d %q, want 400 INVALID_PATH %q", route, param, rec.Code, strings.TrimSpace(rec.Body.String()), want)
+			}
+		}
+	}
+
+	for _, route := range fileRoutes {
+		method, target, _ := strings.Cut(route, " ")
+		p, query, _ := strings.Cut(target, "?")
+		rec := httptest.NewRecorder()
+		s.localHandler(rec, httptest.NewRequest(method, p+"%00?"+query, strings.NewReader("x")))
+		if e := decodeAPIError(rec); rec.Code != http.StatusBadRequest || e == nil || e.Code != "INVALID_PATH" {
+			t.Errorf("%s with a NUL byte in the path: got %d %q, want 400 INVALID_PATH", route, rec.Code, strings.TrimSpace(rec.Body.String()))
+		}
+		if b, err := os.ReadFile(filepath.Join(s.dir, "f.txt")); err != nil || string(b) != "x" {
+			t.Fatalf("%s with a NUL byte in the path changed f.txt: %v", route, err)
+		}
+	}
+}
+
+// resolvePath 只接受登记在 pathParams 里的参数，否则 checkPathParams 覆盖不到
+func TestResolvePathUnregisteredParam(t *testing.T) {
+	s := newTestServer(t, Config{})
+	defer func() {
+		if recover() == nil {
+			t.Error("resolveSandboxPath with an unregistered parameter did not panic")
+		}
+	}()
+	s.resolveSandboxPath(httptest.NewRequest("GET", "/_stat?target=x", nil), "target")
+}
+
+func TestSecureCreateDir(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(root, "file"), []byte("x"), 0o644)
+	os.Symlink(outside, filepath.Join(root, "link"))
+
+	for _, rel := range []string{"a", "a/b/c", "a/b/c", "x/../y"} {
+		if err := SecureCreateDir(root+"/"+rel, root); err != nil {
+			t.Errorf("SecureCreateDir(%q): %v", rel, err)
+		}
+		if fi, err := os.Lstat(filepath.Join(root, rel)); err != nil || !fi.IsDir() {
+			t.Errorf("SecureCreateDir(%q) did not leave a directory: %v", rel, err)
+		}
+	}
+	if err := SecureCreateDir(root, root); err != nil {
+		t.Errorf("SecureCreateDir(root): %v", err)
+	}
+
+	for _, rel := range []string{
+		"..",
+		"../escape",
+		"a/../../escape",
+		"file",        // 目标已是文件
+		"file/sub",    // 路径中间有文件
+		"link/sub",    // 中间一级是指向沙箱外的符号链接
+		"link/sub/x2", // 同上，多级
+	} {
+		if err := SecureCreateDir(root+"/"+rel, root); err == nil {
+			t.Errorf("SecureCreateDir(%q) succeeded, want an error", rel)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escape")); err == nil {
+		t.Error("a directory was created next to the sandbox")
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("directories were created through the symlink: %v", entries)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "file")); string(b) != "x" {
+		t.Errorf("the existing file was changed: %q", b)
+	}
+}
+
+// 创建过程中中间一级目录不断地被换成指向沙箱外的符号链接：无论换在哪一步，都不会在沙箱外建出目录
+func TestSecureCreateDirSymlinkSwap(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	mid := filepath.Join(root, "mid")
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			os.RemoveAll(mid)
+			os.Mkdir(mid, 0o755)
+			os.RemoveAll(mid)
+			os.Symlink(outside, mid)
+		}
+	}()
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		SecureCreateDir(filepath.Join(mid, "a", "b"), root)
+	}
+	close(stop)
+	<-done
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("directories were created outside the sandbox: %v", entries)
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+/* ---------- 服务端：上传内容扫描 ---------- */
+
+// contentScanner 检查暂存的上传文件。clean 为 false 时 verdict 给出拒绝原因；
+// err 非空表示扫描器本身不可用，由 fail-open/fail-closed 策略决定结果
+type contentScanner interface {
+	name() string
+	scan(ctx context.Context, path string) (clean bool, verdict string, err error)
+}
+
+// commandScanner 执行外部命令，参数末尾追加暂存文件路径，退出码0表示通过
+type commandScanner struct {
+	argv []string
+}
+
+func (c *commandScanner) name() string { return "command" }
+
+func (c *commandScanner) scan(ctx context.Context, path string) (bool, string, error) {
+	cmd := exec.CommandContext(ctx, c.argv[0], append(c.argv[1:], path)...)
+	childMu.RLock()
+	out, err := cmd.CombinedOutput()
+	childMu.RUnlock()
+	if err == nil {
+		return true, "", nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		verdict := strings.TrimSpace(string(out))
+		if verdict == "" {
+			verdict = fmt.Sprintf("scanner exited with status %d", exitErr.ExitCode())
+		}
+		return false, verdict, nil
+	}
+	if ctx.Err() != nil {
+		return false, "", ctx.Err()
+	}
+	return false, "", err
+}
+
+// clamdScanner 使用 clamd 的 INSTREAM 协议把文件内容流式发送给扫描守护进程
+type clamdScanner struct {
+	addr string
+}
+
+func (c *clamdScanner) name() string { return "clamd" }
+
+func (c *clamdScanner) scan(ctx context.Context, path string) (bool, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, "", err
+	}
+	defer f.Close()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return false, "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return false, "", err
+	}
+	buf := make([]byte, 64*1024)
+	size := make([]byte, 4)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return false, "", err
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return false, "", err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, "", err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return false, "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return false, "", err
+	}
+	reply = strings.TrimRight(reply, "\x00\n")
+	// 回复形如 "stream: OK" 或 "stream: Eicar-Test-Signature FOUND"
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return true, "", nil
+	case strings.HasSuffix(result, "FOUND"):
+		return false, strings.TrimSpace(strings.TrimSuffix(result, "FOUND")), nil
+	default:
+		return false, "", fmt.Errorf("clamd: %s", reply)
+	}
+}
+
+// newScanners 根据命令行参数构造扫描器
+func newScanners(command, clamd string) ([]contentScanner, error) {
+	var scanners []contentScanner
+	if command != "" {
+		argv := strings.Fields(command)
+		scanners = append(scanners, &commandScanner{argv: argv})
+	}
+	if clamd != "" {
+		u, err := url.Parse(clamd)
+		if err != nil || u.Scheme != "tcp" || u.Host == "" {
+			return nil, fmt.Errorf("invalid -scan-clamd address %q, expected tcp://host:port", clamd)
+		}
+		scanners = append(scanners, &clamdScanner{addr: u.Host})
+	}
+	return scanners, nil
+}
+
+// scanUpload 依次运行所有扫描器。返回的 *APIError 非空时上传必须被拒绝
+func (s *Server) scanUpload(path, clientIP, staged string) *APIError {
+	for _, sc := range s.scanners {
+		ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+		start := time.Now()
+		clean, verdict, err := sc.scan(ctx, staged)
+		cancel()
+		elapsed := time.Since(start)
+
+		if err != nil {
+			if s.scanFailOpen {
+				logEvent(logEntry{IP: clientIP, Action: "SCAN", Path: path, Duration: elapsed, Detail: "scanner=" + sc.name() + " unavailable, accepted (fail-open)", Err: err.Error()})
+				continue
+			}
+			logEvent(logEntry{IP: clientIP, Action: "SCAN", Path: path, Status: http.StatusServiceUnavailable, Duration: elapsed, Detail: "scanner=" + sc.name() + " unavailable, rejected (fail-closed)", Err: err.Error()})
+			return &APIError{Code: "SCANNER_UNAVAILABLE", Message: "content scanner unavailable, upload refused"}
+		}
+		if !clean {
+			logEvent(logEntry{IP: clientIP, Action: "SCAN", Path: path, Status: http.StatusUnprocessableEntity, Duration: elapsed, Detail: "scanner=" + sc.name(), Err: fmt.Sprintf("rejected verdict=%q", verdict)})
+			return &APIError{Code: "CONTENT_REJECTED", Message: "upload rejected by content scanner", Verdict: verdict}
+		}
+		logEvent(logEntry{IP: clientIP, Action: "SCAN", Path: path, Duration: elapsed, Detail: "scanner=" + sc.name() + " clean"})
+	}
+	return nil
+}
+
+// scanHook 把内容扫描接入上传的提交前钩子
+func (s *Server) scanHook(ctx context.Context, ev TransferEvent) error {
+	if rejected := s.scanUpload(ev.Path, ev.ClientIP, ev.Staged); rejected != nil {
+		return &HookRejection{Status: verdictStatus(rejected), Err: rejected}
+	}
+	return nil
+}
+
+// verdictStatus 返回扫描拒绝对应的HTTP状态码
+func verdictStatus(e *APIError) int {
+	if e.Code == "SCANNER_UNAVAILABLE" {
+		return 503
+	}
+	return 422
+}
@@ -0,0 +1,578 @@
+// Package server 是 wsbox 的服务端：一个 websocket 网关，把每个请求在进程内交给本地文件处理器（localHandler）。命令行的 "wsbox server" 只是它的一层外壳，
+// 其他 Go 程序可以直接嵌入：
+//
+//	s, err := server.New(server.Config{Addr: ":8080", Dir: "./files", Token: "secret"})
+//	if err != nil { ... }
+//	go s.ListenAndServe()
+//	...
+//	s.Shutdown(ctx)
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"wsbox/internal/journal"
+	"wsbox/internal/protocol"
+	"wsbox/internal/textfmt"
+)
+
+/* ---------- 错误响应 ---------- */
+
+// APIError 是结构化的错误响应体，钩子通过 HookRejection 返回它
+type APIError = protocol.APIError
+
+func writeError(w http.ResponseWriter, status int, e *APIError) {
+	e.SchemaVersion = protocol.SchemaVersion
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+/* ---------- 配置 ---------- */
+
+// Config 是服务端的配置。Addr、Dir、SocketMode、StatConcurrency、ScanTimeout、UploadHookTimeout、UploadHookConcurrency、CaseCollision、Overwrite、NameCharset、AliasWrites、FindLimit、TreeLimit 为零值时使用默认值，
+// 其余字段的零值表示关闭对应功能（命令行的默认值见 "wsbox help"）
+type Config struct {
+	Addr      string // 网关监听地址，默认 ":8080"；unix:///run/wsbox.sock 监听 Unix 域套接字
+	Dir       string // 沙箱目录，默认当前目录
+	Token     string // 固定token，为空时在 Open 中生成
+	TokenFile string // 保存token的文件（取第一行），与 Token 互斥，在 Open 和 ReloadToken 时读取
+	CertFile  string // 网关的TLS证书与私钥，都为空时使用明文 ws://
+	KeyFile   string
+
+	WalkTimeout     time.Duration // 目录遍历类请求的时间预算，0表示不限
+	StatConcurrency int           // 遍历时并发 stat 的 worker 数，默认8
+	SlowLog         time.Duration // 超过该耗时的请求写入慢日志，0表示关闭
+	FindLimit       int           // GET /_find 一次最多返回的匹配数，默认1000
+	TreeLimit       int           // GET /_tree 一次最多返回的条目数，默认10000
+
+	ScanCommand  string        // 上传扫描命令，暂存文件路径追加在参数末尾
+	ScanClamd    string        // clamd 地址，形如 tcp://host:3310
+	ScanTimeout  time.Duration // 单个文件的扫描时限，默认30秒
+	ScanFailOpen bool          // 扫描器不可用时是否放行
+
+	UploadHook            string        // 上传重命名之前执行的命令，非零退出码以 422 拒绝，见 uploadhook.go
+	UploadHookTimeout     time.Duration // 单次执行的时限，默认30秒
+	UploadHookConcurrency int           // 同时执行的命令数上限，默认4
+
+	FlowWindow    int    // 下载流控窗口的上限（块），0表示关闭流控
+	CaseCollision string // 上传目标与已有条目仅大小写不同时的处理：CaseWarn（默认）、CaseReject、CaseAllow
+
+	StateDir string // 状态存储目录，为空时只保存在内存中
+
+	WarnDirEntries int // 目录条目数第一次超过该值时写警告日志，0表示关闭
+
+	ReadOnly bool // 只允许下载和列表，上传、删除、加锁等写操作以 403 拒绝
+
+	ActivitySize int // GET /_activity 保留的最近操作条数，0表示关闭
+
+	MaxUploadSize int64 // 单个上传的最大字节数，超过时以 413 拒绝，0表示不限
+
+	MaxMessageSize int64 // 网关读取的单个websocket消息的最大字节数，超过时以 1009 关闭连接，0表示不限；不小于 protocol.MinMessageSize
+
+	ExtractMaxSize  int64 // 解包上传解出的内容总量上限（字节），超过时以 422 拒绝，0表示不限
+	ExtractMaxEntry int64 // 解包上传中单个文件的大小上限（字节），0表示不限
+
+	Overwrite string // 上传目标已存在时的处理：OverwriteAllow（默认）、OverwriteDeny、OverwriteVersion
+
+	MaxDepth    int    // 新建目录在沙箱内的最大层数，0表示不限，见 names.go
+	MaxNameLen  int    // 新建目录和文件每一级名字的最大字节数，0表示不限
+	NameCharset string // 新建名字允许的字符：NameAny（默认）、NameWindowsSafe、NameStrict
+
+	HeavyOps   int // 同时进行的重操作（目录树遍历、递归删除）的配额，0表示不限
+	HeavyQueue int // 配额用完时最多排队的重操作请求数，再多的以 429 拒绝
+
+	MetricsAddr string // 单独提供 /metrics 的监听地址（不需要token），为空时挂在网关上、需要token
+
+	Aliases     []string // 路径别名，形如 "/old/reports=/archive/2023/reports"
+	AliasFile   string   // 每行一条别名的文件，在 Open 和 ReloadAliases 时读取
+	AliasWrites string   // 通过别名的写操作：AliasWritesDeny（默认）或 AliasWritesAllow
+
+	TokensFile string // 每行 "<token> <ro|rw> [子目录]" 的文件，这些token与 Token 一起有效，在 Open 和 ReloadTokens 时读取
+
+	AuthFailLimit  int           // 同一IP在 AuthFailWindow 内认证失败这么多次后锁定一个窗口的时间，期间回复 429，0表示关闭
+	AuthFailWindow time.Duration // 统计认证失败的窗口，也是锁定的时长，为0时取1分钟
+
+	RateLimit float64 // 每条连接每秒最多转发的请求数，超过时推迟处理，0表示不限
+
+	BandwidthLimit int64 // 每条连接每秒最多传输的正文字节数（上传和下载合计），0表示不限
+
+	PingInterval time.Duration // 网关向客户端发送 Ping 的间隔，0表示不发送
+	IdleTimeout  time.Duration // 网关连接在等待请求时这么久收不到任何帧就关闭，0表示不限
+
+	Pipeline int // 一条连接上同时转发的请求数上限（流水线，见 protocol.PipelineHeader），0表示不支持流水线
+
+	RejectLegacy bool // 以 426 拒绝只支持协议版本1（文本请求行）的客户端，见 protocol.VersionHeader
+
+	WebUI bool // 在网关的 / 上提供浏览器界面，见 webui.go
+
+	AuditLog   string // 审计日志文件，每个完成的操作追加一行 JSON，为空时不记录，见 auditlog.go
+	AuditChain bool   // 审计日志的每行带上前一行的 SHA-256
+
+	WebhookURL             string // 上传和删除成功后 POST 通知的地址，为空时不发送，见 webhook.go
+	WebhookSecret          string // 计算通知正文 HMAC-SHA256 签名的密钥，为空时不签名
+	WebhookSignatureHeader string // 签名所在的请求头，默认 DefaultWebhookSignatureHeader
+
+	AllowCIDR        []string // 只接受这些网段（或单个地址）的请求，为空时不限，见 ipfilter.go
+	DenyCIDR         []string // 拒绝这些网段的请求，优先于 AllowCIDR
+	TrustProxyHeader bool     // 客户端地址取自 X-Forwarded-For/X-Real-IP，只在网关位于反向代理之后时打开
+
+	SocketMode    os.FileMode // Addr 为 unix:// 时套接字文件的权限，0表示 DefaultSocketMode，见 unix.go
+	NoTokenOnUnix bool        // 经过 Unix 域套接字、不带token的请求获得完整权限
+
+	FollowSymlinks bool // 跟随沙箱内解析后仍在沙箱之内的符号链接，关闭时拒绝经过任何符号链接的路径，见 symlink.go
+
+	AllowedOrigins []string // 浏览器请求接受的 Origin（如 "https://app.example.com"，"*" 为任意），为空时不检查，见 cors.go
+}
+
+/* ---------- 服务端 ---------- */
+type Server struct {
+	addr            string
+	dir             string
+	token           string
+	fixedToken      bool
+	tokenPath       string // Config.TokenFile
+	certFile        string
+	keyFile         string
+	walkTimeout     time.Duration
+	statConcurrency int
+	slowLog         time.Duration
+	findLimit       int
+	treeLimit       int
+
+	scanners     []contentScanner // 上传内容扫描，为空时不扫描
+	uploadHook   *uploadHook      // nil 表示没有配置 -upload-hook
+	scanTimeout  time.Duration
+	scanFailOpen bool
+
+	flowWindow    int
+	caseCollision string
+
+	readOnly   bool
+	maxUpload  int64
+	maxMessage int64 // 单帧上限，见 readLimit
+	overwrite  string
+	names      namePolicy // 新建路径的名字规则，见 checkNewPath
+
+	followSymlinks bool // 见 checkSymlinks
+
+	extractMaxSize  int64
+	extractMaxEntry int64
+
+	stateDir string
+	state    *journal.Store // 各子系统共用的状态存储，按命名空间隔离
+
+	heavyOps *heavyLimiter // 重操作的并发限制
+
+	aliases *aliasTable // 路径别名
+
+	lockMu   sync.Mutex // 串行化锁的获取与释放
+	commitMu sync.Mutex // 串行化上传的提交，覆盖策略的检查与重命名之间不会插入别的上传
+	dirMu    sync.Mutex // 串行化上级目录的创建，见 createDirs
+
+	appendLocks pathLocks // 串行化对同一文件的追加上传，见 append.go
+	hashes      hashCache // 文件摘要缓存，见 hashcache.go
+
+	activity *activityLog // 最近完成的操作，供 /_activity
+
+	metrics     *metrics
+	metricsAddr string
+
+	counts     *dirCounts         // 各目录的条目计数
+	stopCounts context.CancelFunc // 停止后台巡检
+
+	tokensFile string
+	grants     map[string]grant // -tokens-file 中的token
+
+	authFails *authLimiter // 各IP的认证失败与锁定
+	rateLimit float64      // 每条连接每秒的请求数
+	bwLimit   int64        // 每条连接每秒的正文字节数
+
+	pingInterval time.Duration // 见 heartbeat
+	idleTimeout  time.Duration
+	pipeline     int // 流水线的并发上限，0表示不协商
+	rejectLegacy bool
+	webUI        bool
+	origins      *originPolicy // nil 表示接受任意 Origin
+	ipFilter     *ipFilter     // nil 表示不按地址过滤
+	trustProxy   bool
+	socketMode   os.FileMode
+	unixNoToken  bool
+
+	auditPath  string
+	auditChain bool
+	audit      *auditLog // 在 Open 中打开
+
+	webhook *webhook // nil 表示没有配置 -webhook-url
+
+	authMu   sync.Mutex            // 保护 token、grants 和 sessions
+	sessions map[*session]struct{} // 已认证的网关连接，token被换掉时吊销
+
+	drain drainer
+	hooks hooks // 传输钩子，内置的内容扫描也通过它接入
+
+	mu         sync.Mutex
+	opened     bool
+	closed     bool
+	tlsConfig  *tls.Config
+	gwSrv      *http.Server
+	metricsSrv *http.Server
+}
+
+// New 检查配置并构造服务端，不访问磁盘和网络；证书、token和状态存储在 Open 中加载
+func New(cfg Config) (*Server, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = ":8080"
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = "."
+	}
+	if cfg.CaseCollision == "" {
+		cfg.CaseCollision = CaseWarn
+	}
+	if cfg.ScanTimeout <= 0 {
+		cfg.ScanTimeout = 30 * time.Second
+	}
+	if cfg.UploadHookTimeout <= 0 {
+		cfg.UploadHookTimeout = 30 * time.Second
+	}
+	if cfg.UploadHookConcurrency <= 0 {
+		cfg.UploadHookConcurrency = 4
+	}
+	if cfg.StatConcurrency <= 0 {
+		cfg.StatConcurrency = 8
+	}
+	if cfg.FindLimit <= 0 {
+		cfg.FindLimit = defaultFindLimit
+	}
+	if cfg.TreeLimit <= 0 {
+		cfg.TreeLimit = defaultTreeLimit
+	}
+	if cfg.Overwrite == "" {
+		cfg.Overwrite = OverwriteAllow
+	}
+	if err := validCasePolicy(cfg.CaseCollision); err != nil {
+		return nil, err
+	}
+	if err := validOverwritePolicy(cfg.Overwrite); err != nil {
+		return nil, err
+	}
+	if cfg.NameCharset == "" {
+		cfg.NameCharset = NameAny
+	}
+	if err := validNameCharset(cfg.NameCharset); err != nil {
+		return nil, err
+	}
+	if cfg.MaxMessageSize > 0 && cfg.MaxMessageSize < protocol.MinMessageSize {
+		return nil, fmt.Errorf("-max-message-size must be at least %s so chunked uploads fit", textfmt.Size(protocol.MinMessageSize))
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("-cert and -key must be given together")
+	}
+	if cfg.SocketMode == 0 {
+		cfg.SocketMode = DefaultSocketMode
+	}
+	if _, unix := unixSocketPath(cfg.Addr); cfg.NoTokenOnUnix && !unix {
+		return nil, errors.New("-no-token-on-unix needs a unix:// -addr")
+	}
+	if cfg.Token != "" && cfg.TokenFile != "" {
+		return nil, errors.New("-token and -token-file are mutually exclusive")
+	}
+	scanners, err := newScanners(cfg.ScanCommand, cfg.ScanClamd)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := newAliasTable(cfg.Aliases, cfg.AliasFile, cfg.AliasWrites)
+	if err != nil {
+		return nil, err
+	}
+	origins, err := newOriginPolicy(cfg.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newIPFilter(cfg.AllowCIDR, cfg.DenyCIDR)
+	if err != nil {
+		return nil, err
+	}
+	hook, err := newWebhook(cfg.WebhookURL, cfg.WebhookSecret, cfg.WebhookSignatureHeader)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		addr:            cfg.Addr,
+		dir:             cfg.Dir,
+		token:           cfg.Token,
+		fixedToken:      cfg.Token != "",
+		tokenPath:       cfg.TokenFile,
+		certFile:        cfg.CertFile,
+		keyFile:         cfg.KeyFile,
+		walkTimeout:     cfg.WalkTimeout,
+		statConcurrency: cfg.StatConcurrency,
+		slowLog:         cfg.SlowLog,
+		findLimit:       cfg.FindLimit,
+		treeLimit:       cfg.TreeLimit,
+		scanners:        scanners,
+		scanTimeout:     cfg.ScanTimeout,
+		scanFailOpen:    cfg.ScanFailOpen,
+		uploadHook:      newUploadHook(cfg.UploadHook, cfg.UploadHookTimeout, cfg.UploadHookConcurrency),
+		flowWindow:      cfg.FlowWindow,
+		caseCollision:   cfg.CaseCollision,
+		stateDir:        cfg.StateDir,
+		counts:          newDirCounts(cfg.WarnDirEntries),
+		readOnly:        cfg.ReadOnly,
+		maxUpload:       max(cfg.MaxUploadSize, 0),
+		maxMessage:      max(cfg.MaxMessageSize, 0),
+		extractMaxSize:  max(cfg.ExtractMaxSize, 0),
+		extractMaxEntry: max(cfg.ExtractMaxEntry, 0),
+		overwrite:       cfg.Overwrite,
+		followSymlinks:  cfg.FollowSymlinks,
+		names:           namePolicy{maxDepth: max(cfg.MaxDepth, 0), maxLen: max(cfg.MaxNameLen, 0), charset: cfg.NameCharset},
+		heavyOps:        newHeavyLimiter(cfg.HeavyOps, cfg.HeavyQueue),
+		aliases:         aliases,
+		tokensFile:      cfg.TokensFile,
+		authFails:       newAuthLimiter(cfg.AuthFailLimit, cfg.AuthFailWindow),
+		rateLimit:       max(cfg.RateLimit, 0),
+		bwLimit:         max(cfg.BandwidthLimit, 0),
+		pingInterval:    max(cfg.PingInterval, 0),
+		idleTimeout:     max(cfg.IdleTimeout, 0),
+		pipeline:        max(cfg.Pipeline, 0),
+		rejectLegacy:    cfg.RejectLegacy,
+		webUI:           cfg.WebUI,
+		origins:         origins,
+		ipFilter:        filter,
+		trustProxy:      cfg.TrustProxyHeader,
+		socketMode:      cfg.SocketMode,
+		unixNoToken:     cfg.NoTokenOnUnix,
+		auditPath:       cfg.AuditLog,
+		auditChain:      cfg.AuditChain,
+		webhook:         hook,
+		activity:        newActivityLog(max(cfg.ActivitySize, 0)),
+		metrics:         newMetrics(),
+		metricsAddr:     cfg.MetricsAddr,
+	}
+	if len(scanners) > 0 {
+		s.OnUploadStaged(s.scanHook)
+	}
+	if s.uploadHook != nil {
+		s.OnUploadStaged(s.uploadHook.run)
+	}
+	if hook != nil {
+		s.OnUploadComplete(hook.hook("upload"))
+		s.OnDelete(hook.hook("delete"))
+	}
+	return s, nil
+}
+
+// Open 打开状态存储、确定token、检查可写位置并加载证书，问题在绑定端口之前暴露。
+// ListenAndServe 会在需要时调用它；想在监听前拿到自动生成的token时可以先调用
+func (s *Server) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opened {
+		return nil
+	}
+	if err := s.openState(); err != nil {
+		return err
+	}
+	if err := s.loadToken(); err != nil {
+		s.state.Close()
+		return fmt.Errorf("token: %w", err)
+	}
+	if err := s.loadTokens(); err != nil {
+		s.state.Close()
+		return err
+	}
+	if _, err := s.aliases.load(); err != nil {
+		s.state.Close()
+		return fmt.Errorf("aliases: %w", err)
+	}
+	if err := s.checkWritable(); err != nil {
+		s.state.Close()
+		return fmt.Errorf("startup check: %w", err)
+	}
+	tlsConfig, err := s.loadCertificate()
+	if err != nil {
+		s.state.Close()
+		return fmt.Errorf("tls certificate: %w", err)
+	}
+	if s.auditPath != "" {
+		if s.audit, err = openAuditLog(s.auditPath, s.auditChain); err != nil {
+			s.state.Close()
+			return err
+		}
+	}
+	s.webhook.start()
+	s.tlsConfig = tlsConfig
+	s.opened = true
+	return nil
+}
+
+// Token 返回客户端需要携带的token，未指定固定token时在 Open 之后才可用
+func (s *Server) Token() string {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	return s.token
+}
+
+// ListenAndServe 绑定 Config.Addr 并提供服务，直到 Shutdown 被调用，此时返回 http.ErrServerClosed
+func (s *Server) ListenAndServe() error {
+	if err := s.Open(); err != nil {
+		return err
+	}
+	var ln net.Listener
+	var err error
+	if path, ok := unixSocketPath(s.addr); ok {
+		ln, err = listenUnix(path, s.socketMode)
+	} else {
+		ln, err = net.Listen("tcp", s.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("gateway listener: %w", err)
+	}
+	return s.Serve(ln)
+}
+
+// Serve 在已绑定的监听上提供网关服务，配置了证书时以 wss:// 提供服务
+func (s *Server) Serve(gwLn net.Listener) error {
+	if err := s.Open(); err != nil {
+		gwLn.Close()
+		return err
+	}
+	// 先绑定所有监听再输出就绪日志，编排系统可以据此判断服务已可用
+	gwMux := http.NewServeMux()
+	gwMux.HandleFunc("/ws", s.gatewayHandler())
+	rest := s.withCORS(s.restHandler())
+	gwMux.Handle(restFilesPrefix, rest)
+	gwMux.Handle("/api/list", rest)
+	var metricsLn net.Listener
+	if s.metricsAddr != "" {
+		var err error
+		if metricsLn, err = net.Listen("tcp", s.metricsAddr); err != nil {
+			gwLn.Close()
+			return fmt.Errorf("metrics listener: %w", err)
+		}
+	} else {
+		gwMux.HandleFunc("/metrics", s.metricsHandler(true))
+	}
+	if s.webUI {
+		ui := s.withCORS(s.webuiHandler())
+		gwMux.Handle("/{$}", ui)
+		gwMux.Handle("/webui/", ui)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		gwLn.Close()
+		if metricsLn != nil {
+			metricsLn.Close()
+		}
+		return http.ErrServerClosed
+	}
+	if metricsLn != nil {
+		metricsMux := http.NewServeMux()
+		metricsMux.HandleFunc("/metrics", s.metricsHandler(false))
+		s.metricsSrv = &http.Server{Handler: metricsMux}
+	}
+	s.gwSrv = &http.Server{Handler: s.withClientAddr(gwMux), TLSConfig: s.tlsConfig}
+	countsCtx, stopCounts := context.WithCancel(context.Background())
+	s.stopCounts = stopCounts
+	s.mu.Unlock()
+
+	go s.reconcileCounts(countsCtx)
+	go s.sweepTemp()
+
+	if metricsLn != nil {
+		go s.metricsSrv.Serve(metricsLn)
+		logf("metrics @ http://%s/metrics", metricsLn.Addr())
+	}
+	logf("gateway websocket @ %s", listenURL(s.scheme(), gwLn, "/ws"))
+	logf("gateway HTTP API @ %s", listenURL(s.httpScheme(), gwLn, restFilesPrefix))
+	if s.webUI {
+		logf("web UI @ %s", listenURL(s.httpScheme(), gwLn, "/"))
+	}
+	logf("ready")
+	if s.tlsConfig != nil {
+		return s.gwSrv.ServeTLS(gwLn, "", "")
+	}
+	return s.gwSrv.Serve(gwLn)
+}
+
+// Shutdown 停止接受连接和新请求，等待正在转发的请求完成或 ctx 结束，然后发完 webhook 通知，关闭指标监听和状态存储。
+// 网关连接以 going away 关闭：空闲的立即关闭，其余的在请求完成后关闭。
+// ctx 先结束时放弃剩余的请求并返回 ctx.Err()
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	gwSrv, metricsSrv, opened := s.gwSrv, s.metricsSrv, s.opened
+	if s.stopCounts != nil {
+		s.stopCounts()
+	}
+	s.mu.Unlock()
+
+	done, active := s.drain.close()
+	s.closeSessions(true)
+	if deadline, ok := ctx.Deadline(); ok {
+		logf("shutting down, waiting up to %s for %d active requests", time.Until(deadline).Round(time.Second), active)
+	} else {
+		logf("shutting down, waiting for %d active requests", active)
+	}
+	var err error
+	if gwSrv != nil {
+		// 升级后的websocket连接不归 http.Server 管理，Shutdown 只停止接受新连接
+		gwSrv.Shutdown(ctx)
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logf("shutdown timeout, abandoning active requests")
+		err = ctx.Err()
+	}
+	s.closeSessions(false)
+	if metricsSrv != nil {
+		metricsSrv.Close()
+	}
+	if opened {
+		// 请求都已结束，不会再有新的通知；队列中剩下的在 ctx 结束之前发完
+		s.webhook.close(ctx)
+		if cerr := s.audit.close(); cerr != nil {
+			logf("close audit log: %v", cerr)
+		}
+		if cerr := s.state.Close(); cerr != nil {
+			logf("close state store: %v", cerr)
+		}
+	}
+	logf("shutdown complete")
+	return err
+}
+
+// serverFeatures 服务端支持的协议特性，通过 /_caps 告知客户端
+var serverFeatures = []string{"list", "upload", "download", "lock", "sparse", "stat", "stream-upload", "delete", "progress", "stream-list", "list-long", "dir-counts", "metadata", "resume-upload", "sha256", "sha256-trailer", "upload-limit", "bench", "overwrite", "canonical-path", "mkdir", "move", "tail", "json-frames", "du", "find", "tree", "archive", "extract", "attrs", "append"}
+
+// features 返回当前配置下启用的特性，流控只在 FlowWindow 大于0时提供
+func (s *Server) features() []string {
+	f := append([]string(nil), serverFeatures...)
+	if s.flowWindow > 0 {
+		f = append(f, "flow-control")
+	}
+	if len(s.activity.buf) > 0 {
+		f = append(f, "activity")
+	}
+	if s.pipeline > 0 {
+		f = append(f, "pipeline")
+	}
+	return f
+}
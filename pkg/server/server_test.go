@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+/* ---------- 测试公用 ---------- */
+
+const testToken = "test-token"
+
+// newTestServer 构造并打开以临时目录为沙箱的服务端（状态存储在内存中），测试结束时关闭。
+// cfg.Dir 和 cfg.Token 为空时分别取 t.TempDir() 和 testToken
+func newTestServer(t testing.TB, cfg Config) *Server {
+	t.Helper()
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	if cfg.Token == "" && cfg.TokenFile == "" {
+		cfg.Token = testToken
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := s.Open(); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return s
+}
+
+// newTestGateway 在本机的随机端口上运行 newTestServer 的网关（Serve），返回服务端和 websocket 地址，
+// 配置了证书时地址是 wss://
+func newTestGateway(t *testing.T, cfg Config) (*Server, string) {
+	t.Helper()
+	s := newTestServer(t, cfg)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	scheme := "ws"
+	if s.tlsConfig != nil {
+		scheme = "wss"
+	}
+	return s, scheme + "://" + ln.Addr().String() + "/ws"
+}
+
+// decodeAPIError 把记录下的回复正文解析为 APIError，正文不是 JSON 错误时返回 nil
+func decodeAPIError(rec *httptest.ResponseRecorder) *APIError {
+	var e APIError
+	if json.Unmarshal(rec.Body.Bytes(), &e) != nil || e.Code == "" {
+		return nil
+	}
+	return &e
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 稀疏文件 ---------- */
+
+// maxExtents 超过该数量的数据区段按稠密文件传输，避免大量小请求
+const maxExtents = 1024
+
+// handleExtents 实现 GET /_extents?path=，返回文件的数据区段。
+// 不支持 SEEK_DATA/SEEK_HOLE 的平台返回覆盖整个文件的单个区段
+func (s *Server) handleExtents(w http.ResponseWriter, r *http.Request, clientIP string) {
+	p, real, err := s.resolveSandboxPath(r, "path")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	f, err := os.Open(real)
+	if err != nil {
+		writeError(w, http.StatusNotFound, &APIError{Code: "NOT_FOUND", Message: "not found"})
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() || isReservedName(fi.Name()) {
+		writeError(w, http.StatusNotFound, &APIError{Code: "NOT_FOUND", Message: "not found"})
+		return
+	}
+	extents := dataExtents(f, fi.Size())
+	// 有下载变换时不能按区段读取，报告为单个区段让客户端整体下载
+	if len(extents) > maxExtents || len(s.hooks.transformDownload) > 0 {
+		extents = []protocol.Extent{{Offset: 0, Length: fi.Size()}}
+	}
+	logEvent(logEntry{IP: clientIP, Action: "EXTENTS", Path: p, Status: http.StatusOK, Duration: elapsedSince(r), Detail: fmt.Sprintf("size=%d extents=%d", fi.Size(), len(extents))})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(protocol.ExtentsResult{SchemaVersion: protocol.SchemaVersion, Size: fi.Size(), Extents: extents})
+}
+
+// serveRange 处理带 offset/length 参数的下载，只返回文件的一段
+func serveRange(w http.ResponseWriter, r *http.Request, real string, size int64) {
+	q := r.URL.Query()
+	off, err1 := strconv.ParseInt(q.Get("offset"), 10, 64)
+	n, err2 := strconv.ParseInt(q.Get("length"), 10, 64)
+	if err1 != nil || err2 != nil || off < 0 || n < 0 || off > size || n > size-off {
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, &APIError{Code: "BAD_RANGE", Message: fmt.Sprintf("range %s+%s outside file of %d bytes", q.Get("offset"), q.Get("length"), size)})
+		return
+	}
+	f, err := os.Open(real)
+	if err != nil {
+		writeError(w, http.StatusNotFound, &APIError{Code: "NOT_FOUND", Message: "not found"})
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	io.Copy(w, io.NewSectionReader(f, off, n))
+}
@@ -0,0 +1,49 @@
+//go:build linux
+
+package server
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"wsbox/internal/protocol"
+)
+
+// lseek 的 whence 取值，syscall 包没有导出
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// dataExtents 用 SEEK_DATA/SEEK_HOLE 找出文件的数据区段，
+// 文件系统不支持时返回覆盖整个文件的单个区段
+func dataExtents(f *os.File, size int64) []protocol.Extent {
+	dense := []protocol.Extent{{Offset: 0, Length: size}}
+	if size == 0 {
+		return nil
+	}
+	var out []protocol.Extent
+	for off := int64(0); off < size; {
+		start, err := f.Seek(off, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			break // off 之后没有数据
+		}
+		if err != nil {
+			return dense
+		}
+		end, err := f.Seek(start, seekHole)
+		if err != nil {
+			return dense
+		}
+		if end > size {
+			end = size
+		}
+		if end <= start {
+			return dense
+		}
+		out = append(out, protocol.Extent{Offset: start, Length: end - start})
+		off = end
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+//go:build linux
+
+package server
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+
+	"wsbox/internal/protocol"
+	"wsbox/pkg/client"
+)
+
+// fileExtents 返回本地文件的数据区段
+func fileExtents(t *testing.T, name string) []protocol.Extent {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dataExtents(f, fi.Size())
+}
+
+// allocated 返回文件实际占用的磁盘空间，预分配但未写入的区段也计算在内
+func allocated(t *testing.T, name string) int64 {
+	t.Helper()
+	var st syscall.Stat_t
+	if err := syscall.Stat(name, &st); err != nil {
+		t.Fatal(err)
+	}
+	return st.Blocks * 512
+}
+
+// 含空洞的文件下载后大小和内容相同，空洞仍是空洞：只传输数据区段，预分配也只覆盖数据区段
+func TestSparseRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("creates a 64MiB sparse file")
+	}
+	const size = 64 << 20
+	s, wsURL := newTestGateway(t, Config{})
+	src := filepath.Join(s.dir, "disk.img")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 开头、中间和结尾各有一段数据，其余是空洞
+	data := map[int64][]byte{
+		0:                bytes.Repeat([]byte("a"), 64<<10),
+		32 << 20:         bytes.Repeat([]byte("b"), 1<<20),
+		size - (8 << 10): bytes.Repeat([]byte("c"), 8<<10),
+	}
+	for off, b := range data {
+		if _, err := f.WriteAt(b, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+	want := fileExtents(t, src)
+	if len(want) < 2 {
+		t.Skipf("the filesystem does not report holes (extents %v)", want)
+	}
+
+	cl, err := client.Dial(wsURL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	dst := filepath.Join(t.TempDir(), "disk.img")
+	st, err := cl.DownloadFile("/disk.img", dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Extents != len(want) {
+		t.Errorf("downloaded %d extents, want %d", st.Extents, len(want))
+	}
+	var dataBytes int64
+	for _, e := range want {
+		dataBytes += e.Length
+	}
+	if st.Bytes != dataBytes {
+		t.Errorf("transferred %d bytes, want only the %d bytes of data", st.Bytes, dataBytes)
+	}
+
+	fi, err := os.Stat(dst)
+	if err != nil || fi.Size() != size {
+		t.Fatalf("downloaded file: %v, %v; want %d bytes", fi, err, size)
+	}
+	got, _ := os.ReadFile(dst)
+	orig, _ := os.ReadFile(src)
+	if !bytes.Equal(got, orig) {
+		t.Fatal("downloaded content differs from the original")
+	}
+	if ext := fileExtents(t, dst); !slices.Equal(ext, want) {
+		t.Errorf("downloaded file has extents %v, want the holes of the original %v", ext, want)
+	}
+	if a, orig := allocated(t, dst), allocated(t, src); a > orig+(1<<20) {
+		t.Errorf("downloaded file occupies %d bytes on disk, the original %d: the holes were allocated", a, orig)
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：单个路径的 stat ---------- */
+
+// handleStat 实现 GET /_stat?path=[&hash=1]，hash=1 时读取整个文件计算 SHA-256；路径上有未过期的锁时附带锁的信息
+func (s *Server) handleStat(w http.ResponseWriter, r *http.Request, clientIP string) {
+	p, real, err := s.resolveSandboxPath(r, "path")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "STAT", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	info := protocol.StatInfo{SchemaVersion: protocol.SchemaVersion, Path: p}
+	if fi, err := os.Stat(real); err == nil && !isReservedName(fi.Name()) {
+		info.Exists = true
+		info.IsDir = fi.IsDir()
+		info.Size = fi.Size()
+		info.ModTime = fi.ModTime().UTC()
+		info.Mode = fmt.Sprintf("%04o", fi.Mode().Perm())
+		if l := activeLock(real); l != nil {
+			l.SchemaVersion = protocol.SchemaVersion
+			info.Lock = l
+		}
+		if !fi.IsDir() && r.URL.Query().Get("hash") == "1" {
+			if info.SHA256, err = s.fileHash(real); err != nil {
+				logEvent(logEntry{IP: clientIP, Action: "STAT", Path: p, Status: http.StatusInternalServerError, Duration: elapsedSince(r), Err: "hash failed: " + err.Error()})
+				writeError(w, http.StatusInternalServerError, &APIError{Code: "HASH_FAILED", Message: err.Error()})
+				return
+			}
+		}
+	}
+	detail := fmt.Sprintf("exists=%t", info.Exists)
+	if info.SHA256 != "" {
+		detail += " hashed"
+	}
+	logEvent(logEntry{IP: clientIP, Action: "STAT", Path: p, Status: http.StatusOK, Duration: elapsedSince(r), Detail: detail})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
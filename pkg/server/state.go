@@ -0,0 +1,32 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"wsbox/internal/journal"
+)
+
+/* ---------- 服务端：状态存储 ---------- */
+
+// openState 打开 Config.StateDir 指定的状态存储，未指定时使用内存存储，重启后状态丢失
+func (s *Server) openState() error {
+	st, rec, err := journal.Open(s.stateDir)
+	if err != nil {
+		return fmt.Errorf("open state store: %w", err)
+	}
+	s.state = st
+	// 摘要缓存和目录计数保存在各自的命名空间中
+	absRoot, _ := filepath.Abs(s.dir)
+	s.hashes = hashCache{st: st, root: absRoot}
+	s.counts.st = st
+	switch {
+	case s.stateDir == "":
+		logf("state store: in memory (set -state-dir to persist)")
+	case rec.Replayed > 0 || rec.TruncatedBytes > 0:
+		logf("state store %s: recovered, replayed %d journal records, discarded %d bytes of torn tail", s.stateDir, rec.Replayed, rec.TruncatedBytes)
+	default:
+		logf("state store %s: clean", s.stateDir)
+	}
+	return nil
+}
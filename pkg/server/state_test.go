@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 设置了 -state-dir 时摘要缓存和目录计数保存在状态存储中，重启后不必重新读取文件或等待巡检
+func TestStatePersistsAcrossRestart(t *testing.T) {
+	cfg := Config{Dir: t.TempDir(), StateDir: t.TempDir()}
+	real := filepath.Join(cfg.Dir, "d", "big.bin")
+	os.MkdirAll(filepath.Dir(real), 0o755)
+	os.WriteFile(real, []byte("content"), 0o644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(real, old, old)
+
+	s := newTestServer(t, cfg)
+	sum, err := s.fileHash(real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.reconcileStep(context.Background())
+	s.Shutdown(context.Background())
+
+	s = newTestServer(t, cfg)
+	fi, _ := os.Stat(real)
+	if got, ok := s.hashes.get(real, fi); !ok || got != sum {
+		t.Errorf("after a restart the cached digest is %q, %v; want %q", got, ok, sum)
+	}
+	res := s.counts.top(10)
+	if res.Passes != 1 || res.ReconciledAt.IsZero() {
+		t.Errorf("after a restart: %d passes reconciled at %v, want the pass from before", res.Passes, res.ReconciledAt)
+	}
+	counts := map[string]int{}
+	for _, e := range res.Entries {
+		counts[e.Dir] = e.Count
+	}
+	if counts["/"] != 1 || counts["/d"] != 1 {
+		t.Errorf("after a restart counts = %v, want / and /d with one entry each", counts)
+	}
+
+	// 计数继续增量更新，文件换了之后缓存的摘要失效
+	s.noteCreated(filepath.Join(cfg.Dir, "d", "new.txt"))
+	tmp := real + ".new"
+	os.WriteFile(tmp, []byte("content"), 0o644)
+	os.Chtimes(tmp, old, old)
+	os.Rename(tmp, real)
+	fi, _ = os.Stat(real)
+	if _, ok := s.hashes.get(real, fi); ok {
+		t.Error("the cached digest survived replacing the file")
+	}
+	s.hashes.put(real, fi, sum)
+	s.hashes.forget(filepath.Join(cfg.Dir, "d"))
+	s.Shutdown(context.Background())
+
+	s = newTestServer(t, cfg)
+	if _, ok := s.hashes.get(real, fi); ok {
+		t.Error("a forgotten digest came back after a restart")
+	}
+	if c := s.counts.top(10).Entries; len(c) < 1 || c[0].Dir != "/d" || c[0].Count != 2 {
+		t.Errorf("after a restart the incremental count is lost: %v", c)
+	}
+}
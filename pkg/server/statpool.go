@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* ---------- 服务端：并发 stat 与慢日志 ---------- */
+
+// opTimings 记录一次请求各阶段的耗时，超过 -slow-log 阈值时写入慢日志。
+// stat 是所有 worker 的累计耗时，可能大于墙钟时间
+type opTimings struct {
+	start     time.Time
+	queue     time.Duration // 等待重操作配额的时间
+	walk      time.Duration
+	stat      atomic.Int64
+	serialize time.Duration
+}
+
+func newOpTimings() *opTimings {
+	return &opTimings{start: time.Now()}
+}
+
+func (t *opTimings) addStat(d time.Duration) {
+	t.stat.Add(int64(d))
+}
+
+// logSlow 在请求总耗时超过阈值时输出各阶段耗时，便于定位网络存储的延迟
+func (s *Server) logSlow(clientIP, action, detail string, t *opTimings) {
+	total := time.Since(t.start)
+	if s.slowLog <= 0 || total < s.slowLog {
+		return
+	}
+	logEvent(logEntry{IP: clientIP, Action: "SLOW", Duration: total, Detail: fmt.Sprintf("op=%s %s total=%s queue=%s walk=%s stat=%s serialize=%s",
+		action, detail, total, t.queue, t.walk, time.Duration(t.stat.Load()), t.serialize)})
+}
+
+// statItem 是等待 stat 的目录项
+type statItem struct {
+	path string
+	d    fs.DirEntry
+}
+
+// statEntry 获取目录项的文件信息，测试中替换为慢速的实现来模拟网络存储
+var statEntry = fs.DirEntry.Info
+
+// statResult 是 stat 完成后的目录项，结果的顺序与输入无关
+type statResult struct {
+	path string
+	d    fs.DirEntry
+	info fs.FileInfo
+	err  error
+}
+
+// statAll 用大小为 -stat-concurrency 的 worker 池并发获取文件信息。
+// 在慢速存储（如NFS）上单次 stat 可能耗时数百毫秒，串行执行会拖慢整个遍历。
+// ctx 结束后 worker 立即退出，调用方负责在发送 in 时同样检查 ctx
+func (s *Server) statAll(ctx context.Context, in <-chan statItem, t *opTimings) <-chan statResult {
+	out := make(chan statResult, 64)
+	n := s.statConcurrency
+	if n < 1 {
+		n = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range in {
+				start := time.Now()
+				info, err := statEntry(it.d)
+				t.addStat(time.Since(start))
+				select {
+				case out <- statResult{path: it.path, d: it.d, info: info, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
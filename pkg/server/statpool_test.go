@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 长格式列出一个目录，每次 stat 都像网络存储一样耗时，比较不同的 -stat-concurrency
+func BenchmarkList(b *testing.B) {
+	const (
+		files     = 200
+		statDelay = 500 * time.Microsecond
+	)
+	oldStat := statEntry
+	b.Cleanup(func() { statEntry = oldStat })
+	statEntry = func(d fs.DirEntry) (fs.FileInfo, error) {
+		time.Sleep(statDelay)
+		return d.Info()
+	}
+	// 每个请求一行访问日志，不写到基准测试的输出里
+	if err := SetLogFile(filepath.Join(b.TempDir(), "access.log")); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { SetLogFile("") })
+
+	dir := b.TempDir()
+	for i := 0; i < files; i++ {
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%03d.txt", i)), nil, 0o644)
+	}
+	for _, n := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("concurrency=%d", n), func(b *testing.B) {
+			s := newTestServer(b, Config{Dir: dir, StatConcurrency: n})
+			for b.Loop() {
+				rec := httptest.NewRecorder()
+				s.localHandler(rec, httptest.NewRequest("GET", "/_list?dir=/&format=long", nil))
+				if rec.Code != http.StatusOK {
+					b.Fatalf("list: %d %s", rec.Code, rec.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 流式上传：分块请求正文 ---------- */
+
+// 帧格式见 protocol.StreamHeader。网关把收到的每一块直接写入本地处理器的请求正文，
+// 内存占用与文件大小无关。未协商的连接保持原来的"请求行 + 单个正文帧"格式
+
+var errUploadAborted = errors.New("upload aborted by client")
+
+// recvUpload 把分块上传的正文写入 pw，直到收到结束标记；结束标记带有摘要时先把它记在 digest 中再关闭 pw。
+// 本地处理器提前结束（如拒绝上传）导致写入失败后继续读完剩余的块，保持连接上的消息顺序；
+// 只有连接本身出错或收到意外的帧时才返回错误。每一块都把读超时顺延 idle（见 heartbeat）
+func recvUpload(conn frameConn, pw *io.PipeWriter, digest *string, idle time.Duration) error {
+	var werr error
+	for {
+		extendRead(conn, idle)
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			pw.CloseWithError(err)
+			return err
+		}
+		if msgType == websocket.BinaryMessage {
+			// 处理器不再读取后丢弃剩余的块
+			if werr == nil {
+				_, werr = pw.Write(data)
+			}
+			continue
+		}
+		marker := data[:min(len(data), 128)]
+		if d, ok := strings.CutPrefix(string(marker), protocol.StreamEnd+" "); ok && protocol.ValidDigest(d) {
+			*digest = d
+			marker = []byte(protocol.StreamEnd)
+		}
+		switch string(marker) {
+		case protocol.StreamEnd:
+			pw.Close()
+			return nil
+		case protocol.StreamAbort:
+			pw.CloseWithError(errUploadAborted)
+			return nil
+		}
+		err = fmt.Errorf("unexpected frame during upload: %q", marker)
+		pw.CloseWithError(err)
+		return err
+	}
+}
+
+// uploadBody 是分块上传交给本地处理器的请求正文。读到结尾时把结束标记中的摘要放进请求的 trailer：
+// trailer 在传输层写完正文之后发送，而正文的读取和 trailer 的写出在同一个协程里，不会与 recvUpload 竞争
+type uploadBody struct {
+	pr     *io.PipeReader
+	req    *http.Request
+	digest string // recvUpload 在关闭管道之前写入，读到 EOF 之后才读取
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	n, err := b.pr.Read(p)
+	if err == io.EOF && b.digest != "" {
+		b.req.Trailer.Set(digestHeader, b.digest)
+	}
+	return n, err
+}
+
+func (b *uploadBody) Close() error { return b.pr.Close() }
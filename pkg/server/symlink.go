@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/* ---------- 服务端：符号链接 ---------- */
+
+// SecurePath 只按字面检查路径，沙箱里的符号链接（如指向 /etc 的 link）仍然能把 link/passwd 这样的请求带出沙箱。
+// resolveSandboxPath 因此在 SecurePath 之后逐级 Lstat 路径中已经存在的部分：
+//
+//   - 默认拒绝经过任何符号链接的路径，下载、列出、stat 和写入都不跟随链接，也不能经由链接到的目录上传；
+//   - Config.FollowSymlinks 打开时跟随链接，但 filepath.EvalSymlinks 解析后的目标必须仍在解析后的沙箱根目录之内，
+//     指向沙箱之外或不存在的目标同样拒绝。
+//
+// 删除和移动的源作用于链接本身、不经过它，通过 resolveLinkPath 解析，不检查路径的最后一级。
+// 目录遍历（list -R、find、du、tree、get -archive、delete -r）本来就不跟随链接。
+// 检查与随后的文件操作之间不加锁：能在沙箱里放置链接的本机用户不在防范之内
+
+// checkSymlinks 逐级检查沙箱内的 real 中已经存在的部分，leaf 为 false 时不检查最后一级
+func (s *Server) checkSymlinks(real string, leaf bool) error {
+	absRoot, _ := filepath.Abs(s.dir)
+	rel, err := filepath.Rel(absRoot, real)
+	if err != nil || rel == "." {
+		return nil
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	cur := absRoot
+	for i, part := range parts {
+		if i == len(parts)-1 && !leaf {
+			return nil
+		}
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if err != nil {
+			return nil // 其余部分还不存在
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if !s.followSymlinks {
+			return fmt.Errorf("%q is a symlink and the server does not follow symlinks", part)
+		}
+		target, err := filepath.EvalSymlinks(cur)
+		if err != nil {
+			return fmt.Errorf("%q is a symlink to a missing target", part)
+		}
+		root, err := filepath.EvalSymlinks(absRoot)
+		if err != nil {
+			return err
+		}
+		if r, err := filepath.Rel(root, target); err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%q is a symlink that leads outside the sandbox", part)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// symlinkFixture 在临时目录中建立沙箱 sb 和沙箱外的 outside，返回两者的路径：
+//
+//	sb/real/file.txt             "inside"
+//	sb/in      -> real/file.txt  沙箱内的链接
+//	sb/indir   -> real           沙箱内的目录链接，作为中间一级使用
+//	sb/out     -> ../outside/secret.txt
+//	sb/outdir  -> ../outside     逃出沙箱的目录链接，作为中间一级使用
+//	sb/dangling -> missing.txt   目标不存在
+//	outside/secret.txt           "top secret"
+func symlinkFixture(t *testing.T) (dir, outside string) {
+	t.Helper()
+	parent := t.TempDir()
+	dir = filepath.Join(parent, "sb")
+	outside = filepath.Join(parent, "outside")
+	for _, d := range []string{filepath.Join(dir, "real"), outside} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "real", "file.txt"), []byte("inside"), 0o644)
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("top secret"), 0o644)
+	links := map[string]string{
+		"in":       "real/file.txt",
+		"indir":    "real",
+		"out":      "../outside/secret.txt",
+		"outdir":   "../outside",
+		"dangling": "missing.txt",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+	return dir, outside
+}
+
+func TestSymlinks(t *testing.T) {
+	tests := []struct {
+		name         string
+		method, path string
+		noFollow     int    // 不跟随时的状态码
+		follow       int    // 跟随时的状态码
+		body         string // 跟随并成功时下载到的内容
+	}{
+		{"link inside the root", "GET", "/in", 400, 200, "inside"},
+		{"link escaping the root", "GET", "/out", 400, 400, ""},
+		{"dangling link", "GET", "/dangling", 400, 400, ""},
+		{"intermediate link inside the root", "GET", "/indir/file.txt", 400, 200, "inside"},
+		{"intermediate link escaping the root", "GET", "/outdir/secret.txt", 400, 400, ""},
+		{"upload through an intermediate link inside the root", "POST", "/indir/new.txt", 400, 201, ""},
+		{"upload through an intermediate link escaping the root", "POST", "/outdir/new.txt", 400, 400, ""},
+		{"upload onto a link escaping the root", "POST", "/out", 400, 400, ""},
+		{"upload onto a dangling link", "POST", "/dangling", 400, 400, ""},
+	}
+	for _, follow := range []bool{false, true} {
+		for _, tt := range tests {
+			name := tt.name
+			if follow {
+				name += " (follow)"
+			}
+			t.Run(name, func(t *testing.T) {
+				dir, outside := symlinkFixture(t)
+				s := newTestServer(t, Config{Dir: dir, FollowSymlinks: follow})
+				rec := httptest.NewRecorder()
+				s.localHandler(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader("payload")))
+
+				want := tt.noFollow
+				if follow {
+					want = tt.follow
+				}
+				if rec.Code != want {
+					t.Fatalf("%s %s = %d %q, want %d", tt.method, tt.path, rec.Code, strings.TrimSpace(rec.Body.String()), want)
+				}
+				if want == http.StatusOK && tt.method == "GET" && rec.Body.String() != tt.body {
+					t.Errorf("GET %s = %q, want %q", tt.path, rec.Body.String(), tt.body)
+				}
+				if strings.Contains(rec.Body.String(), "top secret") {
+					t.Errorf("%s %s revealed the file outside the sandbox", tt.method, tt.path)
+				}
+				if b, err := os.ReadFile(filepath.Join(outside, "secret.txt")); err != nil || string(b) != "top secret" {
+					t.Errorf("%s %s changed the file outside the sandbox: %v", tt.method, tt.path, err)
+				}
+				for _, p := range []string{filepath.Join(outside, "new.txt"), filepath.Join(dir, "missing.txt")} {
+					if _, err := os.Lstat(p); err == nil {
+						t.Errorf("%s %s created %s", tt.method, tt.path, p)
+					}
+				}
+				if tt.method == "POST" && want == http.StatusCreated {
+					if b, err := os.ReadFile(filepath.Join(dir, "real", "new.txt")); err != nil || string(b) != "payload" {
+						t.Errorf("upload through %s did not reach real/new.txt: %v", tt.path, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// 删除作用于链接本身：链接被删除，链接到的文件不受影响，无论是否跟随
+func TestSymlinkDeleteRemovesLink(t *testing.T) {
+	for _, follow := range []bool{false, true} {
+		dir, outside := symlinkFixture(t)
+		s := newTestServer(t, Config{Dir: dir, FollowSymlinks: follow})
+		for _, name := range []string{"in", "out", "dangling", "outdir"} {
+			rec := httptest.NewRecorder()
+			s.localHandler(rec, httptest.NewRequest("DELETE", "/"+name, nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("follow=%v: DELETE /%s = %d %q, want 200", follow, name, rec.Code, strings.TrimSpace(rec.Body.String()))
+			}
+			if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+				t.Errorf("follow=%v: DELETE /%s left the link in place", follow, name)
+			}
+		}
+		if b, err := os.ReadFile(filepath.Join(outside, "secret.txt")); err != nil || string(b) != "top secret" {
+			t.Errorf("follow=%v: deleting links changed the file outside the sandbox: %v", follow, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "real", "file.txt")); err != nil {
+			t.Errorf("follow=%v: deleting a link removed its target: %v", follow, err)
+		}
+	}
+}
+
+// 不跟随时详细列表照常返回链接本身，并标出它是链接
+func TestSymlinkListed(t *testing.T) {
+	dir, _ := symlinkFixture(t)
+	s := newTestServer(t, Config{Dir: dir})
+	rec := httptest.NewRecorder()
+	s.localHandler(rec, httptest.NewRequest("GET", "/_list?format=long&dir=/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /_list = %d %q", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"symlink":true`) {
+		t.Errorf("listing does not mark symlinks: %s", rec.Body.String())
+	}
+}
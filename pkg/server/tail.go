@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+/* ---------- 服务端：文件末尾的若干行 ---------- */
+
+const (
+	// maxTailLines 是 /_tail 一次最多返回的行数
+	maxTailLines = 100000
+	// maxTailBytes 限制 /_tail 的响应大小，行很长时只返回末尾这么多字节
+	maxTailBytes = 16 << 20
+	// tailBlock 是从后向前读取文件时每次读的块大小
+	tailBlock = 64 << 10
+)
+
+// handleTail 实现 GET /_tail?path=&lines=[&end=]：从文件末尾（或 end 偏移处）向前按块读取，找到最后 lines 行的起点，
+// 只返回这一段原始字节，不把整个文件读进内存。end 让客户端先 stat 得到大小，之后从同一个偏移接着读新增的内容。
+// 与区段下载一样，注册了下载变换时不可用
+func (s *Server) handleTail(w http.ResponseWriter, r *http.Request, clientIP string) {
+	p, real, err := s.resolveSandboxPath(r, "path")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "TAIL", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		writeError(w, http.StatusBadRequest, &APIError{Code: "INVALID_PATH", Message: err.Error()})
+		return
+	}
+	fail := func(status int, e *APIError) {
+		logEvent(logEntry{IP: clientIP, Action: "TAIL", Path: p, Status: status, Duration: elapsedSince(r), Err: e.Message})
+		writeError(w, status, e)
+	}
+	q := r.URL.Query()
+	lines := 10
+	if v := q.Get("lines"); v != "" {
+		if lines, err = strconv.Atoi(v); err != nil || lines < 0 || lines > maxTailLines {
+			fail(http.StatusBadRequest, &APIError{Code: "BAD_LINES", Message: fmt.Sprintf("lines must be between 0 and %d", maxTailLines)})
+			return
+		}
+	}
+	if len(s.hooks.transformDownload) > 0 {
+		fail(http.StatusRequestedRangeNotSatisfiable, &APIError{Code: "BAD_RANGE", Message: "tail is unavailable for transformed downloads"})
+		return
+	}
+	f, err := os.Open(real)
+	if err != nil {
+		fail(http.StatusNotFound, &APIError{Code: "NOT_FOUND", Message: p + " not found"})
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() || isReservedName(fi.Name()) {
+		fail(http.StatusNotFound, &APIError{Code: "NOT_FOUND", Message: p + " not found"})
+		return
+	}
+	end := fi.Size()
+	if v := q.Get("end"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 || n > end {
+			fail(http.StatusRequestedRangeNotSatisfiable, &APIError{Code: "BAD_RANGE", Message: fmt.Sprintf("end %s outside file of %d bytes", v, end)})
+			return
+		}
+		end = n
+	}
+	ev := TransferEvent{Path: p, Size: fi.Size(), Identity: r.Header.Get("X-Wsbox-Token"), ClientIP: clientIP}
+	if status, rejected := runPreHooks(r.Context(), s.hooks.downloadStart, ev); rejected != nil {
+		fail(status, rejected)
+		return
+	}
+	start, err := tailStart(f, end, lines)
+	if err != nil {
+		fail(http.StatusInternalServerError, &APIError{Code: "READ_FAILED", Message: err.Error()})
+		return
+	}
+	n := end - start
+	logEvent(logEntry{IP: clientIP, Action: "TAIL", Path: p, Status: http.StatusOK, Bytes: n, Duration: elapsedSince(r), Detail: fmt.Sprintf("lines=%d end=%d", lines, end)})
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	io.Copy(w, io.NewSectionReader(f, start, n))
+}
+
+// tailStart 返回 end 之前最后 lines 行的起始偏移。end 前的最后一个字节是换行时它只是结束了最后一行，不算新的一行；
+// 结果距离 end 超过 maxTailBytes 时截到这个长度
+func tailStart(f io.ReaderAt, end int64, lines int) (int64, error) {
+	if lines == 0 || end == 0 {
+		return end, nil
+	}
+	limit := max(end-maxTailBytes, 0)
+	buf := make([]byte, tailBlock)
+	pos, found := end, 0
+	skipLast := true
+	for pos > limit {
+		n := min(int64(len(buf)), pos-limit)
+		block := buf[:n]
+		if _, err := f.ReadAt(block, pos-n); err != nil && err != io.EOF {
+			return 0, err
+		}
+		if skipLast {
+			if block[n-1] == '\n' {
+				block = block[:n-1]
+			}
+			skipLast = false
+		}
+		for i := len(block); i > 0; {
+			i = bytes.LastIndexByte(block[:i], '\n')
+			if i < 0 {
+				break
+			}
+			if found++; found == lines {
+				return pos - n + int64(i) + 1, nil
+			}
+		}
+		pos -= n
+	}
+	return limit, nil
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"crypto/tls"
+)
+
+/* ---------- 服务端：网关TLS ---------- */
+
+// loadCertificate 在启动时读取 -cert/-key，证书有问题时在绑定端口之前报错
+func (s *Server) loadCertificate() (*tls.Config, error) {
+	if s.certFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// scheme 返回网关实际使用的websocket协议
+func (s *Server) scheme() string {
+	if s.certFile != "" {
+		return "wss"
+	}
+	return "ws"
+}
+
+// httpScheme 返回网关上普通 HTTP 接口（如浏览器界面）的协议
+func (s *Server) httpScheme() string {
+	if s.certFile != "" {
+		return "https"
+	}
+	return "http"
+}
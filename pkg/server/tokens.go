@@ -0,0 +1,228 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：多token与权限 ---------- */
+
+// -tokens-file 每行一个 "<token> <ro|rw> [子目录]"。网关在升级时按 Config.Token 和这组token认证，
+// 把解析出的权限挂在会话上。Config.Token 始终可读写整个沙箱。
+// ro 会话的写请求在网关直接以 403 TOKEN_READ_ONLY 回复，不会转发给本地处理器；限定了子目录的会话
+// 通过 scopeHeader 把子目录交给本地处理器，resolveSandboxPath 在 SecurePath 之前给路径加上这个前缀
+
+// 权限的取值
+const (
+	PermReadOnly  = "ro"
+	PermReadWrite = "rw"
+)
+
+// scopeHeader 是网关告诉本地处理器会话所限定的子目录的请求头，整个沙箱时不设置
+const scopeHeader = "X-Wsbox-Scope"
+
+// grant 是一个token的权限
+type grant struct {
+	perm  string
+	scope string // 沙箱内的子目录，"/" 表示整个沙箱
+}
+
+// fullAccess 是 Config.Token 的权限
+var fullAccess = grant{perm: PermReadWrite, scope: "/"}
+
+// parseTokensFile 读取token文件：空行和 # 开头的行被忽略，重复的token报错
+func parseTokensFile(name string) (map[string]grant, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("tokens file: %w", err)
+	}
+	defer f.Close()
+	grants := map[string]grant{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tok, g, err := parseGrant(strings.Fields(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		if _, dup := grants[tok]; dup {
+			return nil, fmt.Errorf("%s:%d: duplicate token", name, n)
+		}
+		grants[tok] = g
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("tokens file: %w", err)
+	}
+	return grants, nil
+}
+
+func parseGrant(fields []string) (string, grant, error) {
+	if len(fields) < 2 || len(fields) > 3 {
+		return "", grant{}, errors.New("expected <token> <ro|rw> [subdir]")
+	}
+	g := grant{perm: fields[1], scope: "/"}
+	if g.perm != PermReadOnly && g.perm != PermReadWrite {
+		return "", grant{}, fmt.Errorf("invalid permission %q, expected %s or %s", g.perm, PermReadOnly, PermReadWrite)
+	}
+	if len(fields) == 3 {
+		if err := validPathValue(fields[2]); err != nil {
+			return "", grant{}, fmt.Errorf("subdir: %w", err)
+		}
+		g.scope = path.Clean("/" + fields[2])
+	}
+	// token 会出现在请求头里，不记录它本身
+	return fields[0], g, nil
+}
+
+// loadTokens 在 Open 中读取 -tokens-file
+func (s *Server) loadTokens() error {
+	if s.tokensFile == "" {
+		return nil
+	}
+	grants, err := parseTokensFile(s.tokensFile)
+	if err != nil {
+		return err
+	}
+	s.authMu.Lock()
+	s.grants = grants
+	s.authMu.Unlock()
+	return nil
+}
+
+// ReloadTokens 重新读取 -tokens-file，配合 SIGHUP 调用；没有token文件时什么也不做。已有的连接不会断开：
+// 权限或子目录变了的会话从下一个请求起按新的权限处理，只有token被删掉的会话被吊销。
+// 文件有问题时继续使用原来的token
+func (s *Server) ReloadTokens() error {
+	if s.tokensFile == "" {
+		return nil
+	}
+	grants, err := parseTokensFile(s.tokensFile)
+	if err != nil {
+		return fmt.Errorf("reload tokens: %w", err)
+	}
+	s.authMu.Lock()
+	s.grants = grants
+	var revoked []*session
+	for ss := range s.sessions {
+		if ss.token == s.token || ss.token == "" {
+			// 主token和 -no-token-on-unix 的会话不在文件中
+			continue
+		}
+		if g, ok := grants[ss.token]; ok {
+			ss.setGrant(g)
+		} else {
+			revoked = append(revoked, ss)
+		}
+	}
+	s.authMu.Unlock()
+	for _, ss := range revoked {
+		ss.revoke(revokeGrace)
+	}
+	logf("tokens reloaded: %d in file, revoked %d sessions", len(grants), len(revoked))
+	return nil
+}
+
+// tokenParam 是携带token的查询参数，用于浏览器无法设置请求头的场合（WebSocket、普通链接）
+const tokenParam = "token"
+
+// requestToken 返回请求携带的token：依次是 Authorization: Bearer、浏览器放在子协议中的token（见 protocol.TokenSubprotocolPrefix）
+// 和查询参数 ?token=
+func requestToken(r *http.Request) string {
+	if tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return tok
+	}
+	for _, p := range websocket.Subprotocols(r) {
+		if enc, ok := strings.CutPrefix(p, protocol.TokenSubprotocolPrefix); ok {
+			tok, err := base64.RawURLEncoding.DecodeString(enc)
+			if err != nil {
+				return ""
+			}
+			return string(tok)
+		}
+	}
+	return r.URL.Query().Get(tokenParam)
+}
+
+// lookupToken 返回请求携带的token及其权限，调用方持有 authMu
+func (s *Server) lookupToken(r *http.Request) (string, grant, bool) {
+	tok := requestToken(r)
+	if tok == "" {
+		// -no-token-on-unix：套接字的文件权限已经把关，代理转发的请求（地址被改写过）除外
+		if s.unixNoToken && viaUnix(r) && r.RemoteAddr == unixPeer {
+			return "", fullAccess, true
+		}
+		return "", grant{}, false
+	}
+	// 比较用 subtle.ConstantTimeCompare，耗时不随相同前缀的长度变化，不能逐字节猜出token；
+	// -tokens-file 的token逐个比较而不是在 map 中查找，同样不泄露与哪个token有多少相同
+	if subtle.ConstantTimeCompare([]byte(tok), []byte(s.token)) == 1 {
+		return tok, fullAccess, true
+	}
+	var found grant
+	ok := false
+	for t, g := range s.grants {
+		if subtle.ConstantTimeCompare([]byte(tok), []byte(t)) == 1 {
+			found, ok = g, true
+		}
+	}
+	return tok, found, ok
+}
+
+// writesSandbox 判断请求是否可能写入沙箱：GET 和不落盘的测速（/_bench/sink）之外的方法都算，以后新增的写操作也包括在内
+func writesSandbox(method, urlPath string) bool {
+	return method != "GET" && !(method == "POST" && urlPath == "/_bench/sink")
+}
+
+// sandboxWide 是汇总整个沙箱的接口，限定了子目录的token不能使用
+var sandboxWide = []string{"/_counts", "/_activity"}
+
+// forbidden 在转发之前检查会话的权限，不允许时返回要回复给客户端的错误
+func (g grant) forbidden(method, target string) *APIError {
+	urlPath, _, _ := strings.Cut(target, "?")
+	if g.perm == PermReadOnly && writesSandbox(method, urlPath) {
+		return &APIError{Code: protocol.TokenReadOnlyCode, Message: "this token is read-only"}
+	}
+	if g.scope != "/" {
+		for _, p := range sandboxWide {
+			if urlPath == p {
+				return &APIError{Code: protocol.OutOfScopeCode, Message: urlPath + " covers the whole sandbox and is unavailable to tokens limited to a subdirectory"}
+			}
+		}
+	}
+	return nil
+}
+
+// scopedPath 把客户端看到的路径换成沙箱中的路径：先加上会话限定的子目录，再解析别名。
+// 别名把路径带出子目录时返回错误，子目录是权限的边界
+func (s *Server) scopedPath(r *http.Request, raw string) (p string, aliased bool, err error) {
+	scope := r.Header.Get(scopeHeader)
+	p = path.Join("/", scope, path.Clean("/"+raw))
+	p, aliased = s.aliases.resolve(p)
+	if scope != "" && !underPath(p, path.Clean("/"+scope)) {
+		return "", aliased, errors.New("path is outside the directory of this token")
+	}
+	return p, aliased, nil
+}
+
+// visiblePath 是 scopedPath 的反方向：去掉会话限定的子目录，得到客户端看到的路径
+func visiblePath(r *http.Request, p string) string {
+	scope := r.Header.Get(scopeHeader)
+	if scope == "" {
+		return p
+	}
+	return path.Clean("/" + strings.TrimPrefix(p, path.Clean("/"+scope)))
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wsbox/pkg/client"
+)
+
+// lookupToken 只接受与主token或 -tokens-file 中某个token完全相同的token，前缀、延长和大小写不同的都不算
+func TestLookupToken(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens")
+	os.WriteFile(file, []byte("# comment\nreader-token-0001 ro /pub\nwriter-token-0002 rw\n"), 0o600)
+	s := newTestServer(t, Config{Token: "master-token-000", TokensFile: file})
+
+	tests := []struct {
+		token string
+		ok    bool
+		want  grant
+	}{
+		{"master-token-000", true, fullAccess},
+		{"reader-token-0001", true, grant{perm: PermReadOnly, scope: "/pub"}},
+		{"writer-token-0002", true, grant{perm: PermReadWrite, scope: "/"}},
+		{"master-token-00", false, grant{}},
+		{"master-token-0000", false, grant{}},
+		{"MASTER-TOKEN-000", false, grant{}},
+		{"reader-token-000", false, grant{}},
+		{"reader-token-00011", false, grant{}},
+		{"", false, grant{}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		s.authMu.Lock()
+		tok, g, ok := s.lookupToken(r)
+		s.authMu.Unlock()
+		if ok != tt.ok || g != tt.want || tok != tt.token {
+			t.Errorf("lookupToken(%q) = %q, %+v, %v; want %+v, %v", tt.token, tok, g, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// 限定子目录的token移动到带 ".." 的目标时被夹在子目录内，服务端回报清理后的、客户端看到的路径
+func TestScopedMoveReportsCleanPath(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens")
+	os.WriteFile(file, []byte("scoped-token-0001 rw /team\n"), 0o600)
+	s, wsURL := newTestGateway(t, Config{TokensFile: file})
+	cl, err := client.Dial(wsURL, "scoped-token-0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if _, err := cl.Upload("/c.txt", strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := cl.MoveTo("/c.txt", "../../secret/c.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != "/secret/c.txt" {
+		t.Errorf("MoveTo reported %q, want /secret/c.txt", moved)
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, "team", "secret", "c.txt")); err != nil {
+		t.Errorf("file is not under the token's directory: %v", err)
+	}
+
+	// 正文来自服务端，而不是客户端自己清理的参数
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/_move?src=/secret/c.txt&dst=/a/../../b/c.txt", nil)
+	r.Header.Set(scopeHeader, "/team")
+	s.localHandler(rec, r)
+	if body := strings.TrimSpace(rec.Body.String()); rec.Code != 200 || body != "/b/c.txt" {
+		t.Errorf("local move = %d %q, want 200 /b/c.txt", rec.Code, body)
+	}
+}
+
+// snapshotTree 记录目录下每一项的类型、权限、大小、修改时间和内容摘要
+func snapshotTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	snap := map[string]string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := fmt.Sprintf("%v %d %d", fi.Mode(), fi.Size(), fi.ModTime().UnixNano())
+		if fi.Mode().IsRegular() {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			entry += fmt.Sprintf(" %x", sha256.Sum256(data))
+		}
+		snap[p] = entry
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snap
+}
+
+// 只读的服务端和只读token：上传、建目录、移动和删除都以 403 拒绝，沙箱逐字节不变
+func TestReadOnlyLeavesSandboxUnchanged(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   Config
+		token string
+	}{
+		{"server -readonly", Config{ReadOnly: true}, testToken},
+		{"ro token", Config{}, "reader-token-0001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "tokens")
+			os.WriteFile(file, []byte("reader-token-0001 ro\n"), 0o600)
+			tt.cfg.TokensFile = file
+			tt.cfg.Token = testToken
+			s, wsURL := newTestGateway(t, tt.cfg)
+			os.WriteFile(filepath.Join(s.dir, "a.txt"), []byte("a"), 0o644)
+			os.MkdirAll(filepath.Join(s.dir, "d", "empty"), 0o755)
+			os.WriteFile(filepath.Join(s.dir, "d", "b.txt"), []byte("b"), 0o600)
+			before := snapshotTree(t, s.dir)
+
+			cl, err := client.Dial(wsURL, tt.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			ops := []struct {
+				name string
+				do   func() error
+			}{
+				{"replace a file", func() error { _, err := cl.Upload("/a.txt", strings.NewReader("changed")); return err }},
+				{"upload a new file", func() error { _, err := cl.Upload("/d/new.txt", strings.NewReader("new")); return err }},
+				{"mkdir", func() error { _, err := cl.Mkdir("/newdir"); return err }},
+				{"move a file", func() error { return cl.Move("/a.txt", "/moved.txt", false) }},
+				{"move over a file", func() error { return cl.Move("/a.txt", "/d/b.txt", true) }},
+				{"delete a file", func() error { return cl.Delete("/a.txt", false) }},
+				{"delete a tree", func() error { return cl.Delete("/d", true) }},
+			}
+			for _, op := range ops {
+				var re *client.RemoteError
+				if err := op.do(); !errors.As(err, &re) || re.Status != http.StatusForbidden {
+					t.Errorf("%s: %v, want 403", op.name, err)
+				}
+			}
+			if _, err := cl.List("/"); err != nil {
+				t.Errorf("list after the refused writes: %v", err)
+			}
+			after := snapshotTree(t, s.dir)
+			if !maps.Equal(before, after) {
+				t.Errorf("sandbox changed:\nbefore %v\nafter  %v", before, after)
+			}
+		})
+	}
+}
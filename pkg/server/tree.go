@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"wsbox/internal/protocol"
+)
+
+/* ---------- 服务端：递归目录树 ---------- */
+
+// defaultTreeLimit 是 Config.TreeLimit 为0时一棵树最多返回的条目数
+const defaultTreeLimit = 10000
+
+// handleTree 实现 GET /_tree?dir=&depth=：一次请求返回整棵目录树，客户端不必逐层请求 /_list。
+// 条目是相对 dir 的路径，按先序（父目录在前、同级按名字）排列，Depth 从 1（直接条目）开始；空目录同样列出。
+// depth 为 n 时只列出前 n 层，0 不限。条目数达到 -tree-limit 时停止并标记 limited；
+// 遍历占一个重操作配额，受 -walk-timeout 限制
+func (s *Server) handleTree(w http.ResponseWriter, r *http.Request, clientIP string) {
+	dir, real, err := s.resolveSandboxPath(r, "dir")
+	if err != nil {
+		logEvent(logEntry{IP: clientIP, Action: "TREE", Status: http.StatusBadRequest, Duration: elapsedSince(r), Err: "invalid path: " + err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fail := func(status int, e *APIError) {
+		logEvent(logEntry{IP: clientIP, Action: "TREE", Path: dir, Status: status, Duration: elapsedSince(r), Err: e.Message})
+		writeError(w, status, e)
+	}
+	maxDepth := 0
+	if v := r.URL.Query().Get("depth"); v != "" {
+		if maxDepth, err = strconv.Atoi(v); err != nil || maxDepth < 0 {
+			fail(http.StatusBadRequest, &APIError{Code: "BAD_DEPTH", Message: "depth must be a non-negative integer"})
+			return
+		}
+	}
+	fi, err := os.Stat(real)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fail(http.StatusNotFound, &APIError{Code: "NOT_FOUND", Message: "directory not found"})
+		} else {
+			fail(http.StatusInternalServerError, &APIError{Code: "STAT_FAILED", Message: err.Error()})
+		}
+		return
+	}
+	if !fi.IsDir() {
+		fail(http.StatusBadRequest, &APIError{Code: protocol.NotDirectoryCode, Message: "not a directory"})
+		return
+	}
+
+	t := newOpTimings()
+	release, wait, ok := s.heavy(w, r, clientIP, "TREE", weightWalk)
+	if !ok {
+		return
+	}
+	defer release()
+	t.queue = wait
+
+	ctx, cancel := s.walkContext(r)
+	defer cancel()
+
+	res := protocol.TreeResult{SchemaVersion: protocol.SchemaVersion, Dir: dir, Entries: []protocol.TreeEntry{}}
+	prog := track(r)
+	prog.begin("walking")
+	walkStart := time.Now()
+	err = filepath.WalkDir(real, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return errWalkBudget
+		}
+		if err != nil {
+			if p == real {
+				return err
+			}
+			return nil
+		}
+		if p == real || isReservedName(d.Name()) {
+			return nil
+		}
+		if len(res.Entries) == s.treeLimit {
+			res.Limited = true
+			return fs.SkipAll
+		}
+		prog.add(1)
+		rel, _ := filepath.Rel(real, p)
+		rel = filepath.ToSlash(rel)
+		depth := strings.Count(rel, "/") + 1
+		res.Entries = append(res.Entries, protocol.TreeEntry{Path: rel, Dir: d.IsDir(), Depth: depth})
+		if d.IsDir() && maxDepth > 0 && depth >= maxDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	t.walk = time.Since(walkStart)
+	if errors.Is(err, errWalkBudget) {
+		res.Truncated, err = true, nil
+	}
+	if err != nil {
+		fail(http.StatusInternalServerError, &APIError{Code: "READ_FAILED", Message: "walk failed: " + err.Error()})
+		return
+	}
+	switch {
+	case res.Truncated:
+		res.Warning = s.budgetWarning()
+	case res.Limited:
+		res.Warning = &protocol.Warning{
+			Code:    "RESULT_LIMIT",
+			Message: fmt.Sprintf("the tree was cut off after %d entries, list a subdirectory or use a smaller depth", s.treeLimit),
+		}
+	}
+	logEvent(logEntry{IP: clientIP, Action: "TREE", Path: dir, Status: http.StatusOK, Duration: elapsedSince(r),
+		Detail: fmt.Sprintf("depth=%d count=%d limited=%t truncated=%t", maxDepth, len(res.Entries), res.Limited, res.Truncated)})
+	serializeStart := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+	t.serialize = time.Since(serializeStart)
+	s.logSlow(clientIP, "TREE", "dir="+dir, t)
+}
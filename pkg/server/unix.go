@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+/* ---------- 服务端：Unix 域套接字 ---------- */
+
+// Config.Addr 写成 unix:///run/wsbox.sock 时网关监听 Unix 域套接字而不是 TCP 端口，供同一台机器上的自动化使用。
+// 套接字文件的权限为 Config.SocketMode（默认 DefaultSocketMode）。启动时已有的套接字文件如果没有服务端在监听
+// （上次异常退出留下的）就删除；有服务端在监听或者不是套接字时报错，不会删掉别的文件。关闭监听时删除套接字文件。
+//
+// 经过套接字的连接没有对端地址，日志、锁定和钩子中的客户端地址记为 "unix"，-allow-cidr/-deny-cidr 不适用。
+// Config.NoTokenOnUnix 让经过套接字、不带token的请求获得完整权限：能连接套接字的用户已经由文件权限把关。
+// 带了token的请求照常检查；-trust-proxy-header 改写了地址的请求（反向代理经过套接字转发的）仍然需要token
+
+const (
+	unixPrefix = "unix://"
+	unixPeer   = "unix" // 经过套接字的请求的客户端地址
+
+	// DefaultSocketMode 是 Unix 域套接字文件的默认权限：属主和同组用户可以连接
+	DefaultSocketMode os.FileMode = 0660
+)
+
+// unixSocketPath 返回 unix:// 地址中的套接字路径
+func unixSocketPath(addr string) (string, bool) {
+	p, ok := strings.CutPrefix(addr, unixPrefix)
+	return p, ok && p != ""
+}
+
+// listenUnix 在 path 上创建套接字并设置权限，先清理上次留下的套接字文件
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("another server is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+		logf("removed stale socket %s", path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// viaUnix 判断请求是否经过 Unix 域套接字
+func viaUnix(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// listenURL 返回监听 ln 上 path 的地址，Unix 域套接字写成客户端接受的 ws+unix:///run/wsbox.sock:/ws 形式
+func listenURL(scheme string, ln net.Listener, path string) string {
+	if ln.Addr().Network() == "unix" {
+		return scheme + "+unix://" + ln.Addr().String() + ":" + path
+	}
+	return scheme + "://" + ln.Addr().String() + path
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"wsbox/pkg/client"
+)
+
+// serveUnix 在 t.TempDir() 中的套接字上运行 ListenAndServe，等到套接字可以连接，返回套接字路径和客户端地址
+func serveUnix(t *testing.T, cfg Config) (*Server, string, string) {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "wsbox.sock")
+	cfg.Addr = unixPrefix + sock
+	s := newTestServer(t, cfg)
+	go s.ListenAndServe()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if c, err := net.Dial("unix", sock); err == nil {
+			c.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nothing is listening on %s", sock)
+		}
+	}
+	return s, sock, "ws+unix://" + sock + ":/ws"
+}
+
+// 经由套接字完成 add/get：套接字文件有配置的权限，上次留下的套接字文件被替换，关闭时删除
+func TestUnixSocketRoundTrip(t *testing.T) {
+	s, sock, url := serveUnix(t, Config{SocketMode: 0o600})
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Type() != os.ModeSocket || fi.Mode().Perm() != 0o600 {
+		t.Errorf("socket file has mode %v, want a 0600 socket", fi.Mode())
+	}
+
+	cl, err := client.Dial(url, testToken)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	data := bytes.Repeat([]byte("unix"), 50000)
+	if _, err := cl.Upload("/d/a.bin", bytes.NewReader(data)); err != nil {
+		t.Fatalf("upload over the socket: %v", err)
+	}
+	var got bytes.Buffer
+	if _, err := cl.Download("/d/a.bin", &got); err != nil {
+		t.Fatalf("download over the socket: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Errorf("downloaded %d bytes, want the %d uploaded", got.Len(), len(data))
+	}
+	cl.Close()
+
+	if _, err := client.Dial(url, "wrong-token"); err == nil {
+		t.Error("a wrong token was accepted over the socket")
+	}
+
+	s.Shutdown(context.Background())
+	if _, err := os.Lstat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket file left behind after shutdown: %v", err)
+	}
+}
+
+// 上次异常退出留下的套接字文件（没有服务端在监听）在启动时删除；有服务端在监听或不是套接字时拒绝启动
+func TestUnixSocketStale(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "wsbox.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = listenUnix(sock, DefaultSocketMode)
+	if err != nil {
+		t.Fatalf("stale socket was not replaced: %v", err)
+	}
+	defer ln.Close()
+	if _, err := listenUnix(sock, DefaultSocketMode); err == nil {
+		t.Error("started on a socket another server is listening on")
+	}
+
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, []byte("keep"), 0o644)
+	if _, err := listenUnix(file, DefaultSocketMode); err == nil {
+		t.Error("started on a path that is not a socket")
+	}
+	if b, _ := os.ReadFile(file); string(b) != "keep" {
+		t.Error("a regular file in the way was removed")
+	}
+}
+
+// -no-token-on-unix：经过套接字不带token的请求可以连接，带了错误token的照常拒绝
+func TestUnixSocketNoToken(t *testing.T) {
+	_, _, url := serveUnix(t, Config{NoTokenOnUnix: true})
+	cl, err := client.Dial(url, "")
+	if err != nil {
+		t.Fatalf("dial without a token: %v", err)
+	}
+	defer cl.Close()
+	if _, err := cl.Upload("/a.txt", bytes.NewReader([]byte("x"))); err != nil {
+		t.Fatalf("upload without a token: %v", err)
+	}
+	if _, err := client.Dial(url, "wrong-token"); err == nil {
+		t.Error("a wrong token was accepted with -no-token-on-unix")
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+	"wsbox/pkg/client"
+)
+
+// slowReader 每次最多返回 chunk 字节并在其间停顿，让并发的上传交错进行
+type slowReader struct {
+	r     io.Reader
+	chunk int
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	if len(p) > s.chunk {
+		p = p[:s.chunk]
+	}
+	return s.r.Read(p)
+}
+
+// 两个连接同时上传同一路径：结果是其中一个的完整内容，不会混合，也不留下暂存文件
+func TestConcurrentUploadSamePath(t *testing.T) {
+	s, wsURL := newTestGateway(t, Config{})
+	const size = 1 << 20
+	bodies := [][]byte{bytes.Repeat([]byte("a"), size), bytes.Repeat([]byte("b"), size)}
+	for round := 0; round < 5; round++ {
+		var wg sync.WaitGroup
+		errs := make([]error, len(bodies))
+		for i, body := range bodies {
+			cl, err := client.Dial(wsURL, testToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			wg.Add(1)
+			go func(i int, body []byte) {
+				defer wg.Done()
+				_, errs[i] = cl.Upload("/same.bin", &slowReader{r: bytes.NewReader(body), chunk: 32 << 10})
+			}(i, body)
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("round %d: upload %d: %v", round, i, err)
+			}
+		}
+		got, err := os.ReadFile(filepath.Join(s.dir, "same.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, bodies[0]) && !bytes.Equal(got, bodies[1]) {
+			t.Fatalf("round %d: result is %d bytes starting %q, not one writer's complete content", round, len(got), got[:min(len(got), 16)])
+		}
+		entries, _ := os.ReadDir(s.dir)
+		for _, e := range entries {
+			if strings.Contains(e.Name(), tempMarker) {
+				t.Errorf("round %d: temporary file %s left behind", round, e.Name())
+			}
+		}
+	}
+}
+
+// 分块上传在中途被篡改（内容与声明的摘要不一致）：整个过程中目标始终是原来的内容，
+// 不出现别的可见文件，结束时以 422 DIGEST_MISMATCH 拒绝并删掉暂存文件，连接仍可使用
+func TestCorruptedUploadNeverVisible(t *testing.T) {
+	good := bytes.Repeat([]byte("0123456789abcdef"), protocol.StreamChunkSize/16*2)
+	sum := sha256.Sum256(good)
+	digest := hex.EncodeToString(sum[:])
+	for name, declared := range map[string]string{"declared": digest, "trailer": protocol.DigestTrailer} {
+		t.Run(name, func(t *testing.T) {
+			s, wsURL := newTestGateway(t, Config{})
+			dst := filepath.Join(s.dir, "f.bin")
+			os.WriteFile(dst, []byte("old content"), 0o644)
+			assertUnchanged := func(when string) {
+				t.Helper()
+				if got, err := os.ReadFile(dst); err != nil || string(got) != "old content" {
+					t.Fatalf("%s: destination is %d bytes, %v; want the old content", when, len(got), err)
+				}
+				entries, _ := os.ReadDir(s.dir)
+				for _, e := range entries {
+					if e.Name() != "f.bin" && !strings.Contains(e.Name(), tempMarker) {
+						t.Fatalf("%s: %s is visible in the sandbox", when, e.Name())
+					}
+				}
+			}
+
+			conn := dialRaw(t, wsURL, http.Header{protocol.VersionHeader: {strconv.Itoa(protocol.Version)}, protocol.StreamHeader: {"1"}})
+			req, _ := json.Marshal(protocol.Request{Op: "POST", Path: "/f.bin", Args: url.Values{protocol.DigestParam: {declared}}})
+			conn.WriteMessage(websocket.TextMessage, req)
+			bad := bytes.Clone(good)
+			bad[len(bad)-100] ^= 0xff // 第二块中的一个字节
+			for i := 0; i < len(bad); i += protocol.StreamChunkSize {
+				if err := conn.WriteMessage(websocket.BinaryMessage, bad[i:i+protocol.StreamChunkSize]); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(20 * time.Millisecond)
+				assertUnchanged("during the upload")
+			}
+			end := protocol.StreamEnd
+			if declared == protocol.DigestTrailer {
+				end += " " + digest
+			}
+			conn.WriteMessage(websocket.TextMessage, []byte(end))
+			h, body, err := readReply(t, conn)
+			if err != nil || h.Status != http.StatusUnprocessableEntity || !strings.Contains(string(body), "DIGEST_MISMATCH") {
+				t.Fatalf("reply %+v %q, %v; want 422 DIGEST_MISMATCH", h, body, err)
+			}
+			assertUnchanged("after the upload")
+			entries, _ := os.ReadDir(s.dir)
+			if len(entries) != 1 {
+				t.Errorf("sandbox has %d entries after the rejected upload, want only f.bin", len(entries))
+			}
+			assertUsable(t, conn, "after a digest mismatch")
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* ---------- 服务端：上传钩子命令 ---------- */
+
+// -upload-hook 在每个上传的正文完整写入暂存文件之后、原子重命名之前执行一条命令（包括追加和解包出的每个文件），
+// 参数末尾追加暂存文件路径和沙箱内的目标路径，环境变量中另有：
+//
+//	WSBOX_STAGED     暂存文件的磁盘路径
+//	WSBOX_PATH       沙箱内的目标路径，如 /docs/a.txt
+//	WSBOX_SIZE       暂存文件的字节数
+//	WSBOX_CLIENT_IP  客户端地址（不含端口）
+//	WSBOX_IDENTITY   客户端token的指纹
+//
+// 退出码0放行；非零以 422 UPLOAD_HOOK_REJECTED 拒绝，stderr 放在错误的 verdict 中，暂存文件被删除。
+// 超时或无法启动以 503 UPLOAD_HOOK_FAILED 拒绝。同时运行的命令不超过 -upload-hook-concurrency 个，
+// 其余的上传排队等待，客户端断开时放弃等待
+
+// uploadHookStderr 是写进错误正文的 stderr 上限
+const uploadHookStderr = 4 << 10
+
+// uploadHook 是配置了 -upload-hook 时的命令
+type uploadHook struct {
+	argv    []string
+	timeout time.Duration
+	slots   chan struct{} // 并发上限
+}
+
+// newUploadHook 解析命令，command 为空时返回 nil
+func newUploadHook(command string, timeout time.Duration, concurrency int) *uploadHook {
+	argv := strings.Fields(command)
+	if len(argv) == 0 {
+		return nil
+	}
+	return &uploadHook{argv: argv, timeout: timeout, slots: make(chan struct{}, concurrency)}
+}
+
+// cappedBuffer 只保留写入的前 limit 个字节，其余丢弃
+type cappedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.Buffer.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// run 是接入 OnUploadStaged 的钩子
+func (h *uploadHook) run(ctx context.Context, ev TransferEvent) error {
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-h.slots }()
+
+	ip := hostOnly(ev.ClientIP)
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.argv[0], append(h.argv[1:], ev.Staged, ev.Path)...)
+	cmd.Env = append(os.Environ(),
+		"WSBOX_STAGED="+ev.Staged,
+		"WSBOX_PATH="+ev.Path,
+		"WSBOX_SIZE="+strconv.FormatInt(ev.Size, 10),
+		"WSBOX_CLIENT_IP="+ip,
+		"WSBOX_IDENTITY="+ev.Identity)
+	stderr := &cappedBuffer{limit: uploadHookStderr}
+	cmd.Stderr = stderr
+	// 命令在后台留下的子进程可能一直占着 stderr，不为它们等待
+	cmd.WaitDelay = time.Second
+	start := time.Now()
+	childMu.RLock()
+	err := cmd.Run()
+	childMu.RUnlock()
+	elapsed := time.Since(start)
+
+	if err == nil {
+		logEvent(logEntry{IP: ip, Action: "UPLOAD_HOOK", Path: ev.Path, Duration: elapsed, Detail: "accepted"})
+		return nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		verdict := strings.TrimSpace(stderr.String())
+		if stderr.truncated {
+			verdict += " …"
+		}
+		if verdict == "" {
+			verdict = fmt.Sprintf("hook exited with status %d", exitErr.ExitCode())
+		}
+		logEvent(logEntry{IP: ip, Action: "UPLOAD_HOOK", Path: ev.Path, Status: http.StatusUnprocessableEntity, Duration: elapsed,
+			Detail: fmt.Sprintf("exit=%d", exitErr.ExitCode()), Err: fmt.Sprintf("rejected verdict=%q", verdict)})
+		return &HookRejection{Status: http.StatusUnprocessableEntity,
+			Err: &APIError{Code: "UPLOAD_HOOK_REJECTED", Message: "upload rejected by the server's upload hook", Verdict: verdict}}
+	}
+	msg := err.Error()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		msg = fmt.Sprintf("timed out after %s", h.timeout)
+	}
+	logEvent(logEntry{IP: ip, Action: "UPLOAD_HOOK", Path: ev.Path, Status: http.StatusServiceUnavailable, Duration: elapsed, Err: msg})
+	return &HookRejection{Status: http.StatusServiceUnavailable,
+		Err: &APIError{Code: "UPLOAD_HOOK_FAILED", Message: "upload hook failed: " + msg}}
+}
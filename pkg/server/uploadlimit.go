@@ -0,0 +1,53 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/protocol"
+	"wsbox/internal/textfmt"
+)
+
+/* ---------- 服务端：上传大小限制 ---------- */
+
+// readLimitSlack 是网关单帧读取上限中留给请求行等开销的余量
+const readLimitSlack = 64 << 10
+
+// readLimit 返回网关单帧的读取上限，0表示不限。配置了 -max-upload-size 时，未协商分块上传的连接把整个文件放在一帧里，
+// 上限是它加上余量；-max-message-size 更小时取后者（New 保证它不小于 protocol.MinMessageSize，分块上传总能通过）
+func (s *Server) readLimit() int64 {
+	var limit int64
+	if s.maxUpload > 0 {
+		limit = max(s.maxUpload, protocol.StreamChunkSize) + readLimitSlack
+	}
+	if s.maxMessage > 0 && (limit == 0 || s.maxMessage < limit) {
+		limit = s.maxMessage
+	}
+	return limit
+}
+
+// noteReadLimit 在读取因单帧超过上限而失败时记录日志并返回 true，此时 gorilla 已以 1009 关闭连接
+func (s *Server) noteReadLimit(clientIP string, err error) bool {
+	if !errors.Is(err, websocket.ErrReadLimit) {
+		return false
+	}
+	limit := s.readLimit()
+	logEvent(logEntry{IP: clientIP, Action: "MESSAGE_LIMIT", Detail: fmt.Sprintf("close=%d", protocol.CloseMessageTooBig),
+		Err: fmt.Sprintf("message exceeds the server limit of %s (%d bytes), connection closed", textfmt.Size(limit), limit)})
+	return true
+}
+
+// tooLarge 是上传超过 Config.MaxUploadSize 时的错误
+func (s *Server) tooLarge() *APIError {
+	return &APIError{Code: protocol.TooLargeCode, Message: fmt.Sprintf("upload exceeds the server limit of %s (%d bytes)", textfmt.Size(s.maxUpload), s.maxUpload)}
+}
+
+// handleUploadLimits 实现 GET /_caps/upload，客户端可以在发送之前检查文件大小
+func (s *Server) handleUploadLimits(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(protocol.UploadLimits{SchemaVersion: protocol.SchemaVersion, MaxSize: s.maxUpload})
+}
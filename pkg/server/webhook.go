@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+/* ---------- 服务端：webhook 通知 ---------- */
+
+// -webhook-url 在每次上传（包括追加和解包出的每个文件）和删除成功之后向该地址 POST 一个 JSON（WebhookEvent）。
+// 通知通过 OnUploadComplete 和 OnDelete 钩子接入，只放进一个有界队列，由后台协程发送，从不拖慢文件操作；
+// 队列满时丢弃并记录日志。5xx 和网络错误按退避重试，4xx 不重试，最终失败只记录日志，不影响客户端。
+// 设置 -webhook-secret 时正文的 HMAC-SHA256 以 "sha256=<十六进制>" 放在签名头（默认 X-Wsbox-Signature）中
+
+const (
+	webhookQueue    = 256 // 等待发送的通知上限
+	webhookWorkers  = 2
+	webhookAttempts = 4 // 第一次发送加3次重试
+	webhookTimeout  = 10 * time.Second
+
+	// DefaultWebhookSignatureHeader 是默认的签名头
+	DefaultWebhookSignatureHeader = "X-Wsbox-Signature"
+)
+
+// webhookBackoff 是第一次重试前的等待，之后每次翻倍
+var webhookBackoff = time.Second
+
+// WebhookEvent 是 webhook 请求的正文
+type WebhookEvent struct {
+	Event    string `json:"event"` // upload 或 delete
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`             // 删除为0
+	SHA256   string `json:"sha256,omitempty"` // 上传内容的 SHA-256 十六进制，删除时为空
+	TS       string `json:"ts"`               // UTC，RFC 3339
+	ClientIP string `json:"client_ip"`
+}
+
+// webhook 是配置了 -webhook-url 时的通知发送者，nil 表示不发送
+type webhook struct {
+	url       string
+	secret    []byte
+	sigHeader string
+	client    *http.Client
+
+	mu     sync.Mutex // 保护 closed 和向 ch 的发送
+	closed bool
+	ch     chan WebhookEvent
+	wg     sync.WaitGroup
+	stop   context.CancelFunc // 取消正在进行的发送和退避
+	ctx    context.Context
+}
+
+// newWebhook 检查地址，rawURL 为空时返回 nil
+func newWebhook(rawURL, secret, sigHeader string) (*webhook, error) {
+	if rawURL == "" {
+		if secret != "" {
+			return nil, errors.New("-webhook-secret requires -webhook-url")
+		}
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("-webhook-url: %q is not an http(s) URL", rawURL)
+	}
+	if sigHeader == "" {
+		sigHeader = DefaultWebhookSignatureHeader
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &webhook{
+		url:       rawURL,
+		secret:    []byte(secret),
+		sigHeader: sigHeader,
+		client:    &http.Client{Timeout: webhookTimeout},
+		ch:        make(chan WebhookEvent, webhookQueue),
+		ctx:       ctx,
+		stop:      stop,
+	}, nil
+}
+
+// start 启动发送协程，在 Open 中调用
+func (h *webhook) start() {
+	if h == nil {
+		return
+	}
+	for range webhookWorkers {
+		h.wg.Add(1)
+		go h.run()
+	}
+}
+
+// hook 返回把 event 类的事件放进队列的钩子
+func (h *webhook) hook(event string) HookFunc {
+	return func(_ context.Context, ev TransferEvent) error {
+		h.enqueue(WebhookEvent{Event: event, Path: ev.Path, Size: ev.Size, SHA256: ev.Hash,
+			TS: time.Now().UTC().Format(time.RFC3339), ClientIP: hostOnly(ev.ClientIP)})
+		return nil
+	}
+}
+
+// enqueue 不阻塞：队列满或已关闭时丢弃 e
+func (h *webhook) enqueue(e WebhookEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	select {
+	case h.ch <- e:
+	default:
+		logEvent(logEntry{IP: e.ClientIP, Action: "WEBHOOK", Path: e.Path, Err: fmt.Sprintf("queue full (%d), %s event dropped", webhookQueue, e.Event)})
+	}
+}
+
+func (h *webhook) run() {
+	defer h.wg.Done()
+	for e := range h.ch {
+		h.deliver(e)
+	}
+}
+
+// deliver 发送 e，5xx 和网络错误时退避重试
+func (h *webhook) deliver(e WebhookEvent) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		status, err := h.post(body)
+		if err == nil {
+			return
+		}
+		retry := status == 0 || status >= 500
+		if !retry || attempt == webhookAttempts {
+			logEvent(logEntry{IP: e.ClientIP, Action: "WEBHOOK", Path: e.Path, Status: status,
+				Detail: fmt.Sprintf("event=%s attempts=%d", e.Event, attempt), Err: err.Error()})
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-h.ctx.Done():
+			logEvent(logEntry{IP: e.ClientIP, Action: "WEBHOOK", Path: e.Path, Status: status,
+				Detail: fmt.Sprintf("event=%s attempts=%d", e.Event, attempt), Err: "shutting down: " + err.Error()})
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// post 发送一次，返回接收方的状态码（网络错误时为0）
+func (h *webhook) post(body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wsbox-webhook")
+	if len(h.secret) > 0 {
+		mac := hmac.New(sha256.New, h.secret)
+		mac.Write(body)
+		req.Header.Set(h.sigHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// close 不再接受新的通知，等待队列中的发送完，ctx 结束时取消剩余的发送
+func (h *webhook) close(ctx context.Context) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.ch)
+	}
+	h.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if n := len(h.ch); n > 0 {
+			logf("webhook: shutdown timeout, dropping %d queued events", n)
+		}
+		h.stop()
+		<-done
+	}
+	h.stop()
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"wsbox/pkg/client"
+)
+
+// delivery 是接收方收到的一次 webhook 请求
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver 记录收到的请求，第 i 次以 statuses[i] 回复（超出时回复 200）
+func webhookReceiver(t *testing.T, statuses ...int) (string, <-chan delivery) {
+	t.Helper()
+	ch := make(chan delivery, 16)
+	var mu sync.Mutex
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		status := http.StatusOK
+		if n < len(statuses) {
+			status = statuses[n]
+		}
+		n++
+		mu.Unlock()
+		if r.Method != http.MethodPost {
+			t.Errorf("webhook used %s", r.Method)
+		}
+		ch <- delivery{r.Header.Clone(), body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, ch
+}
+
+func receive(t *testing.T, ch <-chan delivery) delivery {
+	t.Helper()
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivery")
+		return delivery{}
+	}
+}
+
+// expectQuiet 检查接收方在一段时间内没有再收到请求
+func expectQuiet(t *testing.T, ch <-chan delivery, what string) {
+	t.Helper()
+	select {
+	case d := <-ch:
+		t.Errorf("%s: unexpected delivery %s", what, d.body)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// 上传和删除各发出一个签名的通知，正文中的大小、哈希和客户端地址与操作相符
+func TestWebhookDelivery(t *testing.T) {
+	url, ch := webhookReceiver(t)
+	_, wsURL := newTestGateway(t, Config{WebhookURL: url, WebhookSecret: "hook-secret"})
+	cl, err := client.Dial(wsURL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	data := []byte("webhook payload")
+	if _, err := cl.Upload("/d/a.txt", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	check := func(d delivery, want WebhookEvent) {
+		t.Helper()
+		mac := hmac.New(sha256.New, []byte("hook-secret"))
+		mac.Write(d.body)
+		if sig := d.header.Get(DefaultWebhookSignatureHeader); sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("%s: signature %q does not match the body", want.Event, sig)
+		}
+		if ct := d.header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type %q", want.Event, ct)
+		}
+		var e WebhookEvent
+		dec := json.NewDecoder(bytes.NewReader(d.body))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("%s: body %s: %v", want.Event, d.body, err)
+		}
+		ts, err := time.Parse(time.RFC3339, e.TS)
+		if err != nil || time.Since(ts) > time.Minute || !strings.HasSuffix(e.TS, "Z") {
+			t.Errorf("%s: ts %q is not a recent UTC time", want.Event, e.TS)
+		}
+		e.TS = ""
+		if e != want {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+	}
+	check(receive(t, ch), WebhookEvent{Event: "upload", Path: "/d/a.txt", Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:]), ClientIP: "127.0.0.1"})
+
+	if err := cl.Delete("/d/a.txt", false); err != nil {
+		t.Fatal(err)
+	}
+	check(receive(t, ch), WebhookEvent{Event: "delete", Path: "/d/a.txt", ClientIP: "127.0.0.1"})
+
+	// 失败的操作不发通知
+	if err := cl.Delete("/d/missing.txt", false); err == nil {
+		t.Fatal("deleting a missing file succeeded")
+	}
+	expectQuiet(t, ch, "failed delete")
+}
+
+// 5xx 按退避重试直到成功，每次的正文相同；4xx 不重试
+func TestWebhookRetry(t *testing.T) {
+	old := webhookBackoff
+	webhookBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { webhookBackoff = old })
+
+	url, ch := webhookReceiver(t, 503, 502, 200)
+	_, wsURL := newTestGateway(t, Config{WebhookURL: url, WebhookSignatureHeader: "X-Hub-Signature"})
+	cl, err := client.Dial(wsURL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	cl.Upload("/a.txt", strings.NewReader("x"))
+	first := receive(t, ch)
+	for i := 2; i <= 3; i++ {
+		if d := receive(t, ch); !bytes.Equal(d.body, first.body) {
+			t.Errorf("attempt %d sent %s, the first sent %s", i, d.body, first.body)
+		}
+	}
+	expectQuiet(t, ch, "after a successful retry")
+	// 没有密钥时不签名
+	if first.header.Get("X-Hub-Signature") != "" || first.header.Get(DefaultWebhookSignatureHeader) != "" {
+		t.Errorf("unsigned webhook carries a signature: %v", first.header)
+	}
+
+	url, ch = webhookReceiver(t, 400)
+	_, wsURL = newTestGateway(t, Config{WebhookURL: url})
+	cl2, err := client.Dial(wsURL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl2.Close()
+	cl2.Upload("/a.txt", strings.NewReader("x"))
+	receive(t, ch)
+	expectQuiet(t, ch, "after a 400")
+}
+
+// 接收方一直失败时最多尝试 webhookAttempts 次，文件操作不受影响
+func TestWebhookGivesUp(t *testing.T) {
+	old := webhookBackoff
+	webhookBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { webhookBackoff = old })
+
+	url, ch := webhookReceiver(t, 500, 500, 500, 500, 500, 500)
+	_, wsURL := newTestGateway(t, Config{WebhookURL: url})
+	cl, err := client.Dial(wsURL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if _, err := cl.Upload("/a.txt", strings.NewReader("x")); err != nil {
+		t.Fatalf("upload with a failing webhook: %v", err)
+	}
+	for range webhookAttempts {
+		receive(t, ch)
+	}
+	expectQuiet(t, ch, "after the last attempt")
+}
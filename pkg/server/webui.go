@@ -0,0 +1,50 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+/* ---------- 服务端：浏览器界面 ---------- */
+
+// -webui 在网关的 / 上提供嵌入在二进制中的单页界面（webui/ 目录），部署仍然只有一个文件。
+// 页面本身不需要token；打开后先要求输入token，用 GET /webui/auth 检查，通过后以 protocol.Subprotocol
+// 和 protocol.TokenSubprotocolPrefix 直接连接 /ws，列表、上传和下载都是普通的版本2请求，
+// 权限、限额和日志与命令行客户端完全相同。任何 401 都让页面重新要求输入token
+
+//go:embed webui
+var webuiFiles embed.FS
+
+// webuiHandler 返回界面的静态文件和token检查接口，挂在网关的 / 和 /webui/ 上
+func (s *Server) webuiHandler() http.Handler {
+	assets, _ := fs.Sub(webuiFiles, "webui")
+	files := http.FileServerFS(assets)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		setWebuiHeaders(w)
+		http.ServeFileFS(w, r, assets, "index.html")
+	})
+	mux.Handle("GET /webui/", http.StripPrefix("/webui", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setWebuiHeaders(w)
+		files.ServeHTTP(w, r)
+	})))
+	// 与升级使用同一个认证检查，失败同样计入 -auth-fail-limit
+	mux.HandleFunc("GET /webui/auth", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if !s.checkAuth(w, r) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// setWebuiHeaders 限制页面只能加载自己的脚本、只能连接同一网关，也不能被别的网站嵌入
+func setWebuiHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Content-Security-Policy", "default-src 'self'; img-src 'self' blob: data:; frame-ancestors 'none'")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("Cache-Control", "no-cache")
+}
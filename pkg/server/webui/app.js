@@ -0,0 +1,414 @@
+// wsbox 浏览器界面：输入token后直接以版本2协议连接网关的 /ws（见 pkg/server/webui.go）。
+// 一条连接上的请求依次进行：发出 JSON 请求帧（上传时再发一个正文帧），收到 JSON 状态头和一个正文帧。
+// 任何 401 都清掉token并重新要求输入
+"use strict";
+
+const messages = {
+  en: {
+    token_label: "Access token",
+    sign_in: "Sign in",
+    logout: "Sign out",
+    choose_files: "Upload files…",
+    drop_hint: "or drop files anywhere on this page",
+    drop_here: "Drop to upload here",
+    name: "Name",
+    size: "Size",
+    modified: "Modified",
+    truncated: "The listing was cut short; not every entry is shown.",
+    bad_token: "The token was not accepted.",
+    locked_out: "Too many failed attempts, try again later.",
+    revoked: "The token was revoked, sign in again.",
+    unreachable: "Cannot reach the server.",
+    empty: "This directory is empty.",
+    uploading: "Uploading {0} ({1}/{2})…",
+    uploaded: "Uploaded {0} file(s).",
+    downloading: "Downloading {0}…",
+    failed: "{0}: {1}",
+  },
+  zh: {
+    token_label: "访问token",
+    sign_in: "登录",
+    logout: "退出",
+    choose_files: "上传文件…",
+    drop_hint: "或者把文件拖到页面上的任意位置",
+    drop_here: "松开即上传到这里",
+    name: "名称",
+    size: "大小",
+    modified: "修改时间",
+    truncated: "列表被截断，没有显示全部条目。",
+    bad_token: "token无效。",
+    locked_out: "失败次数过多，请稍后再试。",
+    revoked: "token已被吊销，请重新登录。",
+    unreachable: "无法连接服务端。",
+    empty: "目录是空的。",
+    uploading: "正在上传 {0}（{1}/{2}）…",
+    uploaded: "已上传 {0} 个文件。",
+    downloading: "正在下载 {0}…",
+    failed: "{0}：{1}",
+  },
+};
+
+const lang = navigator.language.toLowerCase().startsWith("zh") ? "zh" : "en";
+
+function t(key, ...args) {
+  return messages[lang][key].replace(/\{(\d)\}/g, (_, i) => args[i]);
+}
+
+const $ = (id) => document.getElementById(id);
+
+/* ---------- 认证 ---------- */
+
+const tokenKey = "wsbox.token";
+
+// AuthError 表示服务端拒绝了token，界面回到登录表单
+class AuthError extends Error {}
+
+// checkToken 用 GET /webui/auth 检查token，返回 null 或要显示的原因
+async function checkToken(token) {
+  let resp;
+  try {
+    resp = await fetch("/webui/auth", { headers: { Authorization: "Bearer " + token }, cache: "no-store" });
+  } catch {
+    return t("unreachable");
+  }
+  if (resp.status === 204) return null;
+  if (resp.status === 401) return t("bad_token");
+  if (resp.status === 429) return t("locked_out");
+  return t("unreachable");
+}
+
+// tokenProtocol 把token编码成子协议值：UTF-8 之后的 base64url，没有填充
+function tokenProtocol(token) {
+  let bin = "";
+  for (const b of new TextEncoder().encode(token)) bin += String.fromCharCode(b);
+  return "wsbox.token." + btoa(bin).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+/* ---------- 连接 ---------- */
+
+// Gateway 是一条到 /ws 的连接，请求排队依次进行；连接断开后下一个请求重新连接
+class Gateway {
+  constructor(token) {
+    this.token = token;
+    this.ws = null;
+    this.queue = Promise.resolve();
+    this.pending = null; // 正在等待响应的请求：{ header, resolve, reject }
+  }
+
+  open() {
+    if (this.ws && this.ws.readyState === WebSocket.OPEN) return Promise.resolve();
+    return new Promise((resolve, reject) => {
+      const scheme = location.protocol === "https:" ? "wss:" : "ws:";
+      const ws = new WebSocket(scheme + "//" + location.host + "/ws", ["wsbox", tokenProtocol(this.token)]);
+      ws.binaryType = "arraybuffer";
+      let opened = false;
+      ws.onopen = () => {
+        opened = true;
+        this.ws = ws;
+        resolve();
+      };
+      ws.onmessage = (ev) => this.receive(ev.data);
+      ws.onclose = async (ev) => {
+        if (this.ws === ws) this.ws = null;
+        let err = new Error(ev.reason || t("unreachable"));
+        if (ev.code === 4001) {
+          err = new AuthError(t("revoked"));
+        } else if (!opened) {
+          // 浏览器不提供升级失败的状态码，另外检查一次token
+          const reason = await checkToken(this.token);
+          if (reason) err = new AuthError(reason);
+        }
+        if (!opened) reject(err);
+        if (this.pending) {
+          this.pending.reject(err);
+          this.pending = null;
+        }
+      };
+    });
+  }
+
+  receive(data) {
+    const p = this.pending;
+    if (!p) return;
+    if (typeof data === "string") {
+      p.header = JSON.parse(data);
+      return;
+    }
+    this.pending = null;
+    p.resolve({ header: p.header, body: data });
+  }
+
+  // request 发出一个请求，返回 { header, body }；body 是 ArrayBuffer。401 以 AuthError 拒绝，其他错误状态以 Error 拒绝
+  request(op, path, args, body) {
+    const run = async () => {
+      await this.open();
+      const resp = await new Promise((resolve, reject) => {
+        this.pending = { header: null, resolve, reject };
+        const frame = { op, path };
+        if (args) frame.args = args;
+        this.ws.send(JSON.stringify(frame));
+        if (body !== undefined) this.ws.send(body);
+      });
+      if (resp.header.status === 401) throw new AuthError(t("revoked"));
+      if (resp.header.status >= 300) throw new Error(errorMessage(resp));
+      return resp;
+    };
+    const p = this.queue.then(run, run);
+    this.queue = p.catch(() => {});
+    return p;
+  }
+
+  close() {
+    if (this.ws) this.ws.close();
+    this.ws = null;
+  }
+}
+
+// errorMessage 取出错误响应的说明：JSON 的 APIError 或纯文本
+function errorMessage(resp) {
+  const text = new TextDecoder().decode(resp.body).trim();
+  try {
+    const e = JSON.parse(text);
+    if (e && e.message) return e.message;
+  } catch {}
+  return text || "HTTP " + resp.header.status;
+}
+
+/* ---------- 界面 ---------- */
+
+let gw = null;
+let cwd = "/";
+
+function showLogin(reason) {
+  sessionStorage.removeItem(tokenKey);
+  if (gw) gw.close();
+  gw = null;
+  $("browser").hidden = true;
+  $("logout").hidden = true;
+  $("crumbs").replaceChildren();
+  $("login").hidden = false;
+  $("login-error").hidden = !reason;
+  $("login-error").textContent = reason || "";
+  $("token").value = "";
+  $("token").focus();
+}
+
+function showBrowser(token) {
+  sessionStorage.setItem(tokenKey, token);
+  gw = new Gateway(token);
+  $("login").hidden = true;
+  $("browser").hidden = false;
+  $("logout").hidden = false;
+  navigate();
+}
+
+function setStatus(text, error) {
+  $("status").hidden = !text;
+  $("status").textContent = text || "";
+  $("status").classList.toggle("error", !!error);
+}
+
+// fail 显示失败；token失效时回到登录表单
+function fail(err, what) {
+  if (err instanceof AuthError) {
+    showLogin(err.message);
+    return;
+  }
+  setStatus(what ? t("failed", what, err.message) : err.message, true);
+}
+
+function joinPath(dir, name) {
+  return (dir.endsWith("/") ? dir : dir + "/") + name;
+}
+
+function formatSize(n) {
+  const units = ["B", "KiB", "MiB", "GiB", "TiB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return (i === 0 ? n : n.toFixed(1)) + " " + units[i];
+}
+
+function link(text, onclick) {
+  const a = document.createElement("a");
+  a.href = "#";
+  a.textContent = text;
+  a.addEventListener("click", (ev) => {
+    ev.preventDefault();
+    onclick();
+  });
+  return a;
+}
+
+// 当前目录放在 URL 的 # 之后，浏览器的前进后退可以用
+function navigate() {
+  const dir = decodeURIComponent(location.hash.slice(1)) || "/";
+  cwd = dir.startsWith("/") ? dir : "/" + dir;
+  renderCrumbs();
+  load();
+}
+
+function go(dir) {
+  location.hash = encodeURI(dir);
+}
+
+function renderCrumbs() {
+  const nav = $("crumbs");
+  nav.replaceChildren(link("/", () => go("/")));
+  let p = "";
+  for (const seg of cwd.split("/").filter(Boolean)) {
+    p += "/" + seg;
+    const target = p;
+    nav.append(" ", link(seg, () => go(target)), " /");
+  }
+}
+
+async function load() {
+  if (!gw) return;
+  const dir = cwd;
+  let result;
+  try {
+    const resp = await gw.request("GET", "/_list", { dir: [dir], format: ["long"] });
+    result = JSON.parse(new TextDecoder().decode(resp.body));
+  } catch (err) {
+    fail(err, dir);
+    return;
+  }
+  if (dir !== cwd) return;
+  const rows = [];
+  if (dir !== "/") {
+    const up = dir.slice(0, dir.lastIndexOf("/")) || "/";
+    rows.push(row(link("..", () => go(up)), "", "", true));
+  }
+  for (const e of result.entries || []) {
+    const full = joinPath(dir, e.name);
+    const name = e.dir ? link(e.name + "/", () => go(full)) : link(e.name, () => download(full, e.name));
+    rows.push(row(name, e.dir ? "" : formatSize(e.size), new Date(e.mod_time).toLocaleString(), e.dir));
+  }
+  if (rows.length === 0) {
+    const td = document.createElement("td");
+    td.colSpan = 3;
+    td.className = "hint";
+    td.textContent = t("empty");
+    const tr = document.createElement("tr");
+    tr.append(td);
+    rows.push(tr);
+  }
+  $("listing").tBodies[0].replaceChildren(...rows);
+  $("truncated").hidden = !result.truncated;
+}
+
+function row(name, size, mtime, dir) {
+  const tr = document.createElement("tr");
+  const cells = [name, size, mtime].map((v) => {
+    const td = document.createElement("td");
+    td.append(v);
+    return td;
+  });
+  cells[0].className = dir ? "dir" : "";
+  cells[1].className = "size";
+  tr.append(...cells);
+  return tr;
+}
+
+// download 通过网关取回整个文件，再以浏览器的下载保存
+async function download(path, name) {
+  setStatus(t("downloading", name));
+  let resp;
+  try {
+    resp = await gw.request("GET", path);
+  } catch (err) {
+    fail(err, path);
+    return;
+  }
+  const url = URL.createObjectURL(new Blob([resp.body]));
+  const a = document.createElement("a");
+  a.href = url;
+  a.download = name;
+  document.body.append(a);
+  a.click();
+  a.remove();
+  setTimeout(() => URL.revokeObjectURL(url), 60000);
+  setStatus("");
+}
+
+// upload 依次把文件上传到当前目录，每个文件整体作为一个正文帧发送
+async function upload(files) {
+  const dir = cwd;
+  let done = 0;
+  for (const f of files) {
+    setStatus(t("uploading", f.name, done + 1, files.length));
+    try {
+      await gw.request("POST", joinPath(dir, f.name), null, await f.arrayBuffer());
+    } catch (err) {
+      fail(err, f.name);
+      if (err instanceof AuthError) return;
+      load();
+      return;
+    }
+    done++;
+  }
+  setStatus(t("uploaded", done));
+  load();
+}
+
+/* ---------- 事件 ---------- */
+
+document.addEventListener("DOMContentLoaded", () => {
+  for (const el of document.querySelectorAll("[data-i18n]")) el.textContent = t(el.dataset.i18n);
+  document.documentElement.lang = lang;
+
+  $("login").addEventListener("submit", async (ev) => {
+    ev.preventDefault();
+    const token = $("token").value;
+    const reason = await checkToken(token);
+    if (reason) {
+      showLogin(reason);
+      return;
+    }
+    showBrowser(token);
+  });
+  $("logout").addEventListener("click", () => showLogin());
+  $("picker").addEventListener("change", (ev) => {
+    const files = [...ev.target.files];
+    ev.target.value = "";
+    if (files.length) upload(files);
+  });
+  window.addEventListener("hashchange", () => {
+    if (gw) navigate();
+  });
+
+  // 拖入文件时显示遮罩，dragenter/dragleave 在子元素之间也会触发，按计数判断
+  let depth = 0;
+  const dragging = (ev) => gw && ev.dataTransfer && [...ev.dataTransfer.types].includes("Files");
+  document.addEventListener("dragenter", (ev) => {
+    if (!dragging(ev)) return;
+    ev.preventDefault();
+    depth++;
+    $("dropzone").hidden = false;
+  });
+  document.addEventListener("dragover", (ev) => {
+    if (dragging(ev)) ev.preventDefault();
+  });
+  document.addEventListener("dragleave", () => {
+    depth = Math.max(depth - 1, 0);
+    if (depth === 0) $("dropzone").hidden = true;
+  });
+  document.addEventListener("drop", (ev) => {
+    if (!dragging(ev)) return;
+    ev.preventDefault();
+    depth = 0;
+    $("dropzone").hidden = true;
+    const files = [...ev.dataTransfer.files];
+    if (files.length) upload(files);
+  });
+
+  const saved = sessionStorage.getItem(tokenKey);
+  if (saved) {
+    showBrowser(saved);
+  } else {
+    showLogin();
+  }
+});
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"wsbox/internal/clientconfig"
+	"wsbox/internal/i18n"
+	"wsbox/internal/textfmt"
+)
+
+/* ---------- 客户端：配置文件中的 profile ---------- */
+
+// 配置文件（见 internal/clientconfig）中的 profile 给出服务端地址、token、证书选项和默认的全局标志，
+// 用 -profile、$WSBOX_PROFILE 或文件中的 default 选择。命令行上显式给出的标志总是优先；
+// token 也可以来自 -token、-token-file 或 $WSBOX_TOKEN，它们都优先于 profile 的 token（见 resolveToken）
+
+// profileReserved 是 profile 的 flags 中不能出现的全局标志：地址由 url 给出，token 由 token 给出，
+// -json 只有部分命令支持，profile 不能再选择配置
+var profileReserved = map[string]bool{"s": true, "token": true, "token-file": true, "json": true, "profile": true, "config": true}
+
+// selectProfile 读取配置文件并选出要使用的 profile。文件不存在时只有显式给出 -config 或要求了 profile 才是错误；
+// 没有选择任何 profile 时 prof 为 nil
+func selectProfile(path string, explicitPath bool, name string) (cfg *clientconfig.Config, prof *clientconfig.Profile, err error) {
+	if name == "" {
+		name = os.Getenv("WSBOX_PROFILE")
+	}
+	if !explicitPath {
+		if path, err = clientconfig.DefaultPath(); err != nil {
+			if name == "" {
+				return nil, nil, nil
+			}
+			return nil, nil, err
+		}
+	}
+	cfg, err = clientconfig.Load(path)
+	switch {
+	case errors.Is(err, clientconfig.ErrNotFound):
+		if explicitPath || name != "" {
+			return nil, nil, errors.New(i18n.T("profile.no_config", path))
+		}
+		return nil, nil, nil
+	case err != nil:
+		return nil, nil, err
+	}
+	if name == "" {
+		name = cfg.Default
+	}
+	if name == "" {
+		return cfg, nil, nil
+	}
+	if prof = cfg.Profile(name); prof == nil {
+		return nil, nil, errors.New(i18n.T("profile.not_found", name, path))
+	}
+	if prof.Token != "" {
+		if w := clientconfig.CheckPermissions(path); w != "" {
+			fmt.Fprintln(os.Stderr, w)
+		}
+	}
+	return cfg, prof, nil
+}
+
+// profileArgs 把 profile 的证书选项和 flags 转换为放在命令行标志之前的参数，并校验它们都是已知的全局标志
+func profileArgs(p *clientconfig.Profile) ([]string, error) {
+	var args []string
+	if p.Insecure != nil {
+		args = append(args, "-insecure="+strconv.FormatBool(*p.Insecure))
+	}
+	if p.CACert != "" {
+		args = append(args, "-cacert", p.CACert)
+	}
+	check := flag.NewFlagSet("profile "+p.Name, flag.ContinueOnError)
+	check.SetOutput(io.Discard)
+	registerClientFlags(check)
+	if err := check.Parse(p.Flags); err != nil {
+		return nil, fmt.Errorf("profile %q: flags: %w", p.Name, err)
+	}
+	if check.NArg() > 0 {
+		return nil, fmt.Errorf("profile %q: flags: %q is not a global client flag", p.Name, check.Arg(0))
+	}
+	var err error
+	check.Visit(func(f *flag.Flag) {
+		if profileReserved[f.Name] {
+			err = fmt.Errorf("profile %q: flags must not contain -%s", p.Name, f.Name)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(args, p.Flags...), nil
+}
+
+// serverURL 决定连接地址：命令行上的 -s 优先于 profile 的 url。token 由 resolveToken 单独决定，
+// 地址中的token只在其他来源都没有给出时由 dial 使用
+func serverURL(flagURL string, explicit bool, prof *clientconfig.Profile) string {
+	if !explicit && prof != nil && prof.URL != "" {
+		return prof.URL
+	}
+	return flagURL
+}
+
+// resolveToken 按 -token、-token-file、$WSBOX_TOKEN、profile 的 token 的顺序决定token，都没有时返回空串，
+// 由 dial 使用地址中的token。命令行给出 -s 时不使用 profile 的 token，以免把它发给另一个服务端
+func resolveToken(flagToken, tokenFile string, explicitServer bool, prof *clientconfig.Profile) (string, error) {
+	switch {
+	case flagToken != "":
+		return flagToken, nil
+	case tokenFile != "":
+		return readTokenFile(tokenFile)
+	}
+	if t := os.Getenv("WSBOX_TOKEN"); t != "" {
+		return t, nil
+	}
+	if !explicitServer && prof != nil {
+		return prof.Token, nil
+	}
+	return "", nil
+}
+
+// readTokenFile 读取token文件的第一行，去掉首尾空白
+func readTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("-token-file: %w", err)
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	if line = strings.TrimSpace(line); line == "" {
+		return "", fmt.Errorf("-token-file: %s: first line is empty", path)
+	}
+	return line, nil
+}
+
+// maskedURL 隐藏地址中的token
+func maskedURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = url.User(clientconfig.MaskToken(u.User.Username()))
+	// url.User 会转义 *，显示时还原
+	return strings.ReplaceAll(u.String(), "%2A", "*")
+}
+
+// profiles 实现 client profiles：列出配置文件中的 profile，token 只显示开头几个字符
+func (c *clientCmd) profiles(args []string) {
+	fs := newFlagSet("client profiles")
+	parseFlags(fs, args)
+	if c.config == nil {
+		path, err := clientconfig.DefaultPath()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, i18n.T("profile.no_config", path))
+		os.Exit(1)
+	}
+	if len(c.config.Profiles) == 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("profile.none", c.config.Path))
+		return
+	}
+	t := textfmt.NewTable(os.Stdout)
+	t.Row("", i18n.T("profile.col_name"), i18n.T("profile.col_url"), i18n.T("profile.col_token"), i18n.T("profile.col_flags"))
+	for _, p := range c.config.Profiles {
+		mark := ""
+		if c.profile != nil && c.profile.Name == p.Name {
+			mark = "*"
+		}
+		name := p.Name
+		if p.Name == c.config.Default {
+			name += " " + i18n.T("profile.default")
+		}
+		if p.Protected {
+			name += " " + i18n.T("profile.protected")
+		}
+		token := clientconfig.MaskToken(p.Token)
+		if token == "" {
+			token = "-"
+		}
+		flags, err := profileArgs(p)
+		if err != nil {
+			flags = p.Flags
+		}
+		t.Row(mark, name, maskedURL(p.URL), token, strings.Join(flags, " "))
+	}
+	t.Flush()
+	fmt.Println(i18n.T("profile.file", c.config.Path))
+}
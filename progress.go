@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"wsbox/internal/protocol"
+	"wsbox/internal/textfmt"
+)
+
+/* ---------- 客户端：进度显示 ---------- */
+
+// progressLine 在终端的 stderr 上显示服务端发来的进度帧，输出被重定向时不显示
+type progressLine struct {
+	shown bool
+}
+
+var stderrIsTerminal = isTerminal(os.Stderr)
+
+var stdoutIsTerminal = isTerminal(os.Stdout)
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (l *progressLine) Show(phase string, done int64) {
+	if !stderrIsTerminal {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s... %d", phase, done)
+	l.shown = true
+}
+
+func (l *progressLine) Clear() {
+	if l.shown {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		l.shown = false
+	}
+}
+
+/* ---------- 客户端：传输进度 ---------- */
+
+// 传输进度的显示方式
+const (
+	progressAuto = "auto" // stdout 和 stderr 都是终端时在 stderr 上显示进度条
+	progressJSON = "json" // 每秒向 stdout 输出一个 transferReport
+)
+
+// registerProgress 在 add/get 的 fs 上注册 -progress 和 -q，解析后调用返回的函数校验并记下显示方式
+func (c *clientCmd) registerProgress(fs *flag.FlagSet) func() error {
+	mode := fs.String("progress", progressAuto, "progress display: auto (a bar on the terminal) or json (one object per second on stdout)")
+	quiet := fs.Bool("q", false, "do not show transfer progress")
+	return func() error {
+		switch {
+		case *mode != progressAuto && *mode != progressJSON:
+			return fmt.Errorf("-progress must be %s or %s, not %q", progressAuto, progressJSON, *mode)
+		case *quiet:
+		case *mode == progressJSON:
+			c.progress = progressJSON
+		case stdoutIsTerminal && stderrIsTerminal:
+			c.progress = progressAuto
+		}
+		return nil
+	}
+}
+
+// transferReport 是 -progress=json 输出的对象，传输期间每秒一个，结束时再输出一个 done 为 true 的
+type transferReport struct {
+	SchemaVersion int      `json:"schema_version"`
+	Op            string   `json:"op"`                    // upload 或 download
+	Path          string   `json:"path"`                  // 远程路径
+	Bytes         int64    `json:"bytes"`                 // 已传输的字节数，含续传之前已有的部分
+	Total         int64    `json:"total"`                 // 文件大小，未知时为 -1
+	Percent       *float64 `json:"percent,omitempty"`     // 大小未知时省略
+	Rate          int64    `json:"rate"`                  // 当前速度，字节/秒
+	ETA           *float64 `json:"eta_seconds,omitempty"` // 预计剩余秒数，大小未知或速度为0时省略
+	Done          bool     `json:"done"`
+}
+
+// transferProgress 实现 client.TransferReporter：在终端上刷新一行进度条（字节数、百分比、速度、剩余时间），
+// 或者每秒输出一个 JSON 对象
+type transferProgress struct {
+	op, path string
+	json     bool
+	jsonOut  io.Writer // JSON 的输出位置，get - 时 stdout 用于文件内容，改为 stderr
+	format   textfmt.Options
+
+	mu       sync.Mutex
+	bytes    int64
+	total    int64
+	rate     float64 // 平滑后的速度，字节/秒
+	last     int64   // 上次刷新时的字节数
+	lastTime time.Time
+	shown    bool
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+}
+
+// newTransferProgress 按 -progress 和 -q 的结果创建进度显示，不显示时返回 nil
+func (c *clientCmd) newTransferProgress(op, path string) *transferProgress {
+	if c.progress == "" {
+		return nil
+	}
+	out := io.Writer(os.Stdout)
+	if c.stdoutData || c.json {
+		out = os.Stderr
+	}
+	return &transferProgress{op: op, path: path, json: c.progress == progressJSON, jsonOut: out, format: c.format}
+}
+
+// 刷新间隔：终端上足够平滑，JSON 按请求的每秒一个
+const (
+	barInterval  = 200 * time.Millisecond
+	jsonInterval = time.Second
+)
+
+func (p *transferProgress) Begin(total, done int64) {
+	p.mu.Lock()
+	p.bytes, p.total, p.last, p.rate = done, total, done, 0
+	p.lastTime = time.Now()
+	p.stop = make(chan struct{})
+	p.mu.Unlock()
+
+	interval := barInterval
+	if p.json {
+		interval = jsonInterval
+	}
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-t.C:
+				p.mu.Lock()
+				p.sample()
+				p.render(false)
+				p.mu.Unlock()
+			}
+		}
+	}()
+}
+
+func (p *transferProgress) Advance(n int64) {
+	p.mu.Lock()
+	p.bytes += n
+	p.mu.Unlock()
+}
+
+func (p *transferProgress) End() {
+	close(p.stop)
+	p.stopped.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.json {
+		p.sample()
+		p.render(true)
+	} else if p.shown {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		p.shown = false
+	}
+}
+
+// sample 用上次刷新以来的字节数更新速度，指数平滑避免数字跳动
+func (p *transferProgress) sample() {
+	now := time.Now()
+	dt := now.Sub(p.lastTime).Seconds()
+	if dt <= 0 {
+		return
+	}
+	cur := float64(p.bytes-p.last) / dt
+	if p.rate == 0 {
+		p.rate = cur
+	} else {
+		p.rate = 0.7*p.rate + 0.3*cur
+	}
+	p.last, p.lastTime = p.bytes, now
+}
+
+// eta 返回预计剩余时间，无法估计时返回 false
+func (p *transferProgress) eta() (time.Duration, bool) {
+	if p.total < 0 || p.rate <= 0 {
+		return 0, false
+	}
+	return time.Duration(float64(p.total-p.bytes) / p.rate * float64(time.Second)), true
+}
+
+func (p *transferProgress) render(done bool) {
+	if p.json {
+		r := transferReport{SchemaVersion: protocol.SchemaVersion, Op: p.op, Path: p.path, Bytes: p.bytes, Total: p.total, Rate: int64(p.rate), Done: done}
+		if p.total > 0 {
+			pct := float64(p.bytes) * 100 / float64(p.total)
+			r.Percent = &pct
+		} else if p.total == 0 {
+			pct := float64(100)
+			r.Percent = &pct
+		}
+		if d, ok := p.eta(); ok && !done {
+			secs := d.Seconds()
+			r.ETA = &secs
+		}
+		json.NewEncoder(p.jsonOut).Encode(r)
+		return
+	}
+	var line string
+	rate := p.format.Size(int64(p.rate)) + "/s"
+	if p.total > 0 {
+		const width = 24
+		filled := int(min(p.bytes, p.total) * width / p.total)
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+		eta := "-"
+		if d, ok := p.eta(); ok {
+			eta = textfmt.Duration(d)
+		}
+		line = fmt.Sprintf("%3d%% [%s] %s / %s  %s  ETA %s", p.bytes*100/p.total, bar,
+			p.format.Size(p.bytes), p.format.Size(p.total), rate, eta)
+	} else {
+		line = fmt.Sprintf("%s  %s", p.format.Size(p.bytes), rate)
+	}
+	fmt.Fprint(os.Stderr, "\r\033[K"+line)
+	p.shown = true
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：pull 命令（远程到本地的单向同步） ---------- */
+
+// pull 与 sync 共用遍历和计划（见 sync.go），方向相反：远程是发送方，本地是接收方。
+// 下载的文件原样保留远程的修改时间（不按时钟偏差换算，与 rsync 相同），下次比较时大小和时间都相同即视为未变化。
+// 修改时间精度较粗的文件系统（如 FAT 的2秒）用 -mtime-slack 放宽比较
+
+func (c *clientCmd) pull(args []string) {
+	fs := newFlagSet("client pull")
+	del := fs.Bool("delete", false, "delete local files and directories that do not exist on the server")
+	dryRun := fs.Bool("dry-run", false, "print the plan without transferring or deleting anything")
+	noVerify := fs.Bool("no-verify", false, "skip the SHA-256 check of the downloaded content")
+	parallel := c.registerParallel(fs)
+	retry := c.registerRetry(fs)
+	var filter filterFlags
+	filter.register(fs)
+	var guard guardFlags
+	guard.register(fs, false)
+	var cf listCacheFlags
+	cf.register(fs, 0)
+	args = parseFlags(fs, args)
+	filter.parse()
+	c.verify = !*noVerify && !*dryRun
+	if err := retry(); err != nil {
+		usageFail(err)
+	}
+	if len(args) < 2 {
+		usageFail(i18n.T("usage.missing_local"))
+	}
+	remote, local := path.Join("/", args[0]), args[1]
+	if fi, err := os.Stat(local); err == nil && !fi.IsDir() {
+		fmt.Fprintln(os.Stderr, i18n.T("pull.not_dir", local))
+		os.Exit(1)
+	}
+	if err := guard.checkRoots(local, remote); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	if st, err := cl.Stat(remote); err != nil {
+		c.fail(err)
+	} else if !st.Exists {
+		fmt.Fprintln(os.Stderr, i18n.T("pull.not_remote_dir", remote))
+		os.Exit(exitNotFound)
+	} else if !st.IsDir {
+		fmt.Fprintln(os.Stderr, i18n.T("pull.not_remote_dir", remote))
+		os.Exit(exitFailure)
+	}
+	// 规则来自远程根目录的 .wsboxignore，被排除的本地路径同样不比较也不删除
+	tf, err := filter.remote(cl, remote)
+	if err != nil {
+		c.fail(err)
+	}
+	lc := c.openListCache(cf)
+	remoteTree, truncated, err := c.walkRemoteTree(cl, lc, remote, tf)
+	if err != nil {
+		c.fail(err)
+	}
+	lc.save()
+	if truncated && *del {
+		fmt.Fprintln(os.Stderr, i18n.T("sync.delete_truncated", remote))
+		*del = false
+	}
+	localTree := map[string]syncEntry{}
+	if _, err := os.Stat(local); err == nil {
+		if localTree, err = walkLocalTree(local, tf); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	s := &syncer{c: c, cl: cl, local: local, remote: remote, pull: true}
+	plan, err := s.plan(remoteTree, localTree, *del)
+	if err != nil {
+		c.fail(err)
+	}
+	if *dryRun {
+		tf.report(os.Stdout, "sync.would_exclude")
+		for _, a := range plan {
+			target := filepath.Join(local, filepath.FromSlash(a.rel))
+			switch a.kind {
+			case "copy":
+				fmt.Println(i18n.T("pull.would_download", target, c.format.Size(a.size), a.reason))
+			case "mkdir":
+				fmt.Println(i18n.T("sync.would_mkdir", target))
+			case "delete":
+				fmt.Println(i18n.T("sync.would_delete", target))
+			}
+		}
+		fmt.Println(i18n.T("pull.dry_run_summary", s.st.copied, c.format.Size(s.st.bytes), s.st.skipped, s.st.deleted))
+		return
+	}
+	if err := os.MkdirAll(local, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	ok := s.runPull(plan, remoteTree, *parallel)
+	st := s.st
+	fmt.Println(i18n.T("pull.summary", st.copied, c.format.Size(st.bytes), st.skipped, st.deleted, st.failed))
+	if !ok || st.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runPull 按计划在本地执行。单个文件失败时继续；服务端返回的错误和摘要不一致不影响连接，
+// 其他错误可能在连接上留下未读完的响应，此时停止并返回 false
+func (s *syncer) runPull(plan []syncAction, remote map[string]syncEntry, parallel int) bool {
+	do := func(cl *client.Client, a syncAction) (string, error) {
+		target := filepath.Join(s.local, filepath.FromSlash(a.rel))
+		switch a.kind {
+		case "mkdir":
+			return target, os.MkdirAll(target, 0755)
+		case "copy":
+			return target, s.download(cl, a, target, remote[a.rel].modTime)
+		}
+		err := os.RemoveAll(target)
+		if err == nil {
+			s.mu.Lock()
+			s.st.deleted++
+			fmt.Println(i18n.T("status.delete_done", target))
+			s.mu.Unlock()
+		}
+		return target, err
+	}
+	fatal := func(err error) bool {
+		var re *client.RemoteError
+		var de *client.DigestError
+		var pe *os.PathError
+		return !errors.As(err, &re) && !errors.As(err, &de) && !errors.As(err, &pe)
+	}
+	return s.execute(plan, parallel, do, fatal)
+}
+
+// download 下载一个文件并设置修改时间，接收方的同名目录（类型冲突）在没有 -delete 时使下载失败
+func (s *syncer) download(cl *client.Client, a syncAction, target string, modTime time.Time) error {
+	if fi, err := os.Stat(target); err == nil && fi.IsDir() {
+		return &os.PathError{Op: "download", Path: target, Err: errors.New("is a directory")}
+	}
+	src := path.Join(s.remote, a.rel)
+	// 旧版服务端没有 /_extents，此时按稠密文件下载
+	ext, _ := cl.Extents(src)
+	ts, err := cl.DownloadFile(src, target, ext)
+	if err != nil {
+		return err
+	}
+	s.c.reportResume(ts)
+	s.c.reportTransfer(cl, ts)
+	if !modTime.IsZero() {
+		if err := os.Chtimes(target, modTime, modTime); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.st.copied++
+	s.st.bytes += ts.Size
+	fmt.Println(i18n.T("status.tree_fetched", target, s.c.format.Size(ts.Size)))
+	return nil
+}
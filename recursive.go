@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：目录树上传 ---------- */
+
+// treeStats 汇总一次目录树传输的结果
+type treeStats struct {
+	files     int
+	bytes     int64
+	failed    int
+	skipped   int
+	unchanged int // -if-changed 时内容与远程相同而跳过的文件
+}
+
+// addTree 遍历本地目录，把每个普通文件上传到 remote 下对应的路径，parallel 个连接同时上传不同的文件（见 runParallel）。
+// 远程目录由服务端在上传时按需创建；空目录不会出现在远程。
+// 符号链接默认跳过，followLinks 时上传链接指向的文件（指向目录的链接始终跳过，避免循环）；tf 排除的目录不再遍历。
+// ifChanged 时先与远程文件比较，内容相同的不上传（见 remoteUnchanged）。
+// 单个文件失败时继续处理其余文件，除非 failFast；连接断开时总是停止。返回是否全部成功
+func (c *clientCmd) addTree(local, remote string, tf *treeFilter, failFast, followLinks, ifChanged bool, parallel int) bool {
+	cl := c.dial()
+	defer func() { cl.Close() }()
+
+	var st treeStats
+	var mu sync.Mutex // 保护 st、fatal 和输出的顺序
+	var fatal error
+	var first string // failFast 时第一个失败的文件，汇总前再输出一次，免得淹没在其他连接的输出里
+	start := time.Now()
+	fail := func(rel string, err error) {
+		st.failed++
+		fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", rel, err))
+		if first == "" {
+			first = i18n.T("status.tree_file_failed", rel, err)
+		}
+	}
+
+	// 先遍历出全部文件，再分给工作连接
+	var files []string
+	walkErr := filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		rel, _ := filepath.Rel(local, p)
+		if err != nil {
+			fail(rel, err)
+			if failFast {
+				return fs.SkipAll
+			}
+			return nil
+		}
+		if p != local && tf.skip(filepath.ToSlash(rel), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			fi, err := os.Stat(p)
+			if !followLinks || err != nil || !fi.Mode().IsRegular() {
+				st.skipped++
+				if c.verbose {
+					fmt.Fprintln(os.Stderr, i18n.T("status.tree_skipped", rel))
+				}
+				return nil
+			}
+		} else if !d.Type().IsRegular() {
+			st.skipped++
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if failFast && st.failed > 0 {
+		files = nil
+	}
+	if c.verbose {
+		tf.report(os.Stderr, "status.tree_excluded")
+	}
+
+	cl = c.runParallel(parallel, cl, len(files), func(w *poolWorker, i int) bool {
+		rel := files[i]
+		target := path.Join(remote, filepath.ToSlash(rel))
+		var size int64
+		same := false
+		err := c.retrying(&w.cl, func(cl *client.Client) (err error) {
+			if ifChanged {
+				if same, err = remoteUnchanged(cl, filepath.Join(local, rel), target); same || err != nil {
+					return err
+				}
+			}
+			size, err = addTreeFile(cl, filepath.Join(local, rel), target)
+			return err
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil && same {
+			st.unchanged++
+			fmt.Println(i18n.T("status.tree_file_unchanged", target))
+			return false
+		}
+		if err == nil {
+			st.files++
+			st.bytes += size
+			fmt.Println(i18n.T("status.tree_file_done", target, c.format.Size(size)))
+			return false
+		}
+		var re *client.RemoteError
+		var le *client.LocalReadError
+		var pe *os.PathError
+		if client.IsReadOnly(err) || !errors.As(err, &re) && !errors.As(err, &le) && !errors.As(err, &pe) {
+			// 连接已不可用或服务端只读，剩余文件无法继续
+			if fatal == nil {
+				fatal = errors.New(describeErr(err))
+			}
+			st.failed++
+			return true
+		}
+		switch {
+		case client.IsExists(err):
+			err = errors.New(i18n.T("status.exists"))
+		case re != nil:
+			err = errors.New(re.Message())
+		}
+		fail(rel, err)
+		return failFast
+	})
+	if fatal != nil {
+		fmt.Fprintln(os.Stderr, fatal)
+	} else if walkErr != nil {
+		fmt.Fprintln(os.Stderr, walkErr)
+		st.failed++
+	} else if failFast && first != "" {
+		fmt.Fprintln(os.Stderr, i18n.T("status.fail_fast", first))
+	}
+	fmt.Println(i18n.T("status.tree_summary", st.files, c.format.Size(st.bytes), st.failed, st.skipped))
+	if ifChanged {
+		fmt.Println(i18n.T("status.tree_unchanged", st.unchanged))
+	}
+	if fatal == nil {
+		// 整棵树的平均吞吐，已包含每个文件的往返开销
+		c.noteTransfer(st.bytes, time.Since(start))
+	}
+	return st.failed == 0
+}
+
+// addTreeFile 上传目录树中的一个文件，返回文件大小
+func addTreeFile(cl *client.Client, p, target string) (int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := cl.Upload(target, f); err != nil {
+		return 0, err
+	}
+	size := int64(0)
+	if fi, err := f.Stat(); err == nil {
+		size = fi.Size()
+	}
+	return size, nil
+}
+
+/* ---------- 客户端：目录树下载 ---------- */
+
+// getTree 逐层请求 /_list 遍历远程目录（以 "/" 结尾的条目是目录），在本地用 MkdirAll 重建目录结构，
+// 遍历完成后 parallel 个连接同时下载不同的文件（见 runParallel）。skipExisting 时跳过本地已存在且大小相同的文件。
+// 排除规则来自 filter 和远程根目录的 .wsboxignore，被排除的目录不再列出。
+// 单个文件失败时继续；除服务端返回的错误外，失败的请求可能在连接上留下未读完的响应，此时重新连接。
+// 返回是否全部成功
+func (c *clientCmd) getTree(remote, local string, filter *filterFlags, casePolicy string, skipExisting bool, parallel int) bool {
+	lister := &poolWorker{cl: c.dial()}
+	tf, err := filter.remote(lister.cl, remote)
+	if err != nil {
+		c.fail(err)
+	}
+
+	var st treeStats
+	var files []treeFile
+	remote = path.Join("/", remote)
+	queue := []string{remote}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		rel := strings.TrimPrefix(strings.TrimPrefix(dir, remote), "/")
+		localDir := filepath.Join(local, filepath.FromSlash(rel))
+		names, err := c.listNames(lister.cl, dir)
+		if err != nil {
+			c.treeFileFailed(lister, &st, dir, err)
+			continue
+		}
+		if err := os.MkdirAll(localDir, 0755); err != nil {
+			st.failed++
+			fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", dir, err))
+			continue
+		}
+		for _, name := range names {
+			base := strings.TrimSuffix(name, "/")
+			// 服务端返回的是单层目录项，含路径分隔符或 "." ".." 的名字一律拒绝，防止写出本地目录
+			if base == "" || base == "." || base == ".." || strings.ContainsAny(base, `/\`) {
+				st.failed++
+				fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", path.Join(dir, name), "invalid entry name"))
+				continue
+			}
+			isDir := strings.HasSuffix(name, "/")
+			if tf.skip(path.Join(rel, base), isDir) {
+				continue
+			}
+			if isDir {
+				queue = append(queue, path.Join(dir, base))
+				continue
+			}
+			files = append(files, treeFile{path.Join(dir, base), filepath.Join(localDir, base)})
+		}
+	}
+
+	if c.verbose {
+		tf.report(os.Stderr, "status.tree_excluded")
+	}
+	return c.fetchTreeFiles(lister, files, st, casePolicy, skipExisting, parallel)
+}
+
+// treeFile 是目录树下载中的一个文件
+type treeFile struct{ remote, local string }
+
+// treeFileFailed 记录下载 p 的失败。除服务端返回的错误和摘要不一致外，连接上可能留有未读完的响应，此时为 w 重新连接
+func (c *clientCmd) treeFileFailed(w *poolWorker, st *treeStats, p string, err error) {
+	st.failed++
+	var re *client.RemoteError
+	var de *client.DigestError
+	switch {
+	case errors.As(err, &re):
+		fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", p, re.Message()))
+		return
+	case errors.As(err, &de):
+		// 内容已完整收到，连接仍可继续使用
+		fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", p, describeErr(err)))
+		return
+	}
+	fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", p, err))
+	w.cl.Close()
+	w.cl = c.dial()
+}
+
+// fetchTreeFiles 用 parallel 个连接（第一个是 lister 的）下载 files，st 是此前已记下的结果，最后输出汇总。返回是否全部成功
+func (c *clientCmd) fetchTreeFiles(lister *poolWorker, files []treeFile, st treeStats, casePolicy string, skipExisting bool, parallel int) bool {
+	var mu sync.Mutex // 保护 st 和输出的顺序
+	cl := c.runParallel(parallel, lister.cl, len(files), func(w *poolWorker, i int) bool {
+		var one treeStats
+		err := c.retrying(&w.cl, func(cl *client.Client) error {
+			return c.getTreeFile(cl, files[i].remote, files[i].local, casePolicy, skipExisting, &one)
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		st.files += one.files
+		st.bytes += one.bytes
+		st.skipped += one.skipped
+		st.failed += one.failed
+		if err != nil {
+			c.treeFileFailed(w, &st, files[i].remote, err)
+		}
+		return false
+	})
+	cl.Close()
+	fmt.Println(i18n.T("status.tree_fetch_summary", st.files, c.format.Size(st.bytes), st.skipped, st.failed))
+	return st.failed == 0
+}
+
+// getFilesFrom 实现 get -files-from：从 from（"-" 为标准输入）读取相对 remote 的路径，每条记录以换行分隔，nul 时以NUL分隔
+// （与 list -0、find -0 的输出相同），下载到 local 下对应的路径。以 "/" 结尾的记录是目录，跳过；开头的 "/" 去掉，
+// 仍相对 remote（find / 的输出因此可以直接使用）。含 ".." 或反斜杠的记录会写出 local，计为失败。其余与 get -r 相同
+func (c *clientCmd) getFilesFrom(remote, local, from string, nul bool, casePolicy string, skipExisting bool, parallel int) bool {
+	var data []byte
+	var err error
+	if from == stdioArg {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(from)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	sep := "\n"
+	if nul {
+		sep = "\x00"
+	}
+	var st treeStats
+	var files []treeFile
+	remote = path.Join("/", remote)
+	for _, rec := range strings.Split(string(data), sep) {
+		rel := strings.TrimLeft(rec, "/")
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			continue
+		}
+		if strings.Contains(rel, `\`) || !filepath.IsLocal(filepath.FromSlash(rel)) {
+			st.failed++
+			fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", rec, "invalid entry name"))
+			continue
+		}
+		dst := filepath.Join(local, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			st.failed++
+			fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", rel, err))
+			continue
+		}
+		files = append(files, treeFile{path.Join(remote, rel), dst})
+	}
+	return c.fetchTreeFiles(&poolWorker{cl: c.dial()}, files, st, casePolicy, skipExisting, parallel)
+}
+
+// getTreeFile 下载目录树中的一个文件
+func (c *clientCmd) getTreeFile(cl *client.Client, remote, local, casePolicy string, skipExisting bool, st *treeStats) error {
+	// 旧版服务端没有 /_extents，此时不跳过已有文件，按稠密文件下载
+	ext, _ := cl.Extents(remote)
+	if skipExisting && ext != nil {
+		if fi, err := os.Stat(local); err == nil && fi.Mode().IsRegular() && fi.Size() == ext.Size {
+			st.skipped++
+			if c.verbose {
+				fmt.Fprintln(os.Stderr, i18n.T("status.tree_exists", local))
+			}
+			return nil
+		}
+	}
+	local, err := resolveLocalCase(local, casePolicy)
+	if err != nil {
+		// 还没有发出请求，连接不受影响
+		st.failed++
+		fmt.Fprintln(os.Stderr, err)
+		return nil
+	}
+	ts, err := cl.DownloadFile(remote, local, ext)
+	if err != nil {
+		return err
+	}
+	c.reportResume(ts)
+	c.reportTransfer(cl, ts)
+	st.files++
+	st.bytes += ts.Size
+	fmt.Println(i18n.T("status.tree_fetched", local, c.format.Size(ts.Size)))
+	return nil
+}
+
+// listNames 获取一个远程目录的条目名，兼容只返回名字数组的旧服务端
+func (c *clientCmd) listNames(cl *client.Client, dir string) ([]string, error) {
+	res, err := cl.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	if res.Truncated {
+		fmt.Fprintln(os.Stderr, i18n.T("status.tree_truncated", dir))
+	}
+	return res.Entries, nil
+}
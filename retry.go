@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"wsbox/internal/i18n"
+	"wsbox/internal/protocol"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：瞬时故障的重试 ---------- */
+
+// add、get、sync 和 pull 的 -retries n 让连接失败、传输中途断开和服务端的 5xx 最多重试 n 次，
+// 第 k 次重试前等待 -retry-delay 的 2^(k-1) 倍（不超过 retryDelayMax），其中随机取后一半以错开同时重试的客户端。
+// 服务端的 4xx 说明请求本身有问题，从不重试。连接不可用时先重新连接；下载的重试从 .part 文件续传（见 client.DownloadFile）
+
+// retryDelayMax 是两次重试之间等待时间的上限，-retry-delay 更大时以它为准
+const retryDelayMax = time.Minute
+
+// registerRetry 在 fs 上注册 -retries 和 -retry-delay，解析后由 dial 和 retrying 使用
+func (c *clientCmd) registerRetry(fs *flag.FlagSet) func() error {
+	retries := fs.Int("retries", 0, "retry dial failures, dropped connections and 5xx responses up to `n` times (4xx responses are never retried)")
+	delay := fs.Duration("retry-delay", time.Second, "wait before the first retry, doubled for each further one, with jitter")
+	return func() error {
+		if *retries < 0 || *delay < 0 {
+			return errors.New("-retries and -retry-delay must not be negative")
+		}
+		c.retries, c.retryDelay = *retries, *delay
+		return nil
+	}
+}
+
+// retryable 判断失败是否可能是暂时的：连接失败、连接中断、服务端正在重启或返回 5xx。
+// token 被吊销、4xx、本地文件和校验的错误都不是
+func retryable(err error) bool {
+	var re *client.RemoteError
+	var he *client.HandshakeError
+	var ce *websocket.CloseError
+	var le *client.LocalReadError
+	var pe *client.PreallocError
+	var de *client.DigestError
+	var pxe *client.ProxyError
+	switch {
+	case errors.As(err, &le) || errors.As(err, &pe) || errors.As(err, &de):
+		return false
+	case errors.As(err, &pxe):
+		// 代理拒绝（认证、策略）重试也一样，连不上代理则可能是暂时的
+		return pxe.Err != nil && client.IsConnectionLost(pxe.Err)
+	case errors.As(err, &he):
+		return he.StatusCode >= 500
+	case errors.As(err, &re):
+		return re.Status >= 500
+	case errors.As(err, &ce):
+		// 违反协议、帧太大和token被吊销的关闭重试也无济于事
+		switch ce.Code {
+		case protocol.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseInternalServerErr,
+			websocket.CloseServiceRestart, websocket.CloseTryAgainLater:
+			return true
+		}
+		return false
+	}
+	return client.IsConnectionLost(err)
+}
+
+// retryWait 返回第 attempt 次重试前的等待时间
+func retryWait(delay time.Duration, attempt int) time.Duration {
+	d := delay
+	for i := 1; i < attempt && d < retryDelayMax; i++ {
+		d *= 2
+	}
+	d = min(d, max(delay, retryDelayMax))
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
+
+// backoff 在第 attempt 次尝试以 err 失败后决定是否重试：可以重试时在 stderr 说明次数和原因，等待后返回 true
+func (c *clientCmd) backoff(attempt int, err error) bool {
+	if attempt > c.retries || !retryable(err) {
+		return false
+	}
+	d := retryWait(c.retryDelay, attempt)
+	fmt.Fprintln(os.Stderr, i18n.T("status.retrying", attempt, c.retries+1, describeErr(err), d.Round(time.Millisecond)))
+	time.Sleep(d)
+	return true
+}
+
+// retrying 执行 op，可以重试的失败按 backoff 等待后再试。服务端返回的错误不影响连接，
+// 其他失败（连接断开，或请求在连接上留下了未读完的响应）先重新建立 *cl；重新连接失败也算一次尝试，
+// 此时 *cl 仍是已关闭的旧连接，不会是 nil
+func (c *clientCmd) retrying(cl **client.Client, op func(*client.Client) error) error {
+	err := op(*cl)
+	for attempt := 1; err != nil && c.backoff(attempt, err); attempt++ {
+		var re *client.RemoteError
+		if !errors.As(err, &re) {
+			(*cl).Close()
+			nc, derr := c.dialWorker()
+			if derr != nil {
+				err = derr
+				continue
+			}
+			*cl = nc
+		}
+		err = op(*cl)
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/internal/protocol"
+	"wsbox/pkg/server"
+)
+
+/* ---------- JSON 输出结构的模式 ---------- */
+
+// schemas 登记所有对外输出的 JSON 结构，供 "wsbox schema" 生成 JSON Schema
+var schemas = map[string]any{
+	"activity":        protocol.ActivityResult{},
+	"append":          appendResult{},
+	"append-result":   protocol.AppendResult{},
+	"archive-header":  protocol.ArchiveHeader{},
+	"archive-summary": protocol.ArchiveSummary{},
+	"audit":           server.AuditReport{},
+	"verify-audit":    server.AuditLogReport{},
+	"capabilities":    protocol.Capabilities{},
+	"client-error":    jsonError{},
+	"doctor":          doctorReport{},
+	"error":           protocol.APIError{},
+	"du":              protocol.DuResult{},
+	"estimate":        estimateReport{},
+	"counts":          protocol.DirCountsResult{},
+	"extents":         protocol.ExtentsResult{},
+	"extract-result":  protocol.ExtractResult{},
+	"find":            protocol.FindResult{},
+	"latest":          protocol.LatestResult{},
+	"list":            protocol.ListResult{},
+	"list-entries":    []protocol.ListEntry{},
+	"list-header":     protocol.ListHeader{},
+	"list-long":       protocol.LongListResult{},
+	"list-summary":    protocol.ListSummary{},
+	"metadata-limits": protocol.MetadataLimits{},
+	"progress":        transferReport{},
+	"upload-limits":   protocol.UploadLimits{},
+	"upload-offset":   protocol.UploadOffset{},
+	"lock":            protocol.LockInfo{},
+	"stat":            protocol.StatInfo{},
+	"transfer":        transferResult{},
+	"tree":            protocol.TreeResult{},
+}
+
+// runSchema 实现 "wsbox schema [name]"：不带参数时列出名字，否则打印对应的 JSON Schema
+func runSchema(args []string) {
+	if len(args) == 0 {
+		names := make([]string, 0, len(schemas))
+		for n := range schemas {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		fmt.Printf("schema version %d\n", protocol.SchemaVersion)
+		for _, n := range names {
+			fmt.Println(" ", n)
+		}
+		return
+	}
+	v, ok := schemas[args[0]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, i18n.T("schema.unknown", args[0]))
+		os.Exit(1)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(schemaDoc(args[0], v))
+}
+
+// schemaDoc 返回登记为 name 的结构 v 的完整 JSON Schema 文档，$id 中带有 SchemaVersion
+func schemaDoc(name string, v any) map[string]any {
+	doc := jsonSchema(reflect.TypeOf(v))
+	doc["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	doc["$id"] = fmt.Sprintf("wsbox:%s:v%d", name, protocol.SchemaVersion)
+	doc["title"] = name
+	return doc
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchema 根据 Go 类型和 json 标签生成 JSON Schema 片段
+func jsonSchema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		props := map[string]any{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if !f.IsExported() || tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = jsonSchema(f.Type)
+			if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+				required = append(required, name)
+			}
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           props,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	}
+	return map[string]any{}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wsbox/internal/protocol"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// 每个登记的输出结构的 JSON Schema 与 testdata/schemas 中的 golden 文件相同。结构有变化时必须同时增加
+// protocol.SchemaVersion：版本没有增加时即使 -update 也不改写，版本增加之后用 go test -update 重新生成
+func TestSchemaGolden(t *testing.T) {
+	dir := filepath.Join("testdata", "schemas")
+	if *update {
+		os.MkdirAll(dir, 0o755)
+	}
+	for name, v := range schemas {
+		got, err := json.MarshalIndent(schemaDoc(name, v), "", "  ")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got = append(got, '\n')
+		file := filepath.Join(dir, name+".json")
+		want, err := os.ReadFile(file)
+		switch {
+		case err == nil && bytes.Equal(got, want):
+			continue
+		case err != nil && !*update:
+			t.Errorf("%s: %v (run go test -update to create it)", name, err)
+			continue
+		case err == nil && goldenSchemaVersion(want) == protocol.SchemaVersion:
+			t.Errorf("schema %s changed but protocol.SchemaVersion is still %d; bump it and run go test -update", name, protocol.SchemaVersion)
+			continue
+		case !*update:
+			t.Errorf("schema %s is out of date for version %d; run go test -update", name, protocol.SchemaVersion)
+			continue
+		}
+		if err := os.WriteFile(file, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 删除了的结构也要删除它的 golden 文件，这同样是不兼容的变化
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, f := range files {
+		if _, ok := schemas[strings.TrimSuffix(filepath.Base(f), ".json")]; !ok {
+			t.Errorf("%s has no registered schema; remove it and bump protocol.SchemaVersion", f)
+		}
+	}
+}
+
+// goldenSchemaVersion 从 golden 文件的 $id（wsbox:<name>:v<n>）中取出生成它时的版本
+func goldenSchemaVersion(doc []byte) int {
+	var d struct {
+		ID string `json:"$id"`
+	}
+	json.Unmarshal(doc, &d)
+	var v int
+	if i := strings.LastIndex(d.ID, ":v"); i >= 0 {
+		fmt.Sscanf(d.ID[i+2:], "%d", &v)
+	}
+	return v
+}
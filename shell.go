@@ -0,0 +1,731 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"wsbox/internal/clientstate"
+	"wsbox/internal/i18n"
+	"wsbox/internal/textfmt"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：交互式 shell ---------- */
+
+// shell 只建立一次连接，在提示符下依次执行命令，相对路径按当前远程目录解析。
+// 连接不可用（服务端重启、网络中断）时用同一个地址和token重连，并把失败的命令再执行一次；
+// 命令执行期间的 Ctrl-C 关闭连接以中止它，下一个命令之前重连。exit 或输入结束时发送关闭帧后断开。
+// 补全、cd 和提示符中的条目数使用目录列表缓存（见 listcache.go），本会话的修改使涉及的目录失效，退出时写回状态目录
+
+// shellHistoryFile 是状态目录中保存命令历史的文件，保留最近 shellHistoryKeep 条
+const (
+	shellHistoryFile = "shell_history"
+	shellHistoryKeep = 500
+)
+
+// errShellInterrupted 表示命令被 Ctrl-C 中止
+var errShellInterrupted = errors.New("interrupted")
+
+// shellUsageError 表示参数不对，输出命令的用法
+type shellUsageError struct{ usage string }
+
+func (e *shellUsageError) Error() string { return i18n.T("help.usage") + " " + e.usage }
+
+// shellCommand 是 shell 中的一个命令
+type shellCommand struct {
+	name    string
+	usage   string
+	summary string // i18n 键
+	run     func(s *shell, args []string) error
+}
+
+func shellCommands() []shellCommand {
+	return []shellCommand{
+		{"ls", "ls [-l] [dir]", "shell.cmd.ls", (*shell).ls},
+		{"cd", "cd [-f] [dir|-]", "shell.cmd.cd", (*shell).cd},
+		{"pwd", "pwd", "shell.cmd.pwd", (*shell).pwd},
+		{"get", "get <remote> [local]", "shell.cmd.get", (*shell).get},
+		{"put", "put [-f] <local> [remote]", "shell.cmd.put", (*shell).put},
+		{"rm", "rm [-r] <remote>...", "shell.cmd.rm", (*shell).rm},
+		{"mkdir", "mkdir <dir>...", "shell.cmd.mkdir", (*shell).mkdir},
+		{"stat", "stat <remote>", "shell.cmd.stat", (*shell).stat},
+		{"refresh", "refresh [dir]", "shell.cmd.refresh", (*shell).refresh},
+		{"help", "help", "shell.cmd.help", (*shell).help},
+		{"exit", "exit", "shell.cmd.exit", nil},
+	}
+}
+
+// shell 的状态。cl 和 busy 也被处理 Ctrl-C 的协程访问，由 mu 保护
+type shell struct {
+	c    *clientCmd
+	ed   *lineEditor
+	cwd  string
+	prev string // cd - 回到的目录
+
+	mu          sync.Mutex
+	cl          *client.Client // 连接断开或被中止后为 nil，下一个命令之前重连
+	busy        bool
+	interrupted bool
+
+	cache  *listCache // 目录列表缓存，-cache-ttl 0 时为 nil
+	failed bool
+}
+
+// shell 实现 client shell [dir]
+func (c *clientCmd) shell(args []string) {
+	fs := newFlagSet("client shell")
+	var cf listCacheFlags
+	cf.register(fs, defaultListCacheTTL)
+	args = parseFlags(fs, args)
+	if stdoutIsTerminal && stderrIsTerminal {
+		c.progress = progressAuto
+	}
+	s := &shell{c: c, ed: newLineEditor(), cwd: "/", cache: c.openListCache(cf)}
+	if len(args) > 0 {
+		s.cwd = remoteDir(args[0])
+	}
+	s.ed.complete = s.complete
+	if err := s.connect(); err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("status.dial_failed", describeErr(err)))
+		os.Exit(exitCode(err))
+	}
+	if s.cwd != "/" {
+		if err := s.cd([]string{s.cwd}); err != nil {
+			s.report(err)
+			s.cwd = "/"
+		}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+	go s.interrupts(sigs)
+
+	if s.ed.prompt {
+		s.ed.history = loadShellHistory()
+		fmt.Println(i18n.T("shell.welcome", c.historyKey()))
+	}
+	added := len(s.ed.history)
+	for {
+		line, err := s.ed.readLine(s.prompt())
+		if errors.Is(err, errLineInterrupted) {
+			continue
+		}
+		if err != nil {
+			break
+		}
+		if s.ed.prompt && !strings.HasPrefix(line, " ") {
+			s.ed.addHistory(strings.TrimSpace(line))
+		}
+		if !s.execute(line) {
+			break
+		}
+	}
+	if s.ed.prompt {
+		saveShellHistory(s.ed.history[added:])
+	}
+	s.cache.save()
+	s.mu.Lock()
+	if s.cl != nil {
+		s.cl.Shutdown()
+	}
+	s.mu.Unlock()
+	if s.failed && !s.ed.prompt {
+		os.Exit(1)
+	}
+}
+
+// prompt 在当前目录的列表已经缓存时显示其中的条目数，列表被截断时带 +
+func (s *shell) prompt() string {
+	if l, ok := s.cache.get(s.cwd); ok {
+		n := strconv.Itoa(len(l.Entries))
+		if l.Truncated {
+			n += "+"
+		}
+		return "wsbox:" + s.cwd + " [" + n + "]> "
+	}
+	return "wsbox:" + s.cwd + "> "
+}
+
+// interrupts 处理 Ctrl-C：命令执行期间关闭连接以中止它。逐行读取时终端自己丢弃已输入的内容，这里重新输出提示符
+func (s *shell) interrupts(sigs <-chan os.Signal) {
+	for range sigs {
+		s.mu.Lock()
+		if s.busy && s.cl != nil {
+			s.interrupted = true
+			s.cl.Close()
+		} else if s.ed.prompt {
+			fmt.Print("\n" + s.prompt())
+		} else {
+			os.Exit(130)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// execute 执行一行命令，返回 false 表示退出
+func (s *shell) execute(line string) bool {
+	words, _, err := shellWords([]rune(line))
+	if err != nil {
+		s.report(err)
+		return true
+	}
+	if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+		return true
+	}
+	if words[0] == "exit" || words[0] == "quit" {
+		return false
+	}
+	for _, cmd := range shellCommands() {
+		if cmd.name == words[0] && cmd.run != nil {
+			if err := cmd.run(s, words[1:]); err != nil {
+				s.report(err)
+			}
+			return true
+		}
+	}
+	s.report(errors.New(i18n.T("shell.unknown", words[0])))
+	return true
+}
+
+func (s *shell) report(err error) {
+	s.failed = true
+	var ue *shellUsageError
+	switch {
+	case errors.Is(err, errShellInterrupted):
+		fmt.Fprintln(os.Stderr, i18n.T("shell.interrupted"))
+	case errors.As(err, &ue):
+		fmt.Fprintln(os.Stderr, err)
+	default:
+		fmt.Fprintln(os.Stderr, describeErr(err))
+	}
+}
+
+/* ---------- shell：连接 ---------- */
+
+func (s *shell) connect() error {
+	cl, err := s.c.dialWorker()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.cl = cl
+	s.mu.Unlock()
+	return nil
+}
+
+// call 在当前连接上执行 fn，需要时先重连。连接在执行中变得不可用时重连后再执行一次；
+// 服务端返回的错误状态和读取本地文件的错误不重试
+func (s *shell) call(fn func(*client.Client) error) error {
+	retried := false
+	for {
+		if s.cl == nil {
+			if err := s.connect(); err != nil {
+				return err
+			}
+		}
+		s.mu.Lock()
+		s.busy = true
+		cl := s.cl
+		s.mu.Unlock()
+		err := fn(cl)
+		s.mu.Lock()
+		s.busy = false
+		interrupted := s.interrupted
+		s.interrupted = false
+		s.mu.Unlock()
+		if interrupted {
+			s.dropConn()
+			return errShellInterrupted
+		}
+		var re *client.RemoteError
+		var le *client.LocalReadError
+		if err == nil || errors.As(err, &re) || errors.As(err, &le) || retried {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, i18n.T("shell.reconnecting", describeErr(err)))
+		s.dropConn()
+		retried = true
+	}
+}
+
+func (s *shell) dropConn() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cl != nil {
+		s.cl.Close()
+		s.cl = nil
+	}
+}
+
+// abs 按当前目录解析远程路径
+func (s *shell) abs(p string) string {
+	if strings.HasPrefix(p, "/") {
+		return path.Clean(p)
+	}
+	return path.Join(s.cwd, p)
+}
+
+// shellFlags 取出 args 开头属于 allowed 的单字母标志（如 "-l"），遇到 "--" 或第一个不是标志的参数时停止
+func shellFlags(args []string, allowed, usage string) (map[string]bool, []string, error) {
+	set := map[string]bool{}
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		a := args[0]
+		args = args[1:]
+		if a == "--" {
+			break
+		}
+		if !strings.Contains(allowed, strings.TrimPrefix(a, "-")) || len(a) != 2 {
+			return nil, nil, &shellUsageError{usage}
+		}
+		set[a[1:]] = true
+	}
+	return set, args, nil
+}
+
+/* ---------- shell：命令 ---------- */
+
+func (s *shell) ls(args []string) error {
+	const usage = "ls [-l] [dir]"
+	flags, args, err := shellFlags(args, "l", usage)
+	if err != nil || len(args) > 1 {
+		return &shellUsageError{usage}
+	}
+	dir := s.cwd
+	if len(args) == 1 {
+		dir = s.abs(args[0])
+	}
+	var res *client.LongListResult
+	if err := s.call(func(cl *client.Client) (err error) {
+		res, err = s.cache.list(cl, dir, true)
+		return err
+	}); err != nil {
+		return err
+	}
+	if flags["l"] {
+		t := textfmt.NewTable(os.Stdout, textfmt.Left, textfmt.Right)
+		for _, e := range res.Entries {
+			size, name := "-", e.Name
+			if e.Dir {
+				name += "/"
+			} else {
+				size = s.c.format.Size(e.Size)
+			}
+			t.Row(e.Mode, size, s.c.format.Time(e.ModTime), name)
+		}
+		t.Flush()
+	} else {
+		names := make([]string, len(res.Entries))
+		for i, e := range res.Entries {
+			names[i] = e.Name
+			if e.Dir {
+				names[i] += "/"
+			}
+		}
+		// 不是终端时每行一个名字
+		width := 0
+		if stdoutIsTerminal {
+			width = 80
+			if cols, _, err := terminalSize(int(os.Stdout.Fd())); err == nil {
+				width = cols
+			}
+		}
+		printColumns(os.Stdout, names, width, "\n")
+	}
+	if res.Truncated {
+		fmt.Fprintln(os.Stderr, i18n.T("status.tree_truncated", dir))
+	}
+	return nil
+}
+
+func (s *shell) cd(args []string) error {
+	const usage = "cd [-f] [dir|-]"
+	flags, args, err := shellFlags(args, "f", usage)
+	if err != nil || len(args) > 1 {
+		return &shellUsageError{usage}
+	}
+	dir := "/"
+	switch {
+	case len(args) == 0:
+	case args[0] == "-":
+		if s.prev == "" {
+			return nil
+		}
+		dir = s.prev
+	default:
+		dir = s.abs(args[0])
+	}
+	// 列出目标目录既确认它是目录，也让提示符显示条目数；列不出来时用 stat 给出确切的原因
+	err = s.call(func(cl *client.Client) error {
+		_, err := s.cache.list(cl, dir, flags["f"])
+		return err
+	})
+	var re *client.RemoteError
+	if errors.As(err, &re) {
+		var info *client.StatInfo
+		if err := s.call(func(cl *client.Client) (err error) {
+			info, err = cl.Stat(dir)
+			return err
+		}); err != nil {
+			return err
+		}
+		if !info.Exists {
+			return errors.New(i18n.T("stat.missing", dir))
+		}
+		if !info.IsDir {
+			return errors.New(i18n.T("pull.not_remote_dir", dir))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if dir != s.cwd {
+		s.prev, s.cwd = s.cwd, dir
+	}
+	return nil
+}
+
+func (s *shell) pwd(args []string) error {
+	fmt.Println(s.cwd)
+	return nil
+}
+
+func (s *shell) get(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return &shellUsageError{"get <remote> [local]"}
+	}
+	remote := s.abs(args[0])
+	local := path.Base(remote)
+	if len(args) == 2 {
+		local = args[1]
+		if fi, err := os.Stat(local); err == nil && fi.IsDir() {
+			local = filepath.Join(local, path.Base(remote))
+		}
+	}
+	var st client.TransferStats
+	err := s.call(func(cl *client.Client) (err error) {
+		if p := s.c.newTransferProgress("download", remote); p != nil {
+			cl.SetTransfer(p)
+			defer cl.SetTransfer(nil)
+		}
+		st, err = cl.DownloadFile(remote, local, nil)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(i18n.T("status.download_done", local), "("+s.c.format.Size(st.Size)+")")
+	return nil
+}
+
+func (s *shell) put(args []string) error {
+	const usage = "put [-f] <local> [remote]"
+	flags, args, err := shellFlags(args, "f", usage)
+	if err != nil || len(args) < 1 || len(args) > 2 {
+		return &shellUsageError{usage}
+	}
+	local := args[0]
+	fi, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return errors.New(i18n.T("shell.put_dir", local))
+	}
+	remote := path.Join(s.cwd, filepath.Base(local))
+	if len(args) == 2 {
+		remote = s.abs(args[1])
+		// 目标是已有的目录时放到其中
+		if strings.HasSuffix(args[1], "/") || remote == "/" {
+			remote = path.Join(remote, filepath.Base(local))
+		} else if err := s.call(func(cl *client.Client) error {
+			info, err := cl.Stat(remote)
+			if err == nil && info.IsDir {
+				remote = path.Join(remote, filepath.Base(local))
+			}
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	var st client.TransferStats
+	err = s.call(func(cl *client.Client) error {
+		f, err := os.Open(local)
+		if err != nil {
+			return &client.LocalReadError{Err: err}
+		}
+		defer f.Close()
+		if p := s.c.newTransferProgress("upload", remote); p != nil {
+			cl.SetTransfer(p)
+			defer cl.SetTransfer(nil)
+		}
+		cl.SetOverwrite(flags["f"])
+		defer cl.SetOverwrite(false)
+		st, err = cl.Upload(remote, f)
+		return err
+	})
+	if client.IsExists(err) {
+		return errors.New(i18n.T("shell.put_exists", remote))
+	}
+	s.cache.changed(remote)
+	if err != nil {
+		return err
+	}
+	fmt.Println(i18n.T("status.upload_done", remote), "("+s.c.format.Size(st.Bytes)+")")
+	return nil
+}
+
+func (s *shell) rm(args []string) error {
+	const usage = "rm [-r] <remote>..."
+	flags, args, err := shellFlags(args, "r", usage)
+	if err != nil || len(args) == 0 {
+		return &shellUsageError{usage}
+	}
+	for _, a := range args {
+		target := s.abs(a)
+		err := s.call(func(cl *client.Client) error { return cl.Delete(target, flags["r"]) })
+		s.cache.changed(target)
+		if err != nil {
+			if errors.Is(err, errShellInterrupted) {
+				return err
+			}
+			s.report(err)
+			continue
+		}
+		fmt.Println(i18n.T("status.delete_done", target))
+		if target == s.cwd || strings.HasPrefix(s.cwd, target+"/") {
+			s.cwd = path.Dir(target)
+		}
+	}
+	return nil
+}
+
+func (s *shell) mkdir(args []string) error {
+	if len(args) == 0 {
+		return &shellUsageError{"mkdir <dir>..."}
+	}
+	for _, a := range args {
+		target := s.abs(a)
+		var created bool
+		err := s.call(func(cl *client.Client) (err error) {
+			created, err = cl.Mkdir(target)
+			return err
+		})
+		if created {
+			s.cache.changed(target)
+		}
+		var re *client.RemoteError
+		switch {
+		case errors.Is(err, errShellInterrupted):
+			return err
+		case errors.As(err, &re) && re.Status == http.StatusMethodNotAllowed:
+			return errors.New(i18n.T("status.mkdir_unsupported"))
+		case err != nil:
+			s.report(err)
+		case created:
+			fmt.Println(i18n.T("status.mkdir_done", target))
+		default:
+			fmt.Println(i18n.T("status.mkdir_exists", target))
+		}
+	}
+	return nil
+}
+
+func (s *shell) stat(args []string) error {
+	if len(args) != 1 {
+		return &shellUsageError{"stat <remote>"}
+	}
+	target := s.abs(args[0])
+	var info *client.StatInfo
+	if err := s.call(func(cl *client.Client) (err error) {
+		info, err = cl.Stat(target)
+		return err
+	}); err != nil {
+		return err
+	}
+	if !info.Exists {
+		return errors.New(i18n.T("stat.missing", target))
+	}
+	s.c.printStat(info)
+	return nil
+}
+
+func (s *shell) refresh(args []string) error {
+	if len(args) > 1 {
+		return &shellUsageError{"refresh [dir]"}
+	}
+	dir := s.cwd
+	if len(args) == 1 {
+		dir = s.abs(args[0])
+		s.cache.drop(dir)
+	} else {
+		s.cache.drop("/")
+	}
+	var res *client.LongListResult
+	if err := s.call(func(cl *client.Client) (err error) {
+		res, err = s.cache.list(cl, dir, true)
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Println(i18n.T("shell.refreshed", dir, len(res.Entries)))
+	return nil
+}
+
+func (s *shell) help(args []string) error {
+	t := textfmt.NewTable(os.Stdout)
+	for _, cmd := range shellCommands() {
+		t.Row("  "+cmd.usage, i18n.T(cmd.summary))
+	}
+	t.Flush()
+	return nil
+}
+
+/* ---------- shell：补全 ---------- */
+
+// complete 补全光标前的最后一个词：第一个词补全命令名，put 的第一个参数补全本地路径，其余补全远程路径（cd 只补全目录）。
+// 补全不重连，连接不可用时没有候选
+func (s *shell) complete(line []rune) (start int, word string, cands []string) {
+	words, start, _ := shellWords(line)
+	index := len(words)
+	if start < len(line) {
+		index--
+		word = words[index]
+	}
+	if index == 0 {
+		for _, cmd := range shellCommands() {
+			if strings.HasPrefix(cmd.name, word) {
+				cands = append(cands, cmd.name)
+			}
+		}
+		return start, word, cands
+	}
+	if strings.HasPrefix(word, "-") {
+		return start, word, nil
+	}
+	positional := 0
+	for _, w := range words[1:index] {
+		if !strings.HasPrefix(w, "-") {
+			positional++
+		}
+	}
+	if words[0] == "put" && positional == 0 {
+		return start, word, completeLocal(word)
+	}
+	return start, word, s.completeRemote(word, words[0] == "cd")
+}
+
+// splitCompletion 把正在输入的路径分成目录部分（含结尾的 /）和名字前缀
+func splitCompletion(word string) (dir, prefix string) {
+	i := strings.LastIndex(word, "/")
+	return word[:i+1], word[i+1:]
+}
+
+func (s *shell) completeRemote(word string, dirsOnly bool) []string {
+	dir, prefix := splitCompletion(word)
+	target := s.cwd
+	if dir != "" {
+		target = s.abs(dir)
+	}
+	var entries []client.ListEntry
+	if l, ok := s.cache.get(target); ok {
+		entries = l.Entries
+	} else {
+		s.mu.Lock()
+		cl := s.cl
+		s.mu.Unlock()
+		if cl == nil {
+			return nil
+		}
+		res, err := s.cache.list(cl, target, true)
+		if err != nil {
+			return nil
+		}
+		entries = res.Entries
+	}
+	var cands []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name, prefix) || dirsOnly && !e.Dir {
+			continue
+		}
+		c := dir + e.Name
+		if e.Dir {
+			c += "/"
+		}
+		cands = append(cands, c)
+	}
+	return cands
+}
+
+func completeLocal(word string) []string {
+	dir, prefix := splitCompletion(word)
+	entries, err := os.ReadDir(filepath.FromSlash(dir + "."))
+	if err != nil {
+		return nil
+	}
+	var cands []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		c := dir + e.Name()
+		if fi, err := os.Stat(filepath.Join(filepath.FromSlash(dir+"."), e.Name())); err == nil && fi.IsDir() {
+			c += "/"
+		}
+		cands = append(cands, c)
+	}
+	sort.Strings(cands)
+	return cands
+}
+
+/* ---------- shell：历史 ---------- */
+
+// loadShellHistory 读取保存的命令历史，状态目录不可用时返回空
+func loadShellHistory() []string {
+	dir, err := clientstate.DefaultDir()
+	if err != nil {
+		return nil
+	}
+	st, err := clientstate.Open(dir)
+	if err != nil {
+		return nil
+	}
+	data, err := st.Read(shellHistoryFile)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
+// saveShellHistory 把本次新增的命令追加到历史文件，同时运行的多个 shell 的历史不会互相覆盖
+func saveShellHistory(added []string) {
+	if len(added) == 0 {
+		return
+	}
+	dir, err := clientstate.DefaultDir()
+	if err != nil {
+		return
+	}
+	st, err := clientstate.Open(dir)
+	if err != nil {
+		return
+	}
+	st.Update(shellHistoryFile, func(old []byte) ([]byte, error) {
+		var lines []string
+		if len(old) > 0 {
+			lines = strings.Split(strings.TrimRight(string(old), "\n"), "\n")
+		}
+		lines = append(lines, added...)
+		lines = lines[max(len(lines)-shellHistoryKeep, 0):]
+		return []byte(strings.Join(lines, "\n") + "\n"), nil
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/internal/textfmt"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：stat 命令 ---------- */
+
+func (c *clientCmd) stat(args []string) {
+	fs := newFlagSet("client stat")
+	asJSON := fs.Bool("json", false, "print the raw result as JSON")
+	hash := fs.Bool("hash", false, "also print the SHA-256 of a file; the server reads the whole file")
+	args = parseFlags(fs, args)
+	if len(args) < 1 {
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+	*asJSON = *asJSON || c.json
+	remote := args[0]
+	if !strings.HasPrefix(remote, "/") {
+		remote = "/" + remote
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	stat := cl.Stat
+	if *hash {
+		stat = cl.StatHash
+	}
+	info, err := stat(remote)
+	if err != nil {
+		c.fail(err)
+	}
+	switch {
+	case *asJSON:
+		json.NewEncoder(os.Stdout).Encode(info)
+	case !info.Exists:
+		fmt.Fprintln(os.Stderr, i18n.T("stat.missing", remote))
+	default:
+		c.printStat(info)
+		if *hash && !info.IsDir && info.SHA256 == "" {
+			fmt.Fprintln(os.Stderr, i18n.T("stat.hash_unsupported"))
+		}
+	}
+	if !info.Exists {
+		cl.Close()
+		os.Exit(exitNotFound)
+	}
+}
+
+// printStat 以两列表格输出存在的路径的元数据
+func (c *clientCmd) printStat(info *client.StatInfo) {
+	kind := i18n.T("browse.file")
+	if info.IsDir {
+		kind = i18n.T("browse.directory")
+	}
+	t := textfmt.NewTable(os.Stdout, textfmt.Left, textfmt.Left)
+	t.Row(i18n.T("stat.path"), info.Path)
+	t.Row(i18n.T("stat.type"), kind)
+	t.Row(i18n.T("stat.size"), fmt.Sprintf("%s (%d)", c.format.Size(info.Size), info.Size))
+	t.Row(i18n.T("stat.modified"), c.format.Time(info.ModTime))
+	if info.Mode != "" {
+		t.Row(i18n.T("stat.mode"), info.Mode)
+	}
+	if info.SHA256 != "" {
+		t.Row("sha256:", info.SHA256)
+	}
+	if l := info.Lock; l != nil {
+		t.Row(i18n.T("stat.locked"), i18n.T("stat.lock_detail", l.Holder, c.format.Time(l.AcquiredAt), textfmt.Duration(time.Duration(l.TTL)*time.Second)))
+	}
+	t.Flush()
+}
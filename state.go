@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"wsbox/internal/i18n"
+	"wsbox/internal/journal"
+)
+
+/* ---------- 服务端：状态存储维护 ---------- */
+
+// runState 实现 "wsbox server state verify|compact"，需要在服务停止时运行
+func runState(args []string) {
+	fs := newFlagSet("server state")
+	dir := fs.String("state-dir", "", "state directory of the server")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	args = parseFlags(fs, args)
+	if len(args) < 1 || (args[0] != "verify" && args[0] != "compact") {
+		printUsage("server state")
+		os.Exit(2)
+	}
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, i18n.T("state.need_dir"))
+		os.Exit(2)
+	}
+
+	if args[0] == "compact" {
+		st, rec, err := journal.Open(*dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer st.Close()
+		if err := st.Compact(); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("state.compact_failed", err))
+			os.Exit(1)
+		}
+		fmt.Printf("compacted %s at seq %d (replayed %d records, discarded %d bytes of torn tail)\n",
+			*dir, st.Stats().Seq, rec.Replayed, rec.TruncatedBytes)
+		return
+	}
+
+	rep, err := journal.Verify(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+	} else {
+		fmt.Printf("snapshot seq %d, %d journal records (%d pending replay)\n", rep.SnapshotSeq, rep.Records, rep.Pending)
+		if rep.TruncatedBytes > 0 {
+			fmt.Printf("torn tail: %d bytes will be discarded on next open\n", rep.TruncatedBytes)
+		}
+		names := make([]string, 0, len(rep.Namespaces))
+		for ns := range rep.Namespaces {
+			names = append(names, ns)
+		}
+		sort.Strings(names)
+		for _, ns := range names {
+			fmt.Printf("  %-20s %d keys\n", ns, rep.Namespaces[ns])
+		}
+		for _, g := range rep.Gaps {
+			fmt.Println("ERROR:", g)
+		}
+	}
+	if !rep.OK {
+		os.Exit(1)
+	}
+}
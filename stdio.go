@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：从标准输入上传、下载到标准输出 ---------- */
+
+// stdioArg 作为 add 的本地文件表示标准输入，作为 get 的本地文件表示标准输出
+const stdioArg = "-"
+
+// addStdin 实现 "add - <remote>"：把标准输入作为上传正文按分块协议发送，大小事先未知。
+// 不支持分块上传的旧服务端需要先把全部内容读入内存，这里直接拒绝。
+// 服务端支持 sha256-trailer 时边发送边计算摘要并校验
+func (c *clientCmd) addStdin(args []string, remote string, fileOnly bool) {
+	switch {
+	case len(args) < 2:
+		usageFail(i18n.T("usage.missing_remote"))
+	case fileOnly:
+		usageFail(i18n.T("status.stdio_single"))
+	}
+	c.transfer = c.newTransferProgress("upload", remote)
+	cl := c.dial()
+	defer cl.Close()
+	if !cl.Streaming() {
+		c.failWith(i18n.T("status.stdin_unsupported"), nil, exitFailure)
+	}
+	start := time.Now()
+	st, err := cl.Upload(remote, os.Stdin)
+	if c.verbose {
+		fmt.Fprintln(os.Stderr, i18n.T("status.sent_stats", c.format.Size(st.Bytes), st.Chunks))
+	}
+	if c.verbose && st.Verified {
+		fmt.Fprintln(os.Stderr, i18n.T("status.verified"))
+	}
+	if err != nil {
+		c.fail(err)
+	}
+	elapsed := time.Since(start)
+	c.noteTransfer(st.Bytes, elapsed)
+	switch {
+	case c.json:
+		c.printTransfer(remote, "", st, elapsed)
+	case c.progress != progressJSON:
+		fmt.Println(i18n.T("status.upload_done", remote))
+	}
+}
+
+// getStdout 实现 "get <remote> -"：文件内容原样写到标准输出，状态、进度和错误都写到 stderr。
+// 校验不一致时内容已经写出，只能以非零退出码报告
+func (c *clientCmd) getStdout(remote string) {
+	c.stdoutData = true
+	if c.progress == progressAuto {
+		// 进度条和内容会出现在同一个终端上
+		c.progress = ""
+	}
+	remote = path.Join("/", remote)
+	c.transfer = c.newTransferProgress("download", remote)
+	cl := c.dial()
+	defer cl.Close()
+	st, err := cl.Download(remote, os.Stdout)
+	if err != nil {
+		var re *client.RemoteError
+		if errors.As(err, &re) {
+			fmt.Fprintln(os.Stderr, describeErr(err))
+		} else {
+			fmt.Fprintln(os.Stderr, i18n.T("status.download_failed", describeErr(err)))
+		}
+		cl.Close()
+		os.Exit(exitCode(err))
+	}
+	c.reportTransfer(cl, st)
+	c.noteCanonical(cl, remote)
+}
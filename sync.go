@@ -0,0 +1,523 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：sync 命令（本地到远程的单向同步） ---------- */
+
+// 先完整遍历本地目录和远程目录（逐层 /_list?format=long，给了 -cache-ttl 时其内列过的目录取自缓存，见 listcache.go），得出计划后再执行，
+// 计划和执行共用一个连接。文件比较默认看大小和修改时间：服务端支持 attrs 时上传保留本地的修改时间，
+// 两边的时间相差超过 -mtime-slack 就重新上传（与 pull 相同，不按时钟偏差换算）；这之前上传的文件远程时间是上传时间，会重新上传一次。
+// 旧版服务端或 -no-preserve 时远程文件的修改时间就是上次上传的时间，本地文件比它新（按时钟偏差换算、超过 -mtime-slack）才重新上传。
+// -checksum 改为比较 SHA-256，大小相同的文件由服务端读取整个文件给出摘要。
+// 反方向的 pull 共用遍历和计划，见 pull.go
+
+// syncEntry 是同步树中的一项，路径相对于同步根目录、以 / 分隔
+type syncEntry struct {
+	dir     bool
+	size    int64
+	modTime time.Time
+}
+
+// syncAction 是同步计划中的一步，目标在同步的接收方（sync 为远程，pull 为本地）
+type syncAction struct {
+	kind   string // mkdir、copy、delete
+	rel    string
+	dir    bool   // delete 的目标是目录
+	size   int64  // copy 的文件大小
+	reason string // copy 的原因：new、size、mtime、checksum、type
+}
+
+// syncStats 汇总一次同步的结果
+type syncStats struct {
+	copied  int
+	bytes   int64
+	skipped int
+	deleted int
+	failed  int
+}
+
+func (c *clientCmd) sync(args []string) {
+	fs := newFlagSet("client sync")
+	del := fs.Bool("delete", false, "delete remote files and directories that do not exist locally")
+	dryRun := fs.Bool("dry-run", false, "print the plan without transferring or deleting anything")
+	checksum := fs.Bool("checksum", false, "compare files by SHA-256 instead of size and modification time")
+	ifChanged := fs.Bool("if-changed", false, "when only the modification time differs, compare SHA-256 and skip files with the same content")
+	noVerify := fs.Bool("no-verify", false, "skip the SHA-256 check of the uploaded content")
+	noPreserve := fs.Bool("no-preserve", false, "do not give remote files the local modification time and permissions")
+	force := fs.Bool("f", false, "replace changed remote files even if the server refuses overwrites (-overwrite deny)")
+	parallel := c.registerParallel(fs)
+	retry := c.registerRetry(fs)
+	var filter filterFlags
+	filter.register(fs)
+	var guard guardFlags
+	guard.register(fs, false)
+	guard.registerYes(fs, "with -delete, skip the confirmation for a protected profile")
+	var cf listCacheFlags
+	cf.register(fs, 0)
+	args = parseFlags(fs, args)
+	filter.parse()
+	c.verify = !*noVerify && !*dryRun
+	c.noPreserve = *noPreserve
+	if err := retry(); err != nil {
+		usageFail(err)
+	}
+	// 不允许覆盖的服务端上，有变化的文件以 409 失败，-f 时才替换
+	c.force = *force
+	if len(args) < 2 {
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+	local, remote := args[0], path.Join("/", args[1])
+	if fi, err := os.Stat(local); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	} else if !fi.IsDir() {
+		fmt.Fprintln(os.Stderr, i18n.T("sync.not_dir", local))
+		os.Exit(1)
+	}
+	// -delete 以沙箱根为目标时会清掉本地没有的一切，与 get -r 一样需要显式确认
+	checkRemote := ""
+	if *del {
+		checkRemote = remote
+	}
+	if err := guard.checkRoots(local, checkRemote); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *del && !*dryRun {
+		if err := guard.confirmProtected(c.profile, c.server, "sync -delete "+remote); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	// 被排除的远程路径既不比较也不删除
+	tf := filter.local(local)
+	localTree, err := walkLocalTree(local, tf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	lc := c.openListCache(cf)
+	remoteTree, truncated, err := c.walkRemoteTree(cl, lc, remote, tf)
+	if err != nil {
+		c.fail(err)
+	}
+	if truncated && *del {
+		// 列表不完整时无法确定哪些远程文件本地没有
+		fmt.Fprintln(os.Stderr, i18n.T("sync.delete_truncated", remote))
+		*del = false
+	}
+
+	s := &syncer{c: c, cl: cl, local: local, remote: remote, checksum: *checksum, ifChanged: *ifChanged, preserved: cl.Preserving()}
+	if !*checksum && !s.preserved {
+		if err := s.measureClock(); err != nil {
+			c.fail(err)
+		}
+	}
+	plan, err := s.plan(localTree, remoteTree, *del)
+	if err != nil {
+		c.fail(err)
+	}
+	if *dryRun {
+		tf.report(os.Stdout, "sync.would_exclude")
+		for _, a := range plan {
+			target := path.Join(remote, a.rel)
+			switch a.kind {
+			case "copy":
+				fmt.Println(i18n.T("sync.would_upload", target, c.format.Size(a.size), a.reason))
+			case "mkdir":
+				fmt.Println(i18n.T("sync.would_mkdir", target))
+			case "delete":
+				fmt.Println(i18n.T("sync.would_delete", target))
+			}
+		}
+		fmt.Println(i18n.T("sync.dry_run_summary", s.st.copied, c.format.Size(s.st.bytes), s.st.skipped, s.st.deleted))
+		lc.save()
+		return
+	}
+	start := time.Now()
+	ok := s.run(plan, *parallel)
+	// 计划中的每一步（无论成败）都可能改变了远程目录
+	for _, a := range plan {
+		lc.changed(path.Join(remote, a.rel))
+	}
+	lc.save()
+	st := s.st
+	fmt.Println(i18n.T("sync.summary", st.copied, c.format.Size(st.bytes), st.skipped, st.deleted, st.failed))
+	if ok {
+		c.noteTransfer(st.bytes, time.Since(start))
+	}
+	if !ok || st.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// walkLocalTree 收集本地目录下的文件和目录（不含根目录本身）。与 add -r 一样跳过符号链接、特殊文件和 f 排除的路径
+func walkLocalTree(root string, f *treeFilter) (map[string]syncEntry, error) {
+	tree := map[string]syncEntry{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if f.skip(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case d.IsDir():
+			tree[rel] = syncEntry{dir: true}
+		case d.Type().IsRegular():
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			tree[rel] = syncEntry{size: fi.Size(), modTime: fi.ModTime()}
+		}
+		return nil
+	})
+	return tree, err
+}
+
+// walkRemoteTree 逐层列出远程目录，根目录不存在时返回空树，f 排除的目录不再列出。truncated 表示有目录的列表不完整。
+// lc 中未过期的目录不再列出，新列出的目录记入 lc
+func (c *clientCmd) walkRemoteTree(cl *client.Client, lc *listCache, root string, f *treeFilter) (tree map[string]syncEntry, truncated bool, err error) {
+	tree = map[string]syncEntry{}
+	queue := []string{""}
+	for len(queue) > 0 {
+		rel := queue[0]
+		queue = queue[1:]
+		res, err := lc.list(cl, path.Join(root, rel), false)
+		var re *client.RemoteError
+		if rel == "" && errors.As(err, &re) && re.Status == http.StatusNotFound {
+			return tree, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if res.Truncated {
+			truncated = true
+			if c.verbose {
+				fmt.Fprintln(os.Stderr, i18n.T("status.tree_truncated", path.Join(root, rel)))
+			}
+		}
+		for _, e := range res.Entries {
+			name := strings.TrimSuffix(e.Name, "/")
+			if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+				continue
+			}
+			child := path.Join(rel, name)
+			if f.skip(child, e.Dir) {
+				continue
+			}
+			tree[child] = syncEntry{dir: e.Dir, size: e.Size, modTime: e.ModTime}
+			if e.Dir {
+				queue = append(queue, child)
+			}
+		}
+	}
+	return tree, truncated, nil
+}
+
+// syncer 保存一次同步的连接和统计
+type syncer struct {
+	c         *clientCmd
+	cl        *client.Client
+	local     string
+	remote    string
+	pull      bool // 从远程同步到本地
+	checksum  bool
+	ifChanged bool // 只有修改时间不同的文件再比较 SHA-256，内容相同时不复制
+	preserved bool // 上传保留修改时间（见 client.SetPreserve），远程时间与本地直接比较
+	clock     client.ClockEstimate
+	mu        sync.Mutex // 并发传输时保护 st 和输出的顺序
+	st        syncStats
+}
+
+// measureClock 测量服务端与本机的时钟偏差，比较修改时间时用来换算远程时间
+func (s *syncer) measureClock() error {
+	est, err := s.cl.ClockOffset(clockSamples)
+	if err != nil {
+		return err
+	}
+	if est.Offset > client.ClockSkewWarn || est.Offset < -client.ClockSkewWarn {
+		fmt.Fprintln(os.Stderr, i18n.T("status.clock_skew", est.Offset.Round(time.Second)))
+	}
+	s.clock = est
+	return nil
+}
+
+// plan 比较发送方 src 和接收方 dst 两棵树，按路径顺序给出要创建的目录和要复制的文件，最后是要删除的接收方条目（del 时）。
+// 类型不同的条目（一方是文件、另一方是目录）只有 del 时才先删除接收方的那一项，否则复制会失败并计入失败数
+func (s *syncer) plan(src, dst map[string]syncEntry, del bool) ([]syncAction, error) {
+	rels := make([]string, 0, len(src))
+	for rel := range src {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	var plan, deletes []syncAction
+	for _, rel := range rels {
+		from := src[rel]
+		to, exists := dst[rel]
+		if exists && to.dir != from.dir && del {
+			deletes = append(deletes, syncAction{kind: "delete", rel: rel, dir: to.dir})
+			exists = false
+		}
+		if from.dir {
+			// 接收方是同名文件时创建目录会失败，计入失败数
+			if !exists || !to.dir {
+				plan = append(plan, syncAction{kind: "mkdir", rel: rel})
+			}
+			continue
+		}
+		reason, err := s.compare(rel, from, to, exists)
+		if err != nil {
+			return nil, err
+		}
+		if reason == "" {
+			s.st.skipped++
+			continue
+		}
+		plan = append(plan, syncAction{kind: "copy", rel: rel, size: from.size, reason: reason})
+		s.st.copied++
+		s.st.bytes += from.size
+	}
+	if del {
+		for rel, to := range dst {
+			if _, ok := src[rel]; !ok && !hasDeletedParent(src, dst, rel) {
+				deletes = append(deletes, syncAction{kind: "delete", rel: rel, dir: to.dir})
+			}
+		}
+		sort.Slice(deletes, func(i, j int) bool { return deletes[i].rel < deletes[j].rel })
+		s.st.deleted = len(deletes)
+	}
+	// 类型冲突的条目要在复制之前删除，其余删除放在最后
+	var first, last []syncAction
+	for _, d := range deletes {
+		if _, ok := src[d.rel]; ok {
+			first = append(first, d)
+		} else {
+			last = append(last, d)
+		}
+	}
+	return append(append(first, plan...), last...), nil
+}
+
+// hasDeletedParent 判断接收方 rel 的某个上级目录在发送方没有（或是同名文件），会被整个删除
+func hasDeletedParent(src, dst map[string]syncEntry, rel string) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		from, ok := src[dir]
+		if !ok || !from.dir && dst[dir].dir {
+			return true
+		}
+	}
+	return false
+}
+
+// compare 返回文件需要复制的原因，不需要时返回空串。
+// pull 和保留修改时间的 sync 复制后接收方的时间与发送方相同，不相等就复制；否则 sync 时接收方的修改时间是上传时间，发送方更新才复制
+func (s *syncer) compare(rel string, from, to syncEntry, exists bool) (string, error) {
+	switch {
+	case !exists:
+		return "new", nil
+	case to.dir:
+		return "type", nil
+	case from.size != to.size:
+		return "size", nil
+	case s.pull || s.preserved && !s.checksum:
+		if from.modTime.IsZero() {
+			// 旧服务端的列表没有修改时间，只比较大小
+			return "", nil
+		}
+		d := from.modTime.Sub(to.modTime)
+		if d > s.c.mtimeSlack || d < -s.c.mtimeSlack {
+			return s.mtimeChanged(rel)
+		}
+	case s.checksum:
+		same, err := s.sameContent(rel)
+		if err != nil {
+			return "", err
+		}
+		if !same {
+			return "checksum", nil
+		}
+	case from.modTime.After(s.clock.ToLocal(to.modTime).Add(s.c.mtimeSlack)):
+		return s.mtimeChanged(rel)
+	}
+	return "", nil
+}
+
+// mtimeChanged 返回只有修改时间不同的文件的复制原因：-if-changed 时内容相同的文件不复制
+func (s *syncer) mtimeChanged(rel string) (string, error) {
+	if !s.ifChanged {
+		return "mtime", nil
+	}
+	same, err := s.sameContent(rel)
+	if err != nil || same {
+		return "", err
+	}
+	return "checksum", nil
+}
+
+// sameContent 比较本地和远程的 rel 的 SHA-256
+func (s *syncer) sameContent(rel string) (bool, error) {
+	want, err := hashLocalFile(filepath.Join(s.local, filepath.FromSlash(rel)))
+	if err != nil {
+		return false, err
+	}
+	st, err := s.cl.StatHash(path.Join(s.remote, rel))
+	if err != nil {
+		return false, err
+	}
+	if st.SHA256 == "" {
+		return false, errors.New(i18n.T("stat.hash_unsupported"))
+	}
+	return st.SHA256 == want, nil
+}
+
+func hashLocalFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// run 按计划执行。单项失败时继续；连接不可用或服务端只读时停止并返回 false
+func (s *syncer) run(plan []syncAction, parallel int) bool {
+	do := func(cl *client.Client, a syncAction) (string, error) {
+		target := path.Join(s.remote, a.rel)
+		switch a.kind {
+		case "mkdir":
+			_, err := cl.Mkdir(target)
+			var re *client.RemoteError
+			if errors.As(err, &re) && re.Status == http.StatusMethodNotAllowed {
+				// 旧服务端没有 MKDIR，上传时会按需创建上级目录，只是空目录不会出现在远程
+				return target, nil
+			} else if err == nil {
+				fmt.Println(i18n.T("status.mkdir_done", target))
+			}
+			return target, err
+		case "copy":
+			return target, s.upload(cl, a, target)
+		}
+		err := cl.Delete(target, a.dir)
+		if err == nil {
+			s.mu.Lock()
+			s.st.deleted++
+			fmt.Println(i18n.T("status.delete_done", target))
+			s.mu.Unlock()
+		}
+		return target, err
+	}
+	fatal := func(err error) bool {
+		var re *client.RemoteError
+		var le *client.LocalReadError
+		return client.IsReadOnly(err) || !errors.As(err, &re) && !errors.As(err, &le)
+	}
+	return s.execute(plan, parallel, do, fatal)
+}
+
+// execute 执行 plan：复制之前的删除（类型冲突）和建目录依次在 s.cl 上进行，复制分给 parallel 个连接（见 runParallel），
+// 复制之后的删除（-delete）再依次进行。do 执行一项并返回其目标路径，暂时的失败按 -retries 重试（见 retrying）；
+// fatal 判断错误是否使连接不可用，此时不再开始新的项目并返回 false
+func (s *syncer) execute(plan []syncAction, parallel int, do func(cl *client.Client, a syncAction) (string, error), fatal func(error) bool) bool {
+	s.st = syncStats{skipped: s.st.skipped}
+	last := -1
+	var copies []syncAction
+	for i, a := range plan {
+		if a.kind == "copy" {
+			last = i
+			copies = append(copies, a)
+		}
+	}
+	ok := true
+	step := func(cl **client.Client, a syncAction) (stop bool) {
+		var target string
+		err := s.c.retrying(cl, func(cl *client.Client) (err error) {
+			target, err = do(cl, a)
+			return err
+		})
+		if err == nil {
+			return false
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.st.failed++
+		if fatal(err) {
+			if ok {
+				fmt.Fprintln(os.Stderr, describeErr(err))
+				ok = false
+			}
+			return true
+		}
+		fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", target, describeErr(err)))
+		return false
+	}
+	for _, a := range plan[:last+1] {
+		if a.kind != "copy" && step(&s.cl, a) {
+			return false
+		}
+	}
+	s.cl = s.c.runParallel(parallel, s.cl, len(copies), func(w *poolWorker, i int) bool {
+		return step(&w.cl, copies[i])
+	})
+	if !ok {
+		return false
+	}
+	for _, a := range plan[last+1:] {
+		if step(&s.cl, a) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *syncer) upload(cl *client.Client, a syncAction, target string) error {
+	f, err := os.Open(filepath.Join(s.local, filepath.FromSlash(a.rel)))
+	if err != nil {
+		return &client.LocalReadError{Err: err}
+	}
+	defer f.Close()
+	if _, err := cl.Upload(target, f); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.st.copied++
+	s.st.bytes += a.size
+	fmt.Println(i18n.T("status.tree_file_done", target, s.c.format.Size(a.size)))
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"wsbox/pkg/server"
+)
+
+// 服务端 -overwrite deny 时，sync 不加 -f 把有变化的文件计为失败并保留远程内容，加 -f 时替换
+func TestSyncOverwriteDeny(t *testing.T) {
+	t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+	sandbox := t.TempDir()
+	url := startTestServerConfig(t, server.Config{Dir: sandbox, Overwrite: server.OverwriteDeny})
+	src := t.TempDir()
+	file := filepath.Join(src, "a.txt")
+	os.WriteFile(file, []byte("one"), 0o644)
+	sync := func(args ...string) (int, string, string) {
+		t.Helper()
+		return runWsbox(t, append([]string{"client", "-s", url, "-token", testToken, "sync"}, append(args, src, "/dst")...)...)
+	}
+	if code, _, stderr := sync(); code != 0 {
+		t.Fatalf("first sync: exit %d: %s", code, stderr)
+	}
+
+	os.WriteFile(file, []byte("two!"), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(file, later, later)
+	code, stdout, stderr := sync()
+	if code != 1 || !strings.Contains(stdout, "1 failed") || !strings.Contains(stderr, "/dst/a.txt") {
+		t.Errorf("sync without -f: exit %d, stdout %q, stderr %q; want the changed file reported as failed", code, stdout, stderr)
+	}
+	if got, _ := os.ReadFile(filepath.Join(sandbox, "dst", "a.txt")); string(got) != "one" {
+		t.Errorf("sync without -f replaced the remote file: %q", got)
+	}
+
+	if code, _, stderr := sync("-f"); code != 0 {
+		t.Fatalf("sync -f: exit %d: %s", code, stderr)
+	}
+	if got, _ := os.ReadFile(filepath.Join(sandbox, "dst", "a.txt")); string(got) != "two!" {
+		t.Errorf("sync -f left %q, want the local content", got)
+	}
+}
+
+// 第二次同步没有要传的内容；只改了修改时间的文件在 -if-changed 时同样不传
+func TestSyncSecondRunSendsNothing(t *testing.T) {
+	t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+	url := startTestServer(t)
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "sub"), 0o755)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(src, "sub", "big.bin"), make([]byte, 300<<10), 0o644)
+	sync := func(args ...string) string {
+		t.Helper()
+		code, stdout, stderr := runWsbox(t, append([]string{"client", "-s", url, "-token", testToken, "sync"}, append(args, src, "/dst")...)...)
+		if code != 0 {
+			t.Fatalf("sync %v: exit %d: %s", args, code, stderr)
+		}
+		return stdout
+	}
+	const nothing = "0 files uploaded (0B), 2 unchanged"
+	if out := sync(); !strings.Contains(out, "2 files uploaded") {
+		t.Fatalf("first sync: %q", out)
+	}
+	if out := sync(); !strings.Contains(out, nothing) {
+		t.Errorf("second sync: %q, want %q", out, nothing)
+	}
+
+	later := time.Now().Add(time.Hour)
+	for _, p := range []string{"a.txt", "sub/big.bin"} {
+		os.Chtimes(filepath.Join(src, p), later, later)
+	}
+	if out := sync("-if-changed"); !strings.Contains(out, nothing) {
+		t.Errorf("sync -if-changed after touching every file: %q, want %q", out, nothing)
+	}
+}
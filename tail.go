@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：cat 与 tail 命令 ---------- */
+
+// tailReadMax 是 tail -f 每次读取新增内容的最大字节数，增长很快的文件分几次读完
+const tailReadMax = 4 << 20
+
+// cat 把一个或多个远程文件依次写到标准输出，共用一个连接；-n 时与 cat -n 一样给每行编号，编号跨文件连续
+func (c *clientCmd) cat(args []string) {
+	fs := newFlagSet("client cat")
+	number := fs.Bool("n", false, "number the output lines")
+	args = parseFlags(fs, args)
+	if len(args) < 1 {
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+
+	cl := c.dial()
+	defer cl.Close()
+	var out io.Writer = os.Stdout
+	if *number {
+		out = &lineNumberWriter{w: os.Stdout, start: true}
+	}
+	code := 0
+	for _, remote := range args {
+		if _, err := cl.Download(path.Join("/", remote), out); err != nil {
+			fmt.Fprintln(os.Stderr, remote+":", describeErr(err))
+			var re *client.RemoteError
+			var de *client.DigestError
+			if !errors.As(err, &re) && !errors.As(err, &de) {
+				// 连接上可能留有未读完的响应
+				cl.Close()
+				os.Exit(exitCode(err))
+			}
+			if code == 0 {
+				code = exitCode(err)
+			}
+		}
+	}
+	if code != 0 {
+		cl.Close()
+		os.Exit(code)
+	}
+}
+
+// lineNumberWriter 在每行开头写入 cat -n 格式的行号
+type lineNumberWriter struct {
+	w     io.Writer
+	line  int
+	start bool // 下一个字节是一行的开头
+}
+
+func (l *lineNumberWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if l.start {
+			l.line++
+			if _, err := fmt.Fprintf(l.w, "%6d\t", l.line); err != nil {
+				return written, err
+			}
+			l.start = false
+		}
+		n := len(p)
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			n = i + 1
+			l.start = true
+		}
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// tail 输出远程文件的最后 n 行，服务端只读取和返回这几行。
+// -f 时每隔 -s 查询一次文件大小，通过同一个连接读取新增的部分；文件变短（被截断或轮转）时从头开始
+func (c *clientCmd) tail(args []string) {
+	fs := newFlagSet("client tail")
+	lines := fs.Int("n", 10, "number of lines to print")
+	follow := fs.Bool("f", false, "keep printing data appended to the file")
+	interval := fs.Duration("s", 2*time.Second, "with -f, how often to check the file for new data")
+	args = parseFlags(fs, args)
+	if len(args) < 1 {
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+	if *lines < 0 || *interval <= 0 {
+		usageFail("-n must not be negative and -s must be positive")
+	}
+	remote := path.Join("/", args[0])
+
+	cl := c.dial()
+	defer cl.Close()
+	st, err := cl.Stat(remote)
+	switch {
+	case err != nil:
+		c.fail(err)
+	case !st.Exists:
+		fmt.Fprintln(os.Stderr, i18n.T("tail.not_file", remote))
+		os.Exit(exitNotFound)
+	case st.IsDir:
+		fmt.Fprintln(os.Stderr, i18n.T("tail.not_file", remote))
+		os.Exit(exitFailure)
+	}
+	data, err := cl.Tail(remote, *lines, st.Size)
+	if err != nil {
+		var re *client.RemoteError
+		if errors.As(err, &re) && re.Status == http.StatusNotFound {
+			// 文件存在但没有 /_tail：旧服务端把它当成了下载
+			fmt.Fprintln(os.Stderr, i18n.T("tail.unsupported"))
+			cl.Close()
+			os.Exit(exitFailure)
+		}
+		fmt.Fprintln(os.Stderr, describeErr(err))
+		cl.Close()
+		os.Exit(exitCode(err))
+	}
+	os.Stdout.Write(data)
+	if !*follow {
+		return
+	}
+
+	offset, missing := st.Size, false
+	for {
+		time.Sleep(*interval)
+		st, err := cl.Stat(remote)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, describeErr(err))
+			cl.Close()
+			os.Exit(exitCode(err))
+		}
+		if !st.Exists {
+			if !missing {
+				fmt.Fprintln(os.Stderr, i18n.T("tail.missing", remote))
+			}
+			missing = true
+			continue
+		}
+		if missing || st.Size < offset {
+			fmt.Fprintln(os.Stderr, i18n.T("tail.truncated", remote))
+			offset, missing = 0, false
+		}
+		for offset < st.Size {
+			chunk, err := cl.ReadRange(remote, offset, min(st.Size-offset, tailReadMax))
+			if err != nil {
+				var re *client.RemoteError
+				if errors.As(err, &re) && re.Status == http.StatusRequestedRangeNotSatisfiable {
+					// 两次请求之间文件被截断，下一轮重新判断
+					break
+				}
+				fmt.Fprintln(os.Stderr, describeErr(err))
+				cl.Close()
+				os.Exit(exitCode(err))
+			}
+			os.Stdout.Write(chunk)
+			offset += int64(len(chunk))
+		}
+	}
+}
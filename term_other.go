@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// errNoRawTerminal 表示当前平台不支持 browse 需要的终端原始模式
+var errNoRawTerminal = errors.New("browse needs a Linux terminal")
+
+func makeRaw(fd int) (func(), error) { return nil, errNoRawTerminal }
+
+// isTTY 在其他平台上退回字符设备的判断
+func isTTY(f *os.File) bool { return isTerminal(f) }
+
+func terminalSize(fd int) (cols, rows int, err error) { return 0, 0, errNoRawTerminal }
+
+func notifyResize(ch chan<- os.Signal) {}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：test 命令 ---------- */
+
+// test 命令的退出码，与 POSIX test 一致
+const (
+	testTrue  = 0
+	testFalse = 1
+	testError = 2
+)
+
+const testUsage = `usage: test [!] -e|-f|-d|-s <path>
+       test [!] <path> -nt|-ot <path>
+       test [!] <string>
+paths are remote unless prefixed with "local:"
+exit status: 0 true, 1 false, 2 error (bad syntax, connection or server failure)
+`
+
+// clockSamples 是估计时钟偏差时请求服务端时间的次数，取往返最短的一次
+const clockSamples = 3
+
+// tester 对一次 test 调用的所有远程操作数复用同一个连接
+type tester struct {
+	c     *clientCmd
+	cl    *client.Client
+	clock *client.ClockEstimate // 远程与本地操作数比较修改时间时才测量
+}
+
+func (c *clientCmd) test(args []string) {
+	t := &tester{c: c}
+	defer func() {
+		if t.cl != nil {
+			t.cl.Close()
+		}
+	}()
+	result, err := t.eval(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("test.error", err))
+		if errors.Is(err, errTestSyntax) {
+			fmt.Fprint(os.Stderr, testUsage)
+		}
+		os.Exit(testError)
+	}
+	if c.verbose {
+		fmt.Fprintln(os.Stderr, result)
+	}
+	if !result {
+		os.Exit(testFalse)
+	}
+}
+
+var errTestSyntax = errors.New("syntax error")
+
+// eval 按 POSIX 规则根据参数个数求值：0个为假，1个为非空字符串，
+// 2个为一元运算或 "! 字符串"，3个为二元运算或 "! 一元运算"，4个为 "! 二元运算"
+func (t *tester) eval(args []string) (bool, error) {
+	switch len(args) {
+	case 0:
+		return false, nil
+	case 1:
+		return args[0] != "", nil
+	case 2:
+		if args[0] == "!" {
+			return args[1] == "", nil
+		}
+		return t.unary(args[0], args[1])
+	case 3:
+		if isBinaryTestOp(args[1]) {
+			return t.binary(args[0], args[1], args[2])
+		}
+		if args[0] == "!" {
+			v, err := t.eval(args[1:])
+			return !v, err
+		}
+		return false, fmt.Errorf("%w: unknown binary operator %q", errTestSyntax, args[1])
+	case 4:
+		if args[0] == "!" {
+			v, err := t.eval(args[1:])
+			return !v, err
+		}
+	}
+	return false, fmt.Errorf("%w: too many arguments", errTestSyntax)
+}
+
+func isBinaryTestOp(op string) bool {
+	return op == "-nt" || op == "-ot"
+}
+
+func (t *tester) unary(op, operand string) (bool, error) {
+	switch op {
+	case "-e", "-f", "-d", "-s":
+	default:
+		return false, fmt.Errorf("%w: unknown unary operator %q", errTestSyntax, op)
+	}
+	st, err := t.stat(operand)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "-f":
+		return st.Exists && !st.IsDir, nil
+	case "-d":
+		return st.Exists && st.IsDir, nil
+	case "-s":
+		return st.Exists && st.Size > 0, nil
+	}
+	return st.Exists, nil
+}
+
+// binary 实现 -nt/-ot：与常见 shell 一致，一方不存在时存在的一方视为更新。
+// 远程与本地比较时，远程的修改时间先按测得的时钟偏差换算到本机时钟；相差不超过 -mtime-slack 时都不算更新
+func (t *tester) binary(a, op, b string) (bool, error) {
+	sa, err := t.stat(a)
+	if err != nil {
+		return false, err
+	}
+	sb, err := t.stat(b)
+	if err != nil {
+		return false, err
+	}
+	if isLocalOperand(a) != isLocalOperand(b) {
+		clock, err := t.remoteClock()
+		if err != nil {
+			return false, err
+		}
+		if isLocalOperand(a) {
+			sb.ModTime = clock.ToLocal(sb.ModTime)
+		} else {
+			sa.ModTime = clock.ToLocal(sa.ModTime)
+		}
+	}
+	if op == "-ot" {
+		sa, sb = sb, sa
+	}
+	switch {
+	case !sa.Exists:
+		return false, nil
+	case !sb.Exists:
+		return true, nil
+	}
+	return sa.ModTime.After(sb.ModTime.Add(t.c.mtimeSlack)), nil
+}
+
+func isLocalOperand(operand string) bool {
+	return strings.HasPrefix(operand, "local:")
+}
+
+// remoteClock 测量一次服务端与本机的时钟偏差，偏差较大时在 stderr 上提醒
+func (t *tester) remoteClock() (client.ClockEstimate, error) {
+	if t.clock != nil {
+		return *t.clock, nil
+	}
+	if err := t.dial(); err != nil {
+		return client.ClockEstimate{}, err
+	}
+	est, err := t.cl.ClockOffset(clockSamples)
+	if err != nil {
+		return client.ClockEstimate{}, err
+	}
+	if est.Offset > client.ClockSkewWarn || est.Offset < -client.ClockSkewWarn {
+		fmt.Fprintln(os.Stderr, i18n.T("status.clock_skew", est.Offset.Round(time.Second)))
+	}
+	if t.c.verbose {
+		fmt.Fprintln(os.Stderr, i18n.T("test.clock", est.Offset.Round(time.Millisecond), est.RTT.Round(time.Millisecond)))
+	}
+	t.clock = &est
+	return est, nil
+}
+
+func (t *tester) dial() error {
+	if t.cl != nil {
+		return nil
+	}
+	cl, err := t.c.connect(context.Background())
+	if err != nil {
+		return err
+	}
+	t.cl = cl
+	return nil
+}
+
+// stat 获取一个操作数的状态，"local:" 前缀表示本地路径，其余为远程路径
+func (t *tester) stat(operand string) (client.StatInfo, error) {
+	st, err := t.statOperand(operand)
+	if err == nil && t.c.verbose {
+		fmt.Fprintln(os.Stderr, i18n.T("test.operand", operand, st.Exists, st.IsDir, st.Size, t.c.format.Time(st.ModTime)))
+	}
+	return st, err
+}
+
+func (t *tester) statOperand(operand string) (client.StatInfo, error) {
+	if p, ok := strings.CutPrefix(operand, "local:"); ok {
+		st := client.StatInfo{Path: p}
+		fi, err := os.Stat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			return st, nil
+		}
+		if err != nil {
+			return st, err
+		}
+		st.Exists, st.IsDir, st.Size, st.ModTime = true, fi.IsDir(), fi.Size(), fi.ModTime()
+		return st, nil
+	}
+
+	if err := t.dial(); err != nil {
+		return client.StatInfo{}, err
+	}
+	st, err := t.cl.Stat(operand)
+	if err != nil {
+		var re *client.RemoteError
+		if errors.As(err, &re) {
+			return client.StatInfo{}, errors.New(re.Message())
+		}
+		return client.StatInfo{}, err
+	}
+	return *st, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"wsbox/pkg/server"
+)
+
+// test 的每个运算符、取反和出错的情况：结果只通过退出码表达（0 真、1 假、2 出错），不带 -v 时不输出任何内容
+func TestTestCommand(t *testing.T) {
+	t.Setenv("WSBOX_STATE_DIR", t.TempDir())
+	sandbox := t.TempDir()
+	url := startTestServerConfig(t, server.Config{Dir: sandbox})
+	old, recent := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.WriteFile(filepath.Join(sandbox, "f.txt"), []byte("data"), 0o644)
+	os.WriteFile(filepath.Join(sandbox, "empty.txt"), nil, 0o644)
+	os.Mkdir(filepath.Join(sandbox, "d"), 0o755)
+	os.WriteFile(filepath.Join(sandbox, "old.txt"), []byte("o"), 0o644)
+	os.WriteFile(filepath.Join(sandbox, "new.txt"), []byte("n"), 0o644)
+	os.Chtimes(filepath.Join(sandbox, "old.txt"), old, old)
+	os.Chtimes(filepath.Join(sandbox, "new.txt"), recent, recent)
+	local := filepath.Join(t.TempDir(), "local.txt")
+	os.WriteFile(local, []byte("l"), 0o644)
+	mid := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(local, mid, mid)
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-e", "/f.txt"}, testTrue},
+		{[]string{"-e", "/d"}, testTrue},
+		{[]string{"-e", "/missing"}, testFalse},
+		{[]string{"-f", "/f.txt"}, testTrue},
+		{[]string{"-f", "/d"}, testFalse},
+		{[]string{"-f", "/missing"}, testFalse},
+		{[]string{"-d", "/d"}, testTrue},
+		{[]string{"-d", "/f.txt"}, testFalse},
+		{[]string{"-d", "/missing"}, testFalse},
+		{[]string{"-s", "/f.txt"}, testTrue},
+		{[]string{"-s", "/empty.txt"}, testFalse},
+		{[]string{"-s", "/missing"}, testFalse},
+		{[]string{"-e", "local:" + local}, testTrue},
+		{[]string{"-e", "local:" + local + ".missing"}, testFalse},
+
+		{[]string{"/new.txt", "-nt", "/old.txt"}, testTrue},
+		{[]string{"/old.txt", "-nt", "/new.txt"}, testFalse},
+		{[]string{"/new.txt", "-nt", "/new.txt"}, testFalse},
+		{[]string{"/old.txt", "-ot", "/new.txt"}, testTrue},
+		{[]string{"/new.txt", "-ot", "/old.txt"}, testFalse},
+		{[]string{"/old.txt", "-nt", "/missing"}, testTrue},
+		{[]string{"/missing", "-nt", "/old.txt"}, testFalse},
+		{[]string{"/missing", "-ot", "/old.txt"}, testTrue},
+		{[]string{"/new.txt", "-nt", "local:" + local}, testTrue},
+		{[]string{"local:" + local, "-nt", "/new.txt"}, testFalse},
+		{[]string{"local:" + local, "-nt", "/old.txt"}, testTrue},
+
+		{[]string{"!", "-e", "/missing"}, testTrue},
+		{[]string{"!", "-e", "/f.txt"}, testFalse},
+		{[]string{"!", "/new.txt", "-nt", "/old.txt"}, testFalse},
+		{[]string{"!", "/old.txt", "-nt", "/new.txt"}, testTrue},
+
+		{nil, testFalse},
+		{[]string{""}, testFalse},
+		{[]string{"word"}, testTrue},
+		{[]string{"!", ""}, testTrue},
+		{[]string{"!", "word"}, testFalse},
+
+		{[]string{"-x", "/f.txt"}, testError},
+		{[]string{"/a", "-eq", "/b"}, testError},
+		{[]string{"!", "-x", "/f.txt"}, testError},
+		{[]string{"a", "b", "c", "d", "e"}, testError},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runWsbox(t, append([]string{"client", "-s", url, "-token", testToken, "test"}, tt.args...)...)
+		if code != tt.want {
+			t.Errorf("test %q: exit %d, want %d (stderr %q)", tt.args, code, tt.want, stderr)
+		}
+		if tt.want != testError && (stdout != "" || stderr != "") {
+			t.Errorf("test %q printed stdout %q, stderr %q; want nothing without -v", tt.args, stdout, stderr)
+		}
+	}
+
+	// 连接失败是错误而不是假
+	code, _, _ := runWsbox(t, "client", "-s", "ws://"+closedAddr(t)+"/ws", "-token", testToken, "test", "-e", "/f.txt")
+	if code != testError {
+		t.Errorf("test against a closed port: exit %d, want %d", code, testError)
+	}
+	// -v 时在 stderr 上给出结果
+	if code, _, stderr := runWsbox(t, "client", "-s", url, "-token", testToken, "-v", "test", "-d", "/d"); code != testTrue || stderr == "" {
+		t.Errorf("test -v -d /d: exit %d, stderr %q; want 0 and the result on stderr", code, stderr)
+	}
+}
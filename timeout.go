@@ -0,0 +1,35 @@
+package main
+
+import (
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：超时 ---------- */
+
+// 全局 -connect-timeout 限制建立连接，-op-timeout 限制每个请求等待响应（进度帧重新计时），
+// -transfer-stall-timeout 在传输中任何方向都没有数据时中止。超时后输出超时的阶段并以 exitConn 退出，
+// 传输命令的 -retries 会把它当作连接中断重试
+
+// clientTimeouts 是全局的超时标志，0表示不限
+type clientTimeouts struct {
+	connect, op, stall time.Duration
+}
+
+// apply 把超时设置到连接选项
+func (t clientTimeouts) apply(opts *client.Options) {
+	opts.ConnectTimeout, opts.OpTimeout, opts.StallTimeout = t.connect, t.op, t.stall
+}
+
+// describeTimeout 返回超时的本地化说明
+func describeTimeout(te *client.TimeoutError) string {
+	switch te.Phase {
+	case client.PhaseConnect:
+		return i18n.T("status.timeout_connect", te.Timeout)
+	case client.PhaseResponse:
+		return i18n.T("status.timeout_response", te.Timeout)
+	}
+	return i18n.T("status.timeout_transfer", te.Timeout)
+}
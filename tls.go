@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+)
+
+/* ---------- 客户端：wss:// 连接 ---------- */
+
+// tlsConfig 根据 -insecure 和 -cacert 构造TLS配置，两者都未指定时返回 nil，使用系统信任的根证书
+func (c *clientCmd) tlsConfig() (*tls.Config, error) {
+	if !c.insecure && c.caCert == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{InsecureSkipVerify: c.insecure}
+	if c.caCert != "" {
+		pem, err := os.ReadFile(c.caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New(c.caCert + ": no PEM certificates found")
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"wsbox/pkg/server"
+)
+
+// selfSignedCert 在临时目录中生成 127.0.0.1 的自签名证书和私钥，返回两个 PEM 文件的路径
+func selfSignedCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "wsbox test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+// 网关配置了自签名证书时以 wss:// 提供服务：客户端用 -cacert 信任它或用 -insecure 跳过校验都能完成 add/get，
+// 两者都不指定时以连接失败退出
+func TestTLSRoundTrip(t *testing.T) {
+	certFile, keyFile := selfSignedCert(t)
+	s, err := server.New(server.Config{Dir: t.TempDir(), Token: testToken, CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	url := "wss://" + ln.Addr().String() + "/ws"
+
+	local := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(local, []byte("over tls"), 0o644)
+	wsbox := func(args ...string) (int, string, string) {
+		return runWsbox(t, append([]string{"client", "-s", url, "-token", testToken}, args...)...)
+	}
+
+	if code, _, stderr := wsbox("-cacert", certFile, "add", local, "/a.txt"); code != 0 {
+		t.Fatalf("add with -cacert: exit %d: %s", code, stderr)
+	}
+	got := filepath.Join(t.TempDir(), "b.txt")
+	if code, _, stderr := wsbox("-cacert", certFile, "get", "/a.txt", got); code != 0 {
+		t.Fatalf("get with -cacert: exit %d: %s", code, stderr)
+	}
+	if b, _ := os.ReadFile(got); string(b) != "over tls" {
+		t.Errorf("get over wss:// wrote %q", b)
+	}
+	if code, stdout, stderr := wsbox("-insecure", "cat", "/a.txt"); code != 0 || stdout != "over tls" {
+		t.Errorf("cat with -insecure: exit %d, %q: %s", code, stdout, stderr)
+	}
+
+	code, _, stderr := wsbox("stat", "/a.txt")
+	if code != exitConn || !strings.Contains(stderr, "certificate") {
+		t.Errorf("untrusted certificate: exit %d, stderr %q; want exit %d and a certificate error", code, stderr, exitConn)
+	}
+	// 明文连接到 TLS 监听不会成功
+	if code, _, _ := runWsbox(t, "client", "-s", "ws://"+ln.Addr().String()+"/ws", "-token", testToken, "stat", "/a.txt"); code == 0 {
+		t.Errorf("a ws:// client was served by the TLS listener")
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"wsbox/internal/i18n"
+	"wsbox/pkg/client"
+)
+
+/* ---------- 客户端：watch 命令（持续上传本地改动） ---------- */
+
+// 每隔 -interval 遍历一次本地目录，与上一次的快照比较大小和修改时间得出改动。
+// 依赖只有 websocket，没有使用 inotify 之类的系统通知，轮询在所有平台和网络文件系统上表现一致。
+// 改动的路径在连续 -debounce 内没有再变化之后才处理，编辑器保存时的多次写入只上传一次。
+// 所有请求共用一个连接，连接断开后按 1s、2s、4s…（最长 30s）重连，期间的改动保留到重连之后。
+// 启动时的目录内容只作为基线，不上传；需要先对齐两边时先执行一次 sync
+
+const (
+	watchBackoffMin  = time.Second
+	watchBackoffMax  = 30 * time.Second
+	watchDefaultTick = time.Second
+)
+
+// watchChange 是一个等待处理的改动
+type watchChange struct {
+	at      time.Time // 最后一次看到变化的时间
+	removed bool
+	dir     bool // removed 时为删除前的类型，否则为现在的类型
+}
+
+// watcher 保存监视的状态，只由主协程使用
+type watcher struct {
+	c        *clientCmd
+	cl       *client.Client // 连接断开时为 nil
+	local    string
+	remote   string
+	del      bool
+	debounce time.Duration
+	flags    ignoreRules // -exclude 和 -include
+
+	rules     ignoreRules // .wsboxignore 的规则在前，flags 在后
+	ignoreMod time.Time
+	prev      map[string]syncEntry
+	pending   map[string]watchChange
+
+	backoff time.Duration
+	retryAt time.Time
+
+	st syncStats
+}
+
+func (c *clientCmd) watch(args []string) {
+	fs := newFlagSet("client watch")
+	del := fs.Bool("delete", false, "delete the remote copy when a local file or directory is removed")
+	interval := fs.Duration("interval", watchDefaultTick, "how often the local directory is scanned for changes")
+	debounce := fs.Duration("debounce", 500*time.Millisecond, "wait until a changed file has been stable this long before uploading it")
+	noVerify := fs.Bool("no-verify", false, "skip the SHA-256 check of the uploaded content")
+	force := fs.Bool("f", false, "replace changed remote files even if the server refuses overwrites (-overwrite deny)")
+	var filter filterFlags
+	filter.register(fs)
+	var guard guardFlags
+	guard.register(fs, false)
+	args = parseFlags(fs, args)
+	filter.parse()
+	c.verify = !*noVerify
+	// 与 sync 一样，只有 -f 时才在不允许覆盖的服务端上替换远程副本
+	c.force = *force
+	if len(args) < 2 {
+		usageFail(i18n.T("usage.missing_remote"))
+	}
+	if *interval <= 0 || *debounce < 0 {
+		usageFail("-interval must be positive and -debounce must not be negative")
+	}
+	local, remote := args[0], path.Join("/", args[1])
+	if fi, err := os.Stat(local); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	} else if !fi.IsDir() {
+		fmt.Fprintln(os.Stderr, i18n.T("sync.not_dir", local))
+		os.Exit(1)
+	}
+	checkRemote := ""
+	if *del {
+		checkRemote = remote
+	}
+	if err := guard.checkRoots(local, checkRemote); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	w := &watcher{c: c, local: local, remote: remote, del: *del, debounce: *debounce, flags: filter.rules, pending: map[string]watchChange{}}
+
+	w.cl = c.dial()
+	var err error
+	if w.prev, err = w.scan(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Fprintln(os.Stderr, i18n.T("watch.start", local, remote))
+	for sleepCtx(ctx, *interval) {
+		w.tick(false)
+	}
+	// 正在进行的上传在收到信号时已经完成；之后的第二个信号直接结束进程
+	stop()
+	fmt.Fprintln(os.Stderr, i18n.T("watch.flushing"))
+	w.tick(true)
+	if w.cl != nil {
+		w.cl.Close()
+	}
+	st := w.st
+	fmt.Println(i18n.T("watch.summary", st.copied, c.format.Size(st.bytes), st.deleted, st.failed))
+	if len(w.pending) > 0 {
+		fmt.Fprintln(os.Stderr, i18n.T("watch.unflushed", len(w.pending)))
+		os.Exit(1)
+	}
+	if st.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadIgnore 在 .wsboxignore 改变时重新读取，规则的写法见 ignore.go
+func (w *watcher) loadIgnore() {
+	name := filepath.Join(w.local, ignoreFileName)
+	fi, err := os.Stat(name)
+	if err != nil {
+		w.rules, w.ignoreMod = w.flags, time.Time{}
+		return
+	}
+	if fi.ModTime().Equal(w.ignoreMod) {
+		return
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	defer f.Close()
+	w.rules, w.ignoreMod = append(readIgnore(f, name), w.flags...), fi.ModTime()
+}
+
+func (w *watcher) ignored(rel string, dir bool) bool {
+	_, ok := w.rules.match(rel, dir)
+	return ok
+}
+
+// scan 遍历本地目录，与 walkLocalTree 相同，但规则随 .wsboxignore 的修改更新，遍历期间被删除的条目直接略过
+func (w *watcher) scan() (map[string]syncEntry, error) {
+	w.loadIgnore()
+	tree := map[string]syncEntry{}
+	err := filepath.WalkDir(w.local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p != w.local && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if p == w.local {
+			return nil
+		}
+		rel, _ := filepath.Rel(w.local, p)
+		rel = filepath.ToSlash(rel)
+		if w.ignored(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case d.IsDir():
+			tree[rel] = syncEntry{dir: true}
+		case d.Type().IsRegular():
+			fi, err := d.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			tree[rel] = syncEntry{size: fi.Size(), modTime: fi.ModTime()}
+		}
+		return nil
+	})
+	return tree, err
+}
+
+// tick 扫描一次并处理已经稳定的改动；final 时不等待 -debounce，处理全部改动
+func (w *watcher) tick(final bool) {
+	cur, err := w.scan()
+	if err != nil {
+		// 监视目录暂时不可读（例如被整体替换）时保留上一次的快照，下次再试
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	now := time.Now()
+	for rel, e := range cur {
+		old, ok := w.prev[rel]
+		if !ok || old.dir != e.dir || old.size != e.size || !old.modTime.Equal(e.modTime) {
+			w.pending[rel] = watchChange{at: now, dir: e.dir}
+		}
+	}
+	for rel, old := range w.prev {
+		if _, ok := cur[rel]; !ok {
+			if w.del {
+				w.pending[rel] = watchChange{at: now, removed: true, dir: old.dir}
+			} else {
+				delete(w.pending, rel)
+			}
+		}
+	}
+	w.prev = cur
+
+	var ready []string
+	for rel, ch := range w.pending {
+		if final || now.Sub(ch.at) >= w.debounce {
+			ready = append(ready, rel)
+		}
+	}
+	if len(ready) == 0 || !w.connected(final) {
+		return
+	}
+	// 删除在前，先删上级目录时其中的条目不再单独删除；之后按路径顺序建目录和上传，上级目录总在前面
+	sort.Slice(ready, func(i, j int) bool {
+		ri, rj := w.pending[ready[i]].removed, w.pending[ready[j]].removed
+		if ri != rj {
+			return ri
+		}
+		return ready[i] < ready[j]
+	})
+	for _, rel := range ready {
+		ch := w.pending[rel]
+		if ch.removed && w.parentRemoved(rel) {
+			delete(w.pending, rel)
+			continue
+		}
+		if !w.apply(rel, ch) {
+			return
+		}
+	}
+}
+
+// parentRemoved 判断 rel 的某个上级目录也在等待删除（整个删除时会一并删除 rel）
+func (w *watcher) parentRemoved(rel string) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if ch, ok := w.pending[dir]; ok && ch.removed {
+			return true
+		}
+	}
+	return false
+}
+
+// apply 处理一个改动，完成或失败（计入失败数）后从 pending 中移除。连接不可用时保留该改动、断开连接并返回 false
+func (w *watcher) apply(rel string, ch watchChange) bool {
+	target := path.Join(w.remote, rel)
+	var err error
+	switch {
+	case ch.removed:
+		err = w.cl.Delete(target, ch.dir)
+		var re *client.RemoteError
+		if errors.As(err, &re) && re.Status == http.StatusNotFound {
+			err = nil
+		} else if err == nil {
+			w.st.deleted++
+			fmt.Println(i18n.T("status.delete_done", target))
+		}
+	case ch.dir:
+		var created bool
+		created, err = w.cl.Mkdir(target)
+		var re *client.RemoteError
+		if errors.As(err, &re) && re.Status == http.StatusMethodNotAllowed {
+			// 旧服务端没有 MKDIR，目录中的文件上传时会创建它
+			err = nil
+		} else if created {
+			fmt.Println(i18n.T("status.mkdir_done", target))
+		}
+	default:
+		err = w.upload(rel, target)
+	}
+	var re *client.RemoteError
+	var le *client.LocalReadError
+	switch {
+	case err == nil:
+	case errors.As(err, &le) && errors.Is(err, fs.ErrNotExist):
+		// 扫描之后文件又被删除，下一次扫描会看到
+	case errors.As(err, &re) || errors.As(err, &le):
+		w.st.failed++
+		fmt.Fprintln(os.Stderr, i18n.T("status.tree_file_failed", target, describeErr(err)))
+	default:
+		fmt.Fprintln(os.Stderr, i18n.T("watch.disconnected", describeErr(err)))
+		w.cl.Close()
+		w.cl = nil
+		w.backoff = watchBackoffMin
+		w.retryAt = time.Now().Add(w.backoff)
+		return false
+	}
+	delete(w.pending, rel)
+	return true
+}
+
+func (w *watcher) upload(rel, target string) error {
+	f, err := os.Open(filepath.Join(w.local, filepath.FromSlash(rel)))
+	if err != nil {
+		return &client.LocalReadError{Err: err}
+	}
+	defer f.Close()
+	st, err := w.cl.Upload(target, f)
+	if err != nil {
+		return err
+	}
+	w.st.copied++
+	w.st.bytes += st.Bytes
+	fmt.Println(i18n.T("status.tree_file_done", target, w.c.format.Size(st.Bytes)))
+	return nil
+}
+
+// connected 在连接断开时按退避时间重连，返回是否有可用的连接。final 时不等待退避，立即再试一次
+func (w *watcher) connected(final bool) bool {
+	if w.cl != nil {
+		return true
+	}
+	if !final && time.Now().Before(w.retryAt) {
+		return false
+	}
+	cl, err := w.c.dialWorker()
+	if err != nil {
+		w.backoff = min(w.backoff*2, watchBackoffMax)
+		w.retryAt = time.Now().Add(w.backoff)
+		fmt.Fprintln(os.Stderr, i18n.T("watch.reconnect_failed", describeErr(err), w.backoff))
+		return false
+	}
+	w.cl = cl
+	fmt.Fprintln(os.Stderr, i18n.T("watch.reconnected"))
+	return true
+}